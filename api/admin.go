@@ -0,0 +1,47 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Key của các route quản trị (ADMIN_API_KEY) khi không có TENANTS_FILE; rỗng: các route này bị tắt
+var adminAPIKey string
+
+// --- Middleware cho các route quản trị (thống kê, danh sách worker) ---
+// Có TENANTS_FILE: API key phải thuộc tenant có "admin": true (chạy sau authenticate)
+// Không có: yêu cầu ADMIN_API_KEY qua header X-API-Key hoặc Authorization: Bearer
+func requireAdmin(c *gin.Context) {
+	if tenants != nil {
+		if !callerTenant(c).Admin {
+			respondError(c, http.StatusForbidden, codeAdminRequired, "This route requires the API key of an admin tenant")
+			return
+		}
+		c.Next()
+		return
+	}
+	key := c.GetHeader("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if adminAPIKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminAPIKey)) != 1 {
+		respondError(c, http.StatusForbidden, codeAdminRequired, "This route requires ADMIN_API_KEY")
+		return
+	}
+	c.Next()
+}
+
+// --- Middleware của /api/stats ---
+// Thống kê liệt kê các job tốn tài nguyên nhất của mọi tenant nên cần quyền admin khi
+// có TENANTS_FILE hoặc ADMIN_API_KEY; không có cả hai (một tenant, chưa cấu hình quản trị)
+// route vẫn mở như trước khi có các route quản trị
+func requireAdminIfConfigured(c *gin.Context) {
+	if tenants == nil && adminAPIKey == "" {
+		c.Next()
+		return
+	}
+	requireAdmin(c)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/archive"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// --- Handler trả về job đã lưu trữ (trạng thái, details, văn bản, PDF) ---
+// Dùng khi /api/status trả về 404 vì key Redis của job đã hết hạn
+func handleArchivedJob(c *gin.Context) {
+	record, ok := loadArchivedJob(c)
+	if !ok {
+		return
+	}
+	response := struct {
+		*archive.Record
+		PDFURL       string     `json:"pdf_url,omitempty"`
+		PDFExpiresAt *time.Time `json:"pdf_url_expires_at,omitempty"`
+	}{Record: record}
+	if record.PDFKey != "" {
+		// Link tải PDF có chữ ký, như download_url của status
+		pdfURL, expires := signedURL("/api/archive/" + record.JobID + "/pdf")
+		expires = expires.UTC()
+		response.PDFURL, response.PDFExpiresAt = pdfURL, &expires
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// --- Handler tải PDF của job đã lưu trữ ---
+func handleArchivedPDF(c *gin.Context) {
+	record, ok := loadArchivedJob(c)
+	if !ok {
+		return
+	}
+	if record.PDFKey == "" {
+		respondError(c, http.StatusNotFound, codePDFNotFound, "No PDF archived for this job", gin.H{"status": record.Status})
+		return
+	}
+	servePDF(c, archiveStore, record.PDFKey, record.JobID+".pdf")
+}
+
+func loadArchivedJob(c *gin.Context) (*archive.Record, bool) {
+	jobID := c.Param("job_id")
+	record, err := archive.Load(c.Request.Context(), archiveStore, jobID)
+	if err == storage.ErrNotFound {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found in archive")
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading archived job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to load archived job")
+		return nil, false
+	}
+	return record, true
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// Content-Type của các file trung gian
+var artifactContentTypes = map[string]string{
+	model.ArtifactOCR:      "text/plain; charset=utf-8",
+	model.ArtifactFiltered: "image/png",
+	model.ArtifactCleaned:  "text/plain; charset=utf-8",
+}
+
+// --- Các file trung gian worker đã lưu (details "artifacts") ---
+// Không có bước làm sạch: văn bản đưa vào bước dịch (cleaned) là văn bản OCR
+func jobArtifacts(details map[string]string) []string {
+	if details["artifacts"] == "" {
+		return nil
+	}
+	names := strings.Split(details["artifacts"], ",")
+	if slices.Contains(names, model.ArtifactOCR) && !slices.Contains(names, model.ArtifactCleaned) {
+		names = append(names, model.ArtifactCleaned)
+	}
+	return names
+}
+
+// --- Link tải có chữ ký của các file trung gian ---
+func artifactLinks(jobID string, details map[string]string) gin.H {
+	names := jobArtifacts(details)
+	if names == nil {
+		return nil
+	}
+	links := gin.H{}
+	for _, name := range names {
+		downloadURL, expires := signedURL(fmt.Sprintf("/api/jobs/%s/artifacts/%s", jobID, name))
+		links[name] = gin.H{"download_url": downloadURL, "download_expires_at": expires.UTC()}
+	}
+	return links
+}
+
+// --- GET /api/jobs/:job_id/artifacts/:name: file trung gian của job, để gỡ lỗi bản dịch sai ---
+// ocr: văn bản OCR trước khi làm sạch, filtered: ảnh đã lọc đưa vào OCR (trang đầu),
+// cleaned: văn bản đưa vào bước dịch. Dùng được cả với job lỗi.
+func handleJobArtifact(c *gin.Context) {
+	jobID, name := c.Param("job_id"), c.Param("name")
+	file, ok := model.ArtifactFiles[name]
+	if !ok {
+		respondError(c, http.StatusNotFound, codeArtifactNotFound, fmt.Sprintf("Unknown artifact %s, must be ocr, filtered or cleaned", name))
+		return
+	}
+	job, err := jobStore.Load(c.Request.Context(), jobID)
+	if err == model.ErrNotFound {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting artifacts from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job details")
+		return
+	}
+	if !slices.Contains(jobArtifacts(job.Details), name) {
+		respondError(c, http.StatusNotFound, codeArtifactNotFound, fmt.Sprintf("Artifact %s is not available for this job", name), gin.H{"status": job.Status})
+		return
+	}
+	if name == model.ArtifactCleaned && !slices.Contains(strings.Split(job.Details["artifacts"], ","), name) {
+		file = model.ArtifactFiles[model.ArtifactOCR] // Văn bản OCR được dịch nguyên vẹn
+	}
+	recordHistory(c, jobID, model.HistoryEvent{Type: model.HistoryDownloaded, Detail: "artifact:" + name})
+	serveArtifact(c, artifacts, model.ArtifactKey(jobID, file), jobID+"-"+name+path.Ext(file), artifactContentTypes[name], codeArtifactNotFound)
+}
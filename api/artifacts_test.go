@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+func TestJobArtifacts(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.GET("/api/jobs/:job_id/artifacts/:name", requireSignature, handleJobArtifact)
+	downloadKey, downloadURLTTL = []byte("0123456789abcdef0123456789abcdef"), time.Minute
+	dir := t.TempDir()
+	artifacts = storage.NewFileStorage(dir)
+	t.Cleanup(func() { artifacts = nil })
+
+	jobID := model.TenantJobID("acme", "job1")
+	for file, data := range map[string]string{"ocr.txt": "He1lo wor1d", "filtered.png": "\x89PNG"} {
+		path := filepath.Join(dir, model.ArtifactKey(jobID, file))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, []byte(data), 0o644)
+	}
+	jobStore.SetStatus(ctx, jobID, model.StatusFailed, "Translation error")
+	jobStore.SaveDetails(ctx, jobID, map[string]string{"artifacts": "filtered,ocr"})
+
+	links := artifactLinks(jobID, map[string]string{"artifacts": "filtered,ocr"})
+	if len(links) != 3 {
+		t.Fatalf("links = %v, want filtered, ocr and cleaned", links)
+	}
+	get := func(name string) (int, string) {
+		link, _ := signedURL("/api/jobs/" + jobID + "/artifacts/" + name)
+		w := do(router, "GET", link, "", "")
+		return w.Code, w.Body.String()
+	}
+	for name, want := range map[string]string{
+		"ocr":      "He1lo wor1d",
+		"filtered": "\x89PNG",
+		"cleaned":  "He1lo wor1d", // Không có bước làm sạch: văn bản OCR
+	} {
+		if code, body := get(name); code != http.StatusOK || body != want {
+			t.Errorf("%s: %d %q, want %q", name, code, body, want)
+		}
+	}
+	if code, _ := get("input"); code != http.StatusNotFound {
+		t.Errorf("unknown artifact: %d", code)
+	}
+	if w := do(router, "GET", "/api/jobs/"+jobID+"/artifacts/ocr", "acme-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("unsigned link: %d", w.Code)
+	}
+
+	jobStore.SaveDetails(ctx, jobID, map[string]string{"artifacts": "ocr,cleaned"})
+	if code, _ := get("cleaned"); code != http.StatusNotFound {
+		t.Errorf("cleaned text missing from storage: %d", code)
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/broker"
+)
+
+const backpressureCheckInterval = 5 * time.Second // Độ sâu hàng đợi được đọc lại tối đa một lần mỗi khoảng này
+
+// --- Backpressure: từ chối job mới khi hàng đợi của worker quá dài ---
+// BACKPRESSURE_MAX_LAG: số message chờ (Kafka: lag của consumer group) tối đa, 0 hoặc không đặt: tắt
+// BACKPRESSURE_RETRY_AFTER: giá trị header Retry-After của lỗi 503 (mặc định 30s)
+type backpressure struct {
+	maxLag     int64
+	retryAfter time.Duration
+
+	mu        sync.Mutex
+	depth     broker.QueueDepth
+	err       error
+	checkedAt time.Time
+}
+
+var queueBackpressure = &backpressure{retryAfter: 30 * time.Second}
+
+func backpressureFromEnv() (*backpressure, error) {
+	b := &backpressure{retryAfter: 30 * time.Second}
+	if v := os.Getenv("BACKPRESSURE_MAX_LAG"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("BACKPRESSURE_MAX_LAG must be a non-negative integer, got %q", v)
+		}
+		b.maxLag = n
+	}
+	if v := os.Getenv("BACKPRESSURE_RETRY_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("BACKPRESSURE_RETRY_AFTER must be a duration of at least 1s, got %q", v)
+		}
+		b.retryAfter = d
+	}
+	return b, nil
+}
+
+// Độ sâu hàng đợi, đọc lại từ broker khi giá trị đã lưu cũ hơn backpressureCheckInterval
+// (mọi request upload dùng chung một lần đọc, không gọi broker cho từng request)
+func (b *backpressure) queueDepth(ctx context.Context) (broker.QueueDepth, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Since(b.checkedAt) < backpressureCheckInterval {
+		return b.depth, b.err
+	}
+	inspector, ok := jobBroker.(broker.DepthInspector)
+	if !ok {
+		return broker.QueueDepth{Broker: jobBroker.Name()}, fmt.Errorf("queue depth not supported by broker %s", jobBroker.Name())
+	}
+	b.depth, b.err = inspector.Depth(ctx)
+	b.checkedAt = time.Now()
+	return b.depth, b.err
+}
+
+// Lỗi 503 + Retry-After khi số message chờ vượt BACKPRESSURE_MAX_LAG; nil nếu nhận được job.
+// Không đọc được độ sâu hàng đợi thì vẫn nhận job (broker lỗi sẽ làm enqueue lỗi sau đó)
+func (b *backpressure) check(ctx context.Context) *jobError {
+	if b.maxLag <= 0 {
+		return nil
+	}
+	depth, err := b.queueDepth(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to get queue depth for backpressure: %v", err)
+		return nil
+	}
+	if depth.Pending <= b.maxLag {
+		return nil
+	}
+	retryAfter := int(math.Ceil(b.retryAfter.Seconds()))
+	jobErr := newJobError(http.StatusServiceUnavailable, codeQueueOverloaded, "Too many jobs waiting for the workers, retry later",
+		gin.H{"pending": depth.Pending, "max_lag": b.maxLag, "retry_after_s": retryAfter})
+	jobErr.retryAfter = retryAfter
+	return jobErr
+}
+
+// --- Handler trả về lag của consumer group (theo partition với Kafka) và trạng thái backpressure ---
+// GET /api/admin/queue
+func handleAdminQueue(c *gin.Context) {
+	b := queueBackpressure
+	depth, err := b.queueDepth(c.Request.Context())
+	response := gin.H{
+		"queue": depth,
+		"backpressure": gin.H{
+			"enabled":       b.maxLag > 0,
+			"max_lag":       b.maxLag,
+			"retry_after_s": int(math.Ceil(b.retryAfter.Seconds())),
+			"active":        err == nil && b.maxLag > 0 && depth.Pending > b.maxLag,
+		},
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to get queue depth from %s: %v", jobBroker.Name(), err)
+		response["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/broker"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// fakeBroker trả về độ sâu hàng đợi cố định
+type fakeBroker struct{ pending int64 }
+
+func (b *fakeBroker) Name() string                                        { return "fake" }
+func (b *fakeBroker) Publish(context.Context, messaging.JobMessage) error { return nil }
+func (b *fakeBroker) Close() error                                        { return nil }
+func (b *fakeBroker) Depth(context.Context) (broker.QueueDepth, error) {
+	return broker.QueueDepth{Broker: "fake", Pending: b.pending}, nil
+}
+
+func TestBackpressureCheck(t *testing.T) {
+	fake := &fakeBroker{pending: 50}
+	jobBroker = fake
+	t.Cleanup(func() { jobBroker = nil })
+	ctx := context.Background()
+
+	b := &backpressure{maxLag: 100, retryAfter: 1500 * time.Millisecond}
+	if jobErr := b.check(ctx); jobErr != nil {
+		t.Fatalf("check with lag below the limit = %v, want nil", jobErr)
+	}
+
+	// Độ sâu được giữ trong backpressureCheckInterval: cần đọc lại để thấy lag mới
+	fake.pending = 150
+	if jobErr := b.check(ctx); jobErr != nil {
+		t.Fatal("depth read again before backpressureCheckInterval")
+	}
+	b.checkedAt = b.checkedAt.Add(-backpressureCheckInterval)
+	jobErr := b.check(ctx)
+	if jobErr == nil || jobErr.status != http.StatusServiceUnavailable || jobErr.code != codeQueueOverloaded {
+		t.Fatalf("check with lag above the limit = %+v, want 503 %s", jobErr, codeQueueOverloaded)
+	}
+	if jobErr.retryAfter != 2 {
+		t.Errorf("retryAfter = %d, want 2 (1.5s rounded up)", jobErr.retryAfter)
+	}
+
+	if jobErr := (&backpressure{}).check(ctx); jobErr != nil {
+		t.Errorf("check without BACKPRESSURE_MAX_LAG = %v, want nil", jobErr)
+	}
+}
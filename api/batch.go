@@ -0,0 +1,435 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+const (
+	batchDefaultMaxEntries = 100       // Số file tối đa mặc định trong một file ZIP
+	batchDefaultMaxBytes   = 100 << 20 // Kích thước file ZIP và tổng dung lượng giải nén tối đa mặc định (100 MiB)
+)
+
+var (
+	batchMaxEntries       = batchDefaultMaxEntries // BATCH_MAX_ENTRIES
+	batchMaxBytes   int64 = batchDefaultMaxBytes   // BATCH_MAX_BYTES; mỗi file trong ZIP còn bị giới hạn bởi UPLOAD_MAX_BYTES
+)
+
+// Trạng thái của mục không tạo được job (mục có job mang trạng thái của job)
+const (
+	batchEntrySkipped  = "skipped"  // Không phải ảnh/PDF (thư mục bị bỏ qua, không liệt kê)
+	batchEntryRejected = "rejected" // Đường dẫn không an toàn, quá lớn, hoặc tạo job lỗi (hạn mức, hàng đợi...)
+	batchEntryExpired  = "expired"  // Job con đã hết hạn hoặc bị xóa
+)
+
+// --- Đọc giới hạn của file ZIP từ biến môi trường ---
+func initBatchLimits() error {
+	batchMaxEntries, batchMaxBytes = batchDefaultMaxEntries, batchDefaultMaxBytes
+	if raw := os.Getenv("BATCH_MAX_ENTRIES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("BATCH_MAX_ENTRIES must be a positive integer, got %q", raw)
+		}
+		batchMaxEntries = n
+	}
+	if raw := os.Getenv("BATCH_MAX_BYTES"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("BATCH_MAX_BYTES must be a positive integer, got %q", raw)
+		}
+		batchMaxBytes = n
+	}
+	return nil
+}
+
+// Một file trong ZIP
+type batchEntry struct {
+	Name   string `json:"name"` // Đường dẫn trong file ZIP
+	Size   int64  `json:"size"` // Dung lượng giải nén
+	JobID  string `json:"job_id,omitempty"`
+	Status string `json:"status"` // Trạng thái của job con, hoặc skipped/rejected/expired
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Manifest của lô job tạo từ một file ZIP, lưu ở batch:{id} cùng thời hạn với job con
+type batch struct {
+	ID        string       `json:"batch_id"`
+	Filename  string       `json:"filename"`
+	CreatedAt time.Time    `json:"created_at"`
+	Entries   []batchEntry `json:"entries"`
+	// PDF gộp văn bản của mọi job con, tạo khi tất cả đã xong (nil: lô không có job con)
+	Combined  *batchCombined  `json:"combined,omitempty"`
+	Retention model.Retention `json:"retention"` // Thời hạn lưu của tenant, áp dụng cho PDF gộp
+}
+
+func batchKey(id string) string { return "batch:" + id }
+
+// --- Handler nhận file ZIP nhiều ảnh, mỗi ảnh/PDF hợp lệ thành một job con ---
+// POST /api/batches: trường "archive" là file ZIP, các trường form khác như /api/upload áp dụng cho
+// mọi job con. Trả về manifest với trạng thái từng mục; theo dõi tiếp qua GET /api/batches/:batch_id.
+func handleCreateBatch(c *gin.Context) {
+	archive, cleanup, jerr := readMultipartFile(c, "archive", batchMaxBytes)
+	defer cleanup()
+	if jerr != nil {
+		jerr.respond(c)
+		return
+	}
+	if archive == nil {
+		respondError(c, http.StatusBadRequest, codeInvalidImage, "ZIP archive is required (form field 'archive')")
+		return
+	}
+	if c.PostForm("source_job_id") != "" {
+		respondError(c, http.StatusBadRequest, codeUnsupportedOption, "source_job_id is not supported for batches")
+		return
+	}
+
+	caller := callerTenant(c)
+	b := &batch{ID: model.TenantJobID(caller.ID, uuid.New().String()), Filename: filepath.Base(archive.name), CreatedAt: time.Now().UTC(), Retention: retentionPolicy(caller)}
+	zipPath := filepath.Join(cfg.UploadDir(), ".incoming", "batch-"+b.ID+".zip")
+	if err := archive.save(zipPath); err != nil {
+		log.Printf("Error saving archive of batch %s: %v", b.ID, err)
+		respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to save uploaded file")
+		return
+	}
+	defer os.Remove(zipPath) // Các file đã giải nén được chuyển sang thư mục upload của job con
+
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidArchive, "The uploaded file is not a valid ZIP archive")
+		return
+	}
+	defer reader.Close()
+	files := make([]*zip.File, 0, len(reader.File))
+	var total uint64
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files = append(files, f)
+		total += f.UncompressedSize64
+	}
+	if len(files) > batchMaxEntries {
+		respondError(c, http.StatusBadRequest, codeTooManyEntries, fmt.Sprintf("ZIP archives are limited to %d files", batchMaxEntries), gin.H{"max_entries": batchMaxEntries, "entries": len(files)})
+		return
+	}
+	// Kích thước trong header của ZIP có thể sai: còn kiểm tra lại khi giải nén (extractBatchEntry)
+	if total > uint64(batchMaxBytes) {
+		respondError(c, http.StatusRequestEntityTooLarge, codeUploadTooLarge, fmt.Sprintf("ZIP archives are limited to %d bytes uncompressed", batchMaxBytes), gin.H{"max_bytes": batchMaxBytes})
+		return
+	}
+
+	budget := batchMaxBytes
+	var stop *jobError // Hạn mức hết hoặc hàng đợi quá tải: các mục còn lại không thử tạo job
+	for _, f := range files {
+		entry := batchEntry{Name: f.Name, Size: int64(f.UncompressedSize64)}
+		if stop != nil {
+			entry.Status, entry.Code, entry.Error = batchEntryRejected, stop.code, stop.message
+			b.Entries = append(b.Entries, entry)
+			continue
+		}
+		switch image, jerr := extractBatchEntry(f, &budget); {
+		case jerr != nil:
+			entry.Status, entry.Code, entry.Error = batchEntryRejected, jerr.code, jerr.message
+		case image == nil:
+			entry.Status, entry.Error = batchEntrySkipped, "Not an image or PDF file"
+		default:
+			entry.Size = image.size
+			jobID, _, jerr := createJob(c, image.uploadImage, false)
+			image.discard()
+			if jerr != nil {
+				entry.Status, entry.Code, entry.Error = batchEntryRejected, jerr.code, jerr.message
+				if jerr.status == http.StatusTooManyRequests || jerr.status == http.StatusServiceUnavailable {
+					stop = jerr
+				}
+				break
+			}
+			entry.JobID, entry.Status = jobID, model.StatusQueued
+			if err := jobStore.SaveDetails(c.Request.Context(), jobID, map[string]string{"batch_id": b.ID, "batch_entry": f.Name}); err != nil {
+				log.Printf("Warning: Failed to save batch of job %s: %v", jobID, err)
+			}
+		}
+		b.Entries = append(b.Entries, entry)
+	}
+
+	for _, entry := range b.Entries {
+		if entry.JobID != "" {
+			b.Combined = &batchCombined{Status: batchPDFPending}
+			break
+		}
+	}
+	err = saveBatch(c.Request.Context(), b, metadataRetention(b.Retention))
+	if err == nil && b.Combined != nil {
+		err = redisClient.ZAdd(c.Request.Context(), batchesAssemblingKey, &redis.Z{Score: float64(b.CreatedAt.Unix()), Member: b.ID}).Err()
+	}
+	if err != nil {
+		// Các job con đã được tạo và vẫn chạy, chỉ mất manifest
+		log.Printf("Error saving manifest of batch %s: %v", b.ID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to save batch manifest", gin.H{"entries": b.Entries})
+		return
+	}
+	fmt.Printf("Created batch %s from %s: %d entries\n", b.ID, b.Filename, len(b.Entries))
+	c.JSON(http.StatusOK, batchResponse(b))
+}
+
+// File giải nén của một mục, chưa được createJob chuyển đi thì xóa bằng discard
+type batchImage struct {
+	*uploadImage
+	tmpPath string
+}
+
+func (i *batchImage) discard() { os.Remove(i.tmpPath) }
+
+// --- Giải nén một mục vào thư mục upload, nil nếu không phải ảnh/PDF ---
+// Chống zip-slip: tên mục không bao giờ được dùng làm đường dẫn trên đĩa (file tạm, createJob chỉ
+// lấy tên file), nhưng mục có đường dẫn tuyệt đối, "..", hoặc là symlink vẫn bị từ chối.
+// budget: số byte giải nén còn được phép của cả file ZIP, trừ dần theo số byte thực tế.
+func extractBatchEntry(f *zip.File, budget *int64) (*batchImage, *jobError) {
+	name := f.Name
+	if strings.Contains(name, `\`) || !filepath.IsLocal(filepath.FromSlash(name)) || f.Mode()&os.ModeSymlink != 0 {
+		return nil, newJobError(http.StatusBadRequest, codeInvalidArchive, "Unsafe path in ZIP archive")
+	}
+	if f.UncompressedSize64 > uint64(uploadMaxBytes) {
+		return nil, uploadTooLarge()
+	}
+	src, err := f.Open()
+	if err != nil {
+		return nil, newJobError(http.StatusBadRequest, codeInvalidArchive, "Unreadable ZIP entry: "+err.Error())
+	}
+	defer src.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(src, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, newJobError(http.StatusBadRequest, codeInvalidArchive, "Unreadable ZIP entry: "+err.Error())
+	}
+	header = header[:n]
+	if !isBatchImage(header) {
+		return nil, nil
+	}
+
+	maxBytes := min(uploadMaxBytes, *budget)
+	tmpPath, size, err := receiveUploadFile(io.MultiReader(bytes.NewReader(header), src), maxBytes)
+	if err != nil {
+		if errors.Is(err, errUploadTooLarge) {
+			return nil, fileTooLarge(maxBytes)
+		}
+		if errors.Is(err, zip.ErrChecksum) || errors.Is(err, zip.ErrFormat) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, newJobError(http.StatusBadRequest, codeInvalidArchive, "Corrupt ZIP entry: "+err.Error())
+		}
+		log.Printf("Error extracting ZIP entry %s: %v", name, err)
+		return nil, newJobError(http.StatusInternalServerError, codeStorageUnavailable, "Failed to save ZIP entry")
+	}
+	*budget -= size
+	return &batchImage{tmpPath: tmpPath, uploadImage: &uploadImage{name: path.Base(name), size: size, save: func(dst string) error {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+			return err
+		}
+		return os.Rename(tmpPath, dst)
+	}}}, nil
+}
+
+// Ảnh (theo nội dung, TIFF không được http.DetectContentType nhận ra) hoặc PDF
+func isBatchImage(header []byte) bool {
+	if bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*")) {
+		return true
+	}
+	contentType := http.DetectContentType(header)
+	return strings.HasPrefix(contentType, "image/") || contentType == "application/pdf"
+}
+
+// --- Middleware cho các route có :batch_id ---
+func requireBatchOwner(c *gin.Context) {
+	if !ownsJob(c, c.Param("batch_id")) {
+		respondError(c, http.StatusNotFound, codeBatchNotFound, "Batch not found")
+		return
+	}
+	c.Next()
+}
+
+// ttl âm: giữ thời hạn hiện tại
+func saveBatch(ctx context.Context, b *batch, ttl time.Duration) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		ttl = redis.KeepTTL
+	}
+	return redisClient.Set(ctx, batchKey(b.ID), data, ttl).Err()
+}
+
+func loadBatch(c *gin.Context) (*batch, bool) {
+	id := c.Param("batch_id")
+	data, err := redisClient.Get(c.Request.Context(), batchKey(id)).Bytes()
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeBatchNotFound, "Batch not found")
+		return nil, false
+	}
+	var b *batch
+	if err == nil {
+		b, err = decodeBatch(data)
+	}
+	if err != nil {
+		log.Printf("Error loading batch %s: %v", id, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to load batch")
+		return nil, false
+	}
+	return b, true
+}
+
+func decodeBatch(data []byte) (*batch, error) {
+	var b batch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid batch manifest: %w", err)
+	}
+	return &b, nil
+}
+
+// --- Cập nhật trạng thái của các job con từ store ---
+// Trả về job con đã hoàn thành theo chỉ số mục
+func refreshBatch(ctx context.Context, b *batch) map[int]*model.Result {
+	completed := map[int]*model.Result{}
+	for i := range b.Entries {
+		entry := &b.Entries[i]
+		if entry.JobID == "" {
+			continue
+		}
+		job, err := jobStore.Load(ctx, entry.JobID)
+		if err == model.ErrNotFound {
+			entry.Status = batchEntryExpired
+			continue
+		}
+		if err != nil {
+			// Giữ trạng thái lúc tạo
+			log.Printf("Warning: Failed to load job %s of batch %s: %v", entry.JobID, b.ID, err)
+			continue
+		}
+		entry.Status, entry.Error = job.Status, job.Error
+		if job.Status == model.StatusCompleted {
+			completed[i] = job
+		}
+	}
+	return completed
+}
+
+func batchResponse(b *batch) gin.H {
+	counts := map[string]int{}
+	for _, entry := range b.Entries {
+		counts[entry.Status]++
+	}
+	response := gin.H{
+		"batch_id":     b.ID,
+		"filename":     b.Filename,
+		"created_at":   b.CreatedAt,
+		"counts":       counts,
+		"entries":      b.Entries,
+		"download_url": "/api/batches/" + b.ID + "/download",
+	}
+	if b.Combined != nil {
+		// Kết quả chính của lô: một PDF với mục lục, mỗi ảnh một phần
+		response["combined"] = b.Combined
+		response["pdf_url"] = "/api/batches/" + b.ID + "/pdf"
+	}
+	return response
+}
+
+// --- Handler trả về manifest của lô với trạng thái hiện tại của từng job con ---
+// GET /api/batches/:batch_id
+func handleGetBatch(c *gin.Context) {
+	b, ok := loadBatch(c)
+	if !ok {
+		return
+	}
+	refreshBatch(c.Request.Context(), b)
+	c.JSON(http.StatusOK, batchResponse(b))
+}
+
+// --- Handler tải PDF của mọi job con đã hoàn thành trong một file ZIP ---
+// GET /api/batches/:batch_id/download: mỗi PDF mang tên của mục trong file ZIP gốc (đuôi .pdf),
+// manifest.json liệt kê trạng thái của mọi mục (kể cả mục chưa xong hay lỗi)
+func handleBatchDownload(c *gin.Context) {
+	b, ok := loadBatch(c)
+	if !ok {
+		return
+	}
+	completed := refreshBatch(c.Request.Context(), b)
+	if len(completed) == 0 {
+		respondError(c, http.StatusConflict, codeJobNotCompleted, "No job of the batch has completed", gin.H{"counts": batchResponse(b)["counts"]})
+		return
+	}
+
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", b.ID))
+	c.Status(http.StatusOK)
+	out := zip.NewWriter(c.Writer)
+	used := map[string]bool{"manifest.json": true}
+	for i, entry := range b.Entries {
+		job, ok := completed[i]
+		if !ok {
+			continue
+		}
+		pdfKey := job.PDFPath
+		if pdfKey == "" {
+			pdfKey = model.PDFKey(entry.JobID)
+		}
+		pdfKey = strings.TrimPrefix(pdfKey, cfg.OutputDir+"/")
+		reader, err := artifacts.Open(ctx, pdfKey)
+		if err != nil {
+			// Header đã gửi: ghi lỗi vào manifest thay vì trả lỗi
+			log.Printf("Error opening PDF %s of batch %s: %v", pdfKey, b.ID, err)
+			b.Entries[i].Code, b.Entries[i].Error = codePDFNotFound, "PDF not found in storage"
+			continue
+		}
+		name := batchPDFName(entry.Name, used)
+		w, err := out.Create(name)
+		if err == nil {
+			_, err = io.Copy(w, reader)
+		}
+		reader.Close()
+		if err != nil {
+			log.Printf("Error writing batch %s download: %v", b.ID, err)
+			return // Client ngắt kết nối
+		}
+		recordHistory(c, entry.JobID, model.HistoryEvent{Type: model.HistoryDownloaded, Detail: "batch " + b.ID})
+	}
+	if w, err := out.Create("manifest.json"); err == nil {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(batchResponse(b))
+	}
+	if err := out.Close(); err != nil {
+		log.Printf("Error writing batch %s download: %v", b.ID, err)
+	}
+}
+
+// Tên PDF trong file ZIP tải về: đường dẫn của mục với đuôi .pdf, thêm số nếu trùng
+func batchPDFName(entry string, used map[string]bool) string {
+	base := strings.TrimSuffix(entry, path.Ext(entry))
+	name := base + ".pdf"
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s-%d.pdf", base, n)
+	}
+	used[name] = true
+	return name
+}
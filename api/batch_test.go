@@ -0,0 +1,163 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// newBatchRequest tạo request multipart với file ZIP gồm các file files (tên -> nội dung)
+func newBatchRequest(t *testing.T, names []string, files map[string][]byte) *http.Request {
+	t.Helper()
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(files[name])
+	}
+	zw.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("target_lang", "en")
+	file, _ := form.CreateFormFile("archive", "scans.zip")
+	file.Write(archive.Bytes())
+	form.Close()
+	req := httptest.NewRequest("POST", "/api/batches", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-API-Key", "acme-key")
+	return req
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.POST("/api/batches", handleCreateBatch)
+	router.GET("/api/batches/:batch_id", requireBatchOwner, handleGetBatch)
+	router.GET("/api/batches/:batch_id/download", requireBatchOwner, handleBatchDownload)
+	router.GET("/api/batches/:batch_id/pdf", requireBatchOwner, handleBatchPDF)
+	cfg.OutputDir = t.TempDir()
+	jobBroker = &fakeBroker{}
+	files := storage.NewFileStorage(t.TempDir())
+	artifacts = files
+	t.Cleanup(func() { cfg.OutputDir, jobBroker, artifacts, batchMaxEntries = "", nil, nil, batchDefaultMaxEntries })
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 4)))
+	names := []string{"a.png", "notes.txt", "../evil.png", "pages/b.png"}
+	contents := map[string][]byte{"a.png": img.Bytes(), "notes.txt": []byte("hello"), "../evil.png": img.Bytes(), "pages/b.png": img.Bytes()}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newBatchRequest(t, names, contents))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST: %d %s", w.Code, w.Body)
+	}
+	var manifest struct {
+		BatchID string         `json:"batch_id"`
+		Counts  map[string]int `json:"counts"`
+		Entries []batchEntry   `json:"entries"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &manifest)
+	want := []string{model.StatusQueued, batchEntrySkipped, batchEntryRejected, model.StatusQueued}
+	if len(manifest.Entries) != len(want) {
+		t.Fatalf("entries = %+v", manifest.Entries)
+	}
+	for i, entry := range manifest.Entries {
+		if entry.Name != names[i] || entry.Status != want[i] {
+			t.Errorf("entry %d = %+v, want %s %s", i, entry, names[i], want[i])
+		}
+	}
+	if code := manifest.Entries[2].Code; code != codeInvalidArchive {
+		t.Errorf("zip-slip entry code = %q, want %s", code, codeInvalidArchive)
+	}
+
+	if w := do(router, "GET", "/api/batches/"+manifest.BatchID+"/download", "acme-key", ""); w.Code != http.StatusConflict {
+		t.Errorf("download before any job completed: %d, want 409", w.Code)
+	}
+
+	// Job con của a.png hoàn thành
+	jobID := manifest.Entries[0].JobID
+	writer, _ := files.Create(ctx, model.PDFKey(jobID))
+	writer.Write([]byte("%PDF-a"))
+	writer.Close()
+	if err := jobStore.SetStatus(ctx, jobID, model.StatusCompleted, model.PDFKey(jobID)); err != nil {
+		t.Fatal(err)
+	}
+	if w := do(router, "GET", "/api/batches/"+manifest.BatchID, "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET by other tenant: %d, want 404", w.Code)
+	}
+	w = do(router, "GET", "/api/batches/"+manifest.BatchID, "acme-key", "")
+	json.Unmarshal(w.Body.Bytes(), &manifest)
+	if manifest.Counts[model.StatusCompleted] != 1 || manifest.Counts[model.StatusQueued] != 1 {
+		t.Errorf("counts = %v", manifest.Counts)
+	}
+
+	w = do(router, "GET", "/api/batches/"+manifest.BatchID+"/download", "acme-key", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("download: %d %s", w.Code, w.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range zr.File {
+		got = append(got, f.Name)
+	}
+	if len(got) != 2 || got[0] != "a.pdf" || got[1] != "manifest.json" {
+		t.Errorf("download entries = %v, want [a.pdf manifest.json]", got)
+	}
+
+	// PDF gộp: chờ job con của pages/b.png, rồi gộp các job đã hoàn thành
+	batchPDFFonts.Dir = "../font"
+	t.Cleanup(func() { batchPDFFonts.Dir = "font" })
+	redisClient.Set(ctx, jobID+":translated_text", "Translated alpha", 0)
+	if err := assembleBatches(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if w := do(router, "GET", "/api/batches/"+manifest.BatchID+"/pdf", "acme-key", ""); w.Code != http.StatusConflict {
+		t.Errorf("combined PDF while a job is queued: %d, want 409", w.Code)
+	}
+	if err := jobStore.SetStatus(ctx, manifest.Entries[3].JobID, model.StatusFailed, "OCR failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := assembleBatches(ctx); err != nil {
+		t.Fatal(err)
+	}
+	w = do(router, "GET", "/api/batches/"+manifest.BatchID, "acme-key", "")
+	var combined struct {
+		Combined batchCombined `json:"combined"`
+		PDFURL   string        `json:"pdf_url"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &combined)
+	if combined.Combined.Status != batchPDFCompleted || combined.Combined.Sections != 1 || combined.PDFURL == "" {
+		t.Errorf("combined = %+v, pdf_url %q", combined.Combined, combined.PDFURL)
+	}
+	w = do(router, "GET", combined.PDFURL, "acme-key", "")
+	if w.Code != http.StatusOK || !bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")) {
+		t.Errorf("combined PDF: %d", w.Code)
+	}
+	if n, _ := redisClient.ZCard(ctx, batchesAssemblingKey).Result(); n != 0 {
+		t.Errorf("%d batches still waiting for their PDF", n)
+	}
+
+	batchMaxEntries = 3
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newBatchRequest(t, names, contents))
+	if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(codeTooManyEntries)) {
+		t.Errorf("too many entries: %d %s", w.Code, w.Body)
+	}
+}
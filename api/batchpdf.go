@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+)
+
+// Trạng thái của PDF gộp
+const (
+	batchPDFPending   = "pending"   // Còn job con chưa xong
+	batchPDFCompleted = "completed" // PDF ở model.PDFKey(batch_id), janitor xóa theo thời hạn lưu như PDF của job
+	batchPDFFailed    = "failed"    // Không job con nào hoàn thành, hoặc không tạo được PDF
+)
+
+const (
+	batchesAssemblingKey = "batches:assembling" // ZSET batch_id -> thời điểm tạo, các lô chờ tạo PDF gộp
+	batchAssembleLockTTL = 5 * time.Minute      // Chỉ một replica API tạo PDF gộp của một lô
+	batchAssembleDefault = 15 * time.Second     // Chu kỳ kiểm tra mặc định (BATCH_ASSEMBLE_INTERVAL)
+)
+
+type batchCombined struct {
+	Status      string     `json:"status"`
+	Sections    int        `json:"sections,omitempty"` // Số job con có trong PDF (job lỗi hoặc hết hạn bị bỏ qua)
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+var (
+	batchAssembleInterval = batchAssembleDefault
+	batchPDFFonts         = pdf.DefaultFontRegistry()
+	batchPDFTemplate      *pdf.Template
+)
+
+// --- Đọc cấu hình PDF gộp: chu kỳ, font và template giống worker (PDF_FONTS, PDF_FONT_DIR, PDF_TEMPLATE) ---
+func initBatchPDF() error {
+	if raw := os.Getenv("BATCH_ASSEMBLE_INTERVAL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("BATCH_ASSEMBLE_INTERVAL must be a positive duration such as 15s, got %q", raw)
+		}
+		batchAssembleInterval = d
+	}
+	if tmplPath := os.Getenv("PDF_TEMPLATE"); tmplPath != "" {
+		tmpl := pdf.DefaultTemplate()
+		if tmplPath != "default" {
+			var err error
+			if tmpl, err = pdf.LoadTemplate(tmplPath); err != nil {
+				return err
+			}
+		}
+		batchPDFTemplate = &tmpl
+	}
+	if fontsPath := os.Getenv("PDF_FONTS"); fontsPath != "" {
+		fonts, err := pdf.LoadFontRegistry(fontsPath)
+		if fonts == nil {
+			return err
+		}
+		batchPDFFonts = fonts
+	} else if fontDir := os.Getenv("PDF_FONT_DIR"); fontDir != "" {
+		batchPDFFonts.Dir = fontDir
+	}
+	// Thiếu font không chặn API khởi động: PDF gộp dùng font dựng sẵn (chữ Latin)
+	if err := batchPDFFonts.Validate(); err != nil {
+		log.Printf("Warning: %v; combined batch PDFs use the built-in font (Latin text only)", err)
+		batchPDFFonts = pdf.BuiltinFontRegistry()
+	}
+	return nil
+}
+
+// --- Bước gộp: chạy định kỳ, tạo PDF gộp của các lô có mọi job con đã xong ---
+func runBatchAssembler(ctx context.Context) {
+	ticker := time.NewTicker(batchAssembleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := assembleBatches(ctx); err != nil {
+			log.Printf("Error assembling batch PDFs: %v", err)
+		}
+	}
+}
+
+func assembleBatches(ctx context.Context) error {
+	ids, err := redisClient.ZRange(ctx, batchesAssemblingKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		locked, err := redisClient.SetNX(ctx, batchKey(id)+":lock", "1", batchAssembleLockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if !locked {
+			continue // Replica khác đang tạo
+		}
+		err = assembleBatch(ctx, id)
+		redisClient.Del(ctx, batchKey(id)+":lock")
+		if err != nil {
+			// Thử lại ở lần kiểm tra sau
+			log.Printf("Error assembling PDF of batch %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// --- Tạo PDF gộp của lô nếu mọi job con đã xong, rồi bỏ lô khỏi danh sách chờ ---
+func assembleBatch(ctx context.Context, id string) error {
+	data, err := redisClient.Get(ctx, batchKey(id)).Bytes()
+	if err == redis.Nil {
+		// Manifest đã hết hạn: không còn ai chờ PDF gộp
+		return redisClient.ZRem(ctx, batchesAssemblingKey, id).Err()
+	}
+	if err != nil {
+		return err
+	}
+	b, err := decodeBatch(data)
+	if err != nil {
+		return err
+	}
+	completed := refreshBatch(ctx, b)
+	var sections []pdf.Section
+	for i, entry := range b.Entries {
+		switch entry.Status {
+		case model.StatusQueued, model.StatusProcessing:
+			return nil // Chờ job con
+		}
+		if _, ok := completed[i]; !ok {
+			continue
+		}
+		text, err := batchEntryText(ctx, entry.JobID)
+		if err != nil {
+			return err
+		}
+		sections = append(sections, pdf.Section{Title: entry.Name, Subtitle: "Job " + entry.JobID, Text: text})
+	}
+
+	combined := &batchCombined{Status: batchPDFCompleted, Sections: len(sections)}
+	if len(sections) == 0 {
+		combined = &batchCombined{Status: batchPDFFailed, Error: "No job of the batch completed"}
+	} else if err := writeBatchPDF(ctx, b, sections); err != nil {
+		log.Printf("Error creating PDF of batch %s: %v", b.ID, err)
+		combined = &batchCombined{Status: batchPDFFailed, Error: "Failed to create the combined PDF"}
+	} else {
+		now := time.Now().UTC()
+		combined.CompletedAt = &now
+		record := model.RetentionRecord{Policy: b.Retention, Status: model.StatusCompleted, FinishedAt: now}
+		if err := model.IndexRetention(ctx, redisClient, b.ID, record, metadataRetention(b.Retention)); err != nil {
+			log.Printf("Warning: Failed to save retention of batch %s: %v", b.ID, err)
+		}
+	}
+	// Giữ trạng thái job con như đã lưu lúc tạo lô, trạng thái hiện tại được đọc lại mỗi request
+	stored, err := decodeBatch(data)
+	if err != nil {
+		return err
+	}
+	stored.Combined = combined
+	if err := saveBatch(ctx, stored, -1); err != nil {
+		return err
+	}
+	fmt.Printf("Batch %s: combined PDF %s (%d sections)\n", b.ID, combined.Status, combined.Sections)
+	return redisClient.ZRem(ctx, batchesAssemblingKey, b.ID).Err()
+}
+
+// Bản dịch của job con, văn bản OCR nếu job không dịch
+func batchEntryText(ctx context.Context, jobID string) (string, error) {
+	for _, field := range []string{textFields["translated"], textFields["ocr"]} {
+		text, err := redisClient.Get(ctx, fmt.Sprintf("%s:%s", jobID, field)).Result()
+		if err == nil && text != "" {
+			return text, nil
+		}
+		if err != nil && err != redis.Nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func writeBatchPDF(ctx context.Context, b *batch, sections []pdf.Section) error {
+	w, err := artifacts.Create(ctx, model.PDFKey(b.ID))
+	if err != nil {
+		return err
+	}
+	config := pdf.Config{Template: batchPDFTemplate, JobID: b.ID, Fonts: batchPDFFonts}
+	if err := pdf.CreateCombinedPDFTo(w, b.Filename, sections, config); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// --- Handler tải PDF gộp của lô ---
+// GET /api/batches/:batch_id/pdf: 409 khi còn job con chưa xong (details.status: trạng thái của PDF gộp)
+func handleBatchPDF(c *gin.Context) {
+	b, ok := loadBatch(c)
+	if !ok {
+		return
+	}
+	if b.Combined == nil || b.Combined.Status != batchPDFCompleted {
+		details := gin.H{"status": batchPDFFailed}
+		if b.Combined != nil {
+			details = gin.H{"status": b.Combined.Status, "error_message": b.Combined.Error}
+		}
+		respondError(c, http.StatusConflict, codeJobNotCompleted, "The combined PDF of the batch is not available", details)
+		return
+	}
+	servePDF(c, artifacts, model.PDFKey(b.ID), b.ID+".pdf")
+}
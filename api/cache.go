@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/lineage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/reaper"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+)
+
+// Hash SHA-256 của input, như worker tính cho cache key
+var imageHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// --- Handler xóa kết quả đã cache của một input ---
+// DELETE /api/admin/cache/entry?hash=<sha256> hoặc ?job_id=<id>: xóa mọi biến thể
+// (ngôn ngữ, tùy chọn, văn bản, lỗi đã nhớ) của input, ví dụ sau khi sửa lỗi preprocessing.
+// Chỉ dành cho admin (requireAdmin): cache của tenant gọi API, của tenant ?tenant=<id>,
+// hoặc với job_id là cache của tenant sở hữu job. Chỉ với backend dùng chung có thể liệt kê key
+// (redis, tiered: LRU trong worker còn giữ mục cũ tối đa cache.DefaultL1TTL).
+// Với job_id, bản dịch từng đoạn của job cũng bị xóa.
+func handleDeleteCacheEntry(c *gin.Context) {
+	ctx := c.Request.Context()
+	hash := c.Query("hash")
+	jobID := c.Query("job_id")
+	tenantID := callerTenant(c).ID
+	if id := c.Query("tenant"); id != "" {
+		if !knownTenant(id) {
+			respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, fmt.Sprintf("Unknown tenant '%s'", id))
+			return
+		}
+		tenantID = id
+	}
+	if jobID != "" {
+		tenantID = model.TenantOf(jobID)
+		var err error
+		if hash, err = jobInputHash(c, jobID); err != nil {
+			return // Lỗi đã được trả về
+		}
+	}
+	if !imageHashPattern.MatchString(hash) {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "hash (SHA-256 of the input, lowercase hex) or job_id is required")
+		return
+	}
+	if resultCache == nil || resultCache.Name() == cache.BackendMemory {
+		respondError(c, http.StatusNotImplemented, codeCacheUnsupported, "The result cache is local to each worker and cannot be purged through the API")
+		return
+	}
+
+	deleted, err := deleteCachedResults(ctx, tenantID, hash)
+	if errors.Is(err, cache.ErrPrefixUnsupported) {
+		respondError(c, http.StatusNotImplemented, codeCacheUnsupported, fmt.Sprintf("The '%s' cache backend cannot delete entries by hash", resultCache.Name()))
+		return
+	}
+	if err == nil && jobID != "" {
+		var n int
+		n, err = deleteTranslationCache(ctx, jobID)
+		deleted += n
+	}
+	if err != nil {
+		log.Printf("Error deleting cache entries of hash %s: %v", hash, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to delete cache entries")
+		return
+	}
+	log.Printf("Deleted %d cache entries of hash %s (tenant %q)", deleted, hash, tenantID)
+	c.JSON(http.StatusOK, gin.H{"hash": hash, "deleted": deleted})
+}
+
+// --- Xóa mọi mục cache của input có hash trong cache của tenant, trả về số mục đã xóa ---
+func deleteCachedResults(ctx context.Context, tenantID, hash string) (int, error) {
+	deleted := 0
+	for _, kind := range []string{"imagehash", "pdfhash", "texthash"} {
+		prefix := kind + ":" + hash
+		if tenantID != "" {
+			prefix = "tenant:" + tenantID + ":" + prefix
+		}
+		n, err := cache.DeletePrefix(ctx, resultCache, prefix)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// --- Xóa khỏi cache bản dịch từng đoạn mà job đã ghi hoặc dùng lại (TRANSLATE_PARALLEL) ---
+// Các đoạn không gắn với hash của input nên chỉ tìm được qua job
+func deleteTranslationCache(ctx context.Context, jobID string) (int, error) {
+	keys, err := redisClient.SMembers(ctx, model.TranslationCacheKey(jobID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := resultCache.Delete(ctx, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), redisClient.Del(ctx, model.TranslationCacheKey(jobID)).Err()
+}
+
+// --- Hash input của job: từ chi tiết job (worker đã tính), hoặc tính lại từ file upload ---
+func jobInputHash(c *gin.Context, jobID string) (string, error) {
+	ctx := c.Request.Context()
+	if state, err := jobStore.Load(ctx, jobID); err == nil && state.Details["image_hash"] != "" {
+		return state.Details["image_hash"], nil
+	}
+	job, err := reaper.LoadMessage(ctx, redisClient, jobID)
+	if err == reaper.ErrNoMessage {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return "", err
+	}
+	if err != nil {
+		log.Printf("Error loading message of job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to load job")
+		return "", err
+	}
+	hash, err := fileSHA256(job.ImagePath)
+	if os.IsNotExist(err) {
+		respondError(c, http.StatusGone, codeInputNotFound, "The input file of the job is no longer available")
+		return "", err
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to read the input file of the job")
+		return "", err
+	}
+	return hash, nil
+}
+
+// --- SHA-256 của file (hex), như worker tính cho cache key ---
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// --- Handler xử lý lại input của một job đã xong ---
+// POST /api/jobs/:job_id/reprocess?skipCache=true: tạo job mới với cùng file và tùy chọn
+// (liên kết lineage retry/regeneration với job cũ). skipCache=true bỏ qua kết quả và lỗi
+// đã cache, kết quả mới ghi đè cache.
+func handleReprocess(c *gin.Context) {
+	ctx := c.Request.Context()
+	jobID := c.Param("job_id")
+	skipCache := false
+	switch c.Query("skipCache") {
+	case "", "false":
+	case "true":
+		skipCache = true
+	default:
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "skipCache must be 'true' or 'false'")
+		return
+	}
+
+	state, err := jobStore.Load(ctx, jobID)
+	if err == model.ErrNotFound {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to load job")
+		return
+	}
+	if state.Status != model.StatusCompleted && state.Status != model.StatusFailed {
+		respondError(c, http.StatusConflict, codeJobNotCompleted, "Only completed or failed jobs can be reprocessed", gin.H{"status": state.Status})
+		return
+	}
+	job, err := reaper.LoadMessage(ctx, redisClient, jobID)
+	if err == reaper.ErrNoMessage {
+		respondError(c, http.StatusGone, codeInputNotFound, "The job was not submitted through the API, its input is not available")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading message of job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to load job")
+		return
+	}
+	if _, err := os.Stat(job.ImagePath); err != nil {
+		respondError(c, http.StatusGone, codeInputNotFound, "The input file of the job is no longer available")
+		return
+	}
+
+	caller := callerTenant(c)
+	if jobErr := queueBackpressure.check(ctx); jobErr != nil {
+		jobErr.respond(c)
+		return
+	}
+	if jobErr := checkCharBudget(ctx, caller); jobErr != nil {
+		jobErr.respond(c)
+		return
+	}
+	if err := tenant.Reserve(ctx, redisClient, caller); err == tenant.ErrQuotaExceeded {
+		respondError(c, http.StatusTooManyRequests, codeQuotaExceeded, fmt.Sprintf("Daily quota of %d jobs exceeded", caller.DailyJobs), gin.H{"daily_jobs": caller.DailyJobs})
+		return
+	} else if err != nil {
+		log.Printf("Error reserving job quota of tenant %s: %v", caller.ID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to check job quota")
+		return
+	}
+
+	// Job mới dùng lại file upload của job cũ (file không bị sửa khi xử lý)
+	newJobID := model.TenantJobID(caller.ID, uuid.New().String())
+	job.JobID, job.Attempt, job.SkipCache = newJobID, 1, skipCache
+	job.RequestID = httpserver.RequestID(c.Request)
+	recordHistory(c, newJobID, model.HistoryEvent{Type: model.HistorySubmitted, Detail: "reprocess of " + jobID})
+	if err := jobStore.SetStatus(ctx, newJobID, model.StatusQueued, ""); err != nil {
+		log.Printf("Error setting initial status in Redis for job %s: %v", newJobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to initiate job processing (Redis error)")
+		return
+	}
+	retention := saveRetention(ctx, caller, newJobID, job.ImagePath)
+	if err := jobStore.SaveDetails(ctx, newJobID, map[string]string{"request_id": job.RequestID}); err != nil {
+		log.Printf("Warning: Failed to save request ID of job %s: %v", newJobID, err)
+	}
+	if err := tenant.Track(ctx, redisClient, caller.ID, newJobID, retention); err != nil {
+		log.Printf("Warning: Failed to add job %s to the job list of tenant %q: %v", newJobID, caller.ID, err)
+	}
+	relation := lineage.RelationRegeneration
+	if state.Status == model.StatusFailed {
+		relation = lineage.RelationRetry
+	}
+	if err := lineage.Record(ctx, redisClient, jobID, newJobID, relation, retention); err != nil {
+		log.Printf("Warning: Failed to record lineage %s -> %s: %v", jobID, newJobID, err)
+	}
+	if err := reaper.SaveMessage(ctx, redisClient, job, jobTTL); err != nil {
+		log.Printf("Error saving job message in Redis for job %s: %v", newJobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to prepare job message")
+		return
+	}
+	if err := enqueueJob(ctx, job); err != nil {
+		log.Printf("Error sending message to broker for job %s: %v", newJobID, err)
+		respondError(c, http.StatusInternalServerError, codeQueueUnavailable, "Failed to queue job for processing (broker error)")
+		return
+	}
+	fmt.Printf("Reprocessing job %s as job %s (skip cache: %t)\n", jobID, newJobID, skipCache)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":          "Job queued for reprocessing.",
+		"job_id":           newJobID,
+		"job_type":         jobTypeName(job.JobType),
+		"reprocessed_from": jobID,
+		"skip_cache":       skipCache,
+	})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/lineage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+)
+
+// Giới hạn độ dài văn bản đã sửa: khoảng cách chỉnh sửa tốn O(n*m)
+const correctedTextMaxRunes = 30000
+
+// Hash "<ocr_mode>:<counter>" -> tổng số lần sửa, CER và WER (GET /api/stats/ocr-quality)
+const ocrQualityKey = "stats:ocr_quality"
+
+// --- Handler nhận văn bản OCR do người dùng sửa ---
+// PUT /api/jobs/:job_id/corrected-text, body: {"text": "...", "target_lang": "en"}
+// Tính CER/WER của OCR so với văn bản đã sửa, lưu vào job và thống kê chất lượng OCR,
+// rồi tạo job mới (lineage dependent) dịch lại văn bản đã sửa và tạo lại PDF.
+// Các trang cách nhau bởi dấu ngắt trang như văn bản OCR của job.
+func handleCorrectedText(c *gin.Context) {
+	jobID := c.Param("job_id")
+	ctx := c.Request.Context()
+
+	var body struct {
+		Text       string `json:"text"`
+		TargetLang string `json:"target_lang"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || strings.TrimSpace(body.Text) == "" {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "body must be {\"text\": ...} with the corrected OCR text")
+		return
+	}
+	if n := utf8.RuneCountInString(body.Text); n > correctedTextMaxRunes {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, fmt.Sprintf("text must have at most %d characters", correctedTextMaxRunes), gin.H{"max_chars": correctedTextMaxRunes})
+		return
+	}
+
+	job, err := jobStore.Load(ctx, jobID)
+	if err == model.ErrNotFound {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting status from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job status")
+		return
+	}
+	if job.Status != model.StatusCompleted {
+		respondError(c, http.StatusBadRequest, codeJobNotCompleted, "Job not completed", gin.H{"status": job.Status})
+		return
+	}
+	ocrText, err := redisClient.Get(ctx, jobID+":"+textFields["ocr"]).Result()
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeTextNotFound, "Job has no OCR text")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting OCR text from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get OCR text")
+		return
+	}
+
+	// Sai số của OCR so với văn bản đã sửa (dấu ngắt trang không tính)
+	rates := ocr.CompareText(strings.ReplaceAll(body.Text, pdf.PageBreak, "\n"), strings.ReplaceAll(ocrText, pdf.PageBreak, "\n"))
+	cer, wer := strconv.FormatFloat(rates.CER, 'f', 4, 64), strconv.FormatFloat(rates.WER, 'f', 4, 64)
+	pipe := redisClient.TxPipeline()
+	pipe.Set(ctx, jobID+":corrected_text", body.Text, jobStore.ResultTTL(ctx, jobID)) // Giữ theo thời hạn lưu của job
+	pipe.HSet(ctx, model.DetailsKey(jobID), "ocr_cer", cer, "ocr_wer", wer)
+	if _, ok := job.Details["ocr_ms"]; ok {
+		// Chỉ job có OCR (không phải lớp văn bản của PDF hay văn bản đã sửa) vào thống kê
+		mode := job.Details["ocr_mode"]
+		if mode == "" {
+			mode = "printed"
+		}
+		pipe.HIncrBy(ctx, ocrQualityKey, mode+":corrections", 1)
+		pipe.HIncrByFloat(ctx, ocrQualityKey, mode+":cer_sum", rates.CER)
+		pipe.HIncrByFloat(ctx, ocrQualityKey, mode+":wer_sum", rates.WER)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error saving corrected text of job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to save corrected text")
+		return
+	}
+
+	// Job dịch lại văn bản đã sửa, cùng ngôn ngữ đích với job gốc nếu không chỉ định
+	targetLang := body.TargetLang
+	if targetLang == "" {
+		targetLang = job.Details["target_lang"]
+	}
+	c.Request.PostForm = url.Values{
+		"target_lang":   {targetLang},
+		"parent_job_id": {jobID},
+		"relation":      {lineage.RelationDependent},
+	}
+	text := []byte(body.Text)
+	image := &uploadImage{name: "corrected.txt", size: int64(len(text)), jobType: messaging.JobTypeText, save: func(path string) error {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return err
+		}
+		return os.WriteFile(path, text, 0o644)
+	}}
+	newJobID, _, jerr := createJob(c, image, false)
+	if jerr != nil {
+		jerr.respond(c)
+		return
+	}
+	if err := jobStore.SaveDetails(ctx, jobID, map[string]string{"corrected_job_id": newJobID}); err != nil {
+		log.Printf("Warning: Failed to save corrected job of job %s: %v", jobID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":           jobID,
+		"ocr_quality":      rates,
+		"corrected_job_id": newJobID, // Poll status của job này để lấy PDF mới
+	})
+}
+
+// --- Handler trả về chất lượng OCR theo chế độ OCR, từ các văn bản đã sửa ---
+// GET /api/stats/ocr-quality: số lần sửa, CER và WER trung bình
+func handleOCRQuality(c *gin.Context) {
+	fields, err := redisClient.HGetAll(c.Request.Context(), ocrQualityKey).Result()
+	if err != nil {
+		log.Printf("Error loading OCR quality stats from Redis: %v", err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get stats")
+		return
+	}
+	modes := gin.H{}
+	for field, value := range fields {
+		mode, counter, ok := strings.Cut(field, ":")
+		if !ok || counter != "corrections" {
+			continue
+		}
+		n, _ := strconv.ParseFloat(value, 64)
+		if n == 0 {
+			continue
+		}
+		cerSum, _ := strconv.ParseFloat(fields[mode+":cer_sum"], 64)
+		werSum, _ := strconv.ParseFloat(fields[mode+":wer_sum"], 64)
+		modes[mode] = gin.H{"corrections": int64(n), "avg_cer": cerSum / n, "avg_wer": werSum / n}
+	}
+	c.JSON(http.StatusOK, gin.H{"ocr_modes": modes})
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/archive"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/lineage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/reaper"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+)
+
+// Biên nhận xóa job trả về cho client (lưu lại làm bằng chứng xóa dữ liệu)
+type deletionReceipt struct {
+	ReceiptID string    `json:"receipt_id"`
+	JobID     string    `json:"job_id"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Mode      string    `json:"mode"` // soft_delete hoặc erase
+	DeletedAt time.Time `json:"deleted_at"`
+	// Xóa mềm: dữ liệu còn giữ tới thời điểm này (thời hạn lưu của job) rồi hết hạn
+	RetainedUntil *time.Time `json:"retained_until,omitempty"`
+	// Xóa hẳn: những gì đã xóa
+	Uploads      []string `json:"uploads,omitempty"`   // File upload trên đĩa
+	Artifacts    []string `json:"artifacts,omitempty"` // Key PDF, thumbnail, output trong storage
+	Archive      []string `json:"archive,omitempty"`   // Key trong kho lưu trữ
+	InputHash    string   `json:"input_hash,omitempty"`
+	CacheEntries int      `json:"cache_entries"` // Mục cache theo hash của input và bản dịch từng đoạn
+	RedisKeys    int      `json:"redis_keys"`    // Trạng thái, details, văn bản, lịch sử...
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// --- Handler xóa job của tenant ---
+// DELETE /api/jobs/:job_id: xóa mềm, job trả 404 ở mọi route và biến khỏi danh sách job,
+// dữ liệu hết hạn theo thời hạn lưu. ?erase=true: xóa hẳn (quyền được xóa dữ liệu) file upload,
+// PDF/thumbnail/output, văn bản, cache theo hash của input, bản lưu trữ và mọi key Redis của job.
+// Chỉ job đã completed/failed; job đã xóa mềm hoặc chỉ còn trong kho lưu trữ vẫn xóa hẳn được.
+func handleDeleteJob(c *gin.Context) {
+	ctx := c.Request.Context()
+	jobID := c.Param("job_id")
+	erase, err := strconv.ParseBool(c.DefaultQuery("erase", "false"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "erase must be true or false")
+		return
+	}
+
+	job, err := jobStore.Load(ctx, jobID)
+	if err == model.ErrNotFound {
+		if !erase || !erasable(c, jobID) {
+			respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+			return
+		}
+	} else if err != nil {
+		log.Printf("Error loading job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to load job")
+		return
+	} else if job.Status != model.StatusCompleted && job.Status != model.StatusFailed {
+		respondError(c, http.StatusConflict, codeJobNotCompleted, "Only completed or failed jobs can be deleted", gin.H{"status": job.Status})
+		return
+	}
+
+	caller := callerTenant(c)
+	receipt := &deletionReceipt{ReceiptID: uuid.New().String(), JobID: jobID, Tenant: caller.ID, DeletedAt: time.Now().UTC()}
+	if erase {
+		receipt.Mode = "erase"
+		if err := eraseJob(ctx, caller, jobID, receipt); err != nil {
+			// Các bước đã xong không lỗi khi chạy lại: client gửi lại request
+			log.Printf("Error erasing job %s: %v", jobID, err)
+			respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to erase job, retry the request")
+			return
+		}
+		log.Printf("Erased job %s of tenant %q (receipt %s): %d upload(s), %d artifact key(s), %d cache entries, %d Redis keys",
+			jobID, caller.ID, receipt.ReceiptID, len(receipt.Uploads), len(receipt.Artifacts), receipt.CacheEntries, receipt.RedisKeys)
+		c.JSON(http.StatusOK, receipt)
+		return
+	}
+
+	receipt.Mode = "soft_delete"
+	recordHistory(c, jobID, model.HistoryEvent{Type: model.HistoryDeleted})
+	retainedUntil := receipt.DeletedAt.Add(jobStore.ResultTTL(ctx, jobID))
+	if err := jobStore.SoftDelete(ctx, jobID); err != nil {
+		log.Printf("Error deleting job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to delete job")
+		return
+	}
+	if err := tenant.Untrack(ctx, redisClient, caller.ID, jobID); err != nil {
+		log.Printf("Warning: Failed to remove job %s from the job list of tenant %q: %v", jobID, caller.ID, err)
+	}
+	receipt.RetainedUntil = &retainedUntil
+	log.Printf("Deleted job %s of tenant %q (receipt %s)", jobID, caller.ID, receipt.ReceiptID)
+	c.JSON(http.StatusOK, receipt)
+}
+
+// --- Job không còn trạng thái vẫn xóa hẳn được nếu đã xóa mềm hoặc còn trong kho lưu trữ ---
+func erasable(c *gin.Context, jobID string) bool {
+	ctx := c.Request.Context()
+	if deleted, err := jobStore.Deleted(ctx, jobID); err == nil && deleted {
+		return true
+	}
+	if archiveStore == nil {
+		return false
+	}
+	_, err := archive.Load(ctx, archiveStore, jobID)
+	return err == nil
+}
+
+// --- Xóa hẳn dữ liệu của job, ghi lại vào receipt những gì đã xóa ---
+// File và storage được xóa trước, key Redis (nơi biết đường dẫn file) sau cùng,
+// nên khi một bước lỗi có thể gọi lại
+func eraseJob(ctx context.Context, caller *tenant.Tenant, jobID string, receipt *deletionReceipt) error {
+	details, err := redisClient.HGetAll(ctx, model.DetailsKey(jobID)).Result()
+	if err != nil {
+		return err
+	}
+	pdfPath, err := redisClient.Get(ctx, model.PDFPathKey(jobID)).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	// File upload: đường dẫn trong thời hạn lưu và trong message của job (xử lý lại dùng chung file)
+	var uploads []string
+	if record, err := model.LoadRetention(ctx, redisClient, jobID); err != nil {
+		return err
+	} else if record != nil && record.UploadPath != "" {
+		uploads = append(uploads, record.UploadPath)
+	}
+	if msg, err := reaper.LoadMessage(ctx, redisClient, jobID); err == nil {
+		if msg.ImagePath != "" && (len(uploads) == 0 || uploads[0] != msg.ImagePath) {
+			uploads = append(uploads, msg.ImagePath)
+		}
+	} else if err != reaper.ErrNoMessage {
+		return err
+	}
+	receipt.InputHash = details["image_hash"]
+	for _, path := range uploads {
+		if receipt.InputHash == "" {
+			if hash, err := fileSHA256(path); err == nil {
+				receipt.InputHash = hash
+			}
+		}
+		if err := os.Remove(path); err == nil {
+			receipt.Uploads = append(receipt.Uploads, path)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	keys := []string{model.PDFKey(jobID), model.ThumbnailKey(jobID)}
+	for _, file := range messaging.OutputFiles {
+		keys = append(keys, model.OutputKey(jobID, file))
+	}
+	for _, file := range model.ArtifactFiles {
+		keys = append(keys, model.ArtifactKey(jobID, file))
+	}
+	for _, key := range keys {
+		if err := artifacts.Delete(ctx, key); err != nil {
+			return fmt.Errorf("delete %s: %w", key, err)
+		}
+	}
+	receipt.Artifacts = keys
+	if pdfPath != "" && pdfPath != model.PDFKey(jobID) {
+		// Cache hit: PDF thuộc job trước đó của cùng tenant, xóa khi xóa job đó
+		receipt.Warnings = append(receipt.Warnings, fmt.Sprintf("The PDF %s was reused from an earlier job through the cache and was not deleted", pdfPath))
+	}
+
+	switch {
+	case receipt.InputHash == "":
+		receipt.Warnings = append(receipt.Warnings, "The input hash of the job is unknown, cache entries were not deleted")
+	case resultCache == nil || resultCache.Name() == cache.BackendMemory:
+		receipt.Warnings = append(receipt.Warnings, "The result cache is local to each worker and was not purged")
+	default:
+		n, err := deleteCachedResults(ctx, caller.ID, receipt.InputHash)
+		if errors.Is(err, cache.ErrPrefixUnsupported) {
+			receipt.Warnings = append(receipt.Warnings, fmt.Sprintf("The '%s' cache backend cannot delete entries by hash, they expire on their own", resultCache.Name()))
+		} else if err != nil {
+			return err
+		}
+		receipt.CacheEntries = n
+	}
+	if resultCache != nil && resultCache.Name() != cache.BackendMemory {
+		n, err := deleteTranslationCache(ctx, jobID)
+		if err != nil {
+			return err
+		}
+		receipt.CacheEntries += n
+	}
+
+	if archiveStore != nil {
+		for _, key := range []string{archive.RecordKey(jobID), archive.PDFKey(jobID)} {
+			if err := archiveStore.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+				return fmt.Errorf("delete %s: %w", key, err)
+			}
+			receipt.Archive = append(receipt.Archive, key)
+		}
+	}
+
+	if err := lineage.Forget(ctx, redisClient, jobID); err != nil {
+		return err
+	}
+	if err := tenant.Untrack(ctx, redisClient, caller.ID, jobID); err != nil {
+		return err
+	}
+	receipt.RedisKeys, err = jobStore.Erase(ctx, jobID)
+	return err
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+func TestDeleteJob(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.DELETE("/api/jobs/:job_id", requireJobOwner, handleDeleteJob)
+	dir := t.TempDir()
+	files := storage.NewFileStorage(dir)
+	artifacts = files
+	var err error
+	if resultCache, err = cache.New(cache.BackendRedis, redisClient); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { artifacts, resultCache = nil, nil })
+
+	jobID := model.TenantJobID("acme", "j1")
+	hash := strings.Repeat("ab", 32)
+	upload := filepath.Join(dir, "upload.png")
+	if err := os.WriteFile(upload, []byte("image"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := files.Create(ctx, model.PDFKey(jobID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("%PDF-"))
+	writer.Close()
+	if err := model.SaveRetention(ctx, redisClient, jobID, model.RetentionRecord{UploadPath: upload}, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobStore.SetStatus(ctx, jobID, model.StatusCompleted, model.PDFKey(jobID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobStore.SaveDetails(ctx, jobID, map[string]string{"image_hash": hash}); err != nil {
+		t.Fatal(err)
+	}
+	resultCache.Set(ctx, "tenant:acme:imagehash:"+hash+":vi", model.PDFKey(jobID), 0)
+	// Bản dịch một đoạn của job (TRANSLATE_PARALLEL)
+	resultCache.Set(ctx, "tenant:acme:translation:0123", "Xin chào", 0)
+	redisClient.SAdd(ctx, model.TranslationCacheKey(jobID), "tenant:acme:translation:0123")
+
+	if w := do(router, "DELETE", "/api/jobs/"+jobID, "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE by other tenant: %d, want 404", w.Code)
+	}
+	if w := do(router, "DELETE", "/api/jobs/"+jobID, "acme-key", ""); w.Code != http.StatusOK {
+		t.Fatalf("soft DELETE: %d %s", w.Code, w.Body)
+	}
+	if w := do(router, "GET", "/api/status/"+jobID, "acme-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status after soft delete: %d, want 404", w.Code)
+	}
+	if _, err := os.Stat(upload); err != nil {
+		t.Errorf("upload removed by soft delete: %v", err)
+	}
+
+	w := do(router, "DELETE", "/api/jobs/"+jobID+"?erase=true", "acme-key", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("erase: %d %s", w.Code, w.Body)
+	}
+	var receipt deletionReceipt
+	if err := json.Unmarshal(w.Body.Bytes(), &receipt); err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Mode != "erase" || receipt.InputHash != hash || receipt.CacheEntries != 2 || len(receipt.Uploads) != 1 || receipt.RedisKeys == 0 {
+		t.Errorf("receipt = %+v", receipt)
+	}
+	if _, err := os.Stat(upload); !os.IsNotExist(err) {
+		t.Errorf("upload still exists after erase: %v", err)
+	}
+	if _, err := files.Open(ctx, model.PDFKey(jobID)); err != storage.ErrNotFound {
+		t.Errorf("PDF still exists after erase: %v", err)
+	}
+	if _, err := resultCache.Get(ctx, "tenant:acme:translation:0123"); err != cache.ErrMiss {
+		t.Errorf("paragraph translation still cached after erase: %v", err)
+	}
+	if keys := redisClient.Keys(ctx, jobID+":*").Val(); len(keys) != 0 {
+		t.Errorf("Redis keys left after erase: %v", keys)
+	}
+	if w := do(router, "DELETE", "/api/jobs/"+jobID+"?erase=true", "acme-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("second erase: %d, want 404", w.Code)
+	}
+}
+
+func TestDeleteCacheEntry(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.DELETE("/api/admin/cache/entry", requireAdmin, handleDeleteCacheEntry)
+	var err error
+	if resultCache, err = cache.New(cache.BackendRedis, redisClient); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resultCache = nil })
+
+	hash := strings.Repeat("cd", 32)
+	resultCache.Set(ctx, "tenant:acme:imagehash:"+hash+":vi", "pdfs/acme/x.pdf", 0)
+	resultCache.Set(ctx, "tenant:globex:imagehash:"+hash+":vi", "pdfs/globex/x.pdf", 0)
+
+	// Tenant thường không xóa được cache, kể cả của chính mình
+	if w := do(router, "DELETE", "/api/admin/cache/entry?hash="+hash, "acme-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin tenant: %d, want 403", w.Code)
+	}
+	if w := do(router, "DELETE", "/api/admin/cache/entry?hash="+hash+"&tenant=nope", "ops-key", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown tenant: %d, want 400", w.Code)
+	}
+	w := do(router, "DELETE", "/api/admin/cache/entry?hash="+hash+"&tenant=acme", "ops-key", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":1`) {
+		t.Fatalf("admin: %d %s", w.Code, w.Body)
+	}
+	if _, err := resultCache.Get(ctx, "tenant:acme:imagehash:"+hash+":vi"); err != cache.ErrMiss {
+		t.Errorf("acme entry still cached: %v", err)
+	}
+	if _, err := resultCache.Get(ctx, "tenant:globex:imagehash:"+hash+":vi"); err != nil {
+		t.Errorf("globex entry deleted: %v", err)
+	}
+
+	// Không có TENANTS_FILE: ADMIN_API_KEY
+	router = newTenantRouter(t, "")
+	router.DELETE("/api/admin/cache/entry", requireAdmin, handleDeleteCacheEntry)
+	adminAPIKey = "secret"
+	if w := do(router, "DELETE", "/api/admin/cache/entry?hash="+hash, "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("no API key: %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/delivery"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+)
+
+// Trạng thái giao PDF tới một đích (Google Drive, Dropbox) của tenant
+const (
+	deliveryPending   = "pending"   // Chờ job xong, hoặc thử lại sau lỗi tạm thời
+	deliveryDelivered = "delivered" // Đã upload, file_id là ID của file trên đích
+	deliveryFailed    = "failed"    // Job lỗi, đích từ chối (token bị thu hồi, thư mục không tồn tại) hoặc hết số lần thử
+)
+
+const (
+	deliveriesPendingKey = "deliveries:pending" // ZSET job_id -> thời điểm tạo, các job có đích chờ giao PDF
+	deliveryLockTTL      = 5 * time.Minute      // Chỉ một replica API giao PDF của một job
+	deliveryDefaultEvery = 15 * time.Second     // Chu kỳ kiểm tra mặc định (DELIVERY_INTERVAL)
+	deliveryMaxAttempts  = 5                    // Số lần upload tối đa khi đích lỗi tạm thời (429, 5xx, mạng)
+)
+
+// jobDelivery là trạng thái giao PDF tới một đích, lưu (JSON) trong details "deliveries" của job
+type jobDelivery struct {
+	Target   string `json:"target"` // Tên đích trong cấu hình tenant
+	Provider string `json:"provider"`
+	Status   string `json:"status"`
+	FileName string `json:"file_name"`
+	delivery.File
+	Attempts    int        `json:"attempts,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+var (
+	deliveryInterval = deliveryDefaultEvery
+	// Uploader theo tenant và đích, giữ access token giữa các lần upload
+	deliveryUploaders   = map[string]*delivery.Uploader{}
+	deliveryUploadersMu sync.Mutex
+)
+
+// --- Đọc chu kỳ giao PDF (DELIVERY_INTERVAL) ---
+func initDelivery() error {
+	if raw := os.Getenv("DELIVERY_INTERVAL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("DELIVERY_INTERVAL must be a positive duration such as 15s, got %q", raw)
+		}
+		deliveryInterval = d
+	}
+	return nil
+}
+
+// --- Đọc trường deliver của form: tên các đích của tenant, cách nhau bởi dấu phẩy ---
+func parseDeliverForm(c *gin.Context, caller *tenant.Tenant) ([]jobDelivery, error) {
+	raw := c.PostForm("deliver")
+	if raw == "" {
+		return nil, nil
+	}
+	var deliveries []jobDelivery
+	seen := map[string]bool{}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		target, ok := caller.Delivery[name]
+		if !ok {
+			return nil, fmt.Errorf("deliver: no delivery target %q is configured for the tenant", name)
+		}
+		deliveries = append(deliveries, jobDelivery{Target: name, Provider: target.Provider, Status: deliveryPending})
+	}
+	return deliveries, nil
+}
+
+// Tên file PDF trên đích: tên file upload với đuôi .pdf, hoặc <job_id>.pdf
+func deliveryFileName(image *uploadImage, jobID string) string {
+	if image == nil {
+		return jobID + ".pdf"
+	}
+	name := filepath.Base(image.name)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".pdf"
+}
+
+// --- Bước giao: chạy định kỳ, upload PDF của các job đã xong tới đích của tenant ---
+func runDeliverer(ctx context.Context) {
+	ticker := time.NewTicker(deliveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := deliverPending(ctx); err != nil {
+			log.Printf("Error delivering PDFs: %v", err)
+		}
+	}
+}
+
+func deliverPending(ctx context.Context) error {
+	ids, err := redisClient.ZRange(ctx, deliveriesPendingKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		lockKey := id + ":delivery:lock"
+		locked, err := redisClient.SetNX(ctx, lockKey, "1", deliveryLockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if !locked {
+			continue // Replica khác đang giao
+		}
+		err = deliverJob(ctx, id)
+		redisClient.Del(ctx, lockKey)
+		if err != nil {
+			// Thử lại ở lần kiểm tra sau
+			log.Printf("Error delivering PDF of job %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// --- Giao PDF của job tới các đích còn pending, rồi bỏ job khỏi danh sách chờ khi xong ---
+func deliverJob(ctx context.Context, jobID string) error {
+	job, err := jobStore.Load(ctx, jobID)
+	if err == model.ErrNotFound {
+		// Job đã hết hạn hoặc bị xóa: không còn gì để giao
+		return redisClient.ZRem(ctx, deliveriesPendingKey, jobID).Err()
+	}
+	if err != nil {
+		return err
+	}
+	if job.Status == model.StatusQueued || job.Status == model.StatusProcessing {
+		return nil // Chờ job xong
+	}
+	var deliveries []jobDelivery
+	if err := json.Unmarshal([]byte(job.Details["deliveries"]), &deliveries); err != nil {
+		return redisClient.ZRem(ctx, deliveriesPendingKey, jobID).Err()
+	}
+
+	var pdfData []byte
+	noPDF := "Job failed, there is no PDF to deliver"
+	if job.Status == model.StatusCompleted {
+		pdfData, err = readArtifact(ctx, job.PDFPath)
+		if err == storage.ErrNotFound {
+			noPDF = "The PDF of the job no longer exists"
+		} else if err != nil {
+			return err
+		}
+	}
+	pending := 0
+	for i := range deliveries {
+		d := &deliveries[i]
+		if d.Status != deliveryPending {
+			continue
+		}
+		if pdfData == nil {
+			d.Status, d.Error = deliveryFailed, noPDF
+			continue
+		}
+		uploader, err := deliveryUploader(model.TenantOf(jobID), d.Target)
+		if err != nil {
+			d.Status, d.Error = deliveryFailed, err.Error()
+			continue
+		}
+		d.Attempts++
+		file, err := uploader.Upload(ctx, d.FileName, pdfData)
+		var providerErr *delivery.Error
+		switch {
+		case err == nil:
+			now := time.Now().UTC()
+			d.Status, d.File, d.Error, d.DeliveredAt = deliveryDelivered, file, "", &now
+			event := model.HistoryEvent{Type: model.HistoryDelivered, Detail: d.Target + ":" + file.ID}
+			if err := jobStore.RecordHistory(ctx, jobID, event); err != nil {
+				log.Printf("Warning: Failed to record delivered event in history of job %s: %v", jobID, err)
+			}
+		case errors.As(err, &providerErr) && !providerErr.Temporary(), d.Attempts >= deliveryMaxAttempts:
+			d.Status, d.Error = deliveryFailed, err.Error()
+			log.Printf("Failed to deliver PDF of job %s to %s: %v", jobID, d.Target, err)
+		default:
+			d.Error = err.Error()
+			pending++
+		}
+	}
+
+	data, err := json.Marshal(deliveries)
+	if err != nil {
+		return err
+	}
+	if err := jobStore.SaveDetails(ctx, jobID, map[string]string{"deliveries": string(data)}); err != nil {
+		return err
+	}
+	if pending > 0 {
+		return nil
+	}
+	return redisClient.ZRem(ctx, deliveriesPendingKey, jobID).Err()
+}
+
+// --- Uploader của đích của tenant; lỗi khi đích không còn trong cấu hình ---
+func deliveryUploader(tenantID, name string) (*delivery.Uploader, error) {
+	var target *delivery.Target
+	if tenants != nil {
+		if t, ok := tenants.Tenant(tenantID); ok {
+			target = t.Delivery[name]
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("delivery target %q is no longer configured", name)
+	}
+	deliveryUploadersMu.Lock()
+	defer deliveryUploadersMu.Unlock()
+	key := tenantID + "/" + name
+	uploader, ok := deliveryUploaders[key]
+	if !ok {
+		uploader = delivery.New(target)
+		deliveryUploaders[key] = uploader
+	}
+	return uploader, nil
+}
+
+func readArtifact(ctx context.Context, key string) ([]byte, error) {
+	reader, err := artifacts.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+const deliveryTenants = `{"tenants": [
+	{"id": "acme", "api_keys": ["acme-key"],
+	 "delivery": {"team-dropbox": {"provider": "dropbox", "folder": "/Translations", "access_token": "token"}}}
+]}`
+
+func TestDelivery(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, deliveryTenants)
+	router.POST("/api/upload", handleUpload)
+	cfg.OutputDir = t.TempDir()
+	jobBroker = &fakeBroker{}
+	artifacts = storage.NewFileStorage(t.TempDir())
+	t.Cleanup(func() { cfg.OutputDir, jobBroker, artifacts = "", nil, nil })
+
+	if w := uploadForm(t, router, "acme-key", "invoice.png", map[string]string{"deliver": "team-dropbox,drive"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown target: %d %s", w.Code, w.Body)
+	}
+	w := uploadForm(t, router, "acme-key", "invoice.png", map[string]string{"deliver": "team-dropbox"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", w.Code, w.Body)
+	}
+	var created struct {
+		JobID string `json:"job_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if n, _ := redisClient.ZCard(ctx, deliveriesPendingKey).Result(); n != 1 {
+		t.Fatalf("%d jobs waiting for delivery, want 1", n)
+	}
+
+	var status struct {
+		Deliveries []jobDelivery `json:"deliveries"`
+	}
+	w = do(router, "GET", "/api/status/"+created.JobID, "acme-key", "")
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if len(status.Deliveries) != 1 || status.Deliveries[0].Status != deliveryPending || status.Deliveries[0].FileName != "invoice.pdf" || status.Deliveries[0].Provider != "dropbox" {
+		t.Fatalf("deliveries = %s", w.Body)
+	}
+
+	// Job chưa xong: chờ
+	if err := deliverPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := redisClient.ZCard(ctx, deliveriesPendingKey).Result(); n != 1 {
+		t.Fatalf("queued job removed from the deliveries")
+	}
+
+	// Job lỗi: không có PDF để giao
+	jobStore.SetStatus(ctx, created.JobID, model.StatusFailed, "OCR failed")
+	if err := deliverPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	w = do(router, "GET", "/api/status/"+created.JobID, "acme-key", "")
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if len(status.Deliveries) != 1 || status.Deliveries[0].Status != deliveryFailed || status.Deliveries[0].Error == "" {
+		t.Errorf("deliveries of a failed job = %s", w.Body)
+	}
+	if n, _ := redisClient.ZCard(ctx, deliveriesPendingKey).Result(); n != 0 {
+		t.Errorf("failed job still waiting for delivery")
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const downloadURLDefaultTTL = 15 * time.Minute // Thời hạn mặc định của link tải PDF
+
+var (
+	downloadKey    []byte        // Khóa HMAC ký link tải (DOWNLOAD_SIGNING_KEY)
+	downloadURLTTL time.Duration // Thời hạn link tải (DOWNLOAD_URL_TTL)
+)
+
+// Route tải PDF và output: chữ ký trong link thay cho API key (link mở trực tiếp từ trình duyệt)
+var signedRoutes = map[string]bool{
+	"/api/download/:job_id":             true,
+	"/api/archive/:job_id/pdf":          true,
+	"/api/jobs/:job_id/outputs/:output": true,
+	"/api/jobs/:job_id/artifacts/:name": true,
+}
+
+// --- Đọc khóa và thời hạn của link tải từ biến môi trường ---
+// Không có DOWNLOAD_SIGNING_KEY: dùng khóa ngẫu nhiên, link hết hiệu lực khi API
+// khởi động lại và không dùng được giữa nhiều instance API
+func initDownloadSigning() error {
+	downloadURLTTL = downloadURLDefaultTTL
+	if raw := os.Getenv("DOWNLOAD_URL_TTL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("DOWNLOAD_URL_TTL must be a positive duration such as 15m, got %q", raw)
+		}
+		downloadURLTTL = d
+	}
+	if key := os.Getenv("DOWNLOAD_SIGNING_KEY"); key != "" {
+		if len(key) < 32 {
+			return fmt.Errorf("DOWNLOAD_SIGNING_KEY must be at least 32 characters")
+		}
+		downloadKey = []byte(key)
+		return nil
+	}
+	downloadKey = make([]byte, 32)
+	if _, err := rand.Read(downloadKey); err != nil {
+		return err
+	}
+	log.Printf("Warning: DOWNLOAD_SIGNING_KEY is not set, download links are signed with a random key (invalid after a restart and on other API replicas)")
+	return nil
+}
+
+// --- Chữ ký HMAC-SHA256 của đường dẫn và thời điểm hết hạn ---
+func downloadSignature(path string, expires int64) string {
+	mac := hmac.New(sha256.New, downloadKey)
+	fmt.Fprintf(mac, "%s\n%d", path, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// --- Tạo link tải có chữ ký, hết hạn sau downloadURLTTL ---
+func signedURL(path string) (string, time.Time) {
+	expires := time.Now().Add(downloadURLTTL).Truncate(time.Second)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", downloadSignature(path, expires.Unix()))
+	return path + "?" + query.Encode(), expires
+}
+
+// --- Middleware kiểm tra chữ ký và thời hạn của link tải ---
+// Thời điểm hết hạn được lưu trong context để URL ký sẵn của S3 không sống lâu hơn link
+func requireSignature(c *gin.Context) {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	signature := c.Query("signature")
+	valid := err == nil && hmac.Equal([]byte(signature), []byte(downloadSignature(c.Request.URL.Path, expires)))
+	if !valid {
+		respondError(c, http.StatusForbidden, codeInvalidDownloadLink, "Download link is missing or invalid, get a new one from the job status")
+		return
+	}
+	if time.Now().Unix() >= expires {
+		respondError(c, http.StatusForbidden, codeDownloadLinkExpired, "Download link expired, get a new one from the job status")
+		return
+	}
+	c.Set("link_expires", time.Unix(expires, 0))
+	c.Next()
+}
+
+// --- Thời hạn còn lại của link tải của request (tối đa presignTTL) ---
+func linkTTL(c *gin.Context) time.Duration {
+	ttl := presignTTL
+	if expires, ok := c.Get("link_expires"); ok {
+		if remaining := time.Until(expires.(time.Time)); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return max(ttl, time.Second)
+}
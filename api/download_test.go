@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireSignature(t *testing.T) {
+	router := newTenantRouter(t, testTenants) // Link tải không cần API key cả khi có tenant
+	downloadKey, downloadURLTTL = []byte("0123456789abcdef0123456789abcdef"), time.Minute
+	router.GET("/api/download/:job_id", requireSignature, func(c *gin.Context) {
+		c.String(http.StatusOK, linkTTL(c).String())
+	})
+
+	link, expires := signedURL("/api/download/acme.job1")
+	if until := time.Until(expires); until <= 0 || until > time.Minute {
+		t.Fatalf("link expires in %v, want within DOWNLOAD_URL_TTL", until)
+	}
+	w := do(router, "GET", link, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("signed link: %d %s", w.Code, w.Body)
+	}
+	if ttl, _ := time.ParseDuration(w.Body.String()); ttl > time.Minute {
+		t.Errorf("presign TTL %v outlives the link", ttl)
+	}
+
+	query, _ := url.ParseQuery(link[len("/api/download/acme.job1?"):])
+	expired := time.Now().Add(-time.Second).Unix()
+	tests := map[string]string{
+		"missing signature": "/api/download/acme.job1",
+		"other job":         "/api/download/globex.job1?" + query.Encode(),
+		"changed expiry":    "/api/download/acme.job1?expires=" + strconv.FormatInt(expires.Unix()+3600, 10) + "&signature=" + query.Get("signature"),
+		"expired":           "/api/download/acme.job1?expires=" + strconv.FormatInt(expired, 10) + "&signature=" + downloadSignature("/api/download/acme.job1", expired),
+	}
+	for name, path := range tests {
+		if w := do(router, "GET", path, "", ""); w.Code != http.StatusForbidden {
+			t.Errorf("%s: %d, want 403", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+)
+
+// --- Mã lỗi ổn định của API (trường "code" trong {"error": {...}}) ---
+// Client rẽ nhánh theo mã, không theo message. Mã dùng chung (INVALID_REQUEST,
+// NOT_FOUND, INTERNAL_ERROR...) nằm trong pkg/httpserver.
+const (
+	codeInvalidImage        = "INVALID_IMAGE"         // Thiếu file upload
+	codeUnsupportedOption   = "UNSUPPORTED_OPTION"    // Tùy chọn không áp dụng cho loại input (PDF)
+	codeInvalidSourceJob    = "INVALID_SOURCE_JOB"    // source_job_id/parent_job_id không tồn tại hoặc chưa xong
+	codeJobNotFound         = "JOB_NOT_FOUND"         // Job không tồn tại, đã hết hạn hoặc thuộc tenant khác
+	codeJobNotCompleted     = "JOB_NOT_COMPLETED"     // details.status: trạng thái hiện tại
+	codePDFNotFound         = "PDF_NOT_FOUND"         // PDF không còn trong storage
+	codeTextNotFound        = "TEXT_NOT_FOUND"        // Job không có văn bản (hoặc văn bản vùng crop)
+	codeNotAcceptable       = "NOT_ACCEPTABLE"        // details.available: Accept không khớp định dạng nào của route
+	codeOutputNotFound      = "OUTPUT_NOT_FOUND"      // Output không được yêu cầu cho job hoặc không còn trong storage
+	codeArtifactNotFound    = "ARTIFACT_NOT_FOUND"    // File trung gian không tồn tại, chưa được tạo hoặc không còn trong storage
+	codePreviewNotFound     = "PREVIEW_NOT_FOUND"     // Chưa có thumbnail (details.status: trạng thái của job)
+	codeGlossaryNotFound    = "GLOSSARY_NOT_FOUND"    // Glossary không tồn tại
+	codeTermNotFound        = "TERM_NOT_FOUND"        // Thuật ngữ không có trong glossary
+	codeUnauthorized        = "UNAUTHORIZED"          // Thiếu hoặc sai API key
+	codeAdminRequired       = "ADMIN_REQUIRED"        // Route quản trị toàn hệ thống, API key không thuộc tenant admin
+	codeQuotaExceeded       = "QUOTA_EXCEEDED"        // details.daily_jobs hoặc daily_chars: hạn mức mỗi ngày của tenant
+	codeInvalidDownloadLink = "INVALID_DOWNLOAD_LINK" // Link tải thiếu hoặc sai chữ ký
+	codeDownloadLinkExpired = "DOWNLOAD_LINK_EXPIRED" // Link tải quá hạn, lấy link mới từ status
+	codeUploadTooLarge      = "UPLOAD_TOO_LARGE"      // details.max_bytes: file upload vượt UPLOAD_MAX_BYTES
+	codeUploadNotFound      = "UPLOAD_NOT_FOUND"      // Upload nối tiếp không tồn tại, đã hết hạn hoặc thuộc tenant khác
+	codeUploadConflict      = "UPLOAD_CONFLICT"       // Upload-Offset sai (details.offset: số byte đã nhận) hoặc đang có PATCH khác
+	codeInvalidArchive      = "INVALID_ARCHIVE"       // File ZIP hỏng, hoặc mục có đường dẫn không an toàn (zip-slip)
+	codeTooManyEntries      = "TOO_MANY_ENTRIES"      // details.max_entries: file ZIP có nhiều file hơn BATCH_MAX_ENTRIES
+	codeBatchNotFound       = "BATCH_NOT_FOUND"       // Lô job không tồn tại, đã hết hạn hoặc thuộc tenant khác
+	codeSyncImageTooLarge   = "SYNC_IMAGE_TOO_LARGE"  // details.max_bytes: ảnh quá lớn cho mode=sync
+	codeMalwareDetected     = "MALWARE_DETECTED"      // details.signature: mã độc ClamAV tìm thấy, file đã bị cách ly
+	codeJobStillRunning     = "JOB_STILL_RUNNING"     // /ws: job chưa xong sau thời gian theo dõi tối đa, poll status
+	codeQueueUnavailable    = "QUEUE_UNAVAILABLE"     // Không gửi được job vào broker (thử lại sau)
+	codeQueueOverloaded     = "QUEUE_OVERLOADED"      // details.pending: hàng đợi vượt BACKPRESSURE_MAX_LAG, thử lại sau Retry-After
+	codeStoreUnavailable    = "STORE_UNAVAILABLE"     // Lỗi Redis (thử lại sau)
+	codeScanUnavailable     = "SCAN_UNAVAILABLE"      // Không quét được mã độc (clamd lỗi, thử lại sau)
+	codeScanTooLarge        = "SCAN_TOO_LARGE"        // File vượt StreamMaxLength của clamd nên không quét được mã độc
+	codeStorageUnavailable  = "STORAGE_UNAVAILABLE"   // Lỗi đọc/ghi file upload, PDF hoặc kho lưu trữ
+	codeInputNotFound       = "INPUT_NOT_FOUND"       // File input của job không còn (xử lý lại, xóa cache theo job)
+	codeCacheUnsupported    = "CACHE_NOT_SUPPORTED"   // Backend cache không xóa được theo hash (memory, memcached, disk)
+	codeNoAutoscaleHint     = "NO_AUTOSCALE_HINT"     // Không worker nào ghi số replica cần thiết (WORKER_MAX_CONCURRENCY)
+)
+
+// --- Trả lỗi có cấu trúc và dừng các handler sau ---
+// details (tùy chọn) chứa thông tin để client xử lý, ví dụ trạng thái của job
+func respondError(c *gin.Context, status int, code, message string, details ...gin.H) {
+	var d map[string]any
+	if len(details) > 0 {
+		d = details[0]
+	}
+	c.AbortWithStatusJSON(status, httpserver.ErrorResponse{Error: httpserver.NewError(c.Request, code, message, d)})
+}
+
+// --- Lỗi trả về bởi các hàm dùng chung giữa handler HTTP và WebSocket ---
+type jobError struct {
+	status     int
+	code       string
+	message    string
+	details    gin.H
+	retryAfter int // Giây, header Retry-After (0: không gửi)
+}
+
+func newJobError(status int, code, message string, details ...gin.H) *jobError {
+	e := &jobError{status: status, code: code, message: message}
+	if len(details) > 0 {
+		e.details = details[0]
+	}
+	return e
+}
+
+// --- Trả jobError như lỗi HTTP ---
+func (e *jobError) respond(c *gin.Context) {
+	if e.retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(e.retryAfter))
+	}
+	respondError(c, e.status, e.code, e.message, e.details)
+}
+
+// --- Route không tồn tại, sai method, panic: cùng định dạng lỗi với các handler ---
+func handleNoRoute(c *gin.Context) {
+	respondError(c, http.StatusNotFound, httpserver.CodeNotFound, "Route not found")
+}
+
+func handleNoMethod(c *gin.Context) {
+	respondError(c, http.StatusMethodNotAllowed, httpserver.CodeMethodNotAllowed, "Method not allowed")
+}
+
+func handlePanic(c *gin.Context, recovered any) {
+	log.Printf("Panic in %s %s (request %s): %v", c.Request.Method, c.Request.URL.Path, httpserver.RequestID(c.Request), recovered)
+	respondError(c, http.StatusInternalServerError, httpserver.CodeInternal, "Internal server error")
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// --- ETag của job: đổi mỗi khi trạng thái đổi (version) ---
+// withDetails: thêm digest của details, vốn đổi giữa hai lần đổi trạng thái (stage, deliveries...)
+func jobETag(job *model.Result, withDetails bool) string {
+	if !withDetails {
+		return fmt.Sprintf(`"%s-%d"`, job.JobID, job.Version)
+	}
+	keys := make([]string, 0, len(job.Details))
+	for key := range job.Details {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	h := fnv.New64a()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s\n", key, job.Details[key])
+	}
+	return fmt.Sprintf(`"%s-%d-%x"`, job.JobID, job.Version, h.Sum64())
+}
+
+// --- Gửi ETag; trả 304 và true khi If-None-Match của request khớp ---
+// no-cache: proxy và trình duyệt giữ bản sao nhưng phải hỏi lại API trước khi dùng
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/") // So sánh yếu (RFC 9110)
+		if candidate == etag || candidate == "*" {
+			c.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.GET("/api/download/:job_id", requireSignature, handleDownload)
+	downloadKey, downloadURLTTL = []byte("0123456789abcdef0123456789abcdef"), time.Minute
+	dir := t.TempDir()
+	artifacts = storage.NewFileStorage(dir)
+	t.Cleanup(func() { artifacts = nil })
+
+	jobID := model.TenantJobID("acme", "job1")
+	jobStore.SetStatus(ctx, jobID, model.StatusProcessing, "")
+	jobStore.SaveDetails(ctx, jobID, map[string]string{"stage": "ocr"})
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", "acme-key")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/status/"+jobID, "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status: %d, ETag %q", w.Code, etag)
+	}
+	if w := get("/api/status/"+jobID, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("unchanged status: %d %s", w.Code, w.Body)
+	}
+	if w := get("/api/status/"+jobID, `"other", W/`+etag); w.Code != http.StatusNotModified {
+		t.Errorf("weak ETag in a list: %d", w.Code)
+	}
+	jobStore.SaveDetails(ctx, jobID, map[string]string{"stage": "translate"})
+	if w := get("/api/status/"+jobID, etag); w.Code != http.StatusOK {
+		t.Errorf("stage changed: %d", w.Code)
+	}
+
+	pdfKey := model.PDFKey(jobID)
+	os.MkdirAll(filepath.Dir(filepath.Join(dir, pdfKey)), 0o755)
+	os.WriteFile(filepath.Join(dir, pdfKey), []byte("%PDF-1.4"), 0o644)
+	jobStore.SetStatus(ctx, jobID, model.StatusCompleted, pdfKey)
+	link, _ := signedURL("/api/download/" + jobID)
+	w = get(link, "")
+	pdfETag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "%PDF-1.4" || pdfETag == "" {
+		t.Fatalf("download: %d, ETag %q", w.Code, pdfETag)
+	}
+	if w := get(link, pdfETag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("unchanged PDF: %d", w.Code)
+	}
+	// Xử lý lại: version mới, PDF mới
+	jobStore.SetStatus(ctx, jobID, model.StatusCompleted, pdfKey)
+	if w := get(link, pdfETag); w.Code != http.StatusOK {
+		t.Errorf("PDF of a new version: %d", w.Code)
+	}
+}
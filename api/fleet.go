@@ -0,0 +1,61 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/autoscale"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/fleet"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+)
+
+// --- Handler trả về danh sách worker từ heartbeat trong Redis ---
+// GET /api/admin/workers: worker còn sống và worker bị treo (mất heartbeat quá
+// fleet.StaleAfter, hoặc có job nằm ở một bước quá stall_after, mặc định 15 phút)
+func handleAdminWorkers(c *gin.Context) {
+	stallAfter := fleet.DefaultJobStallAfter
+	if v := c.Query("stall_after"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "Invalid stall_after, expected a duration such as 10m")
+			return
+		}
+		stallAfter = d
+	}
+
+	workers, err := fleet.List(c.Request.Context(), redisClient, stallAfter)
+	if err != nil {
+		log.Printf("Error listing workers from Redis: %v", err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to list workers")
+		return
+	}
+	live, stalled := 0, 0
+	for _, w := range workers {
+		if w.Status == fleet.StatusStalled {
+			stalled++
+		} else {
+			live++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"workers": workers, "live": live, "stalled": stalled})
+}
+
+// --- Handler trả về số replica worker cần thiết theo hàng đợi, do worker tự điều chỉnh ghi ---
+// GET /api/admin/autoscale: nguồn cho HPA (external metric) hoặc KEDA metrics-api
+// (valueLocation: desired_replicas); 404 khi không có worker nào bật WORKER_MAX_CONCURRENCY
+func handleAdminAutoscale(c *gin.Context) {
+	hint, err := autoscale.LoadHint(c.Request.Context(), redisClient)
+	if err != nil {
+		log.Printf("Error loading autoscale hint from Redis: %v", err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get autoscale hint")
+		return
+	}
+	if hint == nil {
+		respondError(c, http.StatusNotFound, codeNoAutoscaleHint, "No worker published an autoscale hint recently (set WORKER_MAX_CONCURRENCY on the workers)")
+		return
+	}
+	c.JSON(http.StatusOK, hint)
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+)
+
+// Tên glossary hợp lệ (dùng trong Redis key và URL)
+var glossaryNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Glossary lưu trong Redis dạng hash (tenant.GlossaryKey), field = thuật ngữ nguồn, value = bản dịch bắt buộc
+// Mỗi tenant có glossary riêng; tenant mặc định dùng key glossary:{name}
+func glossaryKey(c *gin.Context, name string) string {
+	return tenant.GlossaryKey(callerTenant(c).ID, name)
+}
+
+// Set chứa tên các glossary của tenant
+func glossaryIndexKey(c *gin.Context) string {
+	return tenant.GlossaryIndexKey(callerTenant(c).ID)
+}
+
+// --- Lấy tên glossary từ URL, trả về false nếu không hợp lệ ---
+func glossaryName(c *gin.Context) (string, bool) {
+	name := c.Param("name")
+	if !glossaryNamePattern.MatchString(name) {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "glossary name must be 1-64 letters, digits, '-' or '_'")
+		return "", false
+	}
+	return name, true
+}
+
+// --- Đọc thuật ngữ truyền trực tiếp khi upload (glossary_terms: JSON object) ---
+func parseGlossaryForm(c *gin.Context) (string, map[string]string, error) {
+	name := c.PostForm("glossary")
+	if name != "" {
+		if !glossaryNamePattern.MatchString(name) {
+			return "", nil, fmt.Errorf("invalid glossary name")
+		}
+		n, err := redisClient.Exists(c.Request.Context(), glossaryKey(c, name)).Result()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to check glossary %s", name)
+		}
+		if n == 0 {
+			return "", nil, fmt.Errorf("glossary %s not found", name)
+		}
+	}
+	var terms map[string]string
+	if raw := c.PostForm("glossary_terms"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &terms); err != nil {
+			return "", nil, fmt.Errorf("glossary_terms must be a JSON object of source term to target term")
+		}
+	}
+	return name, terms, nil
+}
+
+// --- GET /api/glossaries: danh sách glossary ---
+func handleListGlossaries(c *gin.Context) {
+	names, err := redisClient.SMembers(c.Request.Context(), glossaryIndexKey(c)).Result()
+	if err != nil {
+		log.Printf("Error listing glossaries from Redis: %v", err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to list glossaries")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"glossaries": names})
+}
+
+// --- GET /api/glossaries/:name: các thuật ngữ của glossary ---
+func handleGetGlossary(c *gin.Context) {
+	name, ok := glossaryName(c)
+	if !ok {
+		return
+	}
+	terms, err := redisClient.HGetAll(c.Request.Context(), glossaryKey(c, name)).Result()
+	if err != nil {
+		log.Printf("Error getting glossary %s from Redis: %v", name, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get glossary")
+		return
+	}
+	if len(terms) == 0 {
+		respondError(c, http.StatusNotFound, codeGlossaryNotFound, "Glossary not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": name, "terms": terms})
+}
+
+// --- PUT /api/glossaries/:name: tạo mới hoặc thay thế toàn bộ glossary ---
+// Body: {"terms": {"Acme Cloud": "Acme Cloud", "invoice": "hóa đơn"}}
+func handlePutGlossary(c *gin.Context) {
+	name, ok := glossaryName(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Terms map[string]string `json:"terms"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Terms) == 0 {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "body must be {\"terms\": {source: target, ...}} with at least one term")
+		return
+	}
+	ctx := c.Request.Context()
+	pipe := redisClient.TxPipeline()
+	pipe.Del(ctx, glossaryKey(c, name))
+	pipe.HSet(ctx, glossaryKey(c, name), body.Terms)
+	pipe.SAdd(ctx, glossaryIndexKey(c), name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error saving glossary %s to Redis: %v", name, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to save glossary")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": name, "terms": body.Terms})
+}
+
+// --- POST /api/glossaries/:name/terms: thêm hoặc sửa một thuật ngữ ---
+// Body: {"source": "Acme Cloud", "target": "Acme Cloud"}
+func handlePutGlossaryTerm(c *gin.Context) {
+	name, ok := glossaryName(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Source == "" {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "body must be {\"source\": ..., \"target\": ...}")
+		return
+	}
+	ctx := c.Request.Context()
+	pipe := redisClient.TxPipeline()
+	pipe.HSet(ctx, glossaryKey(c, name), body.Source, body.Target)
+	pipe.SAdd(ctx, glossaryIndexKey(c), name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error saving term to glossary %s in Redis: %v", name, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to save glossary term")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": name, "source": body.Source, "target": body.Target})
+}
+
+// --- DELETE /api/glossaries/:name/terms?source=...: xóa một thuật ngữ ---
+func handleDeleteGlossaryTerm(c *gin.Context) {
+	name, ok := glossaryName(c)
+	if !ok {
+		return
+	}
+	source := c.Query("source")
+	if source == "" {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "source query parameter is required")
+		return
+	}
+	ctx := c.Request.Context()
+	removed, err := redisClient.HDel(ctx, glossaryKey(c, name), source).Result()
+	if err != nil {
+		log.Printf("Error deleting term from glossary %s in Redis: %v", name, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to delete glossary term")
+		return
+	}
+	if removed == 0 {
+		respondError(c, http.StatusNotFound, codeTermNotFound, "Term not found")
+		return
+	}
+	// Glossary rỗng bị Redis xóa -> bỏ khỏi danh sách
+	if n, err := redisClient.Exists(ctx, glossaryKey(c, name)).Result(); err == nil && n == 0 {
+		redisClient.SRem(ctx, glossaryIndexKey(c), name)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// --- DELETE /api/glossaries/:name: xóa glossary ---
+func handleDeleteGlossary(c *gin.Context) {
+	name, ok := glossaryName(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	pipe := redisClient.TxPipeline()
+	del := pipe.Del(ctx, glossaryKey(c, name))
+	pipe.SRem(ctx, glossaryIndexKey(c), name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error deleting glossary %s from Redis: %v", name, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to delete glossary")
+		return
+	}
+	if del.Val() == 0 {
+		respondError(c, http.StatusNotFound, codeGlossaryNotFound, "Glossary not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// --- Người gửi request trong lịch sử job: tenant và dấu vân tay của API key (không lưu key) ---
+func requestActor(c *gin.Context) string {
+	if signedRoutes[c.FullPath()] {
+		return "signed_link"
+	}
+	actor := "tenant:" + callerTenant(c).ID
+	if key, ok := c.Get("api_key"); ok {
+		sum := sha256.Sum256([]byte(key.(string)))
+		actor += " key:" + hex.EncodeToString(sum[:4])
+	}
+	return actor
+}
+
+// --- Ghi một sự kiện của request vào lịch sử job (IP, request ID); lỗi chỉ được log ---
+func recordHistory(c *gin.Context, jobID string, event model.HistoryEvent) {
+	event.Actor = requestActor(c)
+	event.IP = c.ClientIP()
+	event.RequestID = httpserver.RequestID(c.Request)
+	if err := jobStore.RecordHistory(c.Request.Context(), jobID, event); err != nil {
+		log.Printf("Warning: Failed to record %s event in history of job %s: %v", event.Type, jobID, err)
+	}
+}
+
+// --- Handler trả về lịch sử của job (audit trail) ---
+// GET /api/jobs/:job_id/history: gửi bởi tenant/API key nào từ IP nào, các lần đổi trạng thái
+// và bước xử lý kèm thời điểm và worker, các lần tải PDF/output; cũ nhất trước
+func handleJobHistory(c *gin.Context) {
+	jobID := c.Param("job_id")
+	history, err := model.LoadHistory(c.Request.Context(), redisClient, jobID)
+	if err != nil {
+		log.Printf("Error loading history of job %s from Redis: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job history")
+		return
+	}
+	if len(history) == 0 {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job_id": jobID, "events": history})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+)
+
+const maxJobLabels = 16 // Số nhãn tối đa của một job
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,62}$`)
+	labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9._:/-]{1,63}$`)
+)
+
+// --- Đọc danh sách nhãn "key=value" cách nhau bởi dấu phẩy (ví dụ department=legal,batch=2024-06) ---
+// Dùng cho trường form labels và bộ chọn ?labels= của GET /api/jobs
+func parseLabels(raw string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || !labelKeyPattern.MatchString(key) || !labelValuePattern.MatchString(value) {
+			return nil, fmt.Errorf("label %q must be key=value, with a key of letters, digits, '.', '_', '-' or '/' and a value of at most 63 such characters or ':'", item)
+		}
+		if other, ok := labels[key]; ok && other != value {
+			return nil, fmt.Errorf("label %s is set twice", key)
+		}
+		labels[key] = value
+	}
+	if len(labels) > maxJobLabels {
+		return nil, fmt.Errorf("at most %d labels are allowed", maxJobLabels)
+	}
+	return labels, nil
+}
+
+// --- Tham chiếu của các nhãn trong chỉ mục job của tenant (tenant.RefKey), theo thứ tự key ---
+func labelRefs(labels map[string]string) []tenant.Ref {
+	refs := make([]tenant.Ref, 0, len(labels))
+	for key, value := range labels {
+		refs = append(refs, tenant.Ref{Kind: "label", Value: key + "=" + value})
+	}
+	slices.SortFunc(refs, func(a, b tenant.Ref) int { return strings.Compare(a.Value, b.Value) })
+	return refs
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/lineage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// --- Đọc quan hệ lineage từ form upload ---
+// parent_job_id + relation (retry, regeneration, dependent) và/hoặc merge_members (danh sách job ID, cách nhau bởi dấu phẩy)
+// Trả về danh sách cạnh cha -> con (con là job mới, điền sau khi có jobID)
+func parseLineageForm(c *gin.Context) ([]lineage.Edge, error) {
+	var edges []lineage.Edge
+	if parent := c.PostForm("parent_job_id"); parent != "" {
+		relation := c.DefaultPostForm("relation", lineage.RelationRetry)
+		if !lineage.ValidRelation(relation) || relation == lineage.RelationMerge {
+			return nil, fmt.Errorf("relation must be 'retry', 'regeneration' or 'dependent'")
+		}
+		edges = append(edges, lineage.Edge{Parent: parent, Relation: relation})
+	}
+	if members := c.PostForm("merge_members"); members != "" {
+		for _, member := range strings.Split(members, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				edges = append(edges, lineage.Edge{Parent: member, Relation: lineage.RelationMerge})
+			}
+		}
+	}
+
+	// Job cha phải tồn tại và thuộc tenant của request
+	for _, edge := range edges {
+		if !ownsJob(c, edge.Parent) {
+			return nil, fmt.Errorf("parent job %s not found", edge.Parent)
+		}
+		n, err := redisClient.Exists(c.Request.Context(), model.StatusKey(edge.Parent)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check parent job %s", edge.Parent)
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("parent job %s not found", edge.Parent)
+		}
+	}
+	return edges, nil
+}
+
+// --- Handler trả về đồ thị lineage của Job ---
+// GET /api/jobs/:job_id/lineage
+func handleLineage(c *gin.Context) {
+	jobID := c.Param("job_id")
+	ctx := c.Request.Context()
+
+	graph, err := lineage.Load(ctx, redisClient, jobID)
+	if err != nil {
+		log.Printf("Error loading lineage from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job lineage")
+		return
+	}
+
+	// Trạng thái hiện tại của mọi job trong đồ thị (job đã hết hạn có trạng thái "expired")
+	ids := append([]string{jobID}, graph.Ancestors...)
+	ids = append(ids, graph.Children...)
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = model.StatusKey(id)
+	}
+	vals, err := redisClient.MGet(ctx, keys...).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Error getting lineage statuses from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job lineage")
+		return
+	}
+	if vals[0] == nil && len(graph.Edges) == 0 {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	statuses := make(map[string]string, len(ids))
+	for i, id := range ids {
+		if status, ok := vals[i].(string); ok {
+			statuses[id] = status
+		} else {
+			statuses[id] = "expired"
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":      graph.JobID,
+		"ancestors":   graph.Ancestors,
+		"descendants": graph.Children,
+		"edges":       graph.Edges,
+		"statuses":    statuses,
+		"truncated":   graph.Truncated,
+	})
+}
@@ -1,37 +1,65 @@
-package main
+// Package api is the HTTP server receiving uploads and serving job status,
+// texts and PDFs. It is started by `imgproc serve`.
+package api
 
 import (
 	"context"       // Thêm context cho Redis/Kafka
 	"encoding/json" // Thêm để marshal Kafka message
 	"fmt"
 	"log" // Thêm để ghi log lỗi
+	"maps"
 	"net/http"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time" // Thêm để đặt TTL cho Redis key
 
-	"github.com/gin-contrib/cors" // Import CORS middleware
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8" // Import Redis client
 	"github.com/google/uuid"
-	"github.com/segmentio/kafka-go" // Import Kafka client
 
+	"github.com/mxngoc2104/KTPM-CS2/pkg/archive"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/broker"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/janitor"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/lineage"
 	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging" // Import JobMessage từ package chung
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/notify"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pipeline"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/reaper"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
 )
 
-// TODO: Di chuyển cấu hình ra nơi khác (ví dụ: env vars, file config)
 const (
-	kafkaBroker = "localhost:9092"
-	kafkaTopic  = "image_processing_jobs"
-	redisAddr   = "localhost:6379"
-	uploadDir   = "../output/uploads" // Thư mục tạm lưu ảnh upload
-	pdfDir      = "../output/pdfs"    // Thư mục lưu trữ PDF kết quả
-	jobTTL      = time.Hour * 24      // Thời gian sống của thông tin job trong Redis (1 ngày)
+	presignTTL = 15 * time.Minute // Thời hạn URL tải trực tiếp khi dùng S3
+	jobTTL     = time.Hour * 24   // Thời gian sống của thông tin job trong Redis (1 ngày)
+
+	sourceMaxLength     = 256 // Độ dài tối đa của trường source
+	externalIDMaxLength = 256 // Độ dài tối đa của trường external_id
 )
 
-// Biến toàn cục cho Redis client và Kafka writer (để đơn giản)
+// Mã ngôn ngữ đích hợp lệ: ISO 639-1/639-2, có thể kèm vùng (ví dụ: "zh-CN")
+var langCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z]{2,4})?$`)
+
+// Biến toàn cục cho Redis client và broker (để đơn giản)
 var (
-	redisClient *redis.Client
-	kafkaWriter *kafka.Writer
+	cfg          config.Config // Redis, broker, thư mục output (dùng chung với worker)
+	redisClient  *redis.Client
+	jobBroker    broker.Publisher // Gửi job cho worker (BROKER: kafka, nats)
+	syncBroker   broker.Publisher // Làn ưu tiên cho job mode=sync (PRIORITY_TOPIC), nil: dùng jobBroker
+	artifacts    storage.Storage  // Nơi lưu PDF kết quả (STORAGE_BACKEND: file, s3)
+	archiveStore storage.Storage  // Kho lưu trữ job đã xong (ARCHIVE_DIR, ARCHIVE_S3_BUCKET; mặc định artifacts)
+	jobStore     *model.Store     // Trạng thái và thông tin chi tiết của job (dùng chung với worker)
+	redisHealth  *cache.RedisHealth
+	resultCache  cache.Cache // Cache kết quả của worker (CACHE_BACKEND), để xóa kết quả sai theo hash
 )
 
 // Struct cho message gửi vào Kafka - Đã chuyển vào pkg/messaging
@@ -42,117 +70,699 @@ type JobMessage struct {
 }
 */
 
-func main() {
-	// Khởi tạo Redis Client
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: redisAddr,
-		DB:   0, // Sử dụng DB mặc định
-	})
-	// Kiểm tra kết nối Redis
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	_, err := redisClient.Ping(ctx).Result()
+// Serve khởi tạo Redis, storage, broker và chạy HTTP server tại c.ListenAddr
+func Serve(c config.Config) {
+	cfg = c
+	// Profiler (pprof) trên cổng quản trị riêng, không đi qua router của API (ADMIN_ADDR)
+	httpserver.StartAdmin(cfg.AdminAddr)
+
+	// Khởi tạo Redis Client: retry/backoff, timeout và pool theo REDIS_* (pkg/cache)
+	redisConfig, err := cache.RedisConfigFromEnv(cfg.RedisAddr)
 	if err != nil {
+		log.Fatalf("Invalid Redis configuration: %v", err)
+	}
+	if threshold, err := time.ParseDuration(os.Getenv("REDIS_SLOW_LOG")); err == nil {
+		redisConfig.Observer = cache.SlowCommandLogger("", threshold)
+	}
+	redisClient = cache.NewRedisClient(redisConfig)
+	// Chờ Redis sẵn sàng (khởi động cùng lúc trong docker compose/Kubernetes)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := cache.WaitForRedis(ctx, redisClient); err != nil {
 		log.Fatalf("Could not connect to Redis: %v", err)
 	}
 	fmt.Println("Connected to Redis")
+	// Kiểm tra Redis định kỳ cho GET /api/health (load balancer, Kubernetes)
+	redisHealth = cache.NewRedisHealth(redisClient)
+	redisHealth.Start(context.Background(), 10*time.Second)
+	jobStore = model.NewStore(redisClient, jobTTL).WithActor("api")
+	if resultCache, err = cache.New(os.Getenv("CACHE_BACKEND"), redisClient); err != nil {
+		log.Printf("Warning: Result cache unavailable, cache entries cannot be deleted through the API: %v", err)
+	}
 
-	// Khởi tạo Kafka Writer (Producer)
-	kafkaWriter = &kafka.Writer{
-		Addr:     kafka.TCP(kafkaBroker),
-		Topic:    kafkaTopic,
-		Balancer: &kafka.LeastBytes{},
+	artifacts, err = storage.FromEnv(cfg.OutputDir)
+	if err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+	fmt.Printf("Using '%s' artifact storage\n", artifacts.Name())
+
+	// Khởi tạo producer của broker (Kafka mặc định, hoặc NATS JetStream)
+	// Kafka writer tự động kết nối khi gửi message; NATS kết nối và tạo stream ngay
+	jobBroker, err = broker.NewPublisher(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up the message broker: %v", err)
 	}
-	// Không cần kiểm tra kết nối Kafka ngay lập tức, writer sẽ tự động kết nối khi gửi message
-	fmt.Println("Kafka writer configured")
+	fmt.Printf("Using '%s' message broker\n", jobBroker.Name())
 
-	// Đảm bảo đóng Kafka writer khi ứng dụng thoát
+	// Đảm bảo đóng broker khi ứng dụng thoát
 	defer func() {
-		if err := kafkaWriter.Close(); err != nil {
-			log.Printf("Failed to close Kafka writer: %v", err)
+		if err := jobBroker.Close(); err != nil {
+			log.Printf("Failed to close message broker: %v", err)
 		}
 	}()
 
-	router := gin.Default()
+	// Làn ưu tiên: job mode=sync (client đang chờ) không xếp sau hàng đợi của topic chính
+	if broker.PriorityConfigured() {
+		syncBroker, err = broker.NewPriorityPublisher(context.Background(), cfg)
+		if err != nil {
+			log.Fatalf("Failed to set up the priority lane of the message broker: %v", err)
+		}
+		fmt.Println("Sending mode=sync jobs to the priority lane")
+		defer func() {
+			if err := syncBroker.Close(); err != nil {
+				log.Printf("Failed to close priority lane of the message broker: %v", err)
+			}
+		}()
+	}
+
+	// Từ chối job mới (503) khi lag của worker vượt BACKPRESSURE_MAX_LAG
+	queueBackpressure, err = backpressureFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid backpressure configuration: %v", err)
+	}
+	if queueBackpressure.maxLag > 0 {
+		fmt.Printf("Rejecting submissions when more than %d jobs are waiting (retry after %s)\n", queueBackpressure.maxLag, queueBackpressure.retryAfter)
+	}
+
+	// Thông báo job dead letter và worker chết tới Slack, Teams, webhook (NOTIFICATIONS)
+	notifier, err = notify.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid notification configuration: %v", err)
+	}
+	if backlogConfig, err = notify.BacklogConfigFromEnv(); err != nil {
+		log.Fatalf("Invalid notification configuration: %v", err)
+	}
+	if notifier.Len() > 0 {
+		go watchWorkers(context.Background())
+		fmt.Printf("Sending notifications to %d channel(s)\n", notifier.Len())
+	}
+
+	// Gửi lại job bị treo ở trạng thái processing (worker chết sau khi nhận message)
+	reaperConfig, err := reaper.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid reaper configuration: %v", err)
+	}
+	reaperConfig.JobTTL = jobTTL
+	go reaper.New(redisClient, reaperConfig, enqueueJob).Run(context.Background(), func(result reaper.Result, err error) {
+		if err != nil {
+			log.Printf("Error reaping stuck jobs: %v", err)
+		}
+		if len(result.Requeued) > 0 || len(result.Failed) > 0 {
+			log.Printf("Reaped stuck jobs: requeued %v, failed %v", result.Requeued, result.Failed)
+		}
+		notifyDeadLetters(result.Failed, reaperConfig.MaxAttempts)
+	})
+	fmt.Printf("Stuck-job reaper started (deadline %s, max %d attempts)\n", reaperConfig.Deadline, reaperConfig.MaxAttempts)
+
+	// Lưu job đã xong vào kho lưu trữ lâu dài trước khi key Redis hết hạn
+	archiveConfig, archiveEnabled, err := archive.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid archive configuration: %v", err)
+	}
+	archiveStore, err = archive.StorageFromEnv(artifacts)
+	if err != nil {
+		log.Fatalf("Invalid archive storage configuration: %v", err)
+	}
+	if archiveEnabled {
+		go archive.New(redisClient, artifacts, archiveStore, archiveConfig).Run(context.Background(), func(result archive.Result, err error) {
+			if err != nil {
+				log.Printf("Error archiving finished jobs: %v", err)
+			}
+			if len(result.Archived) > 0 {
+				log.Printf("Archived %d job(s), index %s", len(result.Archived), result.IndexKey)
+			}
+		})
+		fmt.Printf("Job archiver started (after %s, '%s' storage)\n", archiveConfig.After, archiveStore.Name())
+	}
+
+	// Thời hạn lưu metadata, PDF/output và file upload của job đã xong (RETENTION_*)
+	if defaultRetention, err = model.RetentionFromEnv(); err != nil {
+		log.Fatalf("Invalid retention configuration: %v", err)
+	}
+	janitorConfig, err := janitor.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid janitor configuration: %v", err)
+	}
+	go janitor.New(redisClient, artifacts, janitorConfig).Run(context.Background(), func(result janitor.Result, err error) {
+		if err != nil {
+			log.Printf("Error cleaning up expired jobs: %v", err)
+		}
+		if len(result.ArtifactsDeleted) > 0 || len(result.UploadsDeleted) > 0 {
+			log.Printf("Deleted expired artifacts of %d job(s), uploads of %d job(s)", len(result.ArtifactsDeleted), len(result.UploadsDeleted))
+		}
+	})
+	fmt.Printf("Retention janitor started (every %s)\n", janitorConfig.Interval)
+
+	// Tenant theo API key (không có TENANTS_FILE: một tenant mặc định, không cần API key)
+	tenants, err = tenant.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid tenant configuration: %v", err)
+	}
+	if tenants != nil {
+		fmt.Printf("Multi-tenant mode: API keys loaded from %s\n", os.Getenv("TENANTS_FILE"))
+	}
+	// Route quản trị: tenant admin (TENANTS_FILE) hoặc ADMIN_API_KEY
+	adminAPIKey = os.Getenv("ADMIN_API_KEY")
+	if tenants == nil && adminAPIKey == "" {
+		fmt.Println("ADMIN_API_KEY not set, admin routes are disabled (/api/stats stays open)")
+	}
+
+	// Quét mã độc file upload bằng ClamAV (CLAMD_ADDRESS, CLAMD_TIMEOUT, CLAMD_FAIL_OPEN)
+	if err := initVirusScan(); err != nil {
+		log.Fatalf("Invalid virus scan configuration: %v", err)
+	}
+	if virusScanner != nil {
+		fmt.Printf("Scanning uploads with clamd at %s\n", virusScanner)
+	}
 
-	// --- Thêm CORS Middleware ---
-	config := cors.DefaultConfig()
-	// Cho phép tất cả origins (chỉ dùng cho dev, cần cấu hình chặt hơn cho production)
-	config.AllowAllOrigins = true
-	// Hoặc chỉ định origin của frontend: config.AllowOrigins = []string{"http://localhost:5173"}
-	config.AllowHeaders = append(config.AllowHeaders, "Authorization") // Thêm header nếu cần
-	router.Use(cors.New(config))
-	// --------------------------
+	// Link tải PDF có chữ ký và thời hạn (DOWNLOAD_SIGNING_KEY, DOWNLOAD_URL_TTL)
+	if err := initDownloadSigning(); err != nil {
+		log.Fatalf("Invalid download link configuration: %v", err)
+	}
+	// Kích thước file upload tối đa qua /api/upload và /ws (UPLOAD_MAX_BYTES)
+	if err := initUploadLimit(); err != nil {
+		log.Fatalf("Invalid upload configuration: %v", err)
+	}
+	// Số file và dung lượng tối đa của file ZIP nhiều ảnh (BATCH_MAX_ENTRIES, BATCH_MAX_BYTES)
+	if err := initBatchLimits(); err != nil {
+		log.Fatalf("Invalid batch configuration: %v", err)
+	}
+	// PDF gộp của lô: tạo khi mọi job con đã xong (BATCH_ASSEMBLE_INTERVAL, font/template như worker)
+	if err := initBatchPDF(); err != nil {
+		log.Fatalf("Invalid batch PDF configuration: %v", err)
+	}
+	go runBatchAssembler(context.Background())
+	// Upload PDF tới Google Drive/Dropbox của tenant (trường deliver, cấu hình delivery trong TENANTS_FILE)
+	if err := initDelivery(); err != nil {
+		log.Fatalf("Invalid delivery configuration: %v", err)
+	}
+	go runDeliverer(context.Background())
+	// Ngưỡng kích thước ảnh và hạn chót của mode=sync (SYNC_MAX_BYTES, SYNC_TIMEOUT)
+	if err := initSyncMode(); err != nil {
+		log.Fatalf("Invalid sync mode configuration: %v", err)
+	}
+
+	// Timeout, TLS và danh sách origin được gọi API từ trình duyệt (CORS)
+	// Mặc định chỉ cho phép frontend chạy bằng `npm run dev`; "*" cho phép mọi origin
+	serverDefaults := httpserver.DefaultConfig()
+	serverDefaults.AllowedOrigins = []string{"http://localhost:5173"}
+	serverDefaults.AutocertCache = filepath.Join(cfg.CacheDir(), "autocert")
+	serverConfig, err := httpserver.ConfigFromEnv(serverDefaults)
+	if err != nil {
+		log.Fatalf("Invalid HTTP server configuration: %v", err)
+	}
+
+	// Lỗi của gin (route không tồn tại, sai method, panic) có cùng định dạng với lỗi của handler
+	router := gin.New()
+	router.Use(stripQueryAPIKey, gin.Logger(), gin.CustomRecovery(handlePanic))
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(handleNoRoute)
+	router.NoMethod(handleNoMethod)
+	router.GET("/api/health", handleHealth) // Đăng ký trước authenticate: load balancer không có API key
+	router.Use(authenticate)                // Xác định tenant của request
 
 	// Định tuyến
 	router.POST("/api/upload", handleUpload)
-	router.GET("/api/status/:job_id", handleStatus)     // Thêm route status
-	router.GET("/api/download/:job_id", handleDownload) // Thêm route download
+	// Upload nối tiếp được (tus 1.0) cho file lớn qua mạng chập chờn, tạo job khi nhận đủ file
+	uploads := router.Group("/api/uploads", tusHeaders)
+	uploads.OPTIONS("", handleResumableOptions)
+	uploads.POST("", handleCreateResumable)
+	uploads.HEAD("/:upload_id", requireUploadOwner, handleResumableHead)
+	uploads.GET("/:upload_id", requireUploadOwner, handleResumableGet)
+	uploads.PATCH("/:upload_id", requireUploadOwner, handleResumablePatch)
+	uploads.DELETE("/:upload_id", requireUploadOwner, handleResumableDelete)
+	// File ZIP nhiều ảnh: mỗi ảnh một job con, manifest theo dõi trạng thái và tải gộp các PDF
+	router.POST("/api/batches", handleCreateBatch)
+	router.GET("/api/batches/:batch_id", requireBatchOwner, handleGetBatch)
+	router.GET("/api/batches/:batch_id/download", requireBatchOwner, handleBatchDownload)
+	router.GET("/api/batches/:batch_id/pdf", requireBatchOwner, handleBatchPDF)
+	router.GET("/ws", handleWebSocket)      // Upload và nhận tiến trình, kết quả qua WebSocket
+	router.GET("/api/jobs", handleListJobs) // Danh sách job của tenant
+	// Các route theo job chỉ trả về job của tenant gọi API
+	router.GET("/api/status/:job_id", requireJobOwner, handleStatus)      // Thêm route status
+	router.GET("/api/results/:job_id", requireJobOwner, handleResult)     // ?wait=30s: chờ job xong (long polling)
+	router.GET("/api/download/:job_id", requireSignature, handleDownload) // Link lấy từ download_url của status
+	router.GET("/api/jobs/:job_id/text", requireJobOwner, handleJobText)  // Văn bản đầy đủ, phân trang
+	router.GET("/api/jobs/:job_id/lineage", requireJobOwner, handleLineage)
+	router.GET("/api/jobs/:job_id/history", requireJobOwner, handleJobHistory)
+	router.GET("/api/jobs/:job_id/preview", requireJobOwner, handlePreview)     // Thumbnail JPEG của ảnh upload
+	router.GET("/api/jobs/:job_id/regions", requireJobOwner, handleJobRegions)  // Văn bản từng vùng crop
+	router.GET("/api/jobs/:job_id/ocr", requireJobOwner, handleJobOCR)          // Văn bản OCR, hOCR hoặc ALTO XML
+	router.GET("/api/jobs/:job_id/audio", requireJobOwner, handleJobAudio)      // Bản dịch đọc thành MP3 (outputs=audio)
+	router.GET("/api/archive/:job_id", requireJobOwner, handleArchivedJob)      // Job đã lưu trữ sau khi hết hạn trong Redis
+	router.GET("/api/archive/:job_id/pdf", requireSignature, handleArchivedPDF) // Link lấy từ pdf_url của job đã lưu trữ
+	router.GET("/api/stats", requireAdminIfConfigured, handleStats)             // Thống kê tài nguyên theo bước xử lý
+	router.GET("/api/admin/workers", requireAdmin, handleAdminWorkers)          // Worker còn sống/bị treo (heartbeat)
+	router.GET("/api/admin/overview", requireAdmin, handleAdminOverview)        // Hàng đợi, job theo trạng thái 24h, độ trễ, lỗi
+	router.GET("/api/admin/queue", requireAdmin, handleAdminQueue)              // Lag của consumer group, trạng thái backpressure
+	router.GET("/api/admin/autoscale", requireAdmin, handleAdminAutoscale)      // Số replica worker cần thiết (HPA/KEDA)
+	router.GET("/api/admin/usage", requireAdmin, handleAdminUsage)              // Ký tự OCR/dịch theo ngày và provider của từng tenant
+
+	// Kết quả sai đã cache: xóa theo hash/job của input, xử lý lại input (skipCache=true: bỏ qua cache)
+	router.DELETE("/api/admin/cache/entry", requireAdmin, handleDeleteCacheEntry)
+	router.POST("/api/jobs/:job_id/reprocess", requireJobOwner, handleReprocess)
+	router.DELETE("/api/jobs/:job_id", requireJobOwner, handleDeleteJob) // ?erase=true: xóa hẳn, trả về biên nhận
+
+	// Văn bản OCR do người dùng sửa: đo CER/WER của OCR rồi dịch lại, thống kê chất lượng OCR
+	router.PUT("/api/jobs/:job_id/corrected-text", requireJobOwner, handleCorrectedText)
+	router.GET("/api/stats/ocr-quality", handleOCRQuality)
+
+	// Output thêm của job (link lấy từ outputs của status)
+	router.GET("/api/jobs/:job_id/outputs/:output", requireSignature, handleOutputDownload)
+	router.GET("/api/jobs/:job_id/artifacts/:name", requireSignature, handleJobArtifact) // Link lấy từ artifacts của status
+
+	// Glossary: thuật ngữ bắt buộc trong bản dịch
+	router.GET("/api/glossaries", handleListGlossaries)
+	router.GET("/api/glossaries/:name", handleGetGlossary)
+	router.PUT("/api/glossaries/:name", handlePutGlossary)
+	router.DELETE("/api/glossaries/:name", handleDeleteGlossary)
+	router.POST("/api/glossaries/:name/terms", handlePutGlossaryTerm)
+	router.DELETE("/api/glossaries/:name/terms", handleDeleteGlossaryTerm)
 
-	fmt.Println("API Server starting on :8080")
-	router.Run(":8080") // Chạy server trên cổng 8080
+	fmt.Printf("API Server starting on %s (TLS: %t, CORS origins: %v)\n", cfg.ListenAddr, serverConfig.TLS(), serverConfig.AllowedOrigins)
+	if err := httpserver.ListenAndServe(cfg.ListenAddr, router, serverConfig); err != nil {
+		log.Fatalf("API Server stopped: %v", err)
+	}
+}
+
+// --- Health check: 503 khi lần kiểm tra Redis gần nhất thất bại ---
+func handleHealth(c *gin.Context) {
+	status := redisHealth.Status()
+	code := http.StatusOK
+	if !status.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"healthy": status.Healthy, "redis": status})
 }
 
 func handleUpload(c *gin.Context) {
-	file, err := c.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Image file is required"})
+	// File "image" được ghi theo luồng xuống thư mục upload, giới hạn UPLOAD_MAX_BYTES
+	image, cleanup, jerr := readUpload(c)
+	defer cleanup()
+	if jerr != nil {
+		jerr.respond(c)
 		return
 	}
 
-	jobID := uuid.New().String()
-	uploadPath := filepath.Join(uploadDir, fmt.Sprintf("%s-%s", jobID, filepath.Base(file.Filename))) // Sử dụng filepath.Base để tránh path traversal
+	// mode=sync: chờ kết quả ngay trong response, chỉ với ảnh nhỏ (SYNC_MAX_BYTES)
+	syncMode := false
+	switch c.Query("mode") {
+	case "", "async":
+	case "sync":
+		if image == nil {
+			respondError(c, http.StatusBadRequest, codeUnsupportedOption, "mode=sync requires an uploaded image")
+			return
+		}
+		if image.size > syncMaxBytes {
+			respondError(c, http.StatusRequestEntityTooLarge, codeSyncImageTooLarge, fmt.Sprintf("mode=sync is limited to images of %d bytes", syncMaxBytes), gin.H{"max_bytes": syncMaxBytes})
+			return
+		}
+		syncMode = true
+	default:
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "mode must be 'sync' or 'async'")
+		return
+	}
 
-	// Đảm bảo thư mục tồn tại (an toàn hơn)
-	if err := c.SaveUploadedFile(file, uploadPath); err != nil {
-		log.Printf("Error saving upload file for job %s: %v", jobID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
+	jobID, jobType, jerr := createJob(c, image, syncMode)
+	if jerr != nil {
+		jerr.respond(c)
 		return
 	}
 
-	fmt.Printf("Received file: %s, JobID: %s, Saved to: %s\n", file.Filename, jobID, uploadPath)
+	if syncMode {
+		respondSync(c, jobID, jobTypeName(jobType))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "File uploaded successfully. Processing queued.", // Cập nhật message
+		"job_id":   jobID,
+		"job_type": jobTypeName(jobType),
+	})
+}
+
+// --- File upload của job: multipart (handleUpload) hoặc các frame nhị phân (/ws) ---
+type uploadImage struct {
+	name string
+	size int64
+	save func(path string) error // Ghi nội dung file vào path
+	// Loại job của file; rỗng: ảnh, hoặc PDF nếu file là PDF
+	jobType string
+}
+
+// --- Tạo job từ các trường form của request (upload qua HTTP hoặc /ws) ---
+// image nil: job dùng source_job_id. Lỗi được trả về để handler gửi cho client
+// theo giao thức của nó (JSON hoặc message WebSocket).
+func createJob(c *gin.Context, image *uploadImage, syncMode bool) (string, string, *jobError) {
+	// source_job_id: dịch lại PDF kết quả của một job trước (không cần upload file)
+	sourceJobID := c.PostForm("source_job_id")
+	if image == nil && sourceJobID == "" {
+		return "", "", newJobError(http.StatusBadRequest, codeInvalidImage, "Image file is required")
+	}
+
+	// Tùy chọn nhúng ảnh gốc vào PDF: "first_page" hoặc "appendix" (mặc định không nhúng)
+	embedImage := c.PostForm("embed_image")
+	if !pdf.ValidImagePlacement(embedImage) {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "embed_image must be 'first_page' or 'appendix'")
+	}
+
+	// Ngôn ngữ đích của bản dịch (mặc định tiếng Việt)
+	targetLang := c.PostForm("target_lang")
+	if targetLang != "" && !langCodePattern.MatchString(targetLang) {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "target_lang must be a language code such as 'vi', 'ar' or 'zh-CN'")
+	}
+
+	// Frame được xử lý với ảnh nhiều frame (GIF động): first (mặc định), best, all
+	framePolicy := c.PostForm("frame_policy")
+	if !imagefilter.ValidFramePolicy(framePolicy) {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "frame_policy must be 'first', 'best' or 'all'")
+	}
+
+	// Độ phân giải (DPI) của ảnh cho OCR, mặc định worker suy ra từ metadata/kích thước ảnh
+	dpi := 0
+	if raw := c.PostForm("dpi"); raw != "" {
+		var err error
+		dpi, err = strconv.Atoi(raw)
+		if err != nil || dpi < imagefilter.MinDPI || dpi > imagefilter.MaxDPI {
+			return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, fmt.Sprintf("dpi must be an integer between %d and %d", imagefilter.MinDPI, imagefilter.MaxDPI))
+		}
+	}
+
+	// Chế độ OCR (ocr_mode hoặc ocrMode): printed (mặc định, Tesseract) hoặc handwriting (engine chữ viết tay của worker)
+	ocrMode := c.DefaultPostForm("ocr_mode", c.PostForm("ocrMode"))
+	switch ocrMode {
+	case "", "printed":
+		ocrMode = messaging.OCRModePrinted
+	case messaging.OCRModeHandwriting:
+	default:
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "ocr_mode must be 'printed' or 'handwriting'")
+	}
+
+	// Cấu hình OCR theo loại tài liệu (PSM, OEM, whitelist/blacklist, biến Tesseract)
+	ocrConfig, err := parseOCRConfigForm(c)
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+	if ocrConfig != nil && ocrMode == messaging.OCRModeHandwriting {
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "ocr_config is not supported with ocr_mode=handwriting")
+	}
+
+	// Tìm và giải mã barcode/QR code của ảnh (hóa đơn, nhãn vận chuyển)
+	barcodes := false
+	if raw := c.PostForm("barcodes"); raw != "" {
+		var err error
+		if barcodes, err = strconv.ParseBool(raw); err != nil {
+			return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "barcodes must be 'true' or 'false'")
+		}
+	}
+
+	// Tóm tắt ngắn của bản dịch để phân loại nhanh lô tài liệu lớn
+	summarize := false
+	if raw := c.PostForm("summarize"); raw != "" {
+		var err error
+		if summarize, err = strconv.ParseBool(raw); err != nil {
+			return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "summarize must be 'true' or 'false'")
+		}
+	}
+
+	// hOCR/ALTO XML lưu cùng văn bản OCR để lập chỉ mục theo vị trí từ
+	ocrFormats, err := parseOCRFormatsForm(c)
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+	if len(ocrFormats) > 0 && ocrMode == messaging.OCRModeHandwriting {
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "ocr_formats is not supported with ocr_mode=handwriting")
+	}
+
+	// Chỉ OCR các vùng crop (biểu mẫu, CCCD...), mỗi vùng trả về văn bản riêng
+	regions, err := parseRegionsForm(c)
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+	if len(regions) > 0 && len(ocrFormats) > 0 {
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "ocr_formats is not supported with regions")
+	}
+
+	// Glossary đã lưu (glossary) và/hoặc thuật ngữ riêng cho request (glossary_terms)
+	glossary, glossaryTerms, err := parseGlossaryForm(c)
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+
+	// Output thêm render song song với PDF bản dịch: original_pdf, txt
+	outputs, err := parseOutputsForm(c)
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+
+	// Pipeline riêng của job (JSON pipeline.Definition): bước, thứ tự, option, điều kiện bỏ qua
+	var jobPipeline json.RawMessage
+	if raw := c.PostForm("pipeline"); raw != "" {
+		if _, err := pipeline.Parse([]byte(raw)); err != nil {
+			return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+		}
+		jobPipeline = json.RawMessage(raw)
+	}
+
+	// Quan hệ với các job trước (retry, regeneration, dependent, merge)
+	lineageEdges, err := parseLineageForm(c)
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+
+	// Nguồn của job gửi qua connector (email:<người gửi>, sftp:<đường dẫn>), trả về trong status
+	source := c.PostForm("source")
+	if len(source) > sourceMaxLength {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, fmt.Sprintf("source is limited to %d bytes", sourceMaxLength))
+	}
+	// ID của job trong hệ thống của client, tìm lại bằng GET /api/jobs?external_id=
+	externalID := c.DefaultPostForm("external_id", c.PostForm("externalId"))
+	if len(externalID) > externalIDMaxLength {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, fmt.Sprintf("external_id is limited to %d bytes", externalIDMaxLength))
+	}
+	// Nhãn key=value để sắp xếp job (department=legal,batch=2024-06), lọc bằng GET /api/jobs?labels=
+	labels, err := parseLabels(c.PostForm("labels"))
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+
+	// Job nguồn phải thuộc cùng tenant (job cha: xem parseLineageForm)
+	caller := callerTenant(c)
+	// Đích (Google Drive, Dropbox) của tenant nhận PDF khi job xong
+	deliveries, err := parseDeliverForm(c, caller)
+	if err != nil {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+	}
+	if sourceJobID != "" && !ownsJob(c, sourceJobID) {
+		return "", "", newJobError(http.StatusBadRequest, codeInvalidSourceJob, fmt.Sprintf("source job %s not found", sourceJobID))
+	}
 
-	// 1. Lưu trạng thái ban đầu vào Redis (jobID:status -> "queued")
-	statusKey := fmt.Sprintf("%s:status", jobID)
 	ctx := c.Request.Context() // Sử dụng context từ request
-	err = redisClient.Set(ctx, statusKey, "queued", jobTTL).Err()
+	requestID := httpserver.RequestID(c.Request)
+	// Hàng đợi quá dài (BACKPRESSURE_MAX_LAG): từ chối trước khi trừ hạn mức của tenant
+	if jobErr := queueBackpressure.check(ctx); jobErr != nil {
+		return "", "", jobErr
+	}
+	// Ngân sách ký tự dịch và hạn mức job mỗi ngày của tenant
+	if jobErr := checkCharBudget(ctx, caller); jobErr != nil {
+		return "", "", jobErr
+	}
+	if err := tenant.Reserve(ctx, redisClient, caller); err == tenant.ErrQuotaExceeded {
+		return "", "", newJobError(http.StatusTooManyRequests, codeQuotaExceeded, fmt.Sprintf("Daily quota of %d jobs exceeded", caller.DailyJobs), gin.H{"daily_jobs": caller.DailyJobs})
+	} else if err != nil {
+		log.Printf("Error reserving job quota of tenant %s: %v", caller.ID, err)
+		return "", "", newJobError(http.StatusInternalServerError, codeStoreUnavailable, "Failed to check job quota")
+	}
+
+	// ID job mang tenant: key Redis, cache và đường dẫn lưu file đều tách theo tenant
+	jobID := model.TenantJobID(caller.ID, uuid.New().String())
+	var uploadPath string
+	var scanDetails map[string]string // Kết quả quét mã độc của file upload
+	var jobErr *jobError
+	jobType := messaging.JobTypeImage
+	if sourceJobID != "" {
+		uploadPath, err = copySourcePDF(ctx, sourceJobID, jobID)
+		if err != nil {
+			log.Printf("Error copying PDF of source job %s for job %s: %v", sourceJobID, jobID, err)
+			return "", "", sourcePDFError(err)
+		}
+		jobType = messaging.JobTypePDFText
+		lineageEdges = append(lineageEdges, lineage.Edge{Parent: sourceJobID, Relation: lineage.RelationDependent})
+		fmt.Printf("Using PDF of job %s, JobID: %s, Copied to: %s\n", sourceJobID, jobID, uploadPath)
+	} else {
+		uploadPath = filepath.Join(cfg.UploadDir(), caller.ID, fmt.Sprintf("%s-%s", jobID, filepath.Base(image.name))) // Sử dụng filepath.Base để tránh path traversal
+
+		// Đảm bảo thư mục tồn tại (an toàn hơn)
+		if err := image.save(uploadPath); err != nil {
+			log.Printf("Error saving upload file for job %s: %v", jobID, err)
+			return "", "", newJobError(http.StatusInternalServerError, codeStorageUnavailable, "Failed to save uploaded file")
+		}
+		// Văn bản đã sửa (loại job do handler chỉ định) hoặc PDF có sẵn lớp văn bản -> dịch trực tiếp, không OCR
+		if image.jobType != "" {
+			jobType = image.jobType
+		} else if isPDFFile(uploadPath) {
+			jobType = messaging.JobTypePDFText
+		}
+
+		fmt.Printf("Received file: %s, JobID: %s, Saved to: %s\n", image.name, jobID, uploadPath)
+		// Quét mã độc trước khi gửi job (CLAMD_ADDRESS)
+		if scanDetails, jobErr = scanUpload(ctx, jobID, uploadPath); jobErr != nil {
+			return "", "", jobErr
+		}
+		if jobType == messaging.JobTypeImage {
+			if stripped := stripUploadMetadata(jobID, uploadPath); stripped != nil {
+				if scanDetails == nil {
+					scanDetails = map[string]string{}
+				}
+				maps.Copy(scanDetails, stripped)
+			}
+		}
+	}
+	if jobType == messaging.JobTypePDFText && embedImage != "" {
+		os.Remove(uploadPath)
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "embed_image is not supported for PDF input")
+	}
+	if jobType == messaging.JobTypePDFText && len(regions) > 0 {
+		os.Remove(uploadPath)
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "regions are not supported for PDF input")
+	}
+	if jobType == messaging.JobTypePDFText && ocrMode != messaging.OCRModePrinted {
+		os.Remove(uploadPath)
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "ocr_mode is not supported for PDF input")
+	}
+	if jobType == messaging.JobTypePDFText && ocrConfig != nil {
+		os.Remove(uploadPath)
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "ocr_config is not supported for PDF input")
+	}
+	if jobType != messaging.JobTypeImage && barcodes {
+		os.Remove(uploadPath)
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "barcodes is only supported for image input")
+	}
+	if jobType != messaging.JobTypeImage && len(ocrFormats) > 0 {
+		os.Remove(uploadPath)
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "ocr_formats is only supported for image input")
+	}
+	if jobType == messaging.JobTypePDFText && syncMode {
+		os.Remove(uploadPath)
+		return "", "", newJobError(http.StatusBadRequest, codeUnsupportedOption, "mode=sync is not supported for PDF input")
+	}
+
+	recordHistory(c, jobID, model.HistoryEvent{Type: model.HistorySubmitted, Detail: jobType})
+
+	// 1. Lưu trạng thái ban đầu vào Redis (jobID:status -> "queued")
+	err = jobStore.SetStatus(ctx, jobID, model.StatusQueued, "")
 	if err != nil {
 		log.Printf("Error setting initial status in Redis for job %s: %v", jobID, err)
 		// Cân nhắc: Có nên xóa file đã upload nếu không lưu được status?
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate job processing (Redis error)"})
-		return
+		return "", "", newJobError(http.StatusInternalServerError, codeStoreUnavailable, "Failed to initiate job processing (Redis error)")
+	}
+	fmt.Printf("Set initial status 'queued' for job %s in Redis (request %s)\n", jobID, requestID)
+	retention := saveRetention(ctx, caller, jobID, uploadPath)
+	// Request tạo job, trả về trong status để đối chiếu lỗi với log của API và worker
+	initialDetails := map[string]string{"request_id": requestID}
+	if source != "" {
+		initialDetails["source"] = source
+	}
+	// Tham chiếu của client: tìm lại job bằng GET /api/jobs?external_id=, ?filename= hoặc ?labels=
+	var refs []tenant.Ref
+	if externalID != "" {
+		initialDetails["external_id"] = externalID
+		refs = append(refs, tenant.Ref{Kind: "external_id", Value: externalID})
+	}
+	if image != nil {
+		initialDetails["filename"] = filepath.Base(image.name)
+		refs = append(refs, tenant.Ref{Kind: "filename", Value: initialDetails["filename"]})
+	}
+	if len(labels) > 0 {
+		data, _ := json.Marshal(labels)
+		initialDetails["labels"] = string(data)
+		refs = append(refs, labelRefs(labels)...)
+	}
+	if len(deliveries) > 0 {
+		for i := range deliveries {
+			deliveries[i].FileName = deliveryFileName(image, jobID)
+		}
+		data, _ := json.Marshal(deliveries)
+		initialDetails["deliveries"] = string(data)
+		if err := redisClient.ZAdd(ctx, deliveriesPendingKey, &redis.Z{Score: float64(time.Now().Unix()), Member: jobID}).Err(); err != nil {
+			log.Printf("Error scheduling delivery of job %s: %v", jobID, err)
+			return "", "", newJobError(http.StatusInternalServerError, codeStoreUnavailable, "Failed to schedule the delivery of the PDF")
+		}
+	}
+	maps.Copy(initialDetails, scanDetails)
+	if err := jobStore.SaveDetails(ctx, jobID, initialDetails); err != nil {
+		log.Printf("Warning: Failed to save request ID of job %s: %v", jobID, err)
+	}
+
+	if err := tenant.Track(ctx, redisClient, caller.ID, jobID, retention); err != nil {
+		log.Printf("Warning: Failed to add job %s to the job list of tenant %q: %v", jobID, caller.ID, err)
+	}
+	for _, ref := range refs {
+		if err := tenant.TrackRef(ctx, redisClient, caller.ID, ref.Kind, ref.Value, jobID, retention); err != nil {
+			log.Printf("Warning: Failed to index %s %s of job %s: %v", ref.Kind, ref.Value, jobID, err)
+		}
 	}
-	fmt.Printf("Set initial status 'queued' for job %s in Redis\n", jobID)
 
-	// 2. Chuẩn bị và gửi message vào Kafka
+	for _, edge := range lineageEdges {
+		if err := lineage.Record(ctx, redisClient, edge.Parent, jobID, edge.Relation, retention); err != nil {
+			log.Printf("Warning: Failed to record lineage %s -> %s for job %s: %v", edge.Parent, jobID, jobID, err)
+		}
+	}
+
+	// 2. Chuẩn bị và gửi message vào broker
 	jobMsg := messaging.JobMessage{ // Sử dụng struct từ package messaging
-		JobID:     jobID,
-		ImagePath: uploadPath, // Worker sẽ đọc file từ đường dẫn này
+		JobID:         jobID,
+		ImagePath:     uploadPath, // Worker sẽ đọc file từ đường dẫn này
+		JobType:       jobType,
+		EmbedImage:    embedImage,
+		TargetLang:    targetLang,
+		Glossary:      glossary,
+		GlossaryTerms: glossaryTerms,
+		FramePolicy:   framePolicy,
+		DPI:           dpi,
+		Regions:       regions,
+		OCRMode:       ocrMode,
+		OCRConfig:     ocrConfig,
+		OCRFormats:    ocrFormats,
+		Barcodes:      barcodes,
+		Summarize:     summarize,
+		Outputs:       outputs,
+		Pipeline:      jobPipeline,
+		Attempt:       1,
+		RequestID:     requestID,
 	}
-	msgBytes, err := json.Marshal(jobMsg)
-	if err != nil {
-		log.Printf("Error marshaling Kafka message for job %s: %v", jobID, err)
-		// Cân nhắc: Cập nhật status trong Redis thành "failed"? Xóa file?
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare job message"})
-		return
+	// Lưu message để reaper gửi lại nếu job bị treo
+	if err := reaper.SaveMessage(ctx, redisClient, jobMsg, jobTTL); err != nil {
+		log.Printf("Error saving job message in Redis for job %s: %v", jobID, err)
+		return "", "", newJobError(http.StatusInternalServerError, codeStoreUnavailable, "Failed to prepare job message")
 	}
 
-	err = kafkaWriter.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(jobID), // Sử dụng jobID làm key để phân phối message (tùy chọn)
-		Value: msgBytes,
-	})
+	if syncMode {
+		err = enqueueSyncJob(ctx, jobMsg)
+	} else {
+		err = enqueueJob(ctx, jobMsg)
+	}
 	if err != nil {
-		log.Printf("Error sending message to Kafka for job %s: %v", jobID, err)
+		log.Printf("Error sending message to broker for job %s: %v", jobID, err)
 		// Cân nhắc: Cập nhật status trong Redis thành "failed"? Xóa file?
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job for processing (Kafka error)"})
-		return
+		return "", "", newJobError(http.StatusInternalServerError, codeQueueUnavailable, "Failed to queue job for processing (broker error)")
 	}
-	fmt.Printf("Sent job %s to Kafka topic %s\n", jobID, kafkaTopic)
+	fmt.Printf("Sent job %s to Kafka topic %s\n", jobID, cfg.KafkaTopic)
+	return jobID, jobType, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "File uploaded successfully. Processing queued.", // Cập nhật message
-		"job_id":  jobID,
-	})
+// --- Gửi message của job vào broker (upload và reaper gửi lại job bị treo) ---
+func enqueueJob(ctx context.Context, job messaging.JobMessage) error {
+	return jobBroker.Publish(ctx, job)
+}
+
+// --- Gửi job mode=sync vào làn ưu tiên nếu có, client đang chờ kết quả ---
+// Job bị treo được reaper gửi lại vào topic chính như job thường
+func enqueueSyncJob(ctx context.Context, job messaging.JobMessage) error {
+	if syncBroker == nil {
+		return enqueueJob(ctx, job)
+	}
+	return syncBroker.Publish(ctx, job)
 }
 
 // --- Handler để kiểm tra trạng thái Job ---
@@ -160,34 +770,59 @@ func handleStatus(c *gin.Context) {
 	jobID := c.Param("job_id")
 	ctx := c.Request.Context()
 
-	statusKey := fmt.Sprintf("%s:status", jobID)
-	// pdfPathKey := fmt.Sprintf("%s:pdfpath", jobID) // Không dùng trực tiếp nữa
-	errorKey := fmt.Sprintf("%s:error", jobID)
-	detailsKey := fmt.Sprintf("%s:details", jobID) // Key chứa thông tin chi tiết
-
-	// Lấy trạng thái cơ bản trước
-	status, err := redisClient.Get(ctx, statusKey).Result()
-	if err == redis.Nil {
+	// Lấy trạng thái và thông tin chi tiết (bước đang chạy khi processing), kèm lỗi nếu job đã kết thúc
+	job, err := jobStore.Load(ctx, jobID)
+	if err == model.ErrNotFound {
 		// Không tìm thấy key status -> Job không tồn tại
-		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
 		return
 	}
 	if err != nil {
-		log.Printf("Error getting base status from Redis for job %s: %v", jobID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job status"})
+		log.Printf("Error getting status from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job status")
+		return
+	}
+	// Client poll liên tục nhận 304 khi trạng thái và details không đổi
+	if notModified(c, jobETag(job, true)) {
 		return
 	}
 
+	status := job.Status
 	response := gin.H{"job_id": jobID, "status": status}
+	if val, ok := job.Details["request_id"]; ok {
+		// Request upload đã tạo job
+		response["request_id"] = val
+	}
+	if val, ok := job.Details["source"]; ok {
+		response["source"] = val
+	}
+	if val, ok := job.Details["external_id"]; ok {
+		response["external_id"] = val
+	}
+	if val, ok := job.Details["filename"]; ok {
+		// Tên file upload
+		response["filename"] = val
+	}
+	if val, ok := job.Details["labels"]; ok {
+		response["labels"] = json.RawMessage(val)
+	}
+	if val, ok := job.Details["deliveries"]; ok {
+		// Trạng thái upload PDF tới Drive/Dropbox, kèm file_id trên đích
+		response["deliveries"] = json.RawMessage(val)
+	}
 
-	// Nếu hoàn thành hoặc thất bại, lấy thêm thông tin
-	if status == "completed" || status == "failed" {
-		// Lấy thông tin chi tiết (dạng hash map)
-		details, err := redisClient.HGetAll(ctx, detailsKey).Result()
-		if err != nil && err != redis.Nil {
-			log.Printf("Warning: Error getting details from Redis for job %s: %v", jobID, err)
-			// Tiếp tục trả về trạng thái cơ bản nếu không lấy được details
-		} else if err == nil && len(details) > 0 {
+	if _, ok := job.Details["thumbnail_path"]; ok {
+		// Thumbnail của ảnh upload, có ngay khi worker nhận job
+		response["preview_url"] = "/api/jobs/" + jobID + "/preview"
+	}
+	if val, ok := job.Details["stage"]; ok && status == model.StatusProcessing {
+		// Bước worker đang chạy: filter, ocr, extract, translate, pdf
+		response["stage"] = val
+	}
+
+	// Nếu hoàn thành hoặc thất bại, trả thêm thông tin
+	if status == model.StatusCompleted || status == model.StatusFailed {
+		if details := job.Details; len(details) > 0 {
 			// Thêm các thông tin chi tiết vào response
 			if val, ok := details["pdf_path"]; ok {
 				response["pdf_path"] = val
@@ -195,6 +830,42 @@ func handleStatus(c *gin.Context) {
 			if val, ok := details["cached"]; ok {
 				response["cached"] = val == "true"
 			}
+			if val, ok := details["image_hash"]; ok {
+				// Hash của input, dùng để xóa kết quả đã cache (DELETE /api/admin/cache/entry)
+				response["image_hash"] = val
+			}
+			if _, ok := details["cache_skipped"]; ok {
+				// Job xử lý lại, không dùng cache (POST /api/jobs/:job_id/reprocess)
+				response["cache_skipped"] = true
+			}
+			if val, ok := details["scan_result"]; ok {
+				// Kết quả quét mã độc của file upload (clean, skipped khi clamd lỗi và CLAMD_FAIL_OPEN)
+				response["scan_result"] = val
+				response["scan_ms"] = details["scan_ms"]
+			}
+			if val, ok := details["metadata_stripped"]; ok {
+				// Loại metadata đã xóa khỏi ảnh upload (exif, xmp, iptc, comment, text)
+				response["metadata_stripped"] = strings.Split(val, ",")
+			}
+			if val, ok := details["input_format"]; ok {
+				response["input_format"] = val
+			}
+			if val, ok := details["exif_orientation"]; ok {
+				response["exif_orientation"] = val
+			}
+			if val, ok := details["thumbnail_ms"]; ok {
+				response["thumbnail_ms"] = val
+			}
+			if val, ok := details["cleanup"]; ok {
+				// Các bước làm sạch văn bản OCR đã chạy
+				response["cleanup"] = val
+				response["cleanup_ms"] = details["cleanup_ms"]
+			}
+			if val, ok := details["cleanup_changes"]; ok {
+				// Các từ đã sửa chính tả (bước spellcheck): từ gốc, từ sửa, độ tin cậy
+				response["cleanup_changes"] = val
+				response["cleanup_report"] = json.RawMessage(details["cleanup_report"])
+			}
 			if val, ok := details["filter_ms"]; ok {
 				response["filter_ms"] = val
 			}
@@ -207,64 +878,223 @@ func handleStatus(c *gin.Context) {
 			if val, ok := details["pdf_ms"]; ok {
 				response["pdf_ms"] = val
 			}
+			if val, ok := details["embed_image"]; ok {
+				response["embed_image"] = val
+			}
+			if val, ok := details["target_lang"]; ok {
+				response["target_lang"] = val
+			}
+			if val, ok := details["glossary_terms"]; ok {
+				response["glossary_terms"] = val
+			}
+			if val, ok := details["pages"]; ok {
+				response["pages"] = val
+				response["extract_ms"] = details["extract_ms"]
+			}
+			if val, ok := details["source_lang"]; ok {
+				response["source_lang"] = val
+			}
+			if val, ok := details["detected_script"]; ok {
+				response["detected_script"] = val
+			}
+			if val, ok := details["rotation"]; ok {
+				response["rotation"] = val
+				response["skew_deg"] = details["skew_deg"]
+			}
+			if val, ok := details["frame_policy"]; ok {
+				response["frame_policy"] = val
+				response["frames"] = details["frames"]
+				response["frames_used"] = details["frames_used"]
+			}
+			if val, ok := details["quarantined"]; ok {
+				response["quarantined"] = val == "true"
+			}
+			if val, ok := details["ocr_dpi"]; ok {
+				response["ocr_dpi"] = val
+				response["ocr_dpi_source"] = details["ocr_dpi_source"]
+				response["ocr_dpi_clamped"] = details["ocr_dpi_clamped"] == "true"
+			}
+			if val, ok := details["ocr_mode"]; ok {
+				response["ocr_mode"] = val
+				response["ocr_engine"] = details["ocr_engine"]
+			}
+			if val, ok := details["ocr_config"]; ok {
+				response["ocr_config"] = val
+			}
+			if val, ok := details["ocr_formats"]; ok {
+				response["ocr_formats"] = strings.Split(val, ",")
+			}
+			if val, ok := details["crop_regions"]; ok {
+				response["crop_regions"] = val
+			}
+			if val, ok := details["layout_regions"]; ok {
+				response["layout_regions"] = val
+				response["layout_tables"] = details["layout_tables"]
+				response["layout_columns"] = details["layout_columns"]
+			}
+			if val, ok := details["attempt"]; ok {
+				// Job đã được gửi lại sau khi bị treo
+				response["attempt"] = val
+				response["reaped"] = details["reaped"] == "true"
+			}
+			if custom := customDetails(details); len(custom) > 0 {
+				// Thông tin ghi bởi các bước tùy chỉnh của worker (worker.RegisterStage)
+				response["custom"] = custom
+			}
+			if val, ok := details["pipeline_stages"]; ok {
+				// Các bước pipeline đã chạy (pipeline: tên pipeline nếu không phải mặc định)
+				response["pipeline_stages"] = val
+				if name, ok := details["pipeline"]; ok {
+					response["pipeline"] = name
+				}
+			}
+			if val, ok := details["resumed_stages"]; ok {
+				// Job được giao lại: các bước này dùng kết quả của lần giao trước
+				response["resumed_stages"] = val
+			}
+			if val, ok := details["resource_usage"]; ok {
+				// CPU, RSS, I/O theo từng bước (JSON do worker ghi)
+				response["resource_usage"] = json.RawMessage(val)
+			}
+		}
+
+		// Bản xem trước (500 ký tự đầu) và độ dài của văn bản OCR và bản dịch; văn bản đầy đủ: /api/jobs/:job_id/text
+		if status == "completed" {
+			addTextPreviews(c, jobID, response)
 		}
 
-		// Lấy lỗi nếu thất bại (vẫn lấy từ key riêng)
-		if status == "failed" {
-			errorMsg, err := redisClient.Get(ctx, errorKey).Result()
-			if err != nil && err != redis.Nil {
-				log.Printf("Warning: Error getting error message from Redis for failed job %s: %v", jobID, err)
-			} else if err == nil {
-				response["error_message"] = errorMsg
+		// File trung gian để gỡ lỗi bản dịch (văn bản OCR thô, ảnh đã lọc, văn bản đã làm sạch)
+		if links := artifactLinks(jobID, job.Details); links != nil {
+			response["artifacts"] = links
+		}
+
+		// Link tải PDF có chữ ký, hết hạn sau DOWNLOAD_URL_TTL (hỏi lại status để lấy link mới)
+		if status == model.StatusCompleted {
+			downloadURL, expires := signedURL("/api/download/" + jobID)
+			response["download_url"] = downloadURL
+			response["download_expires_at"] = expires.UTC()
+			// Các output thêm (PDF văn bản gốc, file văn bản), mỗi output một link riêng
+			if links := outputLinks(jobID, job.Details); links != nil {
+				response["outputs"] = links
+			}
+			// Barcode/QR code của ảnh: loại, giá trị và vị trí (cả với cache hit, details không có "barcodes")
+			if data, err := redisClient.Get(ctx, fmt.Sprintf("%s:barcodes", jobID)).Result(); err == nil {
+				response["barcodes"] = json.RawMessage(data)
+			} else if err != redis.Nil {
+				log.Printf("Warning: Error getting barcodes from Redis for job %s: %v", jobID, err)
+			}
+			// Tóm tắt bản dịch (job yêu cầu summarize hoặc worker đặt SUMMARIZATION)
+			if summary, err := redisClient.Get(ctx, fmt.Sprintf("%s:summary", jobID)).Result(); err == nil {
+				response["summary"] = summary
+			} else if err != redis.Nil {
+				log.Printf("Warning: Error getting summary from Redis for job %s: %v", jobID, err)
 			}
 		}
+
+		// Lỗi của job thất bại (lưu ở key riêng)
+		if status == model.StatusFailed && job.Error != "" {
+			response["error_message"] = job.Error
+		}
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// --- Các details "custom.<key>" do bước tùy chỉnh ghi, theo key ---
+func customDetails(details map[string]string) map[string]string {
+	custom := map[string]string{}
+	for key, value := range details {
+		if name, ok := strings.CutPrefix(key, "custom."); ok {
+			custom[name] = value
+		}
+	}
+	return custom
+}
+
 // --- Handler để tải file PDF kết quả ---
 func handleDownload(c *gin.Context) {
 	jobID := c.Param("job_id")
 	ctx := c.Request.Context()
 
-	statusKey := fmt.Sprintf("%s:status", jobID)
-	// pdfPathKey := fmt.Sprintf("%s:pdfpath", jobID) // Không dùng trực tiếp nữa
-
 	// Lấy trạng thái và đường dẫn PDF từ Redis
-	vals, err := redisClient.MGet(ctx, statusKey).Result()
+	job, err := jobStore.Load(ctx, jobID)
+	if err == model.ErrNotFound {
+		// Không tìm thấy job
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
 	if err != nil {
 		log.Printf("Error getting download info from Redis for job %s: %v", jobID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job details"})
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job details")
 		return
 	}
 
-	statusVal := vals[0]
-
-	if statusVal == nil {
-		// Không tìm thấy job
-		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	if job.Status != model.StatusCompleted {
+		// Job chưa hoàn thành hoặc bị lỗi
+		details := gin.H{"status": job.Status}
+		if job.Error != "" {
+			details["error_message"] = job.Error
+		}
+		respondError(c, http.StatusBadRequest, codeJobNotCompleted, "Job not completed", details)
+		return
+	}
+	// PDF chỉ đổi khi job được xử lý lại (version mới)
+	if notModified(c, jobETag(job, false)) {
 		return
 	}
 
-	status := statusVal.(string)
-	if status != "completed" {
-		// Job chưa hoàn thành hoặc bị lỗi
-		response := gin.H{"error": "Job not completed", "status": status}
-		if status == "failed" {
-			errorKey := fmt.Sprintf("%s:error", jobID)
-			errorMsg, _ := redisClient.Get(ctx, errorKey).Result()
-			if errorMsg != "" {
-				response["error_message"] = errorMsg
-			}
+	recordHistory(c, jobID, model.HistoryEvent{Type: model.HistoryDownloaded, Detail: "pdf"})
+	servePDF(c, artifacts, jobPDFKey(jobID, job), jobID+".pdf")
+}
+
+// --- Key của PDF trong storage (job dùng cache trỏ tới PDF của job trước đó) ---
+func jobPDFKey(jobID string, job *model.Result) string {
+	pdfKey := job.PDFPath
+	if pdfKey == "" {
+		pdfKey = model.PDFKey(jobID)
+	}
+	return strings.TrimPrefix(pdfKey, cfg.OutputDir+"/") // Giá trị cũ lưu đường dẫn file đầy đủ
+}
+
+// --- Gửi file PDF trong storage cho client (tên file tải về là filename) ---
+func servePDF(c *gin.Context, store storage.Storage, key, filename string) {
+	serveArtifact(c, store, key, filename, "application/pdf", codePDFNotFound)
+}
+
+// --- Gửi file trong storage cho client, notFound: mã lỗi khi file không còn ---
+func serveArtifact(c *gin.Context, store storage.Storage, key, filename, contentType, notFound string) {
+	// Storage hỗ trợ URL ký sẵn (S3) -> chuyển hướng để client tải trực tiếp
+	if presigner, ok := store.(storage.Presigner); ok {
+		url, err := presigner.PresignGet(key, linkTTL(c))
+		if err != nil {
+			log.Printf("Error presigning %s: %v", key, err)
+			respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to prepare download")
+			return
 		}
-		c.JSON(http.StatusBadRequest, response)
+		c.Redirect(http.StatusTemporaryRedirect, url)
 		return
 	}
 
-	// Gửi file PDF cho client
-	// Đặt tên file tải về là jobID.pdf
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pdf\"", jobID))
-	c.File(pdfDir + "/" + jobID + ".pdf")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	if files, ok := store.(*storage.FileStorage); ok {
+		path, err := files.Path(key)
+		if err != nil {
+			respondError(c, http.StatusNotFound, notFound, "File not found in storage")
+			return
+		}
+		c.File(path) // Hỗ trợ Range/If-Modified-Since
+		return
+	}
+	reader, err := store.Open(c.Request.Context(), key)
+	if err == storage.ErrNotFound {
+		respondError(c, http.StatusNotFound, notFound, "File not found in storage")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening %s: %v", key, err)
+		respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to read file")
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, -1, contentType, reader, nil)
 }
- 
\ No newline at end of file
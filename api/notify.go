@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/fleet"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/notify"
+)
+
+const notifyTimeout = 10 * time.Second // Thời gian tối đa để gửi một thông báo tới các kênh
+
+var (
+	notifier      = &notify.Notifier{} // Kênh Slack/Teams/webhook (NOTIFICATIONS)
+	backlogConfig = notify.DefaultBacklogConfig()
+)
+
+// --- Thông báo job bị reaper đánh dấu failed sau lần thử cuối (dead letter) ---
+// Số job dead letter trong cửa sổ DEADLETTER_ALERT_WINDOW được đếm chung cho mọi replica API;
+// vượt DEADLETTER_ALERT_THRESHOLD thì gửi thêm thông báo critical (tối đa một lần mỗi cửa sổ)
+func notifyDeadLetters(jobIDs []string, attempts int) {
+	if notifier.Len() == 0 || len(jobIDs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	for _, jobID := range jobIDs {
+		n := notify.New(notify.TypeJobDeadLettered, notify.SeverityWarning, "Job dead-lettered",
+			fmt.Sprintf("The job did not finish after %d attempt(s) and was marked failed", attempts),
+			map[string]string{"job_id": jobID})
+		if err := notifier.Notify(ctx, n); err != nil {
+			log.Printf("Warning: Failed to send dead letter notification for job %s: %v", jobID, err)
+		}
+	}
+	count, err := notify.RecordDeadLetters(ctx, redisClient, jobIDs, backlogConfig.Window)
+	if err != nil {
+		log.Printf("Warning: Failed to count dead-lettered jobs: %v", err)
+		return
+	}
+	if count < int64(backlogConfig.Threshold) {
+		return
+	}
+	n := notify.New(notify.TypeDeadLetterBacklog, notify.SeverityCritical, "Dead-lettered jobs are piling up",
+		fmt.Sprintf("%d job(s) were dead-lettered within %s: workers may be crashing or overloaded", count, backlogConfig.Window),
+		map[string]string{"dead_letters": strconv.FormatInt(count, 10), "window": backlogConfig.Window.String()})
+	if err := notifier.NotifyOnce(ctx, redisClient, "deadletter.backlog", backlogConfig.Window, n); err != nil {
+		log.Printf("Warning: Failed to send dead letter backlog notification: %v", err)
+	}
+}
+
+// --- Theo dõi heartbeat của worker, thông báo worker chết (mất heartbeat) hoặc bị treo ---
+// Mỗi worker được thông báo tối đa một lần trong fleet.Retention, kể cả khi nhiều replica API cùng theo dõi
+func watchWorkers(ctx context.Context) {
+	ticker := time.NewTicker(fleet.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		workers, err := fleet.List(ctx, redisClient, fleet.DefaultJobStallAfter)
+		if err != nil {
+			log.Printf("Warning: Failed to list workers for notifications: %v", err)
+			continue
+		}
+		for _, w := range workers {
+			if w.Status != fleet.StatusStalled {
+				continue
+			}
+			typ, severity, title := notify.TypeWorkerStalled, notify.SeverityWarning, "Worker stalled"
+			if w.HeartbeatAgeS > fleet.StaleAfter.Seconds() {
+				// Worker dừng bình thường thì tự rời fleet: mất heartbeat nghĩa là process đã chết hoặc bị kill
+				typ, severity, title = notify.TypeWorkerCrashed, notify.SeverityCritical, "Worker crashed"
+			}
+			inFlight := make([]string, len(w.InFlight))
+			for i, job := range w.InFlight {
+				inFlight[i] = job.JobID
+			}
+			fields := map[string]string{"worker": w.ID, "hostname": w.Hostname}
+			if len(inFlight) > 0 {
+				fields["jobs"] = strings.Join(inFlight, ", ")
+			}
+			n := notify.New(typ, severity, title, w.StalledReason, fields)
+			if err := notifier.NotifyOnce(ctx, redisClient, typ+":"+w.ID, fleet.Retention, n); err != nil {
+				log.Printf("Warning: Failed to send %s notification for worker %s: %v", typ, w.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+)
+
+// --- Đọc cấu hình OCR của request từ form upload ---
+// ocr_config: JSON {"psm": 6, "oem": 1, "whitelist": "0123456789", "blacklist": "|", "variables": {"preserve_interword_spaces": "1"}}
+// PSM 7 cho một dòng, 11 cho chữ thưa thớt, 4 cho hóa đơn...; nil nếu không có hoặc rỗng
+func parseOCRConfigForm(c *gin.Context) (*messaging.OCRConfig, error) {
+	raw := c.PostForm("ocr_config")
+	if raw == "" {
+		return nil, nil
+	}
+	var config messaging.OCRConfig
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("ocr_config must be a JSON object of psm, oem, whitelist, blacklist and variables")
+	}
+	if err := ocr.Config(config).Validate(); err != nil {
+		return nil, fmt.Errorf("ocr_config: %w", err)
+	}
+	if ocr.Config(config).IsZero() {
+		return nil, nil
+	}
+	return &config, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// Content-Type của từng định dạng OCR trả về bởi /api/jobs/:job_id/ocr
+var ocrFormatTypes = map[string]string{
+	"text":                  "text/plain; charset=utf-8",
+	messaging.OCRFormatHOCR: "application/xhtml+xml; charset=utf-8",
+	messaging.OCRFormatALTO: "application/xml; charset=utf-8",
+}
+
+// --- Đọc các định dạng OCR có tọa độ cần lưu từ form upload ---
+// ocr_formats: danh sách phân cách bởi dấu phẩy của hocr, alto (sắp xếp để cache key ổn định)
+func parseOCRFormatsForm(c *gin.Context) ([]string, error) {
+	var formats []string
+	for _, format := range strings.Split(c.PostForm("ocr_formats"), ",") {
+		format = strings.TrimSpace(format)
+		if format == "" || slices.Contains(formats, format) {
+			continue
+		}
+		if format != messaging.OCRFormatHOCR && format != messaging.OCRFormatALTO {
+			return nil, fmt.Errorf("ocr_formats must be a comma separated list of '%s' and '%s'", messaging.OCRFormatHOCR, messaging.OCRFormatALTO)
+		}
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats, nil
+}
+
+// --- Handler trả về kết quả OCR thô của Job ---
+// GET /api/jobs/:job_id/ocr?format=hocr&page=0
+// format=text (mặc định): văn bản OCR; hocr, alto: tài liệu của một trang (frame),
+// chỉ có với job upload kèm ocr_formats. Header X-Page-Count cho biết số trang.
+func handleJobOCR(c *gin.Context) {
+	jobID := c.Param("job_id")
+	ctx := c.Request.Context()
+
+	format := c.DefaultQuery("format", "text")
+	contentType, ok := ocrFormatTypes[format]
+	if !ok {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "format must be 'text', 'hocr' or 'alto'")
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
+	if err != nil || page < 0 {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "page must be a non-negative integer")
+		return
+	}
+
+	field := "ocr_" + format
+	if format == "text" {
+		field = "ocr_text"
+	}
+	data, err := redisClient.Get(ctx, fmt.Sprintf("%s:%s", jobID, field)).Result()
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeTextNotFound, fmt.Sprintf("OCR %s not available for this job", format))
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting %s from Redis for job %s: %v", field, jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get OCR result")
+		return
+	}
+	if format == "text" {
+		c.Data(http.StatusOK, contentType, []byte(data))
+		return
+	}
+
+	var pages []string
+	if err := json.Unmarshal([]byte(data), &pages); err != nil {
+		log.Printf("Error decoding %s of job %s: %v", field, jobID, err)
+		respondError(c, http.StatusInternalServerError, httpserver.CodeInternal, "Failed to get OCR result")
+		return
+	}
+	if page >= len(pages) {
+		respondError(c, http.StatusNotFound, codeTextNotFound, fmt.Sprintf("page must be less than %d", len(pages)), gin.H{"pages": len(pages)})
+		return
+	}
+	c.Header("X-Page-Count", strconv.Itoa(len(pages)))
+	c.Data(http.StatusOK, contentType, []byte(pages[page]))
+}
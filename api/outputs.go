@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// Kiểu nội dung của các output thêm khi tải về
+var outputContentTypes = map[string]string{
+	messaging.OutputOriginalPDF: "application/pdf",
+	messaging.OutputText:        "text/plain; charset=utf-8",
+	messaging.OutputAudio:       "audio/mpeg",
+}
+
+// --- Đọc tùy chọn outputs: các output thêm, cách nhau bởi dấu phẩy ---
+// "pdf" (PDF bản dịch) luôn được tạo nên được bỏ qua
+func parseOutputsForm(c *gin.Context) ([]string, error) {
+	var outputs []string
+	for _, output := range strings.Split(c.PostForm("outputs"), ",") {
+		output = strings.TrimSpace(output)
+		if output == "" || output == "pdf" || slices.Contains(outputs, output) {
+			continue
+		}
+		if _, ok := messaging.OutputFiles[output]; !ok {
+			return nil, fmt.Errorf("outputs must be a comma separated list of 'pdf', '%s', '%s' and '%s'", messaging.OutputOriginalPDF, messaging.OutputText, messaging.OutputAudio)
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// --- Link tải có chữ ký của từng output thêm của job đã hoàn thành ---
+func outputLinks(jobID string, details map[string]string) gin.H {
+	if details["outputs"] == "" {
+		return nil
+	}
+	links := gin.H{}
+	for _, output := range strings.Split(details["outputs"], ",") {
+		downloadURL, expires := signedURL(fmt.Sprintf("/api/jobs/%s/outputs/%s", jobID, output))
+		links[output] = gin.H{
+			"download_url":        downloadURL,
+			"download_expires_at": expires.UTC(),
+			"render_ms":           details[output+"_ms"],
+		}
+	}
+	return links
+}
+
+// --- GET /api/jobs/:job_id/outputs/:output: tải một output thêm (link từ outputs của status) ---
+func handleOutputDownload(c *gin.Context) {
+	serveOutput(c, c.Param("job_id"), c.Param("output"))
+}
+
+// --- GET /api/jobs/:job_id/audio: bản dịch đọc thành MP3 (job upload với outputs=audio) ---
+func handleJobAudio(c *gin.Context) {
+	serveOutput(c, c.Param("job_id"), messaging.OutputAudio)
+}
+
+// --- Gửi file output của job đã hoàn thành, nếu output đã được yêu cầu cho job ---
+func serveOutput(c *gin.Context, jobID, output string) {
+	job, err := jobStore.Load(c.Request.Context(), jobID)
+	if err == model.ErrNotFound {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting outputs from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job details")
+		return
+	}
+	if job.Status != model.StatusCompleted {
+		respondError(c, http.StatusBadRequest, codeJobNotCompleted, "Job not completed", gin.H{"status": job.Status})
+		return
+	}
+	if !slices.Contains(strings.Split(job.Details["outputs"], ","), output) {
+		respondError(c, http.StatusNotFound, codeOutputNotFound, fmt.Sprintf("Output %s was not requested for this job", output))
+		return
+	}
+	file := messaging.OutputFiles[output]
+	recordHistory(c, jobID, model.HistoryEvent{Type: model.HistoryDownloaded, Detail: output})
+	serveArtifact(c, artifacts, model.OutputKey(jobID, file), jobID+path.Ext(file), outputContentTypes[output], codeOutputNotFound)
+}
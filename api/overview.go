@@ -0,0 +1,75 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+const (
+	overviewWindow    = 24 * time.Hour // Cửa sổ đếm job theo trạng thái và lỗi
+	overviewTopErrors = 10             // Số thông báo lỗi thường gặp nhất trả về
+)
+
+// Độ trễ trung bình của một bước xử lý (từ thống kê tài nguyên, pkg/usage)
+type stageLatency struct {
+	Jobs      int64   `json:"jobs"`
+	AvgWallMS float64 `json:"avg_wall_ms"`
+	MaxWallMS int64   `json:"max_wall_ms"`
+}
+
+// --- Handler tổng quan cho dashboard vận hành ---
+// GET /api/admin/overview: độ sâu hàng đợi của broker (Kafka: lag của consumer group),
+// số job theo trạng thái, throughput và tỉ lệ lỗi trong 24h, độ trễ trung bình
+// từng bước và các lỗi thường gặp nhất, để dựng dashboard mà không phải đọc log
+func handleAdminOverview(c *gin.Context) {
+	ctx := c.Request.Context()
+	activity, err := model.LoadActivity(ctx, redisClient, overviewWindow, overviewTopErrors)
+	if err != nil {
+		log.Printf("Error loading job activity from Redis: %v", err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get overview")
+		return
+	}
+	stats, err := usage.Load(ctx, redisClient)
+	if err != nil {
+		log.Printf("Error loading usage stats from Redis: %v", err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get overview")
+		return
+	}
+	stages := make(map[string]stageLatency, len(stats.Stages))
+	for name, stage := range stats.Stages {
+		stages[name] = stageLatency{Jobs: stage.Jobs, AvgWallMS: stage.AvgWallMS, MaxWallMS: stage.MaxWallMS}
+	}
+
+	completed, failed := activity.Statuses[model.StatusCompleted], activity.Statuses[model.StatusFailed]
+	errorRate := 0.0
+	if completed+failed > 0 {
+		errorRate = float64(failed) / float64(completed+failed)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"queue": queueDepth(c),
+		"jobs": gin.H{
+			"window":              overviewWindow.String(),
+			"statuses":            activity.Statuses,
+			"throughput_per_hour": float64(completed) / overviewWindow.Hours(),
+			"error_rate":          errorRate,
+		},
+		"stages":     stages,
+		"top_errors": activity.TopErrors,
+	})
+}
+
+// Độ sâu hàng đợi của broker; lỗi của broker được trả trong "error" thay vì làm hỏng cả overview
+func queueDepth(c *gin.Context) gin.H {
+	depth, err := queueBackpressure.queueDepth(c.Request.Context())
+	if err != nil {
+		log.Printf("Warning: Failed to get queue depth from %s: %v", jobBroker.Name(), err)
+		return gin.H{"broker": depth.Broker, "queue": depth.Queue, "error": err.Error()}
+	}
+	return gin.H{"broker": depth.Broker, "queue": depth.Queue, "pending": depth.Pending, "in_flight": depth.InFlight}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// errSourceJob là lỗi do client (job nguồn không tồn tại/chưa xong), trả về 400
+var errSourceJob = errors.New("source job")
+
+// --- Kiểm tra file upload có phải PDF (theo magic bytes, không theo đuôi file) ---
+func isPDFFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return string(header) == "%PDF-"
+}
+
+// --- Sao chép PDF kết quả của job trước vào thư mục upload để worker đọc ---
+// Dùng cho job dịch lại PDF (source_job_id) mà không cần client tải PDF về rồi upload lại
+func copySourcePDF(ctx context.Context, sourceJobID, jobID string) (string, error) {
+	source, err := jobStore.Load(ctx, sourceJobID)
+	if err == model.ErrNotFound {
+		return "", fmt.Errorf("%w %s not found", errSourceJob, sourceJobID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if source.Status != model.StatusCompleted {
+		return "", fmt.Errorf("%w %s is not completed (status: %s)", errSourceJob, sourceJobID, source.Status)
+	}
+	pdfKey := source.PDFPath
+	if pdfKey == "" {
+		pdfKey = model.PDFKey(sourceJobID)
+	}
+	pdfKey = strings.TrimPrefix(pdfKey, cfg.OutputDir+"/") // Giá trị cũ lưu đường dẫn file đầy đủ
+
+	reader, err := artifacts.Open(ctx, pdfKey)
+	if err == storage.ErrNotFound {
+		return "", fmt.Errorf("%w %s: PDF not found", errSourceJob, sourceJobID)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	uploadPath := filepath.Join(cfg.UploadDir(), model.TenantOf(jobID), fmt.Sprintf("%s-source.pdf", jobID))
+	if err := os.MkdirAll(filepath.Dir(uploadPath), os.ModePerm); err != nil {
+		return "", err
+	}
+	f, err := os.Create(uploadPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		os.Remove(uploadPath)
+		return "", err
+	}
+	return uploadPath, f.Close()
+}
+
+// --- Lỗi khi chuẩn bị PDF nguồn: job nguồn không hợp lệ hoặc lỗi storage ---
+func sourcePDFError(err error) *jobError {
+	if errors.Is(err, errSourceJob) {
+		return newJobError(http.StatusBadRequest, codeInvalidSourceJob, err.Error())
+	}
+	return newJobError(http.StatusInternalServerError, codeStorageUnavailable, "Failed to copy the PDF of the source job")
+}
+
+// --- Tên loại job trả về cho client ---
+func jobTypeName(jobType string) string {
+	if jobType == messaging.JobTypeImage {
+		return "image"
+	}
+	return jobType
+}
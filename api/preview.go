@@ -0,0 +1,50 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// --- Handler trả về thumbnail JPEG của ảnh upload ---
+// GET /api/jobs/:job_id/preview
+// Thumbnail do worker tạo ở bước đầu tiên; job PDF không có thumbnail
+func handlePreview(c *gin.Context) {
+	jobID := c.Param("job_id")
+	ctx := c.Request.Context()
+
+	job, err := jobStore.Load(ctx, jobID)
+	if err == model.ErrNotFound {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting details from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job details")
+		return
+	}
+	key, ok := job.Details["thumbnail_path"]
+	if !ok {
+		// Worker chưa nhận job, job PDF hoặc tạo thumbnail thất bại
+		respondError(c, http.StatusNotFound, codePreviewNotFound, "Preview not available", gin.H{"status": job.Status})
+		return
+	}
+
+	reader, err := artifacts.Open(ctx, key)
+	if err == storage.ErrNotFound {
+		respondError(c, http.StatusNotFound, codePreviewNotFound, "Preview not available", gin.H{"status": job.Status})
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening thumbnail %s: %v", key, err)
+		respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to read preview")
+		return
+	}
+	defer reader.Close()
+	// Thumbnail không đổi sau khi được tạo
+	c.DataFromReader(http.StatusOK, -1, "image/jpeg", reader, map[string]string{"Cache-Control": "private, max-age=3600"})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+const (
+	maxCropRegions     = 20 // Số vùng crop tối đa của một request
+	maxRegionNameLen   = 64
+	regionCoordEpsilon = 1e-6 // Sai số làm tròn cho phép khi x+width, y+height vượt 1
+)
+
+// --- Đọc các vùng crop từ form upload ---
+// regions: JSON [{"name": "id_number", "x": 0.1, "y": 0.2, "width": 0.5, "height": 0.08}]
+// Tọa độ chuẩn hóa 0-1 theo kích thước ảnh, gốc ở góc trên bên trái
+func parseRegionsForm(c *gin.Context) ([]messaging.CropRegion, error) {
+	raw := c.PostForm("regions")
+	if raw == "" {
+		return nil, nil
+	}
+	var regions []messaging.CropRegion
+	if err := json.Unmarshal([]byte(raw), &regions); err != nil {
+		return nil, fmt.Errorf("regions must be a JSON array of {name, x, y, width, height}")
+	}
+	if len(regions) > maxCropRegions {
+		return nil, fmt.Errorf("at most %d regions are allowed", maxCropRegions)
+	}
+	for i, r := range regions {
+		if len(r.Name) > maxRegionNameLen {
+			return nil, fmt.Errorf("region %d: name is longer than %d characters", i, maxRegionNameLen)
+		}
+		if r.X < 0 || r.Y < 0 || r.Width <= 0 || r.Height <= 0 ||
+			r.X+r.Width > 1+regionCoordEpsilon || r.Y+r.Height > 1+regionCoordEpsilon {
+			return nil, fmt.Errorf("region %d: coordinates must be normalized (0-1) and lie within the image", i)
+		}
+	}
+	return regions, nil
+}
+
+// --- Handler trả về văn bản từng vùng crop của Job ---
+// GET /api/jobs/:job_id/regions
+func handleJobRegions(c *gin.Context) {
+	jobID := c.Param("job_id")
+	ctx := c.Request.Context()
+
+	data, err := redisClient.Get(ctx, fmt.Sprintf("%s:regions", jobID)).Result()
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeTextNotFound, "Region texts not available for this job")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting region texts from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get region texts")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job_id": jobID, "regions": json.RawMessage(data)})
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/reaper"
+)
+
+const resultsMaxWait = 60 * time.Second // wait tối đa của /api/results, dưới WriteTimeout của server
+
+// Định dạng kết quả theo header Accept; JSON khi không có Accept
+var resultFormats = []string{"application/json", "text/plain", "application/pdf"}
+
+// --- Handler trả kết quả của job, chờ tối đa wait nếu job chưa xong (long polling) ---
+// GET /api/results/:job_id?wait=30s
+// Xong: 200 với văn bản và link tải như mode=sync. Chưa xong khi hết wait: 202 kèm status,
+// client gọi lại ngay; trạng thái được nhận qua pub/sub nên không cần poll dày.
+// Accept: text/plain trả văn bản dịch, application/pdf trả PDF, để script dùng thẳng curl.
+func handleResult(c *gin.Context) {
+	jobID := c.Param("job_id")
+	format := c.NegotiateFormat(resultFormats...)
+	if format == "" {
+		respondError(c, http.StatusNotAcceptable, codeNotAcceptable, "Accept must allow application/json, text/plain or application/pdf", gin.H{"available": resultFormats})
+		return
+	}
+	c.Header("Vary", "Accept")
+	var wait time.Duration
+	if raw := c.Query("wait"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 || d > resultsMaxWait {
+			respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "wait must be a duration such as 30s, at most "+resultsMaxWait.String())
+			return
+		}
+		wait = d
+	}
+
+	ctx := c.Request.Context()
+	job, err := jobStore.Load(ctx, jobID)
+	if err == nil && !jobFinished(job) && wait > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, wait)
+		job, err = jobStore.Wait(waitCtx, jobID)
+		cancel()
+		if err == context.DeadlineExceeded {
+			job, err = jobStore.Load(ctx, jobID)
+		}
+	}
+	if err == model.ErrNotFound {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return // Client đã ngắt kết nối
+		}
+		log.Printf("Error waiting for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job status")
+		return
+	}
+	if !jobFinished(job) {
+		c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "status": job.Status})
+		return
+	}
+	if format != "application/json" {
+		serveResultFile(c, jobID, job, format)
+		return
+	}
+	if notModified(c, jobETag(job, true)) {
+		return
+	}
+
+	jobType := ""
+	if msg, err := reaper.LoadMessage(ctx, redisClient, jobID); err == nil {
+		jobType = jobTypeName(msg.JobType)
+	}
+	c.JSON(http.StatusOK, jobResult(ctx, jobID, jobType, job))
+}
+
+func jobFinished(job *model.Result) bool {
+	return job.Status == model.StatusCompleted || job.Status == model.StatusFailed
+}
+
+// --- Kết quả dạng văn bản dịch hoặc PDF; job lỗi không có các định dạng này ---
+func serveResultFile(c *gin.Context, jobID string, job *model.Result, format string) {
+	if job.Status != model.StatusCompleted {
+		respondError(c, http.StatusBadRequest, codeJobNotCompleted, "Job failed", gin.H{"status": job.Status, "error_message": job.Error})
+		return
+	}
+	// ETag khác với bản JSON: mỗi định dạng là một biểu diễn riêng
+	etag := strings.TrimSuffix(jobETag(job, false), `"`) + "-" + strings.TrimPrefix(format, "application/") + `"`
+	if notModified(c, etag) {
+		return
+	}
+	if format == "application/pdf" {
+		recordHistory(c, jobID, model.HistoryEvent{Type: model.HistoryDownloaded, Detail: "pdf"})
+		servePDF(c, artifacts, jobPDFKey(jobID, job), jobID+".pdf")
+		return
+	}
+	text, err := redisClient.Get(c.Request.Context(), jobID+":"+textFields["translated"]).Result()
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeTextNotFound, "Job has no translated text")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting translated text from Redis for job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job text")
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+}
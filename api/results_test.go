@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+func TestResultWait(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.GET("/api/results/:job_id", requireJobOwner, handleResult)
+	jobID := model.TenantJobID("acme", "job1")
+	jobStore.SetStatus(ctx, jobID, model.StatusProcessing, "")
+
+	if w := do(router, "GET", "/api/results/"+jobID+"?wait=2m", "acme-key", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("wait=2m: %d", w.Code)
+	}
+	if w := do(router, "GET", "/api/results/"+jobID+"?wait=30s", "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("job of another tenant: %d", w.Code)
+	}
+	start := time.Now()
+	w := do(router, "GET", "/api/results/"+jobID+"?wait=100ms", "acme-key", "")
+	if w.Code != http.StatusAccepted || time.Since(start) < 100*time.Millisecond {
+		t.Errorf("running job: %d after %v, want 202 after the wait", w.Code, time.Since(start))
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		jobStore.SetStatus(ctx, jobID, model.StatusFailed, "OCR failed")
+	}()
+	start = time.Now()
+	w = do(router, "GET", "/api/results/"+jobID+"?wait=30s", "acme-key", "")
+	var result struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"error_message"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Status != model.StatusFailed || result.ErrorMessage != "OCR failed" {
+		t.Errorf("finished job: %d %s", w.Code, w.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want right after the status change", elapsed)
+	}
+	// Không có wait: trả ngay
+	if w := do(router, "GET", "/api/results/"+jobID, "acme-key", ""); w.Code != http.StatusOK {
+		t.Errorf("without wait: %d", w.Code)
+	}
+}
+
+func TestResultFormats(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.GET("/api/results/:job_id", requireJobOwner, handleResult)
+	dir := t.TempDir()
+	artifacts = storage.NewFileStorage(dir)
+	t.Cleanup(func() { artifacts = nil })
+
+	jobID := model.TenantJobID("acme", "job1")
+	pdfKey := model.PDFKey(jobID)
+	os.MkdirAll(filepath.Dir(filepath.Join(dir, pdfKey)), 0o755)
+	os.WriteFile(filepath.Join(dir, pdfKey), []byte("%PDF-1.4"), 0o644)
+	redisClient.Set(ctx, jobID+":translated_text", "Xin chào", 0)
+	jobStore.SetStatus(ctx, jobID, model.StatusCompleted, pdfKey)
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/results/"+jobID, nil)
+		req.Header.Set("X-API-Key", "acme-key")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for accept, want := range map[string]string{
+		"":                           "application/json",
+		"*/*":                        "application/json",
+		"application/json":           "application/json",
+		"text/plain":                 "text/plain",
+		"text/*":                     "text/plain",
+		"application/pdf":            "application/pdf",
+		"image/png, application/pdf": "application/pdf",
+	} {
+		w := get(accept)
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), want) {
+			t.Errorf("Accept %q: %d %s, want %s", accept, w.Code, w.Header().Get("Content-Type"), want)
+		}
+	}
+	if w := get("text/plain"); w.Body.String() != "Xin chào" {
+		t.Errorf("text = %q", w.Body)
+	}
+	if w := get("application/pdf"); w.Body.String() != "%PDF-1.4" {
+		t.Errorf("pdf = %q", w.Body)
+	}
+	if w := get("image/png"); w.Code != http.StatusNotAcceptable {
+		t.Errorf("Accept image/png: %d", w.Code)
+	}
+	if get("text/plain").Header().Get("ETag") == get("application/json").Header().Get("ETag") {
+		t.Error("text and JSON share an ETag")
+	}
+
+	jobID = model.TenantJobID("acme", "job2")
+	jobStore.SetStatus(ctx, jobID, model.StatusFailed, "OCR failed")
+	if w := get("text/plain"); w.Code != http.StatusBadRequest {
+		t.Errorf("text of a failed job: %d", w.Code)
+	}
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+const (
+	tusVersion       = "1.0.0"
+	resumableTTL     = 24 * time.Hour // Upload dở dang bị bỏ sau khoảng này (key Redis và file)
+	resumableLockTTL = time.Minute    // Lock của PATCH hết hạn sau khoảng này nếu không được gia hạn
+)
+
+// Gia hạn hoặc xóa lock chỉ khi nó còn chứa token của request: lock đã hết hạn
+// có thể đã thuộc về PATCH khác
+var (
+	refreshLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+	unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// Trạng thái một upload nhiều phần (key "upload:{id}", JSON)
+type resumableUpload struct {
+	ID        string            `json:"upload_id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"` // Số byte đã nhận
+	Filename  string            `json:"filename"`
+	Options   map[string]string `json:"options,omitempty"` // Trường form của /api/upload (target_lang...)
+	JobID     string            `json:"job_id,omitempty"`  // Job tạo khi nhận đủ file
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+func resumableKey(id string) string { return "upload:" + id }
+
+// File đang nhận, cùng ổ đĩa với thư mục upload để chuyển bằng rename
+func resumablePath(id string) string {
+	return filepath.Join(cfg.UploadDir(), ".incoming", "resumable-"+id)
+}
+
+func loadResumable(c *gin.Context, id string) (*resumableUpload, bool) {
+	data, err := redisClient.Get(c.Request.Context(), resumableKey(id)).Bytes()
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeUploadNotFound, "Upload not found or expired")
+		return nil, false
+	}
+	var upload resumableUpload
+	if err == nil {
+		err = json.Unmarshal(data, &upload)
+	}
+	if err != nil {
+		log.Printf("Error loading upload %s from Redis: %v", id, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to load upload")
+		return nil, false
+	}
+	return &upload, true
+}
+
+func saveResumable(c *gin.Context, upload *resumableUpload, ttl time.Duration) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	// Vẫn lưu offset khi client đã ngắt kết nối (request context bị hủy)
+	return redisClient.Set(context.WithoutCancel(c.Request.Context()), resumableKey(upload.ID), data, ttl).Err()
+}
+
+// --- Header của giao thức tus trên mọi response của /api/uploads ---
+func tusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	if v := c.GetHeader("Tus-Resumable"); v != "" && v != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		respondError(c, http.StatusPreconditionFailed, httpserver.CodeInvalidRequest, "Unsupported tus version", gin.H{"supported": tusVersion})
+		return
+	}
+	c.Next()
+}
+
+// --- Middleware cho các route có :upload_id: upload của tenant khác coi như không tồn tại ---
+func requireUploadOwner(c *gin.Context) {
+	if model.TenantOf(c.Param("upload_id")) != callerTenant(c).ID {
+		respondError(c, http.StatusNotFound, codeUploadNotFound, "Upload not found or expired")
+		return
+	}
+	c.Next()
+}
+
+// --- Upload nối tiếp được (giao thức tus 1.0, phần mở rộng creation và termination) ---
+// OPTIONS /api/uploads: phiên bản và kích thước tối đa
+func handleResumableOptions(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,termination")
+	c.Header("Tus-Max-Size", strconv.FormatInt(uploadMaxBytes, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/uploads: tạo upload với Upload-Length (byte) và Upload-Metadata ("filename <base64>",
+// các khóa khác là tùy chọn của job như trường form của /api/upload), trả về Location để gửi PATCH
+func handleCreateResumable(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "Upload-Length must be a positive integer")
+		return
+	}
+	if length > uploadMaxBytes {
+		uploadTooLarge().respond(c)
+		return
+	}
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error())
+		return
+	}
+	upload := &resumableUpload{
+		ID:        model.TenantJobID(callerTenant(c).ID, uuid.New().String()),
+		Length:    length,
+		Filename:  metadata["filename"],
+		Options:   metadata,
+		ExpiresAt: time.Now().Add(resumableTTL).UTC(),
+	}
+	delete(upload.Options, "filename")
+	if upload.Filename == "" {
+		upload.Filename = "image"
+	}
+
+	sweepIncoming()
+	path := resumablePath(upload.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err == nil {
+		err = os.WriteFile(path, nil, 0o644)
+	}
+	if err != nil {
+		log.Printf("Error creating upload file %s: %v", path, err)
+		respondError(c, http.StatusInternalServerError, codeStorageUnavailable, "Failed to create upload")
+		return
+	}
+	if err := saveResumable(c, upload, resumableTTL); err != nil {
+		os.Remove(path)
+		log.Printf("Error saving upload %s in Redis: %v", upload.ID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to create upload")
+		return
+	}
+	c.Header("Location", "/api/uploads/"+upload.ID)
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, upload)
+}
+
+// HEAD /api/uploads/:upload_id: số byte đã nhận (Upload-Offset) để gửi tiếp sau khi mất kết nối
+func handleResumableHead(c *gin.Context) {
+	upload, ok := loadResumable(c, c.Param("upload_id"))
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.JobID != "" {
+		c.Header("Upload-Job-Id", upload.JobID)
+	}
+	c.Status(http.StatusOK)
+}
+
+// GET /api/uploads/:upload_id: trạng thái upload dạng JSON (job_id khi đã nhận đủ)
+func handleResumableGet(c *gin.Context) {
+	if upload, ok := loadResumable(c, c.Param("upload_id")); ok {
+		c.JSON(http.StatusOK, upload)
+	}
+}
+
+// PATCH /api/uploads/:upload_id: nối phần tiếp theo (Content-Type application/offset+octet-stream)
+// tại Upload-Offset. Byte nhận được trước khi mất kết nối vẫn được giữ. Khi đủ Upload-Length,
+// job được tạo như /api/upload (job_id trong header Upload-Job-Id); tạo job lỗi (hạn mức,
+// backpressure...) thì gửi lại PATCH rỗng tại offset cuối để thử lại.
+func handleResumablePatch(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("upload_id")
+	if c.ContentType() != "application/offset+octet-stream" {
+		respondError(c, http.StatusUnsupportedMediaType, httpserver.CodeInvalidRequest, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "Upload-Offset must be a non-negative integer")
+		return
+	}
+	unlock, err := lockResumable(ctx, id)
+	if err != nil {
+		log.Printf("Error locking upload %s: %v", id, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to lock upload")
+		return
+	}
+	if unlock == nil {
+		respondError(c, http.StatusConflict, codeUploadConflict, "Another request is writing this upload")
+		return
+	}
+	defer unlock()
+
+	upload, ok := loadResumable(c, id)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		respondError(c, http.StatusConflict, codeUploadConflict, "Upload-Offset does not match the bytes received", gin.H{"offset": upload.Offset})
+		return
+	}
+	if upload.Offset < upload.Length {
+		if jerr := appendResumable(c, upload); jerr != nil {
+			jerr.respond(c)
+			return
+		}
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.Offset == upload.Length && upload.JobID == "" {
+		if jerr := submitResumable(c, upload); jerr != nil {
+			jerr.respond(c)
+			return
+		}
+	}
+	if upload.JobID != "" {
+		c.Header("Upload-Job-Id", upload.JobID)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// --- Lock ghi của upload: key chứa token ngẫu nhiên của request ---
+// Lock được gia hạn mỗi resumableLockTTL/3 trong khi PATCH nhận body (có thể lâu hơn TTL
+// với mạng chậm); PATCH chết giữa chừng nhả lock sau tối đa resumableLockTTL.
+// nil, nil: PATCH khác đang giữ lock
+func lockResumable(ctx context.Context, id string) (unlock func(), err error) {
+	key, token := resumableKey(id)+":lock", uuid.New().String()
+	locked, err := redisClient.SetNX(ctx, key, token, resumableLockTTL).Result()
+	if err != nil || !locked {
+		return nil, err
+	}
+	ctx = context.WithoutCancel(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(resumableLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				held, err := refreshLockScript.Run(ctx, redisClient, []string{key}, token, resumableLockTTL.Milliseconds()).Int()
+				if err != nil {
+					log.Printf("Error refreshing lock of upload %s: %v", id, err)
+				} else if held == 0 {
+					log.Printf("Lock of upload %s expired while writing", id)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		if err := unlockScript.Run(ctx, redisClient, []string{key}, token).Err(); err != nil {
+			log.Printf("Error unlocking upload %s: %v", id, err)
+		}
+	}, nil
+}
+
+// --- Ghi body của PATCH vào cuối file, cập nhật offset theo số byte đã ghi (kể cả khi lỗi) ---
+func appendResumable(c *gin.Context, upload *resumableUpload) *jobError {
+	path := resumablePath(upload.ID)
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err == nil {
+		// Lần ghi trước bị ngắt sau khi ghi file nhưng trước khi lưu offset: bỏ phần thừa
+		if err = f.Truncate(upload.Offset); err == nil {
+			_, err = f.Seek(upload.Offset, io.SeekStart)
+		}
+	}
+	if err != nil {
+		log.Printf("Error opening upload file %s: %v", path, err)
+		return newJobError(http.StatusInternalServerError, codeStorageUnavailable, "Failed to write upload")
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, upload.Length-upload.Offset))
+	if closeErr := f.Close(); copyErr == nil && closeErr != nil {
+		copyErr = closeErr
+	}
+	upload.Offset += n
+	if err := saveResumable(c, upload, redis.KeepTTL); err != nil {
+		log.Printf("Error saving offset of upload %s: %v", upload.ID, err)
+		return newJobError(http.StatusInternalServerError, codeStoreUnavailable, "Failed to save upload offset")
+	}
+	if copyErr != nil {
+		return newJobError(http.StatusBadRequest, codeInvalidImage, "Upload interrupted, resume at Upload-Offset", gin.H{"offset": upload.Offset})
+	}
+	if extra, _ := c.Request.Body.Read(make([]byte, 1)); extra > 0 {
+		return newJobError(http.StatusRequestEntityTooLarge, codeUploadTooLarge, "Received more bytes than Upload-Length", gin.H{"offset": upload.Offset})
+	}
+	return nil
+}
+
+// --- File đã đủ: tạo job với tùy chọn trong Upload-Metadata ---
+func submitResumable(c *gin.Context, upload *resumableUpload) *jobError {
+	form := make(map[string][]string, len(upload.Options))
+	for name, value := range upload.Options {
+		form[name] = []string{value}
+	}
+	c.Request.PostForm = form
+	tmpPath := resumablePath(upload.ID)
+	image := &uploadImage{name: upload.Filename, size: upload.Length, save: func(path string) error {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return err
+		}
+		return os.Rename(tmpPath, path)
+	}}
+	jobID, _, jerr := createJob(c, image, false)
+	if jerr != nil {
+		return jerr
+	}
+	upload.JobID = jobID
+	if err := saveResumable(c, upload, redis.KeepTTL); err != nil {
+		log.Printf("Warning: Failed to save job %s of upload %s: %v", jobID, upload.ID, err)
+	}
+	return nil
+}
+
+// DELETE /api/uploads/:upload_id: hủy upload, xóa phần đã nhận
+func handleResumableDelete(c *gin.Context) {
+	id := c.Param("upload_id")
+	if _, ok := loadResumable(c, id); !ok {
+		return
+	}
+	os.Remove(resumablePath(id))
+	if err := redisClient.Del(c.Request.Context(), resumableKey(id)).Err(); err != nil {
+		log.Printf("Error deleting upload %s: %v", id, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to delete upload")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Upload-Metadata: các cặp "key base64(value)" cách nhau bởi dấu phẩy
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata value of %q is not base64", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+var (
+	sweepMu   sync.Mutex
+	sweptAt   time.Time
+	sweepTick = time.Hour
+)
+
+// --- Xóa file tạm bị bỏ dở trong uploads/.incoming (upload hết hạn, API dừng giữa chừng) ---
+// Chạy tối đa một lần mỗi giờ, khi có upload mới
+func sweepIncoming() {
+	sweepMu.Lock()
+	defer sweepMu.Unlock()
+	if time.Since(sweptAt) < sweepTick {
+		return
+	}
+	sweptAt = time.Now()
+	dir := filepath.Join(cfg.UploadDir(), ".incoming")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > resumableTTL {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+func doTus(router *gin.Engine, method, path string, headers map[string]string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "acme-key")
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestResumableUpload(t *testing.T) {
+	router := newTenantRouter(t, testTenants)
+	uploads := router.Group("/api/uploads", tusHeaders)
+	uploads.POST("", handleCreateResumable)
+	uploads.HEAD("/:upload_id", requireUploadOwner, handleResumableHead)
+	uploads.PATCH("/:upload_id", requireUploadOwner, handleResumablePatch)
+	cfg.OutputDir = t.TempDir()
+	jobBroker = &fakeBroker{}
+	t.Cleanup(func() { cfg.OutputDir, jobBroker = "", nil })
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("scan.png")) + ",target_lang " + base64.StdEncoding.EncodeToString([]byte("en"))
+	w := doTus(router, "POST", "/api/uploads", map[string]string{"Upload-Length": strconv.Itoa(len(data)), "Upload-Metadata": metadata}, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: %d %s", w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+
+	patch := func(offset int, chunk []byte) *httptest.ResponseRecorder {
+		return doTus(router, "PATCH", location, map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": strconv.Itoa(offset)}, chunk)
+	}
+	if w := patch(0, data[:40]); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "40" {
+		t.Fatalf("first PATCH: %d offset %s %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+	if w := patch(0, data[:40]); w.Code != http.StatusConflict {
+		t.Errorf("PATCH at stale offset: %d, want 409", w.Code)
+	}
+	if w := doTus(router, "HEAD", location, nil, nil); w.Header().Get("Upload-Offset") != "40" || w.Header().Get("Upload-Length") != "100" {
+		t.Errorf("HEAD: offset %q length %q", w.Header().Get("Upload-Offset"), w.Header().Get("Upload-Length"))
+	}
+	w = patch(40, data[40:])
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("last PATCH: %d %s", w.Code, w.Body)
+	}
+	jobID := w.Header().Get("Upload-Job-Id")
+	if model.TenantOf(jobID) != "acme" {
+		t.Fatalf("Upload-Job-Id = %q, want a job of acme", jobID)
+	}
+	job, err := jobStore.Load(t.Context(), jobID)
+	if err != nil || job.Status != model.StatusQueued {
+		t.Fatalf("job = %+v, %v", job, err)
+	}
+	if _, err := os.Stat(resumablePath(location[len("/api/uploads/"):])); !os.IsNotExist(err) {
+		t.Errorf("partial file still in .incoming: %v", err)
+	}
+
+	other := httptest.NewRequest("HEAD", location, nil)
+	other.Header.Set("X-API-Key", "globex-key")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, other)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD by other tenant: %d, want 404", rec.Code)
+	}
+}
+
+func TestResumableLock(t *testing.T) {
+	newTenantRouter(t, "")
+	ctx := context.Background()
+	key := resumableKey("u1") + ":lock"
+
+	unlock, err := lockResumable(ctx, "u1")
+	if err != nil || unlock == nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if other, err := lockResumable(ctx, "u1"); err != nil || other != nil {
+		t.Fatalf("second lock taken: %v", err)
+	}
+
+	// Lock hết hạn giữa chừng và được PATCH khác lấy: unlock của PATCH đầu không xóa lock mới
+	redisClient.Del(ctx, key)
+	unlock2, err := lockResumable(ctx, "u1")
+	if err != nil || unlock2 == nil {
+		t.Fatalf("lock after expiry: %v", err)
+	}
+	token := redisClient.Get(ctx, key).Val()
+	if held, _ := refreshLockScript.Run(ctx, redisClient, []string{key}, "stale-token", 1000).Int(); held != 0 {
+		t.Errorf("lock refreshed with another token")
+	}
+	unlock()
+	if got := redisClient.Get(ctx, key).Val(); got != token {
+		t.Fatalf("lock after the first unlock = %q, want %q", got, token)
+	}
+	unlock2()
+	if n := redisClient.Exists(ctx, key).Val(); n != 0 {
+		t.Errorf("lock left after unlock")
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+)
+
+// --- Thời hạn lưu dữ liệu của job đã xong (RETENTION_*, ghi đè theo tenant) ---
+// Ghi lúc tạo job: khi job xong, store đặt TTL của trạng thái và văn bản theo trạng thái cuối
+// (completed/failed), janitor xóa PDF/output và file upload khi hết hạn (pkg/janitor)
+var defaultRetention model.Retention
+
+// Trả về thời hạn lưu metadata dài nhất của job, dùng cho danh sách job của tenant và lineage
+func saveRetention(ctx context.Context, caller *tenant.Tenant, jobID, uploadPath string) time.Duration {
+	policy := retentionPolicy(caller)
+	record := model.RetentionRecord{Policy: policy, UploadPath: uploadPath}
+	if err := model.SaveRetention(ctx, redisClient, jobID, record, jobTTL); err != nil {
+		// Job vẫn chạy, chỉ giữ TTL mặc định
+		log.Printf("Warning: Failed to save retention of job %s: %v", jobID, err)
+		return jobTTL
+	}
+	return metadataRetention(policy)
+}
+
+func retentionPolicy(caller *tenant.Tenant) model.Retention {
+	if caller.Retention == nil {
+		return defaultRetention
+	}
+	return defaultRetention.Merge(*caller.Retention)
+}
+
+func metadataRetention(policy model.Retention) time.Duration {
+	return max(policy.Metadata(model.StatusCompleted, jobTTL), policy.Metadata(model.StatusFailed, jobTTL))
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/antivirus"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+)
+
+var (
+	virusScanner *antivirus.Clamd // Quét file upload bằng ClamAV (CLAMD_ADDRESS), nil: không quét
+	scanFailOpen bool             // clamd lỗi: vẫn nhận file (CLAMD_FAIL_OPEN=true) thay vì trả 503, trừ file quá lớn để quét
+)
+
+// --- Kết nối clamd nếu CLAMD_ADDRESS được đặt ---
+// clamd chưa sẵn sàng khi API khởi động chỉ là cảnh báo: file upload bị từ chối (hoặc
+// được nhận nếu CLAMD_FAIL_OPEN) cho tới khi clamd trả lời
+func initVirusScan() error {
+	var err error
+	if virusScanner, err = antivirus.ConfigFromEnv(); err != nil || virusScanner == nil {
+		return err
+	}
+	if raw := os.Getenv("CLAMD_FAIL_OPEN"); raw != "" {
+		if scanFailOpen, err = strconv.ParseBool(raw); err != nil {
+			return fmt.Errorf("CLAMD_FAIL_OPEN must be true or false, got %q", raw)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := virusScanner.Ping(ctx); err != nil {
+		log.Printf("Warning: clamd is not ready: %v", err)
+	}
+	return nil
+}
+
+// --- Quét file upload trước khi gửi job vào broker ---
+// File nhiễm mã độc được chuyển vào thư mục quarantine và request bị từ chối;
+// kết quả và thời gian quét được trả về để lưu vào details của job
+func scanUpload(ctx context.Context, jobID, uploadPath string) (map[string]string, *jobError) {
+	if virusScanner == nil {
+		return nil, nil
+	}
+	result, err := virusScanner.ScanFile(ctx, uploadPath)
+	if errors.Is(err, antivirus.ErrStreamTooLarge) {
+		// File vượt StreamMaxLength của clamd không bao giờ quét được: từ chối kể cả khi
+		// CLAMD_FAIL_OPEN, nếu không mọi file đủ lớn đều đi qua mà không bị quét
+		log.Printf("Upload of job %s exceeds the clamd stream size limit, rejecting it", jobID)
+		os.Remove(uploadPath)
+		return nil, newJobError(http.StatusRequestEntityTooLarge, codeScanTooLarge, "Uploaded file is too large to be scanned for malware")
+	}
+	if err != nil {
+		log.Printf("Error scanning upload of job %s with clamd: %v", jobID, err)
+		if scanFailOpen {
+			return map[string]string{"scan_result": "skipped"}, nil
+		}
+		os.Remove(uploadPath)
+		return nil, newJobError(http.StatusServiceUnavailable, codeScanUnavailable, "Failed to scan uploaded file for malware, try again later")
+	}
+	scanMs := strconv.FormatInt(result.Duration.Milliseconds(), 10)
+	if !result.Infected {
+		return map[string]string{"scan_result": "clean", "scan_ms": scanMs}, nil
+	}
+
+	log.Printf("Upload of job %s is infected (%s), quarantining it", jobID, result.Signature)
+	dir := filepath.Join(cfg.QuarantineDir(), "uploads", jobID)
+	if err := os.MkdirAll(dir, 0o700); err == nil {
+		err = os.Rename(uploadPath, filepath.Join(dir, filepath.Base(uploadPath)))
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, "scan.txt"), []byte(result.Signature+"\n"), 0o600)
+		}
+		if err != nil {
+			log.Printf("Error quarantining upload of job %s: %v", jobID, err)
+		}
+	} else {
+		log.Printf("Cannot create quarantine directory %s: %v", dir, err)
+	}
+	os.Remove(uploadPath) // Không để file nhiễm trong thư mục upload nếu không cách ly được
+	return nil, newJobError(http.StatusUnprocessableEntity, codeMalwareDetected, "Uploaded file contains malware and was rejected",
+		gin.H{"signature": result.Signature, "scan_ms": scanMs})
+}
+
+// --- Xóa metadata (vị trí GPS, thiết bị chụp...) khỏi ảnh upload trước khi lưu job ---
+// Chỉ giữ hướng xoay EXIF để worker xoay ảnh đúng chiều; tắt bằng STRIP_IMAGE_METADATA=false
+func stripUploadMetadata(jobID, uploadPath string) map[string]string {
+	if strip, err := strconv.ParseBool(os.Getenv("STRIP_IMAGE_METADATA")); err == nil && !strip {
+		return nil
+	}
+	removed, err := imagefilter.StripMetadata(uploadPath)
+	if err != nil {
+		log.Printf("Warning: Failed to strip metadata from upload of job %s: %v", jobID, err)
+		return nil
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return map[string]string{"metadata_stripped": strings.Join(removed, ",")}
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// --- Handler trả về thống kê tài nguyên theo từng bước xử lý ---
+// GET /api/stats: tổng/trung bình CPU, thời gian, I/O, RSS lớn nhất của tesseract
+// và các job tốn tài nguyên nhất (để lập kế hoạch capacity, tìm input bất thường)
+func handleStats(c *gin.Context) {
+	stats, err := usage.Load(c.Request.Context(), redisClient)
+	if err != nil {
+		log.Printf("Error loading usage stats from Redis: %v", err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
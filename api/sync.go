@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+const (
+	syncDefaultMaxBytes = 1 << 20          // Kích thước ảnh tối đa mặc định của mode=sync (1 MiB)
+	syncDefaultTimeout  = 20 * time.Second // Thời gian chờ mặc định của mode=sync
+)
+
+var (
+	syncMaxBytes int64         // Ảnh lớn hơn không được xử lý đồng bộ (SYNC_MAX_BYTES)
+	syncTimeout  time.Duration // Hạn chót của request mode=sync (SYNC_TIMEOUT)
+)
+
+// --- Đọc ngưỡng kích thước và hạn chót của mode=sync từ biến môi trường ---
+func initSyncMode() error {
+	syncMaxBytes = syncDefaultMaxBytes
+	if raw := os.Getenv("SYNC_MAX_BYTES"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("SYNC_MAX_BYTES must be a non-negative integer, got %q", raw)
+		}
+		syncMaxBytes = n
+	}
+	syncTimeout = syncDefaultTimeout
+	if raw := os.Getenv("SYNC_TIMEOUT"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("SYNC_TIMEOUT must be a positive duration such as 20s, got %q", raw)
+		}
+		syncTimeout = d
+	}
+	return nil
+}
+
+// --- Chờ job kết thúc trong hạn chót rồi trả kết quả ngay trong response upload ---
+// Job vẫn đi qua broker và worker: API không có engine OCR (tesseract, pool, engine
+// chữ viết tay) và không nên tốn CPU của OCR. Để job không phải chờ sau hàng đợi của
+// topic chính, job mode=sync được gửi vào làn ưu tiên (PRIORITY_TOPIC) mà mỗi worker
+// đọc bằng consumer riêng; không có làn ưu tiên thì job xếp hàng như job thường.
+// Client không phải poll status; quá hạn chót: 202 kèm job_id, client poll như job thường.
+func respondSync(c *gin.Context, jobID, jobType string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), syncTimeout)
+	defer cancel()
+
+	job, err := jobStore.Wait(ctx, jobID) // Chờ thay đổi trạng thái qua pub/sub, không poll
+	if err == context.DeadlineExceeded {
+		status, err := jobStore.Status(c.Request.Context(), jobID)
+		if err != nil {
+			status = model.StatusProcessing
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  fmt.Sprintf("Job not finished within %s, poll its status", syncTimeout),
+			"job_id":   jobID,
+			"job_type": jobType,
+			"status":   status,
+		})
+		return
+	}
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			return // Client đã ngắt kết nối, job vẫn tiếp tục
+		}
+		log.Printf("Error waiting for sync job %s: %v", jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job status", gin.H{"job_id": jobID})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobResult(c.Request.Context(), jobID, jobType, job))
+}
+
+// --- Kết quả của job đã kết thúc: văn bản và link tải PDF, hoặc lỗi của job ---
+// Dùng chung cho mode=sync và message "result" của /ws
+func jobResult(ctx context.Context, jobID, jobType string, job *model.Result) gin.H {
+	response := gin.H{"job_id": jobID, "job_type": jobType, "status": job.Status}
+	if job.Status == model.StatusFailed {
+		response["error_message"] = job.Error
+		return response
+	}
+	for name, field := range textFields {
+		text, err := redisClient.Get(ctx, fmt.Sprintf("%s:%s", jobID, field)).Result()
+		if err != nil && err != redis.Nil {
+			log.Printf("Warning: Error getting %s from Redis for job %s: %v", field, jobID, err)
+		}
+		response[name+"_text"] = text
+	}
+	downloadURL, expires := signedURL("/api/download/" + jobID)
+	response["download_url"] = downloadURL
+	response["download_expires_at"] = expires.UTC()
+	if links := outputLinks(jobID, job.Details); links != nil {
+		response["outputs"] = links
+	}
+	return response
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// recordingBroker ghi lại ID của các job đã gửi
+type recordingBroker struct {
+	fakeBroker
+	jobs []string
+}
+
+func (b *recordingBroker) Publish(_ context.Context, job messaging.JobMessage) error {
+	b.jobs = append(b.jobs, job.JobID)
+	return nil
+}
+
+func TestEnqueueSyncJob(t *testing.T) {
+	ctx := context.Background()
+	main, priority := &recordingBroker{}, &recordingBroker{}
+	jobBroker = main
+	t.Cleanup(func() { jobBroker, syncBroker = nil, nil })
+
+	// Không có làn ưu tiên: job mode=sync xếp hàng như job thường
+	if err := enqueueSyncJob(ctx, messaging.JobMessage{JobID: "sync1"}); err != nil {
+		t.Fatal(err)
+	}
+	syncBroker = priority
+	if err := enqueueSyncJob(ctx, messaging.JobMessage{JobID: "sync2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueJob(ctx, messaging.JobMessage{JobID: "async"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sync1", "async"}; !reflect.DeepEqual(main.jobs, want) {
+		t.Errorf("main topic got %v, want %v", main.jobs, want)
+	}
+	if want := []string{"sync2"}; !reflect.DeepEqual(priority.jobs, want) {
+		t.Errorf("priority lane got %v, want %v", priority.jobs, want)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+)
+
+const (
+	jobListDefault = 20  // limit mặc định của danh sách job
+	jobListMax     = 100 // Giới hạn limit tối đa cho mỗi trang
+)
+
+// Danh sách tenant và API key (TENANTS_FILE); nil: mọi request thuộc tenant mặc định
+var tenants *tenant.Registry
+
+// --- Middleware xác định tenant của request từ API key ---
+// API key lấy từ header X-API-Key hoặc Authorization: Bearer <key>; với /ws có thể
+// lấy từ query api_key (xem stripQueryAPIKey) vì trình duyệt không gửi được header khi mở WebSocket
+func authenticate(c *gin.Context) {
+	if tenants == nil || signedRoutes[c.FullPath()] {
+		// Link tải có chữ ký không cần API key (xem requireSignature)
+		c.Set("tenant", tenant.Default)
+		c.Next()
+		return
+	}
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		apiKey = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if apiKey == "" && c.FullPath() == "/ws" {
+		apiKey = c.GetString("query_api_key")
+	}
+	t, ok := tenants.Authenticate(apiKey)
+	if apiKey == "" || !ok {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "A valid API key is required")
+		return
+	}
+	c.Set("tenant", t)
+	c.Set("api_key", apiKey) // Dấu vân tay của key được ghi trong lịch sử job
+	c.Next()
+}
+
+// --- Middleware tách api_key khỏi query, đăng ký trước gin.Logger ---
+// Access log ghi nguyên URL; key còn trong query sẽ lộ trong log
+func stripQueryAPIKey(c *gin.Context) {
+	query := c.Request.URL.Query()
+	if !query.Has("api_key") {
+		c.Next()
+		return
+	}
+	c.Set("query_api_key", query.Get("api_key"))
+	query.Del("api_key")
+	c.Request.URL.RawQuery = query.Encode()
+	c.Next()
+}
+
+// --- Tenant của request (do middleware authenticate gán) ---
+func callerTenant(c *gin.Context) *tenant.Tenant {
+	if t, ok := c.Get("tenant"); ok {
+		return t.(*tenant.Tenant)
+	}
+	return tenant.Default
+}
+
+// --- Kiểm tra job thuộc tenant của request ---
+// Job của tenant khác được trả về như job không tồn tại
+func ownsJob(c *gin.Context, jobID string) bool {
+	return model.TenantOf(jobID) == callerTenant(c).ID
+}
+
+// --- Kiểm tra tenant ID do admin chỉ định (?tenant=) ---
+func knownTenant(id string) bool {
+	if tenants == nil {
+		return false // Không có TENANTS_FILE: chỉ có tenant mặc định
+	}
+	_, ok := tenants.Tenant(id)
+	return ok
+}
+
+// --- Middleware cho các route có :job_id ---
+func requireJobOwner(c *gin.Context) {
+	if !ownsJob(c, c.Param("job_id")) {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	c.Next()
+}
+
+// --- Handler trả về danh sách job của tenant, mới nhất trước ---
+// GET /api/jobs?offset=0&limit=20
+// ?external_id=, ?filename=, ?labels=department=legal,batch=2024-06: chỉ các job gửi với
+// ID của client, tên file upload hoặc mọi nhãn đó (kết hợp được với nhau)
+func handleListJobs(c *gin.Context) {
+	ctx := c.Request.Context()
+	t := callerTenant(c)
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "offset must be a non-negative integer")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(jobListDefault)))
+	if err != nil || limit <= 0 || limit > jobListMax {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "limit must be an integer between 1 and "+strconv.Itoa(jobListMax))
+		return
+	}
+
+	var refs []tenant.Ref
+	if externalID := c.DefaultQuery("external_id", c.Query("externalId")); externalID != "" {
+		refs = append(refs, tenant.Ref{Kind: "external_id", Value: externalID})
+	}
+	if filename := c.Query("filename"); filename != "" {
+		refs = append(refs, tenant.Ref{Kind: "filename", Value: filename})
+	}
+	selector, err := parseLabels(c.Query("labels"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "labels: "+err.Error())
+		return
+	}
+	refs = append(refs, labelRefs(selector)...)
+
+	var jobIDs []string
+	var total int64
+	if len(refs) > 0 {
+		jobIDs, total, err = tenant.RefJobs(ctx, redisClient, t.ID, refs, offset, limit)
+	} else {
+		jobIDs, total, err = tenant.Jobs(ctx, redisClient, t.ID, offset, limit)
+	}
+	if err != nil {
+		log.Printf("Error listing jobs of tenant %q: %v", t.ID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to list jobs")
+		return
+	}
+	jobs := make([]gin.H, 0, len(jobIDs))
+	for _, jobID := range jobIDs {
+		job, err := jobStore.Load(ctx, jobID)
+		if err == model.ErrNotFound {
+			continue // Đã hết hạn trong Redis (xem /api/archive/:job_id)
+		}
+		if err != nil {
+			log.Printf("Error getting status from Redis for job %s: %v", jobID, err)
+			respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to list jobs")
+			return
+		}
+		entry := gin.H{"job_id": jobID, "status": job.Status}
+		for _, field := range []string{"external_id", "filename"} {
+			if val, ok := job.Details[field]; ok {
+				entry[field] = val
+			}
+		}
+		if val, ok := job.Details["labels"]; ok {
+			entry["labels"] = json.RawMessage(val)
+		}
+		jobs = append(jobs, entry)
+	}
+
+	response := gin.H{"jobs": jobs, "total": total, "offset": offset, "limit": limit}
+	if t.DailyJobs > 0 {
+		used, err := tenant.Usage(ctx, redisClient, t.ID)
+		if err != nil {
+			log.Printf("Warning: Error getting quota usage of tenant %s: %v", t.ID, err)
+		}
+		response["quota"] = gin.H{"daily_jobs": t.DailyJobs, "used_today": used}
+	}
+	c.JSON(http.StatusOK, response)
+}
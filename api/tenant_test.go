@@ -0,0 +1,421 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// newTenantRouter chạy Redis trong bộ nhớ, nạp các tenant và trả về router
+// với các route cần kiểm tra
+func newTenantRouter(t *testing.T, tenantsJSON string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	redisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	jobStore = model.NewStore(redisClient, time.Hour)
+
+	tenants = nil
+	if tenantsJSON != "" {
+		path := filepath.Join(t.TempDir(), "tenants.json")
+		if err := os.WriteFile(path, []byte(tenantsJSON), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if tenants, err = tenant.Load(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { tenants, adminAPIKey = nil, "" })
+
+	router := gin.New()
+	router.Use(authenticate)
+	router.GET("/api/status/:job_id", requireJobOwner, handleStatus)
+	router.GET("/api/stats", requireAdminIfConfigured, handleStats)
+	router.GET("/api/glossaries", handleListGlossaries)
+	router.GET("/api/glossaries/:name", handleGetGlossary)
+	router.PUT("/api/glossaries/:name", handlePutGlossary)
+	router.DELETE("/api/glossaries/:name", handleDeleteGlossary)
+	return router
+}
+
+const testTenants = `{"tenants": [
+	{"id": "acme", "api_keys": ["acme-key"]},
+	{"id": "globex", "api_keys": ["globex-key"]},
+	{"id": "ops", "api_keys": ["ops-key"], "admin": true}
+]}`
+
+func do(router *gin.Engine, method, path, apiKey, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// uploadForm gửi một ảnh PNG nhỏ lên /api/upload cùng các trường form
+func uploadForm(t *testing.T, router *gin.Engine, apiKey, filename string, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 4)))
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	file, _ := form.CreateFormFile("image", filename)
+	file.Write(img.Bytes())
+	form.Close()
+	req := httptest.NewRequest("POST", "/api/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-API-Key", apiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGlossaryPerTenant(t *testing.T) {
+	router := newTenantRouter(t, testTenants)
+	if w := do(router, "PUT", "/api/glossaries/legal", "acme-key", `{"terms": {"invoice": "hóa đơn"}}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", w.Code, w.Body)
+	}
+
+	// Tenant khác không thấy, không sửa và không xóa được glossary cùng tên
+	if w := do(router, "GET", "/api/glossaries/legal", "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET by another tenant: %d %s", w.Code, w.Body)
+	}
+	if w := do(router, "GET", "/api/glossaries", "globex-key", ""); !strings.Contains(w.Body.String(), `"glossaries":[]`) {
+		t.Errorf("list of another tenant: %s", w.Body)
+	}
+	if w := do(router, "DELETE", "/api/glossaries/legal", "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE by another tenant: %d %s", w.Code, w.Body)
+	}
+	if w := do(router, "PUT", "/api/glossaries/legal", "globex-key", `{"terms": {"invoice": "bill"}}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT by another tenant: %d %s", w.Code, w.Body)
+	}
+
+	w := do(router, "GET", "/api/glossaries/legal", "acme-key", "")
+	var got struct {
+		Terms map[string]string `json:"terms"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Terms["invoice"] != "hóa đơn" {
+		t.Fatalf("glossary of acme = %s, want its own terms", w.Body)
+	}
+	ctx := context.Background()
+	if n, _ := redisClient.Exists(ctx, tenant.GlossaryKey("acme", "legal"), tenant.GlossaryKey("globex", "legal")).Result(); n != 2 {
+		t.Fatalf("%d of the 2 tenant glossary keys exist", n)
+	}
+}
+
+func TestRequireJobOwner(t *testing.T) {
+	router := newTenantRouter(t, testTenants)
+	jobID := model.TenantJobID("acme", "job1")
+	if err := jobStore.SetStatus(context.Background(), jobID, model.StatusQueued, ""); err != nil {
+		t.Fatal(err)
+	}
+	if w := do(router, "GET", "/api/status/"+jobID, "acme-key", ""); w.Code != http.StatusOK {
+		t.Errorf("owner: %d %s", w.Code, w.Body)
+	}
+	if w := do(router, "GET", "/api/status/"+jobID, "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("another tenant: %d %s", w.Code, w.Body)
+	}
+	if w := do(router, "GET", "/api/status/"+jobID, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no API key: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	router := newTenantRouter(t, testTenants)
+	adminAPIKey = "secret" // Bỏ qua khi có TENANTS_FILE
+	for key, want := range map[string]int{"ops-key": http.StatusOK, "acme-key": http.StatusForbidden, "secret": http.StatusUnauthorized} {
+		if w := do(router, "GET", "/api/stats", key, ""); w.Code != want {
+			t.Errorf("key %s: %d, want %d", key, w.Code, want)
+		}
+	}
+
+	// Không có TENANTS_FILE: ADMIN_API_KEY
+	router = newTenantRouter(t, "")
+	adminAPIKey = "secret"
+	for key, want := range map[string]int{"secret": http.StatusOK, "wrong": http.StatusForbidden, "": http.StatusForbidden} {
+		if w := do(router, "GET", "/api/stats", key, ""); w.Code != want {
+			t.Errorf("key %q: %d, want %d", key, w.Code, want)
+		}
+	}
+	router.GET("/api/admin/workers", requireAdmin, handleAdminWorkers)
+	if w := do(router, "GET", "/api/admin/workers", "wrong", ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"ADMIN_REQUIRED"`) {
+		t.Errorf("admin route with a wrong key: %d %s, want 403 ADMIN_REQUIRED", w.Code, w.Body)
+	}
+
+	// Không có ADMIN_API_KEY lẫn TENANTS_FILE: /api/stats mở, các route quản trị khác tắt
+	adminAPIKey = ""
+	if w := do(router, "GET", "/api/stats", "", ""); w.Code != http.StatusOK {
+		t.Errorf("/api/stats without ADMIN_API_KEY: %d %s, want 200", w.Code, w.Body)
+	}
+	if w := do(router, "GET", "/api/admin/workers", "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("admin route without ADMIN_API_KEY: %d, want 403", w.Code)
+	}
+}
+
+func TestAdminUsage(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, testTenants)
+	router.GET("/api/admin/usage", requireAdmin, handleAdminUsage)
+	usage.RecordCharacters(ctx, redisClient, "acme", usage.Characters{OCR: 100, Translated: 80, Provider: "google"})
+	usage.RecordCharacters(ctx, redisClient, "globex", usage.Characters{OCR: 20, Translated: 20, Provider: "google"})
+
+	if w := do(router, "GET", "/api/admin/usage", "acme-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin tenant: %d, want 403", w.Code)
+	}
+	w := do(router, "GET", "/api/admin/usage?days=7", "ops-key", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Tenants []struct {
+			Tenant string                  `json:"tenant"`
+			Days   []usage.DailyCharacters `json:"days"`
+			Total  usage.DailyCharacters   `json:"total"`
+		} `json:"tenants"`
+		Total usage.DailyCharacters `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, u := range resp.Tenants {
+		ids = append(ids, u.Tenant)
+		if len(u.Days) != 7 {
+			t.Errorf("tenant %s: %d days, want 7", u.Tenant, len(u.Days))
+		}
+	}
+	if strings.Join(ids, ",") != "acme,globex,ops" || resp.Tenants[0].Total.TranslatedChars != 80 {
+		t.Errorf("tenants = %+v", resp.Tenants)
+	}
+	if resp.Total.Jobs != 2 || resp.Total.TranslatedChars != 100 || resp.Total.Providers["google"] != 100 {
+		t.Errorf("total = %+v", resp.Total)
+	}
+
+	w = do(router, "GET", "/api/admin/usage?tenant=globex", "ops-key", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tenant":"globex"`) || strings.Contains(w.Body.String(), `"tenant":"acme"`) {
+		t.Errorf("?tenant=globex: %d %s", w.Code, w.Body)
+	}
+	if w := do(router, "GET", "/api/admin/usage?tenant=nope", "ops-key", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown tenant: %d, want 400", w.Code)
+	}
+}
+
+func TestListJobsByRef(t *testing.T) {
+	router := newTenantRouter(t, testTenants)
+	router.POST("/api/upload", handleUpload)
+	router.GET("/api/jobs", handleListJobs)
+	cfg.OutputDir = t.TempDir()
+	jobBroker = &fakeBroker{}
+	t.Cleanup(func() { cfg.OutputDir, jobBroker = "", nil })
+
+	var ids []string
+	for _, upload := range []struct{ apiKey, filename, externalID string }{
+		{"acme-key", "invoice.png", "INV-42"},
+		{"acme-key", "invoice.png", ""},
+		{"globex-key", "invoice.png", "INV-42"},
+	} {
+		w := uploadForm(t, router, upload.apiKey, upload.filename, map[string]string{"external_id": upload.externalID})
+		if w.Code != http.StatusOK {
+			t.Fatalf("upload: %d %s", w.Code, w.Body)
+		}
+		var created struct {
+			JobID string `json:"job_id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		ids = append(ids, created.JobID)
+	}
+
+	list := func(query string) []string {
+		t.Helper()
+		w := do(router, "GET", "/api/jobs?"+query, "acme-key", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", query, w.Code, w.Body)
+		}
+		var body struct {
+			Jobs []struct {
+				JobID string `json:"job_id"`
+			} `json:"jobs"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		var got []string
+		for _, job := range body.Jobs {
+			got = append(got, job.JobID)
+		}
+		return got
+	}
+	if got := list("external_id=INV-42"); len(got) != 1 || got[0] != ids[0] {
+		t.Errorf("external_id=INV-42: %v, want [%s]", got, ids[0])
+	}
+	if got := list("externalId=INV-42"); len(got) != 1 || got[0] != ids[0] {
+		t.Errorf("externalId=INV-42: %v, want [%s]", got, ids[0])
+	}
+	// Cùng giây: thứ tự không xác định
+	if got := list("filename=invoice.png"); len(got) != 2 || !slices.Contains(got, ids[0]) || !slices.Contains(got, ids[1]) {
+		t.Errorf("filename=invoice.png: %v, want %v", got, ids[:2])
+	}
+	if got := list("external_id=INV-7"); len(got) != 0 {
+		t.Errorf("external_id=INV-7: %v, want none", got)
+	}
+	if got := list("external_id=INV-42&filename=invoice.png"); len(got) != 1 || got[0] != ids[0] {
+		t.Errorf("external_id with filename: %v, want [%s]", got, ids[0])
+	}
+
+	w := do(router, "GET", "/api/status/"+ids[0], "acme-key", "")
+	if !strings.Contains(w.Body.String(), `"external_id":"INV-42"`) || !strings.Contains(w.Body.String(), `"filename":"invoice.png"`) {
+		t.Errorf("status = %s", w.Body)
+	}
+	w = uploadForm(t, router, "acme-key", "invoice.png", map[string]string{"external_id": strings.Repeat("x", externalIDMaxLength+1)})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("long external_id: %d", w.Code)
+	}
+}
+
+func TestUploadOCRModeAlias(t *testing.T) {
+	router := newTenantRouter(t, testTenants)
+	router.POST("/api/upload", handleUpload)
+	cfg.OutputDir = t.TempDir()
+	jobBroker = &fakeBroker{}
+	t.Cleanup(func() { cfg.OutputDir, jobBroker = "", nil })
+
+	w := uploadForm(t, router, "acme-key", "note.png", map[string]string{"ocrMode": "cursive"})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "ocr_mode must be") {
+		t.Errorf("ocrMode=cursive: %d %s", w.Code, w.Body)
+	}
+	if w := uploadForm(t, router, "acme-key", "note.png", map[string]string{"ocrMode": "handwriting"}); w.Code != http.StatusOK {
+		t.Errorf("ocrMode=handwriting: %d %s", w.Code, w.Body)
+	}
+	// ocr_mode wins over the alias
+	if w := uploadForm(t, router, "acme-key", "note.png", map[string]string{"ocr_mode": "printed", "ocrMode": "cursive"}); w.Code != http.StatusOK {
+		t.Errorf("ocr_mode and ocrMode: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestListJobsByLabels(t *testing.T) {
+	router := newTenantRouter(t, testTenants)
+	router.POST("/api/upload", handleUpload)
+	router.GET("/api/jobs", handleListJobs)
+	cfg.OutputDir = t.TempDir()
+	jobBroker = &fakeBroker{}
+	t.Cleanup(func() { cfg.OutputDir, jobBroker = "", nil })
+
+	var ids []string
+	for _, labels := range []string{"department=legal,batch=2024-06", "department=legal, batch=2024-07", "department=hr,batch=2024-06"} {
+		w := uploadForm(t, router, "acme-key", "scan.png", map[string]string{"labels": labels})
+		if w.Code != http.StatusOK {
+			t.Fatalf("upload with labels %s: %d %s", labels, w.Code, w.Body)
+		}
+		var created struct {
+			JobID string `json:"job_id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		ids = append(ids, created.JobID)
+	}
+	for _, labels := range []string{"department", "department=legal,department=hr", "depart ment=legal", "batch=2024 06"} {
+		if w := uploadForm(t, router, "acme-key", "scan.png", map[string]string{"labels": labels}); w.Code != http.StatusBadRequest {
+			t.Errorf("labels %q: %d, want 400", labels, w.Code)
+		}
+	}
+
+	list := func(selector string) []string {
+		t.Helper()
+		w := do(router, "GET", "/api/jobs?labels="+url.QueryEscape(selector), "acme-key", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("labels=%s: %d %s", selector, w.Code, w.Body)
+		}
+		var body struct {
+			Jobs []struct {
+				JobID  string            `json:"job_id"`
+				Labels map[string]string `json:"labels"`
+			} `json:"jobs"`
+			Total int `json:"total"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		var got []string
+		for _, job := range body.Jobs {
+			if job.Labels["department"] == "" {
+				t.Errorf("job %s listed without its labels", job.JobID)
+			}
+			got = append(got, job.JobID)
+		}
+		if body.Total != len(got) {
+			t.Errorf("labels=%s: total %d, %d jobs", selector, body.Total, len(got))
+		}
+		slices.Sort(got)
+		return got
+	}
+	sorted := func(ids ...string) []string { return slices.Sorted(slices.Values(ids)) }
+	if got, want := list("department=legal"), sorted(ids[0], ids[1]); !slices.Equal(got, want) {
+		t.Errorf("department=legal: %v, want %v", got, want)
+	}
+	if got, want := list("batch=2024-06,department=legal"), sorted(ids[0]); !slices.Equal(got, want) {
+		t.Errorf("batch=2024-06,department=legal: %v, want %v", got, want)
+	}
+	if got := list("department=finance"); len(got) != 0 {
+		t.Errorf("department=finance: %v", got)
+	}
+	if w := do(router, "GET", "/api/jobs?labels=department", "acme-key", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("selector without value: %d", w.Code)
+	}
+	// Nhãn của tenant khác không lẫn vào
+	if w := do(router, "GET", "/api/jobs?labels=department=legal", "globex-key", ""); strings.Contains(w.Body.String(), ids[0]) {
+		t.Errorf("globex sees the jobs of acme: %s", w.Body)
+	}
+
+	w := do(router, "GET", "/api/status/"+ids[1], "acme-key", "")
+	if !strings.Contains(w.Body.String(), `"labels":{"batch":"2024-07","department":"legal"}`) {
+		t.Errorf("status = %s", w.Body)
+	}
+}
+
+func TestQueryAPIKeyNotLogged(t *testing.T) {
+	newTenantRouter(t, testTenants)
+	var accessLog bytes.Buffer
+	router := gin.New()
+	router.Use(stripQueryAPIKey, gin.LoggerWithWriter(&accessLog), authenticate)
+	router.GET("/ws", func(c *gin.Context) { c.String(http.StatusOK, callerTenant(c).ID) })
+	router.GET("/api/jobs", func(c *gin.Context) { c.String(http.StatusOK, callerTenant(c).ID) })
+
+	if w := do(router, "GET", "/ws?api_key=acme-key&lang=vi", "", ""); w.Code != http.StatusOK || w.Body.String() != "acme" {
+		t.Errorf("/ws with api_key: %d %s", w.Code, w.Body)
+	}
+	// Chỉ /ws nhận key trong query
+	if w := do(router, "GET", "/api/jobs?api_key=acme-key", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("/api/jobs with api_key: %d %s", w.Code, w.Body)
+	}
+	if strings.Contains(accessLog.String(), "acme-key") {
+		t.Errorf("API key in the access log:\n%s", accessLog.String())
+	}
+	if !strings.Contains(accessLog.String(), "/ws?lang=vi") {
+		t.Errorf("access log lost the other query parameters:\n%s", accessLog.String())
+	}
+}
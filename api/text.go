@@ -0,0 +1,147 @@
+package api
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+)
+
+const (
+	textPreviewRunes  = 500   // Số ký tự tối đa của bản xem trước trong response status
+	textPageMaxRunes  = 20000 // Giới hạn limit tối đa cho mỗi trang văn bản
+	textPageDefault   = 5000  // limit mặc định nếu client không truyền
+	gzipMinBodyLength = 1024  // Chỉ nén gzip khi body lớn hơn ngưỡng này
+)
+
+// Các trường văn bản được lưu trong Redis theo dạng {jobID}:{field}
+var textFields = map[string]string{
+	"ocr":        "ocr_text",
+	"translated": "translated_text",
+}
+
+// --- Hàm cắt bản xem trước theo số ký tự (rune) ---
+// Trả về bản xem trước, tổng số ký tự và cờ cho biết có bị cắt hay không
+func textPreview(text string, maxRunes int) (string, int, bool) {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text, len(runes), false
+	}
+	return string(runes[:maxRunes]), len(runes), true
+}
+
+// --- Thêm bản xem trước văn bản vào response status ---
+func addTextPreviews(c *gin.Context, jobID string, response gin.H) {
+	ctx := c.Request.Context()
+	for name, field := range textFields {
+		text, err := redisClient.Get(ctx, fmt.Sprintf("%s:%s", jobID, field)).Result()
+		if err == redis.Nil {
+			continue // Job không có văn bản (ví dụ: thất bại trước bước OCR)
+		}
+		if err != nil {
+			log.Printf("Warning: Error getting %s from Redis for job %s: %v", field, jobID, err)
+			continue
+		}
+		preview, length, truncated := textPreview(text, textPreviewRunes)
+		response[name+"_text_preview"] = preview
+		response[name+"_text_length"] = length
+		response[name+"_text_truncated"] = truncated
+	}
+}
+
+// --- Handler trả về văn bản đầy đủ của Job theo trang ---
+// GET /api/jobs/:job_id/text?field=translated&offset=0&limit=5000
+// offset và limit tính theo ký tự (rune) để không cắt đôi ký tự tiếng Việt
+func handleJobText(c *gin.Context) {
+	jobID := c.Param("job_id")
+	ctx := c.Request.Context()
+
+	fieldName := c.DefaultQuery("field", "translated")
+	field, ok := textFields[fieldName]
+	if !ok {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "field must be 'ocr' or 'translated'")
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "offset must be a non-negative integer")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(textPageDefault)))
+	if err != nil || limit <= 0 {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, "limit must be a positive integer")
+		return
+	}
+	if limit > textPageMaxRunes {
+		limit = textPageMaxRunes
+	}
+
+	text, err := redisClient.Get(ctx, fmt.Sprintf("%s:%s", jobID, field)).Result()
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeTextNotFound, "Text not available for this job")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting %s from Redis for job %s: %v", field, jobID, err)
+		respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get job text")
+		return
+	}
+
+	runes := []rune(text)
+	total := len(runes)
+	start := offset
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	response := gin.H{
+		"job_id":   jobID,
+		"field":    fieldName,
+		"offset":   start,
+		"limit":    limit,
+		"total":    total,
+		"text":     string(runes[start:end]),
+		"has_more": end < total,
+	}
+	if end < total {
+		response["next_offset"] = end
+	}
+
+	writeJSONMaybeGzip(c, http.StatusOK, response)
+}
+
+// --- Ghi JSON, nén gzip nếu client hỗ trợ và body đủ lớn ---
+func writeJSONMaybeGzip(c *gin.Context, code int, obj interface{}) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, httpserver.CodeInternal, "Failed to encode response")
+		return
+	}
+	if len(body) < gzipMinBodyLength || !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Data(code, "application/json; charset=utf-8", body)
+		return
+	}
+
+	c.Header("Content-Encoding", "gzip")
+	c.Header("Vary", "Accept-Encoding")
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(code)
+	gz := gzip.NewWriter(c.Writer)
+	defer gz.Close()
+	if _, err := gz.Write(body); err != nil {
+		log.Printf("Error writing gzip response: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+)
+
+const (
+	uploadDefaultMaxBytes = 10 << 20 // Kích thước file upload tối đa mặc định (10 MiB)
+	uploadFormMaxBytes    = 1 << 20  // Tổng kích thước các trường form khác ngoài file
+)
+
+var uploadMaxBytes int64 = uploadDefaultMaxBytes // File upload lớn hơn bị từ chối với 413 (UPLOAD_MAX_BYTES)
+
+// --- Đọc kích thước file upload tối đa từ biến môi trường ---
+func initUploadLimit() error {
+	uploadMaxBytes = uploadDefaultMaxBytes
+	if raw := os.Getenv("UPLOAD_MAX_BYTES"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("UPLOAD_MAX_BYTES must be a positive integer, got %q", raw)
+		}
+		uploadMaxBytes = n
+	}
+	return nil
+}
+
+func uploadTooLarge() *jobError {
+	return fileTooLarge(uploadMaxBytes)
+}
+
+func fileTooLarge(maxBytes int64) *jobError {
+	return newJobError(http.StatusRequestEntityTooLarge, codeUploadTooLarge, fmt.Sprintf("Uploaded files are limited to %d bytes", maxBytes), gin.H{"max_bytes": maxBytes})
+}
+
+// --- Đọc request upload theo luồng: file "image" được ghi thẳng xuống thư mục upload ---
+// Không đệm cả file trong bộ nhớ hay file tạm của multipart: Content-Length quá lớn bị từ
+// chối trước khi đọc body, file vượt UPLOAD_MAX_BYTES bị dừng ngay khi vượt. Các trường form
+// còn lại được đặt vào PostForm để createJob đọc như trước. cleanup (gọi cả khi lỗi) xóa file
+// tạm nếu job không được tạo (sau khi image.save đã chuyển file đi thì không còn gì để xóa).
+func readUpload(c *gin.Context) (image *uploadImage, cleanup func(), jerr *jobError) {
+	return readMultipartFile(c, "image", uploadMaxBytes)
+}
+
+// --- Đọc request multipart theo luồng, file của trường field tối đa maxBytes (ảnh, file ZIP) ---
+func readMultipartFile(c *gin.Context, field string, maxBytes int64) (image *uploadImage, cleanup func(), jerr *jobError) {
+	cleanup = func() {}
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		// Form thường (source_job_id): không có file
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadFormMaxBytes)
+		return nil, cleanup, nil
+	}
+	if c.Request.ContentLength > maxBytes+uploadFormMaxBytes {
+		c.Header("Connection", "close") // Không đọc phần body còn lại
+		return nil, cleanup, fileTooLarge(maxBytes)
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+uploadFormMaxBytes)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, cleanup, newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "Invalid multipart form")
+	}
+
+	form := url.Values{}
+	formBytes := int64(0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, cleanup, readUploadError(err, maxBytes)
+		}
+		if part.FormName() == field && part.FileName() != "" && image == nil {
+			tmpPath, size, err := receiveUploadFile(part, maxBytes)
+			if err != nil {
+				return nil, cleanup, readUploadError(err, maxBytes)
+			}
+			cleanup = func() { os.Remove(tmpPath) }
+			image = &uploadImage{name: part.FileName(), size: size, save: func(path string) error {
+				if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+					return err
+				}
+				return os.Rename(tmpPath, path)
+			}}
+			continue
+		}
+		var value strings.Builder
+		n, err := io.Copy(&value, io.LimitReader(part, uploadFormMaxBytes-formBytes+1))
+		if err != nil {
+			return nil, cleanup, readUploadError(err, maxBytes)
+		}
+		if formBytes += n; formBytes > uploadFormMaxBytes {
+			return nil, cleanup, newJobError(http.StatusRequestEntityTooLarge, codeUploadTooLarge, fmt.Sprintf("Form fields are limited to %d bytes", uploadFormMaxBytes))
+		}
+		if part.FileName() == "" {
+			form.Add(part.FormName(), value.String())
+		}
+	}
+	c.Request.PostForm = form
+	return image, cleanup, nil
+}
+
+// --- Ghi file upload vào file tạm trong thư mục upload (cùng ổ đĩa: chuyển bằng rename) ---
+func receiveUploadFile(part io.Reader, maxBytes int64) (string, int64, error) {
+	dir := filepath.Join(cfg.UploadDir(), ".incoming")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", 0, err
+	}
+	f, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := io.Copy(f, io.LimitReader(part, maxBytes+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxBytes {
+		err = errUploadTooLarge
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+	return f.Name(), n, nil
+}
+
+var errUploadTooLarge = errors.New("upload too large")
+
+// --- Lỗi khi đọc body: quá giới hạn -> 413, client ngắt giữa chừng -> 400, lỗi ghi đĩa -> 500 ---
+func readUploadError(err error, maxBytes int64) *jobError {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, errUploadTooLarge) || errors.As(err, &maxBytesErr):
+		return fileTooLarge(maxBytes)
+	case errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), "multipart"):
+		return newJobError(http.StatusBadRequest, codeInvalidImage, "Upload interrupted or malformed multipart form")
+	default:
+		log.Printf("Error receiving upload: %v", err)
+		return newJobError(http.StatusInternalServerError, codeStorageUnavailable, "Failed to save uploaded file")
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/antivirus"
+)
+
+// newUploadRequest tạo request multipart với trường target_lang và file image có size byte
+func newUploadRequest(t *testing.T, size int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("target_lang", "vi")
+	file, err := form.CreateFormFile("image", "scan.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(bytes.Repeat([]byte{'x'}, size))
+	form.Close()
+	req := httptest.NewRequest("POST", "/api/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestReadUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg.OutputDir = t.TempDir()
+	uploadMaxBytes = 1000
+	t.Cleanup(func() { cfg.OutputDir, uploadMaxBytes = "", uploadDefaultMaxBytes })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = newUploadRequest(t, 1000)
+	image, cleanup, jerr := readUpload(c)
+	defer cleanup()
+	if jerr != nil {
+		t.Fatalf("readUpload: %+v", jerr)
+	}
+	if image == nil || image.name != "scan.png" || image.size != 1000 {
+		t.Fatalf("image = %+v", image)
+	}
+	if got := c.PostForm("target_lang"); got != "vi" {
+		t.Errorf("target_lang = %q, want vi", got)
+	}
+	path := filepath.Join(cfg.OutputDir, "uploads", "job-scan.png")
+	if err := image.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || len(data) != 1000 {
+		t.Errorf("saved file: %d bytes, %v", len(data), err)
+	}
+
+	// Content-Length quá lớn: từ chối trước khi đọc body
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = newUploadRequest(t, uploadFormMaxBytes+1001)
+	if _, cleanup, jerr := readUpload(c); jerr == nil || jerr.status != http.StatusRequestEntityTooLarge {
+		t.Errorf("large Content-Length: %+v, want 413", jerr)
+	} else {
+		cleanup()
+	}
+
+	// Không có Content-Length (chunked): dừng khi file vượt giới hạn, không để lại file tạm
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = newUploadRequest(t, 1001)
+	c.Request.ContentLength = -1
+	c.Request.Body = io.NopCloser(c.Request.Body)
+	_, cleanup, jerr = readUpload(c)
+	cleanup()
+	if jerr == nil || jerr.code != codeUploadTooLarge {
+		t.Errorf("oversize file: %+v, want %s", jerr, codeUploadTooLarge)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(cfg.OutputDir, "uploads", ".incoming")); len(entries) != 0 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+}
+
+// File vượt StreamMaxLength của clamd bị từ chối, kể cả khi CLAMD_FAIL_OPEN
+func TestScanUploadTooLarge(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			r.ReadString(0) // zINSTREAM
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			io.Copy(io.Discard, r)
+			conn.Close()
+		}
+	}()
+	virusScanner = &antivirus.Clamd{Network: "tcp", Address: ln.Addr().String(), Timeout: 5 * time.Second}
+	scanFailOpen = true
+	t.Cleanup(func() { virusScanner, scanFailOpen = nil, false })
+
+	upload := filepath.Join(t.TempDir(), "scan.pdf")
+	if err := os.WriteFile(upload, bytes.Repeat([]byte{'x'}, 1024), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	details, jobErr := scanUpload(context.Background(), "j1", upload)
+	if jobErr == nil || jobErr.status != http.StatusRequestEntityTooLarge || jobErr.code != codeScanTooLarge {
+		t.Fatalf("scanUpload = %v, %+v, want 413 SCAN_TOO_LARGE", details, jobErr)
+	}
+	if _, err := os.Stat(upload); !os.IsNotExist(err) {
+		t.Errorf("upload kept after rejection: %v", err)
+	}
+}
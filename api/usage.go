@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+const usageDaysDefault = 30 // days mặc định của /api/admin/usage
+
+// --- Handler trả về chi phí dịch của từng tenant theo từng ngày (UTC) ---
+// GET /api/admin/usage?days=30&tenant=<id>: số job, ký tự OCR, ký tự đã gửi tới provider dịch
+// (tổng và theo provider) của mọi tenant (hoặc của tenant chỉ định), mới nhất trước, để phân
+// bổ chi phí dịch và theo dõi ngân sách. Chỉ dành cho admin (requireAdmin)
+func handleAdminUsage(c *gin.Context) {
+	maxDays := int(usage.CharsRetention.Hours() / 24)
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(usageDaysDefault)))
+	if err != nil || days < 1 || days > maxDays {
+		respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, fmt.Sprintf("days must be between 1 and %d", maxDays))
+		return
+	}
+	list := []*tenant.Tenant{tenant.Default}
+	if tenants != nil {
+		list = tenants.Tenants()
+	}
+	if id := c.Query("tenant"); id != "" {
+		if !knownTenant(id) {
+			respondError(c, http.StatusBadRequest, httpserver.CodeInvalidRequest, fmt.Sprintf("Unknown tenant '%s'", id))
+			return
+		}
+		t, _ := tenants.Tenant(id)
+		list = []*tenant.Tenant{t}
+	}
+
+	perTenant := make([]gin.H, 0, len(list))
+	var all []usage.DailyCharacters
+	for _, t := range list {
+		daily, err := usage.LoadCharacters(c.Request.Context(), redisClient, t.ID, days)
+		if err != nil {
+			log.Printf("Error loading character usage of tenant %s: %v", t.ID, err)
+			respondError(c, http.StatusInternalServerError, codeStoreUnavailable, "Failed to get usage")
+			return
+		}
+		perTenant = append(perTenant, gin.H{
+			"tenant":      t.ID,
+			"daily_chars": t.DailyChars, // 0: không giới hạn
+			"days":        daily,
+			"total":       usageTotal(usage.Sum(daily)),
+		})
+		all = append(all, daily...)
+	}
+	c.JSON(http.StatusOK, gin.H{"tenants": perTenant, "total": usageTotal(usage.Sum(all))})
+}
+
+// Tổng của nhiều ngày, không có trường date
+func usageTotal(total usage.DailyCharacters) gin.H {
+	return gin.H{"jobs": total.Jobs, "ocr_chars": total.OCRChars, "translated_chars": total.TranslatedChars, "providers": total.Providers}
+}
+
+// --- Ngân sách ký tự dịch mỗi ngày của tenant ---
+// Job mới bị từ chối khi các job trong ngày đã dùng hết ngân sách
+func checkCharBudget(ctx context.Context, t *tenant.Tenant) *jobError {
+	if t.DailyChars == 0 {
+		return nil
+	}
+	today, err := usage.LoadCharacters(ctx, redisClient, t.ID, 1)
+	if err != nil {
+		log.Printf("Error loading character usage of tenant %s: %v", t.ID, err)
+		return newJobError(http.StatusInternalServerError, codeStoreUnavailable, "Failed to check translation budget")
+	}
+	if today[0].TranslatedChars >= t.DailyChars {
+		return newJobError(http.StatusTooManyRequests, codeQuotaExceeded, fmt.Sprintf("Daily translation budget of %d characters exceeded", t.DailyChars), gin.H{"daily_chars": t.DailyChars})
+	}
+	return nil
+}
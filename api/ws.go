@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+const (
+	wsUploadTimeout = time.Minute      // Thời gian tối đa để gửi xong message start và ảnh
+	wsWriteTimeout  = 10 * time.Second // Thời gian tối đa ghi một message
+	wsPingInterval  = 30 * time.Second // Ping giữ kết nối qua proxy và phát hiện client đã mất
+	wsMaxWait       = time.Hour        // Thời gian tối đa theo dõi một job
+)
+
+var wsUpgrader = websocket.Upgrader{
+	HandshakeTimeout: 10 * time.Second,
+	// Origin đã được kiểm tra bởi httpserver.CORS (CORS_ALLOWED_ORIGINS)
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Message đầu tiên của client, trước các frame nhị phân chứa ảnh
+type wsStart struct {
+	Type     string            `json:"type"` // "start"
+	Filename string            `json:"filename"`
+	Size     int64             `json:"size"`    // Tổng số byte của ảnh
+	Options  map[string]string `json:"options"` // Các trường form của /api/upload (target_lang, ocr_mode...)
+}
+
+// --- Handler WebSocket: upload ảnh rồi nhận tiến trình và kết quả trên cùng kết nối ---
+// GET /ws
+// Client gửi {"type": "start", "filename", "size", "options"} rồi nội dung ảnh
+// trong các frame nhị phân. Server gửi "queued" (job_id), "progress" (status,
+// stage) mỗi khi thay đổi, cuối cùng "result" (như mode=sync) hoặc "error"
+// ({"error": {...}} như API), rồi đóng kết nối.
+func handleWebSocket(c *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrader đã trả lỗi HTTP cho client
+	}
+	defer conn.Close()
+
+	jobID, jobType, jerr := receiveJob(c, conn)
+	if jerr != nil {
+		closeWebSocket(conn, gin.H{"type": "error", "error": httpserver.NewError(c.Request, jerr.code, jerr.message, jerr.details)})
+		return
+	}
+	if err := sendWebSocket(conn, gin.H{"type": "queued", "job_id": jobID, "job_type": jobTypeName(jobType)}); err != nil {
+		return
+	}
+	streamJob(c, conn, jobID, jobTypeName(jobType))
+}
+
+// --- Nhận message start và ảnh, tạo job như /api/upload ---
+func receiveJob(c *gin.Context, conn *websocket.Conn) (string, string, *jobError) {
+	conn.SetReadLimit(uploadMaxBytes)
+	conn.SetReadDeadline(time.Now().Add(wsUploadTimeout))
+
+	var start wsStart
+	if err := conn.ReadJSON(&start); err != nil || start.Type != "start" {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, `The first message must be {"type": "start", "filename", "size", "options"}`)
+	}
+	if start.Size > uploadMaxBytes {
+		return "", "", uploadTooLarge()
+	}
+	if start.Size <= 0 {
+		return "", "", newJobError(http.StatusBadRequest, httpserver.CodeInvalidRequest, "size must be between 1 and the maximum image size", gin.H{"max_bytes": uploadMaxBytes})
+	}
+	if start.Filename == "" {
+		start.Filename = "image"
+	}
+
+	data := make([]byte, 0, start.Size)
+	for int64(len(data)) < start.Size {
+		kind, chunk, err := conn.ReadMessage()
+		if err != nil {
+			return "", "", newJobError(http.StatusBadRequest, codeInvalidImage, "Upload interrupted before size bytes were received")
+		}
+		if kind != websocket.BinaryMessage {
+			return "", "", newJobError(http.StatusBadRequest, codeInvalidImage, "The image must be sent in binary frames")
+		}
+		if int64(len(data)+len(chunk)) > start.Size {
+			return "", "", newJobError(http.StatusBadRequest, codeInvalidImage, "Received more bytes than size")
+		}
+		data = append(data, chunk...)
+	}
+
+	// Tùy chọn của job được đọc như các trường form của /api/upload
+	form := url.Values{}
+	for name, value := range start.Options {
+		form.Set(name, value)
+	}
+	c.Request.PostForm = form
+	image := &uploadImage{name: start.Filename, size: start.Size, save: func(path string) error {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0o644)
+	}}
+	return createJob(c, image, false)
+}
+
+// --- Gửi tiến trình của job cho tới khi job kết thúc, client đóng kết nối hoặc quá wsMaxWait ---
+func streamJob(c *gin.Context, conn *websocket.Conn, jobID, jobType string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), wsMaxWait)
+	defer cancel()
+
+	// Đọc frame của client để xử lý ping/pong và close; lỗi đọc: client đã đóng kết nối
+	go func() {
+		defer cancel()
+		conn.SetReadDeadline(time.Time{})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Ping giữ kết nối; WriteControl được phép chạy song song với các lần ghi message
+	go func() {
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ping.C:
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)) != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	// Trạng thái và bước mới được báo qua pub/sub (model.StatusChannel), không poll Redis
+	lastStatus, lastStage := "", ""
+	var sendErr error
+	job, err := jobStore.Watch(ctx, jobID, func(job *model.Result) error {
+		stage := ""
+		if job.Status == model.StatusProcessing {
+			stage = job.Details["stage"]
+		}
+		if job.Status == lastStatus && stage == lastStage {
+			return nil
+		}
+		progress := gin.H{"type": "progress", "job_id": jobID, "status": job.Status}
+		if stage != "" {
+			progress["stage"] = stage
+		}
+		lastStatus, lastStage = job.Status, stage
+		sendErr = sendWebSocket(conn, progress)
+		return sendErr
+	})
+	switch {
+	case sendErr != nil:
+		return // Client đã mất kết nối
+	case err == nil:
+		result := jobResult(ctx, jobID, jobType, job)
+		result["type"] = "result"
+		closeWebSocket(conn, result)
+	case ctx.Err() == context.DeadlineExceeded:
+		// Job vẫn tiếp tục, client poll /api/status/:job_id
+		closeWebSocket(conn, gin.H{"type": "error", "error": httpserver.NewError(c.Request, codeJobStillRunning, "Job not finished in time, poll its status", gin.H{"job_id": jobID})})
+	case ctx.Err() == nil:
+		log.Printf("Error getting status from Redis for job %s: %v", jobID, err)
+		closeWebSocket(conn, gin.H{"type": "error", "error": httpserver.NewError(c.Request, codeStoreUnavailable, "Failed to get job status", gin.H{"job_id": jobID})})
+	}
+}
+
+func sendWebSocket(conn *websocket.Conn, message gin.H) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return conn.WriteJSON(message)
+}
+
+// --- Gửi message cuối cùng rồi đóng kết nối (close 1000) ---
+func closeWebSocket(conn *websocket.Conn, message gin.H) {
+	if sendWebSocket(conn, message) != nil {
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteTimeout))
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// Tiến trình được gửi ngay khi worker đổi bước (pub/sub), kết nối đóng sau message result
+func TestStreamJob(t *testing.T) {
+	ctx := context.Background()
+	router := newTenantRouter(t, "")
+	jobID := "j1"
+	jobStore.SetStatus(ctx, jobID, model.StatusProcessing, "")
+	router.GET("/watch", func(c *gin.Context) {
+		conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		streamJob(c, conn, jobID, "image")
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/watch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second)) // Fallback poll của Watch là 5s
+
+	read := func() map[string]any {
+		var message map[string]any
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	if message := read(); message["type"] != "progress" || message["status"] != model.StatusProcessing {
+		t.Fatalf("first message = %v", message)
+	}
+	jobStore.SaveDetails(ctx, jobID, map[string]string{"stage": "ocr"})
+	jobStore.RecordHistory(ctx, jobID, model.HistoryEvent{Type: model.HistoryStage, Stage: "ocr"})
+	if message := read(); message["stage"] != "ocr" {
+		t.Fatalf("stage message = %v", message)
+	}
+	jobStore.SetStatus(ctx, jobID, model.StatusFailed, "OCR error")
+	if message := read(); message["type"] != "result" || message["error_message"] != "OCR error" {
+		t.Fatalf("result message = %v", message)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("after result: %v, want close 1000", err)
+	}
+}
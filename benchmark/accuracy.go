@@ -0,0 +1,120 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/benchmark"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/testutil"
+)
+
+// Các cấu hình tiền xử lý của chế độ accuracy, theo các bước của worker
+var preprocessConfigs = map[string]func(string) (string, error){
+	"none": func(path string) (string, error) { return path, nil },
+	"gray": func(path string) (string, error) {
+		filtered, _, err := imagefilter.ApplyFiltersWithOptions(path, imagefilter.Options{})
+		return filtered, err
+	},
+	"deskew": func(path string) (string, error) {
+		filtered, _, err := imagefilter.ApplyFiltersWithOptions(path, imagefilter.Options{Deskew: true})
+		return filtered, err
+	},
+}
+
+func preprocessNames() []string {
+	names := make([]string, 0, len(preprocessConfigs))
+	for name := range preprocessConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// --- Đo độ chính xác OCR (CER/WER) của từng cấu hình tiền xử lý trên cùng bộ ảnh ---
+// Ảnh được chép vào thư mục tạm để ảnh đã lọc không nằm cạnh bộ ảnh gốc
+func runAccuracyMode(dir string, generate int, configNames, langs []string) benchmark.AccuracyReport {
+	workDir, err := os.MkdirTemp("", "accuracy-")
+	if err != nil {
+		log.Fatalf("BENCHMARK: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	var samples []benchmark.Sample
+	if dir == "" {
+		samples, err = generateSamples(workDir, generate)
+	} else if samples, err = benchmark.LoadSamples(dir); err == nil {
+		for i := range samples {
+			copyPath := filepath.Join(workDir, filepath.Base(samples[i].ImagePath))
+			if err = copyFile(samples[i].ImagePath, copyPath); err != nil {
+				break
+			}
+			samples[i].ImagePath = copyPath
+		}
+	}
+	if err != nil {
+		log.Fatalf("BENCHMARK: Failed to prepare samples: %v", err)
+	}
+
+	var configs []benchmark.Preprocess
+	for _, name := range configNames {
+		name = strings.TrimSpace(name)
+		apply, ok := preprocessConfigs[name]
+		if !ok {
+			log.Fatalf("BENCHMARK: Unknown preprocessing config '%s' (expected %s)", name, strings.Join(preprocessNames(), ", "))
+		}
+		configs = append(configs, benchmark.Preprocess{Name: name, Apply: apply})
+	}
+
+	engine := &ocr.TesseractEngine{Languages: langs}
+	if _, err := engine.Prewarm(context.Background()); err != nil {
+		log.Fatalf("BENCHMARK: OCR engine is not ready: %v", err)
+	}
+	fmt.Printf("BENCHMARK: Accuracy of %d sample(s), %d config(s), languages %s\n", len(samples), len(configs), strings.Join(langs, "+"))
+	results := benchmark.RunAccuracy(context.Background(), samples, configs, func(ctx context.Context, imagePath string) (string, error) {
+		return engine.ImageToText(ctx, imagePath)
+	})
+	benchmark.PrintAccuracyResults(os.Stdout, results)
+	return benchmark.AccuracyReport{Mode: "accuracy", Samples: len(samples), Results: results}
+}
+
+// generateSamples sinh ảnh tài liệu tổng hợp kèm ground truth, mỗi mức khó count ảnh
+func generateSamples(dir string, count int) ([]benchmark.Sample, error) {
+	for _, level := range []string{testutil.DifficultyEasy, testutil.DifficultyMedium, testutil.DifficultyHard} {
+		for i := 1; i <= count; i++ {
+			opts, err := testutil.Difficulty(level)
+			if err != nil {
+				return nil, err
+			}
+			opts.Text, opts.Seed = testutil.Paragraphs(2, int64(i)), int64(i)
+			if _, _, err := testutil.WriteSample(dir, fmt.Sprintf("%s-%02d", level, i), opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return benchmark.LoadSamples(dir)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
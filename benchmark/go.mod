@@ -0,0 +1,5 @@
+module github.com/mxngoc2104/KTPM-CS2/benchmark
+
+go 1.24.2
+
+require github.com/go-redis/redis/v8 v8.11.5
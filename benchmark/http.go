@@ -0,0 +1,85 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/benchmark"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/testutil"
+)
+
+// --- Đo toàn hệ thống qua HTTP: upload multipart rồi chờ kết quả (long polling) tới khi job xong ---
+// Dùng được với deployment thật sau load balancer, không cần truy cập Redis hay Kafka
+func runHTTPMode(w benchmark.HTTPWorkload, files string) benchmark.HTTPResult {
+	var err error
+	if files == "" {
+		var dir string
+		if dir, err = os.MkdirTemp("", "http-bench-"); err != nil {
+			log.Fatalf("BENCHMARK: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		w.Files, err = writeUploadSamples(dir)
+	} else {
+		w.Files, err = listFiles(files)
+	}
+	if err != nil {
+		log.Fatalf("BENCHMARK: Failed to prepare upload files: %v", err)
+	}
+
+	fmt.Printf("BENCHMARK: %d job(s) to %s, %d concurrent client(s), %d file(s)\n", w.Requests, w.URL, w.Concurrency, len(w.Files))
+	result := benchmark.RunHTTPBenchmark(context.Background(), &http.Client{Timeout: w.JobTimeout}, w)
+	benchmark.PrintHTTPResult(os.Stdout, result)
+	return result
+}
+
+// listFiles trả về các file của danh sách (file hoặc thư mục, cách nhau bởi dấu phẩy)
+func listFiles(list string) ([]string, error) {
+	var files []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		info, err := os.Stat(item)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, item)
+			continue
+		}
+		entries, err := os.ReadDir(item)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(item, e.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file in %s", list)
+	}
+	return files, nil
+}
+
+// writeUploadSamples sinh một ảnh tài liệu tổng hợp cho mỗi mức khó
+func writeUploadSamples(dir string) ([]string, error) {
+	var files []string
+	for i, level := range []string{testutil.DifficultyEasy, testutil.DifficultyMedium, testutil.DifficultyHard} {
+		opts, err := testutil.Difficulty(level)
+		if err != nil {
+			return nil, err
+		}
+		opts.Text = testutil.Paragraphs(2, int64(i+1))
+		path := filepath.Join(dir, level+".png")
+		if err := testutil.WriteDocument(path, opts); err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
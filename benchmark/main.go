@@ -0,0 +1,225 @@
+// Package benchmark runs the benchmarks of `imgproc benchmark`.
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/benchmark"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+)
+
+// Run chạy benchmark với các tham số dòng lệnh args (Redis mặc định lấy từ cấu hình chung).
+// `compare old.json new.json` so sánh hai file kết quả thay vì chạy benchmark.
+func Run(c config.Config, args []string) {
+	if len(args) > 0 && args[0] == "compare" {
+		os.Exit(runCompare(args[1:]))
+	}
+	fs := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	mode := fs.String("mode", "cache", "Chế độ benchmark: cache, accuracy (CER/WER của OCR), http (tải toàn hệ thống qua API)")
+	jsonOut := fs.String("json", "", "Ghi kết quả dạng JSON vào file này (tùy chọn)")
+
+	// Tham số cho chế độ cache
+	w := benchmark.DefaultCacheWorkload()
+	backends := fs.String("backends", "memory,redis,tiered", "Danh sách backend cache cần so sánh (memory, redis, tiered, memcached, disk)")
+	redisAddr := fs.String("redis", c.RedisAddr, "Địa chỉ Redis cho backend redis/tiered")
+	fs.IntVar(&w.Operations, "ops", w.Operations, "Số thao tác cache")
+	fs.IntVar(&w.Concurrency, "concurrency", w.Concurrency, "Số goroutine chạy song song")
+	fs.IntVar(&w.Keys, "keys", w.Keys, "Số key khác nhau (không gian key)")
+	fs.Float64Var(&w.ReadRatio, "read-ratio", w.ReadRatio, "Tỷ lệ thao tác đọc (cache-aside)")
+	fs.IntVar(&w.ValueBytes, "value-bytes", w.ValueBytes, "Kích thước mỗi giá trị (byte)")
+	fs.Float64Var(&w.Skew, "skew", w.Skew, "Hệ số Zipf (> 1: có key nóng, 0: phân bố đều)")
+	fs.Int64Var(&w.Seed, "seed", w.Seed, "Seed sinh workload (cùng seed -> cùng workload)")
+	sweep := fs.String("sweep", "", "Chạy lại workload với từng mức concurrency (vd. 1,2,4,8,16,32) và tìm điểm gãy throughput")
+
+	// Tham số cho chế độ accuracy
+	sampleDir := fs.String("dir", "", "Thư mục ảnh kèm ground truth (<tên>.gt.txt hoặc <tên>.txt); rỗng: sinh ảnh tổng hợp")
+	generate := fs.Int("generate", 2, "Số ảnh tổng hợp cho mỗi mức khó (easy, medium, hard) khi không có -dir")
+	configs := fs.String("configs", "none,gray,deskew", "Các cấu hình tiền xử lý cần so sánh: "+strings.Join(preprocessNames(), ", "))
+	langs := fs.String("lang", "eng", "Ngôn ngữ Tesseract, cách nhau bởi dấu phẩy")
+
+	// Tham số cho chế độ http (toàn hệ thống qua API, -concurrency là số client song song)
+	hw := benchmark.HTTPWorkload{URL: c.APIURL, APIKey: c.APIKey, Requests: 50, PollInterval: 500 * time.Millisecond, JobTimeout: 5 * time.Minute}
+	fs.StringVar(&hw.URL, "url", hw.URL, "URL của API hoặc load balancer cần đo (mặc định API_URL)")
+	fs.StringVar(&hw.APIKey, "api-key", hw.APIKey, "API key của tenant gửi kèm request (mặc định API_KEY)")
+	files := fs.String("files", "", "File upload, cách nhau bởi dấu phẩy, hoặc một thư mục; rỗng: ảnh tổng hợp")
+	fs.IntVar(&hw.Requests, "requests", hw.Requests, "Số job upload")
+	fs.DurationVar(&hw.PollInterval, "poll", hw.PollInterval, "Thời gian chờ trước khi hỏi lại kết quả job sau lỗi")
+	fs.DurationVar(&hw.JobTimeout, "job-timeout", hw.JobTimeout, "Job chưa xong sau thời gian này tính là thất bại")
+	targetLang := fs.String("target-lang", "", "Ngôn ngữ đích gửi kèm upload (mặc định của API)")
+
+	// Tài nguyên của tiến trình benchmark: RSS, goroutine, profile CPU/heap cho `go tool pprof`
+	profile := fs.Bool("profile", false, "Đo peak RSS, số goroutine và bộ nhớ cấp phát trong lúc chạy")
+	cpuProfile := fs.String("cpuprofile", "", "Ghi profile CPU của lần chạy vào file này (bật -profile)")
+	memProfile := fs.String("memprofile", "", "Ghi profile heap sau lần chạy vào file này (bật -profile)")
+	fs.Parse(args)
+
+	var profiler *benchmark.Profiler
+	if *profile || *cpuProfile != "" || *memProfile != "" {
+		var err error
+		if profiler, err = benchmark.StartProfiler(*cpuProfile); err != nil {
+			log.Fatalf("BENCHMARK: %v", err)
+		}
+	}
+	stopProfiler := func() *benchmark.RuntimeStats {
+		if profiler == nil {
+			return nil
+		}
+		stats, err := profiler.Stop(*memProfile)
+		if err != nil {
+			log.Fatalf("BENCHMARK: %v", err)
+		}
+		benchmark.PrintRuntimeStats(os.Stdout, stats)
+		return &stats
+	}
+
+	switch *mode {
+	case "cache":
+		caches := openCaches(strings.Split(*backends, ","), *redisAddr)
+		if *sweep != "" {
+			levels, err := benchmark.ParseLevels(*sweep)
+			if err != nil {
+				log.Fatalf("BENCHMARK: %v", err)
+			}
+			sweeps := runCacheSweep(caches, w, levels)
+			writeJSON(*jsonOut, benchmark.CacheReport{Mode: "cache", Workload: w, Sweep: sweeps, Runtime: stopProfiler()})
+			break
+		}
+		results := runCacheMode(caches, w)
+		writeJSON(*jsonOut, benchmark.CacheReport{Mode: "cache", Workload: w, Results: results, Runtime: stopProfiler()})
+	case "http":
+		hw.Concurrency = w.Concurrency
+		if *targetLang != "" {
+			hw.Fields = map[string]string{"target_lang": *targetLang}
+		}
+		result := runHTTPMode(hw, *files)
+		writeJSON(*jsonOut, benchmark.HTTPReport{Mode: "http", Workload: hw, Result: result, Runtime: stopProfiler()})
+	case "accuracy":
+		report := runAccuracyMode(*sampleDir, *generate, strings.Split(*configs, ","), strings.Split(*langs, ","))
+		report.Runtime = stopProfiler()
+		writeJSON(*jsonOut, report)
+	default:
+		log.Fatalf("BENCHMARK: Unknown mode '%s'", *mode)
+	}
+}
+
+// --- Kết nối các backend cache cần so sánh (Redis chỉ khi có backend cần) ---
+func openCaches(names []string, redisAddr string) []cache.Cache {
+	var redisClient *redis.Client
+	var caches []cache.Cache
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != cache.BackendMemory && name != cache.BackendMemcached && name != cache.BackendDisk && redisClient == nil {
+			redisConfig, err := cache.RedisConfigFromEnv(redisAddr)
+			if err != nil {
+				log.Fatalf("BENCHMARK: Invalid Redis configuration: %v", err)
+			}
+			redisClient = cache.NewRedisClient(redisConfig)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err = cache.WaitForRedis(ctx, redisClient)
+			cancel()
+			if err != nil {
+				log.Fatalf("BENCHMARK: Could not connect to Redis at %s (needed by backend '%s'): %v", redisAddr, name, err)
+			}
+		}
+		c, err := cache.New(name, redisClient)
+		if err != nil {
+			log.Fatalf("BENCHMARK: %v", err)
+		}
+		caches = append(caches, c)
+	}
+	return caches
+}
+
+// --- So sánh các backend cache với cùng một workload ---
+func runCacheMode(caches []cache.Cache, w benchmark.CacheWorkload) []benchmark.CacheResult {
+	fmt.Printf("BENCHMARK: Cache workload: %d ops, concurrency %d, %d keys, read ratio %.2f, %d-byte values, skew %.2f\n",
+		w.Operations, w.Concurrency, w.Keys, w.ReadRatio, w.ValueBytes, w.Skew)
+	results := benchmark.RunCacheBenchmark(context.Background(), caches, w)
+	benchmark.PrintCacheResults(os.Stdout, results)
+	return results
+}
+
+// --- Cùng workload với từng mức concurrency: throughput/độ trễ theo mức và điểm gãy ---
+func runCacheSweep(caches []cache.Cache, w benchmark.CacheWorkload, levels []int) []benchmark.SweepResult {
+	fmt.Printf("BENCHMARK: Cache workload: %d ops, %d keys, read ratio %.2f, %d-byte values, skew %.2f, concurrency %v\n",
+		w.Operations, w.Keys, w.ReadRatio, w.ValueBytes, w.Skew, levels)
+	sweeps := benchmark.RunCacheSweep(context.Background(), caches, w, levels)
+	benchmark.PrintSweep(os.Stdout, sweeps)
+	return sweeps
+}
+
+// --- So sánh hai lần chạy: in thay đổi của từng chỉ số, exit code 1 nếu có regression ---
+// Dùng trong CI để chặn thay đổi làm chậm pipeline
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("benchmark compare", flag.ExitOnError)
+	threshold := fs.Float64("threshold", 10, "Ngưỡng regression (%): chỉ số xấu đi quá mức này làm lệnh thất bại")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: imgproc benchmark compare [-threshold percent] old.json new.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 || *threshold < 0 {
+		fs.Usage()
+		return 2
+	}
+	old, err := benchmark.LoadCacheReport(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "BENCHMARK: %v\n", err)
+		return 2
+	}
+	current, err := benchmark.LoadCacheReport(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "BENCHMARK: %v\n", err)
+		return 2
+	}
+	deltas, missing, err := benchmark.CompareCache(old, current, *threshold/100)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "BENCHMARK: %v\n", err)
+		return 2
+	}
+	return reportDeltas(deltas, missing, *threshold)
+}
+
+func reportDeltas(deltas []benchmark.Delta, missing []string, threshold float64) int {
+	benchmark.PrintDeltas(os.Stdout, deltas)
+	if len(missing) > 0 {
+		fmt.Printf("BENCHMARK: Backends present in only one run (not compared): %s\n", strings.Join(missing, ", "))
+	}
+	regressions := 0
+	for _, d := range deltas {
+		if d.Regression {
+			regressions++
+		}
+	}
+	if regressions > 0 {
+		fmt.Printf("BENCHMARK: %d metric(s) regressed by more than %.1f%%\n", regressions, threshold)
+		return 1
+	}
+	fmt.Printf("BENCHMARK: No regression beyond %.1f%%\n", threshold)
+	return 0
+}
+
+// --- Ghi kết quả JSON (để so sánh giữa các lần chạy) ---
+func writeJSON(path string, v interface{}) {
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatalf("BENCHMARK: Failed to encode results: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Fatalf("BENCHMARK: Failed to write %s: %v", path, err)
+	}
+	fmt.Printf("BENCHMARK: Results written to %s\n", path)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/jobapi"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// --- imgproc submit: upload file lên API (giống frontend), tùy chọn chờ kết quả ---
+func runSubmit(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	fields := map[string]*string{
+		"target_lang":   fs.String("target-lang", "", "Target language (ISO 639-1), default Vietnamese"),
+		"ocr_mode":      fs.String("ocr-mode", "", "printed or handwriting"),
+		"embed_image":   fs.String("embed-image", "", "Embed the source image: first_page or appendix"),
+		"frame_policy":  fs.String("frame-policy", "", "Frames of animated images: first, best or all"),
+		"glossary":      fs.String("glossary", "", "Name of a stored glossary"),
+		"regions":       fs.String("regions", "", "Regions to OCR, as a JSON array"),
+		"parent_job_id": fs.String("parent", "", "Job this job derives from (lineage)"),
+	}
+	dpi := fs.Int("dpi", 0, "OCR resolution, 0 infers it from the image")
+	wait := fs.Bool("wait", false, "Wait until the job is completed or failed")
+	out := fs.String("o", "", "With -wait: save the PDF to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: imgproc submit [flags] <file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *dpi != 0 {
+		fields["dpi"] = new(string)
+		*fields["dpi"] = strconv.Itoa(*dpi)
+	}
+
+	jobID, err := submitFile(cfg, fs.Arg(0), fields)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 1
+	}
+	fmt.Println(jobID)
+	if !*wait {
+		return 0
+	}
+
+	status, err := waitJob(cfg, jobID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 1
+	}
+	printJSON(status)
+	if status["status"] != model.StatusCompleted {
+		return 1
+	}
+	if *out != "" {
+		downloadURL, _ := status["download_url"].(string)
+		if err := downloadPDF(cfg, downloadURL, *out); err != nil {
+			fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "PDF saved to %s\n", *out)
+	}
+	return 0
+}
+
+// --- imgproc status: in trạng thái của job (JSON của GET /api/status/:job_id) ---
+func runStatus(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: imgproc status <job_id>")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	status, err := getStatus(cfg, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 1
+	}
+	printJSON(status)
+	return 0
+}
+
+func submitFile(cfg config.Config, path string, fields map[string]*string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	values := make(map[string]string, len(fields))
+	for name, value := range fields {
+		values[name] = *value
+	}
+	resp, err := postUpload(cfg, filepath.Base(path), f, values)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result map[string]any
+	if err := decodeResponse(resp, &result); err != nil {
+		return "", fmt.Errorf("upload failed: %w", err)
+	}
+	jobID, _ := result["job_id"].(string)
+	return jobID, nil
+}
+
+// postUpload gửi file (field "image") cùng các field khác rỗng lên POST /api/upload
+func postUpload(cfg config.Config, filename string, r io.Reader, fields map[string]string) (*http.Response, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		if value != "" {
+			form.WriteField(name, value)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+	return apiRequest(cfg, http.MethodPost, "/api/upload", form.FormDataContentType(), &body)
+}
+
+// Chờ job kết thúc bằng long polling GET /api/results/:job_id?wait=30s, rồi trả status
+func waitJob(cfg config.Config, jobID string) (map[string]any, error) {
+	for {
+		resp, err := apiRequest(cfg, http.MethodGet, "/api/results/"+url.PathEscape(jobID)+"?wait=30s", "", nil)
+		if err != nil {
+			return nil, err
+		}
+		var result map[string]any
+		err = decodeResponse(resp, &result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("result of job %s: %w", jobID, err)
+		}
+		if s := result["status"]; s == model.StatusCompleted || s == model.StatusFailed {
+			return getStatus(cfg, jobID)
+		}
+	}
+}
+
+func getStatus(cfg config.Config, jobID string) (map[string]any, error) {
+	resp, err := apiRequest(cfg, http.MethodGet, "/api/status/"+url.PathEscape(jobID), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var status map[string]any
+	if err := decodeResponse(resp, &status); err != nil {
+		return nil, fmt.Errorf("status of job %s: %w", jobID, err)
+	}
+	return status, nil
+}
+
+// downloadURL là link có chữ ký trong status (download_url).
+// PDF trên S3 được API chuyển hướng tới URL ký sẵn, http.Client tự đi theo
+func downloadPDF(cfg config.Config, downloadURL, path string) error {
+	if downloadURL == "" {
+		return fmt.Errorf("no download_url in the job status")
+	}
+	resp, err := apiRequest(cfg, http.MethodGet, downloadURL, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeResponse(resp, nil)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// apiRequest gửi request tới API, kèm API key của tenant (API_KEY) nếu có
+func apiRequest(cfg config.Config, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(cfg.APIURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", cfg.APIKey)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// decodeResponse đọc JSON của API; lỗi HTTP trả về *httpserver.Error (mã lỗi và message của API)
+func decodeResponse(resp *http.Response, v any) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr httpserver.ErrorResponse
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != nil {
+			return fmt.Errorf("%s: %w", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jobAPI gửi job và đọc kết quả qua HTTP API cho các connector
+// (jobapi.API của mailin, filedrop); lỗi không nên thử lại được bọc trong
+// jobapi.ErrRejected
+type jobAPI struct {
+	cfg config.Config
+}
+
+func (a jobAPI) Submit(ctx context.Context, filename string, data []byte, fields map[string]string) (string, error) {
+	resp, err := postUpload(a.cfg, filename, bytes.NewReader(data), fields)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result map[string]any
+	if err := a.decode(resp, &result); err != nil {
+		return "", err
+	}
+	jobID, _ := result["job_id"].(string)
+	return jobID, nil
+}
+
+func (a jobAPI) Status(ctx context.Context, jobID string) (string, string, error) {
+	status, err := a.status(jobID)
+	if err != nil {
+		return "", "", err
+	}
+	s, _ := status["status"].(string)
+	message, _ := status["error_message"].(string)
+	return s, message, nil
+}
+
+func (a jobAPI) PDF(ctx context.Context, jobID string) ([]byte, error) {
+	status, err := a.status(jobID)
+	if err != nil {
+		return nil, err
+	}
+	downloadURL, _ := status["download_url"].(string)
+	if downloadURL == "" {
+		return nil, fmt.Errorf("no download_url in the status of job %s", jobID)
+	}
+	resp, err := apiRequest(a.cfg, http.MethodGet, downloadURL, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.decode(resp, nil)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (a jobAPI) status(jobID string) (map[string]any, error) {
+	resp, err := apiRequest(a.cfg, http.MethodGet, "/api/status/"+url.PathEscape(jobID), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var status map[string]any
+	if err := a.decode(resp, &status); err != nil {
+		return nil, fmt.Errorf("status of job %s: %w", jobID, err)
+	}
+	return status, nil
+}
+
+// decode như decodeResponse; lỗi 4xx (trừ 429 hết quota/rate limit) không
+// thành công khi thử lại nên được bọc trong jobapi.ErrRejected
+func (a jobAPI) decode(resp *http.Response, v any) error {
+	err := decodeResponse(resp, v)
+	if err != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", jobapi.ErrRejected, err)
+	}
+	return err
+}
+
+func printJSON(v any) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(data))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/filedrop"
+)
+
+// --- imgproc filedrop: lấy ảnh/PDF từ thư mục SFTP/FTP, gửi lên API (API_KEY
+// của tenant) và đặt PDF vào thư mục kết quả, cho hệ thống cũ chỉ trao đổi file ---
+func runFiledrop(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("filedrop", flag.ExitOnError)
+	once := fs.Bool("once", false, "Poll once and exit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: imgproc filedrop [-once]")
+		fmt.Fprintln(fs.Output(), "Configured by FILEDROP_URL (sftp://user@host/incoming, ftp:// or ftps://), FILEDROP_RESULTS_PATH and the other FILEDROP_* variables")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	dropConfig, err := filedrop.ConfigFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 2
+	}
+	redisConfig, err := cache.RedisConfigFromEnv(cfg.RedisAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 2
+	}
+	client := cache.NewRedisClient(redisConfig)
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := cache.WaitForRedis(ctx, client); err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: redis: %v\n", err)
+		return 1
+	}
+	connector := filedrop.New(dropConfig, client, jobAPI{cfg: cfg})
+	if *once {
+		result, err := connector.Poll(ctx)
+		printJSON(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("FILEDROP: Polling %s://%s%s every %s\n", dropConfig.Scheme, dropConfig.Host, dropConfig.InputPath, dropConfig.Interval)
+	connector.Run(ctx, func(result filedrop.Result, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FILEDROP: %v\n", err)
+		}
+		if n := len(result.Submitted) + len(result.Rejected) + len(result.Delivered) + len(result.Failed); n > 0 {
+			fmt.Printf("FILEDROP: %d submitted, %d rejected, %d delivered, %d failed\n", len(result.Submitted), len(result.Rejected), len(result.Delivered), len(result.Failed))
+		}
+	})
+	fmt.Println("FILEDROP: Shut down complete.")
+	return 0
+}
@@ -0,0 +1,3 @@
+module github.com/mxngoc2104/KTPM-CS2/cmd/imgproc
+
+go 1.24.2
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/mailin"
+)
+
+// --- imgproc mailin: đọc hộp thư IMAP, gửi file đính kèm lên API (API_KEY
+// của tenant sở hữu hộp thư) và trả lời người gửi kèm PDF ---
+func runMailin(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("mailin", flag.ExitOnError)
+	once := fs.Bool("once", false, "Poll once and exit")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: imgproc mailin [-once]")
+		fmt.Fprintln(fs.Output(), "Configured by MAILIN_IMAP_ADDR, MAILIN_USERNAME, MAILIN_PASSWORD, MAILIN_SMTP_ADDR and the other MAILIN_* variables")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	mailConfig, err := mailin.ConfigFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 2
+	}
+	redisConfig, err := cache.RedisConfigFromEnv(cfg.RedisAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 2
+	}
+	client := cache.NewRedisClient(redisConfig)
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := cache.WaitForRedis(ctx, client); err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: redis: %v\n", err)
+		return 1
+	}
+	poller := mailin.New(mailConfig, client, jobAPI{cfg: cfg})
+	if *once {
+		result, err := poller.Poll(ctx)
+		printJSON(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("MAILIN: Polling %s every %s\n", mailConfig.IMAPAddr, mailConfig.Interval)
+	poller.Run(ctx, func(result mailin.Result, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "MAILIN: %v\n", err)
+		}
+		if len(result.Received)+len(result.Ignored)+len(result.Replied) > 0 {
+			fmt.Printf("MAILIN: %d received, %d ignored, %d replied\n", len(result.Received), len(result.Ignored), len(result.Replied))
+		}
+	})
+	fmt.Println("MAILIN: Shut down complete.")
+	return 0
+}
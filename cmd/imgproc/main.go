@@ -0,0 +1,86 @@
+// Command imgproc là binary duy nhất của hệ thống: API server, worker,
+// benchmark, client dòng lệnh và chế độ xử lý cục bộ, dùng chung cấu hình
+// (pkg/config).
+//
+//	imgproc [-redis addr] [-kafka brokers] [-topic name] [-output dir] [-api url] <lệnh> [tham số]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mxngoc2104/KTPM-CS2/api"
+	"github.com/mxngoc2104/KTPM-CS2/benchmark"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/worker"
+)
+
+const usage = `Usage: imgproc [flags] <command> [arguments]
+
+Commands:
+  serve              Start the API server
+  worker             Start a worker (WORKER_MODE=controller: Kubernetes controller)
+  benchmark          Run a benchmark (imgproc benchmark -h for its flags)
+  benchmark compare old.json new.json
+                     Compare two benchmark result files, exit code 1 on regression
+  submit <file>      Upload an image or PDF to the API and print the job ID
+  status <job_id>    Print the status of a job
+  process <image>    Run the worker pipeline on an image locally, without Redis, Kafka or API
+  mailin             Translate the attachments emailed to an IMAP mailbox and reply with the PDFs
+  filedrop           Translate the files dropped in an SFTP/FTP directory and upload the PDFs next to them
+  ocr-server         Serve OCR requests on stdin/stdout for OCR_ENGINE=pool (OCR_POOL_COMMAND)
+
+Flags (also read from REDIS_ADDR, KAFKA_BROKERS, KAFKA_TOPIC, OUTPUT_DIR, API_URL):
+`
+
+func main() {
+	cfg := config.FromEnv()
+	global := flag.NewFlagSet("imgproc", flag.ExitOnError)
+	cfg.RegisterFlags(global)
+	global.Usage = func() {
+		fmt.Fprint(global.Output(), usage)
+		global.PrintDefaults()
+	}
+	global.Parse(os.Args[1:])
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		fs := flag.NewFlagSet("serve", flag.ExitOnError)
+		fs.StringVar(&cfg.ListenAddr, "listen", cfg.ListenAddr, "Listen address of the API server (LISTEN_ADDR)")
+		fs.Parse(args)
+		api.Serve(cfg)
+	case "worker":
+		fs := flag.NewFlagSet("worker", flag.ExitOnError)
+		fs.StringVar(&cfg.KafkaGroupID, "group", cfg.KafkaGroupID, "Kafka consumer group (KAFKA_GROUP_ID)")
+		fs.Parse(args)
+		worker.Run(cfg)
+	case "benchmark":
+		benchmark.Run(cfg, args)
+	case "submit":
+		os.Exit(runSubmit(cfg, args))
+	case "status":
+		os.Exit(runStatus(cfg, args))
+	case "process":
+		os.Exit(runProcess(cfg, args))
+	case "mailin":
+		os.Exit(runMailin(cfg, args))
+	case "filedrop":
+		os.Exit(runFiledrop(cfg, args))
+	case "ocr-server":
+		os.Exit(runOCRServer(cfg, args))
+	case "help", "-h", "--help":
+		global.SetOutput(os.Stdout)
+		global.Usage()
+	default:
+		fmt.Fprintf(os.Stderr, "imgproc: unknown command %q\n\n", command)
+		global.Usage()
+		os.Exit(2)
+	}
+}
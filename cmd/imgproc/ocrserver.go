@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+)
+
+// --- imgproc ocr-server: OCR server của OCR_ENGINE=pool
+// (OCR_POOL_COMMAND="imgproc ocr-server"), đọc request JSON từng dòng trên
+// stdin và trả lời trên stdout; stdout chỉ dành cho giao thức, log ra stderr ---
+// Server vẫn chạy lệnh tesseract cho mỗi ảnh (không có binding libtesseract như
+// gosseract trong build), nên không nhanh hơn engine mặc định: dùng để kiểm tra
+// cấu hình pool, hoặc làm mẫu cho server giữ engine trong tiến trình
+func runOCRServer(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("ocr-server", flag.ExitOnError)
+	languages := fs.String("languages", "", "Traineddata of the requests without languages, e.g. eng+fra (default eng)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: imgproc ocr-server [-languages eng+fra]")
+		fmt.Fprintln(fs.Output(), "Started by the worker with OCR_ENGINE=pool and OCR_POOL_COMMAND=\"imgproc ocr-server\"; runs the local tesseract for each image, so it does not keep traineddata loaded")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	engine := &ocr.TesseractEngine{}
+	if *languages != "" {
+		engine.Languages = strings.Split(*languages, "+")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := ocr.ServePool(ctx, engine, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: ocr-server: %v\n", err)
+		return 1
+	}
+	return 0
+}
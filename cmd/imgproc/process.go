@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+	"github.com/mxngoc2104/KTPM-CS2/worker"
+)
+
+// --- imgproc process: chạy pipeline của worker (filter → OCR → làm sạch → dịch → PDF) ngay
+// trong tiến trình, không cần Redis, Kafka hay API (dùng như công cụ độc lập, trong script) ---
+func runProcess(cfg config.Config, args []string) int {
+	fs := flag.NewFlagSet("process", flag.ExitOnError)
+	out := fs.String("o", "", "Output PDF (default: the input name with .pdf)")
+	targetLang := fs.String("target-lang", translator.DefaultTargetLanguage, "Target language (ISO 639-1)")
+	framePolicy := fs.String("frame-policy", "", "Frames of animated images: first, best or all")
+	embedImage := fs.String("embed-image", "", "Embed the source image: first_page or appendix")
+	dpi := fs.Int("dpi", 0, "OCR resolution, 0 infers it from the image")
+	detect, _ := strconv.ParseBool(os.Getenv("OCR_LANGUAGE_DETECTION"))
+	fs.BoolVar(&detect, "detect-lang", detect, "Detect the language of the text before OCR (OCR_LANGUAGE_DETECTION)")
+	text := fs.Bool("text", false, "Also print the translated text")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: imgproc process [flags] <image>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	input := fs.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(input, filepath.Ext(input)) + ".pdf"
+	}
+	if !pdf.ValidImagePlacement(*embedImage) {
+		fmt.Fprintf(os.Stderr, "imgproc: invalid -embed-image %q\n", *embedImage)
+		return 2
+	}
+
+	start := time.Now()
+	opts := worker.LocalOptions{
+		TargetLang:     *targetLang,
+		FramePolicy:    *framePolicy,
+		EmbedImage:     *embedImage,
+		DPI:            *dpi,
+		DetectLanguage: detect,
+	}
+	result, err := worker.ProcessLocal(cfg, input, *out, opts, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imgproc: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Processed in %s (stages: %s)\n", time.Since(start).Round(time.Millisecond), result.Details["pipeline_stages"])
+	if *text {
+		fmt.Println(strings.ReplaceAll(result.TranslatedText, pdf.PageBreak, "\n\n"))
+	}
+	fmt.Fprintf(os.Stderr, "PDF saved to %s\n", *out)
+	return 0
+}
@@ -1,10 +1,13 @@
-import { useState, useEffect, useCallback } from 'react';
+import { useState, useEffect, useCallback, useRef } from 'react';
 import type { ChangeEvent } from 'react';
 import axios, { AxiosError } from 'axios';
 import './App.css'; // Bạn có thể thêm CSS để giao diện đẹp hơn
 
 // Cấu hình URL của API backend
 const API_BASE_URL = 'http://localhost:8080/api'; // Chạy API Go trên cổng 8080
+// Endpoint WebSocket: upload ảnh và nhận tiến trình trên cùng kết nối (không cần polling)
+const WS_URL = new URL('/ws', API_BASE_URL.replace(/^http/, 'ws')).toString();
+const WS_CHUNK_BYTES = 64 * 1024; // Kích thước mỗi frame nhị phân khi gửi ảnh
 
 // Định nghĩa kiểu dữ liệu cho trạng thái Job (có thể mở rộng)
 type JobStatus = 'queued' | 'processing' | 'completed' | 'failed' | 'upload_failed' | 'status_error' | 'Uploading...' | null;
@@ -14,6 +17,7 @@ interface StatusResponse {
   job_id: string;
   status: JobStatus;
   pdf_path?: string;
+  download_url?: string; // Link tải có chữ ký, hết hạn sau một thời gian
   error_message?: string;
   cached?: boolean; // Thêm trạng thái cache
   filter_ms?: string; // Thời gian dạng string (từ Redis)
@@ -22,15 +26,24 @@ interface StatusResponse {
   pdf_ms?: string;
 }
 
-// Định nghĩa kiểu dữ liệu cho response từ API upload
-interface UploadResponse {
-    job_id: string;
-    message: string;
+// Message server gửi qua /ws: queued -> progress... -> result hoặc error
+interface WsMessage {
+    type: 'queued' | 'progress' | 'result' | 'error';
+    job_id?: string;
+    status?: JobStatus;
+    stage?: string; // filter, ocr, extract, translate, pdf
+    error_message?: string;
+    error?: ApiError['error'];
 }
 
-// Định nghĩa kiểu dữ liệu cho lỗi API (ví dụ)
+// Định nghĩa kiểu dữ liệu cho lỗi API: {"error": {code, message, details, request_id}}
 interface ApiError {
-    error: string;
+    error: {
+        code: string; // Mã ổn định, ví dụ JOB_NOT_FOUND, QUEUE_UNAVAILABLE
+        message: string;
+        details?: Record<string, unknown>;
+        request_id?: string;
+    };
 }
 
 function App() {
@@ -42,6 +55,8 @@ function App() {
   const [isUploading, setIsUploading] = useState<boolean>(false);
   const [isCheckingStatus, setIsCheckingStatus] = useState<boolean>(false);
   const [pollingIntervalId, setPollingIntervalId] = useState<number | null>(null);
+  const [stage, setStage] = useState<string | null>(null); // Bước worker đang chạy
+  const socketRef = useRef<WebSocket | null>(null);
   // --- Thêm state cho thông tin chi tiết ---
   const [isCached, setIsCached] = useState<boolean | null>(null);
   const [filterMs, setFilterMs] = useState<string | null>(null);
@@ -63,51 +78,91 @@ function App() {
       setOcrMs(null);
       setTranslateMs(null);
       setPdfMs(null);
+      setStage(null);
       stopPolling();
+      closeSocket();
     }
   };
 
+  // Upload qua WebSocket: gửi message start rồi nội dung ảnh, nhận tiến trình và kết quả
+  // Kết nối bị đóng trước khi có kết quả -> quay lại polling /api/status
   const handleUpload = async () => {
     if (!selectedFile) {
       setErrorMessage('Please select an image file first.');
       return;
     }
 
-    const formData = new FormData();
-    formData.append('image', selectedFile); // Tên field 'image' phải khớp với backend Gin
-
     setIsUploading(true);
     setErrorMessage('');
     setJobStatus('Uploading...');
+    setStage(null);
+    closeSocket();
 
-    try {
-      const response = await axios.post<UploadResponse>(`${API_BASE_URL}/upload`, formData, {
-        headers: {
-          'Content-Type': 'multipart/form-data',
-        },
-      });
-      const newJobId = response.data.job_id;
-      setJobId(newJobId);
-      setJobStatus('queued'); // Trạng thái ban đầu sau khi upload thành công
-      console.log('Upload successful, Job ID:', newJobId);
-      startPolling(newJobId); // Bắt đầu kiểm tra status tự động
-    } catch (error) {
-      console.error('Upload failed:', error);
-      let errorMsg = 'Upload failed. Please check the console.';
-      if (axios.isAxiosError(error)) { // Kiểm tra nếu là AxiosError
-           const axiosError = error as AxiosError<ApiError>; // Ép kiểu sang AxiosError với kiểu dữ liệu lỗi dự kiến
-           if(axiosError.response?.data?.error){
-               errorMsg = axiosError.response.data.error;
-           } else {
-               errorMsg = axiosError.message;
-           }
-      } else if (error instanceof Error) {
-           errorMsg = error.message;
+    let currentJobId: string | null = null;
+    let finished = false;
+    const socket = new WebSocket(WS_URL);
+    socket.binaryType = 'arraybuffer';
+    socketRef.current = socket;
+
+    socket.onopen = async () => {
+      socket.send(JSON.stringify({ type: 'start', filename: selectedFile.name, size: selectedFile.size, options: {} }));
+      const data = await selectedFile.arrayBuffer();
+      for (let offset = 0; offset < data.byteLength; offset += WS_CHUNK_BYTES) {
+        socket.send(data.slice(offset, offset + WS_CHUNK_BYTES));
+      }
+    };
+
+    socket.onmessage = (event: MessageEvent<string>) => {
+      const message = JSON.parse(event.data) as WsMessage;
+      switch (message.type) {
+        case 'queued':
+          currentJobId = message.job_id ?? null;
+          setJobId(currentJobId);
+          setJobStatus('queued');
+          setIsUploading(false);
+          console.log('Upload successful, Job ID:', currentJobId);
+          break;
+        case 'progress':
+          setJobStatus(message.status ?? null);
+          setStage(message.stage ?? null);
+          break;
+        case 'result':
+          finished = true;
+          setStage(null);
+          // Lấy thời gian từng bước và trạng thái cache từ status (một lần)
+          checkStatus(message.job_id ?? currentJobId);
+          break;
+        case 'error':
+          finished = true;
+          setErrorMessage(message.error?.message ?? 'Processing failed.');
+          setJobStatus(currentJobId ? 'status_error' : 'upload_failed');
+          setIsUploading(false);
+          break;
+      }
+    };
+
+    socket.onclose = () => {
+      if (socketRef.current === socket) {
+        socketRef.current = null;
       }
-      setErrorMessage(errorMsg);
-      setJobStatus('upload_failed');
-    } finally {
       setIsUploading(false);
+      if (finished) {
+        return;
+      }
+      if (currentJobId) {
+        startPolling(currentJobId);
+      } else {
+        setErrorMessage('Upload failed: connection to the server was lost.');
+        setJobStatus('upload_failed');
+      }
+    };
+  };
+
+  const closeSocket = () => {
+    if (socketRef.current) {
+      socketRef.current.onclose = null;
+      socketRef.current.close();
+      socketRef.current = null;
     }
   };
 
@@ -161,12 +216,12 @@ function App() {
 
       if (axios.isAxiosError(error)) {
            const axiosError = error as AxiosError<ApiError>;
-           if(axiosError.response?.data?.error){
-               errorMsg = axiosError.response.data.error;
+           if(axiosError.response?.data?.error?.message){
+               errorMsg = axiosError.response.data.error.message;
            } else {
                errorMsg = axiosError.message;
            }
-           if (axiosError.response?.status === 404) {
+           if (axiosError.response?.data?.error?.code === 'JOB_NOT_FOUND') {
                errorMsg = `Job ${currentJobId} not found.`;
                shouldStopPolling = true; // Dừng polling nếu job không tồn tại
                statusOnError = 'status_error';
@@ -222,13 +277,22 @@ function App() {
   useEffect(() => {
     return () => {
       stopPolling();
+      closeSocket();
     };
   }, []); // Chạy một lần khi mount
 
-  const handleDownload = () => {
+  const handleDownload = async () => {
     if (jobId) {
-        // Mở URL download trong tab mới
-        window.open(`${API_BASE_URL}/download/${jobId}`, '_blank');
+        // Link tải có thời hạn: hỏi lại status để lấy link mới rồi mở
+        try {
+            const response = await axios.get<StatusResponse>(`${API_BASE_URL}/status/${jobId}`);
+            if (response.data.download_url) {
+                window.location.href = new URL(response.data.download_url, API_BASE_URL).toString();
+            }
+        } catch (error) {
+            console.error('Error getting download link:', error);
+            setErrorMessage('Failed to get download link');
+        }
     }
   };
 
@@ -248,6 +312,7 @@ function App() {
           <h2>Processing Status</h2>
           <p>Job ID: {jobId}</p>
           <p>Status: <strong>{jobStatus || 'N/A'}</strong> {isCheckingStatus && jobStatus !== 'completed' && jobStatus !== 'failed' && '(checking...)'}</p>
+          {jobStatus === 'processing' && stage && <p>Stage: {stage}</p>}
           
           {/* --- Hiển thị thông tin chi tiết khi hoàn thành --- */} 
           {jobStatus === 'completed' && (
@@ -0,0 +1,181 @@
+// Package antivirus scans uploaded files with ClamAV through the clamd
+// daemon, streaming the file over its socket (INSTREAM command) so clamd does
+// not need access to the upload directory.
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStreamTooLarge is returned when the file exceeds StreamMaxLength of clamd
+var ErrStreamTooLarge = errors.New("file exceeds the clamd stream size limit")
+
+// Result is the verdict of a scan
+type Result struct {
+	Infected  bool
+	Signature string        // Name of the detected malware, e.g. "Win.Test.EICAR_HDB-1"
+	Duration  time.Duration // Time spent scanning
+}
+
+// Clamd is a client of a clamd daemon
+type Clamd struct {
+	Network   string        // "unix" or "tcp"
+	Address   string        // Socket path or host:port
+	Timeout   time.Duration // Per scan, default 30s
+	ChunkSize int           // Bytes per INSTREAM chunk, default 64 KiB
+}
+
+// ConfigFromEnv reads CLAMD_ADDRESS ("unix:/run/clamav/clamd.ctl" or
+// "tcp:localhost:3310") and CLAMD_TIMEOUT. It returns nil when CLAMD_ADDRESS
+// is not set, which disables scanning.
+func ConfigFromEnv() (*Clamd, error) {
+	address := os.Getenv("CLAMD_ADDRESS")
+	if address == "" {
+		return nil, nil
+	}
+	network, addr, ok := strings.Cut(address, ":")
+	if !ok || (network != "unix" && network != "tcp") || addr == "" {
+		return nil, fmt.Errorf("CLAMD_ADDRESS must be unix:/path/to/clamd.ctl or tcp:host:port, got %q", address)
+	}
+	c := &Clamd{Network: network, Address: addr}
+	if v := os.Getenv("CLAMD_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("CLAMD_TIMEOUT must be a positive duration such as 30s, got %q", v)
+		}
+		c.Timeout = d
+	}
+	return c, nil
+}
+
+// String describes the daemon for logs
+func (c *Clamd) String() string { return c.Network + ":" + c.Address }
+
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd at %s: %w", c, err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// Ping checks that clamd answers (PING command)
+func (c *Clamd) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	if reply = strings.TrimSuffix(reply, "\x00"); reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// ScanFile streams the file to clamd and returns its verdict
+func (c *Clamd) ScanFile(ctx context.Context, path string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	return c.Scan(ctx, f)
+}
+
+// Scan streams r to clamd and returns its verdict
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	start := time.Now()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, fmt.Errorf("failed to send INSTREAM to clamd: %w", err)
+	}
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 64 * 1024
+	}
+	// Each chunk is prefixed with its length (4 bytes, big endian), a zero length ends the stream
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				// clamd closes the connection when the stream exceeds StreamMaxLength
+				return Result{}, c.readError(conn, werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to read the file to scan: %w", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, c.readError(conn, err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	result, err := parseReply(strings.TrimSuffix(reply, "\x00"))
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+// readError returns the error reply of clamd after a failed write, if any
+func (c *Clamd) readError(conn net.Conn, writeErr error) error {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return fmt.Errorf("failed to stream the file to clamd: %w", writeErr)
+	}
+	_, err = parseReply(strings.TrimSuffix(reply, "\x00"))
+	return err
+}
+
+// parseReply decodes "stream: OK", "stream: <signature> FOUND" and
+// "<message> ERROR"
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(reply)
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return Result{Infected: true, Signature: signature}, nil
+	case reply == "stream: OK":
+		return Result{}, nil
+	case strings.Contains(reply, "size limit exceeded"):
+		return Result{}, ErrStreamTooLarge
+	default:
+		return Result{}, fmt.Errorf("clamd error: %s", strconv.Quote(reply))
+	}
+}
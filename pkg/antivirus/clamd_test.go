@@ -0,0 +1,145 @@
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		err       error
+	}{
+		{"stream: OK", false, "", nil},
+		{"stream: OK\n", false, "", nil},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND", true, "Win.Test.EICAR_HDB-1", nil},
+		{"INSTREAM size limit exceeded. ERROR", false, "", ErrStreamTooLarge},
+	}
+	for _, tt := range tests {
+		result, err := parseReply(tt.reply)
+		if err != tt.err || result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("parseReply(%q) = %+v, %v", tt.reply, result, err)
+		}
+	}
+	if _, err := parseReply("Can't allocate memory ERROR"); err == nil || errors.Is(err, ErrStreamTooLarge) {
+		t.Errorf("clamd error: %v", err)
+	}
+}
+
+// fakeClamd answers PING and INSTREAM like clamd and rejects streams longer
+// than maxLength (StreamMaxLength)
+type fakeClamd struct {
+	maxLength int
+	mu        sync.Mutex
+	received  []byte
+}
+
+func (f *fakeClamd) start(t *testing.T) *Clamd {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return &Clamd{Network: "tcp", Address: ln.Addr().String(), Timeout: 5 * time.Second, ChunkSize: 4}
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	if command == "zPING\x00" {
+		conn.Write([]byte("PONG\x00"))
+		return
+	}
+	var data []byte
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		if data = append(data, chunk...); len(data) > f.maxLength {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			io.Copy(io.Discard, r) // Drain the stream so the client reads the error instead of a reset
+			return
+		}
+	}
+	f.mu.Lock()
+	f.received = data
+	f.mu.Unlock()
+	reply := "stream: OK"
+	if strings.Contains(string(data), "EICAR") {
+		reply = "stream: Win.Test.EICAR_HDB-1 FOUND"
+	}
+	conn.Write([]byte(reply + "\x00"))
+}
+
+func TestClamdScan(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeClamd{maxLength: 64}
+	clamd := fake.start(t)
+
+	if err := clamd.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	result, err := clamd.Scan(ctx, strings.NewReader("hello, clamd"))
+	if err != nil || result.Infected {
+		t.Fatalf("clean file: %+v, %v", result, err)
+	}
+	// ChunkSize 4: the file arrives as several length-prefixed chunks
+	if fake.mu.Lock(); string(fake.received) != "hello, clamd" {
+		t.Errorf("clamd received %q", fake.received)
+	}
+	fake.mu.Unlock()
+
+	result, err = clamd.Scan(ctx, strings.NewReader("X5O!P%@AP EICAR-STANDARD-ANTIVIRUS-TEST-FILE"))
+	if err != nil || !result.Infected || result.Signature != "Win.Test.EICAR_HDB-1" {
+		t.Errorf("infected file: %+v, %v", result, err)
+	}
+
+	if _, err := clamd.Scan(ctx, strings.NewReader(strings.Repeat("a", 100))); !errors.Is(err, ErrStreamTooLarge) {
+		t.Errorf("file over StreamMaxLength: %v, want ErrStreamTooLarge", err)
+	}
+}
+
+func TestClamdUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clamd := &Clamd{Network: "tcp", Address: ln.Addr().String(), Timeout: time.Second}
+	ln.Close()
+	if _, err := clamd.Scan(context.Background(), strings.NewReader("x")); err == nil || errors.Is(err, ErrStreamTooLarge) {
+		t.Errorf("unreachable clamd: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+// Package archive exports finished jobs (status record, texts and PDF) to
+// long-term storage before their Redis keys expire, so the job history is not
+// lost after the job TTL.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/periodic"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// Config of the archiver
+type Config struct {
+	// After is the age of a finished job before it is archived. It must be
+	// shorter than the job TTL, with a margin of a few scan intervals.
+	After    time.Duration
+	Interval time.Duration // Between two scans
+}
+
+// DefaultConfig archives jobs 20 hours after they finished (job TTL: 24 hours)
+func DefaultConfig() Config {
+	return Config{After: 20 * time.Hour, Interval: 10 * time.Minute}
+}
+
+// ConfigFromEnv reads ARCHIVE_AFTER and ARCHIVE_INTERVAL. ARCHIVE_AFTER=off
+// disables archiving (enabled is false).
+func ConfigFromEnv() (config Config, enabled bool, err error) {
+	config = DefaultConfig()
+	if os.Getenv("ARCHIVE_AFTER") == "off" {
+		return config, false, nil
+	}
+	for _, v := range []struct {
+		name  string
+		value *time.Duration
+	}{{"ARCHIVE_AFTER", &config.After}, {"ARCHIVE_INTERVAL", &config.Interval}} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return config, false, fmt.Errorf("%s must be a positive duration such as 20h, got %q", v.name, raw)
+		}
+		*v.value = d
+	}
+	return config, true, nil
+}
+
+// StorageFromEnv returns where jobs are archived: the directory ARCHIVE_DIR,
+// the S3 bucket ARCHIVE_S3_BUCKET (same region, endpoint and credentials as
+// the artifact storage), or by default the artifact storage itself
+func StorageFromEnv(artifacts storage.Storage) (storage.Storage, error) {
+	if dir := os.Getenv("ARCHIVE_DIR"); dir != "" {
+		return storage.NewFileStorage(dir), nil
+	}
+	if bucket := os.Getenv("ARCHIVE_S3_BUCKET"); bucket != "" {
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		return storage.NewS3Storage(storage.S3Config{
+			Bucket:       bucket,
+			Region:       region,
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		})
+	}
+	return artifacts, nil
+}
+
+// Keys of an archived job in the archive storage, under the directory of its
+// tenant (see model.TenantJobID)
+func RecordKey(jobID string) string { return "archive/jobs/" + tenantDir(jobID) + jobID + ".json" }
+func PDFKey(jobID string) string    { return "archive/pdfs/" + tenantDir(jobID) + jobID + ".pdf" }
+
+func tenantDir(jobID string) string {
+	if tenant := model.TenantOf(jobID); tenant != "" {
+		return tenant + "/"
+	}
+	return ""
+}
+
+// Record is an archived job
+type Record struct {
+	JobID          string            `json:"job_id"`
+	Status         string            `json:"status"`
+	Error          string            `json:"error,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
+	OCRText        string            `json:"ocr_text,omitempty"`
+	TranslatedText string            `json:"translated_text,omitempty"`
+	// PDFKey is the key of the archived PDF, empty for a failed job or when
+	// the PDF was already gone
+	PDFKey     string    `json:"pdf_key,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// IndexEntry lists an archived job in the index
+type IndexEntry struct {
+	JobID      string    `json:"job_id"`
+	Status     string    `json:"status"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Load returns the archived job, or storage.ErrNotFound
+func Load(ctx context.Context, archive storage.Storage, jobID string) (*Record, error) {
+	r, err := archive.Open(ctx, RecordKey(jobID))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var record Record
+	if err := json.NewDecoder(r).Decode(&record); err != nil {
+		return nil, fmt.Errorf("invalid archive record of job %s: %w", jobID, err)
+	}
+	return &record, nil
+}
+
+// Result lists the jobs handled by one scan
+type Result struct {
+	Archived []string `json:"archived"`
+	Skipped  []string `json:"skipped"` // Expired before being archived
+	IndexKey string   `json:"index_key,omitempty"`
+}
+
+// Archiver scans model.FinishedKey for jobs older than Config.After
+type Archiver struct {
+	client    *redis.Client
+	store     *model.Store
+	artifacts storage.Storage // Where the PDFs of the jobs are
+	archive   storage.Storage
+	config    Config
+}
+
+// New creates an archiver copying jobs from Redis and artifacts to archive
+func New(client *redis.Client, artifacts, archive storage.Storage, config Config) *Archiver {
+	return &Archiver{
+		client:    client,
+		store:     model.NewStore(client, 0),
+		artifacts: artifacts,
+		archive:   archive,
+		config:    config,
+	}
+}
+
+// Run scans every Interval until ctx is done. Each scan is passed to report
+// (nil: ignored) with its error.
+func (a *Archiver) Run(ctx context.Context, report func(Result, error)) {
+	periodic.RunDelayed(ctx, a.config.Interval, a.Scan, report)
+}
+
+// Scan archives the jobs that finished before Config.After and writes an
+// index object listing them (archive/index/<date>/<time>.json). A replica
+// archives the jobs it took out of model.FinishedKey (ZREM returned 1) and
+// lists them in an index object of its own, so replicas scanning at the same
+// time neither copy a job twice nor overwrite each other's index.
+func (a *Archiver) Scan(ctx context.Context) (Result, error) {
+	var result Result
+	cutoff := time.Now().Add(-a.config.After).Unix()
+	finished, err := a.client.ZRangeByScoreWithScores(ctx, model.FinishedKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff, 10),
+	}).Result()
+	if err != nil {
+		return result, err
+	}
+	var index []IndexEntry
+	var scanErr error
+	for _, z := range finished {
+		jobID, _ := z.Member.(string)
+		claimed, err := a.client.ZRem(ctx, model.FinishedKey, jobID).Result()
+		if err != nil {
+			scanErr = err
+			break
+		}
+		if claimed == 0 {
+			continue // Handled by another replica
+		}
+		record, err := a.archiveJob(ctx, jobID, time.Unix(int64(z.Score), 0).UTC())
+		if err == model.ErrNotFound {
+			result.Skipped = append(result.Skipped, jobID)
+			continue
+		}
+		if err != nil {
+			// Put the job back to retry on the next scan
+			a.client.ZAdd(ctx, model.FinishedKey, &redis.Z{Score: z.Score, Member: jobID})
+			scanErr = fmt.Errorf("failed to archive job %s: %w", jobID, err)
+			break
+		}
+		result.Archived = append(result.Archived, jobID)
+		index = append(index, IndexEntry{JobID: jobID, Status: record.Status, FinishedAt: record.FinishedAt})
+	}
+	if len(index) > 0 {
+		key, err := a.writeIndex(ctx, index)
+		result.IndexKey = key
+		if scanErr == nil {
+			scanErr = err
+		}
+	}
+	return result, scanErr
+}
+
+func (a *Archiver) archiveJob(ctx context.Context, jobID string, finishedAt time.Time) (*Record, error) {
+	job, err := a.store.Load(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	record := &Record{
+		JobID:      jobID,
+		Status:     job.Status,
+		Error:      job.Error,
+		Details:    job.Details,
+		FinishedAt: finishedAt,
+	}
+	texts, err := a.client.MGet(ctx, jobID+":ocr_text", jobID+":translated_text").Result()
+	if err != nil {
+		return nil, err
+	}
+	record.OCRText, _ = texts[0].(string)
+	record.TranslatedText, _ = texts[1].(string)
+
+	if job.Status == model.StatusCompleted && job.PDFPath != "" {
+		// A cache hit points to the PDF of an earlier job: the archive keeps its own copy
+		switch err := a.copyObject(ctx, job.PDFPath, PDFKey(jobID)); err {
+		case nil:
+			record.PDFKey = PDFKey(jobID)
+		case storage.ErrNotFound:
+		default:
+			return nil, err
+		}
+	}
+
+	record.ArchivedAt = time.Now().UTC()
+	return record, a.writeJSON(ctx, RecordKey(jobID), record)
+}
+
+func (a *Archiver) copyObject(ctx context.Context, srcKey, dstKey string) error {
+	src, err := a.artifacts.Open(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := a.archive.Create(ctx, dstKey)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Abort()
+		return err
+	}
+	return dst.Close()
+}
+
+func (a *Archiver) writeIndex(ctx context.Context, entries []IndexEntry) (string, error) {
+	now := time.Now().UTC()
+	// The time with nanoseconds keeps the keys of concurrent replicas apart
+	key := "archive/index/" + now.Format("2006-01-02") + "/" + strings.ReplaceAll(now.Format("150405.000000000"), ".", "-") + ".json"
+	return key, a.writeJSON(ctx, key, entries)
+}
+
+func (a *Archiver) writeJSON(ctx context.Context, key string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := a.archive.Create(ctx, key)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
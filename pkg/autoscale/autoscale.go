@@ -0,0 +1,143 @@
+// Package autoscale sizes the workers by the depth of the job queue: each
+// worker adjusts the number of jobs it processes at the same time within
+// bounds, and publishes the number of worker replicas the backlog calls for,
+// which an external autoscaler (Kubernetes HPA through an external metric,
+// KEDA metrics-api or Redis scaler) applies.
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// HintKey holds the last Hint as JSON. It expires after three intervals
+// without a worker to publish it.
+const HintKey = "autoscale:hint"
+
+// Config bounds the concurrency of a worker and the replica count
+type Config struct {
+	MinConcurrency int // Jobs processed at the same time when the queue is empty
+	MaxConcurrency int // Upper bound of the jobs processed at the same time
+	// TargetBacklog is the number of queued or running jobs a processing slot
+	// is expected to absorb: the backlog is divided by it to get the slots
+	// needed
+	TargetBacklog int
+	MinReplicas   int // Lower bound of DesiredReplicas
+	MaxReplicas   int // Upper bound of DesiredReplicas, 0: unbounded
+	// Interval between two reads of the queue depth
+	Interval time.Duration
+}
+
+// DefaultConfig is the config without bounds set: one job at a time, one
+// slot per two jobs of backlog
+func DefaultConfig() Config {
+	return Config{MinConcurrency: 1, MaxConcurrency: 1, TargetBacklog: 2, MinReplicas: 1, Interval: 15 * time.Second}
+}
+
+// ConfigFromEnv reads WORKER_MIN_CONCURRENCY, WORKER_MAX_CONCURRENCY,
+// AUTOSCALE_TARGET_BACKLOG, AUTOSCALE_MIN_REPLICAS, AUTOSCALE_MAX_REPLICAS
+// and AUTOSCALE_INTERVAL. Autoscaling is enabled when
+// WORKER_MAX_CONCURRENCY is set.
+func ConfigFromEnv() (Config, bool, error) {
+	c := DefaultConfig()
+	raw := os.Getenv("WORKER_MAX_CONCURRENCY")
+	if raw == "" {
+		return c, false, nil
+	}
+	ints := []struct {
+		name  string
+		value *int
+		min   int
+	}{
+		{"WORKER_MIN_CONCURRENCY", &c.MinConcurrency, 1},
+		{"WORKER_MAX_CONCURRENCY", &c.MaxConcurrency, 1},
+		{"AUTOSCALE_TARGET_BACKLOG", &c.TargetBacklog, 1},
+		{"AUTOSCALE_MIN_REPLICAS", &c.MinReplicas, 0},
+		{"AUTOSCALE_MAX_REPLICAS", &c.MaxReplicas, 0},
+	}
+	for _, v := range ints {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < v.min {
+			return c, false, fmt.Errorf("%s must be an integer of at least %d, got %q", v.name, v.min, raw)
+		}
+		*v.value = n
+	}
+	if c.MinConcurrency > c.MaxConcurrency {
+		return c, false, fmt.Errorf("WORKER_MIN_CONCURRENCY (%d) is larger than WORKER_MAX_CONCURRENCY (%d)", c.MinConcurrency, c.MaxConcurrency)
+	}
+	if c.MaxReplicas > 0 && c.MinReplicas > c.MaxReplicas {
+		return c, false, fmt.Errorf("AUTOSCALE_MIN_REPLICAS (%d) is larger than AUTOSCALE_MAX_REPLICAS (%d)", c.MinReplicas, c.MaxReplicas)
+	}
+	if raw := os.Getenv("AUTOSCALE_INTERVAL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second {
+			return c, false, fmt.Errorf("AUTOSCALE_INTERVAL must be a duration of at least 1s, got %q", raw)
+		}
+		c.Interval = d
+	}
+	return c, true, nil
+}
+
+// Hint is the sizing computed from one read of the queue depth
+type Hint struct {
+	Backlog int64 `json:"backlog"` // Queued and running jobs
+	// Slots is the number of jobs the whole fleet should process at the same
+	// time to keep TargetBacklog jobs per slot
+	Slots int64 `json:"slots"`
+	// Concurrency is the number of jobs a worker processes at the same time
+	Concurrency int `json:"concurrency"`
+	// DesiredReplicas is the number of workers at MaxConcurrency providing
+	// Slots, within MinReplicas and MaxReplicas
+	DesiredReplicas int       `json:"desired_replicas"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	WorkerID        string    `json:"worker_id,omitempty"` // Worker that published the hint
+}
+
+// Compute sizes the workers for backlog queued or running jobs
+func (c Config) Compute(backlog int64) Hint {
+	hint := Hint{Backlog: max(backlog, 0), UpdatedAt: time.Now().UTC()}
+	hint.Slots = (hint.Backlog + int64(c.TargetBacklog) - 1) / int64(c.TargetBacklog)
+	hint.Concurrency = int(min(max(hint.Slots, int64(c.MinConcurrency)), int64(c.MaxConcurrency)))
+	replicas := (hint.Slots + int64(c.MaxConcurrency) - 1) / int64(c.MaxConcurrency)
+	if c.MaxReplicas > 0 {
+		replicas = min(replicas, int64(c.MaxReplicas))
+	}
+	hint.DesiredReplicas = int(max(replicas, int64(c.MinReplicas)))
+	return hint
+}
+
+// Publish stores the hint in HintKey, read by LoadHint
+func Publish(ctx context.Context, client redis.Cmdable, hint Hint, interval time.Duration) error {
+	data, err := json.Marshal(hint)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, HintKey, data, 3*interval).Err()
+}
+
+// LoadHint returns the last published hint, nil when no worker published
+// one recently
+func LoadHint(ctx context.Context, client redis.Cmdable) (*Hint, error) {
+	data, err := client.Get(ctx, HintKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hint Hint
+	if err := json.Unmarshal(data, &hint); err != nil {
+		return nil, fmt.Errorf("invalid autoscale hint: %w", err)
+	}
+	return &hint, nil
+}
@@ -0,0 +1,22 @@
+package autoscale
+
+import "testing"
+
+func TestCompute(t *testing.T) {
+	c := Config{MinConcurrency: 2, MaxConcurrency: 4, TargetBacklog: 3, MinReplicas: 1, MaxReplicas: 5}
+	for _, tt := range []struct {
+		backlog     int64
+		concurrency int
+		replicas    int
+	}{
+		{0, 2, 1},   // Empty queue: lower bounds
+		{7, 3, 1},   // 3 slots
+		{30, 4, 3},  // 10 slots, 4 per worker
+		{300, 4, 5}, // Bounded by MaxReplicas
+	} {
+		hint := c.Compute(tt.backlog)
+		if hint.Concurrency != tt.concurrency || hint.DesiredReplicas != tt.replicas {
+			t.Errorf("Compute(%d) = concurrency %d, replicas %d; want %d, %d", tt.backlog, hint.Concurrency, hint.DesiredReplicas, tt.concurrency, tt.replicas)
+		}
+	}
+}
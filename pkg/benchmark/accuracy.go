@@ -0,0 +1,194 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Sample is an image with the text it contains
+type Sample struct {
+	Name      string `json:"name"`
+	ImagePath string `json:"image_path"`
+	Truth     string `json:"-"`
+}
+
+// imageExtensions are the inputs LoadSamples pairs with ground truth files
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".tif": true, ".tiff": true, ".bmp": true, ".gif": true}
+
+// LoadSamples pairs the images of dir with their ground truth: <name>.gt.txt
+// (as written by testutil.WriteSample) or <name>.txt. Images without ground
+// truth are skipped.
+func LoadSamples(dir string) ([]Sample, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var samples []Sample
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || !imageExtensions[strings.ToLower(ext)] {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ext)
+		for _, truthFile := range []string{name + ".gt.txt", name + ".txt"} {
+			truth, err := os.ReadFile(filepath.Join(dir, truthFile))
+			if err == nil {
+				samples = append(samples, Sample{Name: name, ImagePath: filepath.Join(dir, e.Name()), Truth: string(truth)})
+				break
+			}
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no image with a ground truth file (<name>.gt.txt or <name>.txt) in %s", dir)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Name < samples[j].Name })
+	return samples, nil
+}
+
+// Preprocess is a preprocessing configuration evaluated by RunAccuracy: it
+// returns the image to OCR for an input image
+type Preprocess struct {
+	Name  string
+	Apply func(imagePath string) (string, error)
+}
+
+// SampleScore is the accuracy on one sample
+type SampleScore struct {
+	Sample   string        `json:"sample"`
+	CER      float64       `json:"cer"`
+	WER      float64       `json:"wer"`
+	Duration time.Duration `json:"duration_ns"` // Preprocessing and OCR
+	Error    string        `json:"error,omitempty"`
+}
+
+// AccuracyResult is the accuracy of one preprocessing configuration. Error
+// rates are computed over all samples (total edits / total reference length),
+// so long documents weigh more than short ones.
+type AccuracyResult struct {
+	Config   string        `json:"config"`
+	Samples  int           `json:"samples"`
+	Errors   int           `json:"errors"` // Samples whose preprocessing or OCR failed, not counted in the rates
+	CER      float64       `json:"cer"`
+	WER      float64       `json:"wer"`
+	Latency  LatencyStats  `json:"latency"`
+	PerImage []SampleScore `json:"per_image"`
+}
+
+// AccuracyReport is the JSON file written by `imgproc benchmark -mode accuracy -json`
+type AccuracyReport struct {
+	Mode    string           `json:"mode"`
+	Samples int              `json:"samples"`
+	Results []AccuracyResult `json:"results"`
+	Runtime *RuntimeStats    `json:"runtime,omitempty"` // Resources of the benchmark process (-profile)
+}
+
+// RunAccuracy runs every configuration on every sample and measures the
+// character and word error rates of recognize against the ground truth
+func RunAccuracy(ctx context.Context, samples []Sample, configs []Preprocess, recognize func(ctx context.Context, imagePath string) (string, error)) []AccuracyResult {
+	results := make([]AccuracyResult, 0, len(configs))
+	for _, config := range configs {
+		result := AccuracyResult{Config: config.Name, Samples: len(samples)}
+		var charEdits, chars, wordEdits, words int
+		var latencies []time.Duration
+		for _, sample := range samples {
+			if ctx.Err() != nil {
+				break
+			}
+			start := time.Now()
+			score := SampleScore{Sample: sample.Name}
+			text, err := recognizeSample(ctx, sample.ImagePath, config, recognize)
+			score.Duration = time.Since(start)
+			if err != nil {
+				score.Error = err.Error()
+				result.Errors++
+				result.PerImage = append(result.PerImage, score)
+				continue
+			}
+			latencies = append(latencies, score.Duration)
+			ce, cn := CharErrors(sample.Truth, text)
+			we, wn := WordErrors(sample.Truth, text)
+			score.CER, score.WER = rate(ce, cn), rate(we, wn)
+			charEdits, chars, wordEdits, words = charEdits+ce, chars+cn, wordEdits+we, words+wn
+			result.PerImage = append(result.PerImage, score)
+		}
+		result.CER, result.WER = rate(charEdits, chars), rate(wordEdits, words)
+		result.Latency = Summarize(latencies)
+		results = append(results, result)
+	}
+	return results
+}
+
+func recognizeSample(ctx context.Context, imagePath string, config Preprocess, recognize func(context.Context, string) (string, error)) (string, error) {
+	if config.Apply != nil {
+		var err error
+		if imagePath, err = config.Apply(imagePath); err != nil {
+			return "", fmt.Errorf("preprocessing: %w", err)
+		}
+	}
+	return recognize(ctx, imagePath)
+}
+
+func rate(edits, total int) float64 {
+	if total == 0 {
+		if edits == 0 {
+			return 0
+		}
+		return 1
+	}
+	return float64(edits) / float64(total)
+}
+
+// CharErrors returns the edit distance between the characters of the texts
+// (whitespace runs count as one space) and the length of the reference
+func CharErrors(reference, hypothesis string) (edits, length int) {
+	ref := []rune(strings.Join(strings.Fields(reference), " "))
+	hyp := []rune(strings.Join(strings.Fields(hypothesis), " "))
+	return editDistance(ref, hyp), len(ref)
+}
+
+// WordErrors returns the edit distance between the words of the texts and
+// the number of words of the reference
+func WordErrors(reference, hypothesis string) (edits, length int) {
+	ref, hyp := strings.Fields(reference), strings.Fields(hypothesis)
+	return editDistance(ref, hyp), len(ref)
+}
+
+// editDistance is the Levenshtein distance (insertions, deletions and
+// substitutions), computed with a single row
+func editDistance[T comparable](a, b []T) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diag := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			next := min(row[j]+1, row[j-1]+1, diag+cost)
+			diag, row[j] = row[j], next
+		}
+	}
+	return row[len(b)]
+}
+
+// PrintAccuracyResults writes the results as an aligned table
+func PrintAccuracyResults(out io.Writer, results []AccuracyResult) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONFIG\tSAMPLES\tCER\tWER\tP50\tP95\tERRORS")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f%%\t%.2f%%\t%v\t%v\t%d\n",
+			r.Config, r.Samples, r.CER*100, r.WER*100, r.Latency.P50, r.Latency.P95, r.Errors)
+	}
+	tw.Flush()
+}
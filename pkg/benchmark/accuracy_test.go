@@ -0,0 +1,113 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"saturday", "sunday", 3},
+		{"abc", "acb", 2},         // A transposition is two edits
+		{"hóa đơn", "hoa don", 3}, // Runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := editDistance([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance([]rune(tt.b), []rune(tt.a)); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d (symmetric)", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestCharAndWordErrors(t *testing.T) {
+	tests := []struct {
+		name                  string
+		reference, hypothesis string
+		charEdits, chars      int
+		wordEdits, words      int
+	}{
+		{"exact", "total invoice", "total invoice", 0, 13, 0, 2},
+		{"whitespace runs", "total  invoice\n", " total\tinvoice", 0, 13, 0, 2},
+		{"one character", "total invoice", "tota1 invoice", 1, 13, 1, 2},
+		{"missing word", "the total invoice", "total invoice", 4, 17, 1, 3},
+		{"extra word", "invoice", "the invoice", 4, 7, 1, 1},
+		{"empty hypothesis", "two words", "", 9, 9, 2, 2},
+		{"empty reference", "", "noise", 5, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if edits, length := CharErrors(tt.reference, tt.hypothesis); edits != tt.charEdits || length != tt.chars {
+				t.Errorf("CharErrors = %d, %d; want %d, %d", edits, length, tt.charEdits, tt.chars)
+			}
+			if edits, length := WordErrors(tt.reference, tt.hypothesis); edits != tt.wordEdits || length != tt.words {
+				t.Errorf("WordErrors = %d, %d; want %d, %d", edits, length, tt.wordEdits, tt.words)
+			}
+		})
+	}
+}
+
+func TestRunAccuracy(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.png":     "",
+		"a.gt.txt":  "total invoice",
+		"b.jpg":     "",
+		"b.txt":     "two words here",
+		"c.png":     "", // No ground truth
+		"notes.txt": "not a sample",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	samples, err := LoadSamples(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[0].Name != "a" || samples[1].Truth != "two words here" {
+		t.Fatalf("samples = %+v", samples)
+	}
+	if _, err := LoadSamples(t.TempDir()); err == nil {
+		t.Error("LoadSamples of an empty directory succeeded")
+	}
+
+	recognized := map[string]string{"a.png": "tota1 invoice", "b.jpg": "two words here"}
+	recognize := func(_ context.Context, path string) (string, error) {
+		return recognized[filepath.Base(path)], nil
+	}
+	configs := []Preprocess{
+		{Name: "none"},
+		{Name: "broken", Apply: func(path string) (string, error) {
+			if filepath.Base(path) == "b.jpg" {
+				return "", errors.New("bad image")
+			}
+			return path, nil
+		}},
+	}
+	results := RunAccuracy(context.Background(), samples, configs, recognize)
+	if len(results) != 2 {
+		t.Fatalf("results = %+v", results)
+	}
+	// 1 character edit over 13+14 characters, 1 word edit over 2+3 words
+	if r := results[0]; r.Errors != 0 || r.CER != 1.0/27 || r.WER != 1.0/5 || len(r.PerImage) != 2 || r.PerImage[0].WER != 0.5 {
+		t.Errorf("result = %+v", r)
+	}
+	// Failed samples are not counted in the rates
+	if r := results[1]; r.Errors != 1 || r.CER != 1.0/13 || r.PerImage[1].Error != "preprocessing: bad image" {
+		t.Errorf("result with an error = %+v", r)
+	}
+}
@@ -0,0 +1,197 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+)
+
+// CacheWorkload describes the operations replayed against every backend
+type CacheWorkload struct {
+	Operations  int           `json:"operations"`
+	Concurrency int           `json:"concurrency"`
+	Keys        int           `json:"keys"`        // Size of the key space
+	ReadRatio   float64       `json:"read_ratio"`  // Share of cache-aside reads, the rest are plain writes
+	ValueBytes  int           `json:"value_bytes"` // Size of each value (OCR text is typically a few KB)
+	Skew        float64       `json:"skew"`        // Zipf exponent (> 1) for hot keys, 0 for uniform access
+	TTL         time.Duration `json:"ttl_ns"`
+	Seed        int64         `json:"seed"`
+}
+
+// DefaultCacheWorkload returns a workload resembling the image hash cache:
+// mostly reads with a few popular images
+func DefaultCacheWorkload() CacheWorkload {
+	return CacheWorkload{
+		Operations:  20000,
+		Concurrency: 8,
+		Keys:        2000,
+		ReadRatio:   0.9,
+		ValueBytes:  4096,
+		Skew:        1.1,
+		TTL:         10 * time.Minute,
+		Seed:        1,
+	}
+}
+
+// CacheResult is the outcome of the workload on one backend
+type CacheResult struct {
+	Backend    string        `json:"backend"`
+	Operations int           `json:"operations"`
+	Gets       int           `json:"gets"`
+	Hits       int           `json:"hits"`
+	HitRate    float64       `json:"hit_rate"`
+	Errors     int           `json:"errors"`
+	Duration   time.Duration `json:"duration_ns"`
+	OpsPerSec  float64       `json:"ops_per_sec"`
+	GetLatency LatencyStats  `json:"get_latency"`
+	SetLatency LatencyStats  `json:"set_latency"`
+}
+
+type cacheOp struct {
+	read bool
+	key  int
+}
+
+// plan generates the operation sequence once so every backend replays
+// exactly the same keys in the same order
+func (w CacheWorkload) plan() []cacheOp {
+	rng := rand.New(rand.NewSource(w.Seed))
+	var zipf *rand.Zipf
+	if w.Skew > 1 && w.Keys > 1 {
+		zipf = rand.NewZipf(rng, w.Skew, 1, uint64(w.Keys-1))
+	}
+	ops := make([]cacheOp, w.Operations)
+	for i := range ops {
+		key := 0
+		if zipf != nil {
+			key = int(zipf.Uint64())
+		} else if w.Keys > 0 {
+			key = rng.Intn(w.Keys)
+		}
+		ops[i] = cacheOp{read: rng.Float64() < w.ReadRatio, key: key}
+	}
+	return ops
+}
+
+// RunCacheBenchmark replays the workload against each backend in turn.
+// Reads are cache-aside: a miss is followed by a Set of the value, as the
+// worker does after processing an image. Keys are namespaced per run so
+// backends start empty.
+func RunCacheBenchmark(ctx context.Context, backends []cache.Cache, w CacheWorkload) []CacheResult {
+	if w.Concurrency < 1 {
+		w.Concurrency = 1
+	}
+	ops := w.plan()
+	value := strings.Repeat("x", w.ValueBytes)
+	run := time.Now().UnixNano()
+
+	results := make([]CacheResult, 0, len(backends))
+	for _, backend := range backends {
+		prefix := fmt.Sprintf("bench:%d:%s:", run, backend.Name())
+		results = append(results, runCacheWorkload(ctx, backend, ops, prefix, value, w))
+	}
+	return results
+}
+
+func runCacheWorkload(ctx context.Context, c cache.Cache, ops []cacheOp, prefix, value string, w CacheWorkload) CacheResult {
+	var (
+		mu         sync.Mutex
+		getSamples []time.Duration
+		setSamples []time.Duration
+		gets, hits int
+		errCount   int
+		next       int
+		wg         sync.WaitGroup
+	)
+	set := func(key string) {
+		start := time.Now()
+		err := c.Set(ctx, key, value, w.TTL)
+		elapsed := time.Since(start)
+		mu.Lock()
+		setSamples = append(setSamples, elapsed)
+		if err != nil {
+			errCount++
+		}
+		mu.Unlock()
+	}
+
+	start := time.Now()
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if next >= len(ops) || ctx.Err() != nil {
+					mu.Unlock()
+					return
+				}
+				op := ops[next]
+				next++
+				mu.Unlock()
+
+				key := fmt.Sprintf("%s%d", prefix, op.key)
+				if !op.read {
+					set(key)
+					continue
+				}
+				getStart := time.Now()
+				_, err := c.Get(ctx, key)
+				elapsed := time.Since(getStart)
+				mu.Lock()
+				gets++
+				getSamples = append(getSamples, elapsed)
+				switch {
+				case err == nil:
+					hits++
+				case !errors.Is(err, cache.ErrMiss):
+					errCount++
+				}
+				mu.Unlock()
+				if errors.Is(err, cache.ErrMiss) {
+					set(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	duration := time.Since(start)
+
+	result := CacheResult{
+		Backend:    c.Name(),
+		Operations: len(ops),
+		Gets:       gets,
+		Hits:       hits,
+		Errors:     errCount,
+		Duration:   duration,
+		GetLatency: Summarize(getSamples),
+		SetLatency: Summarize(setSamples),
+	}
+	if gets > 0 {
+		result.HitRate = float64(hits) / float64(gets)
+	}
+	if duration > 0 {
+		result.OpsPerSec = float64(len(ops)) / duration.Seconds()
+	}
+	return result
+}
+
+// PrintCacheResults writes the results as an aligned table
+func PrintCacheResults(out io.Writer, results []CacheResult) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tOPS/S\tHIT RATE\tGET P50\tGET P99\tSET P50\tSET P99\tERRORS")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%.0f\t%.1f%%\t%v\t%v\t%v\t%v\t%d\n",
+			r.Backend, r.OpsPerSec, r.HitRate*100,
+			r.GetLatency.P50, r.GetLatency.P99, r.SetLatency.P50, r.SetLatency.P99, r.Errors)
+	}
+	tw.Flush()
+}
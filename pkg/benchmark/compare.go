@@ -0,0 +1,126 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"text/tabwriter"
+)
+
+// CacheReport is the JSON file written by `imgproc benchmark -json`
+type CacheReport struct {
+	Mode     string        `json:"mode"`
+	Workload CacheWorkload `json:"workload"`
+	Results  []CacheResult `json:"results"`
+	Sweep    []SweepResult `json:"sweep,omitempty"`   // Instead of Results with -sweep
+	Runtime  *RuntimeStats `json:"runtime,omitempty"` // Resources of the benchmark process (-profile)
+}
+
+// LoadCacheReport reads a benchmark result file
+func LoadCacheReport(path string) (CacheReport, error) {
+	var report CacheReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return report, fmt.Errorf("invalid benchmark results %s: %w", path, err)
+	}
+	if report.Mode != "cache" {
+		return report, fmt.Errorf("unsupported benchmark mode %q in %s", report.Mode, path)
+	}
+	return report, nil
+}
+
+// Delta is the change of one metric of one backend between two runs
+type Delta struct {
+	Backend    string
+	Metric     string
+	Old, New   float64
+	Change     float64 // Relative change, +0.1 is 10% higher (±Inf when Old is 0)
+	Regression bool    // Worse by more than the threshold
+}
+
+// cacheMetric reads one metric of a result; lower values are better unless higherIsBetter
+type cacheMetric struct {
+	name           string
+	higherIsBetter bool
+	value          func(CacheResult) float64
+}
+
+var cacheMetrics = []cacheMetric{
+	{"ops_per_sec", true, func(r CacheResult) float64 { return r.OpsPerSec }},
+	{"hit_rate", true, func(r CacheResult) float64 { return r.HitRate }},
+	{"errors", false, func(r CacheResult) float64 { return float64(r.Errors) }},
+	{"get_p50", false, func(r CacheResult) float64 { return float64(r.GetLatency.P50) }},
+	{"get_p95", false, func(r CacheResult) float64 { return float64(r.GetLatency.P95) }},
+	{"get_p99", false, func(r CacheResult) float64 { return float64(r.GetLatency.P99) }},
+	{"set_p50", false, func(r CacheResult) float64 { return float64(r.SetLatency.P50) }},
+	{"set_p95", false, func(r CacheResult) float64 { return float64(r.SetLatency.P95) }},
+	{"set_p99", false, func(r CacheResult) float64 { return float64(r.SetLatency.P99) }},
+}
+
+// CompareCache computes the deltas of every metric of the backends present
+// in both reports. A metric regresses when it gets worse by more than
+// threshold (0.1 for 10%). Backends missing from either report are returned
+// in missing. Comparing runs of different workloads is an error.
+func CompareCache(old, new CacheReport, threshold float64) (deltas []Delta, missing []string, err error) {
+	if !reflect.DeepEqual(old.Workload, new.Workload) {
+		return nil, nil, fmt.Errorf("the benchmarks ran different workloads, results are not comparable")
+	}
+	newResults := make(map[string]CacheResult, len(new.Results))
+	for _, r := range new.Results {
+		newResults[r.Backend] = r
+	}
+	seen := make(map[string]bool, len(old.Results))
+	for _, o := range old.Results {
+		seen[o.Backend] = true
+		n, ok := newResults[o.Backend]
+		if !ok {
+			missing = append(missing, o.Backend)
+			continue
+		}
+		for _, m := range cacheMetrics {
+			d := Delta{Backend: o.Backend, Metric: m.name, Old: m.value(o), New: m.value(n)}
+			switch {
+			case d.Old == d.New:
+			case d.Old == 0:
+				d.Change = math.Inf(1)
+				if d.New < 0 {
+					d.Change = math.Inf(-1)
+				}
+			default:
+				d.Change = (d.New - d.Old) / math.Abs(d.Old)
+			}
+			worse := d.Change
+			if m.higherIsBetter {
+				worse = -worse
+			}
+			d.Regression = worse > threshold
+			deltas = append(deltas, d)
+		}
+	}
+	for _, r := range new.Results {
+		if !seen[r.Backend] {
+			missing = append(missing, r.Backend)
+		}
+	}
+	return deltas, missing, nil
+}
+
+// PrintDeltas writes the deltas as an aligned table, regressions marked
+func PrintDeltas(out io.Writer, deltas []Delta) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tMETRIC\tOLD\tNEW\tCHANGE\t")
+	for _, d := range deltas {
+		mark := ""
+		if d.Regression {
+			mark = "REGRESSION"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.4g\t%.4g\t%+.1f%%\t%s\n", d.Backend, d.Metric, d.Old, d.New, d.Change*100, mark)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,102 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deltaOf returns the delta of one metric of one backend
+func deltaOf(t *testing.T, deltas []Delta, backend, metric string) Delta {
+	t.Helper()
+	for _, d := range deltas {
+		if d.Backend == backend && d.Metric == metric {
+			return d
+		}
+	}
+	t.Fatalf("no delta for %s %s", backend, metric)
+	return Delta{}
+}
+
+func TestCompareCache(t *testing.T) {
+	workload := DefaultCacheWorkload()
+	old := CacheReport{Mode: "cache", Workload: workload, Results: []CacheResult{
+		{Backend: "redis", OpsPerSec: 1000, HitRate: 0.8, Errors: 0, GetLatency: LatencyStats{P50: time.Millisecond, P99: 10 * time.Millisecond}},
+		{Backend: "memory", OpsPerSec: 5000},
+	}}
+	new := CacheReport{Mode: "cache", Workload: workload, Results: []CacheResult{
+		{Backend: "redis", OpsPerSec: 850, HitRate: 0.9, Errors: 3, GetLatency: LatencyStats{P50: 1050 * time.Microsecond, P99: 5 * time.Millisecond}},
+		{Backend: "disk", OpsPerSec: 200},
+	}}
+	deltas, missing, err := CompareCache(old, new, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(missing, []string{"memory", "disk"}) {
+		t.Errorf("missing = %v, want the backends of only one report", missing)
+	}
+	if len(deltas) != len(cacheMetrics) {
+		t.Errorf("%d deltas, want one per metric of redis", len(deltas))
+	}
+
+	tests := []struct {
+		metric     string
+		change     float64
+		regression bool
+	}{
+		{"ops_per_sec", -0.15, true},  // Higher is better: 15% lower
+		{"hit_rate", 0.125, false},    // Higher is better: 12.5% higher
+		{"errors", math.Inf(1), true}, // From 0
+		{"get_p50", 0.05, false},      // Lower is better: within the threshold
+		{"get_p99", -0.5, false},      // Lower is better: improved
+		{"set_p50", 0, false},         // Unchanged zero
+	}
+	for _, tt := range tests {
+		d := deltaOf(t, deltas, "redis", tt.metric)
+		sameChange := d.Change == tt.change || math.Abs(d.Change-tt.change) < 1e-9 // Inf - Inf is NaN
+		if !sameChange || d.Regression != tt.regression {
+			t.Errorf("%s: change %v regression %v, want %v %v", tt.metric, d.Change, d.Regression, tt.change, tt.regression)
+		}
+	}
+
+	// A metric dropping from 0 to a negative value is an infinite decrease
+	old.Results[0].HitRate, new.Results[0].HitRate = 0, -1
+	deltas, _, _ = CompareCache(old, new, 0.1)
+	if d := deltaOf(t, deltas, "redis", "hit_rate"); !math.IsInf(d.Change, -1) || !d.Regression {
+		t.Errorf("hit_rate from 0 to -1: %+v, want -Inf and a regression", d)
+	}
+
+	new.Workload.Operations++
+	if _, _, err := CompareCache(old, new, 0.1); err == nil || !strings.Contains(err.Error(), "different workloads") {
+		t.Errorf("CompareCache of different workloads = %v", err)
+	}
+}
+
+func TestLoadCacheReport(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, v any) string {
+		data, _ := json.Marshal(v)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	report := CacheReport{Mode: "cache", Workload: DefaultCacheWorkload(), Results: []CacheResult{{Backend: "redis", OpsPerSec: 1000}}}
+	got, err := LoadCacheReport(write("cache.json", report))
+	if err != nil || !reflect.DeepEqual(got, report) {
+		t.Errorf("LoadCacheReport = %+v, %v", got, err)
+	}
+	if _, err := LoadCacheReport(write("accuracy.json", AccuracyReport{Mode: "accuracy"})); err == nil || !strings.Contains(err.Error(), `unsupported benchmark mode "accuracy"`) {
+		t.Errorf("LoadCacheReport of an accuracy report = %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o644)
+	if _, err := LoadCacheReport(filepath.Join(dir, "bad.json")); err == nil || !strings.Contains(err.Error(), "invalid benchmark results") {
+		t.Errorf("LoadCacheReport of invalid JSON = %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// HTTPWorkload describes a load test of a deployment through its public API:
+// each request uploads a file (multipart, as the frontend does) and waits
+// for the result of the job until it completes or fails
+type HTTPWorkload struct {
+	URL          string            `json:"url"`   // Base URL of the API (or of its load balancer)
+	APIKey       string            `json:"-"`     // Sent as X-API-Key when set
+	Files        []string          `json:"files"` // Uploaded in turn
+	Requests     int               `json:"requests"`
+	Concurrency  int               `json:"concurrency"`
+	PollInterval time.Duration     `json:"poll_interval_ns"` // Delay before asking again after an error
+	JobTimeout   time.Duration     `json:"job_timeout_ns"`   // A job not finished in time counts as failed
+	Fields       map[string]string `json:"fields,omitempty"`
+}
+
+// HTTPResult is the outcome of a load test
+type HTTPResult struct {
+	Requests   int            `json:"requests"`
+	Completed  int            `json:"completed"`
+	Failed     int            `json:"failed"`      // Jobs that failed or timed out
+	Rejected   int            `json:"rejected"`    // Uploads refused by the API or not answered
+	ErrorCodes map[string]int `json:"error_codes"` // API error codes (or HTTP status) of rejected uploads
+	Duration   time.Duration  `json:"duration_ns"`
+	JobsPerSec float64        `json:"jobs_per_sec"` // Completed jobs per second
+	Upload     LatencyStats   `json:"upload_latency"`
+	EndToEnd   LatencyStats   `json:"end_to_end_latency"` // From upload to completed status, completed jobs only
+}
+
+// HTTPReport is the JSON file written by `imgproc benchmark -mode http -json`
+type HTTPReport struct {
+	Mode     string        `json:"mode"`
+	Workload HTTPWorkload  `json:"workload"`
+	Result   HTTPResult    `json:"result"`
+	Runtime  *RuntimeStats `json:"runtime,omitempty"`
+}
+
+// RunHTTPBenchmark runs the load test with client
+func RunHTTPBenchmark(ctx context.Context, client *http.Client, w HTTPWorkload) HTTPResult {
+	if w.Concurrency < 1 {
+		w.Concurrency = 1
+	}
+	if w.PollInterval <= 0 {
+		w.PollInterval = 500 * time.Millisecond
+	}
+	var (
+		mu       sync.Mutex
+		result   = HTTPResult{Requests: w.Requests, ErrorCodes: map[string]int{}}
+		uploads  []time.Duration
+		finished []time.Duration
+		next     int
+		wg       sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if next >= w.Requests || ctx.Err() != nil {
+					mu.Unlock()
+					return
+				}
+				file := w.Files[next%len(w.Files)]
+				next++
+				mu.Unlock()
+
+				begin := time.Now()
+				jobID, code := uploadFile(ctx, client, w, file)
+				uploaded := time.Since(begin)
+				var status string
+				if code == "" {
+					status = pollJob(ctx, client, w, jobID)
+				}
+				total := time.Since(begin)
+
+				mu.Lock()
+				switch {
+				case code != "":
+					result.Rejected++
+					result.ErrorCodes[code]++
+				case status == model.StatusCompleted:
+					uploads = append(uploads, uploaded)
+					result.Completed++
+					finished = append(finished, total)
+				default:
+					uploads = append(uploads, uploaded)
+					result.Failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+	if result.Duration > 0 {
+		result.JobsPerSec = float64(result.Completed) / result.Duration.Seconds()
+	}
+	result.Upload = Summarize(uploads)
+	result.EndToEnd = Summarize(finished)
+	return result
+}
+
+// uploadFile returns the ID of the created job, or the reason of the failure
+func uploadFile(ctx context.Context, client *http.Client, w HTTPWorkload, path string) (jobID, code string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "READ_ERROR"
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("image", filepath.Base(path))
+	part.Write(data)
+	for name, value := range w.Fields {
+		form.WriteField(name, value)
+	}
+	form.Close()
+
+	var created struct {
+		JobID string `json:"job_id"`
+	}
+	if code := apiCall(ctx, client, w, http.MethodPost, "/api/upload", form.FormDataContentType(), &body, &created); code != "" {
+		return "", code
+	}
+	if created.JobID == "" {
+		return "", "NO_JOB_ID"
+	}
+	return created.JobID, ""
+}
+
+// pollJob returns the final status of the job, "" on timeout. It long polls
+// /api/results, so a job is seen finished as soon as its status changes.
+func pollJob(ctx context.Context, client *http.Client, w HTTPWorkload, jobID string) string {
+	if w.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.JobTimeout)
+		defer cancel()
+	}
+	for {
+		var status struct {
+			Status string `json:"status"`
+		}
+		if apiCall(ctx, client, w, http.MethodGet, "/api/results/"+url.PathEscape(jobID)+"?wait=30s", "", nil, &status) == "" {
+			if status.Status == model.StatusCompleted || status.Status == model.StatusFailed {
+				return status.Status
+			}
+			continue // Not finished within the wait: ask again at once
+		}
+		// Errors of a poll (load balancer hiccup) are retried until the timeout
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+// apiCall decodes the JSON response into v, and returns the API error code
+// (or HTTP status, or NETWORK_ERROR) of a failed request
+func apiCall(ctx context.Context, client *http.Client, w HTTPWorkload, method, path, contentType string, body io.Reader, v any) string {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(w.URL, "/")+path, body)
+	if err != nil {
+		return "INVALID_URL"
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if w.APIKey != "" {
+		req.Header.Set("X-API-Key", w.APIKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "NETWORK_ERROR"
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "NETWORK_ERROR"
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr httpserver.ErrorResponse
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != nil && apiErr.Error.Code != "" {
+			return apiErr.Error.Code
+		}
+		return fmt.Sprintf("HTTP_%d", resp.StatusCode)
+	}
+	if json.Unmarshal(data, v) != nil {
+		return "INVALID_RESPONSE"
+	}
+	return ""
+}
+
+// PrintHTTPResult writes the result as an aligned table
+func PrintHTTPResult(out io.Writer, r HTTPResult) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REQUESTS\tCOMPLETED\tFAILED\tREJECTED\tJOBS/S\tUPLOAD P50\tUPLOAD P99\tE2E P50\tE2E P95\tE2E P99")
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%.2f\t%v\t%v\t%v\t%v\t%v\n", r.Requests, r.Completed, r.Failed, r.Rejected, r.JobsPerSec,
+		r.Upload.P50.Round(time.Millisecond), r.Upload.P99.Round(time.Millisecond),
+		r.EndToEnd.P50.Round(time.Millisecond), r.EndToEnd.P95.Round(time.Millisecond), r.EndToEnd.P99.Round(time.Millisecond))
+	tw.Flush()
+	if len(r.ErrorCodes) > 0 {
+		codes := make([]string, 0, len(r.ErrorCodes))
+		for code, n := range r.ErrorCodes {
+			codes = append(codes, fmt.Sprintf("%s: %d", code, n))
+		}
+		sort.Strings(codes)
+		fmt.Fprintf(out, "Rejected uploads: %s\n", strings.Join(codes, ", "))
+	}
+}
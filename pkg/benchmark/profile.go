@@ -0,0 +1,107 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// RuntimeStats describes the resources used by the process during a run
+type RuntimeStats struct {
+	PeakRSSKB      int64  `json:"peak_rss_kb"`     // Peak resident memory of the process (Linux only, 0 elsewhere)
+	PeakGoroutines int    `json:"peak_goroutines"` // Highest goroutine count sampled during the run
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	TotalAlloc     uint64 `json:"total_alloc_bytes"` // Bytes allocated during the run
+	NumGC          uint32 `json:"num_gc"`            // Garbage collections during the run
+}
+
+// Profiler captures an optional CPU profile and samples the goroutine count
+// while a benchmark runs
+type Profiler struct {
+	cpuFile *os.File
+	before  runtime.MemStats
+	stop    chan struct{}
+	done    sync.WaitGroup
+	peak    int
+}
+
+// StartProfiler starts sampling, and writing a CPU profile to cpuPath unless
+// it is empty
+func StartProfiler(cpuPath string) (*Profiler, error) {
+	p := &Profiler{stop: make(chan struct{}), peak: runtime.NumGoroutine()}
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+		p.cpuFile = f
+	}
+	runtime.ReadMemStats(&p.before)
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.peak = max(p.peak, runtime.NumGoroutine())
+			}
+		}
+	}()
+	return p, nil
+}
+
+// Stop ends the run, writes a heap profile to heapPath unless it is empty
+// and returns the resources used
+func (p *Profiler) Stop(heapPath string) (RuntimeStats, error) {
+	close(p.stop)
+	p.done.Wait()
+	var err error
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		err = p.cpuFile.Close()
+	}
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	stats := RuntimeStats{
+		PeakRSSKB:      peakRSSKB(),
+		PeakGoroutines: p.peak,
+		HeapAllocBytes: after.HeapAlloc,
+		TotalAlloc:     after.TotalAlloc - p.before.TotalAlloc,
+		NumGC:          after.NumGC - p.before.NumGC,
+	}
+	if heapPath != "" && err == nil {
+		err = writeHeapProfile(heapPath)
+	}
+	return stats, err
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC() // Up-to-date statistics of live objects
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write heap profile: %w", err)
+	}
+	return f.Close()
+}
+
+// PrintRuntimeStats writes the resources used on one line
+func PrintRuntimeStats(out io.Writer, s RuntimeStats) {
+	fmt.Fprintf(out, "Peak RSS: %.1f MiB, peak goroutines: %d, heap: %.1f MiB, allocated: %.1f MiB, GC cycles: %d\n",
+		float64(s.PeakRSSKB)/1024, s.PeakGoroutines, float64(s.HeapAllocBytes)/(1<<20), float64(s.TotalAlloc)/(1<<20), s.NumGC)
+}
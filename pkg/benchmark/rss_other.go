@@ -0,0 +1,6 @@
+//go:build !linux
+
+package benchmark
+
+// Peak RSS is only read on Linux
+func peakRSSKB() int64 { return 0 }
@@ -0,0 +1,53 @@
+package benchmark
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// LatencyStats summarizes a set of latency samples
+type LatencyStats struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// Summarize computes latency statistics; samples is sorted in place
+func Summarize(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	var total time.Duration
+	for _, s := range samples {
+		total += s
+	}
+	return LatencyStats{
+		Count: len(samples),
+		Mean:  total / time.Duration(len(samples)),
+		P50:   percentile(samples, 0.50),
+		P95:   percentile(samples, 0.95),
+		P99:   percentile(samples, 0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted samples: the
+// smallest sample such that at least p of the samples are less than or equal
+// to it, at index ceil(p*n)-1. With 10 samples p95 and p99 are the maximum,
+// never a lower sample.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	// The epsilon keeps products such as 0.07*100 = 7.000000000000001 at rank 7
+	idx := int(math.Ceil(float64(len(sorted))*p-1e-9)) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
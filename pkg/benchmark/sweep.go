@@ -0,0 +1,101 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+)
+
+// KneeMinGain is the throughput gain below which adding concurrency is
+// considered not worth it: the knee is the last level improving throughput
+// by at least this share over the previous level
+const KneeMinGain = 0.10
+
+// SweepResult is the outcome of the same workload at increasing concurrency
+// levels on one backend
+type SweepResult struct {
+	Backend string        `json:"backend"`
+	Points  []CacheResult `json:"points"` // One per level, in the order of the levels
+	Levels  []int         `json:"levels"`
+	Knee    int           `json:"knee"` // Concurrency level past which throughput stops scaling
+}
+
+// ParseLevels parses a comma separated list of increasing concurrency levels
+func ParseLevels(list string) ([]int, error) {
+	var levels []int
+	for _, item := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid concurrency level %q in %q", item, list)
+		}
+		if len(levels) > 0 && n <= levels[len(levels)-1] {
+			return nil, fmt.Errorf("concurrency levels must be increasing, got %q", list)
+		}
+		levels = append(levels, n)
+	}
+	return levels, nil
+}
+
+// RunCacheSweep replays the workload at each concurrency level (see
+// RunCacheBenchmark; every level starts with empty backends)
+func RunCacheSweep(ctx context.Context, backends []cache.Cache, w CacheWorkload, levels []int) []SweepResult {
+	sweeps := make([]SweepResult, len(backends))
+	for i, backend := range backends {
+		sweeps[i] = SweepResult{Backend: backend.Name(), Levels: levels}
+	}
+	for _, level := range levels {
+		w.Concurrency = level
+		for i, result := range RunCacheBenchmark(ctx, backends, w) {
+			sweeps[i].Points = append(sweeps[i].Points, result)
+		}
+	}
+	for i := range sweeps {
+		sweeps[i].Knee = knee(sweeps[i].Levels, sweeps[i].Points)
+	}
+	return sweeps
+}
+
+// knee returns the last level whose throughput beats the best throughput of
+// the lower levels by at least KneeMinGain
+func knee(levels []int, points []CacheResult) int {
+	if len(points) == 0 {
+		return 0
+	}
+	best, kneeLevel := points[0].OpsPerSec, levels[0]
+	for i := 1; i < len(points); i++ {
+		// The gain as a ratio: best*(1+KneeMinGain) rounds above an exact 10% gain
+		if best > 0 && points[i].OpsPerSec/best-1 >= KneeMinGain || best == 0 && points[i].OpsPerSec > 0 {
+			kneeLevel = levels[i]
+		}
+		best = max(best, points[i].OpsPerSec)
+	}
+	return kneeLevel
+}
+
+// PrintSweep writes one table per backend and its knee point
+func PrintSweep(out io.Writer, sweeps []SweepResult) {
+	for _, s := range sweeps {
+		fmt.Fprintf(out, "Backend %s:\n", s.Backend)
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CONCURRENCY\tOPS/S\tGET P50\tGET P99\tSET P50\tSET P99\tERRORS\t")
+		for i, r := range s.Points {
+			mark := ""
+			if s.Levels[i] == s.Knee {
+				mark = "<- knee"
+			}
+			fmt.Fprintf(tw, "%d\t%.0f\t%v\t%v\t%v\t%v\t%d\t%s\n", s.Levels[i], r.OpsPerSec,
+				r.GetLatency.P50, r.GetLatency.P99, r.SetLatency.P50, r.SetLatency.P99, r.Errors, mark)
+		}
+		tw.Flush()
+		if len(s.Levels) > 0 && s.Knee == s.Levels[len(s.Levels)-1] {
+			fmt.Fprintf(out, "Knee point not reached: throughput still scales at concurrency %d\n\n", s.Knee)
+			continue
+		}
+		fmt.Fprintf(out, "Knee point: concurrency %d (throughput gains below %.0f%% beyond it)\n\n", s.Knee, KneeMinGain*100)
+	}
+}
@@ -0,0 +1,70 @@
+package benchmark
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int
+		wantErr string
+	}{
+		{"1,2,4,8,16,32", []int{1, 2, 4, 8, 16, 32}, ""},
+		{" 1, 3 ,10", []int{1, 3, 10}, ""},
+		{"4", []int{4}, ""},
+		{"", nil, "invalid concurrency level"},
+		{"1,,2", nil, "invalid concurrency level"},
+		{"0,1", nil, "invalid concurrency level"},
+		{"1,-2", nil, "invalid concurrency level"},
+		{"1,x", nil, "invalid concurrency level"},
+		{"1,4,2", nil, "must be increasing"},
+		{"2,2", nil, "must be increasing"},
+	}
+	for _, tt := range tests {
+		levels, err := ParseLevels(tt.list)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseLevels(%q) = %v, %v; want %q", tt.list, levels, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(levels, tt.want) {
+			t.Errorf("ParseLevels(%q) = %v, %v; want %v", tt.list, levels, err, tt.want)
+		}
+	}
+}
+
+func TestKnee(t *testing.T) {
+	levels := []int{1, 2, 4, 8, 16}
+	tests := []struct {
+		name string
+		ops  []float64
+		want int
+	}{
+		{"saturates", []float64{100, 190, 350, 370, 360}, 4},
+		{"keeps scaling", []float64{100, 200, 400, 800, 1600}, 16},
+		{"never scales", []float64{100, 105, 108, 109, 100}, 1},
+		{"exactly the minimum gain", []float64{100, 110, 111, 111, 111}, 2},
+		// A dip does not lower the bar: 8 must beat the best level below it
+		{"dip then recovery", []float64{100, 200, 150, 210, 260}, 16},
+		{"dip then partial recovery", []float64{100, 200, 150, 215, 215}, 2},
+		{"failing low levels", []float64{0, 0, 50, 52, 52}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := make([]CacheResult, len(tt.ops))
+			for i, ops := range tt.ops {
+				points[i].OpsPerSec = ops
+			}
+			if got := knee(levels, points); got != tt.want {
+				t.Errorf("knee = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if got := knee(nil, nil); got != 0 {
+		t.Errorf("knee without points = %d, want 0", got)
+	}
+}
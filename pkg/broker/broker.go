@@ -0,0 +1,161 @@
+// Package broker carries job messages from the API to the workers. Kafka is
+// the default; NATS JetStream can be used instead by teams already running it,
+// and SQS (optionally behind an SNS topic) to run on AWS without a
+// self-managed broker.
+package broker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// Publisher sends job messages to the workers
+type Publisher interface {
+	// Name identifies the broker in logs
+	Name() string
+	Publish(ctx context.Context, job messaging.JobMessage) error
+	Close() error
+}
+
+// Consumer receives the job messages of a consumer group: each message is
+// delivered to one worker of the group
+type Consumer interface {
+	// Name identifies the broker in logs
+	Name() string
+	// Receive blocks until a message is available or ctx is done
+	Receive(ctx context.Context) (*Delivery, error)
+	Close() error
+}
+
+// Delivery is a received message. It must be acknowledged once handled;
+// a message that is neither acked nor nacked is redelivered after a timeout.
+type Delivery struct {
+	ID   string // Position of the message in the broker, for logs
+	Body []byte // JSON encoded messaging.JobMessage
+	// RequestID is the HeaderRequestID header of the message, empty if absent
+	RequestID string
+	ack       func(ctx context.Context) error
+	nack      func(ctx context.Context) error
+}
+
+// Ack marks the message handled
+func (d *Delivery) Ack(ctx context.Context) error { return d.ack(ctx) }
+
+// Nack gives the message back to the broker to be redelivered
+func (d *Delivery) Nack(ctx context.Context) error { return d.nack(ctx) }
+
+// HeaderRequestID carries JobMessage.RequestID in the message headers (Kafka
+// headers, NATS headers, SQS/SNS message attributes), so messages can be
+// traced in the broker tools without decoding them
+const HeaderRequestID = "X-Request-ID"
+
+// Broker names accepted by BROKER
+const (
+	BrokerKafka = "kafka"
+	BrokerNATS  = "nats"
+	BrokerSQS   = "sqs"
+)
+
+// NewPublisher creates the publisher of the broker selected by BROKER:
+// "kafka" (default, cfg.KafkaBrokers and cfg.KafkaTopic), "nats" (see
+// NATSConfigFromEnv) or "sqs" (see SQSConfigFromEnv). Every publisher
+// returned implements DepthInspector for the workers of cfg.KafkaGroupID.
+func NewPublisher(ctx context.Context, cfg config.Config) (Publisher, error) {
+	switch name := os.Getenv("BROKER"); name {
+	case BrokerKafka, "":
+		publisher := NewKafkaPublisher(cfg.KafkaBrokers, cfg.KafkaTopic)
+		publisher.groupID = cfg.KafkaGroupID
+		return publisher, nil
+	case BrokerNATS:
+		natsConfig, err := NATSConfigFromEnv(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewNATSPublisher(ctx, natsConfig)
+	case BrokerSQS:
+		sqsConfig, err := SQSConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewSQSPublisher(sqsConfig)
+	default:
+		return nil, fmt.Errorf("unknown broker %q (expected kafka, nats or sqs)", name)
+	}
+}
+
+// NewConsumer creates the consumer of the broker selected by BROKER, in the
+// consumer group cfg.KafkaGroupID
+func NewConsumer(ctx context.Context, cfg config.Config) (Consumer, error) {
+	switch name := os.Getenv("BROKER"); name {
+	case BrokerKafka, "":
+		return NewKafkaConsumer(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroupID), nil
+	case BrokerNATS:
+		natsConfig, err := NATSConfigFromEnv(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewNATSConsumer(ctx, natsConfig)
+	case BrokerSQS:
+		sqsConfig, err := SQSConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewSQSConsumer(sqsConfig)
+	default:
+		return nil, fmt.Errorf("unknown broker %q (expected kafka, nats or sqs)", name)
+	}
+}
+
+// NATSConfigFromEnv reads NATS_URL, NATS_STREAM and NATS_ACK_WAIT. The
+// subject is cfg.KafkaTopic and the durable consumer cfg.KafkaGroupID, so the
+// -topic and -group flags apply to both brokers.
+func NATSConfigFromEnv(cfg config.Config) (NATSConfig, error) {
+	c := NATSConfig{
+		URL:      "nats://localhost:4222",
+		Stream:   "IMAGE_JOBS",
+		Subject:  cfg.KafkaTopic,
+		Consumer: cfg.KafkaGroupID,
+		AckWait:  30 * time.Minute,
+	}
+	if v := os.Getenv("NATS_URL"); v != "" {
+		c.URL = v
+	}
+	if v := os.Getenv("NATS_STREAM"); v != "" {
+		c.Stream = v
+	}
+	if v := os.Getenv("NATS_ACK_WAIT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("NATS_ACK_WAIT must be a positive duration such as 30m, got %q", v)
+		}
+		c.AckWait = d
+	}
+	return c, nil
+}
+
+// SQSConfigFromEnv reads SQS_QUEUE_URL, SNS_TOPIC_ARN, SQS_VISIBILITY_TIMEOUT,
+// AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+func SQSConfigFromEnv() (SQSConfig, error) {
+	c := SQSConfig{
+		QueueURL:          os.Getenv("SQS_QUEUE_URL"),
+		TopicARN:          os.Getenv("SNS_TOPIC_ARN"),
+		Region:            os.Getenv("AWS_REGION"),
+		VisibilityTimeout: 5 * time.Minute,
+		AccessKey:         os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:         os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:      os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if v := os.Getenv("SQS_VISIBILITY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 10*time.Second || d > 12*time.Hour {
+			return c, fmt.Errorf("SQS_VISIBILITY_TIMEOUT must be a duration between 10s and 12h, got %q", v)
+		}
+		c.VisibilityTimeout = d
+	}
+	return c, nil
+}
@@ -0,0 +1,161 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// QueueDepth is the backlog of the job queue as seen by the broker
+type QueueDepth struct {
+	Broker string `json:"broker"`
+	Queue  string `json:"queue"` // Topic, stream or queue URL
+	// Pending counts the messages not delivered to a worker yet. For Kafka it
+	// is the lag of the consumer group: messages written after its committed
+	// offsets, which includes the messages being processed.
+	Pending int64 `json:"pending"`
+	// InFlight counts the messages delivered but not acked yet, -1 when the
+	// broker does not tell them apart from Pending (Kafka)
+	InFlight int64 `json:"in_flight"`
+	// Partitions details the lag of the consumer group per partition (Kafka)
+	Partitions []PartitionLag `json:"partitions,omitempty"`
+}
+
+// PartitionLag is the lag of the consumer group on one Kafka partition
+type PartitionLag struct {
+	Partition int `json:"partition"`
+	// LastOffset is the offset of the next message written to the partition
+	LastOffset int64 `json:"last_offset"`
+	// CommittedOffset is the offset of the next message to process, -1 when
+	// the group never committed on the partition
+	CommittedOffset int64 `json:"committed_offset"`
+	Lag             int64 `json:"lag"`
+}
+
+// DepthInspector is implemented by the publishers that can report the depth
+// of the job queue
+type DepthInspector interface {
+	Depth(ctx context.Context) (QueueDepth, error)
+}
+
+// Time allowed to the broker to report the depth
+const depthTimeout = 10 * time.Second
+
+// Depth sums the lag of the consumer group of the workers over the
+// partitions of the topic: last offset minus committed offset, or minus the
+// first offset of a partition the group never committed on
+func (p *KafkaPublisher) Depth(ctx context.Context) (QueueDepth, error) {
+	depth := QueueDepth{Broker: BrokerKafka, Queue: p.writer.Topic, InFlight: -1}
+	if p.groupID == "" {
+		return depth, fmt.Errorf("kafka publisher has no consumer group to measure the lag of")
+	}
+	ctx, cancel := context.WithTimeout(ctx, depthTimeout)
+	defer cancel()
+	client := &kafka.Client{Addr: p.writer.Addr, Timeout: depthTimeout}
+	topic := p.writer.Topic
+
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return depth, fmt.Errorf("failed to read metadata of topic %s: %w", topic, err)
+	}
+	var partitions []int
+	var requests []kafka.OffsetRequest
+	for _, t := range metadata.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return depth, fmt.Errorf("failed to read metadata of topic %s: %w", topic, t.Error)
+		}
+		for _, partition := range t.Partitions {
+			partitions = append(partitions, partition.ID)
+			requests = append(requests, kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+		}
+	}
+	if len(partitions) == 0 {
+		return depth, nil
+	}
+
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return depth, fmt.Errorf("failed to list offsets of topic %s: %w", topic, err)
+	}
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: p.groupID, Topics: map[string][]int{topic: partitions}})
+	if err != nil {
+		return depth, fmt.Errorf("failed to fetch offsets of group %s: %w", p.groupID, err)
+	}
+	if committed.Error != nil {
+		return depth, fmt.Errorf("failed to fetch offsets of group %s: %w", p.groupID, committed.Error)
+	}
+	committedOffsets := map[int]int64{}
+	for _, partition := range committed.Topics[topic] {
+		if partition.Error == nil {
+			committedOffsets[partition.Partition] = partition.CommittedOffset
+		}
+	}
+	for _, partition := range offsets.Topics[topic] {
+		if partition.Error != nil {
+			return depth, fmt.Errorf("failed to list offsets of partition %d of topic %s: %w", partition.Partition, topic, partition.Error)
+		}
+		lag := PartitionLag{Partition: partition.Partition, LastOffset: partition.LastOffset, CommittedOffset: -1}
+		start, ok := committedOffsets[partition.Partition]
+		if ok && start >= 0 {
+			lag.CommittedOffset = start
+		}
+		if !ok || start < partition.FirstOffset {
+			start = partition.FirstOffset // Never committed, or messages deleted by retention
+		}
+		lag.Lag = max(partition.LastOffset-start, 0)
+		depth.Pending += lag.Lag
+		depth.Partitions = append(depth.Partitions, lag)
+	}
+	sort.Slice(depth.Partitions, func(i, j int) bool { return depth.Partitions[i].Partition < depth.Partitions[j].Partition })
+	return depth, nil
+}
+
+// Depth reads the consumer of the workers: messages not delivered yet and
+// delivered messages waiting for an ack
+func (p *NATSPublisher) Depth(ctx context.Context) (QueueDepth, error) {
+	depth := QueueDepth{Broker: BrokerNATS, Queue: p.config.Stream}
+	var info struct {
+		NumPending    int64 `json:"num_pending"`
+		NumAckPending int64 `json:"num_ack_pending"`
+	}
+	conn, err := p.session.get()
+	if err != nil {
+		return depth, err
+	}
+	if err := jsRequest(ctx, conn, "CONSUMER.INFO."+p.config.Stream+"."+p.config.Consumer, struct{}{}, &info); err != nil {
+		return depth, fmt.Errorf("failed to read consumer %s: %w", p.config.Consumer, err)
+	}
+	depth.Pending, depth.InFlight = info.NumPending, info.NumAckPending
+	return depth, nil
+}
+
+// Depth reads the approximate number of visible and in-flight (received,
+// hidden by the visibility timeout) messages of the queue
+func (p *SQSPublisher) Depth(ctx context.Context) (QueueDepth, error) {
+	depth := QueueDepth{Broker: BrokerSQS, Queue: p.client.config.QueueURL}
+	if depth.Queue == "" {
+		return depth, fmt.Errorf("SQS publisher has no queue URL (SNS topic only)")
+	}
+	ctx, cancel := context.WithTimeout(ctx, depthTimeout)
+	defer cancel()
+	var resp struct {
+		Attributes map[string]string `json:"Attributes"`
+	}
+	err := p.client.call(ctx, "GetQueueAttributes", map[string]any{
+		"QueueUrl":       depth.Queue,
+		"AttributeNames": []string{"ApproximateNumberOfMessages", "ApproximateNumberOfMessagesNotVisible"},
+	}, &resp)
+	if err != nil {
+		return depth, err
+	}
+	depth.Pending, _ = strconv.ParseInt(resp.Attributes["ApproximateNumberOfMessages"], 10, 64)
+	depth.InFlight, _ = strconv.ParseInt(resp.Attributes["ApproximateNumberOfMessagesNotVisible"], 10, 64)
+	return depth, nil
+}
@@ -0,0 +1,5 @@
+module github.com/mxngoc2104/KTPM-CS2/pkg/broker
+
+go 1.24.2
+
+require github.com/segmentio/kafka-go v0.4.47
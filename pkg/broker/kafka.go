@@ -0,0 +1,85 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// KafkaPublisher writes job messages to a Kafka topic, keyed by job ID
+type KafkaPublisher struct {
+	writer  *kafka.Writer
+	groupID string // Consumer group of the workers, whose lag is reported by Depth
+}
+
+// NewKafkaPublisher creates a KafkaPublisher. The writer connects on the
+// first message.
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.LeastBytes{},
+	}}
+}
+
+func (p *KafkaPublisher) Name() string { return BrokerKafka }
+
+func (p *KafkaPublisher) Publish(ctx context.Context, job messaging.JobMessage) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job message: %w", err)
+	}
+	m := kafka.Message{Key: []byte(job.JobID), Value: body}
+	if job.RequestID != "" {
+		m.Headers = []kafka.Header{{Key: HeaderRequestID, Value: []byte(job.RequestID)}}
+	}
+	return p.writer.WriteMessages(ctx, m)
+}
+
+func (p *KafkaPublisher) Close() error { return p.writer.Close() }
+
+// KafkaConsumer reads a Kafka topic in a consumer group. Ack commits the
+// offset of the message. Kafka has no per-message nack: Nack leaves the
+// offset uncommitted, so the message is redelivered after a restart or
+// rebalance unless a later offset is committed first.
+type KafkaConsumer struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaConsumer creates a KafkaConsumer
+func NewKafkaConsumer(brokers []string, topic, groupID string) *KafkaConsumer {
+	return &KafkaConsumer{reader: kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  brokers,
+		GroupID:  groupID,
+		Topic:    topic,
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+	})}
+}
+
+func (c *KafkaConsumer) Name() string { return BrokerKafka }
+
+func (c *KafkaConsumer) Receive(ctx context.Context) (*Delivery, error) {
+	m, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d := &Delivery{
+		ID:   fmt.Sprintf("partition %d offset %d", m.Partition, m.Offset),
+		Body: m.Value,
+		ack:  func(ctx context.Context) error { return c.reader.CommitMessages(ctx, m) },
+		nack: func(context.Context) error { return nil },
+	}
+	for _, h := range m.Headers {
+		if h.Key == HeaderRequestID {
+			d.RequestID = string(h.Value)
+		}
+	}
+	return d, nil
+}
+
+func (c *KafkaConsumer) Close() error { return c.reader.Close() }
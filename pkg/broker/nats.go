@@ -0,0 +1,621 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// NATSConfig configures the NATS JetStream broker
+type NATSConfig struct {
+	// URL of the server: nats://host:port, with user:password@ or token@
+	URL string
+	// Stream is created on first use as a work-queue stream on Subject, so a
+	// message is removed once a worker acks it
+	Stream  string
+	Subject string
+	// Consumer is the durable pull consumer shared by the workers
+	Consumer string
+	// AckWait is the time a worker has to ack a message before it is
+	// redelivered; it must cover the longest job
+	AckWait time.Duration
+}
+
+// Time a pull request waits on the server for a message
+const natsPullExpires = 30 * time.Second
+
+// NATSPublisher publishes job messages to a JetStream stream
+type NATSPublisher struct {
+	session *natsSession
+	config  NATSConfig
+}
+
+// NewNATSPublisher connects to the server and creates the stream if needed
+func NewNATSPublisher(ctx context.Context, config NATSConfig) (*NATSPublisher, error) {
+	session := &natsSession{url: config.URL}
+	conn, err := session.get()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureStream(ctx, conn, config); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &NATSPublisher{session: session, config: config}, nil
+}
+
+func (p *NATSPublisher) Name() string { return BrokerNATS }
+
+// Publish returns once the stream has stored the message. A message
+// published again after a reconnection is dropped by the stream if the first
+// attempt was stored (Nats-Msg-Id is the job ID).
+func (p *NATSPublisher) Publish(ctx context.Context, job messaging.JobMessage) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job message: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	header := map[string]string{"Nats-Msg-Id": job.JobID}
+	if job.RequestID != "" {
+		header[HeaderRequestID] = job.RequestID
+	}
+	var reply natsMsg
+	for attempt := 0; ; attempt++ {
+		conn, err := p.session.get()
+		if err != nil {
+			return err
+		}
+		reply, err = conn.request(ctx, p.config.Subject, header, body)
+		if err == nil {
+			break
+		}
+		if attempt > 0 || !conn.closed() || ctx.Err() != nil {
+			return err
+		}
+		// The connection dropped: one more attempt on a new connection
+	}
+	var ack struct {
+		Stream string   `json:"stream"`
+		Seq    uint64   `json:"seq"`
+		Error  *jsError `json:"error"`
+	}
+	if err := json.Unmarshal(reply.Data, &ack); err != nil {
+		return fmt.Errorf("invalid JetStream publish ack: %w", err)
+	}
+	if ack.Error != nil {
+		return ack.Error
+	}
+	return nil
+}
+
+func (p *NATSPublisher) Close() error { return p.session.Close() }
+
+// NATSConsumer pulls messages from a durable JetStream consumer, one at a time
+type NATSConsumer struct {
+	session *natsSession
+	config  NATSConfig
+}
+
+// NewNATSConsumer connects to the server and creates the stream and the
+// durable consumer if needed
+func NewNATSConsumer(ctx context.Context, config NATSConfig) (*NATSConsumer, error) {
+	session := &natsSession{url: config.URL}
+	conn, err := session.get()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureStream(ctx, conn, config); err != nil {
+		session.Close()
+		return nil, err
+	}
+	req := map[string]any{
+		"stream_name": config.Stream,
+		"config": map[string]any{
+			"durable_name":   config.Consumer,
+			"deliver_policy": "all",
+			"ack_policy":     "explicit",
+			"ack_wait":       config.AckWait.Nanoseconds(),
+			"filter_subject": config.Subject,
+		},
+	}
+	if err := jsRequest(ctx, conn, "CONSUMER.DURABLE.CREATE."+config.Stream+"."+config.Consumer, req, nil); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to create consumer %s: %w", config.Consumer, err)
+	}
+	return &NATSConsumer{session: session, config: config}, nil
+}
+
+func (c *NATSConsumer) Name() string { return BrokerNATS }
+
+// Receive fails when the connection drops; the next call connects again (the
+// stream and the durable consumer are kept by the server), so the caller
+// only has to back off between calls
+func (c *NATSConsumer) Receive(ctx context.Context) (*Delivery, error) {
+	subject := "$JS.API.CONSUMER.MSG.NEXT." + c.config.Stream + "." + c.config.Consumer
+	pull, _ := json.Marshal(map[string]any{"batch": 1, "expires": natsPullExpires.Nanoseconds()})
+	conn, err := c.session.get()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		// The server answers an empty pull with a 408 status when it expires;
+		// the local timeout only covers a lost answer
+		ctxPull, cancel := context.WithTimeout(ctx, natsPullExpires+5*time.Second)
+		msg, err := conn.request(ctxPull, subject, nil, pull)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				continue
+			}
+			return nil, err
+		}
+		switch msg.Status {
+		case 0:
+		case 404, 408: // No message, pull expired
+			continue
+		default:
+			return nil, fmt.Errorf("jetstream pull: %d %s", msg.Status, msg.Description)
+		}
+		ackSubject := msg.Reply
+		return &Delivery{
+			ID:        natsDeliveryID(ackSubject),
+			Body:      msg.Data,
+			RequestID: msg.Header[HeaderRequestID],
+			ack:       func(context.Context) error { return c.reply(ackSubject, "+ACK") },
+			nack:      func(context.Context) error { return c.reply(ackSubject, "-NAK") },
+		}, nil
+	}
+}
+
+// reply acks or nacks a message, on a new connection if the one it was
+// received on dropped meanwhile
+func (c *NATSConsumer) reply(ackSubject, body string) error {
+	conn, err := c.session.get()
+	if err != nil {
+		return err
+	}
+	return conn.publish(ackSubject, "", nil, []byte(body))
+}
+
+func (c *NATSConsumer) Close() error { return c.session.Close() }
+
+// natsDeliveryID returns the stream sequence of a message from its ack subject
+// $JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>.<consumer seq>.<time>.<pending>
+func natsDeliveryID(ackSubject string) string {
+	tokens := strings.Split(ackSubject, ".")
+	if len(tokens) == 9 {
+		return "sequence " + tokens[5] + " delivery " + tokens[4]
+	}
+	return ackSubject
+}
+
+// jsError is the error of a JetStream API response
+type jsError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *jsError) Error() string {
+	return fmt.Sprintf("jetstream: %s (%d)", e.Description, e.ErrCode)
+}
+
+// JetStream API error codes
+const (
+	jsErrStreamNotFound  = 10059
+	jsErrStreamNameInUse = 10058
+)
+
+// jsRequest calls the JetStream API and decodes the response into resp (nil: ignored)
+func jsRequest(ctx context.Context, conn *natsConn, api string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	reply, err := conn.request(ctx, "$JS.API."+api, nil, body)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		Error *jsError `json:"error"`
+	}
+	if err := json.Unmarshal(reply.Data, &status); err != nil {
+		return fmt.Errorf("invalid JetStream response: %w", err)
+	}
+	if status.Error != nil {
+		return status.Error
+	}
+	if resp != nil {
+		return json.Unmarshal(reply.Data, resp)
+	}
+	return nil
+}
+
+func ensureStream(ctx context.Context, conn *natsConn, config NATSConfig) error {
+	err := jsRequest(ctx, conn, "STREAM.INFO."+config.Stream, struct{}{}, nil)
+	var apiErr *jsError
+	if !errors.As(err, &apiErr) || apiErr.ErrCode != jsErrStreamNotFound {
+		return err
+	}
+	err = jsRequest(ctx, conn, "STREAM.CREATE."+config.Stream, map[string]any{
+		"name":      config.Stream,
+		"subjects":  []string{config.Subject},
+		"retention": "workqueue",
+		"storage":   "file",
+	}, nil)
+	if errors.As(err, &apiErr) && apiErr.ErrCode == jsErrStreamNameInUse {
+		return nil // Created concurrently by another process
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", config.Stream, err)
+	}
+	return nil
+}
+
+// natsSession holds the connection of a publisher or consumer and dials
+// again, with a new inbox subscription, once it dropped. Requests in flight
+// on the old connection fail with its error.
+type natsSession struct {
+	url string
+
+	mu       sync.Mutex
+	conn     *natsConn
+	isClosed bool
+}
+
+func (s *natsSession) get() (*natsConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed {
+		return nil, errNATSClosed
+	}
+	if s.conn != nil && !s.conn.closed() {
+		return s.conn, nil
+	}
+	conn, err := dialNATS(s.url)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+func (s *natsSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isClosed = true
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// natsConn is a minimal client of the NATS protocol: publish and
+// request/reply through a wildcard inbox subscription, which is all the
+// JetStream API needs
+type natsConn struct {
+	conn  net.Conn
+	wmu   sync.Mutex
+	w     *bufio.Writer
+	inbox string // Prefix of the reply subjects of this connection
+
+	mu      sync.Mutex
+	pending map[string]chan natsMsg // Reply subject -> waiting request
+	next    int
+	err     error
+	done    chan struct{}
+}
+
+type natsMsg struct {
+	Subject     string
+	Reply       string
+	Status      int // Status header of JetStream control messages (404, 408...), 0 otherwise
+	Description string
+	Header      map[string]string
+	Data        []byte
+}
+
+var errNATSClosed = errors.New("nats: connection closed")
+
+func dialNATS(rawURL string) (*natsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q (expected nats://host:port)", rawURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+
+	line, err := readNATSLine(r)
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("nats: unexpected greeting %q: %v", line, err)
+	}
+	var info struct {
+		Headers     bool `json:"headers"`
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(line[len("INFO "):]), &info)
+	if info.TLSRequired {
+		conn.Close()
+		return nil, fmt.Errorf("nats: the server requires TLS, which is not supported")
+	}
+	if !info.Headers {
+		conn.Close()
+		return nil, fmt.Errorf("nats: the server does not support headers (NATS 2.2 or later is required)")
+	}
+
+	connect := map[string]any{
+		"verbose": false, "pedantic": false, "lang": "go", "version": "1.0",
+		"protocol": 1, "headers": true, "no_responders": true,
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			connect["user"], connect["pass"] = u.User.Username(), password
+		} else {
+			connect["auth_token"] = u.User.Username()
+		}
+	}
+	connectJSON, _ := json.Marshal(connect)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connectJSON); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("nats: %w", err)
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return nil, fmt.Errorf("nats: %s", strings.TrimSpace(line[len("-ERR"):]))
+		}
+		if line == "PONG" {
+			break
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	c := &natsConn{
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		inbox:   "_INBOX." + hex.EncodeToString(id),
+		pending: map[string]chan natsMsg{},
+		done:    make(chan struct{}),
+	}
+	if err := c.write("SUB " + c.inbox + ".* 1\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop(r)
+	return c, nil
+}
+
+func readNATSLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (c *natsConn) readLoop(r *bufio.Reader) {
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply] <size>
+			f := strings.Fields(line[len("MSG "):])
+			if len(f) < 3 {
+				c.close(fmt.Errorf("nats: malformed %q", line))
+				return
+			}
+			size, _ := strconv.Atoi(f[len(f)-1])
+			data, err := readNATSPayload(r, size)
+			if err != nil {
+				c.close(err)
+				return
+			}
+			msg := natsMsg{Subject: f[0], Data: data}
+			if len(f) == 4 {
+				msg.Reply = f[2]
+			}
+			c.deliver(msg)
+		case strings.HasPrefix(line, "HMSG "):
+			// HMSG <subject> <sid> [reply] <header size> <total size>
+			f := strings.Fields(line[len("HMSG "):])
+			if len(f) < 4 {
+				c.close(fmt.Errorf("nats: malformed %q", line))
+				return
+			}
+			headerSize, _ := strconv.Atoi(f[len(f)-2])
+			size, _ := strconv.Atoi(f[len(f)-1])
+			data, err := readNATSPayload(r, size)
+			if err != nil || headerSize > size {
+				c.close(fmt.Errorf("nats: malformed %q", line))
+				return
+			}
+			msg := natsMsg{Subject: f[0], Data: data[headerSize:]}
+			if len(f) == 5 {
+				msg.Reply = f[2]
+			}
+			// The first header line is "NATS/1.0" or "NATS/1.0 <status> <description>",
+			// followed by "Name: value" lines
+			status, fields, _ := strings.Cut(string(data[:headerSize]), "\r\n")
+			if parts := strings.SplitN(status, " ", 3); len(parts) >= 2 {
+				msg.Status, _ = strconv.Atoi(parts[1])
+				if len(parts) == 3 {
+					msg.Description = parts[2]
+				}
+			}
+			for _, field := range strings.Split(fields, "\r\n") {
+				if name, value, ok := strings.Cut(field, ":"); ok {
+					if msg.Header == nil {
+						msg.Header = map[string]string{}
+					}
+					msg.Header[name] = strings.TrimSpace(value)
+				}
+			}
+			c.deliver(msg)
+		case line == "PING":
+			c.write("PONG\r\n")
+		case strings.HasPrefix(line, "-ERR"):
+			c.close(fmt.Errorf("nats: %s", strings.TrimSpace(line[len("-ERR"):])))
+			return
+		}
+	}
+}
+
+func readNATSPayload(r *bufio.Reader, size int) ([]byte, error) {
+	data := make([]byte, size+2) // Payload followed by \r\n
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+func (c *natsConn) deliver(msg natsMsg) {
+	c.mu.Lock()
+	ch := c.pending[msg.Subject]
+	c.mu.Unlock()
+	if ch != nil {
+		select {
+		case ch <- msg:
+		default: // Late answer to a request that already got one
+		}
+	}
+}
+
+func (c *natsConn) write(s string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.w.WriteString(s); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// publish sends data, with headers (HPUB) if header is not empty
+func (c *natsConn) publish(subject, reply string, header map[string]string, data []byte) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+	op := "PUB"
+	var headers string
+	if len(header) > 0 {
+		op = "HPUB"
+		var b strings.Builder
+		b.WriteString("NATS/1.0\r\n")
+		for name, value := range header {
+			b.WriteString(name + ": " + value + "\r\n")
+		}
+		b.WriteString("\r\n")
+		headers = b.String()
+	}
+	line := op + " " + subject + " "
+	if reply != "" {
+		line += reply + " "
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if headers != "" {
+		fmt.Fprintf(c.w, "%s%d %d\r\n%s", line, len(headers), len(headers)+len(data), headers)
+	} else {
+		fmt.Fprintf(c.w, "%s%d\r\n", line, len(data))
+	}
+	c.w.Write(data)
+	c.w.WriteString("\r\n")
+	return c.w.Flush()
+}
+
+// request publishes data with a unique reply subject and waits for the answer.
+// A subject without subscriber (e.g. JetStream disabled) fails at once thanks
+// to the 503 "no responders" status.
+func (c *natsConn) request(ctx context.Context, subject string, header map[string]string, data []byte) (natsMsg, error) {
+	c.mu.Lock()
+	c.next++
+	reply := c.inbox + "." + strconv.Itoa(c.next)
+	ch := make(chan natsMsg, 1)
+	c.pending[reply] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, reply)
+		c.mu.Unlock()
+	}()
+
+	if err := c.publish(subject, reply, header, data); err != nil {
+		return natsMsg{}, err
+	}
+	select {
+	case msg := <-ch:
+		if msg.Status == 503 {
+			return natsMsg{}, fmt.Errorf("nats: no responders on %s (is JetStream enabled?)", subject)
+		}
+		return msg, nil
+	case <-c.done:
+		return natsMsg{}, c.err
+	case <-ctx.Done():
+		return natsMsg{}, ctx.Err()
+	}
+}
+
+func (c *natsConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+}
+
+// closed reports whether the connection dropped or was closed
+func (c *natsConn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *natsConn) Close() error {
+	c.close(errNATSClosed)
+	return nil
+}
@@ -0,0 +1,252 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// natsFrame is a PUB or HPUB received by fakeNATS
+type natsFrame struct {
+	op, subject, reply string
+	header, data       string
+}
+
+// fakeNATS speaks enough of the NATS protocol for natsConn; respond answers
+// each frame with the MSG/HMSG lines to send back
+type fakeNATS struct {
+	ln      net.Listener
+	respond func(f natsFrame) string
+
+	mu     sync.Mutex
+	frames []natsFrame
+	conns  []net.Conn
+	dials  int
+}
+
+func newFakeNATS(t *testing.T, respond func(f natsFrame) string) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATS{ln: ln, respond: respond}
+	t.Cleanup(func() { ln.Close(); s.drop() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.dials++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) url() string { return "nats://" + s.ln.Addr().String() }
+
+// drop closes the connections of the clients, as a restarting server would
+func (s *fakeNATS) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeNATS) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+func (s *fakeNATS) received() []natsFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]natsFrame(nil), s.frames...)
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	fmt.Fprint(conn, "INFO {\"headers\":true}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(line, " ")
+		f := strings.Fields(args)
+		frame := natsFrame{op: op}
+		switch op {
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+			continue
+		case "PUB": // PUB <subject> [reply] <size>
+			size, _ := strconv.Atoi(f[len(f)-1])
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			frame.data = string(data[:size])
+		case "HPUB": // HPUB <subject> [reply] <header size> <total size>
+			headerSize, _ := strconv.Atoi(f[len(f)-2])
+			size, _ := strconv.Atoi(f[len(f)-1])
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			frame.header, frame.data = string(data[:headerSize]), string(data[headerSize:size])
+		default: // CONNECT, SUB
+			continue
+		}
+		frame.subject = f[0]
+		if (op == "PUB" && len(f) == 3) || (op == "HPUB" && len(f) == 4) {
+			frame.reply = f[1]
+		}
+		s.mu.Lock()
+		s.frames = append(s.frames, frame)
+		s.mu.Unlock()
+		if answer := s.respond(frame); answer != "" {
+			fmt.Fprint(conn, answer)
+		}
+	}
+}
+
+// natsMSG and natsHMSG frame an answer of the server to subject
+func natsMSG(subject, data string) string {
+	return fmt.Sprintf("MSG %s 1 %d\r\n%s\r\n", subject, len(data), data)
+}
+
+func natsHMSG(subject, reply, header, data string) string {
+	if reply != "" {
+		reply += " "
+	}
+	return fmt.Sprintf("HMSG %s 1 %s%d %d\r\n%s%s\r\n", subject, reply, len(header), len(header)+len(data), header, data)
+}
+
+// jetStreamAPI answers the stream and consumer creation requests
+func jetStreamAPI(f natsFrame) string {
+	if strings.HasPrefix(f.subject, "$JS.API.STREAM.") || strings.HasPrefix(f.subject, "$JS.API.CONSUMER.DURABLE.CREATE.") {
+		return natsMSG(f.reply, "{}")
+	}
+	return ""
+}
+
+var testNATSConfig = NATSConfig{Stream: "JOBS", Subject: "jobs.new", Consumer: "workers", AckWait: time.Minute}
+
+func TestNATSPublish(t *testing.T) {
+	server := newFakeNATS(t, func(f natsFrame) string {
+		if f.subject == "jobs.new" {
+			return natsMSG(f.reply, `{"stream":"JOBS","seq":7}`)
+		}
+		return jetStreamAPI(f)
+	})
+	config := testNATSConfig
+	config.URL = server.url()
+	p, err := NewNATSPublisher(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Publish(context.Background(), messaging.JobMessage{JobID: "job1", RequestID: "req1"}); err != nil {
+		t.Fatal(err)
+	}
+	frames := server.received()
+	last := frames[len(frames)-1]
+	if last.op != "HPUB" || last.subject != "jobs.new" || !strings.HasPrefix(last.reply, "_INBOX.") {
+		t.Fatalf("publish frame = %+v", last)
+	}
+	if !strings.HasPrefix(last.header, "NATS/1.0\r\n") || !strings.Contains(last.header, "Nats-Msg-Id: job1\r\n") ||
+		!strings.Contains(last.header, HeaderRequestID+": req1\r\n") || !strings.HasSuffix(last.header, "\r\n\r\n") {
+		t.Errorf("publish header = %q", last.header)
+	}
+	if !strings.Contains(last.data, `"job_id":"job1"`) {
+		t.Errorf("publish body = %q", last.data)
+	}
+
+	// The server restarts: the next publish connects again
+	server.drop()
+	if err := p.Publish(context.Background(), messaging.JobMessage{JobID: "job2"}); err != nil {
+		t.Fatalf("publish after the connection dropped: %v", err)
+	}
+	if n := server.connections(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+}
+
+func TestNATSReceive(t *testing.T) {
+	const ack = "$JS.ACK.JOBS.workers.1.42.3.1700000000000000000.0"
+	var pulls atomic.Int32
+	server := newFakeNATS(t, func(f natsFrame) string {
+		if !strings.HasPrefix(f.subject, "$JS.API.CONSUMER.MSG.NEXT.") {
+			return jetStreamAPI(f)
+		}
+		if pulls.Add(1)%2 == 1 {
+			// Empty pull expired
+			return natsHMSG(f.reply, "", "NATS/1.0 408 Request Timeout\r\n\r\n", "")
+		}
+		return natsHMSG(f.reply, ack, "NATS/1.0\r\n"+HeaderRequestID+": req1\r\n\r\n", `{"job_id":"job1"}`)
+	})
+	config := testNATSConfig
+	config.URL = server.url()
+	c, err := NewNATSConsumer(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	d, err := c.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d.Body) != `{"job_id":"job1"}` || d.RequestID != "req1" || d.ID != "sequence 42 delivery 1" {
+		t.Fatalf("delivery = %+v", d)
+	}
+	if err := d.Ack(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFrame(t, server, natsFrame{op: "PUB", subject: ack, data: "+ACK"})
+
+	// The server restarts: a pull on the dropped connection fails, the next
+	// one connects again
+	server.drop()
+	for attempt := 1; ; attempt++ {
+		if d, err = c.Receive(context.Background()); err == nil {
+			break
+		}
+		if attempt == 3 {
+			t.Fatalf("receive after the connection dropped: %v", err)
+		}
+	}
+	if n := server.connections(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+	if err := d.Nack(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFrame(t, server, natsFrame{op: "PUB", subject: ack, data: "-NAK"})
+}
+
+func waitFrame(t *testing.T, server *fakeNATS, want natsFrame) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		for _, f := range server.received() {
+			if f == want {
+				return
+			}
+		}
+	}
+	t.Fatalf("%+v not received; frames: %+v", want, server.received())
+}
@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+)
+
+// The priority lane carries the jobs a client is waiting for (mode=sync
+// uploads), so that they do not queue behind the backlog of the main topic.
+// It is a second Kafka topic, NATS subject (in its own stream) or SQS queue,
+// read by dedicated consumers of every worker in their own consumer group.
+
+// PriorityConfigured reports whether a priority lane is configured:
+// PRIORITY_TOPIC (Kafka topic or NATS subject), or SQS_PRIORITY_QUEUE_URL
+// with BROKER=sqs
+func PriorityConfigured() bool {
+	if os.Getenv("BROKER") == BrokerSQS {
+		return os.Getenv("SQS_PRIORITY_QUEUE_URL") != ""
+	}
+	return os.Getenv("PRIORITY_TOPIC") != ""
+}
+
+// NewPriorityPublisher creates the publisher of the priority lane of the
+// broker selected by BROKER
+func NewPriorityPublisher(ctx context.Context, cfg config.Config) (Publisher, error) {
+	switch name := os.Getenv("BROKER"); name {
+	case BrokerKafka, "":
+		publisher := NewKafkaPublisher(cfg.KafkaBrokers, os.Getenv("PRIORITY_TOPIC"))
+		publisher.groupID = priorityGroup(cfg)
+		return publisher, nil
+	case BrokerNATS:
+		natsConfig, err := priorityNATSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewNATSPublisher(ctx, natsConfig)
+	case BrokerSQS:
+		sqsConfig, err := prioritySQSConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewSQSPublisher(sqsConfig)
+	default:
+		return nil, fmt.Errorf("unknown broker %q (expected kafka, nats or sqs)", name)
+	}
+}
+
+// NewPriorityConsumer creates a consumer of the priority lane of the broker
+// selected by BROKER
+func NewPriorityConsumer(ctx context.Context, cfg config.Config) (Consumer, error) {
+	switch name := os.Getenv("BROKER"); name {
+	case BrokerKafka, "":
+		return NewKafkaConsumer(cfg.KafkaBrokers, os.Getenv("PRIORITY_TOPIC"), priorityGroup(cfg)), nil
+	case BrokerNATS:
+		natsConfig, err := priorityNATSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewNATSConsumer(ctx, natsConfig)
+	case BrokerSQS:
+		sqsConfig, err := prioritySQSConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewSQSConsumer(sqsConfig)
+	default:
+		return nil, fmt.Errorf("unknown broker %q (expected kafka, nats or sqs)", name)
+	}
+}
+
+// priorityGroup is the consumer group of the lane: a Kafka group whose
+// members subscribe to different topics would not share the partitions
+func priorityGroup(cfg config.Config) string { return cfg.KafkaGroupID + "-priority" }
+
+// priorityNATSConfig uses the subject PRIORITY_TOPIC in the stream
+// <NATS_STREAM>_PRIORITY, since a work-queue stream is bound to its subject
+func priorityNATSConfig(cfg config.Config) (NATSConfig, error) {
+	c, err := NATSConfigFromEnv(cfg)
+	if err != nil {
+		return c, err
+	}
+	c.Subject = os.Getenv("PRIORITY_TOPIC")
+	c.Stream += "_PRIORITY"
+	c.Consumer = priorityGroup(cfg)
+	return c, nil
+}
+
+// prioritySQSConfig sends to SQS_PRIORITY_QUEUE_URL directly, without the
+// SNS topic of the main queue
+func prioritySQSConfig() (SQSConfig, error) {
+	c, err := SQSConfigFromEnv()
+	if err != nil {
+		return c, err
+	}
+	c.QueueURL = os.Getenv("SQS_PRIORITY_QUEUE_URL")
+	c.TopicARN = ""
+	return c, nil
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+)
+
+func TestPriorityLane(t *testing.T) {
+	cfg := config.Config{KafkaTopic: "image_processing", KafkaGroupID: "workers"}
+	tests := []struct {
+		name       string
+		env        map[string]string
+		configured bool
+	}{
+		{"kafka without lane", map[string]string{}, false},
+		{"kafka", map[string]string{"PRIORITY_TOPIC": "image_processing_sync"}, true},
+		{"nats", map[string]string{"BROKER": "nats", "PRIORITY_TOPIC": "image_processing_sync"}, true},
+		{"sqs needs its own queue", map[string]string{"BROKER": "sqs", "PRIORITY_TOPIC": "image_processing_sync"}, false},
+		{"sqs", map[string]string{"BROKER": "sqs", "SQS_PRIORITY_QUEUE_URL": "https://sqs.eu-west-1.amazonaws.com/1/sync"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"BROKER", "PRIORITY_TOPIC", "SQS_PRIORITY_QUEUE_URL"} {
+				t.Setenv(name, tt.env[name])
+			}
+			if got := PriorityConfigured(); got != tt.configured {
+				t.Errorf("PriorityConfigured() = %v, want %v", got, tt.configured)
+			}
+		})
+	}
+
+	t.Setenv("PRIORITY_TOPIC", "image_processing_sync")
+	t.Setenv("NATS_STREAM", "")
+	nats, err := priorityNATSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nats.Subject != "image_processing_sync" || nats.Stream != "IMAGE_JOBS_PRIORITY" || nats.Consumer != "workers-priority" {
+		t.Errorf("NATS lane = %+v, want its own subject, stream and consumer", nats)
+	}
+
+	t.Setenv("SQS_QUEUE_URL", "https://sqs.eu-west-1.amazonaws.com/1/jobs")
+	t.Setenv("SNS_TOPIC_ARN", "arn:aws:sns:eu-west-1:1:jobs")
+	t.Setenv("SQS_PRIORITY_QUEUE_URL", "https://sqs.eu-west-1.amazonaws.com/1/sync")
+	sqs, err := prioritySQSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqs.QueueURL != "https://sqs.eu-west-1.amazonaws.com/1/sync" || sqs.TopicARN != "" {
+		t.Errorf("SQS lane = %+v, want the priority queue without the SNS topic", sqs)
+	}
+}
@@ -0,0 +1,347 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/awssig"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// SQSConfig configures the SQS broker
+type SQSConfig struct {
+	QueueURL string // Queue read by the workers (and written to without TopicARN)
+	// TopicARN, when set, makes the publisher publish to this SNS topic, to
+	// which the queue (and possibly other consumers) is subscribed
+	TopicARN string
+	Region   string // Overridden by the region of an AWS queue URL or topic ARN
+	// VisibilityTimeout hides a received message from the other workers. It is
+	// extended while the job runs, so it only bounds the time before the
+	// message of a crashed worker is delivered again.
+	VisibilityTimeout time.Duration
+	AccessKey         string
+	SecretKey         string
+	SessionToken      string // Temporary credentials (Lambda, ECS task roles)
+}
+
+// Long polling wait of ReceiveMessage (SQS maximum)
+const sqsWaitTime = 20 * time.Second
+
+// sqsClient calls the SQS (JSON protocol) and SNS (query protocol) APIs,
+// signing requests with AWS Signature Version 4
+type sqsClient struct {
+	config SQSConfig
+	client *http.Client
+}
+
+func newSQSClient(config SQSConfig) (*sqsClient, error) {
+	if config.QueueURL == "" && config.TopicARN == "" {
+		return nil, fmt.Errorf("SQS broker requires a queue URL or an SNS topic ARN")
+	}
+	if region := awsRegionOf(config.QueueURL, config.TopicARN); region != "" {
+		config.Region = region
+	}
+	if config.Region == "" {
+		return nil, fmt.Errorf("cannot determine the AWS region of queue %q (set AWS_REGION)", config.QueueURL)
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("SQS broker requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = 5 * time.Minute
+	}
+	return &sqsClient{config: config, client: &http.Client{Timeout: sqsWaitTime + 10*time.Second}}, nil
+}
+
+// awsRegionOf reads the region from https://sqs.<region>.amazonaws.com/...
+// (amazonaws.com.cn in the China regions) or arn:aws:sns:<region>:...
+func awsRegionOf(queueURL, topicARN string) string {
+	if u, err := url.Parse(queueURL); err == nil {
+		region, domain, _ := strings.Cut(strings.TrimPrefix(u.Hostname(), "sqs."), ".")
+		if strings.HasPrefix(u.Hostname(), "sqs.") && (domain == "amazonaws.com" || domain == "amazonaws.com.cn") {
+			return region
+		}
+	}
+	if parts := strings.Split(topicARN, ":"); len(parts) >= 6 && parts[2] == "sns" {
+		return parts[3]
+	}
+	return ""
+}
+
+// awsDomain is the domain of the endpoints of the region
+func awsDomain(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return "amazonaws.com.cn"
+	}
+	return "amazonaws.com"
+}
+
+// call invokes an SQS action and decodes its response into resp (nil: ignored)
+func (c *sqsClient) call(ctx context.Context, action string, req, resp any) error {
+	u, err := url.Parse(c.config.QueueURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid SQS queue URL %q", c.config.QueueURL)
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", u.Scheme+"://"+u.Host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	httpReq.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	c.sign(httpReq, payload, "sqs")
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("SQS %s failed: %w", action, err)
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Type != "" {
+			return fmt.Errorf("SQS %s: %s: %s", action, apiErr.Type, apiErr.Message)
+		}
+		return fmt.Errorf("SQS %s returned %s", action, httpResp.Status)
+	}
+	if resp != nil {
+		return json.Unmarshal(body, resp)
+	}
+	return nil
+}
+
+// publishSNS publishes message to the SNS topic
+func (c *sqsClient) publishSNS(ctx context.Context, message, requestID string) error {
+	form := url.Values{
+		"Action":   {"Publish"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {c.config.TopicARN},
+		"Message":  {message},
+	}
+	if requestID != "" {
+		// Message attribute of the SQS message with raw message delivery, in the envelope otherwise
+		form.Set("MessageAttributes.entry.1.Name", HeaderRequestID)
+		form.Set("MessageAttributes.entry.1.Value.DataType", "String")
+		form.Set("MessageAttributes.entry.1.Value.StringValue", requestID)
+	}
+	payload := []byte(form.Encode())
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", "https://sns."+c.config.Region+"."+awsDomain(c.config.Region)+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	c.sign(httpReq, payload, "sns")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("SNS Publish failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SNS Publish returned %s: %s", resp.Status, string(msg))
+	}
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers of a request to service
+func (c *sqsClient) sign(req *http.Request, payload []byte, service string) {
+	signer := awssig.Signer{
+		AccessKey:    c.config.AccessKey,
+		SecretKey:    c.config.SecretKey,
+		SessionToken: c.config.SessionToken,
+		Region:       c.config.Region,
+		Service:      service,
+	}
+	signer.Sign(req, awssig.PayloadHash(payload), time.Now())
+}
+
+// SQSPublisher sends job messages to an SQS queue, or to an SNS topic
+// fanning out to it
+type SQSPublisher struct {
+	client *sqsClient
+}
+
+// NewSQSPublisher creates an SQSPublisher
+func NewSQSPublisher(config SQSConfig) (*SQSPublisher, error) {
+	client, err := newSQSClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &SQSPublisher{client: client}, nil
+}
+
+func (p *SQSPublisher) Name() string { return BrokerSQS }
+
+func (p *SQSPublisher) Publish(ctx context.Context, job messaging.JobMessage) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job message: %w", err)
+	}
+	return p.PublishBody(ctx, body, job.RequestID)
+}
+
+// PublishBody sends a message other than a job message, e.g. the messages
+// between the stages of the serverless pipeline
+func (p *SQSPublisher) PublishBody(ctx context.Context, body []byte, requestID string) error {
+	if p.client.config.TopicARN != "" {
+		return p.client.publishSNS(ctx, string(body), requestID)
+	}
+	req := map[string]any{
+		"QueueUrl":    p.client.config.QueueURL,
+		"MessageBody": string(body),
+	}
+	if requestID != "" {
+		req["MessageAttributes"] = map[string]any{
+			HeaderRequestID: map[string]string{"DataType": "String", "StringValue": requestID},
+		}
+	}
+	return p.client.call(ctx, "SendMessage", req, nil)
+}
+
+func (p *SQSPublisher) Close() error { return nil }
+
+// SQSConsumer long-polls an SQS queue. Ack deletes the message and Nack makes
+// it visible again at once. Messages nacked or abandoned too often are moved
+// to the dead-letter queue by the redrive policy of the queue.
+type SQSConsumer struct {
+	client *sqsClient
+}
+
+// NewSQSConsumer creates an SQSConsumer
+func NewSQSConsumer(config SQSConfig) (*SQSConsumer, error) {
+	if config.QueueURL == "" {
+		return nil, fmt.Errorf("SQS consumer requires a queue URL")
+	}
+	client, err := newSQSClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &SQSConsumer{client: client}, nil
+}
+
+func (c *SQSConsumer) Name() string { return BrokerSQS }
+
+func (c *SQSConsumer) Receive(ctx context.Context) (*Delivery, error) {
+	visibility := int(c.client.config.VisibilityTimeout.Seconds())
+	for {
+		var resp struct {
+			Messages []struct {
+				MessageID     string            `json:"MessageId"`
+				ReceiptHandle string            `json:"ReceiptHandle"`
+				Body          string            `json:"Body"`
+				Attributes    map[string]string `json:"Attributes"`
+				// Values of the String attributes
+				MessageAttributes map[string]struct {
+					StringValue string `json:"StringValue"`
+				} `json:"MessageAttributes"`
+			} `json:"Messages"`
+		}
+		err := c.client.call(ctx, "ReceiveMessage", map[string]any{
+			"QueueUrl":              c.client.config.QueueURL,
+			"MaxNumberOfMessages":   1,
+			"WaitTimeSeconds":       int(sqsWaitTime.Seconds()),
+			"VisibilityTimeout":     visibility,
+			"AttributeNames":        []string{"ApproximateReceiveCount"},
+			"MessageAttributeNames": []string{HeaderRequestID},
+		}, &resp)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if len(resp.Messages) == 0 {
+			continue
+		}
+		m := resp.Messages[0]
+		d := c.delivery(m.MessageID, m.ReceiptHandle, m.Body, m.Attributes["ApproximateReceiveCount"], visibility)
+		if d.RequestID == "" {
+			d.RequestID = m.MessageAttributes[HeaderRequestID].StringValue
+		}
+		return d, nil
+	}
+}
+
+// delivery keeps the message hidden while the job runs, by extending its
+// visibility every half timeout until it is acked or nacked
+func (c *SQSConsumer) delivery(messageID, receiptHandle, body, receiveCount string, visibility int) *Delivery {
+	stop := make(chan struct{})
+	var once sync.Once
+	setVisibility := func(ctx context.Context, seconds int) error {
+		return c.client.call(ctx, "ChangeMessageVisibility", map[string]any{
+			"QueueUrl":          c.client.config.QueueURL,
+			"ReceiptHandle":     receiptHandle,
+			"VisibilityTimeout": seconds,
+		}, nil)
+	}
+	go func() {
+		ticker := time.NewTicker(c.client.config.VisibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				setVisibility(ctx, visibility) // On failure the message is delivered again after the timeout
+				cancel()
+			}
+		}
+	}()
+
+	message, requestID := unwrapSNS(body)
+	return &Delivery{
+		ID:        "message " + messageID + " receive " + receiveCount,
+		Body:      []byte(message),
+		RequestID: requestID,
+		ack: func(ctx context.Context) error {
+			once.Do(func() { close(stop) })
+			return c.client.call(ctx, "DeleteMessage", map[string]string{
+				"QueueUrl":      c.client.config.QueueURL,
+				"ReceiptHandle": receiptHandle,
+			}, nil)
+		},
+		nack: func(ctx context.Context) error {
+			once.Do(func() { close(stop) })
+			return setVisibility(ctx, 0)
+		},
+	}
+}
+
+// unwrapSNS returns the message and the request ID attribute of an SNS
+// notification envelope, for queues subscribed to the topic without raw
+// message delivery
+func unwrapSNS(body string) (message, requestID string) {
+	var envelope struct {
+		Type              string `json:"Type"`
+		TopicArn          string `json:"TopicArn"`
+		Message           string `json:"Message"`
+		MessageAttributes map[string]struct {
+			Value string `json:"Value"`
+		} `json:"MessageAttributes"`
+	}
+	if json.Unmarshal([]byte(body), &envelope) == nil && envelope.Type == "Notification" && envelope.TopicArn != "" {
+		return envelope.Message, envelope.MessageAttributes[HeaderRequestID].Value
+	}
+	return body, ""
+}
+
+func (c *SQSConsumer) Close() error { return nil }
@@ -0,0 +1,225 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sqsCall is an SQS action received by fakeSQS
+type sqsCall struct {
+	action string
+	params map[string]any
+}
+
+// fakeSQS answers the SQS JSON protocol: ReceiveMessage returns the queued
+// responses in order (no message once they are used up)
+type fakeSQS struct {
+	mu       sync.Mutex
+	calls    []sqsCall
+	messages []string // JSON of the ReceiveMessage responses
+}
+
+func newFakeSQS(t *testing.T, messages ...string) (*fakeSQS, SQSConfig) {
+	f := &fakeSQS{messages: messages}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+		var params map[string]any
+		json.NewDecoder(r.Body).Decode(&params)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls = append(f.calls, sqsCall{action: action, params: params})
+		switch action {
+		case "ReceiveMessage":
+			resp := `{}`
+			if len(f.messages) > 0 {
+				resp, f.messages = f.messages[0], f.messages[1:]
+			}
+			w.Write([]byte(resp))
+		case "SendMessage", "DeleteMessage", "ChangeMessageVisibility":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"InvalidAction","message":"unknown action"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return f, SQSConfig{
+		QueueURL:          server.URL + "/123456789012/jobs",
+		Region:            "eu-west-1",
+		VisibilityTimeout: 2 * time.Second,
+		AccessKey:         "AKID",
+		SecretKey:         "secret",
+	}
+}
+
+// actions returns the actions received so far
+func (f *fakeSQS) actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var actions []string
+	for _, c := range f.calls {
+		actions = append(actions, c.action)
+	}
+	return actions
+}
+
+func (f *fakeSQS) last(action string) map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.calls) - 1; i >= 0; i-- {
+		if f.calls[i].action == action {
+			return f.calls[i].params
+		}
+	}
+	return nil
+}
+
+const sqsMessage = `{"Messages":[{"MessageId":"m1","ReceiptHandle":"rh1","Body":"{\"job_id\":\"job1\"}",
+	"Attributes":{"ApproximateReceiveCount":"2"},"MessageAttributes":{"X-Request-ID":{"StringValue":"req1"}}}]}`
+
+func TestSQSReceive(t *testing.T) {
+	// The first long poll ends without a message
+	fake, config := newFakeSQS(t, `{"Messages":[]}`, sqsMessage)
+	consumer, err := NewSQSConsumer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := consumer.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d.Body) != `{"job_id":"job1"}` || d.RequestID != "req1" || d.ID != "message m1 receive 2" {
+		t.Errorf("delivery = %+v", d)
+	}
+	if got := strings.Join(fake.actions(), ","); got != "ReceiveMessage,ReceiveMessage" {
+		t.Errorf("actions = %s, want two long polls", got)
+	}
+	params := fake.last("ReceiveMessage")
+	if params["WaitTimeSeconds"] != float64(20) || params["VisibilityTimeout"] != float64(2) || params["QueueUrl"] != config.QueueURL {
+		t.Errorf("ReceiveMessage = %v, want a 20s long poll with the visibility timeout", params)
+	}
+
+	// The visibility is extended every half timeout until the ack
+	time.Sleep(1300 * time.Millisecond)
+	params = fake.last("ChangeMessageVisibility")
+	if params == nil || params["ReceiptHandle"] != "rh1" || params["VisibilityTimeout"] != float64(2) {
+		t.Fatalf("ChangeMessageVisibility = %v, want the visibility extended", params)
+	}
+	if err := d.Ack(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if params := fake.last("DeleteMessage"); params["ReceiptHandle"] != "rh1" {
+		t.Errorf("DeleteMessage = %v, want the receipt handle", params)
+	}
+	n := len(fake.actions())
+	time.Sleep(1100 * time.Millisecond)
+	if got := fake.actions(); len(got) != n {
+		t.Errorf("actions after the ack = %v, want the extension stopped", got[n:])
+	}
+}
+
+func TestSQSNack(t *testing.T) {
+	fake, config := newFakeSQS(t, sqsMessage)
+	consumer, err := NewSQSConsumer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := consumer.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Nack(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Visible again at once
+	if params := fake.last("ChangeMessageVisibility"); params["ReceiptHandle"] != "rh1" || params["VisibilityTimeout"] != float64(0) {
+		t.Errorf("ChangeMessageVisibility = %v, want visibility 0", params)
+	}
+}
+
+func TestSQSReceiveCanceled(t *testing.T) {
+	_, config := newFakeSQS(t)
+	consumer, err := NewSQSConsumer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := consumer.Receive(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Receive = %v, want the context error", err)
+	}
+}
+
+func TestSQSPublish(t *testing.T) {
+	fake, config := newFakeSQS(t)
+	publisher, err := NewSQSPublisher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.PublishBody(context.Background(), []byte(`{"job_id":"job1"}`), "req1"); err != nil {
+		t.Fatal(err)
+	}
+	params := fake.last("SendMessage")
+	attributes, _ := params["MessageAttributes"].(map[string]any)
+	if params["MessageBody"] != `{"job_id":"job1"}` || attributes[HeaderRequestID] == nil {
+		t.Errorf("SendMessage = %v, want the body and the request ID attribute", params)
+	}
+}
+
+func TestUnwrapSNS(t *testing.T) {
+	tests := []struct {
+		name, body         string
+		message, requestID string
+	}{
+		{"raw delivery", `{"job_id":"job1"}`, `{"job_id":"job1"}`, ""},
+		{"envelope", `{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:1:jobs","Message":"{\"job_id\":\"job1\"}",
+			"MessageAttributes":{"X-Request-ID":{"Type":"String","Value":"req1"}}}`, `{"job_id":"job1"}`, "req1"},
+		{"envelope without attributes", `{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:1:jobs","Message":"hello"}`, "hello", ""},
+		// A job message with a Type field is not an envelope
+		{"not a notification", `{"Type":"Other","Message":"x"}`, `{"Type":"Other","Message":"x"}`, ""},
+		{"not JSON", "plain text", "plain text", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, requestID := unwrapSNS(tt.body)
+			if message != tt.message || requestID != tt.requestID {
+				t.Errorf("unwrapSNS = %q, %q; want %q, %q", message, requestID, tt.message, tt.requestID)
+			}
+		})
+	}
+}
+
+func TestAWSRegionOf(t *testing.T) {
+	tests := []struct {
+		queueURL, topicARN string
+		want               string
+	}{
+		{"https://sqs.eu-west-1.amazonaws.com/123456789012/jobs", "", "eu-west-1"},
+		{"https://sqs.cn-north-1.amazonaws.com.cn/123456789012/jobs", "", "cn-north-1"},
+		{"https://sqs.us-east-1.amazonaws.com:443/123456789012/jobs", "", "us-east-1"},
+		{"", "arn:aws:sns:ap-southeast-1:123456789012:jobs", "ap-southeast-1"},
+		{"", "arn:aws-cn:sns:cn-northwest-1:123456789012:jobs", "cn-northwest-1"},
+		// LocalStack and other endpoints need AWS_REGION
+		{"http://localhost:4566/000000000000/jobs", "", ""},
+		{"https://sqs.example.com/jobs", "", ""},
+		{"", "arn:aws:sqs:eu-west-1:123456789012:jobs", ""},
+	}
+	for _, tt := range tests {
+		if got := awsRegionOf(tt.queueURL, tt.topicARN); got != tt.want {
+			t.Errorf("awsRegionOf(%q, %q) = %q, want %q", tt.queueURL, tt.topicARN, got, tt.want)
+		}
+	}
+	if got := awsDomain("cn-north-1"); got != "amazonaws.com.cn" {
+		t.Errorf("awsDomain(cn-north-1) = %q", got)
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrMiss is returned by Get when the key is not in the cache
+var ErrMiss = errors.New("cache miss")
+
+// Cache is a string key/value cache with per-entry TTL
+type Cache interface {
+	// Name identifies the backend in logs and benchmark reports
+	Name() string
+	// Get returns the value for key, or ErrMiss if it is absent or expired
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores value for key. A ttl of 0 means no expiration.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrPrefixUnsupported is returned by DeletePrefix for backends that cannot
+// list their keys (memcached, disk)
+var ErrPrefixUnsupported = errors.New("cache backend cannot delete entries by prefix")
+
+// PrefixDeleter is implemented by the backends able to delete every entry
+// whose key starts with a prefix, e.g. all the variants (languages, options,
+// texts) cached for one image hash
+type PrefixDeleter interface {
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// DeletePrefix deletes the entries of c whose key starts with prefix and
+// returns how many were deleted
+func DeletePrefix(ctx context.Context, c Cache, prefix string) (int, error) {
+	d, ok := c.(PrefixDeleter)
+	if !ok {
+		return 0, ErrPrefixUnsupported
+	}
+	return d.DeletePrefix(ctx, prefix)
+}
+
+// Backend names accepted by New
+const (
+	BackendMemory    = "memory"
+	BackendRedis     = "redis"
+	BackendTiered    = "tiered"
+	BackendMemcached = "memcached"
+	BackendDisk      = "disk"
+)
+
+// Defaults for the in-process tier
+const (
+	DefaultMemoryEntries = 10000
+	DefaultL1TTL         = 10 * time.Minute
+)
+
+// New creates a cache backend by name. client is required for the redis
+// and tiered backends; memcached and disk are configured by MemcachedFromEnv
+// and DiskFromEnv.
+func New(backend string, client *redis.Client) (Cache, error) {
+	switch backend {
+	case BackendMemory:
+		return NewMemoryCache(DefaultMemoryEntries), nil
+	case BackendRedis, "":
+		if client == nil {
+			return nil, fmt.Errorf("cache backend %q requires a Redis client", backend)
+		}
+		return NewRedisCache(client, ""), nil
+	case BackendTiered:
+		if client == nil {
+			return nil, fmt.Errorf("cache backend %q requires a Redis client", backend)
+		}
+		return NewTieredCache(NewMemoryCache(DefaultMemoryEntries), NewRedisCache(client, ""), DefaultL1TTL), nil
+	case BackendMemcached:
+		return MemcachedFromEnv()
+	case BackendDisk:
+		return DiskFromEnv()
+	}
+	return nil, fmt.Errorf("unknown cache backend %q (expected memory, redis, tiered, memcached or disk)", backend)
+}
@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisConfig configures the Redis clients of the API server, the workers
+// and the benchmark. Retries of failed commands (with exponential backoff
+// between MinRetryBackoff and MaxRetryBackoff) and reconnections are done by
+// the client pool, callers do not retry themselves.
+type RedisConfig struct {
+	Addr            string
+	Password        string
+	DB              int
+	MaxRetries      int // Retries of a failed command, -1 disables them
+	MinRetryBackoff time.Duration
+	MaxRetryBackoff time.Duration
+	DialTimeout     time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	PoolSize        int // Connections, 0: 10 per CPU
+
+	// Observer is called after every command (pipelines as "pipeline") with
+	// its duration and error (redis.Nil is not an error), e.g. to export
+	// metrics or log slow commands
+	Observer func(command string, duration time.Duration, err error)
+}
+
+// DefaultRedisConfig returns the settings used without configuration
+func DefaultRedisConfig(addr string) RedisConfig {
+	return RedisConfig{
+		Addr:            addr,
+		MaxRetries:      3,
+		MinRetryBackoff: 8 * time.Millisecond,
+		MaxRetryBackoff: 512 * time.Millisecond,
+		DialTimeout:     5 * time.Second,
+		ReadTimeout:     3 * time.Second,
+		WriteTimeout:    3 * time.Second,
+	}
+}
+
+// RedisConfigFromEnv returns defaults overridden by REDIS_PASSWORD, REDIS_DB,
+// REDIS_MAX_RETRIES, REDIS_MIN_RETRY_BACKOFF, REDIS_MAX_RETRY_BACKOFF,
+// REDIS_DIAL_TIMEOUT, REDIS_READ_TIMEOUT, REDIS_WRITE_TIMEOUT and
+// REDIS_POOL_SIZE
+func RedisConfigFromEnv(addr string) (RedisConfig, error) {
+	c := DefaultRedisConfig(addr)
+	c.Password = os.Getenv("REDIS_PASSWORD")
+	for _, v := range []struct {
+		name     string
+		value    *int
+		min, max int
+	}{
+		{"REDIS_DB", &c.DB, 0, 15},
+		{"REDIS_MAX_RETRIES", &c.MaxRetries, -1, 100},
+		{"REDIS_POOL_SIZE", &c.PoolSize, 1, 10000},
+	} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < v.min || n > v.max {
+			return c, fmt.Errorf("%s must be between %d and %d, got %q", v.name, v.min, v.max, raw)
+		}
+		*v.value = n
+	}
+	for _, v := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"REDIS_MIN_RETRY_BACKOFF", &c.MinRetryBackoff},
+		{"REDIS_MAX_RETRY_BACKOFF", &c.MaxRetryBackoff},
+		{"REDIS_DIAL_TIMEOUT", &c.DialTimeout},
+		{"REDIS_READ_TIMEOUT", &c.ReadTimeout},
+		{"REDIS_WRITE_TIMEOUT", &c.WriteTimeout},
+	} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("%s must be a positive duration such as 500ms, got %q", v.name, raw)
+		}
+		*v.value = d
+	}
+	if c.MaxRetryBackoff < c.MinRetryBackoff {
+		return c, fmt.Errorf("REDIS_MAX_RETRY_BACKOFF must not be lower than REDIS_MIN_RETRY_BACKOFF")
+	}
+	return c, nil
+}
+
+// NewRedisClient creates a client with the configuration. It does not
+// connect: see WaitForRedis.
+func NewRedisClient(c RedisConfig) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr:            c.Addr,
+		Password:        c.Password,
+		DB:              c.DB,
+		MaxRetries:      c.MaxRetries,
+		MinRetryBackoff: c.MinRetryBackoff,
+		MaxRetryBackoff: c.MaxRetryBackoff,
+		DialTimeout:     c.DialTimeout,
+		ReadTimeout:     c.ReadTimeout,
+		WriteTimeout:    c.WriteTimeout,
+		PoolSize:        c.PoolSize,
+	})
+	if c.Observer != nil {
+		client.AddHook(observerHook{observe: c.Observer})
+	}
+	return client
+}
+
+// WaitForRedis pings Redis until it answers or ctx ends, waiting between
+// attempts from 100ms doubling up to 5s, so services started together with
+// Redis (docker compose, Kubernetes) do not exit on startup
+func WaitForRedis(ctx context.Context, client *redis.Client) error {
+	wait := 100 * time.Millisecond
+	for {
+		err := client.Ping(ctx).Err()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("redis at %s is not reachable: %w", client.Options().Addr, err)
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, 5*time.Second)
+	}
+}
+
+type startKey struct{}
+
+// observerHook reports the duration of commands to RedisConfig.Observer
+type observerHook struct {
+	observe func(command string, duration time.Duration, err error)
+}
+
+func (h observerHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h observerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.report(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+func (h observerHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h observerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && !errors.Is(cmd.Err(), redis.Nil) {
+			err = cmd.Err()
+			break
+		}
+	}
+	h.report(ctx, "pipeline", err)
+	return nil
+}
+
+func (h observerHook) report(ctx context.Context, command string, err error) {
+	start, ok := ctx.Value(startKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	if errors.Is(err, redis.Nil) {
+		err = nil
+	}
+	h.observe(command, time.Since(start), err)
+}
+
+// SlowCommandLogger returns an Observer logging the commands slower than
+// threshold and the failed ones
+func SlowCommandLogger(prefix string, threshold time.Duration) func(string, time.Duration, error) {
+	return func(command string, duration time.Duration, err error) {
+		switch {
+		case err != nil:
+			log.Printf("%sRedis %s failed after %v: %v", prefix, command, duration, err)
+		case duration >= threshold:
+			log.Printf("%sSlow Redis %s: %v", prefix, command, duration)
+		}
+	}
+}
+
+// RedisHealth pings Redis periodically and keeps the last result, for
+// health endpoints and to log when the connection is lost or restored
+type RedisHealth struct {
+	client *redis.Client
+	mu     sync.Mutex
+	status HealthStatus
+}
+
+// HealthStatus is the result of the last health check
+type HealthStatus struct {
+	Healthy   bool          `json:"healthy"`
+	Latency   time.Duration `json:"latency_ns"`
+	LastCheck time.Time     `json:"last_check"`
+	Error     string        `json:"error,omitempty"`
+	Failures  int           `json:"consecutive_failures"`
+}
+
+// NewRedisHealth creates a checker, healthy until the first check
+func NewRedisHealth(client *redis.Client) *RedisHealth {
+	return &RedisHealth{client: client, status: HealthStatus{Healthy: true, LastCheck: time.Now()}}
+}
+
+// Check pings Redis once and records the result
+func (h *RedisHealth) Check(ctx context.Context) HealthStatus {
+	start := time.Now()
+	err := h.client.Ping(ctx).Err()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wasHealthy := h.status.Healthy
+	h.status.LastCheck, h.status.Latency = time.Now(), time.Since(start)
+	if err != nil {
+		h.status.Healthy, h.status.Error = false, err.Error()
+		h.status.Failures++
+		if wasHealthy {
+			log.Printf("Redis at %s is unreachable: %v", h.client.Options().Addr, err)
+		}
+	} else {
+		if !wasHealthy {
+			log.Printf("Redis at %s is reachable again after %d failed check(s)", h.client.Options().Addr, h.status.Failures)
+		}
+		h.status.Healthy, h.status.Error, h.status.Failures = true, "", 0
+	}
+	return h.status
+}
+
+// Status returns the result of the last check
+func (h *RedisHealth) Status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Start checks Redis every interval until ctx ends
+func (h *RedisHealth) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkCtx, cancel := context.WithTimeout(ctx, interval)
+				h.Check(checkCtx)
+				cancel()
+			}
+		}
+	}()
+}
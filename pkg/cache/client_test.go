@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(RedisConfig) bool
+		wantErr string
+	}{
+		{"defaults", nil, func(c RedisConfig) bool { return reflect.DeepEqual(c, DefaultRedisConfig("redis:6379")) }, ""},
+		{"overrides", map[string]string{
+			"REDIS_PASSWORD": "secret", "REDIS_DB": "3", "REDIS_MAX_RETRIES": "-1", "REDIS_POOL_SIZE": "50",
+			"REDIS_MIN_RETRY_BACKOFF": "10ms", "REDIS_MAX_RETRY_BACKOFF": "1s", "REDIS_DIAL_TIMEOUT": "2s",
+			"REDIS_READ_TIMEOUT": "500ms", "REDIS_WRITE_TIMEOUT": "750ms",
+		}, func(c RedisConfig) bool {
+			return c.Password == "secret" && c.DB == 3 && c.MaxRetries == -1 && c.PoolSize == 50 &&
+				c.MinRetryBackoff == 10*time.Millisecond && c.MaxRetryBackoff == time.Second && c.DialTimeout == 2*time.Second &&
+				c.ReadTimeout == 500*time.Millisecond && c.WriteTimeout == 750*time.Millisecond
+		}, ""},
+		{"db out of range", map[string]string{"REDIS_DB": "16"}, nil, "REDIS_DB must be between 0 and 15"},
+		{"retries below -1", map[string]string{"REDIS_MAX_RETRIES": "-2"}, nil, "REDIS_MAX_RETRIES must be between -1 and 100"},
+		{"pool size zero", map[string]string{"REDIS_POOL_SIZE": "0"}, nil, "REDIS_POOL_SIZE must be between 1 and 10000"},
+		{"not a number", map[string]string{"REDIS_DB": "one"}, nil, `got "one"`},
+		{"duration without unit", map[string]string{"REDIS_READ_TIMEOUT": "3"}, nil, "REDIS_READ_TIMEOUT must be a positive duration"},
+		{"negative duration", map[string]string{"REDIS_DIAL_TIMEOUT": "-1s"}, nil, "REDIS_DIAL_TIMEOUT must be a positive duration"},
+		{"backoffs reversed", map[string]string{"REDIS_MIN_RETRY_BACKOFF": "1s", "REDIS_MAX_RETRY_BACKOFF": "100ms"}, nil, "must not be lower than REDIS_MIN_RETRY_BACKOFF"},
+		// Only the minimum set, above the default maximum of 512ms
+		{"min above default max", map[string]string{"REDIS_MIN_RETRY_BACKOFF": "1s"}, nil, "must not be lower than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"REDIS_PASSWORD", "REDIS_DB", "REDIS_MAX_RETRIES", "REDIS_POOL_SIZE", "REDIS_MIN_RETRY_BACKOFF",
+				"REDIS_MAX_RETRY_BACKOFF", "REDIS_DIAL_TIMEOUT", "REDIS_READ_TIMEOUT", "REDIS_WRITE_TIMEOUT"} {
+				t.Setenv(name, tt.env[name])
+			}
+			c, err := RedisConfigFromEnv("redis:6379")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RedisConfigFromEnv = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Addr != "redis:6379" || !tt.check(c) {
+				t.Errorf("config = %+v", c)
+			}
+		})
+	}
+}
+
+func TestRedisHealth(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	config := DefaultRedisConfig(mr.Addr())
+	config.MaxRetries = -1
+	config.DialTimeout = 200 * time.Millisecond
+	var commands []string
+	config.Observer = func(command string, _ time.Duration, _ error) { commands = append(commands, command) }
+	client := NewRedisClient(config)
+	defer client.Close()
+
+	h := NewRedisHealth(client)
+	if s := h.Status(); !s.Healthy {
+		t.Errorf("status before the first check = %+v, want healthy", s)
+	}
+	if s := h.Check(ctx); !s.Healthy || s.Failures != 0 || s.Error != "" {
+		t.Errorf("check with Redis up = %+v", s)
+	}
+
+	// Down: failures are counted
+	mr.Close()
+	for i := 1; i <= 2; i++ {
+		if s := h.Check(ctx); s.Healthy || s.Failures != i || s.Error == "" {
+			t.Errorf("check %d with Redis down = %+v", i, s)
+		}
+	}
+	if s := h.Status(); s.Healthy || s.Failures != 2 {
+		t.Errorf("status = %+v, want the last check", s)
+	}
+
+	// Up again on the same address
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if s := h.Check(ctx); !s.Healthy || s.Failures != 0 || s.Error != "" {
+		t.Errorf("check after the restart = %+v, want healthy", s)
+	}
+	if len(commands) != 4 || commands[0] != "ping" {
+		t.Errorf("observed commands = %v, want the 4 pings", commands)
+	}
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs accepted by NewCompressedCache
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// DefaultCompressionMinSize is the value size below which compression does
+// not pay off
+const DefaultCompressionMinSize = 1024
+
+// Markers prefixed to stored values. Values written without compression
+// (before it was enabled, or too small) are returned as is, unless they start
+// with a NUL byte: those are stored with markerRaw.
+const (
+	markerGzip = "\x00gz\x00"
+	markerZstd = "\x00zs\x00"
+	markerRaw  = "\x00rw\x00"
+)
+
+// CompressedCache compresses the values of at least MinSize bytes before
+// storing them in the wrapped cache, e.g. to cut the Redis memory used by the
+// OCR texts of dense pages. Get decompresses transparently whatever the codec
+// the value was written with, so the codec can be changed on a live cache.
+type CompressedCache struct {
+	cache   Cache
+	codec   string
+	minSize int
+	zenc    *zstd.Encoder
+	zdec    *zstd.Decoder
+}
+
+// NewCompressedCache wraps c with codec (gzip or zstd)
+func NewCompressedCache(c Cache, codec string, minSize int) (*CompressedCache, error) {
+	if codec != CompressionGzip && codec != CompressionZstd {
+		return nil, fmt.Errorf("unknown cache compression %q (expected none, gzip or zstd)", codec)
+	}
+	cc := &CompressedCache{cache: c, codec: codec, minSize: minSize}
+	var err error
+	if codec == CompressionZstd {
+		if cc.zenc, err = zstd.NewWriter(nil); err != nil {
+			return nil, err
+		}
+	}
+	// Values written with the other codec are still read
+	if cc.zdec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0)); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// CompressionFromEnv wraps c according to CACHE_COMPRESSION (none by
+// default, gzip or zstd) and CACHE_COMPRESSION_MIN_BYTES (default 1024)
+func CompressionFromEnv(c Cache) (Cache, error) {
+	codec := os.Getenv("CACHE_COMPRESSION")
+	if codec == "" || codec == CompressionNone {
+		return c, nil
+	}
+	minSize := DefaultCompressionMinSize
+	if v := os.Getenv("CACHE_COMPRESSION_MIN_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("CACHE_COMPRESSION_MIN_BYTES must be a number of bytes, got %q", v)
+		}
+		minSize = n
+	}
+	return NewCompressedCache(c, codec, minSize)
+}
+
+// Name implements Cache
+func (c *CompressedCache) Name() string { return c.codec + "(" + c.cache.Name() + ")" }
+
+// Get implements Cache
+func (c *CompressedCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.cache.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return c.decode(value)
+}
+
+// Set implements Cache
+func (c *CompressedCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.cache.Set(ctx, key, c.encode(value), ttl)
+}
+
+// Delete implements Cache
+func (c *CompressedCache) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
+// DeletePrefix implements PrefixDeleter when the wrapped cache does
+func (c *CompressedCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	return DeletePrefix(ctx, c.cache, prefix)
+}
+
+// encode compresses value, or keeps it when compression does not shrink it
+func (c *CompressedCache) encode(value string) string {
+	if len(value) >= c.minSize && len(value) > 0 {
+		var compressed string
+		switch c.codec {
+		case CompressionZstd:
+			compressed = markerZstd + string(c.zenc.EncodeAll([]byte(value), nil))
+		case CompressionGzip:
+			var buf bytes.Buffer
+			buf.WriteString(markerGzip)
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte(value))
+			zw.Close()
+			compressed = buf.String()
+		}
+		if len(compressed) < len(value) {
+			return compressed
+		}
+	}
+	if strings.HasPrefix(value, "\x00") {
+		return markerRaw + value
+	}
+	return value
+}
+
+func (c *CompressedCache) decode(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, markerZstd):
+		data, err := c.zdec.DecodeAll([]byte(value[len(markerZstd):]), nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress cache entry: %w", err)
+		}
+		return string(data), nil
+	case strings.HasPrefix(value, markerGzip):
+		zr, err := gzip.NewReader(strings.NewReader(value[len(markerGzip):]))
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress cache entry: %w", err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress cache entry: %w", err)
+		}
+		return string(data), nil
+	case strings.HasPrefix(value, markerRaw):
+		return value[len(markerRaw):], nil
+	}
+	return value, nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressedCacheRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	random := make([]byte, 4096)
+	rand.Read(random)
+	values := map[string]string{
+		"empty":          "",
+		"small":          "Hello world",
+		"dense page":     strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 200),
+		"incompressible": string(random),
+		"leading NUL":    "\x00gz\x00not gzip",
+	}
+	for _, codec := range []string{CompressionGzip, CompressionZstd} {
+		t.Run(codec, func(t *testing.T) {
+			mem := NewMemoryCache(100)
+			c, err := NewCompressedCache(mem, codec, DefaultCompressionMinSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range values {
+				if err := c.Set(ctx, name, value, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+				if got, err := c.Get(ctx, name); err != nil || got != value {
+					t.Errorf("%s: Get = %d bytes, %v; want the %d bytes set", name, len(got), err, len(value))
+				}
+			}
+			stored, _ := mem.Get(ctx, "dense page")
+			if len(stored) >= len(values["dense page"])/4 {
+				t.Errorf("dense page stored in %d bytes, want it compressed", len(stored))
+			}
+			if stored, _ := mem.Get(ctx, "small"); stored != values["small"] {
+				t.Errorf("small value stored as %q, want it uncompressed", stored)
+			}
+			if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrMiss) {
+				t.Errorf("missing key: err = %v, want ErrMiss", err)
+			}
+		})
+	}
+}
+
+func TestCompressedCacheCodecChange(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryCache(100)
+	text := strings.Repeat("OCR text of a dense page. ", 100)
+	mem.Set(ctx, "plain", text, time.Minute) // Written before compression was enabled
+
+	gz, _ := NewCompressedCache(mem, CompressionGzip, 0)
+	gz.Set(ctx, "gzip", text, time.Minute)
+	zs, err := NewCompressedCache(mem, CompressionZstd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"plain", "gzip"} {
+		if got, err := zs.Get(ctx, key); err != nil || got != text {
+			t.Errorf("%s read with zstd: %d bytes, %v", key, len(got), err)
+		}
+	}
+
+	mem.Set(ctx, "corrupt", markerZstd+"not zstd", time.Minute)
+	if _, err := zs.Get(ctx, "corrupt"); err == nil {
+		t.Error("corrupt entry decoded without error")
+	}
+	if _, err := NewCompressedCache(mem, "lz4", 0); err == nil {
+		t.Error("unknown codec accepted")
+	}
+}
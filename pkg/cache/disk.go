@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of DiskFromEnv
+const (
+	DefaultDiskDir      = "cache"
+	DefaultDiskMaxBytes = 1 << 30
+)
+
+// DiskCache stores entries as files under a directory, so a single node keeps
+// its cache (OCR texts, PDF locations) across restarts without Redis. Files
+// are named by the SHA-256 of their key, the first line of a file holds the
+// expiration. When the files exceed maxBytes the least recently used are
+// removed; recency survives restarts through the modification times.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List // Front: most recently used
+}
+
+type diskEntry struct {
+	name string // SHA-256 of the key
+	size int64
+}
+
+// NewDiskCache opens (or creates) the cache in dir, holding at most maxBytes
+// of files (0: unbounded)
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+	c := &DiskCache{dir: dir, maxBytes: maxBytes, entries: make(map[string]*list.Element), lru: list.New()}
+
+	// Rebuild the LRU from the files of the previous runs, oldest at the back
+	type file struct {
+		entry   *diskEntry
+		modTime time.Time
+	}
+	var files []file
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// Only the files of the cache are adopted: anything else in the directory
+		// (or in the wrong shard) is left alone and not counted
+		name, isTmp := d.Name(), false
+		if filepath.Ext(name) == ".tmp" {
+			name, _, _ = strings.Cut(name, "-")
+			isTmp = true
+		}
+		if !isDiskName(name) || filepath.Dir(path) != filepath.Join(dir, name[:2]) {
+			return nil
+		}
+		if isTmp {
+			os.Remove(path) // Write interrupted by a crash
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed meanwhile
+		}
+		files = append(files, file{entry: &diskEntry{name: d.Name(), size: info.Size()}, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory %s: %w", dir, err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for _, f := range files {
+		c.entries[f.entry.name] = c.lru.PushBack(f.entry)
+		c.size += f.entry.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// DiskFromEnv opens the cache in CACHE_DIR (default cache) capped at
+// CACHE_MAX_MB megabytes (default 1024)
+func DiskFromEnv() (*DiskCache, error) {
+	dir := os.Getenv("CACHE_DIR")
+	if dir == "" {
+		dir = DefaultDiskDir
+	}
+	maxBytes := int64(DefaultDiskMaxBytes)
+	if v := os.Getenv("CACHE_MAX_MB"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("CACHE_MAX_MB must be a positive number of megabytes, got %q", v)
+		}
+		maxBytes = n << 20
+	}
+	return NewDiskCache(dir, maxBytes)
+}
+
+// Name implements Cache
+func (c *DiskCache) Name() string { return "disk" }
+
+// Get implements Cache
+func (c *DiskCache) Get(ctx context.Context, key string) (string, error) {
+	name := diskName(key)
+	data, err := os.ReadFile(c.path(name))
+	if os.IsNotExist(err) {
+		return "", ErrMiss
+	}
+	if err != nil {
+		return "", err
+	}
+	header, value, ok := bytes.Cut(data, []byte("\n"))
+	expiresAt, err := strconv.ParseInt(string(header), 10, 64)
+	if !ok || err != nil || (expiresAt > 0 && time.Now().UnixNano() > expiresAt) {
+		c.Delete(ctx, key)
+		return "", ErrMiss
+	}
+
+	now := time.Now()
+	os.Chtimes(c.path(name), now, now)
+	c.mu.Lock()
+	if elem, ok := c.entries[name]; ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	return string(value), nil
+}
+
+// Set implements Cache. The file is written next to its final name and
+// renamed, so readers never see a partial entry.
+func (c *DiskCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	name := diskName(key)
+	path := c.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(tmp, "%d\n%s", expiresAt, value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	size := int64(len(strconv.FormatInt(expiresAt, 10)) + 1 + len(value))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[name]; ok {
+		entry := elem.Value.(*diskEntry)
+		c.size += size - entry.size
+		entry.size = size
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[name] = c.lru.PushFront(&diskEntry{name: name, size: size})
+		c.size += size
+	}
+	c.evict()
+	return nil
+}
+
+// Delete implements Cache
+func (c *DiskCache) Delete(ctx context.Context, key string) error {
+	name := diskName(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[name]; ok {
+		c.removeElement(elem)
+	}
+	if err := os.Remove(c.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Size returns the bytes used by the entries, including expired ones not yet
+// removed
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evict removes the least recently used files until the cache fits in
+// maxBytes. The caller holds c.mu.
+func (c *DiskCache) evict() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.lru.Len() > 0 {
+		elem := c.lru.Back()
+		os.Remove(c.path(elem.Value.(*diskEntry).name))
+		c.removeElement(elem)
+	}
+}
+
+func (c *DiskCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*diskEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.name)
+	c.size -= entry.size
+}
+
+// path spreads the files over 256 subdirectories, by the first two characters
+// of the name (always a diskName)
+func (c *DiskCache) path(name string) string {
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+func diskName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// isDiskName reports whether name is a file name of diskName
+func isDiskName(name string) bool {
+	if len(name) != 2*sha256.Size {
+		return false
+	}
+	for _, r := range name {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Entries without TTL take 2 bytes ("0\n") more than their value
+var diskValue = strings.Repeat("x", 100)
+
+func TestDiskCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewDiskCache(t.TempDir(), 310) // Three entries of 102 bytes
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(ctx, key, diskValue, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Get(ctx, "a"); err != nil { // a is now more recent than b
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "d", diskValue, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "b"); err != ErrMiss {
+		t.Errorf("least recently used entry: %v, want it evicted", err)
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	if size := c.Size(); size != 306 {
+		t.Errorf("size = %d, want 306", size)
+	}
+	if _, err := os.Stat(c.path(diskName("b"))); !os.IsNotExist(err) {
+		t.Errorf("file of the evicted entry: %v, want it removed", err)
+	}
+}
+
+func TestDiskCacheRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a used last, then c, then b
+	base := time.Now().Add(-time.Hour)
+	for i, key := range []string{"b", "c", "a"} {
+		if err := c.Set(ctx, key, diskValue, 0); err != nil {
+			t.Fatal(err)
+		}
+		at := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(c.path(diskName(key)), at, at)
+	}
+
+	// Files that are not entries of the cache
+	foreign := map[string]string{
+		"README":                           "not an entry",
+		"x":                                "short name at the root",
+		filepath.Join("zz", "y"):           "short name in a directory",
+		filepath.Join("00", diskName("a")): "entry name in the wrong shard",
+		filepath.Join("zz", strings.Repeat("Z", 64)): "not hex",
+	}
+	for name, content := range foreign {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Write interrupted by a crash
+	name := diskName("d")
+	tmp := filepath.Join(dir, name[:2], name+"-123.tmp")
+	os.MkdirAll(filepath.Dir(tmp), 0o755)
+	os.WriteFile(tmp, []byte("0\npartial"), 0o644)
+
+	// Reopened with room for two entries: b, the least recently used, is evicted
+	c, err = NewDiskCache(dir, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := c.Size(); size != 204 {
+		t.Errorf("size = %d, want 204 (foreign files not counted)", size)
+	}
+	for _, key := range []string{"a", "c"} {
+		if got, err := c.Get(ctx, key); err != nil || got != diskValue {
+			t.Errorf("%s after restart: %d bytes, %v", key, len(got), err)
+		}
+	}
+	if _, err := c.Get(ctx, "b"); err != ErrMiss {
+		t.Errorf("b after restart: %v, want it evicted", err)
+	}
+	for name := range foreign {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("foreign file %s: %v, want it kept", name, err)
+		}
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temporary file: %v, want it removed", err)
+	}
+}
+
+func TestDiskCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "short", "value", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "long", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := c.Get(ctx, "short"); err != ErrMiss {
+		t.Errorf("expired entry: %v, want a miss", err)
+	}
+	if _, err := os.Stat(c.path(diskName("short"))); !os.IsNotExist(err) {
+		t.Errorf("file of the expired entry: %v, want it removed", err)
+	}
+	if got, err := c.Get(ctx, "long"); err != nil || got != "value" {
+		t.Errorf("entry = %q, %v; want value", got, err)
+	}
+	if err := c.Delete(ctx, "long"); err != nil {
+		t.Fatal(err)
+	}
+	if size := c.Size(); size != 0 {
+		t.Errorf("size after expiry and delete = %d, want 0", size)
+	}
+}
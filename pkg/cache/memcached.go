@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Memcached limits: keys are at most 250 bytes without spaces or control
+// characters, expirations over 30 days are read as Unix timestamps
+const (
+	memcachedMaxKey    = 250
+	memcachedMaxRelTTL = 30 * 24 * time.Hour
+	memcachedMaxIdle   = 8 // Idle connections kept per server
+)
+
+// MemcachedCache stores entries in memcached servers (text protocol). Keys
+// are spread over the servers by hash, so every client must list the same
+// servers in the same order.
+type MemcachedCache struct {
+	servers []string
+	timeout time.Duration
+	idle    []chan *memcachedConn // Per server
+}
+
+// NewMemcachedCache creates a cache on servers (host:port); timeout bounds
+// each operation
+func NewMemcachedCache(servers []string, timeout time.Duration) *MemcachedCache {
+	c := &MemcachedCache{servers: servers, timeout: timeout, idle: make([]chan *memcachedConn, len(servers))}
+	for i := range c.idle {
+		c.idle[i] = make(chan *memcachedConn, memcachedMaxIdle)
+	}
+	return c
+}
+
+// MemcachedFromEnv creates a cache on MEMCACHED_SERVERS (comma separated,
+// default localhost:11211) with MEMCACHED_TIMEOUT (default 1s)
+func MemcachedFromEnv() (*MemcachedCache, error) {
+	servers := []string{"localhost:11211"}
+	if v := os.Getenv("MEMCACHED_SERVERS"); v != "" {
+		servers = servers[:0]
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				servers = append(servers, s)
+			}
+		}
+		if len(servers) == 0 {
+			return nil, fmt.Errorf("MEMCACHED_SERVERS must list host:port addresses, got %q", v)
+		}
+	}
+	timeout := time.Second
+	if v := os.Getenv("MEMCACHED_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("MEMCACHED_TIMEOUT must be a positive duration such as 500ms, got %q", v)
+		}
+		timeout = d
+	}
+	return NewMemcachedCache(servers, timeout), nil
+}
+
+// Name implements Cache
+func (c *MemcachedCache) Name() string { return "memcached" }
+
+// Get implements Cache
+func (c *MemcachedCache) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := c.do(ctx, key, func(conn *memcachedConn, key string) error {
+		fmt.Fprintf(conn.rw, "get %s\r\n", key)
+		if err := conn.rw.Flush(); err != nil {
+			return err
+		}
+		line, err := conn.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return ErrMiss
+		}
+		// VALUE <key> <flags> <bytes>
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[0] != "VALUE" {
+			return memcachedError(line)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return fmt.Errorf("memcached: invalid reply %q", line)
+		}
+		data := make([]byte, size+2) // Value and \r\n
+		if _, err := io.ReadFull(conn.rw, data); err != nil {
+			return err
+		}
+		value = string(data[:size])
+		if line, err = conn.readLine(); err != nil {
+			return err
+		} else if line != "END" {
+			return fmt.Errorf("memcached: invalid reply %q", line)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Set implements Cache
+func (c *MemcachedCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	exptime := int64(0)
+	switch {
+	case ttl > memcachedMaxRelTTL:
+		exptime = time.Now().Add(ttl).Unix()
+	case ttl > 0:
+		exptime = int64((ttl + time.Second - 1) / time.Second) // At least 1s
+	}
+	return c.do(ctx, key, func(conn *memcachedConn, key string) error {
+		fmt.Fprintf(conn.rw, "set %s 0 %d %d\r\n%s\r\n", key, exptime, len(value), value)
+		if err := conn.rw.Flush(); err != nil {
+			return err
+		}
+		line, err := conn.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "STORED" {
+			return memcachedError(line)
+		}
+		return nil
+	})
+}
+
+// Delete implements Cache
+func (c *MemcachedCache) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, key, func(conn *memcachedConn, key string) error {
+		fmt.Fprintf(conn.rw, "delete %s\r\n", key)
+		if err := conn.rw.Flush(); err != nil {
+			return err
+		}
+		line, err := conn.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "DELETED" && line != "NOT_FOUND" {
+			return memcachedError(line)
+		}
+		return nil
+	})
+}
+
+type memcachedConn struct {
+	net.Conn
+	rw *bufio.ReadWriter
+}
+
+func (c *memcachedConn) readLine() (string, error) {
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// memcachedReplyError is an error reported by the server, the connection
+// stays usable
+type memcachedReplyError struct{ reply string }
+
+func (e *memcachedReplyError) Error() string { return "memcached: " + e.reply }
+
+func memcachedError(line string) error {
+	if strings.HasPrefix(line, "SERVER_ERROR") || strings.HasPrefix(line, "CLIENT_ERROR") || line == "ERROR" {
+		return &memcachedReplyError{reply: line}
+	}
+	return fmt.Errorf("memcached: unexpected reply %q", line)
+}
+
+// do runs op on a connection to the server of key. Connections are reused
+// unless the operation failed on the network or the protocol.
+func (c *MemcachedCache) do(ctx context.Context, key string, op func(conn *memcachedConn, key string) error) error {
+	key = memcachedKey(key)
+	server := int(crc32.ChecksumIEEE([]byte(key)) % uint32(len(c.servers)))
+	conn, err := c.conn(ctx, server)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	err = op(conn, key)
+	if _, replyErr := err.(*memcachedReplyError); err == nil || err == ErrMiss || replyErr {
+		select {
+		case c.idle[server] <- conn:
+		default:
+			conn.Close()
+		}
+	} else {
+		conn.Close()
+	}
+	return err
+}
+
+func (c *MemcachedCache) conn(ctx context.Context, server int) (*memcachedConn, error) {
+	select {
+	case conn := <-c.idle[server]:
+		return conn, nil
+	default:
+	}
+	d := net.Dialer{Timeout: c.timeout}
+	nc, err := d.DialContext(ctx, "tcp", c.servers[server])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to memcached at %s: %w", c.servers[server], err)
+	}
+	return &memcachedConn{Conn: nc, rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))}, nil
+}
+
+// memcachedKey replaces keys memcached does not accept (too long, spaces or
+// control characters) by their hash
+func memcachedKey(key string) string {
+	valid := len(key) > 0 && len(key) <= memcachedMaxKey
+	for i := 0; valid && i < len(key); i++ {
+		valid = key[i] > ' ' && key[i] != 0x7f
+	}
+	if valid {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMemcached is a memcached server speaking the text protocol. Keys
+// starting with "server-error" get SERVER_ERROR replies, keys starting with
+// "garbage" get a reply that is not memcached.
+type fakeMemcached struct {
+	addr     string
+	mu       sync.Mutex
+	items    map[string]string
+	exptimes map[string]string
+	conns    int // Connections accepted
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeMemcached{addr: ln.Addr().String(), items: map[string]string{}, exptimes: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			fmt.Fprint(conn, "ERROR\r\n")
+			continue
+		}
+		key := fields[1]
+		f.mu.Lock()
+		switch {
+		case strings.HasPrefix(key, "garbage"):
+			fmt.Fprint(conn, "HELLO\r\n")
+		case fields[0] == "set" && len(fields) == 5:
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			if strings.HasPrefix(key, "server-error") {
+				fmt.Fprint(conn, "SERVER_ERROR out of memory storing object\r\n")
+				break
+			}
+			f.items[key], f.exptimes[key] = string(data[:size]), fields[3]
+			fmt.Fprint(conn, "STORED\r\n")
+		case fields[0] == "get":
+			if value, ok := f.items[key]; ok {
+				fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\n", key, len(value), value)
+			}
+			fmt.Fprint(conn, "END\r\n")
+		case fields[0] == "delete":
+			if _, ok := f.items[key]; !ok {
+				fmt.Fprint(conn, "NOT_FOUND\r\n")
+				break
+			}
+			delete(f.items, key)
+			fmt.Fprint(conn, "DELETED\r\n")
+		default:
+			fmt.Fprint(conn, "ERROR\r\n")
+		}
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeMemcached) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func TestMemcachedCache(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeMemcached(t)
+	c := NewMemcachedCache([]string{f.addr}, time.Second)
+
+	if _, err := c.Get(ctx, "missing"); err != ErrMiss {
+		t.Fatalf("Get of a missing key = %v, want ErrMiss", err)
+	}
+	value := "line 1\r\nline 2 with END\r\n" // The reply is read by length, not by line
+	if err := c.Set(ctx, "ocr:abc", value, 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Get(ctx, "ocr:abc"); err != nil || got != value {
+		t.Fatalf("Get = %q, %v; want %q", got, err, value)
+	}
+	if err := c.Set(ctx, "empty", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Get(ctx, "empty"); err != nil || got != "" {
+		t.Errorf("Get of an empty value = %q, %v", got, err)
+	}
+	if err := c.Delete(ctx, "ocr:abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, "ocr:abc"); err != nil {
+		t.Errorf("Delete of a missing key = %v, want no error", err)
+	}
+	if _, err := c.Get(ctx, "ocr:abc"); err != ErrMiss {
+		t.Errorf("Get after Delete = %v, want ErrMiss", err)
+	}
+
+	// TTLs are rounded up to seconds; beyond 30 days they are Unix timestamps
+	c.Set(ctx, "long", "v", 31*24*time.Hour)
+	f.mu.Lock()
+	short, long := f.exptimes["ocr:abc"], f.exptimes["long"]
+	f.mu.Unlock()
+	if short != "2" {
+		t.Errorf("exptime of 1.5s = %s, want 2", short)
+	}
+	if exptime, _ := strconv.ParseInt(long, 10, 64); exptime < time.Now().Unix() {
+		t.Errorf("exptime of 31 days = %s, want a Unix timestamp", long)
+	}
+
+	if n := f.connections(); n != 1 {
+		t.Errorf("%d connections, want the connection reused", n)
+	}
+}
+
+func TestMemcachedConnectionReuse(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeMemcached(t)
+	c := NewMemcachedCache([]string{f.addr}, time.Second)
+
+	// A server error leaves the connection usable
+	err := c.Set(ctx, "server-error", "v", 0)
+	if _, ok := err.(*memcachedReplyError); !ok || !strings.Contains(err.Error(), "SERVER_ERROR out of memory") {
+		t.Fatalf("Set = %v, want the server error", err)
+	}
+	if err := c.Set(ctx, "key", "v", 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.connections(); n != 1 {
+		t.Errorf("%d connections after a server error, want 1", n)
+	}
+
+	// A reply out of the protocol closes the connection
+	if _, err := c.Get(ctx, "garbage"); err == nil || !strings.Contains(err.Error(), `unexpected reply "HELLO"`) {
+		t.Fatalf("Get = %v, want the unexpected reply", err)
+	}
+	if got, err := c.Get(ctx, "key"); err != nil || got != "v" {
+		t.Fatalf("Get after a protocol error = %q, %v", got, err)
+	}
+	if n := f.connections(); n != 2 {
+		t.Errorf("%d connections after a protocol error, want a new one", n)
+	}
+}
+
+func TestMemcachedUnreachable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	c := NewMemcachedCache([]string{addr}, 100*time.Millisecond)
+	if _, err := c.Get(context.Background(), "key"); err == nil || !strings.Contains(err.Error(), "failed to connect to memcached at "+addr) {
+		t.Errorf("Get = %v, want the connection error", err)
+	}
+}
+
+func TestMemcachedKey(t *testing.T) {
+	long := strings.Repeat("k", memcachedMaxKey+1)
+	tests := []struct {
+		key    string
+		hashed bool
+	}{
+		{"ocr:abc", false},
+		{"imagehash:0123:lang_vi", false},
+		{strings.Repeat("k", memcachedMaxKey), false},
+		{long, true},
+		{"", true},
+		{"with space", true},
+		{"tab\there", true},
+		{"new\nline", true},
+		{"del\x7f", true},
+		{"tiếng việt", true}, // Spaces
+		{"tiếng_việt", false},
+	}
+	for _, tt := range tests {
+		got := memcachedKey(tt.key)
+		if !tt.hashed && got != tt.key {
+			t.Errorf("memcachedKey(%q) = %q, want it unchanged", tt.key, got)
+		}
+		if tt.hashed && (!strings.HasPrefix(got, "sha256:") || len(got) != len("sha256:")+64) {
+			t.Errorf("memcachedKey(%q) = %q, want its hash", tt.key, got)
+		}
+	}
+	if memcachedKey(long) == memcachedKey(long+"x") {
+		t.Error("different long keys have the same hash")
+	}
+
+	// Hashed keys still reach the server
+	ctx := context.Background()
+	c := NewMemcachedCache([]string{newFakeMemcached(t).addr}, time.Second)
+	if err := c.Set(ctx, "with space", "v", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Get(ctx, "with space"); err != nil || got != "v" {
+		t.Errorf("Get of a hashed key = %q, %v", got, err)
+	}
+}
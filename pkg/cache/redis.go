@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisCache stores entries as Redis strings. It persists across restarts
+// and is shared by every worker using the same Redis.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCache creates a RedisCache; prefix is prepended to every key
+func NewRedisCache(client *redis.Client, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+// Name implements Cache
+func (c *RedisCache) Name() string { return "redis" }
+
+// Get implements Cache
+func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Result()
+	if err == redis.Nil {
+		return "", ErrMiss
+	}
+	return value, err
+}
+
+// Set implements Cache
+func (c *RedisCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+// Delete implements Cache
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
+
+// DeletePrefix implements PrefixDeleter with SCAN, so Redis is not blocked
+// on large databases
+func (c *RedisCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	pattern := globEscaper.Replace(c.prefix+prefix) + "*"
+	deleted := 0
+	iter := c.client.Scan(ctx, 0, pattern, 500).Iterator()
+	var batch []string
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == 500 {
+			n, err := c.client.Del(ctx, batch...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted, batch = deleted+int(n), batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	if len(batch) > 0 {
+		n, err := c.client.Del(ctx, batch...).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+	return deleted, nil
+}
+
+// globEscaper escapes the characters special in SCAN MATCH patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
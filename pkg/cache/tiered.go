@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// TieredCache checks a fast local cache (L1) before a shared cache (L2).
+// Writes go to both tiers; L2 hits are copied into L1 with L1TTL.
+type TieredCache struct {
+	L1    Cache
+	L2    Cache
+	L1TTL time.Duration // Upper bound for L1 entries, 0: use the entry TTL
+}
+
+// NewTieredCache creates a TieredCache
+func NewTieredCache(l1, l2 Cache, l1TTL time.Duration) *TieredCache {
+	return &TieredCache{L1: l1, L2: l2, L1TTL: l1TTL}
+}
+
+// Name implements Cache
+func (c *TieredCache) Name() string { return "tiered(" + c.L1.Name() + "+" + c.L2.Name() + ")" }
+
+// Get implements Cache
+func (c *TieredCache) Get(ctx context.Context, key string) (string, error) {
+	if value, err := c.L1.Get(ctx, key); err == nil {
+		return value, nil
+	}
+	value, err := c.L2.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	c.L1.Set(ctx, key, value, c.L1TTL) // Best effort, L2 stays the source of truth
+	return value, nil
+}
+
+// Set implements Cache
+func (c *TieredCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := c.L2.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	return c.L1.Set(ctx, key, value, c.l1TTL(ttl))
+}
+
+// Delete implements Cache
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	c.L1.Delete(ctx, key)
+	return c.L2.Delete(ctx, key)
+}
+
+// DeletePrefix implements PrefixDeleter; the count is the one of L2
+func (c *TieredCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	DeletePrefix(ctx, c.L1, prefix)
+	return DeletePrefix(ctx, c.L2, prefix)
+}
+
+func (c *TieredCache) l1TTL(ttl time.Duration) time.Duration {
+	if c.L1TTL > 0 && (ttl == 0 || ttl > c.L1TTL) {
+		return c.L1TTL
+	}
+	return ttl
+}
@@ -0,0 +1,98 @@
+// Package config holds the settings shared by the API server, the worker and
+// the CLI: where Redis and Kafka are, and where files are stored.
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the deployment configuration. Options specific to one component
+// (OCR engine, storage backend, event sinks...) stay in their own variables.
+type Config struct {
+	RedisAddr    string   // REDIS_ADDR
+	KafkaBrokers []string // KAFKA_BROKERS, comma separated
+	KafkaTopic   string   // KAFKA_TOPIC, jobs sent by the API to the workers
+	KafkaGroupID string   // KAFKA_GROUP_ID, consumer group of the workers
+	// OutputDir is the root of the file storage, uploads, quarantined inputs
+	// and engine caches (OUTPUT_DIR). The API and the workers must share it.
+	OutputDir  string
+	ListenAddr string // LISTEN_ADDR of the API server
+	APIURL     string // API_URL used by the submit and status commands
+	APIKey     string // API_KEY of the tenant, sent by the submit and status commands
+	// AdminAddr serves the profiler of the API server and the workers
+	// (ADMIN_ADDR, e.g. 127.0.0.1:6060), empty to disable it
+	AdminAddr string
+}
+
+// Default returns the configuration of a local development setup
+// (docker-compose infrastructure, services started from the repository root)
+func Default() Config {
+	return Config{
+		RedisAddr:    "localhost:6379",
+		KafkaBrokers: []string{"localhost:9092"},
+		KafkaTopic:   "image_processing_jobs",
+		KafkaGroupID: "image-processor-group",
+		OutputDir:    "../output",
+		ListenAddr:   ":8080",
+		APIURL:       "http://localhost:8080",
+	}
+}
+
+// FromEnv returns the default configuration overridden by the environment
+func FromEnv() Config {
+	c := Default()
+	for name, value := range map[string]*string{
+		"REDIS_ADDR":     &c.RedisAddr,
+		"KAFKA_TOPIC":    &c.KafkaTopic,
+		"KAFKA_GROUP_ID": &c.KafkaGroupID,
+		"OUTPUT_DIR":     &c.OutputDir,
+		"LISTEN_ADDR":    &c.ListenAddr,
+		"ADMIN_ADDR":     &c.AdminAddr,
+		"API_URL":        &c.APIURL,
+		"API_KEY":        &c.APIKey,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*value = v
+		}
+	}
+	if v := os.Getenv("KAFKA_BROKERS"); v != "" {
+		c.KafkaBrokers = splitList(v)
+	}
+	return c
+}
+
+// RegisterFlags adds flags overriding the configuration to fs
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.RedisAddr, "redis", c.RedisAddr, "Redis address")
+	fs.Func("kafka", "Kafka brokers, comma separated (default "+strings.Join(c.KafkaBrokers, ",")+")", func(v string) error {
+		c.KafkaBrokers = splitList(v)
+		return nil
+	})
+	fs.StringVar(&c.KafkaTopic, "topic", c.KafkaTopic, "Kafka topic of the jobs")
+	fs.StringVar(&c.AdminAddr, "admin", c.AdminAddr, "Address of the profiling endpoints of serve and worker (empty: disabled)")
+	fs.StringVar(&c.OutputDir, "output", c.OutputDir, "Root directory of uploads, file storage and caches")
+	fs.StringVar(&c.APIURL, "api", c.APIURL, "API URL used by submit and status")
+	fs.StringVar(&c.APIKey, "api-key", c.APIKey, "API key sent by submit and status (multi-tenant API)")
+}
+
+// UploadDir is where the API stores uploaded inputs read by the workers
+func (c Config) UploadDir() string { return filepath.Join(c.OutputDir, "uploads") }
+
+// QuarantineDir is where the worker keeps inputs that crashed it
+func (c Config) QuarantineDir() string { return filepath.Join(c.OutputDir, "quarantine") }
+
+// CacheDir is where engine capabilities are cached between restarts
+func (c Config) CacheDir() string { return filepath.Join(c.OutputDir, "cache") }
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envRefPattern matches the ${VAR} references expanded by ExpandEnv
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces the ${VAR} references in a JSON document with the values
+// of the environment variables, escaped for use inside a JSON string, so
+// secrets of config files (API keys, webhook URLs) can stay in the
+// environment. An unset variable is an error; a "$" not followed by "{" is
+// kept as is.
+func ExpandEnv(data []byte) ([]byte, error) {
+	var missing []string
+	expanded := envRefPattern.ReplaceAllFunc(data, func(ref []byte) []byte {
+		name := string(envRefPattern.FindSubmatch(ref)[1])
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+			return ref
+		}
+		quoted, _ := json.Marshal(value)
+		return quoted[1 : len(quoted)-1]
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("CONFIG_TOKEN", `s3cr"et\`)
+	t.Setenv("CONFIG_EMPTY", "")
+	tests := []struct {
+		in      string
+		want    string
+		missing string // Expected in the error, "" when expansion succeeds
+	}{
+		{`{"token": "${CONFIG_TOKEN}"}`, `{"token": "s3cr\"et\\"}`, ""},
+		{`{"token": "${CONFIG_EMPTY}"}`, `{"token": ""}`, ""},
+		{`{"price": "$5", "re": "^a$", "var": "$CONFIG_TOKEN"}`, `{"price": "$5", "re": "^a$", "var": "$CONFIG_TOKEN"}`, ""},
+		{`{"a": "${CONFIG_UNSET_1}", "b": "${CONFIG_UNSET_2}"}`, "", "CONFIG_UNSET_1, CONFIG_UNSET_2"},
+		{`{"a": "${not valid}"}`, `{"a": "${not valid}"}`, ""},
+	}
+	for _, tt := range tests {
+		got, err := ExpandEnv([]byte(tt.in))
+		if tt.missing != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.missing) {
+				t.Errorf("ExpandEnv(%s) error = %v, want one naming %s", tt.in, err, tt.missing)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Errorf("ExpandEnv(%s) = %s, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package delivery uploads finished PDFs to the cloud storage of the users
+// (Google Drive, Dropbox) with OAuth credentials the tenant authorized, so
+// that results land where the users already work.
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Providers
+const (
+	ProviderGoogleDrive = "gdrive"
+	ProviderDropbox     = "dropbox"
+)
+
+// HTTPTimeout bounds each request to a provider
+const HTTPTimeout = 2 * time.Minute
+
+// Endpoints of the providers, replaced in tests
+var (
+	googleTokenURL   = "https://oauth2.googleapis.com/token"
+	googleUploadURL  = "https://www.googleapis.com/upload/drive/v3/files?uploadType=multipart&fields=id,name,webViewLink"
+	dropboxTokenURL  = "https://api.dropboxapi.com/oauth2/token"
+	dropboxUploadURL = "https://content.dropboxapi.com/2/files/upload"
+)
+
+// Target is a destination of a tenant, declared in the tenants file:
+//
+//	"delivery": {
+//	  "drive": {"provider": "gdrive", "folder": "<folder ID>",
+//	            "client_id": "...", "client_secret": "${ACME_DRIVE_SECRET}",
+//	            "refresh_token": "${ACME_DRIVE_REFRESH_TOKEN}"},
+//	  "dropbox": {"provider": "dropbox", "folder": "/Translations",
+//	              "access_token": "${ACME_DROPBOX_TOKEN}"}
+//	}
+//
+// With a refresh token the access tokens are requested as needed; a bare
+// access token is used until it expires.
+type Target struct {
+	Provider string `json:"provider"`
+	// Folder receiving the files: the ID of a Drive folder (default the
+	// root of My Drive), or a Dropbox path such as "/Translations"
+	// (default the root of the app folder)
+	Folder       string `json:"folder,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// Validate checks the provider and the credentials
+func (t *Target) Validate() error {
+	switch t.Provider {
+	case ProviderGoogleDrive:
+	case ProviderDropbox:
+		if t.Folder != "" && !strings.HasPrefix(t.Folder, "/") {
+			return fmt.Errorf("dropbox folder must start with '/', got %q", t.Folder)
+		}
+	default:
+		return fmt.Errorf("provider must be %q or %q, got %q", ProviderGoogleDrive, ProviderDropbox, t.Provider)
+	}
+	if t.RefreshToken != "" {
+		if t.ClientID == "" || t.ClientSecret == "" {
+			return errors.New("client_id and client_secret are required with refresh_token")
+		}
+	} else if t.AccessToken == "" {
+		return errors.New("access_token or refresh_token is required")
+	}
+	return nil
+}
+
+// File is a file uploaded to a target
+type File struct {
+	ID   string `json:"file_id"`
+	Path string `json:"path,omitempty"` // Dropbox
+	URL  string `json:"url,omitempty"`  // Drive: link opening the file
+}
+
+// Error is an error answered by a provider
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// Temporary reports whether uploading again later may succeed: rate limits
+// and errors of the provider, not refused credentials or folders
+func (e *Error) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// Uploader uploads files to one target, refreshing its access token. It is
+// safe for concurrent use.
+type Uploader struct {
+	target *Target
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time // Zero: unknown, used until refused
+}
+
+// New creates an uploader for target
+func New(target *Target) *Uploader {
+	return &Uploader{target: target, client: &http.Client{Timeout: HTTPTimeout}, token: target.AccessToken}
+}
+
+// Upload stores data as a new file named name in the folder of the target.
+// An existing file with the same name is kept: Drive allows duplicates,
+// Dropbox renames the new file ("scan (1).pdf").
+func (u *Uploader) Upload(ctx context.Context, name string, data []byte) (File, error) {
+	upload := u.uploadDrive
+	if u.target.Provider == ProviderDropbox {
+		upload = u.uploadDropbox
+	}
+	token, err := u.accessToken(ctx, false)
+	if err != nil {
+		return File{}, err
+	}
+	file, err := upload(ctx, token, name, data)
+	var providerErr *Error
+	if errors.As(err, &providerErr) && providerErr.Status == http.StatusUnauthorized && u.target.RefreshToken != "" {
+		// Access token revoked or expired early
+		if token, err = u.accessToken(ctx, true); err != nil {
+			return File{}, err
+		}
+		file, err = upload(ctx, token, name, data)
+	}
+	return file, err
+}
+
+// accessToken returns the current access token, requested with the refresh
+// token when there is none, it expires within a minute, or force is set
+func (u *Uploader) accessToken(ctx context.Context, force bool) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.target.RefreshToken == "" {
+		return u.token, nil
+	}
+	if !force && u.token != "" && (u.expires.IsZero() || time.Until(u.expires) > time.Minute) {
+		return u.token, nil
+	}
+	tokenURL := googleTokenURL
+	if u.target.Provider == ProviderDropbox {
+		tokenURL = dropboxTokenURL
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {u.target.RefreshToken},
+		"client_id":     {u.target.ClientID},
+		"client_secret": {u.target.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := u.do(req, &token); err != nil {
+		return "", fmt.Errorf("refresh access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("refresh access token: no access_token in the response")
+	}
+	u.token = token.AccessToken
+	u.expires = time.Time{}
+	if token.ExpiresIn > 0 {
+		u.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return u.token, nil
+}
+
+// do sends req and decodes the JSON response into v, or returns an *Error
+func (u *Uploader) do(req *http.Request, v any) error {
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &Error{Status: resp.StatusCode, Message: errorMessage(body)}
+	}
+	return json.Unmarshal(body, v)
+}
+
+// errorMessage extracts the message of an error response of Google
+// ({"error": {"message"}}, {"error_description"}) or Dropbox
+// ({"error_summary"}), or returns the start of the body
+func errorMessage(body []byte) string {
+	var e struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+		ErrorSummary     string          `json:"error_summary"`
+	}
+	if json.Unmarshal(body, &e) == nil {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		switch {
+		case e.ErrorSummary != "":
+			return e.ErrorSummary
+		case e.ErrorDescription != "":
+			return e.ErrorDescription
+		case json.Unmarshal(e.Error, &nested) == nil && nested.Message != "":
+			return nested.Message
+		}
+	}
+	message := strings.TrimSpace(string(body))
+	if len(message) > 200 {
+		message = message[:200]
+	}
+	return message
+}
@@ -0,0 +1,122 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeProviders serves the token and upload endpoints of both providers
+func fakeProviders(t *testing.T) (*httptest.Server, *[]string) {
+	var requests []string
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/token":
+			if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh-1" || r.FormValue("client_secret") != "secret" {
+				http.Error(w, `{"error": "invalid_grant", "error_description": "Bad refresh token"}`, http.StatusBadRequest)
+				return
+			}
+			tokens++
+			fmt.Fprintf(w, `{"access_token": "access-%d", "expires_in": 3600}`, tokens)
+		case "/drive":
+			if r.Header.Get("Authorization") != fmt.Sprintf("Bearer access-%d", tokens) || tokens < 2 {
+				// The first token is refused to check the refresh
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error": {"code": 401, "message": "Invalid Credentials"}}`)
+				return
+			}
+			_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			parts := multipart.NewReader(r.Body, params["boundary"])
+			meta, _ := parts.NextPart()
+			var metadata struct {
+				Name    string   `json:"name"`
+				Parents []string `json:"parents"`
+			}
+			json.NewDecoder(meta).Decode(&metadata)
+			content, _ := parts.NextPart()
+			data, _ := io.ReadAll(content)
+			if metadata.Name != "scan.pdf" || len(metadata.Parents) != 1 || metadata.Parents[0] != "folder-1" || string(data) != "%PDF" {
+				http.Error(w, "bad upload", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"id": "drive-file-1", "name": "scan.pdf", "webViewLink": "https://drive.example/file/drive-file-1"}`)
+		case "/dropbox":
+			var arg struct {
+				Path string `json:"path"`
+				Mode string `json:"mode"`
+			}
+			if err := json.Unmarshal([]byte(r.Header.Get("Dropbox-API-Arg")), &arg); err != nil || r.Header.Get("Authorization") != "Bearer static" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error_summary": "invalid_access_token/"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"id": "id:abc", "path_display": %q}`, arg.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	oldURLs := []string{googleTokenURL, googleUploadURL, dropboxTokenURL, dropboxUploadURL}
+	googleTokenURL, googleUploadURL = server.URL+"/token", server.URL+"/drive"
+	dropboxTokenURL, dropboxUploadURL = server.URL+"/token", server.URL+"/dropbox"
+	t.Cleanup(func() {
+		googleTokenURL, googleUploadURL, dropboxTokenURL, dropboxUploadURL = oldURLs[0], oldURLs[1], oldURLs[2], oldURLs[3]
+	})
+	return server, &requests
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	_, requests := fakeProviders(t)
+
+	drive := &Target{Provider: ProviderGoogleDrive, Folder: "folder-1", RefreshToken: "refresh-1", ClientID: "client", ClientSecret: "secret"}
+	if err := drive.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := New(drive).Upload(ctx, "scan.pdf", []byte("%PDF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ID != "drive-file-1" || file.URL == "" {
+		t.Errorf("drive file = %+v", file)
+	}
+	if got := strings.Join(*requests, " "); got != "/token /drive /token /drive" {
+		t.Errorf("requests = %s, want a refresh after the 401", got)
+	}
+
+	dropbox := &Target{Provider: ProviderDropbox, Folder: "/Bản dịch", AccessToken: "static"}
+	file, err = New(dropbox).Upload(ctx, "hóa đơn.pdf", []byte("%PDF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ID != "id:abc" || file.Path != "/Bản dịch/hóa đơn.pdf" {
+		t.Errorf("dropbox file = %+v", file)
+	}
+
+	_, err = New(&Target{Provider: ProviderDropbox, AccessToken: "revoked"}).Upload(ctx, "scan.pdf", nil)
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusUnauthorized || e.Temporary() || e.Message != "invalid_access_token/" {
+		t.Errorf("revoked token: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, target := range []Target{
+		{Provider: "onedrive", AccessToken: "x"},
+		{Provider: ProviderGoogleDrive},
+		{Provider: ProviderGoogleDrive, RefreshToken: "x"},
+		{Provider: ProviderDropbox, AccessToken: "x", Folder: "Translations"},
+	} {
+		if err := target.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", target)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+// uploadDrive creates the file with a multipart upload of the Drive API v3:
+// the JSON metadata (name, parent folder), then the content
+func (u *Uploader) uploadDrive(ctx context.Context, token, name string, data []byte) (File, error) {
+	metadata := map[string]any{"name": name, "mimeType": "application/pdf"}
+	if u.target.Folder != "" {
+		metadata["parents"] = []string{u.target.Folder}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return File{}, err
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{"application/json; charset=UTF-8", metadataJSON},
+		{"application/pdf", data},
+	} {
+		w, err := form.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return File{}, err
+		}
+		w.Write(part.data)
+	}
+	if err := form.Close(); err != nil {
+		return File{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleUploadURL, &body)
+	if err != nil {
+		return File{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+form.Boundary())
+	var created struct {
+		ID          string `json:"id"`
+		WebViewLink string `json:"webViewLink"`
+	}
+	if err := u.do(req, &created); err != nil {
+		return File{}, err
+	}
+	return File{ID: created.ID, URL: created.WebViewLink}, nil
+}
+
+// uploadDropbox creates the file with /2/files/upload (files up to 150 MB)
+func (u *Uploader) uploadDropbox(ctx context.Context, token, name string, data []byte) (File, error) {
+	arg, err := json.Marshal(map[string]any{
+		"path":       path.Join("/", u.target.Folder, name),
+		"mode":       "add",
+		"autorename": true,
+	})
+	if err != nil {
+		return File{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dropboxUploadURL, bytes.NewReader(data))
+	if err != nil {
+		return File{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Dropbox-API-Arg", asciiJSON(string(arg)))
+	var created struct {
+		ID          string `json:"id"`
+		PathDisplay string `json:"path_display"`
+	}
+	if err := u.do(req, &created); err != nil {
+		return File{}, err
+	}
+	return File{ID: created.ID, Path: created.PathDisplay}, nil
+}
+
+// asciiJSON escapes the non-ASCII characters of a JSON document as \uXXXX,
+// as required for the JSON passed in a header of the Dropbox API
+func asciiJSON(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			b.WriteRune(r)
+		case r > 0xFFFF:
+			// Surrogate pair
+			r -= 0x10000
+			fmt.Fprintf(&b, `\u%04x\u%04x`, 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+		default:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SchemaVersion is the version of the Event JSON schema. It changes only
+// when a field is removed or changes meaning; new fields may be added.
+const SchemaVersion = 1
+
+// Event types
+const (
+	TypeJobCompleted = "job.completed"
+	TypeJobFailed    = "job.failed"
+)
+
+// Event is the final state of a job as published to the sinks.
+//
+// JSON schema (version 1):
+//
+//	{
+//	  "schema_version": 1,
+//	  "event_id":       "uuid, unique per event (use it to deduplicate)",
+//	  "type":           "job.completed" | "job.failed",
+//	  "occurred_at":    "RFC 3339 timestamp",
+//	  "job_id":         "uuid of the job",
+//	  "status":         "completed" | "failed",
+//	  "pdf_key":        "storage key of the PDF (completed only)",
+//	  "cached":         true if the result was reused from the cache,
+//	  "error":          "error message (failed only)",
+//	  "details":        {"ocr_ms": "...", ...} job details as strings
+//	}
+type Event struct {
+	SchemaVersion int               `json:"schema_version"`
+	EventID       string            `json:"event_id"`
+	Type          string            `json:"type"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+	JobID         string            `json:"job_id"`
+	Status        string            `json:"status"`
+	PDFKey        string            `json:"pdf_key,omitempty"`
+	Cached        bool              `json:"cached"`
+	Error         string            `json:"error,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+}
+
+// JobCompleted builds the event for a successful job
+func JobCompleted(jobID string, details map[string]string) Event {
+	return Event{
+		SchemaVersion: SchemaVersion,
+		EventID:       uuid.New().String(),
+		Type:          TypeJobCompleted,
+		OccurredAt:    time.Now().UTC(),
+		JobID:         jobID,
+		Status:        "completed",
+		PDFKey:        details["pdf_path"],
+		Cached:        details["cached"] == "true",
+		Details:       details,
+	}
+}
+
+// JobFailed builds the event for a failed job
+func JobFailed(jobID string, err error, details map[string]string) Event {
+	return Event{
+		SchemaVersion: SchemaVersion,
+		EventID:       uuid.New().String(),
+		Type:          TypeJobFailed,
+		OccurredAt:    time.Now().UTC(),
+		JobID:         jobID,
+		Status:        "failed",
+		Error:         err.Error(),
+		Details:       details,
+	}
+}
+
+// Sink receives published events
+type Sink interface {
+	// Name identifies the sink in logs
+	Name() string
+	// Publish delivers one event
+	Publish(ctx context.Context, event Event) error
+	// Close releases connections and flushes buffers
+	Close() error
+}
@@ -0,0 +1,8 @@
+module github.com/mxngoc2104/KTPM-CS2/pkg/events
+
+go 1.24.2
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/segmentio/kafka-go v0.4.47
+)
@@ -0,0 +1,223 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+)
+
+// SinkConfig declares one sink and the events routed to it.
+//
+// Example config file:
+//
+//	{
+//	  "sinks": [
+//	    {"name": "audit", "type": "file", "path": "../output/events.log"},
+//	    {"name": "billing", "type": "kafka", "brokers": ["localhost:9092"], "topic": "job_events",
+//	     "events": ["job.completed"]},
+//	    {"name": "alerts", "type": "webhook", "urls": ["https://example.com/hook"], "secret": "s3cret",
+//	     "events": ["job.failed"]},
+//	    {"name": "crm", "type": "rabbitmq", "api_url": "http://localhost:15672", "exchange": "jobs",
+//	     "user": "guest", "password": "guest"}
+//	  ]
+//	}
+type SinkConfig struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`   // kafka, rabbitmq, webhook or file
+	Events []string `json:"events"` // Event types to route; empty means all
+
+	// kafka
+	Brokers []string `json:"brokers,omitempty"`
+	Topic   string   `json:"topic,omitempty"`
+
+	// rabbitmq
+	APIURL     string `json:"api_url,omitempty"`
+	VHost      string `json:"vhost,omitempty"`
+	Exchange   string `json:"exchange,omitempty"`
+	RoutingKey string `json:"routing_key,omitempty"`
+	User       string `json:"user,omitempty"`
+	Password   string `json:"password,omitempty"`
+
+	// webhook
+	URLs   []string `json:"urls,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+
+	// file
+	Path string `json:"path,omitempty"`
+}
+
+// Config is the routing table of the event sinks
+type Config struct {
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// LoadConfig reads a routing config from a JSON file. References of the form
+// "${VAR}" are replaced with the environment variable VAR so secrets do not
+// have to be stored in the file; an unset variable is an error. A "$" not
+// followed by "{" is kept as is.
+func LoadConfig(path string) (*Config, error) {
+	var cfg Config
+	if err := ReadConfig(path, "event sink config", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ReadConfig decodes the JSON file path into v after expanding the "${VAR}"
+// references as LoadConfig does. what names the file in errors. The routing
+// configs of other components (notification channels) are read with it.
+func ReadConfig(path, what string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	expanded, err := config.ExpandEnv(data)
+	if err != nil {
+		return fmt.Errorf("invalid %s %s: %w", what, path, err)
+	}
+	if err := json.Unmarshal(expanded, v); err != nil {
+		return fmt.Errorf("invalid %s %s: %w", what, path, err)
+	}
+	return nil
+}
+
+// Filter is the set of event types routed to a destination; the empty
+// filter accepts every type
+type Filter map[string]bool
+
+// NewFilter builds the filter routing types, each of which must be one of
+// known
+func NewFilter(types, known []string) (Filter, error) {
+	filter := Filter{}
+	for _, t := range types {
+		if !slices.Contains(known, t) {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+		filter[t] = true
+	}
+	return filter, nil
+}
+
+// Accepts reports whether events of type eventType pass the filter
+func (f Filter) Accepts(eventType string) bool {
+	return len(f) == 0 || f[eventType]
+}
+
+// route is a sink with its event filter
+type route struct {
+	sink   Sink
+	events Filter
+}
+
+// Router publishes events to every sink whose filter accepts them
+type Router struct {
+	routes []route
+}
+
+// NewRouter builds the sinks declared in cfg. A nil cfg gives a router
+// without sinks.
+func NewRouter(cfg *Config) (*Router, error) {
+	router := &Router{}
+	if cfg == nil {
+		return router, nil
+	}
+	names := map[string]bool{}
+	for i, sc := range cfg.Sinks {
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("%s-%d", sc.Type, i)
+		}
+		if names[sc.Name] {
+			router.Close()
+			return nil, fmt.Errorf("duplicate event sink name %q", sc.Name)
+		}
+		names[sc.Name] = true
+
+		sink, err := newSink(sc)
+		if err != nil {
+			router.Close()
+			return nil, fmt.Errorf("event sink %s: %w", sc.Name, err)
+		}
+		events, err := NewFilter(sc.Events, []string{TypeJobCompleted, TypeJobFailed})
+		if err != nil {
+			router.Close()
+			sink.Close()
+			return nil, fmt.Errorf("event sink %s: %w", sc.Name, err)
+		}
+		router.routes = append(router.routes, route{sink: sink, events: events})
+	}
+	return router, nil
+}
+
+func newSink(sc SinkConfig) (Sink, error) {
+	switch strings.ToLower(sc.Type) {
+	case "kafka":
+		if len(sc.Brokers) == 0 || sc.Topic == "" {
+			return nil, fmt.Errorf("kafka sink requires brokers and topic")
+		}
+		return NewKafkaSink(sc.Name, sc.Brokers, sc.Topic), nil
+	case "rabbitmq":
+		if sc.APIURL == "" || sc.Exchange == "" {
+			return nil, fmt.Errorf("rabbitmq sink requires api_url and exchange")
+		}
+		return NewRabbitMQSink(sc.Name, RabbitMQConfig{
+			APIURL:     strings.TrimRight(sc.APIURL, "/"),
+			VHost:      sc.VHost,
+			Exchange:   sc.Exchange,
+			RoutingKey: sc.RoutingKey,
+			User:       sc.User,
+			Password:   sc.Password,
+		}), nil
+	case "webhook":
+		if len(sc.URLs) == 0 {
+			return nil, fmt.Errorf("webhook sink requires at least one url")
+		}
+		return NewWebhookSink(sc.Name, sc.URLs, sc.Secret), nil
+	case "file":
+		if sc.Path == "" {
+			return nil, fmt.Errorf("file sink requires path")
+		}
+		return NewFileSink(sc.Name, sc.Path)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q (want kafka, rabbitmq, webhook or file)", sc.Type)
+	}
+}
+
+// Len returns the number of configured sinks
+func (r *Router) Len() int { return len(r.routes) }
+
+// Publish sends event to every matching sink. Sink failures are logged and
+// do not stop delivery to the other sinks; the number of failed sinks is
+// returned in the error.
+func (r *Router) Publish(ctx context.Context, event Event) error {
+	failed := 0
+	for _, rt := range r.routes {
+		if !rt.events.Accepts(event.Type) {
+			continue
+		}
+		if err := rt.sink.Publish(ctx, event); err != nil {
+			log.Printf("EVENTS: Failed to publish %s for job %s to sink %s: %v", event.Type, event.JobID, rt.sink.Name(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d event sink(s) failed", failed)
+	}
+	return nil
+}
+
+// Close closes every sink
+func (r *Router) Close() error {
+	var firstErr error
+	for _, rt := range r.routes {
+		if err := rt.sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
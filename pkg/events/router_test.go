@@ -0,0 +1,29 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("SINK_URL", "https://hooks.example.com/a?b=1&c=$2")
+	path := filepath.Join(t.TempDir(), "sinks.json")
+	config := `{"sinks": [{"name": "hook", "type": "webhook", "urls": ["${SINK_URL}"], "events": ["job.failed"]}]}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Sinks) != 1 || cfg.Sinks[0].URLs[0] != "https://hooks.example.com/a?b=1&c=$2" {
+		t.Fatalf("sinks = %+v", cfg.Sinks)
+	}
+
+	os.Unsetenv("SINK_URL")
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "SINK_URL") {
+		t.Fatalf("LoadConfig with SINK_URL unset: err = %v", err)
+	}
+}
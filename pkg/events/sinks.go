@@ -0,0 +1,256 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultHTTPTimeout bounds webhook and RabbitMQ requests
+const DefaultHTTPTimeout = 10 * time.Second
+
+// KafkaSink publishes events to a Kafka topic, keyed by job ID so the events
+// of a job stay ordered within a partition
+type KafkaSink struct {
+	name   string
+	writer *kafka.Writer
+}
+
+// NewKafkaSink creates a sink writing to topic on the given brokers
+func NewKafkaSink(name string, brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		name: name,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			AllowAutoTopicCreation: true,
+		},
+	}
+}
+
+func (s *KafkaSink) Name() string { return s.name }
+
+func (s *KafkaSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{Key: []byte(event.JobID), Value: body})
+}
+
+func (s *KafkaSink) Close() error { return s.writer.Close() }
+
+// WebhookSink POSTs each event to a list of URLs. When a secret is set, the
+// body is signed with HMAC-SHA256 in the X-Signature-256 header
+// ("sha256=<hex>") so receivers can verify the sender.
+type WebhookSink struct {
+	name   string
+	urls   []string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting to every URL in urls
+func NewWebhookSink(name string, urls []string, secret string) *WebhookSink {
+	return &WebhookSink{name: name, urls: urls, secret: secret, client: &http.Client{Timeout: DefaultHTTPTimeout}}
+}
+
+func (s *WebhookSink) Name() string { return s.name }
+
+// Publish delivers the event to every URL and returns the first error; a
+// failing URL does not prevent delivery to the others
+func (s *WebhookSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, u := range s.urls {
+		if err := s.post(ctx, u, event, body); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *WebhookSink) post(ctx context.Context, u string, event Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", event.Type)
+	req.Header.Set("X-Event-ID", event.EventID)
+	Sign(req.Header, s.secret, body)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: status %d", u, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error { return nil }
+
+// Sign sets the X-Signature-256 header of a webhook request to the
+// HMAC-SHA256 of body with secret ("sha256=<hex>"). Nothing is set without
+// a secret.
+func Sign(header http.Header, secret string, body []byte) {
+	if secret == "" {
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// RabbitMQSink publishes events to a RabbitMQ exchange through the HTTP API
+// of the management plugin (POST /api/exchanges/{vhost}/{exchange}/publish),
+// which avoids depending on an AMQP client. The broker must have the
+// management plugin enabled.
+type RabbitMQSink struct {
+	name       string
+	apiURL     string // e.g. http://localhost:15672
+	vhost      string
+	exchange   string
+	routingKey string
+	user       string
+	password   string
+	client     *http.Client
+}
+
+// RabbitMQConfig configures a RabbitMQSink
+type RabbitMQConfig struct {
+	APIURL     string
+	VHost      string // Defaults to "/"
+	Exchange   string
+	RoutingKey string // Defaults to the event type
+	User       string
+	Password   string
+}
+
+// NewRabbitMQSink creates a sink publishing to cfg.Exchange
+func NewRabbitMQSink(name string, cfg RabbitMQConfig) *RabbitMQSink {
+	if cfg.VHost == "" {
+		cfg.VHost = "/"
+	}
+	return &RabbitMQSink{
+		name:       name,
+		apiURL:     cfg.APIURL,
+		vhost:      cfg.VHost,
+		exchange:   cfg.Exchange,
+		routingKey: cfg.RoutingKey,
+		user:       cfg.User,
+		password:   cfg.Password,
+		client:     &http.Client{Timeout: DefaultHTTPTimeout},
+	}
+}
+
+func (s *RabbitMQSink) Name() string { return s.name }
+
+func (s *RabbitMQSink) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	routingKey := s.routingKey
+	if routingKey == "" {
+		routingKey = event.Type
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"properties": map[string]interface{}{
+			"content_type":  "application/json",
+			"delivery_mode": 2, // persistent
+			"message_id":    event.EventID,
+		},
+		"routing_key":      routingKey,
+		"payload":          string(payload),
+		"payload_encoding": "string",
+	})
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/api/exchanges/%s/%s/publish", s.apiURL, url.PathEscape(s.vhost), url.PathEscape(s.exchange))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(s.user, s.password)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("rabbitmq exchange %s: %w", s.exchange, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rabbitmq exchange %s: status %d", s.exchange, resp.StatusCode)
+	}
+	var result struct {
+		Routed bool `json:"routed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("rabbitmq exchange %s: %w", s.exchange, err)
+	}
+	if !result.Routed {
+		return fmt.Errorf("rabbitmq exchange %s: message not routed to any queue", s.exchange)
+	}
+	return nil
+}
+
+func (s *RabbitMQSink) Close() error { return nil }
+
+// FileSink appends events to a file as JSON lines
+type FileSink struct {
+	name string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// NewFileSink opens (or creates) the log file at path
+func NewFileSink(name, path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{name: name, f: f}, nil
+}
+
+func (s *FileSink) Name() string { return s.name }
+
+func (s *FileSink) Publish(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,119 @@
+package filedrop
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+// Config of the connector
+type Config struct {
+	Scheme   string // sftp, ftp or ftps (FTP with explicit TLS, AUTH TLS)
+	Host     string // host:port
+	Username string
+	Password string // FTP only: SFTP authenticates with a key (IdentityFile or ssh-agent)
+
+	InputPath   string // Directory polled for images and PDFs
+	ResultsPath string // Directory receiving the PDFs, default InputPath/results
+
+	IdentityFile   string // SFTP private key, default the keys of ssh
+	KnownHostsFile string // SFTP known hosts, default ~/.ssh/known_hosts
+	SFTPPath       string // Default "sftp" (OpenSSH)
+
+	Interval   time.Duration // Between two polls, default 1m
+	Timeout    time.Duration // Of each FTP exchange or sftp run, default 2m
+	TargetLang string        // target_lang of the jobs, empty: the API default
+}
+
+// ConfigFromEnv reads FILEDROP_URL (sftp://user@host:22/incoming,
+// ftp://user@host/incoming or ftps://...) and the other FILEDROP_*
+// variables
+func ConfigFromEnv() (Config, error) {
+	raw := os.Getenv("FILEDROP_URL")
+	if raw == "" {
+		return Config{}, fmt.Errorf("FILEDROP_URL is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Config{}, fmt.Errorf("FILEDROP_URL: %w", err)
+	}
+	c := Config{
+		Scheme:         u.Scheme,
+		Host:           u.Host,
+		Username:       u.User.Username(),
+		Password:       os.Getenv("FILEDROP_PASSWORD"),
+		InputPath:      u.Path,
+		ResultsPath:    os.Getenv("FILEDROP_RESULTS_PATH"),
+		IdentityFile:   os.Getenv("FILEDROP_IDENTITY_FILE"),
+		KnownHostsFile: os.Getenv("FILEDROP_KNOWN_HOSTS"),
+		SFTPPath:       os.Getenv("SFTP_PATH"),
+		TargetLang:     os.Getenv("FILEDROP_TARGET_LANG"),
+	}
+	if password, ok := u.User.Password(); ok && c.Password == "" {
+		c.Password = password
+	}
+	switch c.Scheme {
+	case "sftp", "ftp", "ftps":
+	default:
+		return c, fmt.Errorf("FILEDROP_URL must be an sftp://, ftp:// or ftps:// URL, got %q", u.Redacted())
+	}
+	if u.Hostname() == "" || c.InputPath == "" || c.InputPath == "/" {
+		return c, fmt.Errorf("FILEDROP_URL must include a host and the input directory, got %q", u.Redacted())
+	}
+	for _, d := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"FILEDROP_INTERVAL", &c.Interval},
+		{"FILEDROP_TIMEOUT", &c.Timeout},
+	} {
+		if raw := os.Getenv(d.name); raw != "" {
+			v, err := time.ParseDuration(raw)
+			if err != nil || v <= 0 {
+				return c, fmt.Errorf("%s must be a positive duration such as 1m, got %q", d.name, raw)
+			}
+			*d.value = v
+		}
+	}
+	return c.withDefaults(), nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.Host != "" {
+		if _, _, err := net.SplitHostPort(c.Host); err != nil {
+			port := "21"
+			if c.Scheme == "sftp" {
+				port = "22"
+			}
+			c.Host = net.JoinHostPort(c.Host, port)
+		}
+	}
+	if c.ResultsPath == "" {
+		c.ResultsPath = path.Join(c.InputPath, "results")
+	}
+	if c.SFTPPath == "" {
+		c.SFTPPath = "sftp"
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 2 * time.Minute
+	}
+	return c
+}
+
+// dial opens a session on the server of the config
+func (c Config) dial(ctx context.Context) (Remote, error) {
+	switch c.Scheme {
+	case "sftp":
+		return newSFTP(c)
+	case "ftp", "ftps":
+		return dialFTP(ctx, c)
+	}
+	return nil, fmt.Errorf("filedrop: unsupported scheme %q", c.Scheme)
+}
@@ -0,0 +1,243 @@
+// Package filedrop connects systems that only exchange files: a connector
+// polls a directory of an SFTP or FTP server, submits the new images and
+// PDFs as jobs (source "<scheme>:<path>") and uploads the translated PDF of
+// each file to a results directory once its job is done. The state of every
+// file is kept in Redis, so a file is processed once per version (size and
+// modification time) even across restarts.
+package filedrop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/periodic"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/jobapi"
+)
+
+// StateKey is a hash of remote path -> JSON of the state of the file
+const StateKey = "filedrop:files"
+
+// Statuses of a file
+const (
+	StatusSeen      = "seen"      // Listed once, submitted if unchanged on the next poll
+	StatusSubmitted = "submitted" // Job running
+	StatusDelivered = "delivered" // PDF uploaded to the results directory
+	StatusFailed    = "failed"    // Job failed: "<name>.error.txt" uploaded instead
+	StatusRejected  = "rejected"  // Refused by the API, retried only if the file changes
+)
+
+// Extensions of the files submitted; others (and directories) are ignored
+var documentExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true,
+	".tif": true, ".tiff": true, ".webp": true, ".heic": true, ".heif": true, ".pdf": true,
+}
+
+// File is a regular file of a remote directory
+type File struct {
+	Name    string
+	Size    int64
+	ModTime string // As listed by the server, only compared for equality
+}
+
+// Remote is a session on the server
+type Remote interface {
+	List(ctx context.Context, dir string) ([]File, error)
+	Get(ctx context.Context, path string) ([]byte, error)
+	// Put replaces path with data, uploading to a temporary name first so
+	// that readers never see a partial file
+	Put(ctx context.Context, path string, data []byte) error
+	Close() error
+}
+
+// Result lists what one poll did, by remote path
+type Result struct {
+	Submitted []string `json:"submitted"`
+	Rejected  []string `json:"rejected"`
+	Delivered []string `json:"delivered"`
+	Failed    []string `json:"failed"`
+}
+
+// fileState is the state of a file, stored in StateKey
+type fileState struct {
+	Version   string    `json:"version"`
+	Status    string    `json:"status"`
+	JobID     string    `json:"job_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Connector polls one directory; run a single connector per directory
+type Connector struct {
+	config Config
+	client *redis.Client
+	api    jobapi.API
+	dial   func(ctx context.Context) (Remote, error)
+}
+
+// New creates a connector submitting to api, with the API key of the tenant
+// owning the file drop, and keeping its state in client
+func New(config Config, client *redis.Client, api jobapi.API) *Connector {
+	config = config.withDefaults()
+	return &Connector{config: config, client: client, api: api, dial: config.dial}
+}
+
+// Run polls every Interval until ctx is done. Each poll is passed to report
+// (nil: ignored) with its error.
+func (c *Connector) Run(ctx context.Context, report func(Result, error)) {
+	periodic.Run(ctx, c.config.Interval, c.Poll, report)
+}
+
+// Poll delivers the results of the finished jobs, then submits the files of
+// the input directory that are new or changed since they were submitted.
+// A file is submitted once its size and modification time did not change
+// between two polls, so that files still being uploaded are left alone.
+func (c *Connector) Poll(ctx context.Context) (Result, error) {
+	var result Result
+	remote, err := c.dial(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer remote.Close()
+
+	states, err := c.loadStates(ctx)
+	if err != nil {
+		return result, err
+	}
+	if err := c.deliver(ctx, remote, states, &result); err != nil {
+		return result, err
+	}
+	files, err := remote.List(ctx, c.config.InputPath)
+	if err != nil {
+		return result, err
+	}
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		if !documentExtensions[strings.ToLower(path.Ext(file.Name))] {
+			continue
+		}
+		filePath := path.Join(c.config.InputPath, file.Name)
+		listed[filePath] = true
+		version := fmt.Sprintf("%d %s", file.Size, file.ModTime)
+		state, ok := states[filePath]
+		switch {
+		case !ok || state.Version != version:
+			// New or still being written: submitted once unchanged on the next poll
+			if err := c.saveState(ctx, filePath, fileState{Version: version, Status: StatusSeen}); err != nil {
+				return result, err
+			}
+		case state.Status == StatusSeen:
+			if err := c.submit(ctx, remote, filePath, version, &result); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// Files removed from the input directory are forgotten once done
+	for filePath, state := range states {
+		if !listed[filePath] && state.Status != StatusSubmitted {
+			if err := c.client.HDel(ctx, StateKey, filePath).Err(); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *Connector) loadStates(ctx context.Context) (map[string]fileState, error) {
+	raw, err := c.client.HGetAll(ctx, StateKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]fileState, len(raw))
+	for filePath, data := range raw {
+		var state fileState
+		if json.Unmarshal([]byte(data), &state) == nil {
+			states[filePath] = state
+		}
+	}
+	return states, nil
+}
+
+func (c *Connector) saveState(ctx context.Context, filePath string, state fileState) error {
+	state.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return c.client.HSet(ctx, StateKey, filePath, data).Err()
+}
+
+// submit creates the job of a file. A file rejected by the API is recorded
+// as such; other errors leave it to the next poll.
+func (c *Connector) submit(ctx context.Context, remote Remote, filePath, version string, result *Result) error {
+	data, err := remote.Get(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	fields := map[string]string{"source": c.config.Scheme + ":" + filePath}
+	if c.config.TargetLang != "" {
+		fields["target_lang"] = c.config.TargetLang
+	}
+	state := fileState{Version: version, Status: StatusSubmitted}
+	state.JobID, err = c.api.Submit(ctx, path.Base(filePath), data, fields)
+	switch {
+	case err == nil:
+		result.Submitted = append(result.Submitted, filePath)
+	case errors.Is(err, jobapi.ErrRejected):
+		state.Status, state.Error = StatusRejected, err.Error()
+		result.Rejected = append(result.Rejected, filePath)
+	default:
+		return fmt.Errorf("submit %s: %w", filePath, err)
+	}
+	return c.saveState(ctx, filePath, state)
+}
+
+// deliver uploads the PDF (or the error) of the finished jobs
+func (c *Connector) deliver(ctx context.Context, remote Remote, states map[string]fileState, result *Result) error {
+	for filePath, state := range states {
+		if state.Status != StatusSubmitted {
+			continue
+		}
+		status, errorMessage, err := c.api.Status(ctx, state.JobID)
+		var pdf []byte
+		if err == nil && status == jobapi.StatusCompleted {
+			pdf, err = c.api.PDF(ctx, state.JobID)
+		}
+		switch {
+		case errors.Is(err, jobapi.ErrRejected):
+			// Job deleted or expired before its PDF was delivered
+			status, errorMessage = jobapi.StatusFailed, err.Error()
+		case err != nil:
+			return fmt.Errorf("result of %s: %w", filePath, err)
+		}
+		base := strings.TrimSuffix(path.Base(filePath), path.Ext(filePath))
+		switch status {
+		case jobapi.StatusCompleted:
+			if err := remote.Put(ctx, path.Join(c.config.ResultsPath, base+".pdf"), pdf); err != nil {
+				return err
+			}
+			state.Status = StatusDelivered
+			result.Delivered = append(result.Delivered, filePath)
+		case jobapi.StatusFailed:
+			message := fmt.Sprintf("Job %s for %s failed: %s\n", state.JobID, filePath, errorMessage)
+			if err := remote.Put(ctx, path.Join(c.config.ResultsPath, base+".error.txt"), []byte(message)); err != nil {
+				return err
+			}
+			state.Status, state.Error = StatusFailed, errorMessage
+			result.Failed = append(result.Failed, filePath)
+		default:
+			continue
+		}
+		states[filePath] = state
+		if err := c.saveState(ctx, filePath, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package filedrop
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/jobapi"
+)
+
+// memRemote is a server holding its files in memory
+type memRemote struct {
+	files map[string][]byte
+	mtime map[string]string
+}
+
+func (m *memRemote) List(ctx context.Context, dir string) ([]File, error) {
+	var files []File
+	for name, data := range m.files {
+		if path.Dir(name) == dir {
+			files = append(files, File{Name: path.Base(name), Size: int64(len(data)), ModTime: m.mtime[name]})
+		}
+	}
+	return files, nil
+}
+
+func (m *memRemote) Get(ctx context.Context, filePath string) ([]byte, error) {
+	return m.files[filePath], nil
+}
+
+func (m *memRemote) Put(ctx context.Context, filePath string, data []byte) error {
+	m.files[filePath] = data
+	return nil
+}
+
+func (m *memRemote) Close() error { return nil }
+
+type fakeAPI struct {
+	submitted []map[string]string
+	status    map[string]string // Job ID -> status
+}
+
+func (a *fakeAPI) Submit(ctx context.Context, filename string, data []byte, fields map[string]string) (string, error) {
+	if string(data) == "bad" {
+		return "", fmt.Errorf("%w: 400 INVALID_IMAGE", jobapi.ErrRejected)
+	}
+	a.submitted = append(a.submitted, fields)
+	jobID := fmt.Sprintf("job-%d", len(a.submitted))
+	a.status[jobID] = "processing"
+	return jobID, nil
+}
+
+func (a *fakeAPI) Status(ctx context.Context, jobID string) (string, string, error) {
+	return a.status[jobID], "OCR failed", nil
+}
+
+func (a *fakeAPI) PDF(ctx context.Context, jobID string) ([]byte, error) {
+	return []byte("%PDF " + jobID), nil
+}
+
+func TestConnector(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	remote := &memRemote{
+		files: map[string][]byte{
+			"/in/scan.png":   []byte("png"),
+			"/in/broken.jpg": []byte("bad"),
+			"/in/notes.txt":  []byte("txt"),
+		},
+		mtime: map[string]string{},
+	}
+	api := &fakeAPI{status: map[string]string{}}
+	c := New(Config{Scheme: "sftp", InputPath: "/in", TargetLang: "en"}, redis.NewClient(&redis.Options{Addr: mr.Addr()}), api)
+	c.dial = func(ctx context.Context) (Remote, error) { return remote, nil }
+	poll := func() Result {
+		t.Helper()
+		result, err := c.Poll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// First poll: files only seen, maybe still being written
+	if result := poll(); len(result.Submitted)+len(result.Rejected) != 0 {
+		t.Fatalf("first poll = %+v, want nothing submitted", result)
+	}
+	result := poll()
+	if !reflect.DeepEqual(result.Submitted, []string{"/in/scan.png"}) || !reflect.DeepEqual(result.Rejected, []string{"/in/broken.jpg"}) {
+		t.Fatalf("second poll = %+v", result)
+	}
+	if want := map[string]string{"source": "sftp:/in/scan.png", "target_lang": "en"}; !reflect.DeepEqual(api.submitted[0], want) {
+		t.Errorf("fields = %v, want %v", api.submitted[0], want)
+	}
+
+	api.status["job-1"] = "completed"
+	result = poll()
+	if !reflect.DeepEqual(result.Delivered, []string{"/in/scan.png"}) || len(result.Submitted)+len(result.Rejected) != 0 {
+		t.Fatalf("third poll = %+v", result)
+	}
+	if got := string(remote.files["/in/results/scan.pdf"]); got != "%PDF job-1" {
+		t.Errorf("results/scan.pdf = %q", got)
+	}
+	if len(api.submitted) != 1 {
+		t.Errorf("submitted %d jobs, want 1", len(api.submitted))
+	}
+
+	// A new version of the file is processed again, and its failure reported
+	remote.files["/in/scan.png"] = []byte("png v2")
+	poll()
+	if result := poll(); len(result.Submitted) != 1 {
+		t.Fatalf("changed file: %+v", result)
+	}
+	api.status["job-2"] = "failed"
+	if result := poll(); len(result.Failed) != 1 || !strings.Contains(string(remote.files["/in/results/scan.error.txt"]), "OCR failed") {
+		t.Fatalf("failed job: %+v, %v", result, remote.files)
+	}
+
+	// Removed files are forgotten
+	delete(remote.files, "/in/broken.jpg")
+	poll()
+	if fields, _ := mr.HKeys(StateKey); !reflect.DeepEqual(fields, []string{"/in/scan.png"}) {
+		t.Errorf("state of %v, want only /in/scan.png", fields)
+	}
+}
+
+func TestParseListings(t *testing.T) {
+	mlsd := "type=cdir;modify=20261016100000; .\r\n" +
+		"type=dir;modify=20261016100000; results\r\n" +
+		"type=file;size=1234;modify=20261016093000; scan 1.png\r\n"
+	if got, want := parseMLSD(mlsd), []File{{Name: "scan 1.png", Size: 1234, ModTime: "20261016093000"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMLSD = %+v, want %+v", got, want)
+	}
+
+	ls := "sftp> ls -ln \"/in\"\n" +
+		"drwxr-xr-x    2 1000     1000         4096 Oct 16 10:00 /in/results\n" +
+		"-rw-r--r--    1 1000     1000         1234 Oct 16 09:30 /in/scan 1.png\n"
+	if got, want := parseLongListing(ls), []File{{Name: "scan 1.png", Size: 1234, ModTime: "Oct 16 09:30"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLongListing = %+v, want %+v", got, want)
+	}
+
+	if port, err := epsvPort("Entering Extended Passive Mode (|||50123|)"); err != nil || port != 50123 {
+		t.Errorf("epsvPort = %d, %v", port, err)
+	}
+}
@@ -0,0 +1,233 @@
+package filedrop
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFileBytes bounds a file downloaded in memory
+const maxFileBytes = 256 << 20
+
+// ftpRemote speaks the FTP commands the connector needs (RFC 959, EPSV of
+// RFC 2428, MLSD of RFC 3659 and AUTH TLS of RFC 4217 for ftps)
+type ftpRemote struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	host    string // Of the control connection, for the passive data connections
+	tls     *tls.Config
+	timeout time.Duration
+}
+
+func dialFTP(ctx context.Context, config Config) (*ftpRemote, error) {
+	conn, err := (&net.Dialer{Timeout: config.Timeout}).DialContext(ctx, "tcp", config.Host)
+	if err != nil {
+		return nil, fmt.Errorf("ftp: %w", err)
+	}
+	host, _, _ := net.SplitHostPort(config.Host)
+	f := &ftpRemote{conn: conn, text: textproto.NewConn(conn), host: host, timeout: config.Timeout}
+	if err := f.open(config); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// open reads the greeting, switches to TLS for ftps and logs in
+func (f *ftpRemote) open(config Config) error {
+	f.conn.SetDeadline(time.Now().Add(f.timeout))
+	if _, _, err := f.text.ReadResponse(220); err != nil {
+		return fmt.Errorf("ftp: greeting: %w", err)
+	}
+	if config.Scheme == "ftps" {
+		if _, err := f.cmd(234, "AUTH TLS"); err != nil {
+			return err
+		}
+		f.tls = &tls.Config{ServerName: f.host, ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+		f.conn = tls.Client(f.conn, f.tls)
+		f.text = textproto.NewConn(f.conn)
+		if _, err := f.cmd(200, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, err := f.cmd(200, "PROT P"); err != nil {
+			return err
+		}
+	}
+	code, err := f.cmd(0, "USER %s", config.Username)
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		if _, err := f.cmd(230, "PASS %s", config.Password); err != nil {
+			return err
+		}
+	} else if code != 230 {
+		return fmt.Errorf("ftp: USER: unexpected reply %d", code)
+	}
+	_, err = f.cmd(200, "TYPE I")
+	return err
+}
+
+// cmd sends a command and reads its reply, checking its code unless
+// expectCode is 0. The arguments are not part of the errors: they may be
+// the password.
+func (f *ftpRemote) cmd(expectCode int, format string, args ...any) (int, error) {
+	verb, _, _ := strings.Cut(format, " ")
+	f.conn.SetDeadline(time.Now().Add(f.timeout))
+	if strings.ContainsAny(fmt.Sprint(args...), "\r\n") {
+		return 0, fmt.Errorf("ftp: %s: line breaks are not allowed in arguments", verb)
+	}
+	if err := f.text.PrintfLine(format, args...); err != nil {
+		return 0, fmt.Errorf("ftp: %s: %w", verb, err)
+	}
+	code, _, err := f.text.ReadResponse(expectCode)
+	if err != nil {
+		return code, fmt.Errorf("ftp: %s: %w", verb, err) // *textproto.Error: code and message of the reply
+	}
+	return code, nil
+}
+
+// data opens a passive data connection, sends cmd and calls fn with the
+// connection, then reads the reply closing the transfer
+func (f *ftpRemote) data(ctx context.Context, fn func(net.Conn) error, format string, args ...any) error {
+	f.conn.SetDeadline(time.Now().Add(f.timeout))
+	if err := f.text.PrintfLine("EPSV"); err != nil {
+		return fmt.Errorf("ftp: EPSV: %w", err)
+	}
+	_, message, err := f.text.ReadResponse(229)
+	if err != nil {
+		return fmt.Errorf("ftp: EPSV: %w", err)
+	}
+	port, err := epsvPort(message)
+	if err != nil {
+		return err
+	}
+	dataConn, err := (&net.Dialer{Timeout: f.timeout}).DialContext(ctx, "tcp", net.JoinHostPort(f.host, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("ftp: data connection: %w", err)
+	}
+	defer dataConn.Close()
+	dataConn.SetDeadline(time.Now().Add(f.timeout))
+
+	if _, err := f.cmd(1, format, args...); err != nil {
+		return err
+	}
+	if f.tls != nil {
+		dataConn = tls.Client(dataConn, f.tls)
+	}
+	if err := fn(dataConn); err != nil {
+		return err
+	}
+	if err := dataConn.Close(); err != nil {
+		return fmt.Errorf("ftp: data connection: %w", err)
+	}
+	f.conn.SetDeadline(time.Now().Add(f.timeout))
+	if _, _, err := f.text.ReadResponse(2); err != nil {
+		verb, _, _ := strings.Cut(format, " ")
+		return fmt.Errorf("ftp: %s: %w", verb, err)
+	}
+	return nil
+}
+
+func (f *ftpRemote) List(ctx context.Context, dir string) ([]File, error) {
+	var listing []byte
+	err := f.data(ctx, func(conn net.Conn) error {
+		var err error
+		listing, err = io.ReadAll(io.LimitReader(conn, maxFileBytes))
+		return err
+	}, "MLSD %s", dir)
+	if err != nil {
+		return nil, err
+	}
+	return parseMLSD(string(listing)), nil
+}
+
+func (f *ftpRemote) Get(ctx context.Context, filePath string) ([]byte, error) {
+	var data []byte
+	err := f.data(ctx, func(conn net.Conn) error {
+		var err error
+		data, err = io.ReadAll(io.LimitReader(conn, maxFileBytes+1))
+		if err == nil && len(data) > maxFileBytes {
+			return fmt.Errorf("ftp: %s is larger than %d bytes", filePath, maxFileBytes)
+		}
+		return err
+	}, "RETR %s", filePath)
+	return data, err
+}
+
+func (f *ftpRemote) Put(ctx context.Context, filePath string, data []byte) error {
+	tmp := path.Join(path.Dir(filePath), "."+path.Base(filePath)+".part")
+	err := f.data(ctx, func(conn net.Conn) error {
+		_, err := io.Copy(conn, bytes.NewReader(data))
+		return err
+	}, "STOR %s", tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.cmd(350, "RNFR %s", tmp); err != nil {
+		return err
+	}
+	_, err = f.cmd(250, "RNTO %s", filePath)
+	return err
+}
+
+// Close logs out, ignoring the reply of the server
+func (f *ftpRemote) Close() error {
+	f.cmd(0, "QUIT")
+	return f.conn.Close()
+}
+
+// epsvPort parses the port of "Entering Extended Passive Mode (|||port|)"
+func epsvPort(message string) (int, error) {
+	open := strings.IndexByte(message, '(')
+	end := strings.LastIndexByte(message, ')')
+	if open < 0 || end < open {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", message)
+	}
+	fields := strings.Split(message[open+1:end], "|")
+	if len(fields) != 5 {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", message)
+	}
+	port, err := strconv.Atoi(fields[3])
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", message)
+	}
+	return port, nil
+}
+
+// parseMLSD returns the regular files of an MLSD listing, whose lines are
+// "fact=value;fact=value; name"
+func parseMLSD(listing string) []File {
+	var files []File
+	for _, line := range strings.Split(listing, "\n") {
+		facts, name, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+		if !ok || name == "" {
+			continue
+		}
+		file := File{Name: name}
+		regular := false
+		for _, fact := range strings.Split(facts, ";") {
+			key, value, _ := strings.Cut(fact, "=")
+			switch strings.ToLower(key) {
+			case "type":
+				regular = strings.EqualFold(value, "file")
+			case "size":
+				file.Size, _ = strconv.ParseInt(value, 10, 64)
+			case "modify":
+				file.ModTime = value
+			}
+		}
+		if regular {
+			files = append(files, file)
+		}
+	}
+	return files
+}
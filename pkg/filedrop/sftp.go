@@ -0,0 +1,153 @@
+package filedrop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrSFTPMissing means the sftp binary of OpenSSH is not installed
+var ErrSFTPMissing = errors.New("sftp is not installed")
+
+// sftpRemote runs the sftp client of OpenSSH in batch mode, one run per
+// operation. Authentication must not prompt: a key (IdentityFile or
+// ssh-agent) and the host key in KnownHostsFile.
+type sftpRemote struct {
+	config Config
+	tmpDir string // Local copies of the files transferred
+}
+
+func newSFTP(config Config) (*sftpRemote, error) {
+	if _, err := exec.LookPath(config.SFTPPath); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSFTPMissing, config.SFTPPath)
+	}
+	tmpDir, err := os.MkdirTemp("", "filedrop-")
+	if err != nil {
+		return nil, err
+	}
+	return &sftpRemote{config: config, tmpDir: tmpDir}, nil
+}
+
+// run executes the batch commands and returns the output of sftp
+func (s *sftpRemote) run(ctx context.Context, commands ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	host, port, err := net.SplitHostPort(s.config.Host)
+	if err != nil {
+		return "", fmt.Errorf("sftp: %w", err)
+	}
+	args := []string{"-b", "-", "-P", port, "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes"}
+	if s.config.IdentityFile != "" {
+		args = append(args, "-i", s.config.IdentityFile)
+	}
+	if s.config.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+s.config.KnownHostsFile)
+	}
+	if s.config.Username != "" {
+		host = s.config.Username + "@" + host
+	}
+	args = append(args, "--", host)
+
+	cmd := exec.CommandContext(ctx, s.config.SFTPPath, args...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("sftp: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func (s *sftpRemote) List(ctx context.Context, dir string) ([]File, error) {
+	out, err := s.run(ctx, "ls -ln "+sftpQuote(dir))
+	if err != nil {
+		return nil, err
+	}
+	return parseLongListing(out), nil
+}
+
+func (s *sftpRemote) Get(ctx context.Context, filePath string) ([]byte, error) {
+	local := filepath.Join(s.tmpDir, "get")
+	defer os.Remove(local)
+	if _, err := s.run(ctx, "get "+sftpQuote(filePath)+" "+sftpQuote(local)); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxFileBytes {
+		return nil, fmt.Errorf("sftp: %s is larger than %d bytes", filePath, maxFileBytes)
+	}
+	return os.ReadFile(local)
+}
+
+func (s *sftpRemote) Put(ctx context.Context, filePath string, data []byte) error {
+	local := filepath.Join(s.tmpDir, "put")
+	defer os.Remove(local)
+	if err := os.WriteFile(local, data, 0o600); err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(filePath), "."+path.Base(filePath)+".part")
+	// "-": a missing file to remove is not an error
+	_, err := s.run(ctx,
+		"put "+sftpQuote(local)+" "+sftpQuote(tmp),
+		"-rm "+sftpQuote(filePath),
+		"rename "+sftpQuote(tmp)+" "+sftpQuote(filePath))
+	return err
+}
+
+func (s *sftpRemote) Close() error {
+	return os.RemoveAll(s.tmpDir)
+}
+
+// sftpQuote quotes a path for a batch command of sftp
+func sftpQuote(p string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", "", "\r", "").Replace(p) + `"`
+}
+
+// parseLongListing returns the regular files of the output of "ls -ln":
+// "-rw-r--r-- 1 1000 1000 12345 Oct 16 10:00 name", after the commands
+// echoed by sftp ("sftp> ls -ln ...")
+func parseLongListing(out string) []File {
+	var files []File
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "-") {
+			continue // Directories, links, echoed commands
+		}
+		// 8 fields before the name, which may contain spaces
+		rest := line
+		var fields []string
+		for len(fields) < 8 {
+			rest = strings.TrimLeft(rest, " ")
+			field, remainder, ok := strings.Cut(rest, " ")
+			if !ok {
+				break
+			}
+			fields, rest = append(fields, field), remainder
+		}
+		if len(fields) < 8 {
+			continue
+		}
+		name := strings.TrimLeft(rest, " ")
+		size, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil || name == "" {
+			continue
+		}
+		files = append(files, File{
+			Name:    path.Base(name), // sftp prints the names with the listed directory
+			Size:    size,
+			ModTime: strings.Join(fields[5:8], " "),
+		})
+	}
+	return files
+}
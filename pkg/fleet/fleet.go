@@ -0,0 +1,258 @@
+// Package fleet publishes worker heartbeats to Redis and lists the live and
+// stalled workers from them.
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys of the heartbeats
+const (
+	WorkersKey      = "fleet:workers" // Sorted set worker ID -> unix time of the last heartbeat
+	workerKeyPrefix = "fleet:worker:" // String per worker, JSON Heartbeat expiring after Retention
+)
+
+// Timing of the heartbeats
+const (
+	Interval   = 10 * time.Second // Between two heartbeats of a worker
+	StaleAfter = 3 * Interval     // Without a heartbeat for this long, a worker is stalled (hung or killed)
+	Retention  = 10 * time.Minute // Workers silent for longer are dropped from the list
+
+	// DefaultJobStallAfter is how long a job may stay in one stage before its worker is reported stalled
+	DefaultJobStallAfter = 15 * time.Minute
+)
+
+// Worker statuses reported by List
+const (
+	StatusLive    = "live"
+	StatusStalled = "stalled"
+)
+
+// InFlightJob is a job being processed by a worker
+type InFlightJob struct {
+	JobID          string    `json:"job_id"`
+	Stage          string    `json:"stage"` // filter, ocr, extract, translate, pdf; empty before the first stage
+	StartedAt      time.Time `json:"started_at"`
+	StageStartedAt time.Time `json:"stage_started_at"`
+}
+
+// Counts are the jobs a worker finished since it started
+type Counts struct {
+	Processed int64 `json:"processed"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+	Cached    int64 `json:"cached"` // Completed from the result cache
+}
+
+// Heartbeat is the state a worker publishes every Interval
+type Heartbeat struct {
+	ID               string         `json:"id"` // <hostname>-<pid>
+	Hostname         string         `json:"hostname"`
+	PID              int            `json:"pid"`
+	Mode             string         `json:"mode"` // How the worker receives jobs, e.g. "kafka" or "controller"
+	StartedAt        time.Time      `json:"started_at"`
+	LastHeartbeat    time.Time      `json:"last_heartbeat"`
+	MaxConcurrency   int            `json:"max_concurrency"`   // Jobs the worker processes at the same time
+	StageConcurrency map[string]int `json:"stage_concurrency"` // In-flight jobs per stage
+	InFlight         []InFlightJob  `json:"in_flight"`
+	Counts           Counts         `json:"counts"`
+}
+
+// Tracker records the jobs of this process and publishes its heartbeat
+type Tracker struct {
+	mu     sync.Mutex
+	base   Heartbeat
+	jobs   map[string]*InFlightJob
+	counts Counts
+}
+
+// NewTracker creates the tracker of this process
+func NewTracker(mode string, maxConcurrency int) *Tracker {
+	hostname, _ := os.Hostname()
+	pid := os.Getpid()
+	return &Tracker{
+		base: Heartbeat{
+			ID:             fmt.Sprintf("%s-%d", hostname, pid),
+			Hostname:       hostname,
+			PID:            pid,
+			Mode:           mode,
+			StartedAt:      time.Now().UTC(),
+			MaxConcurrency: maxConcurrency,
+		},
+		jobs: make(map[string]*InFlightJob),
+	}
+}
+
+// ID identifies the worker in the fleet
+func (t *Tracker) ID() string { return t.base.ID }
+
+// SetMaxConcurrency records a new number of jobs the worker processes at
+// the same time (autoscaling)
+func (t *Tracker) SetMaxConcurrency(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.base.MaxConcurrency = n
+}
+
+// StartJob records that the job is being processed
+func (t *Tracker) StartJob(jobID string) {
+	now := time.Now().UTC()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.jobs[jobID] = &InFlightJob{JobID: jobID, StartedAt: now, StageStartedAt: now}
+}
+
+// SetStage records the stage the job entered
+func (t *Tracker) SetStage(jobID, stage string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if job, ok := t.jobs[jobID]; ok && job.Stage != stage {
+		job.Stage, job.StageStartedAt = stage, time.Now().UTC()
+	}
+}
+
+// FinishJob records the outcome of the job
+func (t *Tracker) FinishJob(jobID string, err error, cached bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.jobs, jobID)
+	t.counts.Processed++
+	switch {
+	case err != nil:
+		t.counts.Failed++
+	case cached:
+		t.counts.Cached++
+		t.counts.Completed++
+	default:
+		t.counts.Completed++
+	}
+}
+
+// Snapshot returns the current heartbeat
+func (t *Tracker) Snapshot() Heartbeat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hb := t.base
+	hb.LastHeartbeat = time.Now().UTC()
+	hb.Counts = t.counts
+	hb.StageConcurrency = make(map[string]int)
+	hb.InFlight = make([]InFlightJob, 0, len(t.jobs))
+	for _, job := range t.jobs {
+		hb.InFlight = append(hb.InFlight, *job)
+		if job.Stage != "" {
+			hb.StageConcurrency[job.Stage]++
+		}
+	}
+	sort.Slice(hb.InFlight, func(i, j int) bool { return hb.InFlight[i].StartedAt.Before(hb.InFlight[j].StartedAt) })
+	return hb
+}
+
+// Run publishes a heartbeat now and every Interval until ctx is done.
+// Failed writes are returned to onError (nil: ignored) and retried on the next tick.
+func (t *Tracker) Run(ctx context.Context, client *redis.Client, onError func(error)) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for {
+		if err := t.publish(ctx, client); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tracker) publish(ctx context.Context, client *redis.Client) error {
+	hb := t.Snapshot()
+	data, err := json.Marshal(hb)
+	if err != nil {
+		return err
+	}
+	pipe := client.TxPipeline()
+	pipe.Set(ctx, workerKeyPrefix+hb.ID, data, Retention)
+	pipe.ZAdd(ctx, WorkersKey, &redis.Z{Score: float64(hb.LastHeartbeat.Unix()), Member: hb.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Deregister removes the worker from the fleet on a graceful shutdown
+func (t *Tracker) Deregister(ctx context.Context, client *redis.Client) error {
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, workerKeyPrefix+t.base.ID)
+	pipe.ZRem(ctx, WorkersKey, t.base.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Worker is a worker of the fleet with its health
+type Worker struct {
+	Heartbeat
+	Status        string  `json:"status"` // StatusLive or StatusStalled
+	StalledReason string  `json:"stalled_reason,omitempty"`
+	HeartbeatAgeS float64 `json:"heartbeat_age_s"`
+}
+
+// List returns the workers that sent a heartbeat within Retention, oldest
+// heartbeat first. A worker is stalled when its heartbeat is older than
+// StaleAfter, or when one of its jobs stayed in a stage longer than
+// jobStallAfter (the heartbeat keeps running while a job hangs).
+// Workers gone for longer than Retention are removed from WorkersKey.
+func List(ctx context.Context, client *redis.Client, jobStallAfter time.Duration) ([]Worker, error) {
+	now := time.Now()
+	cutoff := now.Add(-Retention).Unix()
+	if err := client.ZRemRangeByScore(ctx, WorkersKey, "-inf", fmt.Sprintf("(%d", cutoff)).Err(); err != nil {
+		return nil, err
+	}
+	ids, err := client.ZRange(ctx, WorkersKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	workers := make([]Worker, 0, len(ids))
+	if len(ids) == 0 {
+		return workers, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = workerKeyPrefix + id
+	}
+	values, err := client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // Expired between ZRANGE and MGET
+		}
+		var w Worker
+		if err := json.Unmarshal([]byte(data), &w.Heartbeat); err != nil {
+			continue
+		}
+		age := now.Sub(w.LastHeartbeat)
+		w.HeartbeatAgeS = age.Round(time.Second).Seconds()
+		w.Status = StatusLive
+		if age > StaleAfter {
+			w.Status, w.StalledReason = StatusStalled, fmt.Sprintf("no heartbeat for %s", age.Round(time.Second))
+		} else {
+			for _, job := range w.InFlight {
+				if inStage := now.Sub(job.StageStartedAt); inStage > jobStallAfter {
+					w.Status = StatusStalled
+					w.StalledReason = fmt.Sprintf("job %s in stage %q for %s", job.JobID, job.Stage, inStage.Round(time.Second))
+					break
+				}
+			}
+		}
+		workers = append(workers, w)
+	}
+	return workers, nil
+}
@@ -0,0 +1,102 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestTrackerSnapshot(t *testing.T) {
+	tracker := NewTracker("kafka", 2)
+	tracker.StartJob("j1")
+	tracker.StartJob("j2")
+	tracker.SetStage("j1", "ocr")
+	tracker.SetStage("j2", "ocr")
+	tracker.SetStage("unknown", "ocr") // Ignored
+	tracker.FinishJob("j2", nil, true)
+	tracker.StartJob("j3")
+	tracker.FinishJob("j3", errors.New("OCR error"), false)
+	tracker.SetMaxConcurrency(4)
+
+	hb := tracker.Snapshot()
+	if hb.ID != tracker.ID() || hb.Mode != "kafka" || hb.MaxConcurrency != 4 {
+		t.Errorf("heartbeat = %+v", hb)
+	}
+	if len(hb.InFlight) != 1 || hb.InFlight[0].JobID != "j1" || hb.InFlight[0].Stage != "ocr" {
+		t.Errorf("in flight = %+v", hb.InFlight)
+	}
+	if hb.StageConcurrency["ocr"] != 1 {
+		t.Errorf("stage concurrency = %v", hb.StageConcurrency)
+	}
+	if want := (Counts{Processed: 2, Completed: 1, Failed: 1, Cached: 1}); hb.Counts != want {
+		t.Errorf("counts = %+v, want %+v", hb.Counts, want)
+	}
+}
+
+// setHeartbeat writes a heartbeat as publish does, with its own LastHeartbeat
+func setHeartbeat(t *testing.T, client *redis.Client, hb Heartbeat) {
+	t.Helper()
+	ctx := context.Background()
+	data, _ := json.Marshal(hb)
+	client.Set(ctx, workerKeyPrefix+hb.ID, data, Retention)
+	client.ZAdd(ctx, WorkersKey, &redis.Z{Score: float64(hb.LastHeartbeat.Unix()), Member: hb.ID})
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	tracker := NewTracker("controller", 1)
+	tracker.StartJob("running")
+	tracker.SetStage("running", "translate")
+	if err := tracker.publish(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	setHeartbeat(t, client, Heartbeat{ID: "silent", LastHeartbeat: now.Add(-time.Minute)})
+	setHeartbeat(t, client, Heartbeat{ID: "hung", LastHeartbeat: now, InFlight: []InFlightJob{
+		{JobID: "stuck", Stage: "ocr", StageStartedAt: now.Add(-20 * time.Minute)},
+	}})
+	setHeartbeat(t, client, Heartbeat{ID: "gone", LastHeartbeat: now.Add(-time.Hour)})
+
+	workers, err := List(ctx, client, DefaultJobStallAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := map[string]string{}
+	for _, w := range workers {
+		status[w.ID] = w.Status
+		if w.Status == StatusStalled && w.StalledReason == "" {
+			t.Errorf("worker %s stalled without a reason", w.ID)
+		}
+	}
+	want := map[string]string{tracker.ID(): StatusLive, "silent": StatusStalled, "hung": StatusStalled}
+	if len(status) != len(want) {
+		t.Fatalf("List = %v, want %v", status, want)
+	}
+	for id, s := range want {
+		if status[id] != s {
+			t.Errorf("worker %s: %q, want %q", id, status[id], s)
+		}
+	}
+	if workers[0].ID != "silent" {
+		t.Errorf("first worker %s, want the oldest heartbeat first", workers[0].ID)
+	}
+	if _, err := client.ZScore(ctx, WorkersKey, "gone").Result(); err != redis.Nil {
+		t.Errorf("worker gone for longer than Retention still listed: %v", err)
+	}
+
+	if err := tracker.Deregister(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if workers, _ := List(ctx, client, DefaultJobStallAfter); len(workers) != 2 {
+		t.Errorf("%d workers after Deregister, want 2", len(workers))
+	}
+}
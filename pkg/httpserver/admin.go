@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// AdminHandler serves the Go profiler (/debug/pprof/, see net/http/pprof)
+// and runtime counters (/debug/runtime: goroutines, heap, GC). It exposes
+// the internals of the process and must only be reachable by operators.
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"goroutines":       runtime.NumGoroutine(),
+			"heap_alloc_bytes": m.HeapAlloc,
+			"heap_sys_bytes":   m.HeapSys,
+			"sys_bytes":        m.Sys,
+			"num_gc":           m.NumGC,
+			"gc_pause_total":   time.Duration(m.PauseTotalNs).String(),
+		})
+	})
+	return mux
+}
+
+// StartAdmin serves AdminHandler on addr in the background, without the TLS
+// and CORS of the main server: bind it to a private interface, e.g.
+// 127.0.0.1:6060. An empty addr disables it. Failures are logged, they do not
+// stop the process.
+func StartAdmin(addr string) {
+	if addr == "" {
+		return
+	}
+	// Profiles (/debug/pprof/profile?seconds=30) take longer than a normal request
+	srv := &http.Server{Addr: addr, Handler: AdminHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Printf("Admin server (pprof) listening on %s", addr)
+		if err := srv.ListenAndServe(); err != nil {
+			log.Printf("Admin server on %s stopped: %v", addr, err)
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+)
+
+// Error is the body of every error response, {"error": {...}}. Clients branch
+// on Code, which is stable; Message is for humans and may change.
+type Error struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Code + ": " + e.Message }
+
+// ErrorResponse wraps an Error in the response body
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
+
+// Codes shared by every server. The API adds its own (JOB_NOT_FOUND...).
+const (
+	CodeInvalidRequest   = "INVALID_REQUEST"    // Missing or invalid parameter
+	CodeNotFound         = "NOT_FOUND"          // No such route
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED" // Route exists for other methods
+	CodeOriginNotAllowed = "ORIGIN_NOT_ALLOWED" // Origin missing from the CORS allowlist
+	CodeInternal         = "INTERNAL_ERROR"     // Unexpected failure, see the server logs
+)
+
+// RequestIDHeader carries the ID of a request, from the client (or a proxy)
+// or generated by the server, and is echoed in the response
+const RequestIDHeader = "X-Request-ID"
+
+// IDs from clients are used in logs: a bounded set of characters
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID returns the ID of r set by the server (see NewServer)
+func RequestID(r *http.Request) string { return r.Header.Get(RequestIDHeader) }
+
+// withRequestID keeps a valid X-Request-ID of the request or replaces it
+// with a random one, and echoes it in the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewError returns the error of request r, with its request ID
+func NewError(r *http.Request, code, message string, details map[string]any) *Error {
+	return &Error{Code: code, Message: message, Details: details, RequestID: RequestID(r)}
+}
+
+// WriteError writes an error response with a JSON body
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: NewError(r, code, message, details)})
+}
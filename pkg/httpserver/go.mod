@@ -0,0 +1,5 @@
+module github.com/mxngoc2104/KTPM-CS2/pkg/httpserver
+
+go 1.24.2
+
+require golang.org/x/crypto v0.36.0
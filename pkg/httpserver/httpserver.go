@@ -0,0 +1,230 @@
+// Package httpserver runs the HTTP servers of the project (the API and the
+// serverless event endpoint) with timeouts, optional TLS (certificate files or
+// Let's Encrypt through autocert) and a CORS origin allowlist, instead of a
+// bare http.ListenAndServe.
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Config of a server
+type Config struct {
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading a whole request, uploads included
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing a response, PDF downloads included
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration // Keep-alive connections
+
+	// TLS with certificate files, or with certificates obtained from Let's
+	// Encrypt for AutocertDomains (cached in AutocertCache, none: memory only)
+	CertFile        string
+	KeyFile         string
+	AutocertDomains []string
+	AutocertCache   string
+
+	// AllowedOrigins of cross-origin requests, "*" for any origin. Empty
+	// disables CORS: cross-origin browser requests are not checked.
+	AllowedOrigins []string
+}
+
+// DefaultConfig returns the timeouts used without configuration, without
+// TLS and CORS
+func DefaultConfig() Config {
+	return Config{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       2 * time.Minute,
+		WriteTimeout:      5 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+}
+
+// ConfigFromEnv returns defaults (see DefaultConfig) overridden by
+// HTTP_READ_HEADER_TIMEOUT, HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT,
+// HTTP_IDLE_TIMEOUT, TLS_CERT_FILE, TLS_KEY_FILE, TLS_AUTOCERT_DOMAINS,
+// TLS_AUTOCERT_CACHE and CORS_ALLOWED_ORIGINS (lists are comma separated)
+func ConfigFromEnv(defaults Config) (Config, error) {
+	c := defaults
+	for _, v := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"HTTP_READ_HEADER_TIMEOUT", &c.ReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", &c.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", &c.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", &c.IdleTimeout},
+	} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("%s must be a positive duration such as 1m, got %q", v.name, raw)
+		}
+		*v.value = d
+	}
+	for name, value := range map[string]*string{
+		"TLS_CERT_FILE":      &c.CertFile,
+		"TLS_KEY_FILE":       &c.KeyFile,
+		"TLS_AUTOCERT_CACHE": &c.AutocertCache,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*value = v
+		}
+	}
+	for name, value := range map[string]*[]string{
+		"TLS_AUTOCERT_DOMAINS": &c.AutocertDomains,
+		"CORS_ALLOWED_ORIGINS": &c.AllowedOrigins,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*value = splitList(v)
+		}
+	}
+	return c, c.validate()
+}
+
+func (c Config) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.CertFile != "" && len(c.AutocertDomains) > 0 {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS are exclusive")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("invalid CORS origin %q (expected scheme://host[:port] or *)", origin)
+		}
+	}
+	return nil
+}
+
+// TLS reports whether the server serves HTTPS
+func (c Config) TLS() bool { return c.CertFile != "" || len(c.AutocertDomains) > 0 }
+
+// NewServer returns a server for handler on addr, wrapped with the CORS checks
+// and request IDs (see RequestIDHeader)
+func NewServer(addr string, handler http.Handler, c Config) (*http.Server, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           withRequestID(CORS(handler, c.AllowedOrigins)),
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+	}
+	switch {
+	case c.CertFile != "":
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	case len(c.AutocertDomains) > 0:
+		// Challenge tls-alpn-01: the server must be reachable on port 443 of the domains
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.AutocertDomains...),
+		}
+		if c.AutocertCache != "" {
+			manager.Cache = autocert.DirCache(c.AutocertCache)
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+	}
+	return srv, nil
+}
+
+// ListenAndServe serves handler on addr until the server fails
+func ListenAndServe(addr string, handler http.Handler, c Config) error {
+	srv, err := NewServer(addr, handler, c)
+	if err != nil {
+		return err
+	}
+	if srv.TLSConfig != nil {
+		// Certificates are in TLSConfig
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// Headers of cross-origin requests
+const (
+	corsMethods = "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS"
+	corsHeaders = "Origin, Content-Length, Content-Type, Authorization, X-API-Key, " + RequestIDHeader + ", " + tusHeaders
+	corsMaxAge  = "43200" // Preflight responses cached 12 hours
+	// Headers of the resumable upload protocol (tus), sent and read by browser clients
+	tusHeaders = "Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata"
+)
+
+// CORS answers preflight requests and rejects (403) requests from origins
+// missing from allowed. Requests without Origin, or from the origin of the
+// server itself, are not checked. An empty allowed list disables the checks.
+func CORS(next http.Handler, allowed []string) http.Handler {
+	if len(allowed) == 0 {
+		return next
+	}
+	allowAll := false
+	origins := map[string]bool{}
+	for _, origin := range allowed {
+		if origin == "*" {
+			allowAll = true
+		}
+		origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(origin, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !allowAll && !origins[origin] {
+			WriteError(w, r, http.StatusForbidden, CodeOriginNotAllowed, "Origin not allowed", map[string]any{"origin": origin})
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// Filename of the downloaded PDFs, ID to quote when reporting an error,
+		// state of a resumable upload
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, "+RequestIDHeader+", Location, Upload-Job-Id, "+tusHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
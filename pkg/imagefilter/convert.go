@@ -0,0 +1,128 @@
+package imagefilter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Input formats that imgio and Tesseract cannot read, converted to PNG by
+// Converter
+const (
+	FormatHEIF = "heif" // HEIC/HEIF photos of iPhones
+	FormatWebP = "webp"
+)
+
+// ErrConverterMissing is returned when the tool converting a format is not installed
+var ErrConverterMissing = errors.New("image converter is not installed")
+
+// heifBrands are the ftyp brands of HEIF images (still images and
+// sequences). AVIF is HEIF with AV1 instead of HEVC: its files list mif1
+// among their brands and heif-convert decodes them as well (libheif built
+// with an AV1 decoder, as in the Debian and Alpine packages), so they are
+// FormatHEIF too.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true, "heim": true,
+	"heis": true, "hevm": true, "hevs": true, "mif1": true, "msf1": true,
+	"avif": true, "avis": true,
+}
+
+// InputFormat sniffs the header of the image and returns FormatHEIF or
+// FormatWebP when it must be converted, "" for formats read directly
+func InputFormat(imagePath string) (string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	header := make([]byte, 64)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF { // Short files are left to the decoder
+		return "", err
+	}
+	header = header[:n]
+	switch {
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return FormatWebP, nil
+	case len(header) >= 16 && bytes.Equal(header[4:8], []byte("ftyp")):
+		// Major brand, then the compatible brands after the minor version
+		if heifBrands[string(header[8:12])] {
+			return FormatHEIF, nil
+		}
+		for i := 16; i+4 <= len(header); i += 4 {
+			if heifBrands[string(header[i:i+4])] {
+				return FormatHEIF, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Converter converts HEIF images with heif-convert (libheif) and WebP
+// images with dwebp (libwebp) to PNG
+type Converter struct {
+	HEIFConvertPath string        // Default "heif-convert"
+	DWebPPath       string        // Default "dwebp"
+	Timeout         time.Duration // Per conversion, default 60s
+}
+
+// ConverterFromEnv reads HEIF_CONVERT_PATH, DWEBP_PATH and IMAGE_CONVERT_TIMEOUT
+func ConverterFromEnv() (Converter, error) {
+	c := Converter{HEIFConvertPath: os.Getenv("HEIF_CONVERT_PATH"), DWebPPath: os.Getenv("DWEBP_PATH")}
+	if v := os.Getenv("IMAGE_CONVERT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("IMAGE_CONVERT_TIMEOUT must be a positive duration such as 60s, got %q", v)
+		}
+		c.Timeout = d
+	}
+	return c, nil
+}
+
+// ToPNG converts a HEIF or WebP image to "<name>_converted.png" next to it,
+// with the rotation of HEIF photos applied. It returns the path to process,
+// imagePath itself for other formats, and the detected input format.
+func (c Converter) ToPNG(ctx context.Context, imagePath string) (string, string, error) {
+	format, err := InputFormat(imagePath)
+	if err != nil || format == "" {
+		return imagePath, "", err
+	}
+	outPath := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + "_converted.png"
+	var tool string
+	var args []string
+	switch format {
+	case FormatHEIF:
+		tool, args = orDefault(c.HEIFConvertPath, "heif-convert"), []string{imagePath, outPath}
+	case FormatWebP:
+		tool, args = orDefault(c.DWebPPath, "dwebp"), []string{imagePath, "-o", outPath}
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return "", format, fmt.Errorf("%w: %s is required to read %s images", ErrConverterMissing, tool, format)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, tool, args...).CombinedOutput(); err != nil {
+		os.Remove(outPath)
+		return "", format, fmt.Errorf("%s failed to convert %s: %w: %s", tool, imagePath, err, strings.TrimSpace(string(out)))
+	}
+	return outPath, format, nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+package imagefilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ftyp returns the ftyp box of an ISO media file
+func ftyp(major string, compatible ...string) []byte {
+	size := 16 + 4*len(compatible)
+	box := []byte{0, 0, 0, byte(size)}
+	box = append(box, "ftyp"+major+"\x00\x00\x00\x00"...)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	return box
+}
+
+func TestInputFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"iPhone HEIC", ftyp("heic", "mif1", "heic"), FormatHEIF},
+		{"HEIF sequence", ftyp("msf1", "msf1", "hevc"), FormatHEIF},
+		{"generic brand with HEIC", ftyp("mif1", "mif1", "heic"), FormatHEIF},
+		{"compatible brand only", ftyp("XXXX", "miaf", "heix"), FormatHEIF},
+		{"AVIF", ftyp("avif", "avif", "mif1", "miaf"), FormatHEIF},
+		{"AVIF sequence", ftyp("avis", "avis", "msf1"), FormatHEIF},
+		{"MP4 video", ftyp("isom", "isom", "iso2", "mp41"), ""},
+		{"QuickTime", ftyp("qt  ", "qt  "), ""},
+		{"truncated ftyp", []byte("\x00\x00\x00\x18ftyphei"), ""},
+		{"WebP lossy", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"), FormatWebP},
+		{"WebP lossless", []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00"), FormatWebP},
+		{"WAV audio", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), ""},
+		{"PNG", append(append([]byte{}, pngSignature...), pngChunk("IHDR", make([]byte, 13))...), ""},
+		{"JPEG", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 16, 'J', 'F', 'I', 'F', 0}, ""},
+		{"TIFF", []byte("II*\x00\x08\x00\x00\x00"), ""},
+		{"PDF", []byte("%PDF-1.7\n"), ""},
+		{"empty", nil, ""},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "input")
+			if err := os.WriteFile(path, tt.header, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := InputFormat(path)
+			if err != nil || got != tt.want {
+				t.Errorf("InputFormat = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+	if _, err := InputFormat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("InputFormat of a missing file = %v", err)
+	}
+}
+
+func TestToPNGOtherFormats(t *testing.T) {
+	// Formats read directly are returned as they are, without a converter
+	path := filepath.Join(t.TempDir(), "scan.png")
+	os.WriteFile(path, append(append([]byte{}, pngSignature...), pngChunk("IHDR", make([]byte, 13))...), 0o644)
+	c := Converter{HEIFConvertPath: "/nonexistent/heif-convert", DWebPPath: "/nonexistent/dwebp"}
+	out, format, err := c.ToPNG(t.Context(), path)
+	if err != nil || out != path || format != "" {
+		t.Errorf("ToPNG = %q, %q, %v; want the input unchanged", out, format, err)
+	}
+}
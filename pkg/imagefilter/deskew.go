@@ -0,0 +1,215 @@
+package imagefilter
+
+import (
+	"image"
+	"math"
+)
+
+// Skew search range and precision, in degrees. Phone photos of documents are
+// rarely skewed by more than a few degrees; larger rotations are handled by
+// the 90 degree orientation step.
+const (
+	maxSkew       = 15.0
+	coarseSkewDeg = 0.5
+	fineSkewDeg   = 0.1
+	minSkew       = 0.2 // Smaller angles are not worth the interpolation blur
+)
+
+// skewSampleWidth bounds the width of the image used to estimate the skew
+const skewSampleWidth = 1000
+
+// grayChannel extracts the gray levels of an image produced by
+// effect.Grayscale (R, G and B are equal)
+func grayChannel(img *image.RGBA) *image.Gray {
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			gray.Pix[y*gray.Stride+x] = img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y)]
+		}
+	}
+	return gray
+}
+
+// rotateRight rotates img clockwise by a multiple of 90 degrees
+func rotateRight(img *image.Gray, degrees int) *image.Gray {
+	degrees = ((degrees % 360) + 360) % 360
+	if degrees == 0 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var out *image.Gray
+	if degrees == 180 {
+		out = image.NewGray(image.Rect(0, 0, w, h))
+	} else {
+		out = image.NewGray(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y)]
+			switch degrees {
+			case 90:
+				out.Pix[out.PixOffset(h-1-y, x)] = v
+			case 180:
+				out.Pix[out.PixOffset(w-1-x, h-1-y)] = v
+			case 270:
+				out.Pix[out.PixOffset(y, w-1-x)] = v
+			}
+		}
+	}
+	return out
+}
+
+// estimateSkew returns the angle in degrees of the text lines of img
+// (positive when lines descend to the right). It searches the angle whose
+// horizontal projection of the dark pixels is the sharpest, i.e. where the
+// text lines fall into the fewest rows.
+func estimateSkew(img *image.Gray) float64 {
+	points := darkPoints(img)
+	if len(points) < 100 {
+		return 0
+	}
+	best, _ := searchSkew(points, -maxSkew, maxSkew, coarseSkewDeg)
+	best, score := searchSkew(points, best-coarseSkewDeg, best+coarseSkewDeg, fineSkewDeg)
+	if math.Abs(best) < minSkew || score <= projectionScore(points, 0) {
+		return 0
+	}
+	return math.Round(best/fineSkewDeg) * fineSkewDeg
+}
+
+// searchSkew evaluates the angles from..to by step and returns the best one
+// with its score
+func searchSkew(points [][2]float64, from, to, step float64) (float64, float64) {
+	bestAngle, bestScore := 0.0, -1.0
+	for angle := from; angle <= to+1e-9; angle += step {
+		if score := projectionScore(points, angle); score > bestScore {
+			bestAngle, bestScore = angle, score
+		}
+	}
+	return bestAngle, bestScore
+}
+
+// projectionScore is the sum of squared differences between adjacent rows
+// of the projection profile of points rotated by -angle. The empty rows
+// around the profile count, so that a solid block scores best unrotated.
+func projectionScore(points [][2]float64, angle float64) float64 {
+	rad := angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	rows := map[int]float64{}
+	minRow, maxRow := math.MaxInt32, math.MinInt32
+	for _, p := range points {
+		row := int(math.Round(p[1]*cos - p[0]*sin))
+		rows[row]++
+		if row < minRow {
+			minRow = row
+		}
+		if row > maxRow {
+			maxRow = row
+		}
+	}
+	score := 0.0
+	for row := minRow - 1; row <= maxRow; row++ {
+		d := rows[row+1] - rows[row]
+		score += d * d
+	}
+	return score
+}
+
+// darkPoints returns the coordinates of the dark pixels of img (below the
+// Otsu threshold), on a copy downsampled to skewSampleWidth
+func darkPoints(img *image.Gray) [][2]float64 {
+	b := img.Bounds()
+	step := 1
+	if b.Dx() > skewSampleWidth {
+		step = (b.Dx() + skewSampleWidth - 1) / skewSampleWidth
+	}
+	threshold := otsuThreshold(img)
+	var points [][2]float64
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			if img.Pix[img.PixOffset(x, y)] < threshold {
+				points = append(points, [2]float64{float64((x - b.Min.X) / step), float64((y - b.Min.Y) / step)})
+			}
+		}
+	}
+	return points
+}
+
+// otsuThreshold computes the gray level separating ink from paper
+func otsuThreshold(img *image.Gray) uint8 {
+	var hist [256]float64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y) : img.PixOffset(b.Min.X, y)+b.Dx()]
+		for _, v := range row {
+			hist[v]++
+		}
+	}
+	total := float64(b.Dx() * b.Dy())
+	var sumAll float64
+	for i, n := range hist {
+		sumAll += float64(i) * n
+	}
+	var sumB, weightB, bestVar float64
+	threshold := uint8(128)
+	for i, n := range hist {
+		weightB += n
+		if weightB == 0 {
+			continue
+		}
+		weightF := total - weightB
+		if weightF == 0 {
+			break
+		}
+		sumB += float64(i) * n
+		meanB, meanF := sumB/weightB, (sumAll-sumB)/weightF
+		if v := weightB * weightF * (meanB - meanF) * (meanB - meanF); v > bestVar {
+			bestVar, threshold = v, uint8(i)
+		}
+	}
+	return threshold
+}
+
+// rotate rotates img counter-clockwise by degrees around its center with
+// bilinear interpolation. The canvas grows to keep the corners and the
+// uncovered area is white.
+func rotate(img *image.Gray, degrees float64) *image.Gray {
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	rad := degrees * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	outW := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin)))
+	outH := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos)))
+	out := image.NewGray(image.Rect(0, 0, outW, outH))
+
+	cx, cy := w/2, h/2
+	ocx, ocy := float64(outW)/2, float64(outH)/2
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			// Inverse mapping: output pixel -> source position (y axis points down)
+			dx, dy := float64(x)+0.5-ocx, float64(y)+0.5-ocy
+			sx := dx*cos - dy*sin + cx - 0.5
+			sy := dx*sin + dy*cos + cy - 0.5
+			out.Pix[y*out.Stride+x] = sampleBilinear(img, sx, sy)
+		}
+	}
+	return out
+}
+
+// sampleBilinear interpolates img at (x, y) relative to its bounds, white
+// outside the image
+func sampleBilinear(img *image.Gray, x, y float64) uint8 {
+	b := img.Bounds()
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	at := func(px, py int) float64 {
+		if px < 0 || py < 0 || px >= b.Dx() || py >= b.Dy() {
+			return 255
+		}
+		return float64(img.Pix[img.PixOffset(b.Min.X+px, b.Min.Y+py)])
+	}
+	top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+	bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+	return uint8(math.Round(top*(1-fy) + bottom*fy))
+}
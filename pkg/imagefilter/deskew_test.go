@@ -0,0 +1,139 @@
+package imagefilter
+
+import (
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// textPage is a white page with rows of dark "words", like lines of text
+func textPage(w, h int) *image.Gray {
+	page := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range page.Pix {
+		page.Pix[i] = 255
+	}
+	for top := 40; top+12 < h-40; top += 30 {
+		for x := 40; x < w-40; x++ {
+			if (x/50+top/30)%4 == 3 || x%50 > 42 {
+				continue // Spaces between the words
+			}
+			for y := top; y < top+12; y++ {
+				page.Pix[y*page.Stride+x] = 20
+			}
+		}
+	}
+	return page
+}
+
+func TestRotateRight(t *testing.T) {
+	// 3×2 image with a distinct value per pixel
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(img.Pix, []uint8{1, 2, 3, 4, 5, 6})
+	tests := []struct {
+		degrees int
+		w, h    int
+		want    []uint8
+	}{
+		{0, 3, 2, []uint8{1, 2, 3, 4, 5, 6}},
+		{90, 2, 3, []uint8{4, 1, 5, 2, 6, 3}},
+		{180, 3, 2, []uint8{6, 5, 4, 3, 2, 1}},
+		{270, 2, 3, []uint8{3, 6, 2, 5, 1, 4}},
+		{-90, 2, 3, []uint8{3, 6, 2, 5, 1, 4}},
+		{450, 2, 3, []uint8{4, 1, 5, 2, 6, 3}},
+	}
+	for _, tt := range tests {
+		got := rotateRight(img, tt.degrees)
+		if got.Bounds().Dx() != tt.w || got.Bounds().Dy() != tt.h || string(got.Pix) != string(tt.want) {
+			t.Errorf("rotateRight(%d) = %dx%d %v, want %dx%d %v", tt.degrees, got.Bounds().Dx(), got.Bounds().Dy(), got.Pix, tt.w, tt.h, tt.want)
+		}
+	}
+}
+
+func TestEstimateSkew(t *testing.T) {
+	page := textPage(800, 600)
+	if skew := estimateSkew(page); skew != 0 {
+		t.Errorf("estimateSkew of a straight page = %.1f", skew)
+	}
+	for _, degrees := range []float64{-7, -2.5, 1, 4.3, 12} {
+		// rotate turns counter-clockwise: -degrees makes the lines descend to the right
+		skewed := rotate(page, -degrees)
+		skew := estimateSkew(skewed)
+		if math.Abs(skew-degrees) > 0.2 {
+			t.Errorf("estimateSkew of a page skewed by %.1f = %.1f", degrees, skew)
+		}
+		if residual := estimateSkew(rotate(skewed, skew)); residual != 0 {
+			t.Errorf("skew %.1f left after correcting %.1f", residual, degrees)
+		}
+	}
+	// Below minSkew the page is left as it is
+	if skew := estimateSkew(rotate(page, -0.1)); skew != 0 {
+		t.Errorf("estimateSkew of a page skewed by 0.1 = %.1f, want 0", skew)
+	}
+	blank, dark := textPage(200, 60), image.NewGray(image.Rect(0, 0, 200, 200))
+	if skew := estimateSkew(blank); skew != 0 {
+		t.Errorf("estimateSkew of a blank page = %.1f", skew)
+	}
+	if skew := estimateSkew(dark); skew != 0 {
+		t.Errorf("estimateSkew of a dark page = %.1f", skew)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	page := textPage(400, 300)
+	out := rotate(page, 30)
+	// The canvas grows to keep the corners
+	w := math.Ceil(400*math.Cos(math.Pi/6) + 300*math.Sin(math.Pi/6))
+	h := math.Ceil(400*math.Sin(math.Pi/6) + 300*math.Cos(math.Pi/6))
+	if out.Bounds().Dx() != int(w) || out.Bounds().Dy() != int(h) {
+		t.Errorf("rotated canvas = %v, want %.0fx%.0f", out.Bounds(), w, h)
+	}
+	if out.Pix[0] != 255 || out.Pix[len(out.Pix)-1] != 255 {
+		t.Error("uncovered corners are not white")
+	}
+	if same := rotate(page, 0); string(same.Pix) != string(page.Pix) {
+		t.Error("rotate by 0 changed the image")
+	}
+	if threshold := otsuThreshold(page); threshold < 20 || threshold >= 255 {
+		t.Errorf("otsuThreshold = %d, want between ink and paper", threshold)
+	}
+}
+
+func TestApplyFiltersOrientation(t *testing.T) {
+	// A page photographed sideways (turned 90° counter-clockwise) and skewed by 3°
+	page := rotateRight(rotate(textPage(800, 600), -3), 270)
+	path := filepath.Join(t.TempDir(), "page.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, page); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	filtered, correction, err := ApplyFiltersWithOptions(path, Options{Rotate: 90, Deskew: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correction.Rotation != 90 || math.Abs(correction.Skew-3) > 0.2 {
+		t.Errorf("correction = %+v, want 90° and a 3° skew", correction)
+	}
+	out, err := os.Open(filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	img, err := png.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() <= b.Dy() {
+		t.Errorf("filtered page is %v, want landscape like the original", b)
+	}
+	if _, _, err := ApplyFiltersWithOptions(path, Options{Rotate: 45}); err == nil {
+		t.Error("rotation by 45 degrees accepted")
+	}
+}
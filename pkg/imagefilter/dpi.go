@@ -0,0 +1,248 @@
+package imagefilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sources of a resolved DPI
+const (
+	DPISourceRequest    = "request"    // Per-job override
+	DPISourceConfig     = "config"     // Fixed value of the deployment
+	DPISourceMetadata   = "metadata"   // EXIF, JFIF density or PNG pHYs of the image
+	DPISourceDimensions = "dimensions" // Estimated from the pixel size, assuming a full page
+)
+
+// Limits of any DPI value accepted from a request or the configuration
+const (
+	MinDPI = 50
+	MaxDPI = 2400
+)
+
+// pageLongSide is the long side in inches of the page assumed when the DPI is
+// estimated from the pixel size (US Letter; A4 is 11.7)
+const pageLongSide = 11.0
+
+// DPIConfig selects the resolution given to OCR
+type DPIConfig struct {
+	Fixed int // Resolution of every image unless overridden per job, 0 infers it
+	Min   int // Bounds of the resolved value
+	Max   int
+}
+
+// DefaultDPIConfig infers the resolution and clamps it to the range where
+// Tesseract works well (it rejects below 70 DPI)
+func DefaultDPIConfig() DPIConfig {
+	return DPIConfig{Min: 70, Max: 600}
+}
+
+// DPIConfigFromEnv reads OCR_DPI ("auto" or a fixed value), OCR_DPI_MIN and OCR_DPI_MAX
+func DPIConfigFromEnv() (DPIConfig, error) {
+	config := DefaultDPIConfig()
+	for _, v := range []struct {
+		name  string
+		value *int
+	}{{"OCR_DPI", &config.Fixed}, {"OCR_DPI_MIN", &config.Min}, {"OCR_DPI_MAX", &config.Max}} {
+		raw := os.Getenv(v.name)
+		if raw == "" || (v.name == "OCR_DPI" && strings.EqualFold(raw, "auto")) {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < MinDPI || n > MaxDPI {
+			return config, fmt.Errorf("%s must be between %d and %d, got %q", v.name, MinDPI, MaxDPI, raw)
+		}
+		*v.value = n
+	}
+	if config.Min > config.Max {
+		return config, fmt.Errorf("OCR_DPI_MIN (%d) is greater than OCR_DPI_MAX (%d)", config.Min, config.Max)
+	}
+	return config, nil
+}
+
+// DPI is the resolution chosen for an image
+type DPI struct {
+	Value   int
+	Source  string
+	Clamped bool // The candidate value was outside the bounds
+}
+
+// Resolve returns the DPI of the image: the override (0: none), the fixed
+// value, the image metadata or an estimate from its size, clamped to the bounds
+func (c DPIConfig) Resolve(imagePath string, override int) (DPI, error) {
+	var dpi DPI
+	switch {
+	case override > 0:
+		dpi = DPI{Value: override, Source: DPISourceRequest}
+	case c.Fixed > 0:
+		dpi = DPI{Value: c.Fixed, Source: DPISourceConfig}
+	default:
+		f, err := os.Open(imagePath)
+		if err != nil {
+			return DPI{}, err
+		}
+		defer f.Close()
+		header, err := io.ReadAll(io.LimitReader(f, 1<<20)) // Metadata precedes the pixel data
+		if err != nil {
+			return DPI{}, err
+		}
+		if value := metadataDPI(header); value > 0 {
+			dpi = DPI{Value: value, Source: DPISourceMetadata}
+			break
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return DPI{}, err
+		}
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return DPI{}, fmt.Errorf("failed to read image size of %s: %w", imagePath, err)
+		}
+		long := max(cfg.Width, cfg.Height)
+		dpi = DPI{Value: int(math.Round(float64(long) / pageLongSide)), Source: DPISourceDimensions}
+	}
+	if c.Min > 0 && dpi.Value < c.Min {
+		dpi.Value, dpi.Clamped = c.Min, true
+	}
+	if c.Max > 0 && dpi.Value > c.Max {
+		dpi.Value, dpi.Clamped = c.Max, true
+	}
+	return dpi, nil
+}
+
+// metadataDPI returns the horizontal resolution stored in a PNG or JPEG
+// header, 0 if there is none. 72 and 96 DPI are ignored: cameras and editors
+// write them as placeholders regardless of the real resolution.
+func metadataDPI(data []byte) int {
+	var dpi float64
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		dpi = pngDPI(data)
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		dpi = jpegDPI(data)
+	}
+	value := int(math.Round(dpi))
+	if value == 72 || value == 96 {
+		return 0
+	}
+	return value
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngDPI reads the pHYs chunk (pixels per meter)
+func pngDPI(data []byte) float64 {
+	for pos := len(pngSignature); pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		body := data[pos+8:]
+		if length > len(body) || kind == "IDAT" {
+			return 0
+		}
+		if kind == "pHYs" && length >= 9 && body[8] == 1 {
+			return float64(binary.BigEndian.Uint32(body)) * 0.0254
+		}
+		pos += 12 + length
+	}
+	return 0
+}
+
+// jpegDPI reads the EXIF resolution, or the JFIF density if there is no EXIF
+func jpegDPI(data []byte) float64 {
+	var jfif float64
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) { // Start of scan
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+		switch {
+		case marker == 0xE0 && len(segment) >= 12 && bytes.HasPrefix(segment, []byte("JFIF\x00")):
+			density := float64(binary.BigEndian.Uint16(segment[8:]))
+			switch segment[7] {
+			case 1: // Dots per inch
+				jfif = density
+			case 2: // Dots per cm
+				jfif = density * 2.54
+			}
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			if dpi := exifDPI(segment[6:]); dpi > 0 {
+				return dpi
+			}
+		}
+		pos += 2 + length
+	}
+	return jfif
+}
+
+// exifDPI reads XResolution and ResolutionUnit from IFD0 of a TIFF structure
+func exifDPI(tiff []byte) float64 {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	var resolution float64
+	unit := uint16(2) // Inches unless stated otherwise
+	for i := 0; i < int(order.Uint16(tiff[ifd:])); i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			break
+		}
+		switch order.Uint16(tiff[entry:]) {
+		case 0x011A: // XResolution, RATIONAL stored at an offset
+			offset := int(order.Uint32(tiff[entry+8:]))
+			if offset+8 <= len(tiff) {
+				if den := order.Uint32(tiff[offset+4:]); den != 0 {
+					resolution = float64(order.Uint32(tiff[offset:])) / float64(den)
+				}
+			}
+		case 0x0128: // ResolutionUnit
+			unit = order.Uint16(tiff[entry+8:])
+		}
+	}
+	if unit == 3 { // Centimeters
+		resolution *= 2.54
+	}
+	return resolution
+}
+
+// withPNGDPI inserts a pHYs chunk with the resolution after the IHDR chunk
+// of encoded PNG data, so OCR engines reading the file use it
+func withPNGDPI(data []byte, dpi int) []byte {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4 // Signature + IHDR length, type, data, CRC
+	if dpi <= 0 || len(data) < ihdrEnd || !bytes.HasPrefix(data, pngSignature) {
+		return data
+	}
+	ppm := uint32(math.Round(float64(dpi) / 0.0254))
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk, 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1 // Unit: meter
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
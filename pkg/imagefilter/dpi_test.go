@@ -0,0 +1,171 @@
+package imagefilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pngHeader is the signature and the IHDR chunk of a 1×1 grayscale PNG
+func pngHeader() []byte {
+	return append(append([]byte{}, pngSignature...), pngChunk("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0})...)
+}
+
+// pHYs returns a pHYs chunk of the same density on both axes
+func pHYs(ppm uint32, unit byte) []byte {
+	body := binary.BigEndian.AppendUint32(nil, ppm)
+	body = binary.BigEndian.AppendUint32(body, ppm)
+	return pngChunk("pHYs", append(body, unit))
+}
+
+// jfif returns a JFIF APP0 segment
+func jfif(unit byte, density uint16) []byte {
+	body := []byte("JFIF\x00\x01\x02")
+	body = append(body, unit)
+	body = binary.BigEndian.AppendUint16(body, density)
+	body = binary.BigEndian.AppendUint16(body, density)
+	return jpegSegment(0xE0, append(body, 0, 0))
+}
+
+// resolutionTIFF is a TIFF structure whose IFD0 has XResolution num/den,
+// stored after the IFD, and ResolutionUnit unit (0: no tag)
+func resolutionTIFF(order binary.AppendByteOrder, num, den uint32, unit uint16) []byte {
+	tiff := []byte("II*\x00")
+	if order == binary.BigEndian {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+	entries := uint16(1)
+	if unit != 0 {
+		entries++
+	}
+	tiff = order.AppendUint16(tiff, entries)
+	rational := uint32(8 + 2 + 12*int(entries) + 4)
+	tiff = order.AppendUint16(tiff, 0x011A) // XResolution, RATIONAL
+	tiff = order.AppendUint16(tiff, 5)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint32(tiff, rational)
+	if unit != 0 {
+		tiff = order.AppendUint16(tiff, 0x0128) // ResolutionUnit, SHORT
+		tiff = order.AppendUint16(tiff, 3)
+		tiff = order.AppendUint32(tiff, 1)
+		tiff = order.AppendUint16(tiff, unit)
+		tiff = append(tiff, 0, 0)
+	}
+	tiff = append(tiff, 0, 0, 0, 0) // No next IFD
+	tiff = order.AppendUint32(tiff, num)
+	return order.AppendUint32(tiff, den)
+}
+
+// jpegWith returns the start of a JPEG made of the segments, then the start
+// of scan
+func jpegWith(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, s := range segments {
+		data = append(data, s...)
+	}
+	return append(data, 0xFF, 0xDA, 0, 2)
+}
+
+// exifSegment returns an APP1 segment holding the TIFF structure
+func exifSegment(tiff []byte) []byte {
+	return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func TestMetadataDPI(t *testing.T) {
+	png := func(chunks ...[]byte) []byte {
+		data := pngHeader()
+		for _, c := range chunks {
+			data = append(data, c...)
+		}
+		return append(data, pngChunk("IEND", nil)...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"png 300", png(pHYs(11811, 1)), 300},
+		{"png 600", png(pngChunk("tEXt", []byte("a\x00b")), pHYs(23622, 1)), 600},
+		{"png aspect ratio only", png(pHYs(11811, 0)), 0},
+		{"png 72 placeholder", png(pHYs(2835, 1)), 0},
+		{"png 96 placeholder", png(pHYs(3780, 1)), 0},
+		{"png pHYs after IDAT", png(pngChunk("IDAT", []byte{0}), pHYs(11811, 1)), 0},
+		{"png truncated chunk", pngHeader()[:len(pngHeader())-2], 0},
+		{"png without pHYs", png(), 0},
+		{"jfif inches", jpegWith(jfif(1, 300)), 300},
+		{"jfif centimeters", jpegWith(jfif(2, 118)), 300},
+		{"jfif aspect ratio only", jpegWith(jfif(0, 1)), 0},
+		{"jfif 72 placeholder", jpegWith(jfif(1, 72)), 0},
+		{"exif little endian", jpegWith(exifSegment(resolutionTIFF(binary.LittleEndian, 300, 1, 2))), 300},
+		{"exif big endian", jpegWith(exifSegment(resolutionTIFF(binary.BigEndian, 400, 1, 0))), 400},
+		{"exif centimeters", jpegWith(exifSegment(resolutionTIFF(binary.BigEndian, 236220, 2000, 3))), 300},
+		{"exif fraction", jpegWith(exifSegment(resolutionTIFF(binary.LittleEndian, 601, 2, 2))), 301},
+		{"exif zero denominator", jpegWith(exifSegment(resolutionTIFF(binary.LittleEndian, 300, 0, 2))), 0},
+		{"exif before jfif", jpegWith(jfif(1, 150), exifSegment(resolutionTIFF(binary.LittleEndian, 300, 1, 2))), 300},
+		{"jfif when exif has no resolution", jpegWith(jfif(1, 150), exifSegment(cameraTIFF(1))), 150},
+		{"exif not tiff", jpegWith(exifSegment([]byte("XX*\x00\x08\x00\x00\x00"))), 0},
+		{"exif offset out of range", jpegWith(exifSegment([]byte("II*\x00\xff\x00\x00\x00"))), 0},
+		{"segment longer than the data", append([]byte{0xFF, 0xD8}, jfif(1, 300)[:8]...), 0},
+		{"after start of scan", append(jpegWith(), jfif(1, 300)...), 0},
+		{"not an image", []byte("%PDF-1.7"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metadataDPI(tt.data); got != tt.want {
+				t.Errorf("metadataDPI = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithPNGDPI(t *testing.T) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 3300, 10))); err != nil {
+		t.Fatal(err)
+	}
+	data := withPNGDPI(b.Bytes(), 400)
+	if got := metadataDPI(data); got != 400 {
+		t.Errorf("metadataDPI = %d, want 400", got)
+	}
+	// The chunk is valid: the CRC is checked by the decoder
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil || img.Bounds().Dx() != 3300 {
+		t.Fatalf("decoding the PNG: %v", err)
+	}
+	if got := withPNGDPI(b.Bytes(), 0); !bytes.Equal(got, b.Bytes()) {
+		t.Error("PNG changed without a DPI")
+	}
+	if got := withPNGDPI([]byte("not a png"), 300); string(got) != "not a png" {
+		t.Errorf("withPNGDPI of other data = %q", got)
+	}
+
+	// Resolve reads it back; without it the size gives 3300 / 11 = 300
+	dir := t.TempDir()
+	tagged, plain := filepath.Join(dir, "tagged.png"), filepath.Join(dir, "plain.png")
+	os.WriteFile(tagged, data, 0o644)
+	os.WriteFile(plain, b.Bytes(), 0o644)
+	config := DefaultDPIConfig()
+	for _, tt := range []struct {
+		config   DPIConfig
+		path     string
+		override int
+		want     DPI
+	}{
+		{config, tagged, 0, DPI{Value: 400, Source: DPISourceMetadata}},
+		{config, plain, 0, DPI{Value: 300, Source: DPISourceDimensions}},
+		{config, tagged, 200, DPI{Value: 200, Source: DPISourceRequest}},
+		{DPIConfig{Fixed: 250, Min: 70, Max: 600}, tagged, 0, DPI{Value: 250, Source: DPISourceConfig}},
+		{DPIConfig{Min: 70, Max: 350}, tagged, 0, DPI{Value: 350, Source: DPISourceMetadata, Clamped: true}},
+		{config, tagged, 50, DPI{Value: 70, Source: DPISourceRequest, Clamped: true}},
+	} {
+		got, err := tt.config.Resolve(tt.path, tt.override)
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%s, %d) with %+v = %+v, %v; want %+v", filepath.Base(tt.path), tt.override, tt.config, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package imagefilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anthonynsimon/bild/imgio"
+)
+
+// Orientation reads the EXIF orientation of a JPEG or PNG image: 1 (upright,
+// also returned without EXIF) to 8, as defined by the TIFF Orientation tag.
+// Phone cameras store the pixels as captured and set this tag instead of
+// rotating the photo.
+func Orientation(imagePath string) int {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return 1
+	}
+	if tiff := exifData(data); tiff != nil {
+		if o := exifOrientation(tiff); o >= 1 && o <= 8 {
+			return o
+		}
+	}
+	return 1
+}
+
+// exifData returns the TIFF structure of the EXIF of JPEG (APP1) or PNG
+// (eXIf chunk) data, nil if there is none
+func exifData(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+			marker := data[pos+1]
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+				break
+			}
+			segment := data[pos+4 : pos+2+length]
+			if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				return segment[6:]
+			}
+			pos += 2 + length
+		}
+	case bytes.HasPrefix(data, pngSignature):
+		for pos := len(pngSignature); pos+8 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			kind := string(data[pos+4 : pos+8])
+			if length > len(data)-pos-12 || kind == "IDAT" {
+				break
+			}
+			if kind == "eXIf" {
+				return data[pos+8 : pos+8+length]
+			}
+			pos += 12 + length
+		}
+	}
+	return nil
+}
+
+// exifOrientation reads the Orientation tag from IFD0 of a TIFF structure, 0 if absent
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	for i := 0; i < int(order.Uint16(tiff[ifd:])); i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 { // Orientation, SHORT
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// Orient returns the image as it is meant to be displayed according to its
+// EXIF orientation (see Orientation)
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // Rotated by 90 or 270 degrees: width and height swap
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180 degrees
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Rotated 90 degrees clockwise to display
+				sx, sy = y, h-1-x
+			case 7: // Transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotated 90 degrees counter-clockwise to display
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, color.NRGBAModel.Convert(img.At(b.Min.X+sx, b.Min.Y+sy)))
+		}
+	}
+	return dst
+}
+
+// AutoOrient writes an upright PNG copy ("<name>_upright.png") of an image
+// whose EXIF orientation is not upright, so OCR, orientation detection and
+// crop regions (given on the displayed image) see the photo as displayed. It
+// returns the path to use, imagePath itself if the image is upright, and the
+// orientation that was applied.
+func AutoOrient(imagePath string) (string, int, error) {
+	orientation := Orientation(imagePath)
+	if orientation == 1 {
+		return imagePath, 1, nil
+	}
+	img, err := imgio.Open(imagePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open image %s: %w", imagePath, err)
+	}
+	uprightPath := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + "_upright.png"
+	if err := imgio.Save(uprightPath, Orient(img, orientation), imgio.PNGEncoder()); err != nil {
+		return "", 0, fmt.Errorf("failed to save upright image %s: %w", uprightPath, err)
+	}
+	return uprightPath, orientation, nil
+}
+
+// StripMetadata removes the metadata that can identify the author of a JPEG
+// or PNG image (EXIF with GPS position and camera model, XMP, IPTC, comments,
+// PNG text chunks) from the file, without re-encoding the pixels. The EXIF
+// orientation is kept, alone in a minimal EXIF block, so the image is still
+// displayed upright. Other formats are left unchanged. It returns the kinds
+// of metadata removed ("exif", "xmp", "iptc", "comment", "text"), nil if none.
+func StripMetadata(imagePath string) ([]string, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	orientation := 1
+	if tiff := exifData(data); tiff != nil {
+		if o := exifOrientation(tiff); o >= 2 && o <= 8 {
+			orientation = o
+		}
+	}
+	var stripped []byte
+	var removed []string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		stripped, removed = stripJPEG(data, orientation)
+	case bytes.HasPrefix(data, pngSignature):
+		stripped, removed = stripPNG(data, orientation)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	tmp := imagePath + ".tmp"
+	if err := os.WriteFile(tmp, stripped, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, imagePath); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return removed, nil
+}
+
+// orientationTIFF is a big endian TIFF structure with only the Orientation tag
+func orientationTIFF(orientation int) []byte {
+	return []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, 0, 0, 0, 0}
+}
+
+func addKind(kinds []string, kind string) []string {
+	for _, k := range kinds {
+		if k == kind {
+			return kinds
+		}
+	}
+	return append(kinds, kind)
+}
+
+// stripJPEG keeps the segments needed to decode and display the image: JFIF
+// (APP0), ICC profile (APP2), Adobe color transform (APP14) and the image data
+func stripJPEG(data []byte, orientation int) ([]byte, []string) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	if orientation != 1 {
+		exif := append([]byte("Exif\x00\x00"), orientationTIFF(orientation)...)
+		out = append(out, 0xFF, 0xE1, byte((len(exif)+2)>>8), byte(len(exif)+2))
+		out = append(out, exif...)
+	}
+	var removed []string
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+		keep := true
+		switch {
+		case marker == 0xE1 && bytes.Equal(segment, append([]byte("Exif\x00\x00"), orientationTIFF(orientation)...)):
+			keep = false // Already stripped: replaced by the same block
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			keep, removed = false, addKind(removed, "exif")
+		case marker == 0xE1:
+			keep, removed = false, addKind(removed, "xmp")
+		case marker == 0xED:
+			keep, removed = false, addKind(removed, "iptc")
+		case marker == 0xFE:
+			keep, removed = false, addKind(removed, "comment")
+		case marker == 0xE2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")):
+		case marker == 0xE0 || marker == 0xEE:
+		case marker >= 0xE2 && marker <= 0xEF: // Maker notes, multi-picture data...
+			keep, removed = false, addKind(removed, "exif")
+		}
+		if keep {
+			out = append(out, data[pos:pos+2+length]...)
+		}
+		pos += 2 + length
+	}
+	return append(out, data[pos:]...), removed
+}
+
+// stripPNG removes the eXIf, text and time chunks
+func stripPNG(data []byte, orientation int) ([]byte, []string) {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	var removed []string
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		if length > len(data)-pos-12 {
+			break
+		}
+		chunk := data[pos : pos+12+length]
+		pos += 12 + length
+		switch kind {
+		case "eXIf":
+			if !bytes.Equal(chunk[8:8+length], orientationTIFF(orientation)) { // Not already stripped
+				removed = addKind(removed, "exif")
+			}
+			if orientation != 1 {
+				out = append(out, pngChunk("eXIf", orientationTIFF(orientation))...)
+			}
+			continue
+		case "tEXt", "zTXt", "iTXt", "tIME":
+			removed = addKind(removed, "text")
+			continue
+		}
+		out = append(out, chunk...)
+	}
+	return append(out, data[pos:]...), removed
+}
+
+func pngChunk(kind string, body []byte) []byte {
+	chunk := make([]byte, 8, 12+len(body))
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, body...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
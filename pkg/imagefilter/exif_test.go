@@ -0,0 +1,180 @@
+package imagefilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// cameraTIFF is a little endian TIFF structure with the Orientation tag and
+// the camera make "ABC", like the EXIF of a phone photo
+func cameraTIFF(orientation int) []byte {
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 2, 0}
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x010F) // Make, ASCII, 4 bytes inline
+	tiff = append(tiff, 2, 0, 4, 0, 0, 0, 'A', 'B', 'C', 0)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112) // Orientation, SHORT
+	tiff = append(tiff, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0)
+	return append(tiff, 0, 0, 0, 0)
+}
+
+// jpegSegment returns a JPEG marker segment
+func jpegSegment(marker byte, body []byte) []byte {
+	return append([]byte{0xFF, marker, byte((len(body) + 2) >> 8), byte(len(body) + 2)}, body...)
+}
+
+// writePhoto writes a 4×2 JPEG with an EXIF block of orientation, XMP and a
+// comment after the SOI marker
+func writePhoto(t *testing.T, orientation int) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, image.NewGray(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{0xFF, 0xD8}
+	data = append(data, jpegSegment(0xE1, append([]byte("Exif\x00\x00"), cameraTIFF(orientation)...))...)
+	data = append(data, jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))...)
+	data = append(data, jpegSegment(0xFE, []byte("taken by ABC"))...)
+	data = append(data, b.Bytes()[2:]...)
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeAnnotatedPNG writes a PNG with an eXIf chunk of orientation and a
+// text chunk after IHDR
+func writeAnnotatedPNG(t *testing.T, orientation int) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	ihdrEnd := len(pngSignature) + 12 + 13
+	data := append([]byte{}, b.Bytes()[:ihdrEnd]...)
+	data = append(data, pngChunk("eXIf", cameraTIFF(orientation))...)
+	data = append(data, pngChunk("tEXt", []byte("Author\x00ABC"))...)
+	data = append(data, b.Bytes()[ihdrEnd:]...)
+	path := filepath.Join(t.TempDir(), "scan.png")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOrientation(t *testing.T) {
+	if o := Orientation(writePhoto(t, 6)); o != 6 {
+		t.Errorf("JPEG orientation = %d, want 6", o)
+	}
+	if o := Orientation(writeAnnotatedPNG(t, 3)); o != 3 {
+		t.Errorf("PNG orientation = %d, want 3", o)
+	}
+	if o := Orientation(writePhoto(t, 9)); o != 1 {
+		t.Errorf("invalid orientation read as %d, want 1", o)
+	}
+	if o := Orientation(filepath.Join(t.TempDir(), "missing.jpg")); o != 1 {
+		t.Errorf("missing file: orientation %d, want 1", o)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	a, b := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1)) // [a b]
+	src.Set(0, 0, a)
+	src.Set(1, 0, b)
+	tests := []struct {
+		orientation int
+		want        []color.NRGBA // Pixels of the result, row by row
+		w, h        int
+	}{
+		{1, []color.NRGBA{a, b}, 2, 1},
+		{2, []color.NRGBA{b, a}, 2, 1},
+		{3, []color.NRGBA{b, a}, 2, 1},
+		{4, []color.NRGBA{a, b}, 2, 1},
+		{5, []color.NRGBA{a, b}, 1, 2},
+		{6, []color.NRGBA{a, b}, 1, 2}, // Turned clockwise: the left pixel goes on top
+		{7, []color.NRGBA{b, a}, 1, 2},
+		{8, []color.NRGBA{b, a}, 1, 2},
+	}
+	for _, tt := range tests {
+		img := Orient(src, tt.orientation)
+		if img.Bounds().Dx() != tt.w || img.Bounds().Dy() != tt.h {
+			t.Errorf("orientation %d: size %v, want %dx%d", tt.orientation, img.Bounds().Size(), tt.w, tt.h)
+			continue
+		}
+		var got []color.NRGBA
+		for y := 0; y < tt.h; y++ {
+			for x := 0; x < tt.w; x++ {
+				got = append(got, color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA))
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("orientation %d: pixels %v, want %v", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestAutoOrient(t *testing.T) {
+	path, orientation, err := AutoOrient(writePhoto(t, 6))
+	if err != nil || orientation != 6 || filepath.Base(path) != "photo_upright.png" {
+		t.Fatalf("AutoOrient = %s, %d, %v", path, orientation, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil || cfg.Width != 2 || cfg.Height != 4 {
+		t.Fatalf("upright image %dx%d, %v; want 2x4", cfg.Width, cfg.Height, err)
+	}
+
+	upright := writePhoto(t, 1)
+	if path, orientation, err := AutoOrient(upright); path != upright || orientation != 1 || err != nil {
+		t.Fatalf("upright photo: AutoOrient = %s, %d, %v", path, orientation, err)
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		removed     []string
+		orientation int
+	}{
+		{"jpeg", writePhoto(t, 6), []string{"exif", "xmp", "comment"}, 6},
+		{"upright jpeg", writePhoto(t, 1), []string{"exif", "xmp", "comment"}, 1},
+		{"png", writeAnnotatedPNG(t, 8), []string{"exif", "text"}, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, err := StripMetadata(tt.path)
+			if err != nil || !reflect.DeepEqual(removed, tt.removed) {
+				t.Fatalf("StripMetadata = %v, %v; want %v", removed, err, tt.removed)
+			}
+			data, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(data, []byte("ABC")) || bytes.Contains(data, []byte("xmpmeta")) {
+				t.Error("metadata still in the file")
+			}
+			if o := Orientation(tt.path); o != tt.orientation {
+				t.Errorf("orientation = %d after stripping, want %d", o, tt.orientation)
+			}
+			if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("stripped image does not decode: %v", err)
+			}
+			if removed, err := StripMetadata(tt.path); removed != nil || err != nil {
+				t.Errorf("second StripMetadata = %v, %v; want nothing removed", removed, err)
+			}
+		})
+	}
+}
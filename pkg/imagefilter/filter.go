@@ -1,7 +1,12 @@
 package imagefilter
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -11,22 +16,85 @@ import (
 	// "github.com/anthonynsimon/bild/blur"
 )
 
+// Rect is a region of the image in normalized coordinates (0-1, origin at
+// the top left corner)
+type Rect struct {
+	X, Y, Width, Height float64
+}
+
+// Options enables the geometric corrections applied before OCR
+type Options struct {
+	// Crop keeps only this region of the image (nil: whole image). It is
+	// applied first, in the coordinates of the original image.
+	Crop *Rect
+	// Rotate is the clockwise rotation in degrees (a multiple of 90) that
+	// makes the page upright, e.g. the "Rotate" value of Tesseract OSD
+	Rotate int
+	// Deskew estimates and corrects the small skew of photographed pages
+	Deskew bool
+	// DPI is stored in the filtered image (PNG pHYs) for OCR, 0 leaves it unset
+	DPI int
+}
+
+// Correction records the corrections that were applied
+type Correction struct {
+	Rotation int     // Clockwise rotation in degrees
+	Skew     float64 // Detected skew in degrees (positive: lines descending to the right), 0 if none
+}
+
 // ApplyFilters applies pre-processing filters using the bild library.
 // Implements ONLY Grayscale conversion.
 // Returns the path to the filtered grayscale image.
 func ApplyFilters(imagePath string) (string, error) {
-	fmt.Printf("Applying bild Grayscale filter ONLY to: %s\n", imagePath)
+	filteredImagePath, _, err := ApplyFiltersWithOptions(imagePath, Options{})
+	return filteredImagePath, err
+}
+
+// ApplyFiltersWithOptions converts the image to grayscale, then rotates it
+// upright and corrects its skew as requested by opts. Returns the path to
+// the filtered image and the applied corrections.
+func ApplyFiltersWithOptions(imagePath string, opts Options) (string, *Correction, error) {
+	fmt.Printf("Applying bild Grayscale filter to: %s\n", imagePath)
 
 	// Mở ảnh gốc sử dụng bild
 	srcImage, err := imgio.Open(imagePath)
 	if err != nil {
-		return "", fmt.Errorf("bild: failed to open image %s: %w", imagePath, err)
+		return "", nil, fmt.Errorf("bild: failed to open image %s: %w", imagePath, err)
+	}
+
+	// Cắt vùng được yêu cầu (OCR theo vùng, ví dụ ô của biểu mẫu/CCCD)
+	if opts.Crop != nil {
+		if srcImage, err = cropImage(srcImage, *opts.Crop); err != nil {
+			return "", nil, err
+		}
 	}
 
 	// 1. Chuyển sang ảnh xám
 	grayImage := effect.Grayscale(srcImage)
 
-	// Bỏ qua các bước khác
+	// 2. Xoay ảnh về đúng chiều (bội số của 90 độ) và chỉnh nghiêng (deskew)
+	var result image.Image = grayImage
+	correction := &Correction{}
+	rotation := ((opts.Rotate % 360) + 360) % 360
+	if rotation%90 != 0 {
+		return "", nil, fmt.Errorf("rotation must be a multiple of 90 degrees, got %d", opts.Rotate)
+	}
+	if rotation != 0 || opts.Deskew {
+		gray := grayChannel(grayImage)
+		if rotation != 0 {
+			gray = rotateRight(gray, rotation)
+			correction.Rotation = rotation
+			fmt.Printf("Rotated image %d degrees clockwise\n", rotation)
+		}
+		if opts.Deskew {
+			if skew := estimateSkew(gray); skew != 0 {
+				gray = rotate(gray, skew)
+				correction.Skew = skew
+				fmt.Printf("Corrected skew of %.1f degrees\n", skew)
+			}
+		}
+		result = gray
+	}
 
 	// Tạo đường dẫn cho file output
 	ext := filepath.Ext(imagePath)
@@ -34,12 +102,38 @@ func ApplyFilters(imagePath string) (string, error) {
 	// Đổi hậu tố
 	filteredImagePath := fmt.Sprintf("%s_gray%s", baseName, ext) // Chỉ gray
 
-	// Lưu ảnh đã xử lý (ảnh xám)
-	encoder := imgio.PNGEncoder()
-	if err := imgio.Save(filteredImagePath, grayImage, encoder); err != nil { // Lưu grayImage
-		return "", fmt.Errorf("bild: failed to save grayscale image %s: %w", filteredImagePath, err)
+	// Lưu ảnh đã xử lý (ảnh xám), kèm DPI để Tesseract không phải đoán độ phân giải
+	var buf bytes.Buffer
+	if err := imgio.PNGEncoder()(&buf, result); err != nil {
+		return "", nil, fmt.Errorf("bild: failed to encode grayscale image %s: %w", filteredImagePath, err)
+	}
+	if err := os.WriteFile(filteredImagePath, withPNGDPI(buf.Bytes(), opts.DPI), 0644); err != nil { // Lưu ảnh xám
+		return "", nil, fmt.Errorf("bild: failed to save grayscale image %s: %w", filteredImagePath, err)
 	}
 
 	fmt.Printf("Saved Grayscale image to: %s\n", filteredImagePath)
-	return filteredImagePath, nil
+	return filteredImagePath, correction, nil
+}
+
+// cropImage returns the region r of img
+func cropImage(img image.Image, r Rect) (image.Image, error) {
+	b := img.Bounds()
+	px := func(v float64, size int) int {
+		return int(math.Round(math.Max(0, math.Min(1, v)) * float64(size)))
+	}
+	rect := image.Rect(
+		b.Min.X+px(r.X, b.Dx()), b.Min.Y+px(r.Y, b.Dy()),
+		b.Min.X+px(r.X+r.Width, b.Dx()), b.Min.Y+px(r.Y+r.Height, b.Dy()),
+	)
+	if rect.Empty() {
+		return nil, fmt.Errorf("crop region %+v is empty for a %dx%d image", r, b.Dx(), b.Dy())
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect), nil
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+	return cropped, nil
 }
@@ -0,0 +1,319 @@
+package imagefilter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Frame policies for multi-frame inputs (animated GIFs)
+const (
+	FramesFirst = "first" // OCR the first frame only (default)
+	FramesBest  = "best"  // OCR the sharpest frame
+	FramesAll   = "all"   // OCR every distinct frame, one PDF page per frame
+)
+
+// MaxFrames caps the number of frames extracted with FramesAll
+const MaxFrames = 50
+
+// MaxAnimationPixels caps the canvas size times the frame count of an
+// animated GIF. A few KB of LZW data can declare thousands of full-canvas
+// frames, so larger animations are rejected before they are decoded.
+const MaxAnimationPixels = 1 << 27
+
+// ValidFramePolicy reports whether policy is supported ("" means FramesFirst)
+func ValidFramePolicy(policy string) bool {
+	switch policy {
+	case "", FramesFirst, FramesBest, FramesAll:
+		return true
+	}
+	return false
+}
+
+// FrameSet is the result of ExtractFrames
+type FrameSet struct {
+	Paths  []string // Images to process, in page order
+	Total  int      // Frames in the input (1 for still images)
+	Used   []int    // Index in the input of each extracted frame
+	Policy string   // Policy that was applied
+
+	written bool // Paths are frames written by ExtractFrames, not the input
+}
+
+// Remove deletes the frames written by ExtractFrames once the job is done.
+// The input image is never removed.
+func (s *FrameSet) Remove() {
+	if !s.written {
+		return
+	}
+	for _, path := range s.Paths {
+		os.Remove(path)
+	}
+}
+
+// ExtractFrames selects the frames of imagePath to process according to
+// policy. Still images (and single-frame GIFs) are returned unchanged.
+// Frames of an animated GIF are composited (GIF frames are often partial
+// updates of the previous ones), flattened on white and written as PNG next
+// to the input; the caller removes them with Remove. Compositing stops at the
+// last frame the policy can select.
+func ExtractFrames(imagePath, policy string) (_ *FrameSet, err error) {
+	if policy == "" {
+		policy = FramesFirst
+	}
+	if !ValidFramePolicy(policy) {
+		return nil, fmt.Errorf("unsupported frame policy %q", policy)
+	}
+	still := &FrameSet{Paths: []string{imagePath}, Total: 1, Used: []int{0}, Policy: policy}
+
+	anim, err := decodeGIF(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	if anim == nil || len(anim.Image) <= 1 {
+		return still, nil
+	}
+
+	base := strings.TrimSuffix(imagePath, filepath.Ext(imagePath))
+	set := &FrameSet{Total: len(anim.Image), Policy: policy, written: true}
+	defer func() {
+		if err != nil {
+			set.Remove() // Frames written before the error
+		}
+	}()
+	add := func(i int, frame *image.RGBA) error {
+		path := fmt.Sprintf("%s_frame%03d.png", base, i)
+		if err := writePNG(path, frame); err != nil {
+			return err
+		}
+		set.Paths = append(set.Paths, path)
+		set.Used = append(set.Used, i)
+		return nil
+	}
+
+	c := newCompositor(anim)
+	switch policy {
+	case FramesFirst:
+		if err := add(0, c.next()); err != nil {
+			return nil, err
+		}
+	case FramesBest:
+		var best *image.RGBA
+		bestIndex, bestScore := 0, -1.0
+		for i := range anim.Image {
+			frame := c.next()
+			if score := sharpness(frame); score > bestScore {
+				best, bestIndex, bestScore = frame, i, score
+			}
+		}
+		if err := add(bestIndex, best); err != nil {
+			return nil, err
+		}
+	case FramesAll:
+		// Animations repeat frames; keep only frames that differ from the previous one
+		var last [32]byte
+		for i := range anim.Image {
+			frame := c.next()
+			sum := sha256.Sum256(frame.Pix)
+			if i > 0 && sum == last {
+				continue
+			}
+			last = sum
+			if err := add(i, frame); err != nil {
+				return nil, err
+			}
+			if len(set.Used) == MaxFrames {
+				break
+			}
+		}
+	}
+	return set, nil
+}
+
+// decodeGIF decodes imagePath if it is a GIF, and returns nil otherwise.
+// Animations above MaxAnimationPixels are rejected from their headers.
+func decodeGIF(imagePath string) (*gif.GIF, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %s: %w", imagePath, err)
+	}
+	if !bytes.HasPrefix(data, []byte("GIF8")) {
+		return nil, nil
+	}
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GIF %s: %w", imagePath, err)
+	}
+	frames, err := countGIFFrames(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GIF %s: %w", imagePath, err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height) * int64(max(frames, 1)); pixels > MaxAnimationPixels {
+		return nil, fmt.Errorf("GIF %s is too large: %dx%d with %d frames exceeds %d pixels", imagePath, config.Width, config.Height, frames, MaxAnimationPixels)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GIF %s: %w", imagePath, err)
+	}
+	return anim, nil
+}
+
+// countGIFFrames counts the image descriptors of a GIF by walking its blocks,
+// without decompressing the frames
+func countGIFFrames(data []byte) (int, error) {
+	const header = 13 // Signature, version and logical screen descriptor
+	if len(data) < header {
+		return 0, fmt.Errorf("truncated GIF header")
+	}
+	pos := header
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1) // Global color table
+	}
+	// skipSubBlocks moves pos past a sequence of data sub-blocks
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return fmt.Errorf("truncated GIF data")
+			}
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return nil
+			}
+			pos += size
+		}
+	}
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension: label, then sub-blocks
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // Image descriptor, local color table, LZW code size, sub-blocks
+			if pos+10 > len(data) {
+				return 0, fmt.Errorf("truncated GIF image descriptor")
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++ // LZW minimum code size
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // Trailer
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("unknown GIF block 0x%02x", data[pos])
+		}
+	}
+	return frames, nil // gif.DecodeAll also accepts a missing trailer
+}
+
+// compositor renders the frames of an animation one at a time, as they are
+// displayed, honouring the frame disposal methods
+type compositor struct {
+	anim   *gif.GIF
+	bounds image.Rectangle
+	canvas *image.RGBA
+	i      int
+}
+
+func newCompositor(anim *gif.GIF) *compositor {
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range anim.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+	return &compositor{anim: anim, bounds: bounds, canvas: image.NewRGBA(bounds)}
+}
+
+// next returns the next frame flattened on a white background
+func (c *compositor) next() *image.RGBA {
+	frame := c.anim.Image[c.i]
+	disposal := byte(0)
+	if c.i < len(c.anim.Disposal) {
+		disposal = c.anim.Disposal[c.i]
+	}
+	c.i++
+
+	var previous *image.RGBA
+	if disposal == gif.DisposalPrevious {
+		previous = cloneRGBA(c.canvas)
+	}
+
+	draw.Draw(c.canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+	flat := image.NewRGBA(c.bounds)
+	draw.Draw(flat, c.bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, c.bounds, c.canvas, c.bounds.Min, draw.Over)
+
+	switch disposal {
+	case gif.DisposalBackground:
+		draw.Draw(c.canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+	case gif.DisposalPrevious:
+		c.canvas = previous
+	}
+	return flat
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	clone := image.NewRGBA(img.Bounds())
+	copy(clone.Pix, img.Pix)
+	return clone
+}
+
+// sharpness scores a frame by the variance of the Laplacian of its
+// luminance: blurred or blank frames score low, crisp text scores high
+func sharpness(img *image.RGBA) float64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < 3 || h < 3 {
+		return 0
+	}
+	lum := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			o := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			lum[y*w+x] = 0.299*float64(img.Pix[o]) + 0.587*float64(img.Pix[o+1]) + 0.114*float64(img.Pix[o+2])
+		}
+	}
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			l := lum[i-w] + lum[i+w] + lum[i-1] + lum[i+1] - 4*lum[i]
+			sum += l
+			sumSq += l * l
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create frame %s: %w", path, err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode frame %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,162 @@
+package imagefilter
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testPalette = color.Palette{color.White, color.Black}
+
+// blankFrame returns a white w×h frame
+func blankFrame(w, h int) *image.Paletted {
+	return image.NewPaletted(image.Rect(0, 0, w, h), testPalette)
+}
+
+// stripedFrame returns a frame with black stripes, which scores as sharp
+func stripedFrame(w, h int) *image.Paletted {
+	img := blankFrame(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x += 2 {
+			img.SetColorIndex(x, y, 1)
+		}
+	}
+	return img
+}
+
+func writeGIF(t *testing.T, anim *gif.GIF) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "anim.gif")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := gif.EncodeAll(f, anim); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractFrames(t *testing.T) {
+	// Frame 0 is blank, frame 1 has content, frame 2 repeats frame 1
+	anim := &gif.GIF{
+		Image: []*image.Paletted{blankFrame(16, 16), stripedFrame(16, 16), stripedFrame(16, 16)},
+		Delay: []int{10, 10, 10},
+	}
+	path := writeGIF(t, anim)
+
+	tests := []struct {
+		policy string
+		used   []int
+	}{
+		{"", []int{0}},
+		{FramesFirst, []int{0}},
+		{FramesBest, []int{1}},
+		{FramesAll, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		set, err := ExtractFrames(path, tt.policy)
+		if err != nil {
+			t.Fatalf("policy %q: %v", tt.policy, err)
+		}
+		if set.Total != 3 || !reflect.DeepEqual(set.Used, tt.used) || len(set.Paths) != len(tt.used) {
+			t.Errorf("policy %q: total %d, used %v, paths %v; want 3, %v", tt.policy, set.Total, set.Used, set.Paths, tt.used)
+			continue
+		}
+		for _, p := range set.Paths {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("policy %q: frame not written: %v", tt.policy, err)
+			}
+		}
+		set.Remove()
+		for _, p := range set.Paths {
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
+				t.Errorf("policy %q: frame %s left after Remove", tt.policy, filepath.Base(p))
+			}
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("input removed with the frames: %v", err)
+	}
+
+	if _, err := ExtractFrames(path, "middle"); err == nil {
+		t.Error("ExtractFrames accepted an unknown policy")
+	}
+}
+
+func TestExtractFramesStill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, stripedFrame(8, 8))
+	f.Close()
+
+	set, err := ExtractFrames(path, FramesAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Total != 1 || !reflect.DeepEqual(set.Paths, []string{path}) {
+		t.Fatalf("still image: %+v", set)
+	}
+	set.Remove()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("still image removed: %v", err)
+	}
+}
+
+func TestExtractFramesMaxFrames(t *testing.T) {
+	anim := &gif.GIF{}
+	for i := 0; i < MaxFrames+10; i++ {
+		frame := blankFrame(8, 8)
+		frame.SetColorIndex(i%8, i/8%8, 1) // Every frame differs from the previous one
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 0)
+	}
+	set, err := ExtractFrames(writeGIF(t, anim), FramesAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Total != MaxFrames+10 || len(set.Used) != MaxFrames {
+		t.Fatalf("total %d, extracted %d; want %d, %d", set.Total, len(set.Used), MaxFrames+10, MaxFrames)
+	}
+}
+
+func TestExtractFramesTooLarge(t *testing.T) {
+	// Tiny frames on a huge canvas: small file, but every composited frame
+	// would be a full-canvas RGBA image
+	anim := &gif.GIF{Config: image.Config{Width: 8192, Height: 8192, ColorModel: testPalette}}
+	for i := 0; i < 3; i++ {
+		anim.Image = append(anim.Image, blankFrame(1, 1))
+		anim.Delay = append(anim.Delay, 0)
+	}
+	_, err := ExtractFrames(writeGIF(t, anim), FramesFirst)
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("err = %v, want a size error", err)
+	}
+}
+
+func TestCountGIFFrames(t *testing.T) {
+	anim := &gif.GIF{
+		Image: []*image.Paletted{blankFrame(4, 4), stripedFrame(4, 4)},
+		Delay: []int{0, 0},
+	}
+	data, err := os.ReadFile(writeGIF(t, anim))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := countGIFFrames(data); err != nil || n != 2 {
+		t.Fatalf("countGIFFrames = %d, %v; want 2", n, err)
+	}
+	if _, err := countGIFFrames(data[:len(data)/2]); err == nil {
+		t.Fatal("countGIFFrames accepted a truncated GIF")
+	}
+}
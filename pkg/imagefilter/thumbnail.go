@@ -0,0 +1,102 @@
+package imagefilter
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/anthonynsimon/bild/imgio"
+)
+
+// ThumbnailConfig bounds the size of the thumbnails of uploaded images
+type ThumbnailConfig struct {
+	MaxWidth  int
+	MaxHeight int
+	Quality   int // JPEG quality, 1-100
+}
+
+// DefaultThumbnailConfig fits thumbnails in 320x320 pixels
+func DefaultThumbnailConfig() ThumbnailConfig {
+	return ThumbnailConfig{MaxWidth: 320, MaxHeight: 320, Quality: 80}
+}
+
+// ThumbnailConfigFromEnv reads THUMBNAIL_MAX_WIDTH, THUMBNAIL_MAX_HEIGHT and
+// THUMBNAIL_QUALITY
+func ThumbnailConfigFromEnv() (ThumbnailConfig, error) {
+	config := DefaultThumbnailConfig()
+	for _, v := range []struct {
+		name     string
+		value    *int
+		min, max int
+	}{
+		{"THUMBNAIL_MAX_WIDTH", &config.MaxWidth, 16, 4096},
+		{"THUMBNAIL_MAX_HEIGHT", &config.MaxHeight, 16, 4096},
+		{"THUMBNAIL_QUALITY", &config.Quality, 1, 100},
+	} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < v.min || n > v.max {
+			return config, fmt.Errorf("%s must be between %d and %d, got %q", v.name, v.min, v.max, raw)
+		}
+		*v.value = n
+	}
+	return config, nil
+}
+
+// WriteThumbnail writes a JPEG of the image (the first frame of animated
+// images) scaled down to fit the configured size, keeping its aspect ratio.
+// Smaller images are not enlarged. Photos are turned upright according to
+// their EXIF orientation.
+func (c ThumbnailConfig) WriteThumbnail(w io.Writer, imagePath string) error {
+	src, err := imgio.Open(imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to open image %s: %w", imagePath, err)
+	}
+	src = Orient(src, Orientation(imagePath))
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width > c.MaxWidth {
+		width, height = c.MaxWidth, max(1, height*c.MaxWidth/width)
+	}
+	if height > c.MaxHeight {
+		width, height = max(1, width*c.MaxHeight/height), c.MaxHeight
+	}
+	return jpeg.Encode(w, downscale(src, width, height), &jpeg.Options{Quality: c.Quality})
+}
+
+// downscale averages the pixels of src covered by each pixel of the result
+// (box filter), which keeps the text of scans readable without aliasing
+func downscale(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/width)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			// JPEG has no alpha: transparent areas are composited on white
+			white := 0xffff - a/n
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8((r/n + white) >> 8)
+			dst.Pix[i+1] = uint8((g/n + white) >> 8)
+			dst.Pix[i+2] = uint8((bl/n + white) >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
@@ -0,0 +1,140 @@
+// Package awssig signs AWS API requests with Signature Version 4. The S3
+// storage and the SQS/SNS broker call the AWS APIs over plain HTTP instead of
+// through the AWS SDK, and share this signer.
+package awssig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UnsignedPayload replaces the payload hash of presigned URLs
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Signer signs the requests of one service in one region
+type Signer struct {
+	AccessKey string
+	SecretKey string
+	// SessionToken accompanies temporary credentials (Lambda, ECS task
+	// roles); Sign sends it as X-Amz-Security-Token
+	SessionToken string
+	Region       string
+	Service      string // "s3", "sqs", "sns"...
+}
+
+// Scope returns the credential scope of a signature made at t
+func (s Signer) Scope(t time.Time) string {
+	return t.UTC().Format("20060102") + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+// Signature returns the signature of canonicalRequest made at t
+func (s Signer) Signature(t time.Time, canonicalRequest string) string {
+	t = t.UTC()
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		s.Scope(t),
+		PayloadHash([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// Sign adds header authentication to req made at t: X-Amz-Date, the session
+// token and Authorization. The host, Content-Type and X-Amz-* headers are
+// signed, so they must be set before. payloadHash is the PayloadHash of the
+// body.
+func (s Signer) Sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	values := map[string]string{"host": req.URL.Host}
+	for name, v := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			for i := range v {
+				v[i] = strings.TrimSpace(v[i])
+			}
+			values[name] = strings.Join(v, ",")
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, s.Scope(t), signedHeaders, s.Signature(t, canonicalRequest)))
+}
+
+// PayloadHash returns the hex SHA-256 of a request body
+func PayloadHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Escape percent-encodes everything except the unreserved characters, as
+// required by SigV4 (url.QueryEscape would turn spaces into '+')
+func Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// CanonicalQuery returns the query sorted by name and escaped with Escape
+func CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, Escape(k)+"="+Escape(query.Get(k)))
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
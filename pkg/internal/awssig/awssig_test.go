@@ -0,0 +1,68 @@
+package awssig
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Credentials and requests of the AWS Signature Version 4 test suite
+var testSigner = Signer{
+	AccessKey: "AKIDEXAMPLE",
+	SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	Region:    "us-east-1",
+	Service:   "service",
+}
+
+var testTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name, method, url string
+		want              string
+	}{
+		{"get-vanilla", "GET", "https://example.amazonaws.com/",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "GET", "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testSigner.Sign(req, PayloadHash(nil), testTime)
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization = %s\nwant %s", got, tt.want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s", got)
+			}
+		})
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	signer := testSigner
+	signer.SessionToken = "token"
+	req, _ := http.NewRequest("POST", "https://sqs.us-east-1.amazonaws.com/", nil)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+	req.Header.Set("Accept", "*/*")
+	signer.Sign(req, PayloadHash([]byte("{}")), testTime)
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "token" {
+		t.Errorf("X-Amz-Security-Token = %q", got)
+	}
+	const want = "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target,"
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, want) {
+		t.Errorf("Authorization = %s, want %s", got, want)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got := Escape("a b/c~d+é"); got != "a%20b%2Fc~d%2B%C3%A9" {
+		t.Errorf("Escape = %s", got)
+	}
+}
@@ -0,0 +1,68 @@
+// Package flight deduplicates concurrent identical work within a process:
+// while a call for a key runs, calls with the same key wait for it and share
+// its result instead of doing the work again. Results are not kept once the
+// call returns, persistent reuse is the job of the result cache.
+package flight
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Group runs the calls of one kind of work; the zero value is ready to use
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done    chan struct{}
+	value   any
+	err     error
+	waiters int // Callers sharing the result
+}
+
+// PanicError is returned to the waiting callers when the function of the
+// call they share panics
+type PanicError struct {
+	Value any // Value passed to panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("shared call panicked: %v", e.Value)
+}
+
+// Do runs fn once for concurrent calls with the same key and returns its
+// result to all of them; shared reports whether the result came from
+// another call. Shared values must be treated as read-only.
+//
+// If fn panics, the waiting callers get a *PanicError and the panic goes on
+// in the caller that ran fn.
+func (g *Group) Do(key string, fn func() (any, error)) (value any, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		g.mu.Unlock()
+		<-c.done
+		return c.value, true, c.err
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.value, c.err = nil, &PanicError{Value: r}
+			defer panic(r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	return c.value, false, c.err
+}
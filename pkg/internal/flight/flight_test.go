@@ -0,0 +1,119 @@
+package flight
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor waits until n callers wait for the running call of key
+func waitFor(g *Group, key string, n int) {
+	for {
+		g.mu.Lock()
+		c := g.calls[key]
+		ready := c != nil && c.waiters == n
+		g.mu.Unlock()
+		if ready {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDoShared(t *testing.T) {
+	var g Group
+	var runs atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	const callers = 5
+	var wg sync.WaitGroup
+	values := make([]any, callers)
+	shared := make([]bool, callers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		values[0], shared[0], _ = g.Do("key", func() (any, error) {
+			runs.Add(1)
+			close(started)
+			<-release
+			return "text", nil
+		})
+	}()
+	<-started
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], shared[i], _ = g.Do("key", func() (any, error) {
+				runs.Add(1)
+				return "other", nil
+			})
+		}(i)
+	}
+	waitFor(&g, "key", callers-1)
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Fatalf("fn ran %d times, want 1", runs.Load())
+	}
+	for i := range values {
+		if values[i] != "text" || shared[i] != (i > 0) {
+			t.Errorf("caller %d: %v, shared %v", i, values[i], shared[i])
+		}
+	}
+
+	// The call is forgotten once it returns
+	if value, shared, _ := g.Do("key", func() (any, error) { return "again", nil }); value != "again" || shared {
+		t.Fatalf("after the call: %v, shared %v", value, shared)
+	}
+}
+
+func TestDoError(t *testing.T) {
+	var g Group
+	errOCR := errors.New("tesseract failed")
+	if _, _, err := g.Do("key", func() (any, error) { return nil, errOCR }); err != errOCR {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	recovered := make(chan any)
+	go func() {
+		defer func() { recovered <- recover() }()
+		g.Do("key", func() (any, error) {
+			close(started)
+			<-release
+			panic("corrupt image")
+		})
+	}()
+	<-started
+
+	waiter := make(chan error)
+	go func() {
+		value, shared, err := g.Do("key", func() (any, error) { return "not run", nil })
+		if value != nil || !shared {
+			t.Errorf("waiter got %v, shared %v", value, shared)
+		}
+		waiter <- err
+	}()
+	waitFor(&g, "key", 1)
+	close(release)
+
+	if r := <-recovered; r != "corrupt image" {
+		t.Fatalf("caller running fn recovered %v, want the panic", r)
+	}
+	var panicErr *PanicError
+	if err := <-waiter; !errors.As(err, &panicErr) || panicErr.Value != "corrupt image" {
+		t.Fatalf("waiter err = %v, want a PanicError", err)
+	}
+	if value, _, err := g.Do("key", func() (any, error) { return "ok", nil }); value != "ok" || err != nil {
+		t.Fatalf("after the panic: %v, %v", value, err)
+	}
+}
@@ -0,0 +1,40 @@
+// Package periodic runs the background loops of the pkg services: the polls
+// of the connectors and the scans of the maintenance tasks.
+package periodic
+
+import (
+	"context"
+	"time"
+)
+
+// Run calls scan now, then every interval until ctx is done. Each result is
+// passed to report (nil: ignored) with its error, unless ctx ended during
+// the call.
+func Run[R any](ctx context.Context, interval time.Duration, scan func(context.Context) (R, error), report func(R, error)) {
+	run(ctx, interval, true, scan, report)
+}
+
+// RunDelayed is Run with the first call after one interval, for the scans
+// that replicas starting together should not all run at once
+func RunDelayed[R any](ctx context.Context, interval time.Duration, scan func(context.Context) (R, error), report func(R, error)) {
+	run(ctx, interval, false, scan, report)
+}
+
+func run[R any](ctx context.Context, interval time.Duration, now bool, scan func(context.Context) (R, error), report func(R, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if now {
+			result, err := scan(ctx)
+			if report != nil && ctx.Err() == nil {
+				report(result, err)
+			}
+		}
+		now = true
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
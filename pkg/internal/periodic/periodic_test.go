@@ -0,0 +1,60 @@
+package periodic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	for _, tt := range []struct {
+		name    string
+		run     func(context.Context, time.Duration, func(context.Context) (int, error), func(int, error))
+		delayed bool // First call after one interval
+	}{
+		{"Run", Run[int], false},
+		{"RunDelayed", RunDelayed[int], true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			start := time.Now()
+			var first time.Duration
+			calls := 0
+			var reported []int
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				tt.run(ctx, interval, func(context.Context) (int, error) {
+					calls++
+					if calls == 1 {
+						first = time.Since(start)
+					}
+					if calls == 3 {
+						cancel()
+					}
+					return calls, errors.New("scan failed")
+				}, func(n int, err error) {
+					if err == nil {
+						t.Error("error not reported")
+					}
+					reported = append(reported, n)
+				})
+			}()
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("Run did not return once ctx was done")
+			}
+			if (first >= interval) != tt.delayed {
+				t.Errorf("first call after %v, interval %v", first, interval)
+			}
+			// The call during which ctx ended is not reported
+			if calls != 3 || len(reported) != 2 {
+				t.Errorf("%d calls, reported %v", calls, reported)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package janitor enforces the retention of finished jobs (see
+// model.Retention): it deletes the artifacts of a job from the storage and
+// its uploaded file once their retention is over. The Redis keys of the job
+// expire by themselves with the TTL the store sets when the job finishes.
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/periodic"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// Config of the janitor
+type Config struct {
+	Interval time.Duration // Between two scans
+}
+
+// DefaultConfig scans every 10 minutes
+func DefaultConfig() Config {
+	return Config{Interval: 10 * time.Minute}
+}
+
+// ConfigFromEnv reads JANITOR_INTERVAL
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	if raw := os.Getenv("JANITOR_INTERVAL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("JANITOR_INTERVAL must be a positive duration such as 10m, got %q", raw)
+		}
+		config.Interval = d
+	}
+	return config, nil
+}
+
+// Result lists the jobs handled by one scan
+type Result struct {
+	ArtifactsDeleted []string `json:"artifacts_deleted"`
+	UploadsDeleted   []string `json:"uploads_deleted"`
+}
+
+// Janitor scans model.RetentionIndexKey for jobs with data to delete
+type Janitor struct {
+	client    *redis.Client
+	artifacts storage.Storage
+	config    Config
+}
+
+// New creates a janitor deleting artifacts from artifacts and uploads from
+// the local disk
+func New(client *redis.Client, artifacts storage.Storage, config Config) *Janitor {
+	return &Janitor{client: client, artifacts: artifacts, config: config}
+}
+
+// Run scans every Interval until ctx is done. Each scan is passed to report
+// (nil: ignored) with its error.
+func (j *Janitor) Run(ctx context.Context, report func(Result, error)) {
+	periodic.RunDelayed(ctx, j.config.Interval, j.Scan, report)
+}
+
+// Scan deletes the artifacts and uploads whose retention is over: the jobs of
+// model.RetentionIndexKey scored before now. Replicas scanning at the same
+// time race on the ZREM of a job and only the winner cleans it up. A job
+// that fails is put back with its score and retried on the next scan, which
+// deletes again what the failed attempt already removed (a no-op).
+func (j *Janitor) Scan(ctx context.Context) (Result, error) {
+	var result Result
+	due, err := j.client.ZRangeByScoreWithScores(ctx, model.RetentionIndexKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return result, err
+	}
+	for _, z := range due {
+		jobID, _ := z.Member.(string)
+		claimed, err := j.client.ZRem(ctx, model.RetentionIndexKey, jobID).Result()
+		if err != nil {
+			return result, err
+		}
+		if claimed == 0 {
+			continue // Handled by another replica
+		}
+		if err := j.cleanJob(ctx, jobID, &result); err != nil {
+			// Put the job back to retry on the next scan
+			j.client.ZAdd(ctx, model.RetentionIndexKey, &redis.Z{Score: z.Score, Member: jobID})
+			return result, fmt.Errorf("failed to clean up job %s: %w", jobID, err)
+		}
+	}
+	return result, nil
+}
+
+func (j *Janitor) cleanJob(ctx context.Context, jobID string, result *Result) error {
+	record, err := model.LoadRetention(ctx, j.client, jobID)
+	if err != nil || record == nil {
+		return err // Record expired: nothing left to delete
+	}
+	now := time.Now()
+	if after := record.Policy.Artifacts; after > 0 && !record.ArtifactsDeleted && !now.Before(record.FinishedAt.Add(after)) {
+		keys := []string{model.PDFKey(jobID), model.ThumbnailKey(jobID)}
+		for _, file := range messaging.OutputFiles {
+			keys = append(keys, model.OutputKey(jobID, file))
+		}
+		for _, file := range model.ArtifactFiles {
+			keys = append(keys, model.ArtifactKey(jobID, file))
+		}
+		for _, key := range keys {
+			if err := j.artifacts.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		record.ArtifactsDeleted = true
+		result.ArtifactsDeleted = append(result.ArtifactsDeleted, jobID)
+	}
+	if after := record.Policy.Uploads; after > 0 && !record.UploadDeleted && record.UploadPath != "" && !now.Before(record.FinishedAt.Add(after)) {
+		if err := os.Remove(record.UploadPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		record.UploadDeleted = true
+		result.UploadsDeleted = append(result.UploadsDeleted, jobID)
+	}
+	if err := model.SaveRetention(ctx, j.client, jobID, *record, -1); err != nil {
+		return err
+	}
+	if next := record.NextDeletion(); !next.IsZero() {
+		return j.client.ZAdd(ctx, model.RetentionIndexKey, &redis.Z{Score: float64(next.Unix()), Member: jobID}).Err()
+	}
+	return nil
+}
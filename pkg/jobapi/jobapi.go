@@ -0,0 +1,30 @@
+// Package jobapi is what the connectors (mailin, filedrop) need of the HTTP
+// API to submit documents on behalf of a tenant: create a job, follow its
+// status and download its PDF. The implementation over HTTP lives in
+// cmd/imgproc; tests use fakes.
+package jobapi
+
+import (
+	"context"
+	"errors"
+)
+
+// Statuses of a job as reported by the API that end it
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// ErrRejected wraps the errors of the API that retrying would not fix
+// (invalid or too large file, job not found...); connectors retry the other
+// errors on their next poll
+var ErrRejected = errors.New("rejected")
+
+// API submits jobs and reads their results: the HTTP API of the deployment,
+// called with the API key of the tenant owning the connector
+type API interface {
+	Submit(ctx context.Context, filename string, data []byte, fields map[string]string) (jobID string, err error)
+	// Status returns the status of the job and its error once failed
+	Status(ctx context.Context, jobID string) (status, errorMessage string, err error)
+	PDF(ctx context.Context, jobID string) ([]byte, error)
+}
@@ -0,0 +1,161 @@
+package lineage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Relations between a job and its parent
+const (
+	RelationRetry        = "retry"        // Resubmission of a failed job
+	RelationRegeneration = "regeneration" // New artifact for the same input (e.g. other options)
+	RelationDependent    = "dependent"    // Job that consumes the output of its parent
+	RelationMerge        = "merge"        // Parent is a member merged into this job
+	RelationCache        = "cache"        // Result reused from the parent through the image cache
+)
+
+// ValidRelation reports whether relation can be set by a client
+func ValidRelation(relation string) bool {
+	switch relation {
+	case RelationRetry, RelationRegeneration, RelationDependent, RelationMerge:
+		return true
+	}
+	return false
+}
+
+// Edge links a parent job to a child job
+type Edge struct {
+	Parent   string `json:"parent"`
+	Child    string `json:"child"`
+	Relation string `json:"relation"`
+}
+
+// Graph is the ancestry and descendants of a job
+type Graph struct {
+	JobID     string   `json:"job_id"`
+	Ancestors []string `json:"ancestors"`
+	Children  []string `json:"descendants"`
+	Edges     []Edge   `json:"edges"`
+	Truncated bool     `json:"truncated"` // MaxDepth or MaxNodes was reached
+}
+
+// Limits of a lineage traversal
+const (
+	MaxDepth = 10
+	MaxNodes = 200
+)
+
+func parentsKey(jobID string) string  { return fmt.Sprintf("%s:lineage:parents", jobID) }
+func childrenKey(jobID string) string { return fmt.Sprintf("%s:lineage:children", jobID) }
+
+// Record stores that child was derived from parent. Both sides are stored
+// as Redis hashes (job ID -> relation) so the graph can be walked both ways.
+func Record(ctx context.Context, client *redis.Client, parent, child, relation string, ttl time.Duration) error {
+	if parent == "" || parent == child {
+		return nil
+	}
+	pipe := client.TxPipeline()
+	pipe.HSet(ctx, parentsKey(child), parent, relation)
+	pipe.Expire(ctx, parentsKey(child), ttl)
+	pipe.HSet(ctx, childrenKey(parent), child, relation)
+	pipe.Expire(ctx, childrenKey(parent), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Forget removes jobID from the lineage of its parents and children, before
+// its own keys are erased
+func Forget(ctx context.Context, client *redis.Client, jobID string) error {
+	pipe := client.Pipeline()
+	parents := pipe.HKeys(ctx, parentsKey(jobID))
+	children := pipe.HKeys(ctx, childrenKey(jobID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+	pipe = client.TxPipeline()
+	for _, parent := range parents.Val() {
+		pipe.HDel(ctx, childrenKey(parent), jobID)
+	}
+	for _, child := range children.Val() {
+		pipe.HDel(ctx, parentsKey(child), jobID)
+	}
+	pipe.Del(ctx, parentsKey(jobID), childrenKey(jobID))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Load walks the lineage of jobID in both directions (breadth first, up to
+// MaxDepth levels and MaxNodes jobs)
+func Load(ctx context.Context, client *redis.Client, jobID string) (*Graph, error) {
+	graph := &Graph{JobID: jobID, Ancestors: []string{}, Children: []string{}, Edges: []Edge{}}
+	seenEdges := map[Edge]bool{}
+	nodes := map[string]bool{jobID: true}
+
+	walk := func(up bool) error {
+		frontier := []string{jobID}
+		for depth := 0; len(frontier) > 0; depth++ {
+			if depth == MaxDepth {
+				graph.Truncated = true
+				return nil
+			}
+			var next []string
+			for _, id := range frontier {
+				key := childrenKey(id)
+				if up {
+					key = parentsKey(id)
+				}
+				related, err := client.HGetAll(ctx, key).Result()
+				if err != nil && err != redis.Nil {
+					return err
+				}
+				for _, other := range sortedKeys(related) {
+					edge := Edge{Parent: id, Child: other, Relation: related[other]}
+					if up {
+						edge = Edge{Parent: other, Child: id, Relation: related[other]}
+					}
+					if !seenEdges[edge] {
+						seenEdges[edge] = true
+						graph.Edges = append(graph.Edges, edge)
+					}
+					if nodes[other] {
+						continue
+					}
+					if len(nodes) >= MaxNodes {
+						graph.Truncated = true
+						return nil
+					}
+					nodes[other] = true
+					if up {
+						graph.Ancestors = append(graph.Ancestors, other)
+					} else {
+						graph.Children = append(graph.Children, other)
+					}
+					next = append(next, other)
+				}
+			}
+			frontier = next
+		}
+		return nil
+	}
+
+	if err := walk(true); err != nil {
+		return nil, err
+	}
+	if err := walk(false); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,122 @@
+package mailin
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config of the mailbox poller
+type Config struct {
+	IMAPAddr string // host:port of the IMAP server
+	IMAPTLS  bool   // Implicit TLS (port 993), default true
+	Username string
+	Password string
+	Mailbox  string        // Default INBOX
+	Interval time.Duration // Between two polls, default 1m
+	Timeout  time.Duration // Of each IMAP/SMTP exchange, default 30s
+
+	SMTPAddr     string // host:port of the SMTP server sending the replies (STARTTLS when offered)
+	SMTPUsername string // Default Username
+	SMTPPassword string // Default Password
+	From         string // Sender of the replies, default Username
+
+	// AllowedSenders are the addresses ("user@example.com") or domains
+	// ("@example.com") whose messages are processed; empty allows nobody, as
+	// anyone could otherwise spend the quota of the tenant and get PDFs mailed
+	// back. Other messages are marked as read without a reply.
+	AllowedSenders []string
+	TargetLang     string        // target_lang of the jobs, empty: the API default
+	ReplyTimeout   time.Duration // Reply without the jobs still running after this long, default 1h
+}
+
+// ConfigFromEnv reads the MAILIN_* variables; MAILIN_IMAP_ADDR,
+// MAILIN_USERNAME, MAILIN_SMTP_ADDR and MAILIN_ALLOWED_SENDERS are required
+func ConfigFromEnv() (Config, error) {
+	c := Config{
+		IMAPAddr:     os.Getenv("MAILIN_IMAP_ADDR"),
+		IMAPTLS:      true,
+		Username:     os.Getenv("MAILIN_USERNAME"),
+		Password:     os.Getenv("MAILIN_PASSWORD"),
+		Mailbox:      os.Getenv("MAILIN_MAILBOX"),
+		Interval:     time.Minute,
+		Timeout:      30 * time.Second,
+		SMTPAddr:     os.Getenv("MAILIN_SMTP_ADDR"),
+		SMTPUsername: os.Getenv("MAILIN_SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("MAILIN_SMTP_PASSWORD"),
+		From:         os.Getenv("MAILIN_FROM"),
+		TargetLang:   os.Getenv("MAILIN_TARGET_LANG"),
+		ReplyTimeout: time.Hour,
+	}
+	if c.IMAPAddr == "" || c.Username == "" || c.SMTPAddr == "" {
+		return c, fmt.Errorf("MAILIN_IMAP_ADDR, MAILIN_USERNAME and MAILIN_SMTP_ADDR are required")
+	}
+	if raw := os.Getenv("MAILIN_IMAP_TLS"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return c, fmt.Errorf("MAILIN_IMAP_TLS must be true or false, got %q", raw)
+		}
+		c.IMAPTLS = v
+	}
+	for _, d := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"MAILIN_INTERVAL", &c.Interval},
+		{"MAILIN_TIMEOUT", &c.Timeout},
+		{"MAILIN_REPLY_TIMEOUT", &c.ReplyTimeout},
+	} {
+		if raw := os.Getenv(d.name); raw != "" {
+			v, err := time.ParseDuration(raw)
+			if err != nil || v <= 0 {
+				return c, fmt.Errorf("%s must be a positive duration such as 1m, got %q", d.name, raw)
+			}
+			*d.value = v
+		}
+	}
+	for _, sender := range strings.Split(os.Getenv("MAILIN_ALLOWED_SENDERS"), ",") {
+		if sender = strings.ToLower(strings.TrimSpace(sender)); sender != "" {
+			c.AllowedSenders = append(c.AllowedSenders, sender)
+		}
+	}
+	if len(c.AllowedSenders) == 0 {
+		return c, fmt.Errorf("MAILIN_ALLOWED_SENDERS is required (addresses or @domains, comma separated)")
+	}
+	return c.withDefaults(), nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.Mailbox == "" {
+		c.Mailbox = "INBOX"
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.ReplyTimeout <= 0 {
+		c.ReplyTimeout = time.Hour
+	}
+	if c.SMTPUsername == "" {
+		c.SMTPUsername, c.SMTPPassword = c.Username, c.Password
+	}
+	if c.From == "" {
+		c.From = c.Username
+	}
+	return c
+}
+
+// allowed reports whether messages from address are processed
+func (c Config) allowed(address string) bool {
+	address = strings.ToLower(address)
+	_, domain, _ := strings.Cut(address, "@")
+	for _, sender := range c.AllowedSenders {
+		if sender == address || sender == "@"+domain {
+			return true
+		}
+	}
+	return false
+}
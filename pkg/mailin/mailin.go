@@ -0,0 +1,226 @@
+// Package mailin lets users email documents to the service: a poller reads
+// the unread messages of an IMAP mailbox, submits their image and PDF
+// attachments as jobs tagged with the sender (source "email:<address>"),
+// and replies to the sender with the translated PDFs once the jobs are
+// done. Messages waiting for their jobs are kept in Redis, so a restarted
+// poller still replies.
+package mailin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/periodic"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/jobapi"
+)
+
+// PendingKey is a hash of message key -> JSON of the messages whose jobs
+// are not all finished yet
+const PendingKey = "mailin:pending"
+
+// Result lists what one poll did
+type Result struct {
+	Received []string `json:"received"` // Message keys of the messages submitted
+	Ignored  []string `json:"ignored"`  // Senders not allowed, or unparsable messages
+	Replied  []string `json:"replied"`
+}
+
+// pendingMail is a message waiting for its jobs, stored in PendingKey
+type pendingMail struct {
+	Message    Message      `json:"message"` // Without the attachment data
+	ReceivedAt time.Time    `json:"received_at"`
+	Jobs       []pendingJob `json:"jobs"`
+}
+
+type pendingJob struct {
+	Filename string `json:"filename"`
+	JobID    string `json:"job_id,omitempty"`
+	Error    string `json:"error,omitempty"` // Not submitted
+}
+
+// Poller polls one mailbox; run a single poller per mailbox
+type Poller struct {
+	config Config
+	client *redis.Client
+	api    jobapi.API
+	send   sendFunc
+}
+
+// New creates a poller submitting to api, with the API key of the tenant
+// owning the mailbox, and keeping its state in client
+func New(config Config, client *redis.Client, api jobapi.API) *Poller {
+	return &Poller{config: config.withDefaults(), client: client, api: api, send: smtp.SendMail}
+}
+
+// Run polls every Interval until ctx is done. Each poll is passed to report
+// (nil: ignored) with its error.
+func (p *Poller) Run(ctx context.Context, report func(Result, error)) {
+	periodic.Run(ctx, p.config.Interval, p.Poll, report)
+}
+
+// Poll submits the attachments of the unread messages, then replies to the
+// messages whose jobs are all finished (or ran longer than ReplyTimeout)
+func (p *Poller) Poll(ctx context.Context) (Result, error) {
+	var result Result
+	if err := p.receive(ctx, &result); err != nil {
+		return result, err
+	}
+	return result, p.reply(ctx, &result)
+}
+
+func (p *Poller) receive(ctx context.Context, result *Result) error {
+	c, err := dialIMAP(ctx, p.config.IMAPAddr, p.config.IMAPTLS, p.config.Timeout)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	if err := c.login(p.config.Username, p.config.Password); err != nil {
+		return err
+	}
+	if err := c.selectMailbox(p.config.Mailbox); err != nil {
+		return err
+	}
+	uids, err := c.unseen()
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		raw, err := c.fetch(uid)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("uid:%d", uid)
+		msg, err := parseMessage(raw)
+		switch {
+		case err != nil:
+			result.Ignored = append(result.Ignored, key)
+		case !p.config.allowed(msg.From):
+			result.Ignored = append(result.Ignored, msg.From)
+		default:
+			if msg.MessageID != "" {
+				key = msg.MessageID
+			}
+			if err := p.submit(ctx, key, msg); err != nil {
+				return err // Still unread: retried on the next poll
+			}
+			result.Received = append(result.Received, key)
+		}
+		if err := c.markSeen(uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submit creates a job per attachment and stores the message in PendingKey.
+// A message without attachment gets its reply right away.
+func (p *Poller) submit(ctx context.Context, key string, msg *Message) error {
+	if len(msg.Attachments) == 0 {
+		return p.sendReply(msg, "No image or PDF was found in your message. Attach the documents to translate and send it again.\r\n", nil)
+	}
+	pending := pendingMail{ReceivedAt: time.Now().UTC()}
+	fields := map[string]string{"source": "email:" + msg.From}
+	if p.config.TargetLang != "" {
+		fields["target_lang"] = p.config.TargetLang
+	}
+	for i, attachment := range msg.Attachments {
+		job := pendingJob{Filename: attachment.Filename}
+		jobID, err := p.api.Submit(ctx, attachment.Filename, attachment.Data, fields)
+		switch {
+		case err == nil:
+			job.JobID = jobID
+		case errors.Is(err, jobapi.ErrRejected) || i > 0:
+			// Jobs of the previous attachments exist: reply with this error
+			// rather than submitting them again on the next poll
+			job.Error = err.Error()
+		default:
+			return err
+		}
+		pending.Jobs = append(pending.Jobs, job)
+	}
+	pending.Message = *msg
+	pending.Message.Attachments = nil
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	return p.client.HSet(ctx, PendingKey, key, data).Err()
+}
+
+// reply sends the PDFs of the pending messages whose jobs are finished
+func (p *Poller) reply(ctx context.Context, result *Result) error {
+	pending, err := p.client.HGetAll(ctx, PendingKey).Result()
+	if err != nil {
+		return err
+	}
+	for key, data := range pending {
+		var mail pendingMail
+		if err := json.Unmarshal([]byte(data), &mail); err != nil {
+			p.client.HDel(ctx, PendingKey, key)
+			continue
+		}
+		sent, err := p.replyTo(ctx, &mail)
+		if err != nil {
+			return fmt.Errorf("reply to %s: %w", key, err)
+		}
+		if !sent {
+			continue
+		}
+		if err := p.client.HDel(ctx, PendingKey, key).Err(); err != nil {
+			return err
+		}
+		result.Replied = append(result.Replied, key)
+	}
+	return nil
+}
+
+// replyTo sends the reply of mail once its jobs are finished, false while
+// some are still running
+func (p *Poller) replyTo(ctx context.Context, mail *pendingMail) (bool, error) {
+	timedOut := time.Since(mail.ReceivedAt) > p.config.ReplyTimeout
+	var body strings.Builder
+	var files []Attachment
+	body.WriteString("Results of the documents in your message:\r\n\r\n")
+	for _, job := range mail.Jobs {
+		outcome := job.Error
+		if job.JobID != "" {
+			status, errorMessage, err := p.api.Status(ctx, job.JobID)
+			switch {
+			case errors.Is(err, jobapi.ErrRejected):
+				// Job deleted or expired
+				status, errorMessage = jobapi.StatusFailed, err.Error()
+			case err != nil:
+				return false, err
+			}
+			switch status {
+			case jobapi.StatusCompleted:
+				pdf, err := p.api.PDF(ctx, job.JobID)
+				if err != nil {
+					return false, err
+				}
+				name := strings.TrimSuffix(job.Filename, path.Ext(job.Filename)) + ".pdf"
+				files = append(files, Attachment{Filename: name, ContentType: "application/pdf", Data: pdf})
+				outcome = "translated, attached as " + name
+			case jobapi.StatusFailed:
+				outcome = "failed: " + errorMessage
+			default:
+				if !timedOut {
+					return false, nil
+				}
+				outcome = fmt.Sprintf("still %s, check job %s later", status, job.JobID)
+			}
+		}
+		fmt.Fprintf(&body, "- %s: %s\r\n", job.Filename, outcome)
+	}
+	if err := p.sendReply(&mail.Message, body.String(), files); err != nil {
+		return false, err
+	}
+	return true, nil
+}
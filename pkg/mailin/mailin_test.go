@@ -0,0 +1,228 @@
+package mailin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/jobapi"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: scans@service.test\r\n" +
+	"Subject: =?utf-8?q?H=C3=B3a_=C4=91=C6=A1n?=\r\n" +
+	"Message-Id: <m1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Please translate\r\n" +
+	"--b1\r\n" +
+	"Content-Type: image/png; name=\"invoice.png\"\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.png\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0K\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/zip; name=\"notes.zip\"\r\n" +
+	"\r\n" +
+	"PK\r\n" +
+	"--b1--\r\n"
+
+// fakeIMAP serves messages (UID -> raw message) and records the UIDs
+// marked as read
+type fakeIMAP struct {
+	messages map[uint32]string
+	mu       sync.Mutex
+	seen     []uint32
+}
+
+func (s *fakeIMAP) serve(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (s *fakeIMAP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimSpace(line), " ")
+		var uid uint32
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN"), strings.HasPrefix(cmd, "SELECT"):
+		case cmd == "UID SEARCH UNSEEN":
+			uids := []string{}
+			s.mu.Lock()
+			for uid := range s.messages {
+				uids = append(uids, fmt.Sprint(uid))
+			}
+			s.mu.Unlock()
+			fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(uids, " "))
+		case strings.HasPrefix(cmd, "UID FETCH"):
+			fmt.Sscanf(cmd, "UID FETCH %d", &uid)
+			s.mu.Lock()
+			msg := s.messages[uid]
+			s.mu.Unlock()
+			fmt.Fprintf(conn, "* 1 FETCH (UID %d BODY[] {%d}\r\n%s)\r\n", uid, len(msg), msg)
+		case strings.HasPrefix(cmd, "UID STORE"):
+			fmt.Sscanf(cmd, "UID STORE %d", &uid)
+			s.mu.Lock()
+			s.seen = append(s.seen, uid)
+			delete(s.messages, uid)
+			s.mu.Unlock()
+		case cmd == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK\r\n", tag)
+			return
+		default:
+			fmt.Fprintf(conn, "%s BAD unknown command\r\n", tag)
+			continue
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+type fakeAPI struct {
+	submitted map[string]map[string]string // Filename -> fields
+	status    string
+}
+
+func (a *fakeAPI) Submit(ctx context.Context, filename string, data []byte, fields map[string]string) (string, error) {
+	a.submitted[filename] = fields
+	return "job-" + filename, nil
+}
+
+func (a *fakeAPI) Status(ctx context.Context, jobID string) (string, string, error) {
+	return a.status, "", nil
+}
+
+func (a *fakeAPI) PDF(ctx context.Context, jobID string) ([]byte, error) {
+	return []byte("%PDF-1.4"), nil
+}
+
+func TestPoller(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	server := &fakeIMAP{messages: map[uint32]string{
+		7: testMessage,
+		8: strings.Replace(testMessage, "alice@example.com", "mallory@spam.test", 1),
+	}}
+	api := &fakeAPI{submitted: map[string]map[string]string{}, status: "processing"}
+	p := New(Config{
+		IMAPAddr:       server.serve(t),
+		Username:       "scans@service.test",
+		SMTPAddr:       "smtp.service.test:587",
+		AllowedSenders: []string{"@example.com"},
+		TargetLang:     "en",
+	}, client, api)
+	var sent [][]byte
+	p.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if len(to) != 1 || to[0] != "alice@example.com" {
+			t.Errorf("reply sent to %v", to)
+		}
+		sent = append(sent, msg)
+		return nil
+	}
+
+	result, err := p.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Received) != 1 || result.Received[0] != "<m1@example.com>" || len(result.Ignored) != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(server.seen) != 2 {
+		t.Errorf("marked as read: %v, want both messages", server.seen)
+	}
+	fields, ok := api.submitted["invoice.png"]
+	if len(api.submitted) != 1 || !ok || fields["source"] != "email:alice@example.com" || fields["target_lang"] != "en" {
+		t.Errorf("submitted = %v", api.submitted)
+	}
+	if len(sent) != 0 {
+		t.Errorf("replied before the job finished")
+	}
+
+	api.status = jobapi.StatusCompleted
+	result, err = p.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Replied) != 1 || len(sent) != 1 {
+		t.Fatalf("result = %+v, %d replies", result, len(sent))
+	}
+	reply := string(sent[0])
+	for _, want := range []string{"In-Reply-To: <m1@example.com>", "Auto-Submitted: auto-replied", `filename=invoice.pdf`, "Subject: =?utf-8?q?Re:_H=C3=B3a_=C4=91=C6=A1n?="} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply lacks %q:\n%s", want, reply)
+		}
+	}
+	if n, _ := client.HLen(ctx, PendingKey).Result(); n != 0 {
+		t.Errorf("%d messages still pending", n)
+	}
+}
+
+func TestParseMessageNoAttachment(t *testing.T) {
+	msg, err := parseMessage([]byte("From: bob@example.com\r\nSubject: hi\r\n\r\nNo files\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.From != "bob@example.com" || msg.Subject != "hi" || len(msg.Attachments) != 0 {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
+func TestConfigFromEnvAllowedSenders(t *testing.T) {
+	t.Setenv("MAILIN_IMAP_ADDR", "imap.service.test:993")
+	t.Setenv("MAILIN_USERNAME", "scans@service.test")
+	t.Setenv("MAILIN_SMTP_ADDR", "smtp.service.test:587")
+	t.Setenv("MAILIN_ALLOWED_SENDERS", " , ")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("ConfigFromEnv accepted an empty MAILIN_ALLOWED_SENDERS")
+	}
+
+	t.Setenv("MAILIN_ALLOWED_SENDERS", "Bob@Partner.test, @example.com")
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for address, want := range map[string]bool{
+		"bob@partner.test":  true,
+		"alice@example.com": true,
+		"eve@partner.test":  false,
+		"mallory@spam.test": false,
+	} {
+		if got := c.allowed(address); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", address, got, want)
+		}
+	}
+	if (Config{}).allowed("alice@example.com") {
+		t.Error("a Config without AllowedSenders allows anyone")
+	}
+}
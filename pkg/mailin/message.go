@@ -0,0 +1,147 @@
+package mailin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+// maxPartDepth bounds the nesting of multipart bodies
+const maxPartDepth = 10
+
+// Extensions of the documents accepted when the attachment has a generic
+// content type (application/octet-stream)
+var documentExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true,
+	".tif": true, ".tiff": true, ".webp": true, ".pdf": true,
+}
+
+// Attachment is an image or PDF attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is what the poller keeps of an email
+type Message struct {
+	From        string // Address of the sender
+	Subject     string
+	MessageID   string
+	References  string
+	Attachments []Attachment
+}
+
+var wordDecoder = &mime.WordDecoder{}
+
+// parseMessage reads the sender, subject and the image/PDF attachments of
+// a raw RFC 5322 message
+func parseMessage(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(m.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid From: %w", err)
+	}
+	msg := &Message{
+		From:       from.Address,
+		MessageID:  m.Header.Get("Message-Id"),
+		References: m.Header.Get("References"),
+	}
+	msg.Subject, err = wordDecoder.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		msg.Subject = m.Header.Get("Subject")
+	}
+	if err := msg.walk(textproto.MIMEHeader(m.Header), m.Body, 0); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// walk collects the attachments of a part and of its sub-parts
+func (msg *Message) walk(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxPartDepth {
+		return errors.New("multipart nesting too deep")
+	}
+	contentType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		contentType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(contentType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := msg.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	filename := params["name"]
+	if _, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && dispParams["filename"] != "" {
+		filename = dispParams["filename"]
+	}
+	if decoded, err := wordDecoder.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if !isDocument(contentType, filename) {
+		return nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		// Only for a single-part message: multipart.Part decodes
+		// quoted-printable itself and drops the header
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("attachment %s: %w", filename, err)
+	}
+	if filename == "" || filename == "." || filename == "/" {
+		filename = "attachment" + extensionOf(contentType)
+	}
+	msg.Attachments = append(msg.Attachments, Attachment{Filename: filename, ContentType: contentType, Data: data})
+	return nil
+}
+
+// isDocument reports whether a part is an image or PDF to translate
+func isDocument(contentType, filename string) bool {
+	switch {
+	case strings.HasPrefix(contentType, "image/"), contentType == "application/pdf":
+		return true
+	case contentType == "application/octet-stream":
+		return documentExtensions[strings.ToLower(path.Ext(filename))]
+	}
+	return false
+}
+
+func extensionOf(contentType string) string {
+	if contentType == "application/pdf" {
+		return ".pdf"
+	}
+	if _, subtype, ok := strings.Cut(contentType, "/"); ok && contentType != "application/octet-stream" {
+		return "." + subtype
+	}
+	return ""
+}
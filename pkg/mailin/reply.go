@@ -0,0 +1,85 @@
+package mailin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendFunc sends a message, smtp.SendMail outside of tests
+type sendFunc func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// composeReply builds a reply to original with a text body and the files
+// attached, threaded with In-Reply-To and References
+func composeReply(from string, original *Message, body string, files []Attachment) []byte {
+	boundary := randomHex(16)
+	var b bytes.Buffer
+	header := func(name, value string) { fmt.Fprintf(&b, "%s: %s\r\n", name, value) }
+	header("From", from)
+	header("To", original.From)
+	subject := original.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	_, domain, _ := strings.Cut(from, "@")
+	header("Message-Id", fmt.Sprintf("<%s@%s>", randomHex(12), domain))
+	if original.MessageID != "" {
+		header("In-Reply-To", original.MessageID)
+		header("References", strings.TrimSpace(original.References+" "+original.MessageID))
+	}
+	header("Auto-Submitted", "auto-replied") // RFC 3834: no auto-reply loops
+	header("MIME-Version", "1.0")
+	header("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%q", boundary))
+	b.WriteString("\r\n")
+
+	part := func(contentType, disposition string, data []byte) {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s\r\n", contentType)
+		if disposition != "" {
+			fmt.Fprintf(&b, "Content-Disposition: %s\r\n", disposition)
+		}
+		b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			b.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		b.WriteString(encoded + "\r\n")
+	}
+	part("text/plain; charset=utf-8", "", []byte(body))
+	for _, file := range files {
+		part(file.ContentType, mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}), file.Data)
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes()
+}
+
+// sendReply sends msg to the sender of original through the SMTP server of
+// the config
+func (p *Poller) sendReply(original *Message, body string, files []Attachment) error {
+	msg := composeReply(p.config.From, original, body, files)
+	var auth smtp.Auth
+	if p.config.SMTPPassword != "" {
+		host, _, _ := net.SplitHostPort(p.config.SMTPAddr)
+		auth = smtp.PlainAuth("", p.config.SMTPUsername, p.config.SMTPPassword, host)
+	}
+	if err := p.send(p.config.SMTPAddr, auth, p.config.From, []string{original.From}, msg); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -1,7 +1,108 @@
 package messaging
 
+import "encoding/json"
+
+// Job types
+const (
+	JobTypeImage   = ""         // OCR of an uploaded image (default)
+	JobTypePDFText = "pdf_text" // Translation of the text layer of a PDF, without OCR
+	JobTypeText    = "text"     // Translation of a text supplied by the client (corrected OCR text)
+)
+
+// OCR modes of an image job
+const (
+	OCRModePrinted     = ""            // Printed text, recognized by the worker OCR engine (default)
+	OCRModeHandwriting = "handwriting" // Handwritten notes, recognized by the handwriting engine
+)
+
+// Positional formats of the OCR text stored when requested in JobMessage.OCRFormats
+const (
+	OCRFormatHOCR = "hocr" // hOCR (XHTML)
+	OCRFormatALTO = "alto" // ALTO XML
+)
+
+// Outputs rendered next to the translated PDF when requested in JobMessage.Outputs
+const (
+	OutputOriginalPDF = "original_pdf" // PDF of the recognized text, in the source language
+	OutputText        = "txt"          // Translated text, UTF-8 with a form feed between pages
+	OutputAudio       = "audio"        // Translated text read aloud (text-to-speech), MP3
+)
+
+// OutputFiles maps the outputs to the name of their file in the storage
+var OutputFiles = map[string]string{
+	OutputOriginalPDF: "original.pdf",
+	OutputText:        "translated.txt",
+	OutputAudio:       "translated.mp3",
+}
+
 // JobMessage represents the data sent over Kafka for a processing job.
 type JobMessage struct {
 	JobID     string `json:"job_id"`
-	ImagePath string `json:"image_path"`
+	ImagePath string `json:"image_path"` // Input file: an image, a PDF for JobTypePDFText or UTF-8 text for JobTypeText
+	// JobType is JobTypeImage, JobTypePDFText or JobTypeText
+	JobType string `json:"job_type,omitempty"`
+	// EmbedImage controls embedding the source image in the PDF: "", "first_page" or "appendix"
+	EmbedImage string `json:"embed_image,omitempty"`
+	// TargetLang is the translation target language (ISO 639-1), empty means Vietnamese
+	TargetLang string `json:"target_lang,omitempty"`
+	// Glossary is the name of a stored glossary whose terms are enforced in the translation
+	Glossary string `json:"glossary,omitempty"`
+	// GlossaryTerms are per-request terms (source -> target), overriding the stored glossary
+	GlossaryTerms map[string]string `json:"glossary_terms,omitempty"`
+	// FramePolicy selects the frames of multi-frame images (animated GIFs): "first", "best" or "all"
+	FramePolicy string `json:"frame_policy,omitempty"`
+	// DPI overrides the resolution given to OCR, 0 infers it from the image
+	DPI int `json:"dpi,omitempty"`
+	// Regions limits OCR to these regions of the image, each returning its own text
+	Regions []CropRegion `json:"regions,omitempty"`
+	// OCRMode is OCRModePrinted or OCRModeHandwriting
+	OCRMode string `json:"ocr_mode,omitempty"`
+	// OCRConfig tunes the OCR engine for the document type, nil for the
+	// defaults of the worker
+	OCRConfig *OCRConfig `json:"ocr_config,omitempty"`
+	// OCRFormats lists the positional formats (OCRFormatHOCR, OCRFormatALTO)
+	// stored with the plain OCR text, one document per page
+	OCRFormats []string `json:"ocr_formats,omitempty"`
+	// Barcodes detects and decodes the barcodes and QR codes of the image
+	// (also done by workers with BARCODE_DETECTION set)
+	Barcodes bool `json:"barcodes,omitempty"`
+	// Summarize adds a short summary of the translation to the result (also
+	// done by workers with SUMMARIZATION set)
+	Summarize bool `json:"summarize,omitempty"`
+	// Outputs lists the outputs rendered in addition to the translated PDF
+	// (OutputOriginalPDF, OutputText, OutputAudio), concurrently with it
+	Outputs []string `json:"outputs,omitempty"`
+	// Pipeline is a pipeline.Definition (JSON) replacing the stages of the
+	// worker's pipeline for this job, empty for the worker's pipeline
+	Pipeline json.RawMessage `json:"pipeline,omitempty"`
+	// Attempt is the delivery number of the job, starting at 1 and incremented
+	// each time a stuck job is re-enqueued (0 in messages without a counter)
+	Attempt int `json:"attempt,omitempty"`
+	// RequestID is the ID of the API request that created the job
+	// (X-Request-ID), logged by every service handling the job
+	RequestID string `json:"request_id,omitempty"`
+	// SkipCache processes the job even when a result (or a recent failure) is
+	// cached for its input; the fresh result replaces the cached one
+	SkipCache bool `json:"skip_cache,omitempty"`
+}
+
+// CropRegion is a rectangle of the image in normalized coordinates (0-1,
+// origin at the top left corner)
+type CropRegion struct {
+	Name   string  `json:"name,omitempty"` // Label chosen by the client, e.g. "id_number"
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// OCRConfig tunes the recognition of an image job: Tesseract page
+// segmentation mode and engine mode, allowed and refused characters and other
+// variables. Its fields match ocr.Config.
+type OCRConfig struct {
+	PSM       int               `json:"psm,omitempty"`       // Page segmentation mode, 0: engine default
+	OEM       *int              `json:"oem,omitempty"`       // OCR engine mode, nil: engine default
+	Whitelist string            `json:"whitelist,omitempty"` // Only characters recognized
+	Blacklist string            `json:"blacklist,omitempty"` // Characters never recognized
+	Variables map[string]string `json:"variables,omitempty"` // Other Tesseract variables (name -> value)
 }
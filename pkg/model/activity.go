@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Job activity is counted in hourly buckets, kept a little longer than the
+// longest window read by LoadActivity
+const (
+	activityBucket    = time.Hour
+	activityRetention = 25 * time.Hour
+	// Longest error message counted; longer messages are cut, so messages
+	// that differ only in a long tail are grouped
+	maxErrorLength = 200
+)
+
+// ActivityKey is a hash of status -> number of jobs that entered the status
+// during the hour starting at hour
+func ActivityKey(hour time.Time) string {
+	return "stats:jobs:" + hour.UTC().Format("2006010215")
+}
+
+// ErrorsKey is a sorted set of error message -> number of jobs that failed
+// with it during the hour starting at hour
+func ErrorsKey(hour time.Time) string {
+	return "stats:errors:" + hour.UTC().Format("2006010215")
+}
+
+// ErrorCount is an error message with the number of jobs that failed with it
+type ErrorCount struct {
+	Message string `json:"message"`
+	Jobs    int64  `json:"jobs"`
+}
+
+// Activity is the job activity over a window
+type Activity struct {
+	// Statuses counts the status changes per status: a job requeued by the
+	// reaper is counted again in queued and processing
+	Statuses  map[string]int64 `json:"statuses"`
+	TopErrors []ErrorCount     `json:"top_errors"`
+}
+
+// errorSummary returns the first line of an error message, cut to
+// maxErrorLength
+func errorSummary(message string) string {
+	message, _, _ = strings.Cut(strings.TrimSpace(message), "\n")
+	if len(message) > maxErrorLength {
+		message = strings.ToValidUTF8(message[:maxErrorLength], "") + "…"
+	}
+	return message
+}
+
+// recordActivity counts a status change in the bucket of the current hour
+func recordActivity(ctx context.Context, pipe redis.Pipeliner, status, result string) {
+	hour := time.Now().Truncate(activityBucket)
+	pipe.HIncrBy(ctx, ActivityKey(hour), status, 1)
+	pipe.Expire(ctx, ActivityKey(hour), activityRetention)
+	if status == StatusFailed {
+		pipe.ZIncrBy(ctx, ErrorsKey(hour), 1, errorSummary(result))
+		pipe.Expire(ctx, ErrorsKey(hour), activityRetention)
+	}
+}
+
+// LoadActivity sums the hourly buckets covering the last window (at most 24
+// hours, rounded up to whole hours) and returns the topErrors most frequent
+// error messages
+func LoadActivity(ctx context.Context, client redis.Cmdable, window time.Duration, topErrors int) (*Activity, error) {
+	if window > activityRetention-activityBucket {
+		window = activityRetention - activityBucket
+	}
+	now := time.Now().Truncate(activityBucket)
+	pipe := client.Pipeline()
+	var statuses []*redis.StringStringMapCmd
+	var failures []*redis.ZSliceCmd
+	for hour := now; !hour.Before(now.Add(-window)); hour = hour.Add(-activityBucket) {
+		statuses = append(statuses, pipe.HGetAll(ctx, ActivityKey(hour)))
+		failures = append(failures, pipe.ZRangeWithScores(ctx, ErrorsKey(hour), 0, -1))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	activity := &Activity{Statuses: map[string]int64{}, TopErrors: []ErrorCount{}}
+	for _, status := range []string{StatusQueued, StatusProcessing, StatusCompleted, StatusFailed} {
+		activity.Statuses[status] = 0
+	}
+	for _, cmd := range statuses {
+		for status, count := range cmd.Val() {
+			n, _ := strconv.ParseInt(count, 10, 64)
+			activity.Statuses[status] += n
+		}
+	}
+	counts := map[string]int64{}
+	for _, cmd := range failures {
+		for _, z := range cmd.Val() {
+			message, _ := z.Member.(string)
+			counts[message] += int64(z.Score)
+		}
+	}
+	for message, jobs := range counts {
+		activity.TopErrors = append(activity.TopErrors, ErrorCount{Message: message, Jobs: jobs})
+	}
+	sort.Slice(activity.TopErrors, func(i, j int) bool {
+		a, b := activity.TopErrors[i], activity.TopErrors[j]
+		return a.Jobs > b.Jobs || (a.Jobs == b.Jobs && a.Message < b.Message)
+	})
+	if len(activity.TopErrors) > topErrors {
+		activity.TopErrors = activity.TopErrors[:topErrors]
+	}
+	return activity, nil
+}
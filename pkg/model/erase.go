@@ -0,0 +1,53 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DeletedKey marks a job deleted by its owner: Load reports it as not found
+// while its data is kept until its retention is over
+func DeletedKey(jobID string) string { return jobID + ":deleted" }
+
+// SoftDelete hides the job from Load until its keys expire. The history of
+// the job is kept.
+func (s *Store) SoftDelete(ctx context.Context, jobID string) error {
+	return s.client.Set(ctx, DeletedKey(jobID), time.Now().UTC().Format(time.RFC3339), s.ResultTTL(ctx, jobID)).Err()
+}
+
+// Deleted reports whether the job was soft deleted
+func (s *Store) Deleted(ctx context.Context, jobID string) (bool, error) {
+	n, err := s.client.Exists(ctx, DeletedKey(jobID)).Result()
+	return n > 0, err
+}
+
+// Erase deletes every Redis key of the job ("<jobID>:*": status, details,
+// texts, history, stage markers...) and removes it from the job indexes. It
+// returns the number of keys deleted.
+func (s *Store) Erase(ctx context.Context, jobID string) (int, error) {
+	var keys []string
+	iter := s.client.Scan(ctx, 0, jobID+":*", 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+	pipe := s.client.TxPipeline()
+	var deleted *redis.IntCmd
+	if len(keys) > 0 {
+		deleted = pipe.Del(ctx, keys...)
+	}
+	for _, index := range []string{ProcessingKey, FinishedKey, RetentionIndexKey} {
+		pipe.ZRem(ctx, index, jobID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	if deleted == nil {
+		return 0, nil
+	}
+	return int(deleted.Val()), nil
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// historyMaxLen bounds the history stream of a job; a job redelivered many
+// times keeps its latest events
+const historyMaxLen = 1000
+
+// HistoryKey is the Redis stream holding the audit trail of a job, append
+// only, expiring with the job
+func HistoryKey(jobID string) string { return jobID + ":history" }
+
+// History event types
+const (
+	HistorySubmitted  = "submitted"  // Accepted by the API
+	HistoryStatus     = "status"     // Status change, see Store.SetStatus
+	HistoryStage      = "stage"      // A worker entered a processing stage
+	HistoryDownloaded = "downloaded" // PDF or output downloaded
+	HistoryDeleted    = "deleted"    // Soft deleted by its owner, see Store.SoftDelete
+	HistoryDelivered  = "delivered"  // PDF uploaded to a Drive/Dropbox folder of the tenant
+)
+
+// HistoryEvent is an entry of the audit trail of a job
+type HistoryEvent struct {
+	ID     string    `json:"id"` // Stream entry ID, ordered
+	At     time.Time `json:"at"`
+	Type   string    `json:"type"`
+	Status string    `json:"status,omitempty"`
+	Stage  string    `json:"stage,omitempty"`
+	// Actor is who caused the event: "api", "reaper", "worker:<id>", or the
+	// tenant and API key fingerprint of a request
+	Actor     string `json:"actor,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Detail    string `json:"detail,omitempty"` // Error of a failed job, downloaded file...
+}
+
+func (e HistoryEvent) values() map[string]interface{} {
+	values := map[string]interface{}{"at": e.At.UnixMilli(), "type": e.Type}
+	for name, value := range map[string]string{
+		"status": e.Status, "stage": e.Stage, "actor": e.Actor, "ip": e.IP,
+		"request_id": e.RequestID, "detail": e.Detail,
+	} {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// appendHistory adds event to the history of the job in pipe and resets the
+// expiry of the stream to ttl
+func appendHistory(ctx context.Context, pipe redis.Cmdable, jobID string, event HistoryEvent, ttl time.Duration) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: HistoryKey(jobID), MaxLenApprox: historyMaxLen, Values: event.values()})
+	pipe.Expire(ctx, HistoryKey(jobID), ttl)
+}
+
+// RecordHistory appends event to the history of the job, with the actor of
+// the store when the event has none. A stage event is also published on
+// StatusChannel, for the clients following the progress of the job.
+func (s *Store) RecordHistory(ctx context.Context, jobID string, event HistoryEvent) error {
+	if event.Actor == "" {
+		event.Actor = s.actor
+	}
+	ttl := s.ResultTTL(ctx, jobID)
+	pipe := s.client.TxPipeline()
+	appendHistory(ctx, pipe, jobID, event, ttl)
+	if event.Type == HistoryStage {
+		pipe.Publish(ctx, StatusChannel(jobID), "stage:"+event.Stage)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LoadHistory returns the history of the job, oldest first; empty for an
+// unknown or expired job
+func LoadHistory(ctx context.Context, client redis.Cmdable, jobID string) ([]HistoryEvent, error) {
+	entries, err := client.XRange(ctx, HistoryKey(jobID), "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]HistoryEvent, 0, len(entries))
+	for _, entry := range entries {
+		field := func(name string) string {
+			value, _ := entry.Values[name].(string)
+			return value
+		}
+		event := HistoryEvent{
+			ID:        entry.ID,
+			Type:      field("type"),
+			Status:    field("status"),
+			Stage:     field("stage"),
+			Actor:     field("actor"),
+			IP:        field("ip"),
+			RequestID: field("request_id"),
+			Detail:    field("detail"),
+		}
+		if ms, err := strconv.ParseInt(field("at"), 10, 64); err == nil {
+			event.At = time.UnixMilli(ms).UTC()
+		}
+		history = append(history, event)
+	}
+	return history, nil
+}
@@ -0,0 +1,400 @@
+// Package model holds the job status types and the Redis layer that persists
+// them, shared by the API (reads), the worker (writes) and the reaper, so every
+// component uses the same key scheme and status semantics.
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Job statuses
+const (
+	StatusQueued     = "queued"     // Accepted, waiting for a worker
+	StatusProcessing = "processing" // A worker is running the pipeline
+	StatusCompleted  = "completed"  // The PDF is in storage
+	StatusFailed     = "failed"     // See Result.Error
+)
+
+// ProcessingKey is a sorted set of job ID -> unix time the job entered
+// StatusProcessing, scanned by the stuck-job reaper
+const ProcessingKey = "jobs:processing"
+
+// FinishedKey is a sorted set of job ID -> unix time the job became completed
+// or failed, scanned by the archiver before the job keys expire
+const FinishedKey = "jobs:finished"
+
+// ErrNotFound is returned for a job without status (unknown or expired)
+var ErrNotFound = errors.New("job not found")
+
+// ErrConflict is returned when a status write lost a race: the version
+// passed to CompareAndSetStatus is stale, or the job is already completed
+var ErrConflict = errors.New("job status changed concurrently")
+
+// Redis keys of a job
+func StatusKey(jobID string) string  { return jobID + ":status" }
+func ErrorKey(jobID string) string   { return jobID + ":error" }
+func PDFPathKey(jobID string) string { return jobID + ":pdfpath" }
+func DetailsKey(jobID string) string { return jobID + ":details" }
+func VersionKey(jobID string) string { return jobID + ":version" }
+
+// StatusChannel is the pub/sub channel receiving the new status of the job
+// on every change, and "stage:<name>" when a worker enters a stage (see
+// RecordHistory), for following a job without polling
+func StatusChannel(jobID string) string { return jobID + ":status:changed" }
+
+// waitPollInterval bounds the wait for a status change in Wait, in case a
+// message is lost (reconnection of the subscription)
+const waitPollInterval = 5 * time.Second
+
+// PDFKey is the storage key of the PDF generated by the job, under the
+// directory of its tenant
+func PDFKey(jobID string) string {
+	if tenant := TenantOf(jobID); tenant != "" {
+		return fmt.Sprintf("pdfs/%s/%s.pdf", tenant, jobID)
+	}
+	return fmt.Sprintf("pdfs/%s.pdf", jobID)
+}
+
+// ThumbnailKey is the storage key of the JPEG thumbnail of the uploaded
+// image, next to the PDF of the job
+func ThumbnailKey(jobID string) string {
+	if tenant := TenantOf(jobID); tenant != "" {
+		return fmt.Sprintf("thumbnails/%s/%s.jpg", tenant, jobID)
+	}
+	return fmt.Sprintf("thumbnails/%s.jpg", jobID)
+}
+
+// OutputKey is the storage key of an extra output of the job, named file
+// (see messaging.OutputFiles), next to the PDF of the job
+func OutputKey(jobID, file string) string {
+	if tenant := TenantOf(jobID); tenant != "" {
+		return fmt.Sprintf("outputs/%s/%s/%s", tenant, jobID, file)
+	}
+	return fmt.Sprintf("outputs/%s/%s", jobID, file)
+}
+
+// Intermediate files of a job kept for debugging bad translations
+const (
+	ArtifactOCR      = "ocr"      // Text recognized or extracted, before cleanup
+	ArtifactFiltered = "filtered" // Image given to OCR after filtering (first page)
+	ArtifactCleaned  = "cleaned"  // Text given to translation, after cleanup
+)
+
+// ArtifactFiles maps the artifacts to the name of their file in the storage
+var ArtifactFiles = map[string]string{
+	ArtifactOCR:      "ocr.txt",
+	ArtifactFiltered: "filtered.png",
+	ArtifactCleaned:  "cleaned.txt",
+}
+
+// ArtifactKey is the storage key of an artifact of the job, named file (see
+// ArtifactFiles), next to the PDF of the job
+func ArtifactKey(jobID, file string) string {
+	if tenant := TenantOf(jobID); tenant != "" {
+		return fmt.Sprintf("artifacts/%s/%s/%s", tenant, jobID, file)
+	}
+	return fmt.Sprintf("artifacts/%s/%s", jobID, file)
+}
+
+// OutputsKey is a hash of output -> storage key of the outputs of the job
+// rendered so far. The job completes once every requested output is in the
+// hash, which also lets a redelivered job skip the outputs already rendered.
+func OutputsKey(jobID string) string { return jobID + ":outputs" }
+
+// TranslationCacheKey is a set of the result cache keys of the paragraph
+// translations the job wrote or reused, deleted from the cache when the job
+// is erased
+func TranslationCacheKey(jobID string) string { return jobID + ":translation_cache" }
+
+// TenantJobID returns the ID of a job of tenant: "<tenant>.<id>", so every
+// Redis key and storage path derived from the job ID is scoped to the tenant.
+// The default tenant ("") keeps plain IDs.
+func TenantJobID(tenant, id string) string {
+	if tenant == "" {
+		return id
+	}
+	return tenant + "." + id
+}
+
+// TenantOf returns the tenant of a job ID created by TenantJobID
+func TenantOf(jobID string) string {
+	tenant, _, found := strings.Cut(jobID, ".")
+	if !found {
+		return ""
+	}
+	return tenant
+}
+
+// Result is the persisted state of a job
+type Result struct {
+	JobID  string
+	Status string
+	// PDFPath is the storage key of the PDF of a completed job; a cache hit
+	// points to the PDF of an earlier job
+	PDFPath string
+	Error   string            // Error message of a failed job
+	Details map[string]string // Submit fields, stage while running, timings and options once finished
+	// Version counts the status changes of the job, see CompareAndSetStatus
+	Version int64
+}
+
+// Store persists job statuses in Redis
+type Store struct {
+	client *redis.Client
+	ttl    time.Duration
+	actor  string // Recorded in the history of the jobs, see WithActor
+}
+
+// NewStore creates a store whose keys expire after ttl
+func NewStore(client *redis.Client, ttl time.Duration) *Store {
+	return &Store{client: client, ttl: ttl}
+}
+
+// WithActor returns a store recording actor ("api", "worker:<id>"...) as the
+// author of the status changes in the history of the jobs
+func (s *Store) WithActor(actor string) *Store {
+	store := *s
+	store.actor = actor
+	return &store
+}
+
+// SetStatus sets the status of the job. result is the PDF key of a completed
+// job or the error message of a failed one; the value of the other status is
+// removed. Jobs in StatusProcessing are indexed in ProcessingKey, finished
+// jobs in FinishedKey; the change is counted in the job activity (see
+// LoadActivity).
+//
+// A completed job stays completed: moving it to another status returns
+// ErrConflict, so a late write of a stale worker (redelivered message) cannot
+// erase its PDF path.
+func (s *Store) SetStatus(ctx context.Context, jobID, status, result string) error {
+	// The transaction is retried when another writer changed the status meanwhile
+	for attempt := 0; attempt < 3; attempt++ {
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := tx.Get(ctx, StatusKey(jobID)).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if current == StatusCompleted && status != StatusCompleted {
+				return ErrConflict
+			}
+			return s.write(ctx, tx, jobID, status, result)
+		}, StatusKey(jobID))
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return ErrConflict
+}
+
+// CompareAndSetStatus sets the status like SetStatus, only if the version of
+// the job (Result.Version) is still version; otherwise it returns ErrConflict
+// and changes nothing. It makes read-check-write sequences safe against
+// concurrent writers, e.g. the reaper requeuing a job a worker just finished.
+func (s *Store) CompareAndSetStatus(ctx context.Context, jobID string, version int64, status, result string) error {
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, VersionKey(jobID)).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current != version {
+			return ErrConflict
+		}
+		return s.write(ctx, tx, jobID, status, result)
+	}, VersionKey(jobID), StatusKey(jobID))
+	if err == redis.TxFailedErr {
+		return ErrConflict
+	}
+	return err
+}
+
+// write applies a status change in a MULTI/EXEC of tx and bumps the version.
+// A finished job with a RetentionRecord keeps its keys for the retention of
+// its status, and is indexed in RetentionIndexKey for the janitor.
+func (s *Store) write(ctx context.Context, tx *redis.Tx, jobID, status, result string) error {
+	ttl := s.ttl
+	finished := status == StatusCompleted || status == StatusFailed
+	var record *RetentionRecord
+	if finished {
+		var err error
+		if record, err = LoadRetention(ctx, tx, jobID); err != nil {
+			return err
+		}
+		if record != nil {
+			ttl = record.Policy.Metadata(status, s.ttl)
+			record.Status, record.FinishedAt = status, time.Now().UTC()
+		}
+	}
+	_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, StatusKey(jobID), status, ttl)
+		pipe.Incr(ctx, VersionKey(jobID))
+		pipe.Expire(ctx, VersionKey(jobID), ttl)
+		if status == StatusProcessing {
+			pipe.ZAdd(ctx, ProcessingKey, &redis.Z{Score: float64(time.Now().Unix()), Member: jobID})
+		} else {
+			pipe.ZRem(ctx, ProcessingKey, jobID)
+		}
+		if finished {
+			pipe.ZAdd(ctx, FinishedKey, &redis.Z{Score: float64(time.Now().Unix()), Member: jobID})
+		} else {
+			pipe.ZRem(ctx, FinishedKey, jobID)
+		}
+		recordActivity(ctx, pipe, status, result)
+		event := HistoryEvent{Type: HistoryStatus, Status: status, Actor: s.actor}
+		if status == StatusFailed {
+			event.Detail = errorSummary(result)
+		}
+		appendHistory(ctx, pipe, jobID, event, ttl)
+		pipe.Publish(ctx, StatusChannel(jobID), status)
+		switch status {
+		case StatusCompleted:
+			pipe.Set(ctx, PDFPathKey(jobID), result, ttl)
+			pipe.Del(ctx, ErrorKey(jobID))
+		case StatusFailed:
+			pipe.Set(ctx, ErrorKey(jobID), result, ttl)
+			pipe.Del(ctx, PDFPathKey(jobID))
+		default:
+			pipe.Del(ctx, PDFPathKey(jobID), ErrorKey(jobID))
+		}
+		if record != nil {
+			pipe.Expire(ctx, DetailsKey(jobID), ttl)
+			for _, suffix := range ResultKeys {
+				pipe.Expire(ctx, jobID+":"+suffix, ttl)
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, RetentionKey(jobID), data, record.keepFor(ttl))
+			if next := record.NextDeletion(); !next.IsZero() {
+				pipe.ZAdd(ctx, RetentionIndexKey, &redis.Z{Score: float64(next.Unix()), Member: jobID})
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// ResultTTL returns the expiry of keys written for the job now: the TTL of
+// the store, or the remaining retention of a finished job if longer
+func (s *Store) ResultTTL(ctx context.Context, jobID string) time.Duration {
+	if remaining, err := s.client.PTTL(ctx, StatusKey(jobID)).Result(); err == nil && remaining > s.ttl {
+		return remaining
+	}
+	return s.ttl
+}
+
+// SaveDetails merges details into the details of the job: only the given
+// fields are written, so concurrent writers of different fields do not
+// overwrite each other. The details of a finished job keep its retention.
+func (s *Store) SaveDetails(ctx context.Context, jobID string, details map[string]string) error {
+	if len(details) == 0 {
+		return nil
+	}
+	ttl := s.ResultTTL(ctx, jobID)
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, DetailsKey(jobID), details)
+	pipe.Expire(ctx, DetailsKey(jobID), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Status returns the status of the job
+func (s *Store) Status(ctx context.Context, jobID string) (string, error) {
+	status, err := s.client.Get(ctx, StatusKey(jobID)).Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	return status, err
+}
+
+// Load returns the job with its version and details, and its PDF path and
+// error once finished. The details of a queued or running job hold what is
+// known so far: the submit fields (request_id, external_id, labels...), then
+// the stage and the thumbnail written by the worker. A soft deleted job is
+// not found.
+func (s *Store) Load(ctx context.Context, jobID string) (*Result, error) {
+	pipe := s.client.Pipeline()
+	values := pipe.MGet(ctx, StatusKey(jobID), VersionKey(jobID), DeletedKey(jobID))
+	details := pipe.HGetAll(ctx, DetailsKey(jobID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	status, ok := values.Val()[0].(string)
+	if !ok || values.Val()[2] != nil {
+		return nil, ErrNotFound
+	}
+	result := &Result{JobID: jobID, Status: status, Details: details.Val()}
+	if version, ok := values.Val()[1].(string); ok {
+		result.Version, _ = strconv.ParseInt(version, 10, 64)
+	}
+	if status != StatusCompleted && status != StatusFailed {
+		return result, nil
+	}
+	pipe = s.client.Pipeline()
+	pdfPath := pipe.Get(ctx, PDFPathKey(jobID))
+	errorMsg := pipe.Get(ctx, ErrorKey(jobID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	result.PDFPath = pdfPath.Val()
+	result.Error = errorMsg.Val()
+	return result, nil
+}
+
+// Wait returns the job once completed or failed, waiting for the status
+// changes published on StatusChannel, or the error of ctx when it ends
+// first. It returns ErrNotFound for an unknown or deleted job.
+func (s *Store) Wait(ctx context.Context, jobID string) (*Result, error) {
+	return s.Watch(ctx, jobID, nil)
+}
+
+// Watch is Wait calling progress (nil: ignored) with the job loaded after
+// every message on StatusChannel while it is not finished, so a client can
+// be told about each status and stage. An error of progress stops the watch
+// and is returned.
+func (s *Store) Watch(ctx context.Context, jobID string, progress func(*Result) error) (*Result, error) {
+	// Subscribed before the first Load so a change in between is not missed
+	sub := s.client.Subscribe(ctx, StatusChannel(jobID))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	changes := sub.Channel()
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := s.Load(ctx, jobID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if job.Status == StatusCompleted || job.Status == StatusFailed {
+			return job, nil
+		}
+		if progress != nil {
+			if err := progress(job); err != nil {
+				return nil, err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changes:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client, time.Hour), mr
+}
+
+func TestSetStatus(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestStore(t)
+
+	if err := store.SetStatus(ctx, "job1", StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mr.ZScore(ProcessingKey, "job1"); err != nil {
+		t.Fatalf("processing job not indexed: %v", err)
+	}
+	if err := store.SetStatus(ctx, "job1", StatusFailed, "OCR error"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(ProcessingKey) {
+		t.Fatal("failed job still indexed as processing")
+	}
+	if err := store.SetStatus(ctx, "job1", StatusCompleted, "pdfs/job1.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(ErrorKey("job1")) {
+		t.Fatal("error message kept after completion")
+	}
+	if ttl := mr.TTL(StatusKey("job1")); ttl != time.Hour {
+		t.Fatalf("status TTL = %v, want 1h", ttl)
+	}
+
+	// A stale worker cannot move a completed job back
+	if err := store.SetStatus(ctx, "job1", StatusProcessing, ""); !errors.Is(err, ErrConflict) {
+		t.Fatalf("SetStatus on a completed job: err = %v, want ErrConflict", err)
+	}
+	job, err := store.Load(ctx, "job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusCompleted || job.PDFPath != "pdfs/job1.pdf" || job.Error != "" || job.Version != 3 {
+		t.Fatalf("job = %+v, want completed with its PDF at version 3", job)
+	}
+}
+
+func TestCompareAndSetStatus(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	if err := store.SetStatus(ctx, "job1", StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	job, err := store.Load(ctx, "job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker finishes between the read and the write of the reaper
+	if err := store.SetStatus(ctx, "job1", StatusCompleted, "pdfs/job1.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CompareAndSetStatus(ctx, "job1", job.Version, StatusQueued, ""); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale version: err = %v, want ErrConflict", err)
+	}
+	if status, _ := store.Status(ctx, "job1"); status != StatusCompleted {
+		t.Fatalf("status = %q after a failed compare-and-set", status)
+	}
+
+	if err := store.SetStatus(ctx, "job2", StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	job, _ = store.Load(ctx, "job2")
+	if err := store.CompareAndSetStatus(ctx, "job2", job.Version, StatusFailed, "deadline exceeded"); err != nil {
+		t.Fatalf("current version: %v", err)
+	}
+	if job, _ = store.Load(ctx, "job2"); job.Status != StatusFailed || job.Error != "deadline exceeded" || job.Version != 2 {
+		t.Fatalf("job = %+v", job)
+	}
+}
+
+func TestSaveDetails(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	if err := store.SaveDetails(ctx, "job1", map[string]string{"ocr_ms": "10", "cached": "false"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveDetails(ctx, "job1", map[string]string{"pdf_ms": "5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetStatus(ctx, "job1", StatusCompleted, "pdfs/job1.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	job, err := store.Load(ctx, "job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Details) != 3 || job.Details["ocr_ms"] != "10" || job.Details["pdf_ms"] != "5" {
+		t.Fatalf("details = %v, want the fields of both writes", job.Details)
+	}
+}
+
+func TestLoadNotFound(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load: err = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Status(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Status: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLoadDetailsWhileRunning(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	if err := store.SetStatus(ctx, "job1", StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveDetails(ctx, "job1", map[string]string{"stage": "ocr"}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := store.Load(ctx, "job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Details["stage"] != "ocr" || job.PDFPath != "" {
+		t.Fatalf("job = %+v, want the stage of the running job", job)
+	}
+}
+
+func TestLoadActivity(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	for i, jobID := range []string{"job1", "job2", "job3"} {
+		if err := store.SetStatus(ctx, jobID, StatusQueued, ""); err != nil {
+			t.Fatal(err)
+		}
+		result := "OCR error: exit status 1\ntesseract output"
+		if i == 2 {
+			result = "Translation timeout"
+		}
+		if err := store.SetStatus(ctx, jobID, StatusFailed, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	activity, err := LoadActivity(ctx, store.client, 24*time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activity.Statuses[StatusQueued] != 3 || activity.Statuses[StatusFailed] != 3 || activity.Statuses[StatusCompleted] != 0 {
+		t.Errorf("Statuses = %v, want 3 queued and 3 failed", activity.Statuses)
+	}
+	want := []ErrorCount{{Message: "OCR error: exit status 1", Jobs: 2}}
+	if len(activity.TopErrors) != 1 || activity.TopErrors[0] != want[0] {
+		t.Errorf("TopErrors = %v, want %v", activity.TopErrors, want)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestStore(t)
+
+	policy := Retention{Completed: 30 * 24 * time.Hour, Failed: 48 * time.Hour, Artifacts: 7 * 24 * time.Hour}
+	for _, jobID := range []string{"done", "broken"} {
+		if err := SaveRetention(ctx, store.client, jobID, RetentionRecord{Policy: policy, UploadPath: "/uploads/" + jobID}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetStatus(ctx, jobID, StatusQueued, ""); err != nil {
+			t.Fatal(err)
+		}
+		mr.Set(jobID+":ocr_text", "text")
+		mr.SetTTL(jobID+":ocr_text", time.Hour)
+	}
+	if err := store.SetStatus(ctx, "done", StatusCompleted, "done.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetStatus(ctx, "broken", StatusFailed, "OCR error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveDetails(ctx, "done", map[string]string{"ocr_ms": "10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]time.Duration{
+		StatusKey("done"):      policy.Completed,
+		PDFPathKey("done"):     policy.Completed,
+		DetailsKey("done"):     policy.Completed,
+		"done:ocr_text":        policy.Completed,
+		StatusKey("broken"):    policy.Failed,
+		"broken:ocr_text":      policy.Failed,
+		RetentionKey("done"):   policy.Completed + time.Hour,
+		RetentionKey("broken"): policy.Artifacts + time.Hour,
+	} {
+		if got := mr.TTL(key); got != want {
+			t.Errorf("TTL of %s = %s, want %s", key, got, want)
+		}
+	}
+
+	record, err := LoadRetention(ctx, store.client, "done")
+	if err != nil || record == nil {
+		t.Fatalf("LoadRetention = %v, %v", record, err)
+	}
+	if record.Status != StatusCompleted || record.FinishedAt.IsZero() {
+		t.Errorf("record = %+v, want finished completed", record)
+	}
+	score, err := mr.ZScore(RetentionIndexKey, "done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := record.FinishedAt.Add(policy.Artifacts).Unix(); int64(score) != want {
+		t.Errorf("next deletion = %d, want %d", int64(score), want)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	worker := store.WithActor("worker:w1")
+
+	if err := store.RecordHistory(ctx, "job1", HistoryEvent{Type: HistorySubmitted, Actor: "tenant:acme", IP: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WithActor("api").SetStatus(ctx, "job1", StatusQueued, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := worker.SetStatus(ctx, "job1", StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := worker.RecordHistory(ctx, "job1", HistoryEvent{Type: HistoryStage, Stage: "ocr"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := worker.SetStatus(ctx, "job1", StatusFailed, "OCR error\ndetails"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := LoadHistory(ctx, store.client, "job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HistoryEvent{
+		{Type: HistorySubmitted, Actor: "tenant:acme", IP: "10.0.0.1"},
+		{Type: HistoryStatus, Status: StatusQueued, Actor: "api"},
+		{Type: HistoryStatus, Status: StatusProcessing, Actor: "worker:w1"},
+		{Type: HistoryStage, Stage: "ocr", Actor: "worker:w1"},
+		{Type: HistoryStatus, Status: StatusFailed, Actor: "worker:w1", Detail: "OCR error"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v, want %d events", history, len(want))
+	}
+	for i, event := range history {
+		if event.ID == "" || event.At.IsZero() {
+			t.Errorf("event %d has no ID or time: %+v", i, event)
+		}
+		event.ID, event.At = "", time.Time{}
+		if event != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, event, want[i])
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	if _, err := store.Wait(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("Wait(missing) = %v, want ErrNotFound", err)
+	}
+	store.SetStatus(ctx, "job1", StatusProcessing, "")
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := store.Wait(short, "job1"); err != context.DeadlineExceeded {
+		t.Fatalf("Wait(processing) = %v, want DeadlineExceeded", err)
+	}
+
+	done := make(chan *Result)
+	go func() {
+		job, err := store.Wait(ctx, "job1")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- job
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := store.SetStatus(ctx, "job1", StatusCompleted, "pdfs/job1.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case job := <-done:
+		if job == nil || job.Status != StatusCompleted || job.PDFPath != "pdfs/job1.pdf" {
+			t.Errorf("Wait = %+v", job)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the status change")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	store.SetStatus(ctx, "job1", StatusProcessing, "")
+
+	stages := make(chan string, 10)
+	done := make(chan *Result)
+	go func() {
+		job, err := store.Watch(ctx, "job1", func(job *Result) error {
+			stages <- job.Details["stage"]
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- job
+	}()
+	if stage := <-stages; stage != "" {
+		t.Fatalf("first progress in stage %q, want none", stage)
+	}
+	// A new stage wakes the watch well before waitPollInterval
+	store.SaveDetails(ctx, "job1", map[string]string{"stage": "ocr"})
+	if err := store.RecordHistory(ctx, "job1", HistoryEvent{Type: HistoryStage, Stage: "ocr"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case stage := <-stages:
+		if stage != "ocr" {
+			t.Errorf("progress in stage %q, want ocr", stage)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not report the stage change")
+	}
+	store.SetStatus(ctx, "job1", StatusFailed, "OCR error")
+	select {
+	case job := <-done:
+		if job == nil || job.Status != StatusFailed {
+			t.Errorf("Watch = %+v", job)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return after the job failed")
+	}
+
+	stop := errors.New("client gone")
+	store.SetStatus(ctx, "job2", StatusQueued, "")
+	if _, err := store.Watch(ctx, "job2", func(*Result) error { return stop }); err != stop {
+		t.Errorf("Watch stopped by progress = %v, want its error", err)
+	}
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RetentionIndexKey is a sorted set of job ID -> unix time at which the
+// janitor has artifacts or the upload of the finished job to delete
+const RetentionIndexKey = "jobs:retention"
+
+// RetentionKey holds the RetentionRecord of a job as JSON
+func RetentionKey(jobID string) string { return jobID + ":retention" }
+
+// ResultKeys are the suffixes of the Redis keys holding the results of a job
+// ("<jobID>:<suffix>": texts, regions, rendered outputs...). They are written
+// by the worker before the job finishes; once it finishes they expire with
+// its status, see Retention.
+var ResultKeys = []string{"ocr_text", "translated_text", "corrected_text", "summary", "barcodes", "regions", "ocr_hocr", "ocr_alto", "outputs", "message"}
+
+// Retention sets how long the data of a finished job is kept. A zero
+// duration keeps the default: the TTL of the store for the metadata, forever
+// for the artifacts and the upload.
+type Retention struct {
+	Completed time.Duration // Status, details and texts of a completed job
+	Failed    time.Duration // Status, details and texts of a failed job
+	Artifacts time.Duration // PDF, thumbnail and extra outputs in storage
+	Uploads   time.Duration // Uploaded input file
+}
+
+// retentionJSON is Retention with durations as strings ("720h")
+type retentionJSON struct {
+	Completed string `json:"completed,omitempty"`
+	Failed    string `json:"failed,omitempty"`
+	Artifacts string `json:"artifacts,omitempty"`
+	Uploads   string `json:"uploads,omitempty"`
+}
+
+func (r Retention) MarshalJSON() ([]byte, error) {
+	format := func(d time.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	return json.Marshal(retentionJSON{format(r.Completed), format(r.Failed), format(r.Artifacts), format(r.Uploads)})
+}
+
+func (r *Retention) UnmarshalJSON(data []byte) error {
+	var raw retentionJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for _, v := range []struct {
+		name  string
+		raw   string
+		value *time.Duration
+	}{{"completed", raw.Completed, &r.Completed}, {"failed", raw.Failed, &r.Failed}, {"artifacts", raw.Artifacts, &r.Artifacts}, {"uploads", raw.Uploads, &r.Uploads}} {
+		d, err := parseRetention(v.raw)
+		if err != nil {
+			return fmt.Errorf("retention %s: %w", v.name, err)
+		}
+		*v.value = d
+	}
+	return nil
+}
+
+func parseRetention(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("want a non-negative duration such as 720h, got %q", raw)
+	}
+	return d, nil
+}
+
+// RetentionFromEnv reads RETENTION_COMPLETED, RETENTION_FAILED,
+// RETENTION_ARTIFACTS and RETENTION_UPLOADS
+func RetentionFromEnv() (Retention, error) {
+	var r Retention
+	for _, v := range []struct {
+		name  string
+		value *time.Duration
+	}{{"RETENTION_COMPLETED", &r.Completed}, {"RETENTION_FAILED", &r.Failed}, {"RETENTION_ARTIFACTS", &r.Artifacts}, {"RETENTION_UPLOADS", &r.Uploads}} {
+		d, err := parseRetention(os.Getenv(v.name))
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", v.name, err)
+		}
+		*v.value = d
+	}
+	return r, nil
+}
+
+// Merge returns r with the non-zero durations of override
+func (r Retention) Merge(override Retention) Retention {
+	for _, v := range []struct{ dst, src *time.Duration }{
+		{&r.Completed, &override.Completed}, {&r.Failed, &override.Failed},
+		{&r.Artifacts, &override.Artifacts}, {&r.Uploads, &override.Uploads},
+	} {
+		if *v.src != 0 {
+			*v.dst = *v.src
+		}
+	}
+	return r
+}
+
+// Metadata returns how long the metadata of a job finished with status is
+// kept, defaultTTL when not set
+func (r Retention) Metadata(status string, defaultTTL time.Duration) time.Duration {
+	ttl := r.Completed
+	if status == StatusFailed {
+		ttl = r.Failed
+	}
+	if ttl == 0 {
+		return defaultTTL
+	}
+	return ttl
+}
+
+// RetentionRecord is the retention of one job, written at submission and
+// completed by the store when the job finishes
+type RetentionRecord struct {
+	Policy     Retention `json:"policy"`
+	UploadPath string    `json:"upload_path,omitempty"`
+	Status     string    `json:"status,omitempty"`      // Final status, set when the job finishes
+	FinishedAt time.Time `json:"finished_at,omitempty"` // Zero until the job finishes
+	// Set by the janitor once done
+	ArtifactsDeleted bool `json:"artifacts_deleted,omitempty"`
+	UploadDeleted    bool `json:"upload_deleted,omitempty"`
+}
+
+// NextDeletion returns when the janitor has something left to delete, zero
+// when nothing (unfinished job, or everything kept forever or deleted)
+func (r RetentionRecord) NextDeletion() time.Time {
+	if r.FinishedAt.IsZero() {
+		return time.Time{}
+	}
+	var next time.Time
+	for _, v := range []struct {
+		after time.Duration
+		done  bool
+	}{{r.Policy.Artifacts, r.ArtifactsDeleted}, {r.Policy.Uploads, r.UploadDeleted || r.UploadPath == ""}} {
+		if v.after > 0 && !v.done {
+			if at := r.FinishedAt.Add(v.after); next.IsZero() || at.Before(next) {
+				next = at
+			}
+		}
+	}
+	return next
+}
+
+// keepFor returns how long the record must be kept after the job finished:
+// until the metadata expires and the janitor is done
+func (r RetentionRecord) keepFor(metadataTTL time.Duration) time.Duration {
+	return max(metadataTTL, r.Policy.Artifacts, r.Policy.Uploads) + time.Hour
+}
+
+// SaveRetention stores the retention record of a job, expiring after ttl
+// (the record of an unfinished job must outlive the job); a negative ttl
+// keeps the current expiry
+func SaveRetention(ctx context.Context, client redis.Cmdable, jobID string, record RetentionRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		ttl = redis.KeepTTL
+	}
+	return client.Set(ctx, RetentionKey(jobID), data, ttl).Err()
+}
+
+// LoadRetention returns the retention record of a job, nil if it has none
+// (submitted without retention, or expired)
+func LoadRetention(ctx context.Context, client redis.Cmdable, jobID string) (*RetentionRecord, error) {
+	data, err := client.Get(ctx, RetentionKey(jobID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record RetentionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid retention record of job %s: %w", jobID, err)
+	}
+	return &record, nil
+}
+
+// IndexRetention stores the record of something finished outside the store,
+// such as the combined PDF of a batch, for as long as its metadata is kept
+// (metadataTTL), and indexes its next deletion for the janitor
+func IndexRetention(ctx context.Context, client redis.Cmdable, jobID string, record RetentionRecord, metadataTTL time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	pipe := client.TxPipeline()
+	pipe.Set(ctx, RetentionKey(jobID), data, record.keepFor(metadataTTL))
+	if next := record.NextDeletion(); !next.IsZero() {
+		pipe.ZAdd(ctx, RetentionIndexKey, &redis.Z{Score: float64(next.Unix()), Member: jobID})
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/events"
+)
+
+// HTTPTimeout bounds the requests of the channels
+const HTTPTimeout = 10 * time.Second
+
+// Colors of the severities in Slack attachments and Teams cards
+var severityColors = map[string]string{
+	SeverityInfo:     "#2E86DE",
+	SeverityWarning:  "#F39C12",
+	SeverityCritical: "#D0021B",
+}
+
+// heading is the first line of a chat message: "[CRITICAL] Worker crashed"
+func heading(n Notification) string {
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(n.Severity), n.Title)
+}
+
+// sortedFields returns the field names in a stable order
+func sortedFields(n Notification) []string {
+	names := make([]string, 0, len(n.Fields))
+	for name := range n.Fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// postJSON POSTs body to url and checks for a 2xx status
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SlackChannel posts to a Slack incoming webhook, the fields in a colored
+// attachment
+type SlackChannel struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// NewSlackChannel creates a channel posting to the incoming webhook url
+func NewSlackChannel(name, url string) *SlackChannel {
+	return &SlackChannel{name: name, url: url, client: &http.Client{Timeout: HTTPTimeout}}
+}
+
+func (c *SlackChannel) Name() string { return c.name }
+
+func (c *SlackChannel) Send(ctx context.Context, n Notification) error {
+	type field struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+	fields := []field{}
+	for _, name := range sortedFields(n) {
+		fields = append(fields, field{Title: name, Value: n.Fields[name], Short: len(n.Fields[name]) < 40})
+	}
+	body, err := json.Marshal(map[string]any{
+		"text": "*" + heading(n) + "*\n" + n.Text,
+		"attachments": []map[string]any{{
+			"color":  severityColors[n.Severity],
+			"fields": fields,
+			"ts":     n.OccurredAt.Unix(),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, c.client, c.url, body, nil)
+}
+
+// TeamsChannel posts a MessageCard to a Microsoft Teams incoming webhook, the
+// fields as facts
+type TeamsChannel struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// NewTeamsChannel creates a channel posting to the incoming webhook url
+func NewTeamsChannel(name, url string) *TeamsChannel {
+	return &TeamsChannel{name: name, url: url, client: &http.Client{Timeout: HTTPTimeout}}
+}
+
+func (c *TeamsChannel) Name() string { return c.name }
+
+func (c *TeamsChannel) Send(ctx context.Context, n Notification) error {
+	facts := []map[string]string{}
+	for _, name := range sortedFields(n) {
+		facts = append(facts, map[string]string{"name": name, "value": n.Fields[name]})
+	}
+	body, err := json.Marshal(map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    heading(n),
+		"themeColor": strings.TrimPrefix(severityColors[n.Severity], "#"),
+		"title":      heading(n),
+		"text":       n.Text,
+		"sections":   []map[string]any{{"facts": facts}},
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, c.client, c.url, body, nil)
+}
+
+// WebhookChannel POSTs the notification as JSON. When a secret is set, the
+// body is signed like the webhook event sink does (events.Sign), so receivers
+// verify both with the same code.
+type WebhookChannel struct {
+	name   string
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookChannel creates a channel posting to url
+func NewWebhookChannel(name, url, secret string) *WebhookChannel {
+	return &WebhookChannel{name: name, url: url, secret: secret, client: &http.Client{Timeout: HTTPTimeout}}
+}
+
+func (c *WebhookChannel) Name() string { return c.name }
+
+func (c *WebhookChannel) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("X-Notification-Type", n.Type)
+	events.Sign(header, c.secret, body)
+	return postJSON(ctx, c.client, c.url, body, header)
+}
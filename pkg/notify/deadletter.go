@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DeadLettersKey is a sorted set of job ID -> unix time at which the reaper
+// gave up on the job (failed after its last attempt)
+const DeadLettersKey = "notify:deadletters"
+
+// BacklogConfig sets when dead-lettered jobs are reported as a backlog
+type BacklogConfig struct {
+	Threshold int           // Dead-lettered jobs within Window that raise TypeDeadLetterBacklog
+	Window    time.Duration // Sliding window of the count, also the minimum time between two backlog notifications
+}
+
+// DefaultBacklogConfig reports 10 dead-lettered jobs within an hour
+func DefaultBacklogConfig() BacklogConfig {
+	return BacklogConfig{Threshold: 10, Window: time.Hour}
+}
+
+// BacklogConfigFromEnv reads DEADLETTER_ALERT_THRESHOLD and DEADLETTER_ALERT_WINDOW
+func BacklogConfigFromEnv() (BacklogConfig, error) {
+	config := DefaultBacklogConfig()
+	if raw := os.Getenv("DEADLETTER_ALERT_THRESHOLD"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("DEADLETTER_ALERT_THRESHOLD must be at least 1, got %q", raw)
+		}
+		config.Threshold = n
+	}
+	if raw := os.Getenv("DEADLETTER_ALERT_WINDOW"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("DEADLETTER_ALERT_WINDOW must be a positive duration such as 1h, got %q", raw)
+		}
+		config.Window = d
+	}
+	return config, nil
+}
+
+// RecordDeadLetters adds the jobs to DeadLettersKey and returns the number of
+// jobs dead-lettered within window, older entries being dropped
+func RecordDeadLetters(ctx context.Context, client redis.Cmdable, jobIDs []string, window time.Duration) (int64, error) {
+	now := time.Now()
+	pipe := client.TxPipeline()
+	for _, jobID := range jobIDs {
+		pipe.ZAdd(ctx, DeadLettersKey, &redis.Z{Score: float64(now.Unix()), Member: jobID})
+	}
+	pipe.ZRemRangeByScore(ctx, DeadLettersKey, "-inf", fmt.Sprintf("(%d", now.Add(-window).Unix()))
+	count := pipe.ZCard(ctx, DeadLettersKey)
+	pipe.Expire(ctx, DeadLettersKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
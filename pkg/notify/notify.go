@@ -0,0 +1,215 @@
+// Package notify announces job failures and system problems (dead-lettered
+// jobs piling up, crashed workers) to chat channels and webhooks, so
+// operators hear about them without watching the logs.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/events"
+)
+
+// Notification types
+const (
+	TypeJobFailed         = "job.failed"         // A job failed in a worker
+	TypeJobDeadLettered   = "job.dead_lettered"  // The reaper gave up on a job after its last attempt
+	TypeDeadLetterBacklog = "deadletter.backlog" // Too many jobs dead-lettered within the window
+	TypeWorkerCrashed     = "worker.crashed"     // A worker stopped sending heartbeats without deregistering
+	TypeWorkerStalled     = "worker.stalled"     // A job of a live worker is stuck in a stage
+)
+
+var types = []string{TypeJobFailed, TypeJobDeadLettered, TypeDeadLetterBacklog, TypeWorkerCrashed, TypeWorkerStalled}
+
+// Severities, in increasing order
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// Notification is one message sent to the channels
+type Notification struct {
+	Type       string            `json:"type"`
+	Severity   string            `json:"severity"`
+	Title      string            `json:"title"`
+	Text       string            `json:"text"`
+	Fields     map[string]string `json:"fields,omitempty"` // Job ID, worker, counts... shown as a table
+	OccurredAt time.Time         `json:"occurred_at"`
+}
+
+// New builds a notification occurring now
+func New(typ, severity, title, text string, fields map[string]string) Notification {
+	return Notification{Type: typ, Severity: severity, Title: title, Text: text, Fields: fields, OccurredAt: time.Now().UTC()}
+}
+
+// Channel delivers notifications to one destination
+type Channel interface {
+	// Name identifies the channel in logs
+	Name() string
+	// Send delivers one notification
+	Send(ctx context.Context, n Notification) error
+}
+
+// ChannelConfig declares one channel and the notifications routed to it.
+//
+// Example config file:
+//
+//	{
+//	  "channels": [
+//	    {"name": "ops", "type": "slack", "url": "${SLACK_WEBHOOK_URL}", "min_severity": "critical"},
+//	    {"name": "team", "type": "teams", "url": "${TEAMS_WEBHOOK_URL}",
+//	     "events": ["job.failed", "job.dead_lettered"]},
+//	    {"name": "pager", "type": "webhook", "url": "https://example.com/alerts", "secret": "${ALERT_SECRET}"}
+//	  ]
+//	}
+type ChannelConfig struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`         // slack, teams or webhook
+	URL         string   `json:"url"`          // Incoming webhook URL
+	Secret      string   `json:"secret"`       // webhook: HMAC-SHA256 key of the X-Signature-256 header
+	Events      []string `json:"events"`       // Notification types to route; empty means all
+	MinSeverity string   `json:"min_severity"` // Lowest severity routed, default info
+}
+
+// Config is the routing table of the notification channels
+type Config struct {
+	Channels []ChannelConfig `json:"channels"`
+}
+
+// LoadConfig reads a routing config from a JSON file like events.LoadConfig:
+// references of the form "${VAR}" are replaced with the environment variable
+// VAR, so webhook URLs (which are secrets) do not have to be stored in the
+// file.
+func LoadConfig(path string) (*Config, error) {
+	var cfg Config
+	if err := events.ReadConfig(path, "notification config", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// route is a channel with its filter
+type route struct {
+	channel     Channel
+	events      events.Filter
+	minSeverity int
+}
+
+func (r route) accepts(n Notification) bool {
+	return r.events.Accepts(n.Type) && slices.Index(severities, n.Severity) >= r.minSeverity
+}
+
+// Notifier sends notifications to every channel whose filter accepts them.
+// The zero Notifier has no channel and sends nothing.
+type Notifier struct {
+	routes []route
+}
+
+// NewNotifier builds the channels declared in cfg. A nil cfg gives a
+// notifier without channels.
+func NewNotifier(cfg *Config) (*Notifier, error) {
+	notifier := &Notifier{}
+	if cfg == nil {
+		return notifier, nil
+	}
+	names := map[string]bool{}
+	for i, cc := range cfg.Channels {
+		if cc.Name == "" {
+			cc.Name = fmt.Sprintf("%s-%d", cc.Type, i)
+		}
+		if names[cc.Name] {
+			return nil, fmt.Errorf("duplicate notification channel name %q", cc.Name)
+		}
+		names[cc.Name] = true
+		if cc.URL == "" {
+			return nil, fmt.Errorf("notification channel %s requires url", cc.Name)
+		}
+		var channel Channel
+		switch strings.ToLower(cc.Type) {
+		case "slack":
+			channel = NewSlackChannel(cc.Name, cc.URL)
+		case "teams":
+			channel = NewTeamsChannel(cc.Name, cc.URL)
+		case "webhook":
+			channel = NewWebhookChannel(cc.Name, cc.URL, cc.Secret)
+		default:
+			return nil, fmt.Errorf("notification channel %s: unknown type %q (want slack, teams or webhook)", cc.Name, cc.Type)
+		}
+		filter, err := events.NewFilter(cc.Events, types)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %s: %w", cc.Name, err)
+		}
+		rt := route{channel: channel, events: filter}
+		if cc.MinSeverity != "" {
+			if rt.minSeverity = slices.Index(severities, cc.MinSeverity); rt.minSeverity < 0 {
+				return nil, fmt.Errorf("notification channel %s: unknown severity %q (want info, warning or critical)", cc.Name, cc.MinSeverity)
+			}
+		}
+		notifier.routes = append(notifier.routes, rt)
+	}
+	return notifier, nil
+}
+
+// FromEnv builds the notifier of the config file named by NOTIFICATIONS,
+// without channels when it is not set
+func FromEnv() (*Notifier, error) {
+	path := os.Getenv("NOTIFICATIONS")
+	if path == "" {
+		return NewNotifier(nil)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewNotifier(cfg)
+}
+
+// Len returns the number of configured channels
+func (n *Notifier) Len() int { return len(n.routes) }
+
+// Notify sends the notification to every matching channel. Channel failures
+// are logged and do not stop delivery to the other channels; the number of
+// failed channels is returned in the error.
+func (n *Notifier) Notify(ctx context.Context, notification Notification) error {
+	failed := 0
+	for _, rt := range n.routes {
+		if !rt.accepts(notification) {
+			continue
+		}
+		if err := rt.channel.Send(ctx, notification); err != nil {
+			log.Printf("NOTIFY: Failed to send %s to channel %s: %v", notification.Type, rt.channel.Name(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d notification channel(s) failed", failed)
+	}
+	return nil
+}
+
+// NotifyOnce sends the notification unless one with the same key was sent
+// within ttl, by this process or another one sharing client (several API
+// replicas watch the same workers and dead letters)
+func (n *Notifier) NotifyOnce(ctx context.Context, client redis.Cmdable, key string, ttl time.Duration, notification Notification) error {
+	if n.Len() == 0 {
+		return nil
+	}
+	first, err := client.SetNX(ctx, "notify:sent:"+key, notification.OccurredAt.Unix(), ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !first {
+		return nil
+	}
+	return n.Notify(ctx, notification)
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNotifierRouting(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]string{} // path -> bodies
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], string(body))
+		if r.URL.Path == "/signed" {
+			signature = r.Header.Get("X-Signature-256")
+		}
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	notifier, err := NewNotifier(&Config{Channels: []ChannelConfig{
+		{Name: "ops", Type: "slack", URL: server.URL + "/slack", MinSeverity: SeverityCritical},
+		{Name: "team", Type: "teams", URL: server.URL + "/teams", Events: []string{TypeJobFailed}},
+		{Name: "all", Type: "webhook", URL: server.URL + "/webhook"},
+		{Name: "signed", Type: "webhook", URL: server.URL + "/signed", Secret: "s3cret", Events: []string{TypeWorkerCrashed}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	notifier.Notify(ctx, New(TypeJobFailed, SeverityWarning, "Job failed", "OCR error", map[string]string{"job_id": "j1"}))
+	notifier.Notify(ctx, New(TypeWorkerCrashed, SeverityCritical, "Worker crashed", "no heartbeat", nil))
+
+	if got := len(received["/slack"]); got != 1 || !strings.Contains(received["/slack"][0], "[CRITICAL] Worker crashed") {
+		t.Errorf("slack received %q, want the critical notification only", received["/slack"])
+	}
+	if got := len(received["/teams"]); got != 1 || !strings.Contains(received["/teams"][0], `"MessageCard"`) {
+		t.Errorf("teams received %q, want the job.failed card only", received["/teams"])
+	}
+	if got := len(received["/webhook"]); got != 2 {
+		t.Fatalf("webhook received %d notifications, want 2", got)
+	}
+	var n Notification
+	if err := json.Unmarshal([]byte(received["/webhook"][0]), &n); err != nil || n.Fields["job_id"] != "j1" {
+		t.Errorf("webhook body = %s (%v)", received["/webhook"][0], err)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(received["/signed"][0]))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("X-Signature-256 = %q, want %q", signature, want)
+	}
+}
+
+func TestNewNotifierErrors(t *testing.T) {
+	for _, cc := range []ChannelConfig{
+		{Type: "slack"},
+		{Type: "email", URL: "https://example.com"},
+		{Type: "slack", URL: "https://example.com", Events: []string{"job.done"}},
+		{Type: "slack", URL: "https://example.com", MinSeverity: "fatal"},
+	} {
+		if _, err := NewNotifier(&Config{Channels: []ChannelConfig{cc}}); err == nil {
+			t.Errorf("NewNotifier(%+v) succeeded, want an error", cc)
+		}
+	}
+}
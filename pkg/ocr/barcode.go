@@ -0,0 +1,138 @@
+package ocr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// Barcode is a barcode or QR code found in an image
+type Barcode struct {
+	Type   string   `json:"type"`  // Symbology reported by zbar: "QR-Code", "EAN-13", "CODE-128"...
+	Value  string   `json:"value"` // Decoded data
+	Frame  int      `json:"frame"` // Frame of multi-frame images, 0 otherwise
+	X      int      `json:"x"`     // Bounding box in pixels of the image, zero if unknown
+	Y      int      `json:"y"`
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+	Points [][2]int `json:"points,omitempty"` // Corners of the symbol as located by zbar
+}
+
+// zbarNoSymbols is the exit status of zbarimg when the image has no barcode
+const zbarNoSymbols = 4
+
+// CheckBarcodes checks that zbarimg, used by DetectBarcodes, is installed
+func CheckBarcodes() error {
+	if _, err := exec.LookPath("zbarimg"); err != nil {
+		return fmt.Errorf("zbarimg executable not found in PATH: %w", err)
+	}
+	return nil
+}
+
+// DetectBarcodes finds and decodes the barcodes and QR codes of the image
+// (every frame of multi-frame images) with zbarimg
+func DetectBarcodes(ctx context.Context, imagePath string) ([]Barcode, error) {
+	zbarPath, err := exec.LookPath("zbarimg")
+	if err != nil {
+		return nil, fmt.Errorf("zbarimg executable not found in PATH: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, zbarPath, "--xml", "-q", imagePath)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	usage.TrackProcess(ctx, cmd.ProcessState)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == zbarNoSymbols {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zbarimg failed: %w. Output: %s", err, stderr.String())
+	}
+	return ParseZbarXML(out)
+}
+
+// zbarDocument is the --xml output of zbarimg
+type zbarDocument struct {
+	Sources []struct {
+		Indexes []struct {
+			Num     int `xml:"num,attr"`
+			Symbols []struct {
+				Type    string `xml:"type,attr"`
+				Polygon struct {
+					Points string `xml:"points,attr"`
+				} `xml:"polygon"`
+				Data struct {
+					Format string `xml:"format,attr"`
+					Value  string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"symbol"`
+		} `xml:"index"`
+	} `xml:"source"`
+}
+
+// ParseZbarXML parses the --xml output of zbarimg. Binary data (format
+// "base64") is decoded; zbar versions without the polygon element give
+// barcodes without position.
+func ParseZbarXML(data []byte) ([]Barcode, error) {
+	var doc zbarDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid zbarimg output: %w", err)
+	}
+	var barcodes []Barcode
+	for _, source := range doc.Sources {
+		for _, index := range source.Indexes {
+			for _, symbol := range index.Symbols {
+				value := symbol.Data.Value
+				if symbol.Data.Format == "base64" {
+					decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+					if err != nil {
+						return nil, fmt.Errorf("invalid base64 data of %s barcode: %w", symbol.Type, err)
+					}
+					value = string(decoded)
+				}
+				barcode := Barcode{Type: symbol.Type, Value: value, Frame: index.Num}
+				barcode.Points = parsePolygon(symbol.Polygon.Points)
+				barcode.X, barcode.Y, barcode.Width, barcode.Height = boundingBox(barcode.Points)
+				barcodes = append(barcodes, barcode)
+			}
+		}
+	}
+	return barcodes, nil
+}
+
+// parsePolygon parses the points of a zbar polygon ("+24,24 +24,136 ...")
+func parsePolygon(points string) [][2]int {
+	var corners [][2]int
+	for _, point := range strings.Fields(points) {
+		xs, ys, ok := strings.Cut(strings.TrimPrefix(point, "+"), ",")
+		if !ok {
+			continue
+		}
+		x, errX := strconv.Atoi(xs)
+		y, errY := strconv.Atoi(strings.TrimPrefix(ys, "+"))
+		if errX == nil && errY == nil {
+			corners = append(corners, [2]int{x, y})
+		}
+	}
+	return corners
+}
+
+// boundingBox returns the rectangle enclosing points
+func boundingBox(points [][2]int) (x, y, width, height int) {
+	if len(points) == 0 {
+		return 0, 0, 0, 0
+	}
+	minX, minY, maxX, maxY := points[0][0], points[0][1], points[0][0], points[0][1]
+	for _, p := range points[1:] {
+		minX, maxX = min(minX, p[0]), max(maxX, p[0])
+		minY, maxY = min(minY, p[1]), max(maxY, p[1])
+	}
+	return minX, minY, maxX - minX, maxY - minY
+}
@@ -0,0 +1,72 @@
+package ocr
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseZbarXML(t *testing.T) {
+	// zbarimg 0.23 --xml of a two-page TIFF: a URL and an EAN-13 on the
+	// first page, binary data (base64, wrapped at 76 characters) on the second
+	data, err := os.ReadFile("testdata/zbarimg.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	barcodes, err := ParseZbarXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := "\x00\x01\x02\x03\xff\xfehóa đơn VAT 0123456789 "
+	for b := 0x80; b < 0x9e; b++ {
+		binary += string([]byte{byte(b)})
+	}
+	want := []Barcode{
+		{Type: "QR-Code", Value: "https://example.com/invoice/INV-2024-0042?total=1.250.000&currency=VND",
+			X: 24, Y: 24, Width: 112, Height: 112, Points: [][2]int{{24, 24}, {24, 136}, {136, 136}, {136, 24}}},
+		{Type: "EAN-13", Value: "8934563138165",
+			X: 210, Y: 398, Width: 108, Height: 54, Points: [][2]int{{210, 400}, {212, 452}, {318, 450}, {316, 398}}},
+		{Type: "QR-Code", Value: binary, Frame: 1,
+			X: 300, Y: 40, Width: 112, Height: 112, Points: [][2]int{{300, 40}, {412, 40}, {412, 152}, {300, 152}}},
+	}
+	if !reflect.DeepEqual(barcodes, want) {
+		t.Errorf("barcodes =\n%+v\nwant\n%+v", barcodes, want)
+	}
+}
+
+func TestParseZbarXMLErrors(t *testing.T) {
+	// zbar before 0.23: no polygon, no namespace
+	old := `<barcodes><source href='a.png'><index num='0'><symbol type='CODE-128' quality='1'><data><![CDATA[A-42]]></data></symbol></index></source></barcodes>`
+	barcodes, err := ParseZbarXML([]byte(old))
+	if err != nil || !reflect.DeepEqual(barcodes, []Barcode{{Type: "CODE-128", Value: "A-42"}}) {
+		t.Errorf("ParseZbarXML without polygon = %+v, %v", barcodes, err)
+	}
+	if barcodes, err := ParseZbarXML([]byte(`<barcodes xmlns='http://zbar.sourceforge.net/2008/barcode'></barcodes>`)); err != nil || barcodes != nil {
+		t.Errorf("ParseZbarXML without symbols = %+v, %v", barcodes, err)
+	}
+	bad := `<barcodes><source><index num='0'><symbol type='QR-Code'><data format='base64'><![CDATA[not base64!]]></data></symbol></index></source></barcodes>`
+	if _, err := ParseZbarXML([]byte(bad)); err == nil || !strings.Contains(err.Error(), "invalid base64 data of QR-Code barcode") {
+		t.Errorf("ParseZbarXML of invalid base64 = %v", err)
+	}
+	if _, err := ParseZbarXML([]byte("zbarimg: unable to open")); err == nil || !strings.Contains(err.Error(), "invalid zbarimg output") {
+		t.Errorf("ParseZbarXML of text = %v", err)
+	}
+}
+
+func TestParsePolygon(t *testing.T) {
+	tests := []struct {
+		points string
+		want   [][2]int
+	}{
+		{"+24,24 +24,136 +136,136 +136,24", [][2]int{{24, 24}, {24, 136}, {136, 136}, {136, 24}}},
+		{"24,24 -3,+7", [][2]int{{24, 24}, {-3, 7}}}, // Off the image after rotation
+		{"+1,2 garbage +3 +x,4 +5,6", [][2]int{{1, 2}, {5, 6}}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parsePolygon(tt.points); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePolygon(%q) = %v, want %v", tt.points, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package ocr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Config tunes the recognition of one document type: receipts, single
+// lines, sparse text or forms need another page segmentation than the
+// default one of Tesseract. Its fields match messaging.OCRConfig, which
+// converts to it.
+type Config struct {
+	PSM       int               `json:"psm,omitempty"`       // Page segmentation mode (--psm), 0: engine default
+	OEM       *int              `json:"oem,omitempty"`       // OCR engine mode (--oem), nil: engine default
+	Whitelist string            `json:"whitelist,omitempty"` // Only characters recognized (tessedit_char_whitelist)
+	Blacklist string            `json:"blacklist,omitempty"` // Characters never recognized (tessedit_char_blacklist)
+	Variables map[string]string `json:"variables,omitempty"` // Other Tesseract variables (-c name=value)
+}
+
+// ConfigurableEngine is an Engine whose recognition can be tuned per image
+type ConfigurableEngine interface {
+	Engine
+	// WithConfig returns the engine recognizing images with config. The
+	// returned engine shares the resources (processes, connections) of e.
+	WithConfig(config Config) Engine
+}
+
+// ErrConfigUnsupported is returned by WithConfig for engines that cannot be
+// tuned
+var ErrConfigUnsupported = errors.New("OCR configuration is not supported by this engine")
+
+// WithConfig returns engine tuned by config, or engine itself for the zero
+// Config
+func WithConfig(engine Engine, config Config) (Engine, error) {
+	if config.IsZero() {
+		return engine, nil
+	}
+	configurable, ok := engine.(ConfigurableEngine)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConfigUnsupported, engine.Name())
+	}
+	return configurable.WithConfig(config), nil
+}
+
+// variablePattern matches the name of a Tesseract variable
+var variablePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// allowedVariables are the Tesseract variables a Config may set: they only
+// tune the recognition. Tesseract has hundreds of variables, some naming
+// files to read or write (word lists, debug output) or changing the output
+// format, so unknown ones are refused rather than filtered.
+var allowedVariables = map[string]bool{
+	// Layout and spacing
+	"preserve_interword_spaces":      true,
+	"textord_heavy_nr":               true,
+	"textord_min_linesize":           true,
+	"textord_min_xheight":            true,
+	"textord_space_size_is_variable": true,
+	"textord_tabfind_find_tables":    true,
+	"textord_tabfind_vertical_text":  true,
+	"textord_really_old_xheight":     true,
+	"paragraph_text_based":           true,
+	"user_defined_dpi":               true,
+	// Binarization (Tesseract 5)
+	"thresholding_method":             true,
+	"thresholding_window_size":        true,
+	"thresholding_kfactor":            true,
+	"thresholding_tile_size":          true,
+	"thresholding_smooth_kernel_size": true,
+	"thresholding_score_fraction":     true,
+	"tessedit_do_invert":              true,
+	"invert_threshold":                true,
+	// Dictionaries and language model
+	"load_system_dawg":                          true,
+	"load_freq_dawg":                            true,
+	"load_number_dawg":                          true,
+	"load_punc_dawg":                            true,
+	"tessedit_enable_dict_correction":           true,
+	"language_model_penalty_non_dict_word":      true,
+	"language_model_penalty_non_freq_dict_word": true,
+	"segment_penalty_dict_nonword":              true,
+	// Characters
+	"classify_bln_numeric_mode": true,
+	"tessedit_char_unblacklist": true,
+	"min_characters_to_try":     true,
+	"classify_enable_learning":  true,
+	"chop_enable":               true,
+}
+
+// Limits of a Config
+const (
+	maxConfigVariables = 32
+	maxConfigValueLen  = 256
+)
+
+// IsZero reports whether c keeps every default of the engine
+func (c Config) IsZero() bool {
+	return c.PSM == 0 && c.OEM == nil && c.Whitelist == "" && c.Blacklist == "" && len(c.Variables) == 0
+}
+
+// Validate checks the modes and variables. Only the variables tuning the
+// recognition are accepted (see allowedVariables): others name files (debug
+// output, word lists) a caller could read or write on the worker, or change
+// what tesseract outputs.
+func (c Config) Validate() error {
+	// 0 only runs orientation detection and 2 is not implemented by Tesseract
+	if c.PSM != 0 && (c.PSM < 1 || c.PSM == 2 || c.PSM > 13) {
+		return fmt.Errorf("psm must be 1 or between 3 and 13")
+	}
+	if c.OEM != nil && (*c.OEM < 0 || *c.OEM > 3) {
+		return fmt.Errorf("oem must be between 0 and 3")
+	}
+	for _, chars := range []string{c.Whitelist, c.Blacklist} {
+		if len(chars) > maxConfigValueLen || strings.ContainsAny(chars, "\n\r\x00") {
+			return fmt.Errorf("whitelist and blacklist must be at most %d characters on one line", maxConfigValueLen)
+		}
+	}
+	if len(c.Variables) > maxConfigVariables {
+		return fmt.Errorf("at most %d variables are allowed", maxConfigVariables)
+	}
+	for name, value := range c.Variables {
+		if !variablePattern.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		if name == "tessedit_char_whitelist" || name == "tessedit_char_blacklist" {
+			return fmt.Errorf("variable %s is set with whitelist or blacklist", name)
+		}
+		if !allowedVariables[name] {
+			return fmt.Errorf("variable %s is not allowed", name)
+		}
+		if len(value) > maxConfigValueLen || strings.ContainsAny(value, "\n\r\x00") {
+			return fmt.Errorf("variable %s: value must be at most %d characters on one line", name, maxConfigValueLen)
+		}
+	}
+	return nil
+}
+
+// variables returns every Tesseract variable set by c, sorted by name
+func (c Config) variables() [][2]string {
+	var vars [][2]string
+	if c.Whitelist != "" {
+		vars = append(vars, [2]string{"tessedit_char_whitelist", c.Whitelist})
+	}
+	if c.Blacklist != "" {
+		vars = append(vars, [2]string{"tessedit_char_blacklist", c.Blacklist})
+	}
+	for name, value := range c.Variables {
+		vars = append(vars, [2]string{name, value})
+	}
+	slices.SortFunc(vars, func(a, b [2]string) int { return strings.Compare(a[0], b[0]) })
+	return vars
+}
+
+// args returns the options of the tesseract command line
+func (c Config) args() []string {
+	var args []string
+	if c.PSM != 0 {
+		args = append(args, "--psm", strconv.Itoa(c.PSM))
+	}
+	if c.OEM != nil {
+		args = append(args, "--oem", strconv.Itoa(*c.OEM))
+	}
+	for _, v := range c.variables() {
+		args = append(args, "-c", v[0]+"="+v[1])
+	}
+	return args
+}
+
+// String describes c in the tesseract option syntax, "" for the zero Config
+func (c Config) String() string {
+	return strings.Join(c.args(), " ")
+}
@@ -0,0 +1,74 @@
+package ocr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	oem := func(n int) *int { return &n }
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string // Empty: valid
+	}{
+		{"zero", Config{}, ""},
+		{"modes", Config{PSM: 6, OEM: oem(1)}, ""},
+		{"characters", Config{Whitelist: "0123456789.,", Blacklist: "|"}, ""},
+		{"allowed variables", Config{Variables: map[string]string{"preserve_interword_spaces": "1", "load_system_dawg": "0", "user_defined_dpi": "300"}}, ""},
+		{"psm 0", Config{PSM: 0}, ""},
+		{"psm 2", Config{PSM: 2}, "psm must be"},
+		{"psm 14", Config{PSM: 14}, "psm must be"},
+		{"negative psm", Config{PSM: -1}, "psm must be"},
+		{"oem 4", Config{OEM: oem(4)}, "oem must be"},
+		{"multiline whitelist", Config{Whitelist: "0\n1"}, "on one line"},
+		{"long blacklist", Config{Blacklist: strings.Repeat("x", maxConfigValueLen+1)}, "at most 256 characters"},
+		{"file variable", Config{Variables: map[string]string{"user_words_file": "/etc/passwd"}}, "variable user_words_file is not allowed"},
+		{"debug variable", Config{Variables: map[string]string{"debug_file": "/tmp/out"}}, "is not allowed"},
+		{"output variable", Config{Variables: map[string]string{"tessedit_create_hocr": "1"}}, "is not allowed"},
+		{"write variable", Config{Variables: map[string]string{"tessedit_write_images": "1"}}, "is not allowed"},
+		// Names a file without "file" in its name
+		{"patterns file", Config{Variables: map[string]string{"user_patterns_suffix": "../../tmp/x"}}, "is not allowed"},
+		{"unknown variable", Config{Variables: map[string]string{"no_such_variable": "1"}}, "is not allowed"},
+		{"whitelist variable", Config{Variables: map[string]string{"tessedit_char_whitelist": "0"}}, "set with whitelist or blacklist"},
+		{"invalid name", Config{Variables: map[string]string{"Preserve-Spaces": "1"}}, "invalid variable name"},
+		{"multiline value", Config{Variables: map[string]string{"preserve_interword_spaces": "1\n-c debug_file=/x"}}, "on one line"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	many := Config{Variables: map[string]string{}}
+	for i := range maxConfigVariables + 1 {
+		many.Variables[fmt.Sprintf("v%d", i)] = "1"
+	}
+	if err := many.Validate(); err == nil || !strings.Contains(err.Error(), "at most 32 variables") {
+		t.Errorf("Validate of %d variables = %v", len(many.Variables), err)
+	}
+	for name := range allowedVariables {
+		if !variablePattern.MatchString(name) {
+			t.Errorf("allowed variable %q does not match the variable pattern", name)
+		}
+	}
+}
+
+func TestConfigString(t *testing.T) {
+	oem := 1
+	c := Config{PSM: 6, OEM: &oem, Whitelist: "0123456789", Variables: map[string]string{"preserve_interword_spaces": "1", "load_system_dawg": "0"}}
+	want := "--psm 6 --oem 1 -c load_system_dawg=0 -c preserve_interword_spaces=1 -c tessedit_char_whitelist=0123456789"
+	if got := c.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if got := (Config{}).String(); got != "" {
+		t.Errorf("String of the zero Config = %q", got)
+	}
+}
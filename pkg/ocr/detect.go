@@ -0,0 +1,244 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// Detection is the result of the language detection pass
+type Detection struct {
+	Script           string   // Script reported by OSD, e.g. "Latin", "Han", "Arabic"
+	ScriptConfidence float64  // OSD script confidence (higher is better)
+	Orientation      int      // Page rotation in degrees reported by OSD
+	Rotate           int      // Clockwise rotation in degrees that makes the page upright
+	Traineddata      []string // Traineddata used for the main OCR run, e.g. ["jpn", "eng"]
+	Language         string   // ISO 639-1 language of the document, "" if unknown
+}
+
+// LanguageEngine is an Engine that can detect the language of an image
+// before recognizing it
+type LanguageEngine interface {
+	Engine
+	// DetectLanguage runs a fast detection pass (script and orientation)
+	DetectLanguage(ctx context.Context, imagePath string) (*Detection, error)
+	// HasLanguage reports whether traineddata is installed
+	HasLanguage(traineddata string) bool
+	// ImageToTextWithLanguages recognizes the image with the given traineddata
+	ImageToTextWithLanguages(ctx context.Context, imagePath string, langs []string) (string, error)
+}
+
+// scriptTraineddata lists the traineddata to try for each OSD script, in
+// order of preference. Latin is decided from the recognized text instead.
+var scriptTraineddata = map[string][]string{
+	"Han":        {"chi_sim", "chi_tra"},
+	"Japanese":   {"jpn"},
+	"Katakana":   {"jpn"},
+	"Hiragana":   {"jpn"},
+	"Hangul":     {"kor"},
+	"Arabic":     {"ara", "fas"},
+	"Cyrillic":   {"rus", "ukr"},
+	"Devanagari": {"hin"},
+	"Hebrew":     {"heb"},
+	"Greek":      {"ell"},
+	"Thai":       {"tha"},
+}
+
+// traineddataLanguage maps traineddata names to ISO 639-1 codes
+var traineddataLanguage = map[string]string{
+	"eng": "en", "fra": "fr", "deu": "de", "spa": "es", "ita": "it", "por": "pt", "nld": "nl", "vie": "vi",
+	"chi_sim": "zh-CN", "chi_tra": "zh-TW", "jpn": "ja", "kor": "ko", "ara": "ar", "fas": "fa",
+	"rus": "ru", "ukr": "uk", "hin": "hi", "heb": "he", "ell": "el", "tha": "th",
+}
+
+// languageTraineddata is the reverse of traineddataLanguage
+var languageTraineddata = func() map[string]string {
+	m := make(map[string]string, len(traineddataLanguage))
+	for data, lang := range traineddataLanguage {
+		m[lang] = data
+	}
+	return m
+}()
+
+// DetectLanguage implements LanguageEngine with Tesseract orientation and
+// script detection (--psm 0, needs osd.traineddata)
+func (e *TesseractEngine) DetectLanguage(ctx context.Context, imagePath string) (*Detection, error) {
+	tesseractPath, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, fmt.Errorf("tesseract executable not found in PATH: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, tesseractPath, imagePath, "stdout", "--psm", "0")
+	out, err := cmd.CombinedOutput()
+	usage.TrackProcess(ctx, cmd.ProcessState)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract OSD failed: %w. Output: %s", err, string(out))
+	}
+	det, err := parseOSD(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, data := range scriptTraineddata[det.Script] {
+		if e.HasLanguage(data) {
+			det.Traineddata = []string{data}
+			det.Language = traineddataLanguage[data]
+			break
+		}
+	}
+	if len(det.Traineddata) > 0 && e.HasLanguage("eng") {
+		// Documents in other scripts often contain English words and numbers
+		det.Traineddata = append(det.Traineddata, "eng")
+	}
+	return det, nil
+}
+
+// parseOSD parses the output of tesseract --psm 0
+func parseOSD(output string) (*Detection, error) {
+	det := &Detection{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Script":
+			det.Script = value
+		case "Script confidence":
+			det.ScriptConfidence, _ = strconv.ParseFloat(value, 64)
+		case "Orientation in degrees":
+			det.Orientation, _ = strconv.Atoi(value)
+		case "Rotate":
+			det.Rotate, _ = strconv.Atoi(value)
+		}
+	}
+	if det.Script == "" {
+		return nil, fmt.Errorf("tesseract OSD did not report a script")
+	}
+	return det, nil
+}
+
+// HasLanguage implements LanguageEngine. The installed languages are known
+// after Prewarm; before that every language is assumed to be missing.
+func (e *TesseractEngine) HasLanguage(traineddata string) bool {
+	return e.installed[traineddata]
+}
+
+// DetectAndRecognize runs the detection pass of engine (if it supports one),
+// recognizes the image with the traineddata of the detected script and
+// identifies the language of the text. A failed detection pass falls back to
+// the default recognition, since OSD needs a fair amount of text to work.
+// osd is the result of an earlier detection pass on the same page (e.g. the
+// one that corrected its orientation), nil to run it.
+func DetectAndRecognize(ctx context.Context, engine Engine, imagePath string, osd *Detection) (string, *Detection, error) {
+	return detectAndRun(ctx, engine, imagePath, osd, func(langs []string) (string, error) {
+		if langEngine, ok := engine.(LanguageEngine); ok {
+			return langEngine.ImageToTextWithLanguages(ctx, imagePath, langs)
+		}
+		return engine.ImageToText(ctx, imagePath)
+	})
+}
+
+// detectAndRun implements DetectAndRecognize with recognize as the
+// recognition pass (langs nil: engine default), which returns the text
+func detectAndRun(ctx context.Context, engine Engine, imagePath string, osd *Detection, recognize func(langs []string) (string, error)) (string, *Detection, error) {
+	langEngine, ok := engine.(LanguageEngine)
+	if !ok {
+		text, err := recognize(nil)
+		if err != nil {
+			return "", nil, err
+		}
+		lang, _ := DetectTextLanguage(text)
+		return text, &Detection{Language: lang}, nil
+	}
+
+	var det *Detection
+	var err error
+	if osd != nil {
+		// Copy: the language found in the text is set below
+		d := *osd
+		det = &d
+	} else if det, err = langEngine.DetectLanguage(ctx, imagePath); err != nil {
+		log.Printf("OCR: Language detection failed for %s, using default languages: %v", imagePath, err)
+		det = &Detection{}
+	}
+	text, err := recognize(det.Traineddata)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(det.Traineddata) > 0 {
+		return text, det, nil
+	}
+
+	// Latin script (or unknown): the language is identified from the text and
+	// the image recognized again if its traineddata is installed
+	lang, _ := DetectTextLanguage(text)
+	det.Language = lang
+	if data := languageTraineddata[lang]; data != "" && data != "eng" && langEngine.HasLanguage(data) {
+		det.Traineddata = []string{data}
+		refined, err := recognize(det.Traineddata)
+		if err != nil {
+			return "", nil, err
+		}
+		text = refined
+	}
+	return text, det, nil
+}
+
+// stopwords are frequent words used to tell Latin-script languages apart
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "for", "it", "with", "as", "was", "on", "are", "this", "be", "by"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "du", "que", "dans", "pour", "pas", "sur", "qui", "au", "avec"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "von", "sich", "auf", "für", "dem"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "las", "del", "se", "por", "un", "una", "con", "para", "es"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "sono", "del", "della", "con", "gli", "le", "è"},
+	"pt": {"de", "que", "não", "o", "a", "os", "as", "do", "da", "em", "um", "uma", "para", "com", "é", "no"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor", "met", "die", "in"},
+	"vi": {"và", "của", "là", "không", "có", "được", "những", "trong", "cho", "với", "các", "này", "một", "người", "đã"},
+}
+
+// stopwordIndex maps each stopword to the languages it belongs to
+var stopwordIndex = func() map[string][]string {
+	index := map[string][]string{}
+	for lang, words := range stopwords {
+		for _, w := range words {
+			index[w] = append(index[w], lang)
+		}
+	}
+	return index
+}()
+
+// minStopwords is the number of stopword hits needed to name a language
+const minStopwords = 3
+
+// DetectTextLanguage identifies the language of Latin-script text from its
+// stopwords. It returns "" when the text is too short to decide. The
+// confidence is the share of stopword hits of the chosen language.
+func DetectTextLanguage(text string) (string, float64) {
+	scores := map[string]int{}
+	total := 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for _, lang := range stopwordIndex[word] {
+			scores[lang]++
+			total++
+		}
+	}
+	best, bestScore := "", 0
+	for lang, score := range scores {
+		if score > bestScore || (score == bestScore && lang < best) {
+			best, bestScore = lang, score
+		}
+	}
+	if bestScore < minStopwords {
+		return "", 0
+	}
+	return best, float64(bestScore) / float64(total)
+}
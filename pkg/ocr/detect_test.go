@@ -0,0 +1,166 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOSD(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    *Detection
+		wantErr bool
+	}{
+		{
+			name: "upright latin",
+			output: "Estimating resolution as 300\nPage number: 0\nOrientation in degrees: 0\nRotate: 0\n" +
+				"Orientation confidence: 11.34\nScript: Latin\nScript confidence: 2.50\n",
+			want: &Detection{Script: "Latin", ScriptConfidence: 2.5},
+		},
+		{
+			name: "rotated han",
+			output: "Page number: 0\nOrientation in degrees: 270\nRotate: 90\nOrientation confidence: 3.02\n" +
+				"Script: Han\nScript confidence: 0.83\n",
+			want: &Detection{Script: "Han", ScriptConfidence: 0.83, Orientation: 270, Rotate: 90},
+		},
+		{
+			name:   "windows line endings",
+			output: "Orientation in degrees: 180\r\nRotate: 180\r\nScript: Cyrillic\r\nScript confidence: 4.1\r\n",
+			want:   &Detection{Script: "Cyrillic", ScriptConfidence: 4.1, Orientation: 180, Rotate: 180},
+		},
+		{
+			name:   "invalid numbers",
+			output: "Orientation in degrees: ?\nScript: Arabic\nScript confidence: nan%\n",
+			want:   &Detection{Script: "Arabic"},
+		},
+		{
+			name:    "too few characters",
+			output:  "Estimating resolution as 142\nToo few characters. Skipping this page\nError during processing.\n",
+			wantErr: true,
+		},
+		{name: "empty", output: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOSD(tt.output)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "did not report a script") {
+					t.Errorf("parseOSD = %+v, %v; want an error", got, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOSD = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectTextLanguage(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		want       string
+		confidence float64
+	}{
+		{"english", "The invoice is due by the end of the month and it was paid.", "en", 9.0 / 10},
+		{"vietnamese", "Hóa đơn này đã được thanh toán cho người bán", "vi", 1},
+		{"german", "Der Vertrag ist nicht mit dem Kunden", "de", 1},
+		{"spanish over shared words", "El pago de la factura que vence", "es", 4.0 / 10},
+		{"apostrophes kept in words", "L'homme est dans la maison et les enfants", "fr", 5.0 / 7},
+		{"uppercase", "THE TOTAL OF THE INVOICE IS PAID", "en", 4.0 / 5},
+		{"tie broken by code", "la la la", "es", 3.0 / 9},
+		{"two stopwords", "the invoice and receipt", "", 0},
+		{"no stopwords", "INV-2024-0042 1.250.000 VND", "", 0},
+		{"empty", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, confidence := DetectTextLanguage(tt.text)
+			if got != tt.want || confidence != tt.confidence {
+				t.Errorf("DetectTextLanguage = %q, %.3f; want %q, %.3f", got, confidence, tt.want, tt.confidence)
+			}
+		})
+	}
+}
+
+// languageEngine is a LanguageEngine with a fixed detection result and the
+// traineddata in installed
+type languageEngine struct {
+	fakeEngine
+	det       *Detection
+	err       error
+	installed []string
+}
+
+func (e languageEngine) DetectLanguage(context.Context, string) (*Detection, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	det := *e.det
+	return &det, nil
+}
+
+func (e languageEngine) HasLanguage(traineddata string) bool {
+	for _, data := range e.installed {
+		if data == traineddata {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDetectAndRun(t *testing.T) {
+	french := "Le montant de la facture est payé dans les délais"
+	tests := []struct {
+		name     string
+		engine   Engine
+		osd      *Detection
+		wantRuns [][]string // Traineddata of each recognition pass
+		wantLang string
+	}{
+		{"no detection pass", fakeEngine{}, nil, [][]string{nil}, "fr"},
+		{"script detected", languageEngine{det: &Detection{Script: "Han", Traineddata: []string{"chi_sim", "eng"}, Language: "zh-CN"}}, nil,
+			[][]string{{"chi_sim", "eng"}}, "zh-CN"},
+		{"latin refined", languageEngine{det: &Detection{Script: "Latin"}, installed: []string{"eng", "fra"}}, nil,
+			[][]string{nil, {"fra"}}, "fr"},
+		{"latin without traineddata", languageEngine{det: &Detection{Script: "Latin"}, installed: []string{"eng"}}, nil,
+			[][]string{nil}, "fr"},
+		{"failed detection", languageEngine{err: errors.New("too few characters"), installed: []string{"fra"}}, nil,
+			[][]string{nil, {"fra"}}, "fr"},
+		{"earlier detection reused", languageEngine{err: errors.New("not run again")},
+			&Detection{Script: "Han", Rotate: 90, Traineddata: []string{"chi_sim", "eng"}, Language: "zh-CN"},
+			[][]string{{"chi_sim", "eng"}}, "zh-CN"},
+		{"earlier latin detection", languageEngine{err: errors.New("not run again"), installed: []string{"fra"}},
+			&Detection{Script: "Latin"}, [][]string{nil, {"fra"}}, "fr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs [][]string
+			text, det, err := detectAndRun(context.Background(), tt.engine, "page.png", tt.osd, func(langs []string) (string, error) {
+				runs = append(runs, langs)
+				return french, nil
+			})
+			if err != nil || text != french {
+				t.Fatalf("detectAndRun = %q, %v", text, err)
+			}
+			if !reflect.DeepEqual(runs, tt.wantRuns) || det.Language != tt.wantLang {
+				t.Errorf("recognized with %q, language %q; want %q, %q", runs, det.Language, tt.wantRuns, tt.wantLang)
+			}
+			if tt.osd != nil && det == tt.osd {
+				t.Error("earlier detection returned, not a copy")
+			}
+		})
+	}
+
+	engine := languageEngine{det: &Detection{Script: "Latin"}}
+	if _, _, err := detectAndRun(context.Background(), engine, "page.png", nil, func([]string) (string, error) {
+		return "", errors.New("tesseract failed")
+	}); err == nil {
+		t.Error("detectAndRun ignored a recognition error")
+	}
+}
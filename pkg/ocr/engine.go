@@ -0,0 +1,191 @@
+package ocr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Engine is an OCR backend (local Tesseract or a remote service)
+type Engine interface {
+	// Name identifies the engine in logs and job details
+	Name() string
+	// ImageToText extracts the text of the image. Remote engines abort the
+	// request when ctx is cancelled.
+	ImageToText(ctx context.Context, imagePath string) (string, error)
+	// Prewarm validates the configuration and returns the engine capabilities.
+	// It is called once at startup so misconfiguration surfaces before the first job.
+	Prewarm(ctx context.Context) (*Capabilities, error)
+}
+
+// Capabilities describes what an engine supports
+type Capabilities struct {
+	Engine        string    `json:"engine"`
+	Version       string    `json:"version,omitempty"`
+	Languages     []string  `json:"languages"`
+	MaxImageBytes int64     `json:"max_image_bytes,omitempty"` // 0: no known limit
+	FetchedAt     time.Time `json:"fetched_at"`
+}
+
+// SupportsLanguage reports whether lang is one of the engine languages
+func (c *Capabilities) SupportsLanguage(lang string) bool {
+	for _, l := range c.Languages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireLanguages returns an error listing the languages the engine lacks
+func (c *Capabilities) RequireLanguages(langs ...string) error {
+	var missing []string
+	for _, lang := range langs {
+		if !c.SupportsLanguage(lang) {
+			missing = append(missing, lang)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s engine does not support languages %s (available: %s)",
+			c.Engine, strings.Join(missing, ", "), strings.Join(c.Languages, ", "))
+	}
+	return nil
+}
+
+// CapabilityCache stores engine capabilities on disk so restarts do not
+// query the provider again while the cached entry is fresh
+type CapabilityCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+func (c CapabilityCache) path(key string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == ':' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, key)
+	return filepath.Join(c.Dir, "ocr-capabilities-"+safe+".json")
+}
+
+// Load returns the cached capabilities for key, or nil if missing or expired
+func (c CapabilityCache) Load(key string) *Capabilities {
+	if c.Dir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	var caps Capabilities
+	if err := json.Unmarshal(data, &caps); err != nil {
+		return nil
+	}
+	if c.TTL > 0 && time.Since(caps.FetchedAt) > c.TTL {
+		return nil
+	}
+	return &caps
+}
+
+// Store writes the capabilities for key to the cache directory
+func (c CapabilityCache) Store(key string, caps *Capabilities) error {
+	if c.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(caps, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(key), data, 0644)
+}
+
+// TesseractEngine runs the local tesseract executable
+type TesseractEngine struct {
+	Languages []string // Languages passed with -l, default "eng"
+	Config    Config   // Page segmentation, engine mode and variables
+
+	installed map[string]bool // Installed traineddata, set by Prewarm
+}
+
+// Name implements Engine
+func (e *TesseractEngine) Name() string { return "tesseract" }
+
+// ImageToText implements Engine
+func (e *TesseractEngine) ImageToText(ctx context.Context, imagePath string) (string, error) {
+	lang := "eng"
+	if len(e.Languages) > 0 {
+		lang = strings.Join(e.Languages, "+")
+	}
+	return imageToText(ctx, imagePath, lang, e.Config)
+}
+
+// ImageToTextWithLanguages implements LanguageEngine
+func (e *TesseractEngine) ImageToTextWithLanguages(ctx context.Context, imagePath string, langs []string) (string, error) {
+	if len(langs) == 0 {
+		return e.ImageToText(ctx, imagePath)
+	}
+	return imageToText(ctx, imagePath, strings.Join(langs, "+"), e.Config)
+}
+
+// WithConfig implements ConfigurableEngine
+func (e *TesseractEngine) WithConfig(config Config) Engine {
+	configured := *e
+	configured.Config = config
+	return &configured
+}
+
+// Prewarm checks the tesseract executable and its installed language packs.
+// Running it once also loads the binary and traineddata into the OS page cache.
+func (e *TesseractEngine) Prewarm(ctx context.Context) (*Capabilities, error) {
+	tesseractPath, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, fmt.Errorf("tesseract executable not found in PATH: %w", err)
+	}
+	versionOut, err := exec.CommandContext(ctx, tesseractPath, "--version").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract --version failed: %w", err)
+	}
+	langsOut, err := exec.CommandContext(ctx, tesseractPath, "--list-langs").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract --list-langs failed: %w. Output: %s", err, string(langsOut))
+	}
+
+	caps := &Capabilities{
+		Engine:    e.Name(),
+		Version:   strings.TrimSpace(strings.SplitN(string(versionOut), "\n", 2)[0]),
+		Languages: parseListLangs(string(langsOut)),
+		FetchedAt: time.Now(),
+	}
+	e.installed = make(map[string]bool, len(caps.Languages))
+	for _, lang := range caps.Languages {
+		e.installed[lang] = true
+	}
+	langs := e.Languages
+	if len(langs) == 0 {
+		langs = []string{"eng"}
+	}
+	return caps, caps.RequireLanguages(langs...)
+}
+
+// parseListLangs parses the output of tesseract --list-langs,
+// skipping the "List of available languages" header line
+func parseListLangs(output string) []string {
+	var langs []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "List of available languages") {
+			continue
+		}
+		langs = append(langs, line)
+	}
+	return langs
+}
@@ -0,0 +1,80 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// Positional formats of the recognized text, with the bounding box of every
+// line and word
+const (
+	FormatHOCR = "hocr" // hOCR (XHTML)
+	FormatALTO = "alto" // ALTO XML
+)
+
+// exportFiles maps the formats to the extension of the file written by
+// tesseract with the config of the same name
+var exportFiles = map[string]string{
+	FormatHOCR: ".hocr",
+	FormatALTO: ".xml",
+}
+
+// ExportEngine is an Engine that can return the recognized text in
+// positional formats, for document-management systems indexing words by
+// position
+type ExportEngine interface {
+	Engine
+	// ImageToFormats recognizes the image with the given traineddata (nil:
+	// engine default) and returns the document of each format
+	ImageToFormats(ctx context.Context, imagePath string, langs []string, formats []string) (map[string]string, error)
+}
+
+// ImageToFormats implements ExportEngine. Every format is written by a single
+// tesseract run.
+func (e *TesseractEngine) ImageToFormats(ctx context.Context, imagePath string, langs []string, formats []string) (map[string]string, error) {
+	if len(langs) == 0 {
+		langs = e.Languages
+	}
+	lang := "eng"
+	if len(langs) > 0 {
+		lang = strings.Join(langs, "+")
+	}
+	for _, format := range formats {
+		if _, ok := exportFiles[format]; !ok {
+			return nil, fmt.Errorf("unsupported OCR output format %q", format)
+		}
+	}
+	tesseractPath, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, fmt.Errorf("tesseract executable not found in PATH: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "ocr-export-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	outputBase := filepath.Join(dir, "page")
+
+	args := append([]string{imagePath, outputBase, "-l", lang}, e.Config.args()...)
+	cmd := exec.CommandContext(ctx, tesseractPath, append(args, formats...)...)
+	output, err := cmd.CombinedOutput()
+	usage.TrackProcess(ctx, cmd.ProcessState)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract %s output failed: %w. Output: %s", strings.Join(formats, "+"), err, string(output))
+	}
+	documents := make(map[string]string, len(formats))
+	for _, format := range formats {
+		data, err := os.ReadFile(outputBase + exportFiles[format])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tesseract %s output: %w", format, err)
+		}
+		documents[format] = string(data)
+	}
+	return documents, nil
+}
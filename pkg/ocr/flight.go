@@ -0,0 +1,35 @@
+package ocr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/flight"
+)
+
+// Flight deduplicates concurrent identical OCR work: while a call for a key
+// (see ImageKey) runs, calls with the same key wait for it and share its
+// result instead of running the engine again
+type Flight = flight.Group
+
+// ImageKey returns a key identifying the content of the image and the
+// parameters of the recognition (engine, languages, mode), so copies of the
+// same image uploaded by different jobs share one recognition
+func ImageKey(imagePath string, params ...string) (string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	for _, p := range params {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,326 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Handwriting providers accepted by NewHandwritingEngine
+const (
+	HandwritingGoogle = "google" // Google Cloud Vision document text detection
+	HandwritingAzure  = "azure"  // Azure AI Vision Read API
+	HandwritingRemote = "remote" // Self-hosted service (e.g. TrOCR) speaking the RemoteConfig protocol
+)
+
+// HandwritingConfig selects the engine used for handwritten documents
+type HandwritingConfig struct {
+	Provider string        // HandwritingGoogle, HandwritingAzure or HandwritingRemote; empty disables handwriting OCR
+	Endpoint string        // Azure resource endpoint or remote service URL; optional for Google
+	APIKey   string        // Google API key, Azure subscription key or remote bearer token
+	Timeout  time.Duration // Per image, default 60s
+	Cache    CapabilityCache
+}
+
+// HandwritingConfigFromEnv reads HANDWRITING_ENGINE, HANDWRITING_ENDPOINT and HANDWRITING_API_KEY
+func HandwritingConfigFromEnv() HandwritingConfig {
+	return HandwritingConfig{
+		Provider: strings.ToLower(os.Getenv("HANDWRITING_ENGINE")),
+		Endpoint: os.Getenv("HANDWRITING_ENDPOINT"),
+		APIKey:   os.Getenv("HANDWRITING_API_KEY"),
+	}
+}
+
+// NewHandwritingEngine creates the engine of the provider, or returns nil if
+// no provider is configured. Call Prewarm before the first job.
+func NewHandwritingEngine(config HandwritingConfig) (Engine, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = 60 * time.Second
+	}
+	switch config.Provider {
+	case "":
+		return nil, nil
+	case HandwritingGoogle:
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("the google handwriting engine requires an API key")
+		}
+		if config.Endpoint == "" {
+			config.Endpoint = "https://vision.googleapis.com"
+		}
+		if _, err := url.ParseRequestURI(config.Endpoint); err != nil {
+			return nil, fmt.Errorf("invalid Google Vision endpoint %q: %w", config.Endpoint, err)
+		}
+		return &GoogleVisionEngine{config: config, client: &http.Client{Timeout: config.Timeout}}, nil
+	case HandwritingAzure:
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("the azure handwriting engine requires a subscription key")
+		}
+		if _, err := url.ParseRequestURI(config.Endpoint); err != nil {
+			return nil, fmt.Errorf("invalid Azure endpoint %q: %w", config.Endpoint, err)
+		}
+		return &AzureReadEngine{config: config, client: &http.Client{Timeout: config.Timeout}}, nil
+	case HandwritingRemote:
+		return NewRemoteEngine(RemoteConfig{
+			URL:     config.Endpoint,
+			APIKey:  config.APIKey,
+			Timeout: config.Timeout,
+			Cache:   config.Cache,
+		})
+	default:
+		return nil, fmt.Errorf("unknown handwriting engine %q (expected google, azure or remote)", config.Provider)
+	}
+}
+
+// GoogleVisionEngine recognizes handwriting with Google Cloud Vision
+// DOCUMENT_TEXT_DETECTION and the handwriting language hint
+type GoogleVisionEngine struct {
+	config HandwritingConfig
+	client *http.Client
+}
+
+// Base64 content must fit in the 10 MB request limit of the Vision API
+const googleVisionMaxImageBytes = 7 << 20
+
+// Name implements Engine
+func (e *GoogleVisionEngine) Name() string { return "google-vision" }
+
+// Prewarm sends an empty batch, which the API rejects only for an invalid key
+// or a project without the Vision API enabled
+func (e *GoogleVisionEngine) Prewarm(ctx context.Context) (*Capabilities, error) {
+	if _, err := e.annotate(ctx, []byte(`{"requests":[]}`)); err != nil {
+		return nil, err
+	}
+	return &Capabilities{Engine: e.Name(), MaxImageBytes: googleVisionMaxImageBytes, FetchedAt: time.Now()}, nil
+}
+
+// ImageToText implements Engine
+func (e *GoogleVisionEngine) ImageToText(ctx context.Context, imagePath string) (string, error) {
+	image, err := readImage(imagePath, googleVisionMaxImageBytes, e.Name())
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]any{
+		"requests": []map[string]any{{
+			"image":        map[string][]byte{"content": image},
+			"features":     []map[string]string{{"type": "DOCUMENT_TEXT_DETECTION"}},
+			"imageContext": map[string][]string{"languageHints": {"en-t-i0-handwrit"}},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+	data, err := e.annotate(ctx, body)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Responses []struct {
+			FullTextAnnotation struct {
+				Text string `json:"text"`
+			} `json:"fullTextAnnotation"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"responses"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid response from Google Vision: %w", err)
+	}
+	if len(result.Responses) == 0 {
+		return "", nil
+	}
+	if r := result.Responses[0]; r.Error != nil {
+		return "", fmt.Errorf("Google Vision failed to annotate the image: %s", r.Error.Message)
+	}
+	return result.Responses[0].FullTextAnnotation.Text, nil
+}
+
+func (e *GoogleVisionEngine) annotate(ctx context.Context, body []byte) ([]byte, error) {
+	// The key goes in a header, not in ?key=: the URL appears in the errors
+	// of the client, which end up in the error message of the job
+	endpoint := strings.TrimRight(e.config.Endpoint, "/") + "/v1/images:annotate"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-Api-Key", e.config.APIKey)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Google Vision request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusBadRequest && bytes.Contains(data, []byte("API_KEY_INVALID")):
+		return nil, ErrInvalidCredentials
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("Google Vision returned %s: %s", resp.Status, truncate(data, 512))
+	}
+	return data, nil
+}
+
+// AzureReadEngine recognizes printed and handwritten text with the Azure AI
+// Vision Read API (v3.2), which runs asynchronously and is polled for the result
+type AzureReadEngine struct {
+	config HandwritingConfig
+	client *http.Client
+}
+
+// Limit of the Read API for paid tiers (4 MB on the free tier)
+const azureReadMaxImageBytes = 50 << 20
+
+// Interval between two polls of a Read operation (shortened by tests)
+var azurePollInterval = time.Second
+
+// Name implements Engine
+func (e *AzureReadEngine) Name() string { return "azure-read" }
+
+// Prewarm looks up a nonexistent operation: the service answers 404 for a
+// valid key and 401 for an invalid one
+func (e *AzureReadEngine) Prewarm(ctx context.Context) (*Capabilities, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", e.url("/analyzeResults/00000000-0000-0000-0000-000000000000"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", e.config.APIKey)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Azure Read request failed: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrInvalidCredentials
+	default:
+		return nil, fmt.Errorf("Azure Read API returned %s", resp.Status)
+	}
+	return &Capabilities{Engine: e.Name(), MaxImageBytes: azureReadMaxImageBytes, FetchedAt: time.Now()}, nil
+}
+
+// ImageToText implements Engine
+func (e *AzureReadEngine) ImageToText(ctx context.Context, imagePath string) (string, error) {
+	image, err := readImage(imagePath, azureReadMaxImageBytes, e.Name())
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url("/analyze"), bytes.NewReader(image))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := e.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	operation := resp.Header.Get("Operation-Location")
+	if operation == "" {
+		return "", fmt.Errorf("Azure Read API returned no Operation-Location")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("Azure Read operation did not finish: %w", ctx.Err())
+		case <-time.After(azurePollInterval):
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", operation, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := e.do(req)
+		if err != nil {
+			return "", err
+		}
+		var result struct {
+			Status        string `json:"status"` // notStarted, running, succeeded, failed
+			AnalyzeResult struct {
+				ReadResults []struct {
+					Lines []struct {
+						Text string `json:"text"`
+					} `json:"lines"`
+				} `json:"readResults"`
+			} `json:"analyzeResult"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("invalid response from Azure Read API: %w", err)
+		}
+		switch result.Status {
+		case "failed":
+			return "", fmt.Errorf("Azure Read operation failed")
+		case "succeeded":
+			pages := make([]string, 0, len(result.AnalyzeResult.ReadResults))
+			for _, page := range result.AnalyzeResult.ReadResults {
+				lines := make([]string, len(page.Lines))
+				for i, line := range page.Lines {
+					lines[i] = line.Text
+				}
+				pages = append(pages, strings.Join(lines, "\n"))
+			}
+			return strings.Join(pages, "\n\n"), nil
+		}
+	}
+}
+
+func (e *AzureReadEngine) url(path string) string {
+	return strings.TrimRight(e.config.Endpoint, "/") + "/vision/v3.2/read" + path
+}
+
+// do sends the request with the subscription key and maps error statuses
+func (e *AzureReadEngine) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Ocp-Apim-Subscription-Key", e.config.APIKey)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Azure Read request failed: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, ErrInvalidCredentials
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("Azure Read API returned %s: %s", resp.Status, string(msg))
+	}
+	return resp, nil
+}
+
+// readImage reads an image to send to a cloud engine within its size limit
+func readImage(imagePath string, limit int64, engine string) ([]byte, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %s: %w", imagePath, err)
+	}
+	if int64(len(image)) > limit {
+		return nil, fmt.Errorf("image is %d bytes, %s accepts at most %d", len(image), engine, limit)
+	}
+	return image, nil
+}
+
+func truncate(data []byte, n int) string {
+	if len(data) > n {
+		data = data[:n]
+	}
+	return string(data)
+}
@@ -0,0 +1,124 @@
+package ocr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoogleVisionEngine(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/images:annotate" || r.URL.RawQuery != "" {
+			t.Errorf("request to %s", r.URL)
+		}
+		if r.Header.Get("X-Goog-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"status":"INVALID_ARGUMENT","details":[{"reason":"API_KEY_INVALID"}]}}`))
+			return
+		}
+		var req struct {
+			Requests []struct {
+				Image struct {
+					Content []byte `json:"content"`
+				} `json:"image"`
+				ImageContext struct {
+					LanguageHints []string `json:"languageHints"`
+				} `json:"imageContext"`
+			} `json:"requests"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case len(req.Requests) == 0: // Prewarm
+			w.Write([]byte(`{}`))
+		case len(req.Requests[0].Image.Content) != 8 || req.Requests[0].ImageContext.LanguageHints[0] != "en-t-i0-handwrit":
+			t.Errorf("request = %+v", req)
+		default:
+			w.Write([]byte(`{"responses":[{"fullTextAnnotation":{"text":"Dear diary\nToday"}}]}`))
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	engine, err := NewHandwritingEngine(HandwritingConfig{Provider: HandwritingGoogle, Endpoint: srv.URL, APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps, err := engine.Prewarm(ctx); err != nil || caps.MaxImageBytes != googleVisionMaxImageBytes {
+		t.Fatalf("Prewarm = %+v, %v", caps, err)
+	}
+	if text, err := engine.ImageToText(ctx, writeImage(t, 8)); err != nil || text != "Dear diary\nToday" {
+		t.Fatalf("ImageToText = %q, %v", text, err)
+	}
+
+	invalid, _ := NewHandwritingEngine(HandwritingConfig{Provider: HandwritingGoogle, Endpoint: srv.URL, APIKey: "wrong"})
+	if _, err := invalid.Prewarm(ctx); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Prewarm with an invalid key: %v", err)
+	}
+
+	// A transport error does not reveal the key
+	srv.Close()
+	if _, err := engine.ImageToText(ctx, writeImage(t, 8)); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("error with the server down: %v", err)
+	}
+}
+
+func TestAzureReadEngine(t *testing.T) {
+	previous := azurePollInterval
+	azurePollInterval = time.Millisecond
+	defer func() { azurePollInterval = previous }()
+
+	var polls atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/vision/v3.2/read/analyze":
+			w.Header().Set("Operation-Location", srv.URL+"/vision/v3.2/read/analyzeResults/op1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/vision/v3.2/read/analyzeResults/op1":
+			if polls.Add(1) == 1 {
+				w.Write([]byte(`{"status":"running"}`))
+				return
+			}
+			w.Write([]byte(`{"status":"succeeded","analyzeResult":{"readResults":[
+				{"lines":[{"text":"line one"},{"text":"line two"}]},
+				{"lines":[{"text":"page two"}]}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	engine, err := NewHandwritingEngine(HandwritingConfig{Provider: HandwritingAzure, Endpoint: srv.URL, APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Prewarm(ctx); err != nil {
+		t.Fatalf("Prewarm: %v", err)
+	}
+	text, err := engine.ImageToText(ctx, writeImage(t, 8))
+	if err != nil || text != "line one\nline two\n\npage two" {
+		t.Fatalf("ImageToText = %q, %v", text, err)
+	}
+	if polls.Load() != 2 {
+		t.Errorf("%d polls, want 2", polls.Load())
+	}
+
+	invalid, _ := NewHandwritingEngine(HandwritingConfig{Provider: HandwritingAzure, Endpoint: srv.URL, APIKey: "wrong"})
+	if _, err := invalid.Prewarm(ctx); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Prewarm with an invalid key: %v", err)
+	}
+	if _, err := invalid.ImageToText(ctx, writeImage(t, 8)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ImageToText with an invalid key: %v", err)
+	}
+}
@@ -0,0 +1,461 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// Region kinds of a page layout
+const (
+	RegionText  = "text"  // Paragraph of running text
+	RegionTable = "table" // Grid of cells
+)
+
+// Box is a rectangle in image pixels
+type Box struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (b Box) right() int  { return b.Left + b.Width }
+func (b Box) bottom() int { return b.Top + b.Height }
+
+// union returns the smallest box containing b and other (a zero b is empty)
+func (b Box) union(other Box) Box {
+	if b == (Box{}) {
+		return other
+	}
+	left, top := min(b.Left, other.Left), min(b.Top, other.Top)
+	return Box{Left: left, Top: top, Width: max(b.right(), other.right()) - left, Height: max(b.bottom(), other.bottom()) - top}
+}
+
+// Region is one structured part of a page
+type Region struct {
+	Kind   string     `json:"kind"`
+	Text   string     `json:"text,omitempty"` // RegionText: lines separated by "\n"
+	Rows   [][]string `json:"rows,omitempty"` // RegionTable: cell text by row and column
+	Column int        `json:"column"`         // Text column of the region, -1 if it spans several columns
+	Box    Box        `json:"box"`
+}
+
+// Layout is the structure of a page, regions in reading order (columns left
+// to right, each top to bottom; regions spanning the columns split the page
+// into bands that are read in turn)
+type Layout struct {
+	Regions []Region `json:"regions"`
+	Columns int      `json:"columns"`
+}
+
+// Text returns the plain text of the layout: regions separated by blank
+// lines, table cells separated by tabs
+func (l *Layout) Text() string {
+	parts := make([]string, 0, len(l.Regions))
+	for _, region := range l.Regions {
+		if region.Kind == RegionTable {
+			rows := make([]string, len(region.Rows))
+			for i, row := range region.Rows {
+				rows[i] = strings.Join(row, "\t")
+			}
+			parts = append(parts, strings.Join(rows, "\n"))
+			continue
+		}
+		parts = append(parts, region.Text)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Tables returns the number of table regions
+func (l *Layout) Tables() int {
+	n := 0
+	for _, region := range l.Regions {
+		if region.Kind == RegionTable {
+			n++
+		}
+	}
+	return n
+}
+
+// LayoutEngine is an Engine that can return the layout of the page instead
+// of one text blob
+type LayoutEngine interface {
+	Engine
+	// ImageToLayout recognizes the image with the given traineddata (nil: engine default)
+	ImageToLayout(ctx context.Context, imagePath string, langs []string) (*Layout, error)
+}
+
+// ImageToLayout implements LayoutEngine with the TSV output of Tesseract
+// (one row per block, paragraph, line and word with its bounding box)
+func (e *TesseractEngine) ImageToLayout(ctx context.Context, imagePath string, langs []string) (*Layout, error) {
+	if len(langs) == 0 {
+		langs = e.Languages
+	}
+	lang := "eng"
+	if len(langs) > 0 {
+		lang = strings.Join(langs, "+")
+	}
+	tesseractPath, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, fmt.Errorf("tesseract executable not found in PATH: %w", err)
+	}
+	args := append([]string{imagePath, "stdout", "-l", lang}, e.Config.args()...)
+	cmd := exec.CommandContext(ctx, tesseractPath, append(args, "tsv")...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	usage.TrackProcess(ctx, cmd.ProcessState)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract layout analysis failed: %w. Output: %s", err, stderr.String())
+	}
+	return ParseTSV(string(out))
+}
+
+// DetectAndRecognizeLayout is DetectAndRecognize for layout analysis
+func DetectAndRecognizeLayout(ctx context.Context, engine LayoutEngine, imagePath string, osd *Detection) (*Layout, *Detection, error) {
+	var layout *Layout
+	_, det, err := detectAndRun(ctx, engine, imagePath, osd, func(langs []string) (string, error) {
+		l, err := engine.ImageToLayout(ctx, imagePath, langs)
+		if err != nil {
+			return "", err
+		}
+		layout = l
+		return l.Text(), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return layout, det, nil
+}
+
+// Layout analysis thresholds, relative to the median word height
+const (
+	cellGapFactor  = 2.0 // Horizontal gap that separates table cells within a line
+	rowGapFactor   = 3.0 // Largest vertical gap between two rows of a table
+	wideRegionPart = 0.55
+)
+
+// tsvWord is a recognized word of the TSV output
+type tsvWord struct {
+	block, par, line int
+	box              Box
+	text             string
+}
+
+// segment is a run of words of one line without a cell gap
+type segment struct {
+	block, par, line int
+	words            []tsvWord
+	box              Box
+	used             bool // Part of a table
+}
+
+func (s *segment) text() string {
+	texts := make([]string, len(s.words))
+	for i, w := range s.words {
+		texts[i] = w.text
+	}
+	return strings.Join(texts, " ")
+}
+
+// ParseTSV builds the layout of a page from Tesseract TSV output
+func ParseTSV(tsv string) (*Layout, error) {
+	if !strings.HasPrefix(tsv, "level\t") {
+		return nil, fmt.Errorf("not a tesseract TSV output")
+	}
+	var words []tsvWord
+	for _, row := range strings.Split(tsv, "\n") {
+		fields := strings.Split(strings.TrimRight(row, "\r"), "\t")
+		if len(fields) < 12 || fields[0] != "5" { // Level 5: word
+			continue
+		}
+		text := strings.TrimSpace(fields[11])
+		if text == "" {
+			continue
+		}
+		var nums [10]int
+		for i := range nums {
+			n, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid TSV row %q: %w", row, err)
+			}
+			nums[i] = n
+		}
+		words = append(words, tsvWord{
+			block: nums[1], par: nums[2], line: nums[3],
+			box:  Box{Left: nums[5], Top: nums[6], Width: nums[7], Height: nums[8]},
+			text: text,
+		})
+	}
+	return analyzeLayout(words), nil
+}
+
+// analyzeLayout finds the tables, paragraphs and columns of the page
+func analyzeLayout(words []tsvWord) *Layout {
+	layout := &Layout{Regions: []Region{}, Columns: 1}
+	if len(words) == 0 {
+		return layout
+	}
+	heights := make([]int, len(words))
+	for i, w := range words {
+		heights[i] = w.box.Height
+	}
+	sort.Ints(heights)
+	unit := float64(max(heights[len(heights)/2], 1))
+
+	segments := splitSegments(words, unit)
+	regions := findTables(segments, unit)
+	regions = append(regions, paragraphs(segments)...)
+	layout.Regions, layout.Columns = readingOrder(regions)
+	return layout
+}
+
+// splitSegments groups the words by line and splits lines at cell gaps
+func splitSegments(words []tsvWord, unit float64) []*segment {
+	type lineKey struct{ block, par, line int }
+	lines := map[lineKey][]tsvWord{}
+	var keys []lineKey
+	for _, w := range words {
+		key := lineKey{w.block, w.par, w.line}
+		if _, ok := lines[key]; !ok {
+			keys = append(keys, key)
+		}
+		lines[key] = append(lines[key], w)
+	}
+
+	var segments []*segment
+	for _, key := range keys {
+		lineWords := lines[key]
+		sort.SliceStable(lineWords, func(i, j int) bool { return lineWords[i].box.Left < lineWords[j].box.Left })
+		var current *segment
+		for _, w := range lineWords {
+			if current == nil || float64(w.box.Left-current.box.right()) > cellGapFactor*unit {
+				current = &segment{block: key.block, par: key.par, line: key.line}
+				segments = append(segments, current)
+			}
+			current.words = append(current.words, w)
+			current.box = current.box.union(w.box)
+		}
+	}
+	return segments
+}
+
+// visualRow is the segments at the same height of the page
+type visualRow struct {
+	segments []*segment
+	box      Box
+}
+
+// findTables finds runs of rows split into aligned cells and marks their
+// segments as used. Cells must be short, otherwise the rows are lines of
+// text columns side by side.
+func findTables(segments []*segment, unit float64) []Region {
+	sorted := append([]*segment(nil), segments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].box.Top+sorted[i].box.Height/2 < sorted[j].box.Top+sorted[j].box.Height/2
+	})
+	var rows []*visualRow
+	for _, s := range sorted {
+		center := s.box.Top + s.box.Height/2
+		if n := len(rows); n > 0 && center >= rows[n-1].box.Top && center <= rows[n-1].box.bottom() {
+			rows[n-1].segments = append(rows[n-1].segments, s)
+			rows[n-1].box = rows[n-1].box.union(s.box)
+			continue
+		}
+		rows = append(rows, &visualRow{segments: []*segment{s}, box: s.box})
+	}
+
+	var tables []Region
+	for start := 0; start < len(rows); {
+		end := start
+		for end < len(rows) && len(rows[end].segments) >= 2 &&
+			(end == start || float64(rows[end].box.Top-rows[end-1].box.bottom()) <= rowGapFactor*unit) {
+			end++
+		}
+		if end-start >= 2 {
+			if table, ok := buildTable(rows[start:end]); ok {
+				tables = append(tables, table)
+			}
+		}
+		start = max(end, start+1)
+	}
+	return tables
+}
+
+// buildTable turns rows of segments into a table region: columns are the
+// overlapping horizontal extents of the segments
+func buildTable(rows []*visualRow) (Region, bool) {
+	var segments []*segment
+	for _, row := range rows {
+		segments = append(segments, row.segments...)
+	}
+	columns := mergeIntervals(segments)
+	if len(columns) < 2 {
+		return Region{}, false
+	}
+	wordCount := 0
+	for _, s := range segments {
+		wordCount += len(s.words)
+	}
+	avgWords := float64(wordCount) / float64(len(segments))
+	if avgWords > 4 && (len(columns) < 3 || avgWords > 6) {
+		return Region{}, false
+	}
+
+	region := Region{Kind: RegionTable}
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		sort.SliceStable(row.segments, func(i, j int) bool { return row.segments[i].box.Left < row.segments[j].box.Left })
+		for _, s := range row.segments {
+			c := columnOf(columns, s.box)
+			if cells[c] != "" {
+				cells[c] += " "
+			}
+			cells[c] += s.text()
+			s.used = true
+			region.Box = region.Box.union(s.box)
+		}
+		region.Rows = append(region.Rows, cells)
+	}
+	return region, true
+}
+
+// interval is a horizontal extent [left, right)
+type interval struct{ left, right int }
+
+// mergeIntervals returns the horizontal extents of the segments, merging
+// those that overlap, from left to right
+func mergeIntervals(segments []*segment) []interval {
+	spans := make([]interval, len(segments))
+	for i, s := range segments {
+		spans[i] = interval{s.box.Left, s.box.right()}
+	}
+	return mergeSpans(spans)
+}
+
+func mergeSpans(spans []interval) []interval {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].left < spans[j].left })
+	var merged []interval
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.left < merged[n-1].right {
+			merged[n-1].right = max(merged[n-1].right, span.right)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// columnOf returns the column containing the horizontal center of box
+func columnOf(columns []interval, box Box) int {
+	center := box.Left + box.Width/2
+	for i, column := range columns {
+		if center < column.right {
+			return i
+		}
+	}
+	return len(columns) - 1
+}
+
+// paragraphs groups the segments outside tables by Tesseract paragraph
+func paragraphs(segments []*segment) []Region {
+	type parKey struct{ block, par int }
+	var keys []parKey
+	lines := map[parKey][]*segment{}
+	for _, s := range segments {
+		if s.used {
+			continue
+		}
+		key := parKey{s.block, s.par}
+		if _, ok := lines[key]; !ok {
+			keys = append(keys, key)
+		}
+		lines[key] = append(lines[key], s)
+	}
+
+	regions := make([]Region, 0, len(keys))
+	for _, key := range keys {
+		region := Region{Kind: RegionText}
+		var text strings.Builder
+		prevLine := -1
+		for _, s := range lines[key] {
+			switch {
+			case prevLine == -1:
+			case s.line == prevLine:
+				text.WriteString(" ")
+			default:
+				text.WriteString("\n")
+			}
+			text.WriteString(s.text())
+			prevLine = s.line
+			region.Box = region.Box.union(s.box)
+		}
+		region.Text = text.String()
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// readingOrder sorts the regions into reading order and returns the number
+// of text columns. Columns are the extents of the narrow regions; a region
+// that is wide or overlaps several columns spans the page.
+func readingOrder(regions []Region) ([]Region, int) {
+	left, right := regions[0].Box.Left, regions[0].Box.right()
+	for _, r := range regions {
+		left, right = min(left, r.Box.Left), max(right, r.Box.right())
+	}
+	wide := wideRegionPart * float64(right-left)
+
+	var spans []interval
+	for _, r := range regions {
+		if float64(r.Box.Width) < wide {
+			spans = append(spans, interval{r.Box.Left, r.Box.right()})
+		}
+	}
+	columns := mergeSpans(spans)
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].Box.Top < regions[j].Box.Top })
+	if len(columns) <= 1 {
+		for i := range regions {
+			regions[i].Column = 0
+		}
+		return regions, 1
+	}
+
+	for i, r := range regions {
+		regions[i].Column = -1
+		if float64(r.Box.Width) >= wide {
+			continue
+		}
+		for c, column := range columns {
+			if r.Box.Left < column.right && r.Box.right() > column.left {
+				regions[i].Column = c
+				break
+			}
+		}
+	}
+
+	// Spanning regions close a band; regions of a band are read column by column
+	ordered := make([]Region, 0, len(regions))
+	var band []Region
+	flush := func() {
+		sort.SliceStable(band, func(i, j int) bool { return band[i].Column < band[j].Column })
+		ordered = append(ordered, band...)
+		band = band[:0]
+	}
+	for _, r := range regions {
+		if r.Column == -1 {
+			flush()
+			ordered = append(ordered, r)
+			continue
+		}
+		band = append(band, r)
+	}
+	flush()
+	return ordered, len(columns)
+}
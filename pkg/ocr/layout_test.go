@@ -0,0 +1,91 @@
+package ocr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const tsvHeader = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n"
+
+// tsvWords returns word rows of one line: words of width 30, 10 pixels
+// apart, starting at left
+func tsvWords(block, par, line, left, top int, text string) string {
+	var b strings.Builder
+	for i, word := range strings.Fields(text) {
+		fmt.Fprintf(&b, "5\t1\t%d\t%d\t%d\t%d\t%d\t%d\t30\t20\t96\t%s\n", block, par, line, i+1, left+40*i, top, word)
+	}
+	return b.String()
+}
+
+func TestParseTSVTable(t *testing.T) {
+	tsv := tsvHeader +
+		"1\t1\t0\t0\t0\t0\t0\t0\t1000\t1000\t-1\t\n" + // Page row, ignored
+		tsvWords(1, 1, 1, 0, 0, "Invoice for March 2024 order") +
+		tsvWords(2, 1, 1, 0, 100, "Item") + tsvWords(2, 1, 1, 300, 100, "Qty") + tsvWords(2, 1, 1, 600, 100, "Price") +
+		tsvWords(2, 1, 2, 0, 130, "Blue pen") + tsvWords(2, 1, 2, 300, 130, "2") + tsvWords(2, 1, 2, 600, 130, "1.50") +
+		tsvWords(2, 1, 3, 0, 160, "Book") + tsvWords(2, 1, 3, 600, 160, "9.00")
+	layout, err := ParseTSV(tsv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layout.Regions) != 2 || layout.Columns != 1 || layout.Tables() != 1 {
+		t.Fatalf("layout = %+v", layout)
+	}
+	if title := layout.Regions[0]; title.Kind != RegionText || title.Text != "Invoice for March 2024 order" {
+		t.Errorf("first region = %+v, want the title", title)
+	}
+	wantRows := [][]string{{"Item", "Qty", "Price"}, {"Blue pen", "2", "1.50"}, {"Book", "", "9.00"}}
+	if table := layout.Regions[1]; table.Kind != RegionTable || !reflect.DeepEqual(table.Rows, wantRows) {
+		t.Errorf("second region = %+v, want rows %q", table, wantRows)
+	}
+	wantText := "Invoice for March 2024 order\n\nItem\tQty\tPrice\nBlue pen\t2\t1.50\nBook\t\t9.00"
+	if text := layout.Text(); text != wantText {
+		t.Errorf("Text() = %q, want %q", text, wantText)
+	}
+}
+
+func TestParseTSVColumns(t *testing.T) {
+	// A title and a footer spanning two columns of running text: lines of
+	// the columns sit side by side but are too long to be table cells
+	tsv := tsvHeader + tsvWords(1, 1, 1, 0, 0, strings.Repeat("title ", 15))
+	for i := 0; i < 3; i++ {
+		tsv += tsvWords(2, 1, i+1, 0, 50+30*i, "left column words go here")
+		tsv += tsvWords(3, 1, i+1, 400, 50+30*i, "right column words go here")
+	}
+	tsv += tsvWords(4, 1, 1, 0, 200, strings.Repeat("footer ", 15))
+
+	layout, err := ParseTSV(tsv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Columns != 2 || layout.Tables() != 0 {
+		t.Fatalf("columns %d, tables %d; want 2, 0", layout.Columns, layout.Tables())
+	}
+	var order []string
+	var columns []int
+	for _, region := range layout.Regions {
+		order = append(order, strings.Fields(region.Text)[0])
+		columns = append(columns, region.Column)
+	}
+	if !reflect.DeepEqual(order, []string{"title", "left", "right", "footer"}) || !reflect.DeepEqual(columns, []int{-1, 0, 1, -1}) {
+		t.Fatalf("reading order %v, columns %v", order, columns)
+	}
+	if want := "left column words go here\nleft column words go here\nleft column words go here"; layout.Regions[1].Text != want {
+		t.Errorf("left column = %q, want %q", layout.Regions[1].Text, want)
+	}
+}
+
+func TestParseTSVInvalid(t *testing.T) {
+	if _, err := ParseTSV("Hello world"); err == nil {
+		t.Error("ParseTSV accepted plain text")
+	}
+	if _, err := ParseTSV(tsvHeader + "5\t1\t1\t1\t1\t1\tx\t0\t30\t20\t96\tword\n"); err == nil {
+		t.Error("ParseTSV accepted a non-numeric box")
+	}
+	layout, err := ParseTSV(tsvHeader + "5\t1\t1\t1\t1\t1\t0\t0\t30\t20\t-1\t \n")
+	if err != nil || len(layout.Regions) != 0 || layout.Text() != "" {
+		t.Fatalf("blank page: %+v, %v", layout, err)
+	}
+}
@@ -1,16 +1,25 @@
 package ocr
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
 )
 
 // ImageToText converts an image to text using Tesseract OCR
 func ImageToText(imagePath string) (string, error) {
+	return imageToText(context.Background(), imagePath, "eng", Config{})
+}
+
+// imageToText runs Tesseract with the given traineddata (e.g. "eng" or "jpn+eng")
+// and config
+func imageToText(ctx context.Context, imagePath, lang string, config Config) (string, error) {
 	// Find the full path to the tesseract executable Go is using
 	tesseractPath, err := exec.LookPath("tesseract")
 	if err != nil {
@@ -27,12 +36,14 @@ func ImageToText(imagePath string) (string, error) {
 	// Xóa file output cũ nếu tồn tại (phòng trường hợp lần chạy trước lỗi)
 	os.Remove(tempOutputFilePath)
 
-	// Lệnh Tesseract: output vào file tạm, dùng PSM mặc định
-	cmd := exec.Command(tesseractPath, imagePath, tempOutputFileBase, "-l", "eng")
+	// Lệnh Tesseract: output vào file tạm, PSM mặc định trừ khi config chỉ định
+	args := append([]string{imagePath, tempOutputFileBase, "-l", lang}, config.args()...)
+	cmd := exec.CommandContext(ctx, tesseractPath, args...)
 	log.Printf("OCR: Executing command: %s", cmd.String())
 
 	// Chạy lệnh và lấy lỗi (bao gồm cả stderr nếu có)
-	outputBytes, err := cmd.CombinedOutput() // Dùng CombinedOutput để vẫn thấy stderr nếu lỗi
+	outputBytes, err := cmd.CombinedOutput()  // Dùng CombinedOutput để vẫn thấy stderr nếu lỗi
+	usage.TrackProcess(ctx, cmd.ProcessState) // CPU và peak RSS của tesseract cho thống kê tài nguyên
 	if err != nil {
 		// Ghi log lỗi chi tiết bao gồm cả output (thường chứa stderr)
 		log.Printf("OCR: Tesseract command failed for image %s. Error: %v, Output: %s", imagePath, err, string(outputBytes))
@@ -0,0 +1,303 @@
+package ocr
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// PoolConfig configures a PoolEngine.
+//
+// Command starts an OCR server that answers requests on its stdin/stdout, one
+// JSON object per line (ServePool implements the server side):
+//
+//	{"image": "/path/page.png", "languages": "eng+fra"} -> {"text": "..."} or {"error": "..."}
+//	{"image": ..., "languages": ..., "config": Config}  -> same, recognized with psm, oem and variables
+//	{"capabilities": true}                              -> {"version": "...", "languages": ["eng", ...]}
+//
+// The pool only saves time with a server that keeps its engines initialized,
+// e.g. one tesserocr/gosseract handle per language set. "imgproc ocr-server"
+// speaks the protocol but still runs the tesseract command for each image.
+type PoolConfig struct {
+	Command   []string      // Server program and arguments
+	Size      int           // Processes kept running, default 2
+	Timeout   time.Duration // Per request, default 60s
+	Languages []string      // Traineddata used by ImageToText, default "eng"
+}
+
+// PoolEngine sends the images to a pool of long-lived OCR server processes
+// instead of starting tesseract for each image, which saves the process
+// startup and the loading of the traineddata on every job. A process that
+// fails or times out is killed and started again for the next image.
+type PoolEngine struct {
+	config    PoolConfig
+	ocrConfig *Config           // Sent with every image, set by WithConfig
+	idle      chan *poolProcess // Free slots of the pool, nil: process not started
+}
+
+// poolProcess is one running OCR server
+type poolProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   *bufio.Reader
+}
+
+type poolRequest struct {
+	Image        string  `json:"image,omitempty"`
+	Languages    string  `json:"languages,omitempty"`
+	Config       *Config `json:"config,omitempty"`
+	Capabilities bool    `json:"capabilities,omitempty"`
+}
+
+type poolResponse struct {
+	Text      string   `json:"text,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+}
+
+// NewPoolEngine creates a PoolEngine. The processes are started by Prewarm.
+func NewPoolEngine(config PoolConfig) (*PoolEngine, error) {
+	if len(config.Command) == 0 {
+		return nil, fmt.Errorf("OCR pool requires the command of the OCR server")
+	}
+	if config.Size <= 0 {
+		config.Size = 2
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 60 * time.Second
+	}
+	if len(config.Languages) == 0 {
+		config.Languages = []string{"eng"}
+	}
+	e := &PoolEngine{config: config, idle: make(chan *poolProcess, config.Size)}
+	for i := 0; i < config.Size; i++ {
+		e.idle <- nil
+	}
+	return e, nil
+}
+
+// Name implements Engine
+func (e *PoolEngine) Name() string { return "pool" }
+
+// Prewarm starts every process of the pool and asks the first one for the
+// installed languages
+func (e *PoolEngine) Prewarm(ctx context.Context) (*Capabilities, error) {
+	procs := make([]*poolProcess, e.config.Size)
+	for i := range procs {
+		procs[i] = <-e.idle
+	}
+	defer func() {
+		for _, p := range procs {
+			e.idle <- p
+		}
+	}()
+	for i, p := range procs {
+		if p != nil {
+			continue
+		}
+		var err error
+		if procs[i], err = e.start(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := e.call(ctx, procs[0], poolRequest{Capabilities: true})
+	if err != nil {
+		procs[0] = nil
+		return nil, err
+	}
+	caps := &Capabilities{
+		Engine:    e.Name(),
+		Version:   resp.Version,
+		Languages: resp.Languages,
+		FetchedAt: time.Now(),
+	}
+	return caps, caps.RequireLanguages(e.config.Languages...)
+}
+
+// ImageToText implements Engine
+func (e *PoolEngine) ImageToText(ctx context.Context, imagePath string) (string, error) {
+	return e.ImageToTextWithLanguages(ctx, imagePath, e.config.Languages)
+}
+
+// ImageToTextWithLanguages recognizes the image with the given traineddata.
+// It waits for a free process of the pool; a process whose request is
+// canceled is stopped, since it cannot be interrupted otherwise.
+func (e *PoolEngine) ImageToTextWithLanguages(ctx context.Context, imagePath string, langs []string) (string, error) {
+	if len(langs) == 0 {
+		langs = e.config.Languages
+	}
+	var p *poolProcess
+	select {
+	case p = <-e.idle:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if p == nil {
+		var err error
+		if p, err = e.start(); err != nil {
+			e.idle <- nil
+			return "", err
+		}
+	}
+	resp, err := e.call(ctx, p, poolRequest{Image: imagePath, Languages: strings.Join(langs, "+"), Config: e.ocrConfig})
+	if err != nil {
+		e.idle <- nil // Started again for the next image
+		return "", err
+	}
+	e.idle <- p
+	if resp.Error != "" {
+		return "", fmt.Errorf("OCR server failed on %s: %s", imagePath, resp.Error)
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
+
+// WithConfig implements ConfigurableEngine. The returned engine uses the
+// processes of e.
+func (e *PoolEngine) WithConfig(config Config) Engine {
+	configured := *e
+	configured.ocrConfig = &config
+	return &configured
+}
+
+// Close stops the processes of the pool. Images being recognized finish
+// first.
+func (e *PoolEngine) Close() {
+	for i := 0; i < e.config.Size; i++ {
+		if p := <-e.idle; p != nil {
+			p.stop()
+		}
+	}
+}
+
+// start runs a new OCR server process
+func (e *PoolEngine) start() (*poolProcess, error) {
+	cmd := exec.Command(e.config.Command[0], e.config.Command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start OCR server %q: %w", e.config.Command[0], err)
+	}
+	log.Printf("OCR: Started OCR server process %d: %s", cmd.Process.Pid, cmd.String())
+	return &poolProcess{cmd: cmd, stdin: stdin, out: bufio.NewReader(stdout)}, nil
+}
+
+// call sends one request to p and reads the answer. On error p is stopped.
+func (e *PoolEngine) call(ctx context.Context, p *poolProcess, req poolRequest) (*poolResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.stdin.Write(append(data, '\n')); err != nil {
+		p.stop()
+		return nil, fmt.Errorf("OCR server process %d is gone: %w", p.cmd.Process.Pid, err)
+	}
+
+	type answer struct {
+		line []byte
+		err  error
+	}
+	done := make(chan answer, 1)
+	go func() {
+		line, err := p.out.ReadBytes('\n')
+		done <- answer{line, err}
+	}()
+	var a answer
+	select {
+	case a = <-done:
+	case <-time.After(e.config.Timeout):
+		p.stop()
+		return nil, fmt.Errorf("OCR server process %d timed out after %v", p.cmd.Process.Pid, e.config.Timeout)
+	case <-ctx.Done():
+		p.stop()
+		return nil, ctx.Err()
+	}
+	if a.err != nil {
+		p.stop()
+		return nil, fmt.Errorf("OCR server process %d is gone: %w", p.cmd.Process.Pid, a.err)
+	}
+	var resp poolResponse
+	if err := json.Unmarshal(a.line, &resp); err != nil {
+		p.stop()
+		return nil, fmt.Errorf("invalid response from OCR server process %d: %w", p.cmd.Process.Pid, err)
+	}
+	return &resp, nil
+}
+
+// stop kills the process and reaps it
+func (p *poolProcess) stop() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+// ServePool is the server side of PoolEngine: it reads the requests from in,
+// one per line, recognizes the images with engine and writes the responses
+// to out in the same order. It returns nil once in is closed (the pool
+// stopped the process), or the error of in or out.
+func ServePool(ctx context.Context, engine Engine, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	encoder := json.NewEncoder(out) // One line per response
+	for scanner.Scan() {
+		var req poolRequest
+		resp := poolResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = "invalid request: " + err.Error()
+		} else {
+			resp = servePoolRequest(ctx, engine, req)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func servePoolRequest(ctx context.Context, engine Engine, req poolRequest) poolResponse {
+	if req.Capabilities {
+		// The pool checks the languages it needs itself
+		caps, err := engine.Prewarm(ctx)
+		if caps == nil {
+			return poolResponse{Error: err.Error()}
+		}
+		return poolResponse{Version: caps.Version, Languages: caps.Languages}
+	}
+	if req.Image == "" {
+		return poolResponse{Error: "request without image"}
+	}
+	if req.Config != nil {
+		configured, err := WithConfig(engine, *req.Config)
+		if err != nil {
+			return poolResponse{Error: err.Error()}
+		}
+		engine = configured
+	}
+	var text string
+	var err error
+	if le, ok := engine.(interface {
+		ImageToTextWithLanguages(ctx context.Context, imagePath string, langs []string) (string, error)
+	}); ok && req.Languages != "" {
+		text, err = le.ImageToTextWithLanguages(ctx, req.Image, strings.Split(req.Languages, "+"))
+	} else {
+		text, err = engine.ImageToText(ctx, req.Image)
+	}
+	if err != nil {
+		return poolResponse{Error: err.Error()}
+	}
+	return poolResponse{Text: text}
+}
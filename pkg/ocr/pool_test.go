@@ -0,0 +1,171 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary is also the OCR server of the pools under test: started
+// with OCR_POOL_TEST_SERVER set, it serves fakeEngine on stdin/stdout
+func TestMain(m *testing.M) {
+	if os.Getenv("OCR_POOL_TEST_SERVER") != "" {
+		if err := ServePool(context.Background(), fakeEngine{}, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeEngine answers "<image> <languages> psm <psm> pid <pid>"; the image
+// "slow.png" never finishes and "crash.png" kills the server
+type fakeEngine struct{ psm int }
+
+func (fakeEngine) Name() string { return "fake" }
+
+func (e fakeEngine) ImageToText(ctx context.Context, imagePath string) (string, error) {
+	return e.ImageToTextWithLanguages(ctx, imagePath, []string{"eng"})
+}
+
+func (e fakeEngine) ImageToTextWithLanguages(ctx context.Context, imagePath string, langs []string) (string, error) {
+	switch filepath.Base(imagePath) {
+	case "slow.png":
+		time.Sleep(time.Minute)
+	case "crash.png":
+		os.Exit(3)
+	case "bad.png":
+		return "", fmt.Errorf("unreadable image")
+	}
+	return fmt.Sprintf("%s %s psm %d pid %d", filepath.Base(imagePath), strings.Join(langs, "+"), e.psm, os.Getpid()), nil
+}
+
+func (e fakeEngine) WithConfig(config Config) Engine { return fakeEngine{psm: config.PSM} }
+
+func (fakeEngine) Prewarm(context.Context) (*Capabilities, error) {
+	return &Capabilities{Version: "fake 1.0", Languages: []string{"eng", "fra"}}, nil
+}
+
+func newTestPool(t *testing.T, size int) *PoolEngine {
+	t.Helper()
+	t.Setenv("OCR_POOL_TEST_SERVER", "1")
+	e, err := NewPoolEngine(PoolConfig{Command: []string{os.Args[0]}, Size: size, Timeout: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// processes returns the processes of the idle pool
+func (e *PoolEngine) processes() []*poolProcess {
+	procs := make([]*poolProcess, e.config.Size)
+	for i := range procs {
+		procs[i] = <-e.idle
+	}
+	for _, p := range procs {
+		e.idle <- p
+	}
+	return procs
+}
+
+// serverPID returns the pid reported in the text of fakeEngine
+func serverPID(t *testing.T, text string) int {
+	t.Helper()
+	f := strings.Fields(text)
+	pid, err := strconv.Atoi(f[len(f)-1])
+	if err != nil {
+		t.Fatalf("no pid in %q", text)
+	}
+	return pid
+}
+
+func TestPoolEngineLifecycle(t *testing.T) {
+	e := newTestPool(t, 2)
+	ctx := context.Background()
+	caps, err := e.Prewarm(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Engine != "pool" || caps.Version != "fake 1.0" || !caps.SupportsLanguage("fra") {
+		t.Errorf("capabilities = %+v", caps)
+	}
+	procs := e.processes()
+	for i, p := range procs {
+		if p == nil {
+			t.Fatalf("process %d not started by Prewarm", i)
+		}
+	}
+
+	text, err := e.ImageToTextWithLanguages(ctx, "/tmp/a.png", []string{"eng", "fra"})
+	if err != nil || !strings.HasPrefix(text, "a.png eng+fra psm 0 ") {
+		t.Fatalf("ImageToTextWithLanguages = %q, %v", text, err)
+	}
+	text, err = e.WithConfig(Config{PSM: 6}).ImageToText(ctx, "/tmp/b.png")
+	if err != nil || !strings.HasPrefix(text, "b.png eng psm 6 ") {
+		t.Fatalf("configured ImageToText = %q, %v", text, err)
+	}
+	// An error of the engine is returned, the process is kept
+	if _, err := e.ImageToText(ctx, "/tmp/bad.png"); err == nil || !strings.Contains(err.Error(), "unreadable image") {
+		t.Fatalf("bad image: %v", err)
+	}
+	if procs := e.processes(); procs[0] == nil || procs[1] == nil {
+		t.Errorf("process dropped after an engine error")
+	}
+
+	e.Close()
+	for i, p := range procs {
+		if p.cmd.ProcessState == nil {
+			t.Errorf("process %d still running after Close", i)
+		}
+	}
+}
+
+func TestPoolEngineRestart(t *testing.T) {
+	e := newTestPool(t, 1)
+	defer e.Close()
+	ctx := context.Background()
+
+	// Started on the first image without Prewarm
+	text, err := e.ImageToText(ctx, "/tmp/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := serverPID(t, text)
+
+	for _, tt := range []struct{ image, err string }{
+		{"/tmp/slow.png", "timed out"},
+		{"/tmp/crash.png", "is gone"},
+	} {
+		if _, err := e.ImageToText(ctx, tt.image); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: error %v, want %q", tt.image, err, tt.err)
+		}
+		if p := e.processes()[0]; p != nil {
+			t.Fatalf("%s: process kept in the pool", tt.image)
+		}
+		text, err := e.ImageToText(ctx, "/tmp/a.png")
+		if err != nil {
+			t.Fatalf("after %s: %v", tt.image, err)
+		}
+		if next := serverPID(t, text); next == pid {
+			t.Fatalf("after %s: answered by the same process %d", tt.image, pid)
+		} else {
+			pid = next
+		}
+	}
+
+	// A canceled request stops the process too
+	ctxCancel, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := e.ImageToText(ctxCancel, "/tmp/slow.png"); err != context.DeadlineExceeded {
+		t.Fatalf("canceled request: %v", err)
+	}
+	if p := e.processes()[0]; p != nil {
+		t.Fatal("canceled process kept in the pool")
+	}
+}
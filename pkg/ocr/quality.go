@@ -0,0 +1,68 @@
+package ocr
+
+import "strings"
+
+// ErrorRates compares OCR output with a reference text, usually the OCR text
+// corrected by a human
+type ErrorRates struct {
+	CER            float64 `json:"cer"` // Character error rate: CharErrors / ReferenceChars
+	WER            float64 `json:"wer"` // Word error rate: WordErrors / ReferenceWords
+	CharErrors     int     `json:"char_errors"`
+	ReferenceChars int     `json:"reference_chars"`
+	WordErrors     int     `json:"word_errors"`
+	ReferenceWords int     `json:"reference_words"`
+}
+
+// CompareText returns the edit distances (insertions, deletions and
+// substitutions) between the reference and the OCR output, in characters and
+// in words. Runs of whitespace count as a single space, so line breaks moved
+// by the correction are not errors. The rates may exceed 1 when the output
+// has many extra characters.
+func CompareText(reference, hypothesis string) ErrorRates {
+	refWords, hypWords := strings.Fields(reference), strings.Fields(hypothesis)
+	refChars := []rune(strings.Join(refWords, " "))
+	hypChars := []rune(strings.Join(hypWords, " "))
+
+	rates := ErrorRates{
+		CharErrors:     editDistance(refChars, hypChars),
+		ReferenceChars: len(refChars),
+		WordErrors:     editDistance(refWords, hypWords),
+		ReferenceWords: len(refWords),
+	}
+	rates.CER = errorRate(rates.CharErrors, rates.ReferenceChars)
+	rates.WER = errorRate(rates.WordErrors, rates.ReferenceWords)
+	return rates
+}
+
+func errorRate(errors, reference int) float64 {
+	if reference == 0 {
+		if errors == 0 {
+			return 0
+		}
+		return 1
+	}
+	return float64(errors) / float64(reference)
+}
+
+// editDistance is the Levenshtein distance between a and b, computed with a
+// single row (O(len(b)) memory)
+func editDistance[T comparable](a, b []T) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			above := row[j]
+			row[j] = min(row[j]+1, row[j-1]+1, diagonal+cost)
+			diagonal = above
+		}
+	}
+	return row[len(b)]
+}
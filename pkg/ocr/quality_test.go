@@ -0,0 +1,59 @@
+package ocr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"same", "same", 0},
+		{"Việt", "Viet", 1}, // Runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := editDistance([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance([]rune(tt.b), []rune(tt.a)); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d (not symmetric)", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestCompareText(t *testing.T) {
+	tests := []struct {
+		name                  string
+		reference, hypothesis string
+		charErrors, refChars  int
+		wordErrors, refWords  int
+		cer, wer              float64
+	}{
+		{"identical", "hello world", "hello world", 0, 11, 0, 2, 0, 0},
+		{"whitespace runs", "hello world", "hello \n\n  world\n", 0, 11, 0, 2, 0, 0},
+		{"one substitution", "hello world", "hallo world", 1, 11, 1, 2, 1.0 / 11, 0.5},
+		{"missing word", "the quick fox", "the fox", 6, 13, 1, 3, 6.0 / 13, 1.0 / 3},
+		{"extra output", "ab", "abcdef", 4, 2, 1, 1, 2, 1},
+		{"empty both", "", "  ", 0, 0, 0, 0, 0, 0},
+		{"empty reference", "", "noise", 5, 0, 1, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareText(tt.reference, tt.hypothesis)
+			if got.CharErrors != tt.charErrors || got.ReferenceChars != tt.refChars ||
+				got.WordErrors != tt.wordErrors || got.ReferenceWords != tt.refWords {
+				t.Errorf("CompareText(%q, %q) = %+v", tt.reference, tt.hypothesis, got)
+			}
+			if math.Abs(got.CER-tt.cer) > 1e-9 || math.Abs(got.WER-tt.wer) > 1e-9 {
+				t.Errorf("CompareText(%q, %q): CER %v, WER %v, want %v, %v", tt.reference, tt.hypothesis, got.CER, got.WER, tt.cer, tt.wer)
+			}
+		})
+	}
+}
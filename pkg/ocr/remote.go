@@ -0,0 +1,169 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInvalidCredentials is returned when the remote engine rejects the API key
+var ErrInvalidCredentials = errors.New("remote OCR engine rejected the credentials")
+
+// RemoteConfig configures an HTTP OCR service.
+//
+// The service exposes GET {URL}/capabilities returning Capabilities as JSON
+// and POST {URL}/ocr taking a multipart "image" field and returning {"text": "..."}.
+type RemoteConfig struct {
+	URL     string
+	APIKey  string        // Sent as "Authorization: Bearer <key>" (optional)
+	Timeout time.Duration // Per request, default 30s
+	Cache   CapabilityCache
+}
+
+// RemoteEngine calls a remote OCR service over HTTP
+type RemoteEngine struct {
+	config RemoteConfig
+	client *http.Client
+	caps   *Capabilities
+}
+
+// NewRemoteEngine creates a RemoteEngine. Call Prewarm before the first job.
+func NewRemoteEngine(config RemoteConfig) (*RemoteEngine, error) {
+	if _, err := url.ParseRequestURI(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid remote OCR URL %q: %w", config.URL, err)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &RemoteEngine{
+		config: config,
+		// One shared client keeps the connections opened by Prewarm alive for later jobs
+		client: &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: 8,
+				IdleConnTimeout:     5 * time.Minute,
+			},
+		},
+	}, nil
+}
+
+// Name implements Engine
+func (e *RemoteEngine) Name() string { return "remote" }
+
+// Prewarm opens a connection to the service, validates the credentials and
+// caches the provider capabilities. If the service is unreachable but a fresh
+// cached entry exists, the cached capabilities are used.
+func (e *RemoteEngine) Prewarm(ctx context.Context) (*Capabilities, error) {
+	caps, err := e.fetchCapabilities(ctx)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+		if cached := e.config.Cache.Load(e.config.URL); cached != nil {
+			log.Printf("OCR: Remote engine unreachable (%v), using cached capabilities from %s", err, cached.FetchedAt.Format(time.RFC3339))
+			e.caps = cached
+			return cached, nil
+		}
+		return nil, err
+	}
+	if err := e.config.Cache.Store(e.config.URL, caps); err != nil {
+		log.Printf("OCR: Failed to cache remote engine capabilities: %v", err)
+	}
+	e.caps = caps
+	return caps, nil
+}
+
+func (e *RemoteEngine) fetchCapabilities(ctx context.Context) (*Capabilities, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", e.config.URL+"/capabilities", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var caps Capabilities
+	if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+		return nil, fmt.Errorf("invalid capabilities response from remote OCR engine: %w", err)
+	}
+	caps.Engine = e.Name()
+	caps.FetchedAt = time.Now()
+	return &caps, nil
+}
+
+// ImageToText implements Engine
+func (e *RemoteEngine) ImageToText(ctx context.Context, imagePath string) (string, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image %s: %w", imagePath, err)
+	}
+	if e.caps != nil && e.caps.MaxImageBytes > 0 && int64(len(image)) > e.caps.MaxImageBytes {
+		return "", fmt.Errorf("image is %d bytes, remote OCR engine accepts at most %d", len(image), e.caps.MaxImageBytes)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("image", filepath.Base(imagePath))
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(image); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.config.URL+"/ocr", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := e.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid OCR response from remote engine: %w", err)
+	}
+	return result.Text, nil
+}
+
+// do sends the request with credentials and maps error statuses
+func (e *RemoteEngine) do(req *http.Request) (*http.Response, error) {
+	if e.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.config.APIKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("remote OCR request failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		resp.Body.Close()
+		return nil, ErrInvalidCredentials
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("remote OCR engine returned %s: %s", resp.Status, string(msg))
+	}
+	return resp, nil
+}
@@ -0,0 +1,100 @@
+package ocr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestService serves the remote OCR protocol; ocr replaces the /ocr handler
+func newTestService(t *testing.T, ocr http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(Capabilities{Version: "1.0", Languages: []string{"eng", "vie"}, MaxImageBytes: 16})
+	})
+	mux.HandleFunc("/ocr", ocr)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func writeImage(t *testing.T, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "page.png")
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRemoteEngine(t *testing.T) {
+	srv := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := r.FormFile("image"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"text": "xin chào"})
+	})
+	ctx := context.Background()
+
+	bad, err := NewRemoteEngine(RemoteConfig{URL: srv.URL, APIKey: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bad.Prewarm(ctx); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Prewarm with a wrong key: err = %v, want ErrInvalidCredentials", err)
+	}
+
+	engine, err := NewRemoteEngine(RemoteConfig{URL: srv.URL, APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, err := engine.Prewarm(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Engine != "remote" || !caps.SupportsLanguage("vie") {
+		t.Fatalf("capabilities = %+v", caps)
+	}
+
+	text, err := engine.ImageToText(ctx, writeImage(t, 8))
+	if err != nil || text != "xin chào" {
+		t.Fatalf("ImageToText = %q, %v", text, err)
+	}
+	if _, err := engine.ImageToText(ctx, writeImage(t, 17)); err == nil {
+		t.Fatal("ImageToText accepted an image above MaxImageBytes")
+	}
+}
+
+func TestRemoteEngineCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release // Never answers: only the caller's ctx ends the request
+	})
+	t.Cleanup(func() { close(release) }) // Runs before srv.Close
+	engine, err := NewRemoteEngine(RemoteConfig{URL: srv.URL, Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := engine.ImageToText(ctx, writeImage(t, 8)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request ran for %v after the context ended", elapsed)
+	}
+}
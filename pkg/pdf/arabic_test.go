@@ -0,0 +1,29 @@
+package pdf
+
+import "testing"
+
+func TestShapeArabic(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "", ""},
+		{"latin untouched", "abc 123", "abc 123"},
+		{"isolated", "ب", "\uFE8F"},
+		{"initial and final", "بب", "\uFE91\uFE90"},
+		{"medial", "ببب", "\uFE91\uFE92\uFE90"},
+		{"space breaks joining", "ب ب", "\uFE8F \uFE8F"},
+		{"right-joining only", "دب", "\uFEA9\uFE8F"},
+		{"joins into right-joining", "بد", "\uFE91\uFEAA"},
+		{"lam-alef isolated", "لا", "\uFEFB"},
+		{"lam-alef final", "بلا", "\uFE91\uFEFC"},
+		{"haraka is transparent", "بَب", "\uFE91\u064E\uFE90"},
+		{"persian letter", "پب", "\uFB58\uFE90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shapeArabic(tt.in); got != tt.want {
+				t.Errorf("shapeArabic(%+q) = %+q, want %+q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Section is one source document of a combined PDF
+type Section struct {
+	Title    string // Header of the section and entry of the table of contents, e.g. the source file name
+	Subtitle string // Printed below the header (optional), e.g. the job ID
+	Text     string // Content; PageBreak starts a new page
+}
+
+// CreateCombinedPDFTo writes to w a single document made of sections: a
+// table of contents titled title, then every section on its own pages below
+// its header. The entries of the table of contents link to their section,
+// which is also added to the document outline. Of config, only Template,
+// JobID, Date, Fonts and Language apply.
+func CreateCombinedPDFTo(w io.Writer, title string, sections []Section, config Config) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+
+	fonts := config.Fonts
+	if fonts == nil {
+		fonts = DefaultFontRegistry()
+	}
+	texts := make([]string, 0, len(sections))
+	for _, section := range sections {
+		texts = append(texts, section.Text)
+	}
+	script := DetectScript(strings.Join(texts, "\n"))
+	if config.Language != "" {
+		script = ScriptForLanguage(config.Language)
+	}
+	fontName, err := fonts.register(pdf, script)
+	if err != nil {
+		return err
+	}
+	titleStyle := fonts.style(fontName, "B")
+
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetLeftMargin(15)
+	pdf.SetRightMargin(15)
+	pdf.SetTopMargin(15)
+	if config.Template != nil {
+		config.Template.apply(pdf, fontName, config.JobID, config.date())
+	}
+	pdf.AddPage()
+	if config.Template != nil && config.Template.CoverPage {
+		config.Template.writeCover(pdf, fontName, titleStyle, config.JobID, config.date())
+		pdf.AddPage()
+	}
+
+	// Table of contents: the page of a section is only known once it is
+	// written, the entries hold an alias replaced when the document is closed
+	pdf.SetFont(fontName, titleStyle, 18)
+	pdf.MultiCell(0, 9, title, "", "L", false)
+	pdf.Ln(4)
+	pdf.SetFont(fontName, titleStyle, 13)
+	pdf.CellFormat(0, 8, "Contents", "", 1, "L", false, 0, "")
+	pdf.SetFont(fontName, "", 11)
+	links := make([]int, len(sections))
+	for i, section := range sections {
+		links[i] = pdf.AddLink()
+		entry := fmt.Sprintf("%d. %s", i+1, section.Title)
+		pdf.CellFormat(textWidth(pdf)-15, 7, entry, "", 0, "L", false, links[i], "")
+		pdf.CellFormat(15, 7, sectionAlias(i), "", 1, "R", false, links[i], "")
+	}
+
+	for i, section := range sections {
+		pdf.AddPage()
+		pdf.SetLink(links[i], 0, -1)
+		pdf.RegisterAlias(sectionAlias(i), strconv.Itoa(pdf.PageNo()))
+		pdf.Bookmark(section.Title, 0, -1)
+		pdf.SetFont(fontName, titleStyle, 16)
+		pdf.MultiCell(0, 8, fmt.Sprintf("%d. %s", i+1, section.Title), "", "L", false)
+		if section.Subtitle != "" {
+			pdf.SetFont(fontName, "", 9)
+			pdf.MultiCell(0, 5, section.Subtitle, "", "L", false)
+		}
+		pdf.Ln(4)
+		pdf.SetFont(fontName, "", 11)
+		for p, page := range strings.Split(section.Text, PageBreak) {
+			if p > 0 {
+				pdf.AddPage()
+			}
+			writeText(pdf, page, script)
+		}
+	}
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("failed to build PDF: %w", err)
+	}
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+// sectionAlias is the placeholder of the page number of section i in the
+// table of contents
+func sectionAlias(i int) string {
+	return fmt.Sprintf("{section%d}", i+1)
+}
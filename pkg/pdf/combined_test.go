@@ -0,0 +1,45 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCreateCombinedPDF(t *testing.T) {
+	fonts := DefaultFontRegistry()
+	fonts.Dir = "../../font"
+	sections := []Section{
+		{Title: "first.png", Text: "Alpha text"},
+		{Title: "second.png", Subtitle: "job-2", Text: "Beta page one" + PageBreak + "Beta page two"},
+		{Title: "third.png", Text: "Gamma text"},
+	}
+	var out bytes.Buffer
+	if err := CreateCombinedPDFTo(&out, "Batch scans.zip", sections, Config{Fonts: fonts}); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := ExtractText(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Contents, first, second (2 pages), third
+	if len(pages) != 5 {
+		t.Fatalf("%d pages, want 5: %q", len(pages), pages)
+	}
+	for _, want := range []string{"Contents", "1. first.png", "2. second.png", "3. third.png"} {
+		if !strings.Contains(pages[0], want) {
+			t.Errorf("table of contents %q lacks %q", pages[0], want)
+		}
+	}
+	if strings.Contains(pages[0], "{section") {
+		t.Errorf("page aliases not replaced: %q", pages[0])
+	}
+	for _, p := range []struct {
+		page int
+		want string
+	}{{1, "1. first.png"}, {2, "2. second.png"}, {2, "job-2"}, {3, "Beta page two"}, {4, "3. third.png"}} {
+		if !strings.Contains(pages[p.page], p.want) {
+			t.Errorf("page %d = %q, want %q", p.page+1, pages[p.page], p.want)
+		}
+	}
+}
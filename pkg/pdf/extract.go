@@ -0,0 +1,505 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// ExtractText reads the text layer of a PDF and returns the text of each
+// page. Lines are separated by "\n" and paragraphs (lines further apart than
+// the usual line spacing) by "\n\n". Pages without text are empty strings; a
+// scanned document therefore returns only empty pages.
+//
+// The extractor handles the PDFs written by this package and common
+// born-digital documents (simple and Type0 fonts with ToUnicode maps,
+// object streams, Flate compression). It does not reorder text drawn out of
+// reading order, and does not decrypt encrypted files (ErrEncrypted).
+func ExtractText(data []byte) ([]string, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	var catalog pdfDict
+	for _, t := range doc.trailers {
+		if c := doc.dict(t["Root"]); c != nil {
+			catalog = c
+		}
+	}
+	if catalog == nil {
+		for _, obj := range doc.objects {
+			if d := doc.dict(obj); d != nil && d["Type"] == pdfName("Catalog") {
+				catalog = d
+				break
+			}
+		}
+	}
+	if catalog == nil {
+		return nil, fmt.Errorf("PDF has no document catalog")
+	}
+
+	var pages []string
+	visited := map[int]bool{} // Page tree nodes, which a damaged file can make cyclic
+	var walk func(node pdfDict, resources interface{}, depth int)
+	walk = func(node pdfDict, resources interface{}, depth int) {
+		if node == nil || depth > 64 {
+			return
+		}
+		if r, ok := node["Resources"]; ok {
+			resources = r // Inherited by the kids
+		}
+		kids, isTree := doc.resolve(node["Kids"]).(pdfArray)
+		if !isTree {
+			pages = append(pages, doc.pageText(node, doc.dict(resources)))
+			return
+		}
+		for _, kid := range kids {
+			if ref, ok := kid.(pdfRef); ok {
+				if visited[ref.num] {
+					continue
+				}
+				visited[ref.num] = true
+			}
+			walk(doc.dict(kid), resources, depth+1)
+		}
+	}
+	walk(doc.dict(catalog["Pages"]), nil, 0)
+	return pages, nil
+}
+
+// ExtractTextFile reads the text layer of the PDF file at path
+func ExtractTextFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractText(data)
+}
+
+// pageText extracts the text of one page
+func (d *pdfDocument) pageText(page pdfDict, resources pdfDict) string {
+	var content []byte
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = d.decodeStream(c)
+	case pdfArray:
+		for _, part := range c {
+			if len(content) > maxDecodedStream {
+				break
+			}
+			if s, ok := d.resolve(part).(*pdfStream); ok {
+				if data, err := d.decodeStream(s); err == nil {
+					content = append(append(content, data...), '\n')
+				}
+			}
+		}
+	}
+	w := &textWriter{decoded: len(content)}
+	d.runContent(content, resources, w, 0)
+	return w.String()
+}
+
+// textRun is a string drawn at a position of the page
+type textRun struct {
+	x, y float64
+	text string
+}
+
+// textWriter collects the runs of a page and assembles them into lines
+type textWriter struct {
+	runs    []textRun
+	decoded int // Content bytes of the page and its forms, capped at maxDecodedStream
+}
+
+func (w *textWriter) add(x, y float64, text string) {
+	if text != "" {
+		w.runs = append(w.runs, textRun{x: x, y: y, text: text})
+	}
+}
+
+// String joins the runs into lines (same baseline) and paragraphs (gaps
+// larger than the usual line spacing)
+func (w *textWriter) String() string {
+	type line struct {
+		y    float64
+		text strings.Builder
+	}
+	var lines []*line
+	var lastX float64
+	for _, r := range w.runs {
+		if len(lines) == 0 || math.Abs(lines[len(lines)-1].y-r.y) > 1 {
+			lines = append(lines, &line{y: r.y})
+		} else if cur := &lines[len(lines)-1].text; r.x > lastX && cur.Len() > 0 &&
+			!strings.HasSuffix(cur.String(), " ") && !strings.HasPrefix(r.text, " ") {
+			// Separately positioned run further right on the same line
+			cur.WriteByte(' ')
+		}
+		lines[len(lines)-1].text.WriteString(r.text)
+		lastX = r.x
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	// The most frequent gap between consecutive lines is the line spacing
+	var gaps []float64
+	for i := 1; i < len(lines); i++ {
+		if gap := lines[i-1].y - lines[i].y; gap > 0 {
+			gaps = append(gaps, math.Round(gap))
+		}
+	}
+	spacing := modeOf(gaps)
+
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			gap := lines[i-1].y - l.y
+			if spacing > 0 && (gap > spacing*1.3 || gap < 0) {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString(strings.TrimRight(l.text.String(), " "))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func modeOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	best, bestCount, count := values[0], 0, 0
+	for i, v := range values {
+		if i > 0 && v == values[i-1] {
+			count++
+		} else {
+			count = 1
+		}
+		if count > bestCount {
+			best, bestCount = v, count
+		}
+	}
+	return best
+}
+
+// runContent interprets the text operators of a content stream. Form
+// XObjects are interpreted recursively with their own resources.
+func (d *pdfDocument) runContent(content []byte, resources pdfDict, w *textWriter, depth int) {
+	if depth > 8 {
+		return
+	}
+	fonts := map[string]*fontDecoder{}
+	fontFor := func(name string) *fontDecoder {
+		if f, ok := fonts[name]; ok {
+			return f
+		}
+		f := d.newFontDecoder(d.dict(d.dict(resources["Font"])[name]))
+		fonts[name] = f
+		return f
+	}
+
+	var (
+		font         = &fontDecoder{codeBytes: 1}
+		lineX, lineY float64 // Start of the current line (text line matrix)
+		x, y         float64 // Current position, advanced by Td/TD/T*
+		leading      float64
+		operands     []interface{}
+		showString   = func(s pdfString) { w.add(x, y, font.decode(s)) }
+		nextLine     = func() { lineY -= leading; x, y = lineX, lineY }
+		number       = func(i int) float64 {
+			if i < len(operands) {
+				if f, ok := operands[i].(float64); ok {
+					return f
+				}
+			}
+			return 0
+		}
+	)
+
+	p := &parser{data: content}
+	for {
+		obj, err := p.parseObject()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "BT":
+			lineX, lineY, x, y = 0, 0, 0, 0
+		case "Tf":
+			if name, ok := firstName(operands); ok {
+				font = fontFor(name)
+			}
+		case "TL":
+			leading = number(0)
+		case "Td", "TD":
+			lineX += number(0)
+			lineY += number(1)
+			if op == "TD" {
+				leading = -number(1)
+			}
+			x, y = lineX, lineY
+		case "Tm":
+			lineX, lineY = number(4), number(5)
+			x, y = lineX, lineY
+		case "T*":
+			nextLine()
+		case "Tj":
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					showString(s)
+				}
+			}
+		case "'", "\"":
+			nextLine()
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					showString(s)
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				if arr, ok := operands[len(operands)-1].(pdfArray); ok {
+					var b strings.Builder
+					for _, item := range arr {
+						switch v := item.(type) {
+						case pdfString:
+							b.WriteString(font.decode(v))
+						case float64:
+							// Large negative adjustments (thousandths of an em) are word gaps
+							if v < -200 && b.Len() > 0 && !strings.HasSuffix(b.String(), " ") {
+								b.WriteByte(' ')
+							}
+						}
+					}
+					w.add(x, y, b.String())
+				}
+			}
+		case "Do":
+			if name, ok := firstName(operands); ok {
+				xobj, _ := d.resolve(d.dict(resources["XObject"])[name]).(*pdfStream)
+				if xobj != nil && xobj.dict["Subtype"] == pdfName("Form") {
+					formResources := d.dict(xobj.dict["Resources"])
+					if formResources == nil {
+						formResources = resources
+					}
+					// Forms drawn many times each count, so a few nested
+					// forms cannot multiply into an endless page
+					if data, err := d.decodeStream(xobj); err == nil && w.decoded+len(data) <= maxDecodedStream {
+						w.decoded += len(data)
+						d.runContent(data, formResources, w, depth+1)
+					}
+				}
+			}
+		case "ID":
+			// Inline image data: skip to the EI operator
+			if end := bytes.Index(content[p.pos:], []byte("EI")); end >= 0 {
+				p.pos += end + 2
+			} else {
+				return
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func firstName(operands []interface{}) (string, bool) {
+	for _, o := range operands {
+		if n, ok := o.(pdfName); ok {
+			return string(n), true
+		}
+	}
+	return "", false
+}
+
+// fontDecoder maps the character codes of a font to Unicode
+type fontDecoder struct {
+	codeBytes int // 1 for simple fonts, 2 for Type0 (CID) fonts
+	cmap      *toUnicodeMap
+}
+
+func (d *pdfDocument) newFontDecoder(font pdfDict) *fontDecoder {
+	f := &fontDecoder{codeBytes: 1}
+	if font == nil {
+		return f
+	}
+	if font["Subtype"] == pdfName("Type0") {
+		f.codeBytes = 2
+	}
+	if s, ok := d.resolve(font["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(s); err == nil {
+			f.cmap = parseToUnicode(data)
+			if f.cmap.codeBytes > 0 {
+				f.codeBytes = f.cmap.codeBytes
+			}
+		}
+	}
+	return f
+}
+
+func (f *fontDecoder) decode(s pdfString) string {
+	step := max(f.codeBytes, 1)
+	var b strings.Builder
+	for i := 0; i+step <= len(s); i += step {
+		code := uint32(s[i])
+		if step == 2 {
+			code = code<<8 | uint32(s[i+1])
+		}
+		if f.cmap != nil {
+			if text, ok := f.cmap.lookup(code); ok {
+				b.WriteString(text)
+				continue
+			}
+		}
+		switch {
+		case step == 2:
+			// No map: assume the codes are UTF-16 (Identity encoding of Unicode fonts)
+			b.WriteRune(rune(code))
+		case code >= 0x80 && code < 0xa0:
+			b.WriteRune(winAnsiHigh[code-0x80])
+		default:
+			b.WriteRune(rune(code)) // Latin-1 / WinAnsi
+		}
+	}
+	return b.String()
+}
+
+// winAnsiHigh is the WinAnsiEncoding of 0x80-0x9F, where it differs from Latin-1
+var winAnsiHigh = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// toUnicodeMap is a parsed ToUnicode CMap
+type toUnicodeMap struct {
+	codeBytes int
+	chars     map[uint32]string
+	ranges    []cmapRange
+}
+
+type cmapRange struct {
+	lo, hi uint32
+	start  []uint16 // Destination of lo; the last unit increments across the range
+	list   []string // Explicit destinations, if given as an array
+}
+
+func (m *toUnicodeMap) lookup(code uint32) (string, bool) {
+	if s, ok := m.chars[code]; ok {
+		return s, true
+	}
+	for _, r := range m.ranges {
+		if code < r.lo || code > r.hi {
+			continue
+		}
+		offset := code - r.lo
+		if r.list != nil {
+			if int(offset) < len(r.list) {
+				return r.list[offset], true
+			}
+			return "", false
+		}
+		units := append([]uint16(nil), r.start...)
+		if len(units) > 0 {
+			units[len(units)-1] += uint16(offset)
+		}
+		return string(utf16.Decode(units)), true
+	}
+	return "", false
+}
+
+// parseToUnicode reads the codespace, bfchar and bfrange sections of a CMap
+func parseToUnicode(data []byte) *toUnicodeMap {
+	m := &toUnicodeMap{chars: map[uint32]string{}}
+	p := &parser{data: data}
+	var operands []interface{}
+	section := ""
+	for {
+		obj, err := p.next()
+		if err != nil {
+			return m
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			if section != "" {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+		switch kw {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			section = string(kw)
+			operands = operands[:0]
+		case "[", "]":
+			// Arrays are read by next() as a whole; stray brackets are ignored
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if s, ok := operands[0].(pdfString); ok && m.codeBytes == 0 {
+					m.codeBytes = len(s)
+				}
+			}
+			section = ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m.chars[codeOf(src)] = utf16String(dst)
+				}
+			}
+			section = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				r := cmapRange{lo: codeOf(lo), hi: codeOf(hi)}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					r.start = utf16Units(dst)
+				case pdfArray:
+					for _, item := range dst {
+						s, _ := item.(pdfString)
+						r.list = append(r.list, utf16String(s))
+					}
+				}
+				m.ranges = append(m.ranges, r)
+			}
+			section = ""
+		}
+	}
+}
+
+func codeOf(s pdfString) uint32 {
+	var code uint32
+	for _, c := range s {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func utf16Units(s pdfString) []uint16 {
+	if len(s) == 1 {
+		return []uint16{uint16(s[0])}
+	}
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return units
+}
+
+func utf16String(s pdfString) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
@@ -0,0 +1,196 @@
+package pdf
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Scripts supported by the font registry
+const (
+	ScriptLatin      = "latin"
+	ScriptCJK        = "cjk"
+	ScriptArabic     = "arabic"
+	ScriptHebrew     = "hebrew"
+	ScriptDevanagari = "devanagari"
+)
+
+// FontFamily is a TrueType family with optional style variants.
+// File names are relative to the registry directory.
+type FontFamily struct {
+	Name       string `json:"name"`
+	Regular    string `json:"regular"`
+	Bold       string `json:"bold,omitempty"`
+	Italic     string `json:"italic,omitempty"`
+	BoldItalic string `json:"bold_italic,omitempty"`
+}
+
+// FontRegistry maps scripts to the font family used to render them
+type FontRegistry struct {
+	Dir      string                `json:"dir"`
+	Families map[string]FontFamily `json:"families"` // Keyed by script (ScriptLatin, ScriptCJK, ...)
+	builtin  bool                  // Latin family embedded in the binary, no files
+}
+
+//go:embed font/Roboto-Regular.ttf
+var builtinFont []byte
+
+// DefaultFontRegistry returns the registry used when a deployment does not
+// configure one: Roboto from the "font" directory for Latin text
+func DefaultFontRegistry() *FontRegistry {
+	return &FontRegistry{
+		Dir: "font",
+		Families: map[string]FontFamily{
+			ScriptLatin: {Name: "Roboto", Regular: "Roboto-Regular.ttf"},
+		},
+	}
+}
+
+// BuiltinFontRegistry returns a registry with Roboto embedded in the binary,
+// the fallback when the font files of a deployment are missing. It only
+// covers Latin text (including Vietnamese).
+func BuiltinFontRegistry() *FontRegistry {
+	return &FontRegistry{
+		Families: map[string]FontFamily{
+			ScriptLatin: {Name: "Roboto", Regular: "Roboto-Regular.ttf"},
+		},
+		builtin: true,
+	}
+}
+
+// LoadFontRegistry reads a FontRegistry from a JSON file.
+// An empty dir in the file defaults to the directory of the file itself.
+func LoadFontRegistry(path string) (*FontRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font registry %s: %w", path, err)
+	}
+	reg := &FontRegistry{}
+	if err := json.Unmarshal(data, reg); err != nil {
+		return nil, fmt.Errorf("failed to parse font registry %s: %w", path, err)
+	}
+	if reg.Dir == "" {
+		reg.Dir = filepath.Dir(path)
+	}
+	if _, ok := reg.Families[ScriptLatin]; !ok {
+		return nil, fmt.Errorf("font registry %s has no %q family", path, ScriptLatin)
+	}
+	return reg, reg.Validate()
+}
+
+// Validate checks that every configured font file exists
+func (r *FontRegistry) Validate() error {
+	for script, family := range r.Families {
+		if family.Name == "" || family.Regular == "" {
+			return fmt.Errorf("font family for script %q needs a name and a regular file", script)
+		}
+		if r.builtin {
+			continue
+		}
+		for _, file := range family.files() {
+			if _, err := os.Stat(filepath.Join(r.Dir, file)); err != nil {
+				return fmt.Errorf("font file for script %q: %w", script, err)
+			}
+		}
+	}
+	return nil
+}
+
+// files returns the configured font files of the family
+func (f FontFamily) files() []string {
+	files := []string{f.Regular}
+	for _, file := range []string{f.Bold, f.Italic, f.BoldItalic} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// ScriptForLanguage maps an ISO 639-1 language code to the script of its text
+func ScriptForLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	switch lang {
+	case "zh", "ja", "ko":
+		return ScriptCJK
+	case "ar", "fa", "ur", "ps":
+		return ScriptArabic
+	case "he", "yi":
+		return ScriptHebrew
+	case "hi", "mr", "ne", "sa":
+		return ScriptDevanagari
+	}
+	return ScriptLatin
+}
+
+// DetectScript returns the non-Latin script used by text, or ScriptLatin
+// if the text contains none of the scripts known to the registry
+func DetectScript(text string) string {
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			return ScriptCJK
+		case unicode.Is(unicode.Arabic, r):
+			return ScriptArabic
+		case unicode.Is(unicode.Hebrew, r):
+			return ScriptHebrew
+		case unicode.Is(unicode.Devanagari, r):
+			return ScriptDevanagari
+		}
+	}
+	return ScriptLatin
+}
+
+// register adds the family for the given script to the document and
+// returns its font name. It fails with a clear error when the registry has
+// no font for the script instead of rendering empty boxes.
+func (r *FontRegistry) register(pdf *gofpdf.Fpdf, script string) (string, error) {
+	family, ok := r.Families[script]
+	if !ok {
+		return "", fmt.Errorf("no font registered for %s script (add a %q family to the font registry)", script, script)
+	}
+	if r.builtin {
+		pdf.AddUTF8FontFromBytes(family.Name, "", builtinFont)
+		return family.Name, pdf.Error()
+	}
+	pdf.SetFontLocation(r.Dir)
+	pdf.AddUTF8Font(family.Name, "", family.Regular)
+	if family.Bold != "" {
+		pdf.AddUTF8Font(family.Name, "B", family.Bold)
+	}
+	if family.Italic != "" {
+		pdf.AddUTF8Font(family.Name, "I", family.Italic)
+	}
+	if family.BoldItalic != "" {
+		pdf.AddUTF8Font(family.Name, "BI", family.BoldItalic)
+	}
+	if err := pdf.Error(); err != nil {
+		return "", fmt.Errorf("failed to load %s font %q from %s: %w", script, family.Name, r.Dir, err)
+	}
+	return family.Name, nil
+}
+
+// style returns the requested style if the family has it, or regular otherwise
+func (r *FontRegistry) style(fontName, style string) string {
+	for _, family := range r.Families {
+		if family.Name != fontName {
+			continue
+		}
+		switch {
+		case style == "B" && family.Bold != "",
+			style == "I" && family.Italic != "",
+			style == "BI" && family.BoldItalic != "":
+			return style
+		}
+	}
+	return ""
+}
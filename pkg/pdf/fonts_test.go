@@ -0,0 +1,39 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinFontRegistry(t *testing.T) {
+	missing := DefaultFontRegistry()
+	missing.Dir = t.TempDir()
+	if err := missing.Validate(); err == nil {
+		t.Fatal("Validate accepted a directory without the font")
+	}
+
+	fonts := BuiltinFontRegistry()
+	if err := fonts.Validate(); err != nil {
+		t.Fatalf("Validate = %v", err)
+	}
+	var out bytes.Buffer
+	sections := []Section{{Title: "scan.png", Text: "Hóa đơn đã thanh toán"}}
+	if err := CreateCombinedPDFTo(&out, "Scans", sections, Config{Fonts: fonts}); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := ExtractText(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || !strings.Contains(pages[1], "Hóa đơn đã thanh toán") {
+		t.Errorf("pages = %q, want the Vietnamese text", pages)
+	}
+
+	// Only Latin text is covered
+	out.Reset()
+	err = CreateCombinedPDFTo(&out, "Scans", sections, Config{Fonts: fonts, Language: "ja"})
+	if err == nil || !strings.Contains(err.Error(), "no font registered for cjk script") {
+		t.Errorf("CreateCombinedPDFTo in Japanese = %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package pdf
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// writeParagraph writes one paragraph with the line-breaking and direction
+// rules of its script. Latin text keeps using MultiCell.
+func writeParagraph(pdf *gofpdf.Fpdf, paragraph, script string, lineHeight float64) {
+	switch script {
+	case ScriptCJK:
+		for _, line := range wrapCJK(pdf, paragraph, textWidth(pdf)) {
+			pdf.CellFormat(0, lineHeight, line, "", 1, "L", false, 0, "")
+		}
+	case ScriptArabic, ScriptHebrew:
+		if script == ScriptArabic {
+			paragraph = shapeArabic(paragraph)
+		}
+		for _, line := range wrapWords(pdf, paragraph, textWidth(pdf)) {
+			pdf.CellFormat(0, lineHeight, visualOrder(line), "", 1, "R", false, 0, "")
+		}
+	default:
+		pdf.MultiCell(0, lineHeight, paragraph, "", "", false)
+	}
+}
+
+// textWidth returns the width available between the page margins
+func textWidth(pdf *gofpdf.Fpdf) float64 {
+	pageW, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	return pageW - left - right
+}
+
+// wrapWords breaks text at spaces so every line fits in width.
+// Words longer than a line are broken between characters.
+func wrapWords(pdf *gofpdf.Fpdf, text string, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if pdf.GetStringWidth(candidate) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = ""
+		for _, r := range word {
+			if line != "" && pdf.GetStringWidth(line+string(r)) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// CJK punctuation that must not start a line (kinsoku shori)
+const cjkNoLineStart = "、。，．・：；？！）〕］｝〉》」』】〙〗〟’”ゝゞーァィゥェォッャュョヮヵヶぁぃぅぇぉっゃゅょゎゕゖㇰㇱㇲㇳㇴㇵㇶㇷㇸㇹㇺㇻㇼㇽㇾㇿ々〻‐゠–〜?!‼⁇⁈⁉・,.:;)]}"
+
+// CJK punctuation that must not end a line
+const cjkNoLineEnd = "（〔［｛〈《「『【〘〖〝‘“([{"
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		strings.ContainsRune(cjkNoLineStart, r) || strings.ContainsRune(cjkNoLineEnd, r)
+}
+
+// wrapCJK breaks text between any two CJK characters (CJK text has no
+// spaces), keeps Latin words whole and applies the kinsoku rules: closing
+// punctuation hangs on the previous line and opening brackets move to the next.
+func wrapCJK(pdf *gofpdf.Fpdf, text string, width float64) []string {
+	// Split into unbreakable units: single CJK characters or Latin words,
+	// trailing spaces stay with the unit before them
+	var units []string
+	for _, r := range text {
+		n := len(units)
+		switch {
+		case n > 0 && unicode.IsSpace(r):
+			units[n-1] += " "
+		case n > 0 && !isCJK(r) && !strings.HasSuffix(units[n-1], " ") && !isCJK(lastRune(units[n-1])):
+			units[n-1] += string(r)
+		case !unicode.IsSpace(r):
+			units = append(units, string(r))
+		}
+	}
+
+	var lines []string
+	line := ""
+	for _, unit := range units {
+		if line == "" || pdf.GetStringWidth(line+strings.TrimRight(unit, " ")) <= width {
+			line += unit
+			continue
+		}
+		first := []rune(unit)[0]
+		if strings.ContainsRune(cjkNoLineStart, first) {
+			// Hang closing punctuation in the margin instead of starting a line with it
+			line += unit
+			continue
+		}
+		next := ""
+		if last := lastRune(strings.TrimRight(line, " ")); strings.ContainsRune(cjkNoLineEnd, last) {
+			// Move the opening bracket to the next line
+			trimmed := strings.TrimRight(line, " ")
+			line = strings.TrimSuffix(trimmed, string(last))
+			next = string(last)
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " "))
+		}
+		line = next + unit
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return lines
+}
+
+func lastRune(s string) rune {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return 0
+	}
+	return runes[len(runes)-1]
+}
+
+// Bidi classes used by visualOrder
+const (
+	bidiNeutral = iota
+	bidiLTR
+	bidiRTL
+)
+
+func bidiClass(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Arabic, unicode.Hebrew) || (r >= 0xFB1D && r <= 0xFEFC):
+		return bidiRTL
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		return bidiLTR
+	}
+	return bidiNeutral
+}
+
+// Brackets are mirrored when a right-to-left run is reversed
+var bidiMirror = map[rune]rune{'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{', '<': '>', '>': '<', '«': '»', '»': '«'}
+
+// visualOrder converts a logical right-to-left line to the left-to-right
+// drawing order of the PDF: the line is reversed, except runs of Latin
+// words and numbers which keep their own order. This is a simplified
+// bidi algorithm for a right-to-left paragraph.
+func visualOrder(line string) string {
+	runes := []rune(line)
+	classes := make([]int, len(runes))
+	for i, r := range runes {
+		classes[i] = bidiClass(r)
+	}
+	// Neutrals between two left-to-right characters join the LTR run,
+	// all other neutrals follow the paragraph direction
+	for i := range classes {
+		if classes[i] != bidiNeutral {
+			continue
+		}
+		prev, next := bidiRTL, bidiRTL
+		for j := i - 1; j >= 0; j-- {
+			if classes[j] != bidiNeutral {
+				prev = classes[j]
+				break
+			}
+		}
+		for j := i + 1; j < len(classes); j++ {
+			if classes[j] != bidiNeutral {
+				next = classes[j]
+				break
+			}
+		}
+		if prev == bidiLTR && next == bidiLTR {
+			classes[i] = bidiLTR
+		} else {
+			classes[i] = bidiRTL
+		}
+	}
+
+	out := make([]rune, 0, len(runes))
+	for end := len(runes); end > 0; {
+		start := end - 1
+		for start > 0 && classes[start-1] == classes[end-1] {
+			start--
+		}
+		if classes[end-1] == bidiLTR {
+			out = append(out, runes[start:end]...)
+		} else {
+			for i := end - 1; i >= start; i-- {
+				r := runes[i]
+				if m, ok := bidiMirror[r]; ok {
+					r = m
+				}
+				out = append(out, r)
+			}
+		}
+		end = start
+	}
+	return string(out)
+}
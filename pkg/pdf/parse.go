@@ -0,0 +1,528 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// Minimal PDF object parser, enough to read the text layer of a document:
+// it indexes the "N G obj" definitions of the file (the last definition of
+// an object wins, as with incremental updates), expands object streams and
+// decodes Flate, ASCIIHex and ASCII85 streams. Cross-reference tables are
+// not needed and not read.
+
+// ErrEncrypted is returned for encrypted PDFs, whose text cannot be read
+var ErrEncrypted = errors.New("PDF is encrypted")
+
+// Limits on untrusted input: a few bytes of "[" or "<<" would otherwise
+// exhaust the stack, and a small Flate stream can inflate to gigabytes.
+const (
+	maxNesting       = 64       // Nested arrays and dictionaries
+	maxDecodedStream = 32 << 20 // Bytes of one decoded stream
+)
+
+var (
+	errTooDeep       = fmt.Errorf("objects nested deeper than %d levels", maxNesting)
+	errStreamTooLong = fmt.Errorf("decoded stream larger than %d bytes", maxDecodedStream)
+)
+
+type (
+	pdfName   string
+	pdfString []byte
+	pdfArray  []interface{}
+	pdfDict   map[string]interface{}
+	pdfRef    struct{ num, gen int }
+	pdfStream struct {
+		dict pdfDict
+		raw  []byte
+	}
+	pdfKeyword string // Content stream operators, true, false, null, ...
+)
+
+// pdfDocument holds the parsed objects of a file
+type pdfDocument struct {
+	objects  map[int]interface{}
+	trailers []pdfDict
+}
+
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parseDocument indexes every object of data
+func parseDocument(data []byte) (*pdfDocument, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	doc := &pdfDocument{objects: map[int]interface{}{}}
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		p := &parser{data: data, pos: m[1]}
+		obj, err := p.parseObject()
+		if err != nil {
+			continue // Damaged object, the text may still be readable elsewhere
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			p.skipSpace()
+			if p.hasKeyword("stream") {
+				obj = p.readStream(dict)
+			}
+		}
+		doc.objects[num] = obj
+	}
+
+	// Classic trailers, and cross-reference streams that replace them
+	for i := 0; ; {
+		idx := bytes.Index(data[i:], []byte("trailer"))
+		if idx < 0 {
+			break
+		}
+		p := &parser{data: data, pos: i + idx + len("trailer")}
+		if obj, err := p.parseObject(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				doc.trailers = append(doc.trailers, dict)
+			}
+		}
+		i += idx + len("trailer")
+	}
+	for _, obj := range doc.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("XRef") {
+			doc.trailers = append(doc.trailers, s.dict)
+		}
+	}
+	for _, t := range doc.trailers {
+		if _, ok := t["Encrypt"]; ok {
+			return nil, ErrEncrypted
+		}
+	}
+
+	doc.expandObjectStreams()
+	return doc, nil
+}
+
+// expandObjectStreams adds the objects stored in object streams (PDF 1.5+)
+func (d *pdfDocument) expandObjectStreams() {
+	var streams []*pdfStream
+	for _, obj := range d.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, s)
+		}
+	}
+	for _, s := range streams {
+		data, err := d.decodeStream(s)
+		if err != nil {
+			continue
+		}
+		n, _ := d.resolve(s.dict["N"]).(float64)
+		first, _ := d.resolve(s.dict["First"]).(float64)
+		if first < 0 || first >= float64(len(data)) {
+			continue
+		}
+		header := &parser{data: data}
+		for i := 0; i < int(n); i++ {
+			numObj, err1 := header.parseObject()
+			offObj, err2 := header.parseObject()
+			num, ok1 := numObj.(float64)
+			off, ok2 := offObj.(float64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			if off < 0 || first+off >= float64(len(data)) {
+				continue
+			}
+			if _, defined := d.objects[int(num)]; defined {
+				continue // Defined directly in the file (later update)
+			}
+			p := &parser{data: data, pos: int(first) + int(off)}
+			if obj, err := p.parseObject(); err == nil {
+				d.objects[int(num)] = obj
+			}
+		}
+	}
+}
+
+// resolve follows references
+func (d *pdfDocument) resolve(obj interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.objects[ref.num]
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(obj interface{}) pdfDict {
+	switch v := d.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decodeStream applies the filters of s
+func (d *pdfDocument) decodeStream(s *pdfStream) ([]byte, error) {
+	data := s.raw
+	var filters []interface{}
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{f}
+	case pdfArray:
+		filters = f
+	}
+	for _, f := range filters {
+		var err error
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			var r io.ReadCloser
+			if r, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+				// Truncated streams are common; keep what could be inflated
+				data, err = io.ReadAll(io.LimitReader(r, maxDecodedStream+1))
+				if len(data) > 0 {
+					err = nil
+				}
+				if len(data) > maxDecodedStream {
+					err = errStreamTooLong
+				}
+				r.Close()
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = decodeHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("unsupported stream filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func decodeHex(data []byte) []byte {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isHexDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	hex.Decode(out, digits)
+	return out
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// parser reads PDF objects and content stream tokens
+type parser struct {
+	data  []byte
+	pos   int
+	depth int // Arrays and dictionaries being read
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) hasKeyword(kw string) bool {
+	end := p.pos + len(kw)
+	return end <= len(p.data) && string(p.data[p.pos:end]) == kw &&
+		(end == len(p.data) || isSpace(p.data[end]) || isDelimiter(p.data[end]))
+}
+
+// readStream reads the stream data following the "stream" keyword
+func (p *parser) readStream(dict pdfDict) *pdfStream {
+	p.pos += len("stream")
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	// /Length is often an indirect reference; endstream is reliable enough
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && length <= float64(len(p.data)-start) {
+		rest := bytes.TrimLeft(p.data[start+int(length):], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return &pdfStream{dict: dict, raw: p.data[start : start+int(length)]}
+		}
+	}
+	end := bytes.Index(p.data[start:], []byte("endstream"))
+	if end < 0 {
+		return &pdfStream{dict: dict, raw: p.data[start:]}
+	}
+	raw := bytes.TrimRight(p.data[start:start+end], "\r\n")
+	return &pdfStream{dict: dict, raw: raw}
+}
+
+// parseObject parses the next object; "n g R" becomes a pdfRef
+func (p *parser) parseObject() (interface{}, error) {
+	obj, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	num, ok := obj.(float64)
+	if !ok || num != float64(int(num)) {
+		return obj, nil
+	}
+	// Look ahead for "gen R"
+	save := p.pos
+	p.skipSpace()
+	if gen, err := p.next(); err == nil {
+		if g, ok := gen.(float64); ok {
+			p.skipSpace()
+			if p.hasKeyword("R") {
+				p.pos++
+				return pdfRef{num: int(num), gen: int(g)}, nil
+			}
+		}
+	}
+	p.pos = save
+	return obj, nil
+}
+
+// next reads one token or composite object
+func (p *parser) next() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, io.EOF
+	}
+	c := p.data[p.pos]
+	switch {
+	case c == '/':
+		return p.readName(), nil
+	case c == '(':
+		return p.readLiteral(), nil
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		return p.readDict()
+	case c == '<':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.data) && p.data[p.pos] != '>' {
+			p.pos++
+		}
+		s := decodeHex(p.data[start:p.pos])
+		if p.pos < len(p.data) {
+			p.pos++
+		}
+		return pdfString(s), nil
+	case c == '[':
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		p.pos++
+		var arr pdfArray
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return arr, nil
+			}
+			obj, err := p.parseObject()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, obj)
+		}
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.data) && (p.data[p.pos] == '.' || (p.data[p.pos] >= '0' && p.data[p.pos] <= '9')) {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(string(p.data[start:p.pos]), 64)
+		if err != nil {
+			return float64(0), nil
+		}
+		return f, nil
+	case isDelimiter(c):
+		p.pos++
+		return pdfKeyword(string(c)), nil
+	}
+	start := p.pos
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	switch kw := string(p.data[start:p.pos]); kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(kw), nil
+	}
+}
+
+func (p *parser) readName() pdfName {
+	p.pos++ // '/'
+	var name []byte
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+		c := p.data[p.pos]
+		if c == '#' && p.pos+2 < len(p.data) && isHexDigit(p.data[p.pos+1]) && isHexDigit(p.data[p.pos+2]) {
+			b, _ := strconv.ParseUint(string(p.data[p.pos+1:p.pos+3]), 16, 8)
+			name = append(name, byte(b))
+			p.pos += 3
+			continue
+		}
+		name = append(name, c)
+		p.pos++
+	}
+	return pdfName(name)
+}
+
+func (p *parser) readLiteral() pdfString {
+	p.pos++ // '('
+	var s []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return s
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b':
+				s = append(s, '\b')
+			case 'f':
+				s = append(s, '\f')
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+			case '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					s = append(s, byte(v))
+				} else {
+					s = append(s, e)
+				}
+			}
+			continue
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+// enter records one more level of nesting, failing beyond maxNesting
+func (p *parser) enter() error {
+	if p.depth >= maxNesting {
+		return errTooDeep
+	}
+	p.depth++
+	return nil
+}
+
+func (p *parser) leave() { p.depth-- }
+
+func (p *parser) readDict() (pdfDict, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	p.pos += 2 // "<<"
+	dict := pdfDict{}
+	for {
+		p.skipSpace()
+		if p.pos+1 >= len(p.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+			p.pos += 2
+			return dict, nil
+		}
+		key, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("invalid dictionary key %v", key)
+		}
+		value, err := p.parseObject()
+		if err != nil {
+			return nil, err
+		}
+		dict[string(name)] = value
+	}
+}
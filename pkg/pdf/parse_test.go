@@ -0,0 +1,167 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rawPDF numbers objs from 1 and adds a trailer whose root is object 1
+func rawPDF(objs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	for i, obj := range objs {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+// stream returns a stream object with the dictionary entries dict
+func stream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+// helloPage returns the objects of a one-page document; object 5 is the
+// font, referenced by the page as /F1
+func helloPage(content []byte, font string) []string {
+	return []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		stream("/Filter /FlateDecode", deflate(content)),
+		font,
+	}
+}
+
+const helvetica = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+
+func TestExtractText(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 700 Td (Hello PDF) Tj ET")
+	pages, err := ExtractText(rawPDF(helloPage(content, helvetica)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pages, []string{"Hello PDF"}) {
+		t.Fatalf("pages = %q", pages)
+	}
+
+	// Text shown without a Tf uses the default one-byte font
+	pages, err = ExtractText(rawPDF(helloPage([]byte("BT 72 700 Td (Hi) Tj ET"), helvetica)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pages, []string{"Hi"}) {
+		t.Fatalf("pages without Tf = %q", pages)
+	}
+
+	// The same font stored in an object stream
+	objs := append(helloPage(content, "")[:4],
+		stream("/Type /ObjStm /N 1 /First 4 /Filter /FlateDecode", deflate([]byte("6 0 "+helvetica))))
+	doc, err := parseDocument(rawPDF(objs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if font := doc.dict(pdfRef{num: 6}); font["BaseFont"] != pdfName("Helvetica") {
+		t.Fatalf("object 6 = %v, want the font of the object stream", doc.objects[6])
+	}
+}
+
+func TestParserNesting(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"arrays", strings.Repeat("[", 100000), errTooDeep},
+		{"dictionaries", strings.Repeat("<< /A ", 100000), errTooDeep},
+		{"mixed", strings.Repeat("[<< /A ", 50000), errTooDeep},
+		{"at the limit", strings.Repeat("[", maxNesting) + strings.Repeat("]", maxNesting), nil},
+		{"unterminated", "[ 1 2 << /A (x", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &parser{data: []byte(tt.data)}
+			_, err := p.parseObject()
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && errors.Is(err, errTooDeep) {
+				t.Fatalf("err = %v", err)
+			}
+			if p.depth != 0 {
+				t.Fatalf("depth = %d after parsing", p.depth)
+			}
+		})
+	}
+}
+
+func TestDecodeStreamLimit(t *testing.T) {
+	bomb := deflate(make([]byte, maxDecodedStream+1))
+	doc := &pdfDocument{objects: map[int]interface{}{}}
+	s := &pdfStream{dict: pdfDict{"Filter": pdfName("FlateDecode")}, raw: bomb}
+	if _, err := doc.decodeStream(s); !errors.Is(err, errStreamTooLong) {
+		t.Fatalf("err = %v, want errStreamTooLong", err)
+	}
+
+	s.raw = deflate(make([]byte, 1024))
+	if data, err := doc.decodeStream(s); err != nil || len(data) != 1024 {
+		t.Fatalf("decodeStream = %d bytes, %v", len(data), err)
+	}
+}
+
+// TestMalformedDocuments feeds damaged and hostile files to the extractor,
+// which must return (text or an error) without panicking
+func TestMalformedDocuments(t *testing.T) {
+	content := []byte("BT /F1 12 Tf (x) Tj ET")
+	// Object 5 is an object stream holding the font (object 6) after header
+	objStm := func(dict, header string) []string {
+		return append(helloPage(content, "")[:4], stream("/Type /ObjStm "+dict, []byte(header+helvetica)))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte("")},
+		{"not a PDF", []byte("GIF89a")},
+		{"truncated header", []byte("%PDF-1.4\n1 0 obj\n<<")},
+		{"unterminated hex string", []byte("%PDF-1.4\n1 0 obj\n<abc")},
+		{"unterminated hex string before stream", []byte("%PDF-1.4\n1 0 obj\n<< /A <abc")},
+		{"negative length", rawPDF(helloPage(content, "<< /Length -100 >>\nstream\nabc\nendstream")...)},
+		{"huge length", rawPDF(helloPage(content, "<< /Length 1e300 >>\nstream\nabc\nendstream")...)},
+		{"object stream with negative First", rawPDF(objStm("/N 1 /First -4", "6 0 ")...)},
+		{"object stream with huge First", rawPDF(objStm("/N 1 /First 1e12", "6 0 ")...)},
+		{"object stream with negative offset", rawPDF(objStm("/N 1 /First 0", "6 -9 ")...)},
+		{"object stream with offset past the end", rawPDF(objStm("/N 1 /First 4", "6 999 ")...)},
+		{"object stream with huge N", rawPDF(objStm("/N 1e15 /First 4", "6 0 ")...)},
+		{"deep nesting", rawPDF(helloPage(content, strings.Repeat("[", 200000))...)},
+		{"cyclic page tree", rawPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [2 0 R 2 0 R 2 0 R] /Count 3 >>",
+		)},
+		{"self-drawing form", rawPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R /Resources << /XObject << /X 4 0 R >> >> >>",
+			stream("/Subtype /Form", []byte(strings.Repeat("/X Do ", 1000))),
+		)},
+		{"flate bomb", rawPDF(helloPage(nil, stream("/Filter /FlateDecode", deflate(make([]byte, maxDecodedStream+1))))...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ExtractText(tt.data)
+		})
+	}
+}
@@ -1,64 +1,255 @@
 package pdf
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jung-kurt/gofpdf"
 )
 
+// Image placement options for embedding the source image
+const (
+	ImageNone      = ""           // Do not embed the source image
+	ImageFirstPage = "first_page" // Source image on the first page, before the text
+	ImageAppendix  = "appendix"   // Source image on a separate page after the text
+)
+
+// PageBreak in the text starts a new page (e.g. between the frames of a
+// multi-frame image)
+const PageBreak = "\f"
+
+// Config holds optional settings for PDF generation
+type Config struct {
+	// SourceImagePath is the original uploaded image to embed (optional)
+	SourceImagePath string
+	// ImagePlacement is one of ImageNone, ImageFirstPage or ImageAppendix
+	ImagePlacement string
+	// Template adds header, footer, logo and cover page (nil: plain pages)
+	Template *Template
+	// JobID is used for the {jobID} template placeholder
+	JobID string
+	// Date is used for the {date} template placeholder (zero: now)
+	Date time.Time
+	// Fonts selects the font per script (nil: DefaultFontRegistry)
+	Fonts *FontRegistry
+	// Language is the language of the text, used to pick the font.
+	// Empty detects the script from the text itself.
+	Language string
+	// Pages is structured content (e.g. from layout analysis) rendered
+	// instead of the text; the text is still used to pick the font
+	Pages []Page
+	// Summary is printed on the cover page, which is added for it when the
+	// template has none (empty: no summary)
+	Summary string
+}
+
+func (c Config) date() time.Time {
+	if c.Date.IsZero() {
+		return time.Now()
+	}
+	return c.Date
+}
+
+// ValidImagePlacement reports whether placement is a supported image placement
+func ValidImagePlacement(placement string) bool {
+	switch placement {
+	case ImageNone, ImageFirstPage, ImageAppendix:
+		return true
+	}
+	return false
+}
+
 // CreatePDF generates a PDF file with the given text
 func CreatePDF(text string) (string, error) {
+	return CreatePDFWithConfig(text, Config{})
+}
+
+// CreatePDFWithConfig generates a PDF file with the given text and config
+func CreatePDFWithConfig(text string, config Config) (string, error) {
+	pdf, err := buildPDF(text, config)
+	if err != nil {
+		return "", err
+	}
+
+	// Create output directory if it doesn't exist
+	outputDir := "output"
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+		os.Mkdir(outputDir, 0755)
+	}
+
+	// Save the PDF
+	outputPath := filepath.Join(outputDir, "output.pdf")
+	err = pdf.OutputFileAndClose(outputPath)
+
+	return outputPath, err
+}
+
+// CreatePDFTo generates a PDF with the given text and config and writes it
+// to w, e.g. an object storage writer or an HTTP response. Nothing is
+// written if the document cannot be built.
+func CreatePDFTo(w io.Writer, text string, config Config) error {
+	pdf, err := buildPDF(text, config)
+	if err != nil {
+		return err
+	}
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+// buildPDF lays out the complete document in memory
+func buildPDF(text string, config Config) (*gofpdf.Fpdf, error) {
+	if !ValidImagePlacement(config.ImagePlacement) {
+		return nil, fmt.Errorf("unsupported image placement %q", config.ImagePlacement)
+	}
+	if config.ImagePlacement != ImageNone && config.SourceImagePath == "" {
+		return nil, fmt.Errorf("image placement %q requires a source image path", config.ImagePlacement)
+	}
+
 	// Create a new PDF document with UTF-8 encoding
 	pdf := gofpdf.New("P", "mm", "A4", "")
-	
-	// Set up font directory
-	fontDir := "font"
-	fontName := "Roboto"
-	
-	// Register the TrueType font for Vietnamese characters
-	pdf.SetFontLocation(fontDir)
-	pdf.AddUTF8Font(fontName, "", "Roboto-Regular.ttf")
-	
-	// Add a page
-	pdf.AddPage()
-	
-	// Set font with UTF-8 encoding
-	pdf.SetFont(fontName, "", 11)
-	
+
+	// Register the TrueType font for the script of the text
+	fonts := config.Fonts
+	if fonts == nil {
+		fonts = DefaultFontRegistry()
+	}
+	script := DetectScript(text)
+	if config.Language != "" {
+		script = ScriptForLanguage(config.Language)
+	}
+	fontName, err := fonts.register(pdf, script)
+	if err != nil {
+		return nil, err
+	}
+
 	// Enable auto page break for better paragraph handling
 	pdf.SetAutoPageBreak(true, 15)
-	
-	// Set margins for better readability
+
+	// Set margins for better readability (before the first page so the
+	// template header uses the same margins on every page)
 	pdf.SetLeftMargin(15)
 	pdf.SetRightMargin(15)
 	pdf.SetTopMargin(15)
-	
+
+	// Header, footer and cover page from the template; the summary is
+	// printed on a cover page, added to a copy of the template if needed
+	if config.Summary != "" && (config.Template == nil || !config.Template.CoverPage) {
+		var tmpl Template
+		if config.Template != nil {
+			tmpl = *config.Template
+		}
+		tmpl.CoverPage = true
+		config.Template = &tmpl
+	}
+	if config.Template != nil {
+		config.Template.apply(pdf, fontName, config.JobID, config.date())
+	}
+
+	// Add a page
+	pdf.AddPage()
+
+	// Set font with UTF-8 encoding
+	pdf.SetFont(fontName, "", 11)
+
+	if config.Template != nil && config.Template.CoverPage {
+		config.Template.writeCover(pdf, fontName, fonts.style(fontName, "B"), config.JobID, config.date())
+		if config.Summary != "" {
+			writeSummary(pdf, config.Summary, fontName, fonts.style(fontName, "B"), script)
+		}
+		pdf.AddPage()
+	}
+
+	// Source image before the text
+	if config.ImagePlacement == ImageFirstPage {
+		embedImage(pdf, config.SourceImagePath)
+		pdf.Ln(6)
+	}
+
+	if config.Pages != nil {
+		writePages(pdf, config.Pages, script)
+	} else {
+		for p, page := range strings.Split(text, PageBreak) {
+			if p > 0 {
+				pdf.AddPage()
+			}
+			writeText(pdf, page, script)
+		}
+	}
+
+	// Source image as an appendix page
+	if config.ImagePlacement == ImageAppendix {
+		pdf.AddPage()
+		embedImage(pdf, config.SourceImagePath)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("failed to build PDF: %w", err)
+	}
+	return pdf, nil
+}
+
+// writeSummary writes the summary of the document below the cover title
+func writeSummary(pdf *gofpdf.Fpdf, summary, fontName, titleStyle, script string) {
+	pdf.Ln(12)
+	pdf.SetFont(fontName, titleStyle, 12)
+	pdf.CellFormat(0, 7, "Summary", "", 1, "L", false, 0, "")
+	pdf.SetFont(fontName, "", 11)
+	writeText(pdf, summary, script)
+}
+
+// writeText writes text split into paragraphs at blank lines
+func writeText(pdf *gofpdf.Fpdf, text, script string) {
 	// Process text to handle paragraphs properly
 	paragraphs := strings.Split(text, "\n\n")
 	for i, paragraph := range paragraphs {
 		// Replace single newlines with spaces for better flow
 		paragraph = strings.ReplaceAll(paragraph, "\n", " ")
-		
-		// Write paragraph with UTF-8 encoding
-		pdf.MultiCell(0, 6, paragraph, "", "", false)
-		
+
+		// Write paragraph with the line breaking and direction of its script
+		writeParagraph(pdf, paragraph, script, 6)
+
 		// Add space between paragraphs
 		if i < len(paragraphs)-1 {
 			pdf.Ln(4)
 		}
 	}
-	
-	// Create output directory if it doesn't exist
-	outputDir := "output"
-	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
-		os.Mkdir(outputDir, 0755)
+}
+
+// embedImage draws the image at the current position, scaled to the page
+// width and shrunk further if it would not fit in the remaining page height
+func embedImage(pdf *gofpdf.Fpdf, imagePath string) {
+	info := pdf.RegisterImageOptions(imagePath, gofpdf.ImageOptions{ReadDpi: true})
+	if pdf.Err() || info == nil {
+		return // Error is reported by pdf.Error()
 	}
-	
-	// Save the PDF
-	outputPath := filepath.Join(outputDir, "output.pdf")
-	err := pdf.OutputFileAndClose(outputPath)
-	
-	return outputPath, err
-}
\ No newline at end of file
+
+	pageW, pageH := pdf.GetPageSize()
+	left, top, right, bottom := pdf.GetMargins()
+	maxW := pageW - left - right
+	maxH := pageH - top - bottom
+
+	imgW, imgH := info.Extent()
+	if imgW <= 0 || imgH <= 0 {
+		return
+	}
+	w := maxW
+	h := imgH * w / imgW
+	if h > maxH {
+		h = maxH
+		w = imgW * h / imgH
+	}
+
+	// Start a new page if the image does not fit below the current position
+	if pdf.GetY()+h > pageH-bottom {
+		pdf.AddPage()
+	}
+
+	x := left + (maxW-w)/2
+	pdf.ImageOptions(imagePath, x, pdf.GetY(), w, h, true, gofpdf.ImageOptions{ReadDpi: true}, 0, "")
+}
@@ -0,0 +1,127 @@
+package pdf
+
+import (
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Region kinds of a structured page
+const (
+	RegionText  = "text"  // Paragraphs separated by blank lines
+	RegionTable = "table" // Rows of cells, drawn as a grid
+)
+
+// Region is a text block or a table of a structured page
+type Region struct {
+	Kind string
+	Text string     // RegionText
+	Rows [][]string // RegionTable: cell text by row and column
+}
+
+// Page is one page of structured content, regions in reading order
+type Page struct {
+	Regions []Region
+}
+
+// Table cell padding in mm
+const cellPadding = 1.5
+
+// writePages writes structured pages, each starting on a new page
+func writePages(pdf *gofpdf.Fpdf, pages []Page, script string) {
+	for p, page := range pages {
+		if p > 0 {
+			pdf.AddPage()
+		}
+		for i, region := range page.Regions {
+			if i > 0 {
+				pdf.Ln(4)
+			}
+			if region.Kind == RegionTable {
+				writeTable(pdf, region.Rows, script, 6)
+				continue
+			}
+			writeText(pdf, region.Text, script)
+		}
+	}
+}
+
+// writeTable draws rows as a bordered grid across the text width. Columns
+// get a width proportional to their widest cell and cells wrap within it;
+// right-to-left tables start with the first column on the right.
+func writeTable(pdf *gofpdf.Fpdf, rows [][]string, script string, lineHeight float64) {
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	if cols == 0 {
+		return
+	}
+
+	// Narrow columns keep at least a third of an even share of the width
+	width := textWidth(pdf)
+	weights := make([]float64, cols)
+	for _, row := range rows {
+		for c, cell := range row {
+			weights[c] = max(weights[c], pdf.GetStringWidth(cell)+2*cellPadding)
+		}
+	}
+	total := 0.0
+	for c := range weights {
+		weights[c] = max(weights[c], width/float64(cols)/3)
+		total += weights[c]
+	}
+	widths := make([]float64, cols)
+	for c := range weights {
+		widths[c] = width * weights[c] / total
+	}
+
+	rtl := script == ScriptArabic || script == ScriptHebrew
+	left, _, _, bottom := pdf.GetMargins()
+	_, pageH := pdf.GetPageSize()
+	for _, row := range rows {
+		cells := make([][]string, cols)
+		lines := 1
+		for c := range cells {
+			text := ""
+			if c < len(row) {
+				text = row[c]
+			}
+			cells[c] = wrapCell(pdf, text, script, widths[c]-2*cellPadding)
+			lines = max(lines, len(cells[c]))
+		}
+		height := float64(lines)*lineHeight + 2*cellPadding
+
+		// Keep a row on one page
+		if pdf.GetY()+height > pageH-bottom {
+			pdf.AddPage()
+		}
+		x, y := left, pdf.GetY()
+		for i := range cells {
+			c := i
+			if rtl {
+				c = cols - 1 - i
+			}
+			pdf.Rect(x, y, widths[c], height, "D")
+			for l, line := range cells[c] {
+				align := "L"
+				if rtl {
+					line, align = visualOrder(line), "R"
+				}
+				pdf.SetXY(x+cellPadding, y+cellPadding+float64(l)*lineHeight)
+				pdf.CellFormat(widths[c]-2*cellPadding, lineHeight, line, "", 0, align, false, 0, "")
+			}
+			x += widths[c]
+		}
+		pdf.SetXY(left, y+height)
+	}
+}
+
+// wrapCell breaks the text of a table cell with the rules of its script
+func wrapCell(pdf *gofpdf.Fpdf, text, script string, width float64) []string {
+	switch script {
+	case ScriptCJK:
+		return wrapCJK(pdf, text, width)
+	case ScriptArabic:
+		return wrapWords(pdf, shapeArabic(text), width)
+	}
+	return wrapWords(pdf, text, width)
+}
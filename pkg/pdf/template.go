@@ -0,0 +1,174 @@
+package pdf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Template describes the page decoration of a generated PDF.
+//
+// HeaderText, FooterText, CoverTitle and CoverSubtitle may contain the
+// placeholders {jobID}, {date}, {page} and {pages}.
+type Template struct {
+	HeaderText    string  `json:"header_text"`
+	FooterText    string  `json:"footer_text"`
+	LogoPath      string  `json:"logo_path"`     // PNG/JPEG logo drawn in the header (optional)
+	LogoWidth     float64 `json:"logo_width_mm"` // Logo width in mm, 0 uses 20mm
+	CoverPage     bool    `json:"cover_page"`    // Add a cover page before the content
+	CoverTitle    string  `json:"cover_title"`
+	CoverSubtitle string  `json:"cover_subtitle"`
+	DateFormat    string  `json:"date_format"` // Go time layout for {date}, default "2006-01-02 15:04"
+}
+
+// DefaultTemplate returns the template used when a deployment does not
+// configure its own: a creation date header and a page-number footer
+func DefaultTemplate() Template {
+	return Template{
+		HeaderText: "Created: {date}",
+		FooterText: "Page {page}/{pages}",
+	}
+}
+
+// LoadTemplate reads a Template from a JSON file
+func LoadTemplate(path string) (Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to read PDF template %s: %w", path, err)
+	}
+	var tmpl Template
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return Template{}, fmt.Errorf("failed to parse PDF template %s: %w", path, err)
+	}
+	if tmpl.LogoPath != "" {
+		if _, err := os.Stat(tmpl.LogoPath); err != nil {
+			return Template{}, fmt.Errorf("PDF template logo %s: %w", tmpl.LogoPath, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// pagesAlias is replaced by gofpdf with the total page count when the document is closed
+const pagesAlias = "{nb}"
+
+// CacheKey identifies the decoration the template renders at date: the
+// PDFs of two jobs with the same content may be shared only when their keys
+// are equal. The key covers the template and, when the template uses it,
+// the rendered {date}. A template using {jobID} makes every PDF unique to
+// its job, see PerJob.
+func (t Template) CacheKey(date time.Time) string {
+	data, _ := json.Marshal(t)
+	h := sha256.New()
+	h.Write(data)
+	if t.uses("{date}") {
+		fmt.Fprintf(h, "\x00%s", date.Format(t.dateLayout()))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// PerJob reports whether the template renders the job ID, in which case a
+// PDF must not be served to another job
+func (t Template) PerJob() bool { return t.uses("{jobID}") }
+
+// uses reports whether a text of the template contains placeholder
+func (t Template) uses(placeholder string) bool {
+	for _, text := range []string{t.HeaderText, t.FooterText, t.CoverTitle, t.CoverSubtitle} {
+		if strings.Contains(text, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Template) dateLayout() string {
+	if t.DateFormat == "" {
+		return "2006-01-02 15:04"
+	}
+	return t.DateFormat
+}
+
+// expand replaces the template placeholders in text
+func (t Template) expand(text, jobID string, now time.Time, page int) string {
+	r := strings.NewReplacer(
+		"{jobID}", jobID,
+		"{date}", now.Format(t.dateLayout()),
+		"{page}", strconv.Itoa(page),
+		"{pages}", pagesAlias,
+	)
+	return r.Replace(text)
+}
+
+// apply registers the header and footer callbacks on the document.
+// It must be called before the first AddPage.
+func (t Template) apply(pdf *gofpdf.Fpdf, fontName, jobID string, now time.Time) {
+	pdf.AliasNbPages(pagesAlias)
+
+	if t.HeaderText != "" || t.LogoPath != "" {
+		pdf.SetHeaderFunc(func() {
+			// No header on the cover page
+			if t.CoverPage && pdf.PageNo() == 1 {
+				return
+			}
+			left, top, _, _ := pdf.GetMargins()
+			headerHeight := 6.0
+			if t.LogoPath != "" {
+				logoW := t.LogoWidth
+				if logoW <= 0 {
+					logoW = 20
+				}
+				info := pdf.RegisterImageOptions(t.LogoPath, gofpdf.ImageOptions{ReadDpi: true})
+				if info != nil && info.Width() > 0 {
+					logoH := info.Height() * logoW / info.Width()
+					pdf.ImageOptions(t.LogoPath, left, top, logoW, logoH, false, gofpdf.ImageOptions{ReadDpi: true}, 0, "")
+					if logoH > headerHeight {
+						headerHeight = logoH
+					}
+				}
+			}
+			if t.HeaderText != "" {
+				pdf.SetFont(fontName, "", 9)
+				pdf.SetXY(left, top)
+				pdf.CellFormat(0, 6, t.expand(t.HeaderText, jobID, now, pdf.PageNo()), "", 0, "R", false, 0, "")
+			}
+			pdf.SetY(top + headerHeight + 4)
+			pdf.SetFont(fontName, "", 11)
+		})
+	}
+
+	if t.FooterText != "" {
+		pdf.SetFooterFunc(func() {
+			if t.CoverPage && pdf.PageNo() == 1 {
+				return
+			}
+			pdf.SetY(-12)
+			pdf.SetFont(fontName, "", 9)
+			pdf.CellFormat(0, 6, t.expand(t.FooterText, jobID, now, pdf.PageNo()), "", 0, "C", false, 0, "")
+		})
+	}
+}
+
+// writeCover fills the current (first) page with the cover content.
+// titleStyle is the font style of the title ("" if the family has no bold).
+func (t Template) writeCover(pdf *gofpdf.Fpdf, fontName, titleStyle, jobID string, now time.Time) {
+	_, pageH := pdf.GetPageSize()
+	pdf.SetY(pageH / 3)
+	title := t.CoverTitle
+	if title == "" {
+		title = "Translated document"
+	}
+	pdf.SetFont(fontName, titleStyle, 22)
+	pdf.MultiCell(0, 10, t.expand(title, jobID, now, pdf.PageNo()), "", "C", false)
+	if t.CoverSubtitle != "" {
+		pdf.Ln(4)
+		pdf.SetFont(fontName, "", 13)
+		pdf.MultiCell(0, 7, t.expand(t.CoverSubtitle, jobID, now, pdf.PageNo()), "", "C", false)
+	}
+	pdf.SetFont(fontName, "", 11)
+}
@@ -0,0 +1,51 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateCacheKey(t *testing.T) {
+	date := time.Date(2024, 6, 1, 10, 30, 15, 0, time.UTC)
+	dated := DefaultTemplate()
+	key := dated.CacheKey(date)
+	if dated.CacheKey(date.Add(30*time.Second)) != key {
+		t.Error("key changed within the minute rendered by {date}")
+	}
+	if dated.CacheKey(date.Add(time.Minute)) == key {
+		t.Error("key unchanged for another rendered {date}")
+	}
+	footer := dated
+	footer.FooterText = "{page}"
+	if footer.CacheKey(date) == key {
+		t.Error("key unchanged for another template")
+	}
+	undated := Template{FooterText: "Page {page}"}
+	if undated.CacheKey(date) != undated.CacheKey(date.AddDate(0, 1, 0)) {
+		t.Error("key of a template without {date} depends on the date")
+	}
+
+	if dated.PerJob() || !(Template{CoverSubtitle: "Job {jobID}"}).PerJob() {
+		t.Error("PerJob")
+	}
+}
+
+func TestTemplateDate(t *testing.T) {
+	fonts := DefaultFontRegistry()
+	fonts.Dir = "../../font"
+	tmpl := Template{HeaderText: "Created {date} for {jobID}", DateFormat: "2006-01-02"}
+	var out bytes.Buffer
+	config := Config{Template: &tmpl, JobID: "job-7", Date: time.Date(2024, 6, 1, 10, 30, 0, 0, time.UTC), Fonts: fonts}
+	if err := CreatePDFTo(&out, "Body", config); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := ExtractText(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || !strings.Contains(pages[0], "Created 2024-06-01 for job-7") {
+		t.Errorf("pages = %q", pages)
+	}
+}
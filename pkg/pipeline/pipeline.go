@@ -0,0 +1,169 @@
+// Package pipeline describes the processing of a job as data: a Definition
+// lists the stages in order, with per-stage options and conditions skipping a
+// stage for some jobs. Definitions are loaded from a JSON file (the worker's
+// PIPELINE_DEFINITION) or sent with a job, and executed by a Runner on which
+// the worker registers its stage functions, so stages are added, removed or
+// reordered without changing the worker.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Definition is an ordered list of stages, e.g.
+//
+//	{"stages": [
+//	  {"name": "ocr", "when": {"job_type": ["image"]}},
+//	  {"name": "cleanup", "options": {"steps": "dehyphenate,whitespace"}},
+//	  {"name": "translate"},
+//	  {"name": "pdf"}
+//	]}
+type Definition struct {
+	Name   string  `json:"name,omitempty"`
+	Stages []Stage `json:"stages"`
+}
+
+// Stage is a step of a Definition
+type Stage struct {
+	Name    string            `json:"name"`              // Stage registered on the Runner
+	Options map[string]string `json:"options,omitempty"` // Passed to the stage function
+	// When runs the stage only if every variable has one of the listed values
+	When map[string][]string `json:"when,omitempty"`
+	// Unless skips the stage if any variable has one of the listed values
+	Unless map[string][]string `json:"unless,omitempty"`
+}
+
+// Vars gives the value of the variables used by the conditions of a stage,
+// e.g. the job type or whether a layout was recognized. Variables are read
+// right before each stage, so conditions can depend on earlier stages.
+type Vars interface {
+	Var(name string) string
+}
+
+// Runs reports whether the stage runs with these variables
+func (s Stage) Runs(vars Vars) bool {
+	for name, values := range s.When {
+		if !slices.Contains(values, vars.Var(name)) {
+			return false
+		}
+	}
+	for name, values := range s.Unless {
+		if slices.Contains(values, vars.Var(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse decodes a JSON definition and checks that it has stages with names
+func Parse(data []byte) (Definition, error) {
+	var def Definition
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&def); err != nil {
+		return def, fmt.Errorf("invalid pipeline definition: %w", err)
+	}
+	if len(def.Stages) == 0 {
+		return def, fmt.Errorf("invalid pipeline definition: no stages")
+	}
+	for i, stage := range def.Stages {
+		if stage.Name == "" {
+			return def, fmt.Errorf("invalid pipeline definition: stage %d has no name", i+1)
+		}
+	}
+	return def, nil
+}
+
+// Load reads a JSON definition from a file
+func Load(path string) (Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Definition{}, err
+	}
+	def, err := Parse(data)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// Hash identifies the definition, for cache keys of results depending on it
+func (d Definition) Hash() string {
+	data, _ := json.Marshal(d) // Map keys are sorted by encoding/json
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:8])
+}
+
+// Names returns the names of the stages, in order
+func (d Definition) Names() []string {
+	names := make([]string, len(d.Stages))
+	for i, stage := range d.Stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// StageFunc runs a stage on the state S of a job
+type StageFunc[S any] func(ctx context.Context, state S, options map[string]string) error
+
+// Runner executes definitions with the registered stage functions
+type Runner[S Vars] struct {
+	stages map[string]StageFunc[S]
+}
+
+// NewRunner returns a runner without stages
+func NewRunner[S Vars]() *Runner[S] {
+	return &Runner[S]{stages: map[string]StageFunc[S]{}}
+}
+
+// Register adds a stage under name, replacing a stage of the same name
+func (r *Runner[S]) Register(name string, fn StageFunc[S]) {
+	r.stages[name] = fn
+}
+
+// Validate checks that every stage of the definition is registered
+func (r *Runner[S]) Validate(def Definition) error {
+	for _, stage := range def.Stages {
+		if _, ok := r.stages[stage.Name]; !ok {
+			known := make([]string, 0, len(r.stages))
+			for name := range r.stages {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown pipeline stage %q (want %s)", stage.Name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// Run executes the stages of the definition in order, skipping those whose
+// conditions do not hold, and returns the names of the stages that ran. It
+// stops at the first error.
+func (r *Runner[S]) Run(ctx context.Context, def Definition, state S) ([]string, error) {
+	if err := r.Validate(def); err != nil {
+		return nil, err
+	}
+	var ran []string
+	for _, stage := range def.Stages {
+		if err := ctx.Err(); err != nil {
+			return ran, err
+		}
+		if !stage.Runs(state) {
+			continue
+		}
+		if err := r.stages[stage.Name](ctx, state, stage.Options); err != nil {
+			return ran, err
+		}
+		ran = append(ran, stage.Name)
+	}
+	return ran, nil
+}
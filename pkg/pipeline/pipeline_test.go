@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string // Empty: valid
+	}{
+		{"valid", `{"name":"custom","stages":[{"name":"ocr","when":{"job_type":["image"]}},{"name":"pdf","options":{"dpi":"300"}}]}`, ""},
+		{"no stages", `{"stages":[]}`, "no stages"},
+		{"missing stages", `{"name":"empty"}`, "no stages"},
+		{"stage without name", `{"stages":[{"name":"ocr"},{"options":{"a":"b"}}]}`, "stage 2 has no name"},
+		{"unknown field", `{"stages":[{"name":"ocr","if":{"job_type":["image"]}}]}`, "unknown field"},
+		{"not JSON", `stages: [ocr]`, "invalid pipeline definition"},
+		{"wrong type", `{"stages":[{"name":"ocr","when":{"job_type":"image"}}]}`, "invalid pipeline definition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := Parse([]byte(tt.json))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Parse: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Parse error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantErr == "" && (def.Name != "custom" || !reflect.DeepEqual(def.Names(), []string{"ocr", "pdf"}) || def.Stages[1].Options["dpi"] != "300") {
+				t.Errorf("definition = %+v", def)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pipeline.json")
+	if err := os.WriteFile(path, []byte(`{"stages":[{"name":"ocr"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if def, err := Load(path); err != nil || len(def.Stages) != 1 {
+		t.Errorf("Load = %+v, %v", def, err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"stages":[]}`), 0o644)
+	if _, err := Load(bad); err == nil || !strings.HasPrefix(err.Error(), bad+": ") {
+		t.Errorf("Load error = %v, want it prefixed with the path", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load missing file = %v", err)
+	}
+}
+
+// testVars are the variables of a job in tests
+type testVars map[string]string
+
+func (v testVars) Var(name string) string { return v[name] }
+
+func TestStageRuns(t *testing.T) {
+	tests := []struct {
+		name  string
+		stage Stage
+		vars  testVars
+		want  bool
+	}{
+		{"no condition", Stage{Name: "pdf"}, testVars{}, true},
+		{"when matches", Stage{When: map[string][]string{"job_type": {"image", "text"}}}, testVars{"job_type": "text"}, true},
+		{"when does not match", Stage{When: map[string][]string{"job_type": {"image"}}}, testVars{"job_type": "pdf_text"}, false},
+		{"when on an unset variable", Stage{When: map[string][]string{"layout": {"true"}}}, testVars{}, false},
+		{"when on an empty value", Stage{When: map[string][]string{"ocr_mode": {""}}}, testVars{}, true},
+		{"every when variable", Stage{When: map[string][]string{"job_type": {"image"}, "layout": {"true"}}}, testVars{"job_type": "image"}, false},
+		{"unless matches", Stage{Unless: map[string][]string{"layout": {"true"}}}, testVars{"layout": "true"}, false},
+		{"unless does not match", Stage{Unless: map[string][]string{"layout": {"true"}}}, testVars{"layout": "false"}, true},
+		{"any unless variable", Stage{Unless: map[string][]string{"layout": {"true"}, "regions": {"true"}}}, testVars{"regions": "true"}, false},
+		{"when and unless", Stage{When: map[string][]string{"job_type": {"image"}}, Unless: map[string][]string{"layout": {"true"}}}, testVars{"job_type": "image", "layout": "true"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stage.Runs(tt.vars); got != tt.want {
+				t.Errorf("Runs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	base := Definition{Stages: []Stage{{Name: "ocr"}, {Name: "pdf", Options: map[string]string{"a": "1", "b": "2"}}}}
+	same := Definition{Stages: []Stage{{Name: "ocr"}, {Name: "pdf", Options: map[string]string{"b": "2", "a": "1"}}}}
+	if base.Hash() != same.Hash() {
+		t.Error("hash depends on the order of the map keys")
+	}
+	if len(base.Hash()) != 16 {
+		t.Errorf("hash %q, want 16 hex characters", base.Hash())
+	}
+	for name, other := range map[string]Definition{
+		"order":   {Stages: []Stage{{Name: "pdf", Options: map[string]string{"a": "1", "b": "2"}}, {Name: "ocr"}}},
+		"options": {Stages: []Stage{{Name: "ocr"}, {Name: "pdf", Options: map[string]string{"a": "1", "b": "3"}}}},
+		"when":    {Stages: []Stage{{Name: "ocr", When: map[string][]string{"job_type": {"image"}}}, {Name: "pdf", Options: map[string]string{"a": "1", "b": "2"}}}},
+		"name":    {Name: "custom", Stages: base.Stages},
+	} {
+		if other.Hash() == base.Hash() {
+			t.Errorf("definitions differing by %s have the same hash", name)
+		}
+	}
+}
+
+// runState records the stages that ran
+type runState struct {
+	testVars
+	ran []string
+}
+
+func TestRunnerRun(t *testing.T) {
+	errStage := errors.New("stage failed")
+	r := NewRunner[*runState]()
+	record := func(name string) StageFunc[*runState] {
+		return func(_ context.Context, s *runState, options map[string]string) error {
+			s.ran = append(s.ran, name+options["suffix"])
+			return nil
+		}
+	}
+	r.Register("ocr", record("ocr"))
+	r.Register("layout", func(_ context.Context, s *runState, _ map[string]string) error {
+		s.testVars["layout"] = "true" // Read by the conditions of the later stages
+		return nil
+	})
+	r.Register("cleanup", record("cleanup"))
+	r.Register("pdf", record("pdf"))
+	r.Register("fail", func(context.Context, *runState, map[string]string) error { return errStage })
+
+	def := Definition{Stages: []Stage{
+		{Name: "ocr", When: map[string][]string{"job_type": {"image"}}},
+		{Name: "layout"},
+		{Name: "cleanup", Unless: map[string][]string{"layout": {"true"}}},
+		{Name: "pdf", Options: map[string]string{"suffix": "-a4"}},
+	}}
+	state := &runState{testVars: testVars{"job_type": "image"}}
+	ran, err := r.Run(context.Background(), def, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ocr", "layout", "pdf"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+	if want := []string{"ocr", "pdf-a4"}; !reflect.DeepEqual(state.ran, want) {
+		t.Errorf("stage calls %v, want %v", state.ran, want)
+	}
+
+	// Stops at the first error
+	def = Definition{Stages: []Stage{{Name: "ocr"}, {Name: "fail"}, {Name: "pdf"}}}
+	state = &runState{testVars: testVars{}}
+	ran, err = r.Run(context.Background(), def, state)
+	if !errors.Is(err, errStage) || !reflect.DeepEqual(ran, []string{"ocr"}) || len(state.ran) != 1 {
+		t.Errorf("Run = %v, %v (calls %v); want the error after ocr", ran, err, state.ran)
+	}
+
+	// Unknown stages are rejected before any stage runs
+	def = Definition{Stages: []Stage{{Name: "ocr"}, {Name: "translate"}}}
+	state = &runState{testVars: testVars{}}
+	if _, err := r.Run(context.Background(), def, state); err == nil || !strings.Contains(err.Error(), `"translate"`) || len(state.ran) != 0 {
+		t.Errorf("Run with an unknown stage = %v (calls %v)", err, state.ran)
+	}
+	if err := r.Validate(def); err == nil || !strings.Contains(err.Error(), "want cleanup, fail, layout, ocr, pdf") {
+		t.Errorf("Validate = %v, want the registered stages listed", err)
+	}
+
+	// A canceled job stops before the next stage
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	state = &runState{testVars: testVars{}}
+	if ran, err := r.Run(ctx, Definition{Stages: []Stage{{Name: "ocr"}}}, state); err != context.Canceled || len(ran) != 0 {
+		t.Errorf("Run canceled = %v, %v", ran, err)
+	}
+}
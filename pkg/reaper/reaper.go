@@ -0,0 +1,215 @@
+// Package reaper finds jobs stuck in "processing" (for example because the
+// worker crashed after consuming the message) and re-enqueues them, or marks
+// them failed after too many attempts or when their message is no longer
+// stored, so a job never hangs forever.
+package reaper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/periodic"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// Config of the reaper
+type Config struct {
+	Deadline    time.Duration // Time a job may stay in "processing" before it is considered stuck
+	MaxAttempts int           // Deliveries of a job before it is marked failed; 1 never re-enqueues
+	Interval    time.Duration // Between two scans
+	JobTTL      time.Duration // TTL of the status keys written for a reaped job
+}
+
+// DefaultConfig allows 30 minutes per attempt and 3 attempts per job
+func DefaultConfig() Config {
+	return Config{Deadline: 30 * time.Minute, MaxAttempts: 3, Interval: time.Minute, JobTTL: 24 * time.Hour}
+}
+
+// ConfigFromEnv reads JOB_DEADLINE, JOB_MAX_ATTEMPTS and REAPER_INTERVAL
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	for _, v := range []struct {
+		name  string
+		value *time.Duration
+	}{{"JOB_DEADLINE", &config.Deadline}, {"REAPER_INTERVAL", &config.Interval}} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("%s must be a positive duration such as 30m, got %q", v.name, raw)
+		}
+		*v.value = d
+	}
+	if raw := os.Getenv("JOB_MAX_ATTEMPTS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("JOB_MAX_ATTEMPTS must be at least 1, got %q", raw)
+		}
+		config.MaxAttempts = n
+	}
+	return config, nil
+}
+
+func messageKey(jobID string) string { return jobID + ":message" }
+
+// SaveMessage stores the message of a submitted job so the reaper can re-enqueue it
+func SaveMessage(ctx context.Context, client redis.Cmdable, job messaging.JobMessage, ttl time.Duration) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, messageKey(job.JobID), data, ttl).Err()
+}
+
+// ErrNoMessage is returned by LoadMessage for jobs without a stored message
+// (not submitted through the API, or expired)
+var ErrNoMessage = errors.New("no stored message for job")
+
+// LoadMessage returns the message stored by SaveMessage
+func LoadMessage(ctx context.Context, client redis.Cmdable, jobID string) (messaging.JobMessage, error) {
+	var job messaging.JobMessage
+	data, err := client.Get(ctx, messageKey(jobID)).Result()
+	if err == redis.Nil {
+		return job, ErrNoMessage
+	}
+	if err != nil {
+		return job, err
+	}
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return job, fmt.Errorf("invalid stored message: %w", err)
+	}
+	return job, nil
+}
+
+// Enqueue sends a job message to the workers
+type Enqueue func(ctx context.Context, job messaging.JobMessage) error
+
+// Result lists the jobs handled by one scan
+type Result struct {
+	Requeued []string `json:"requeued"`
+	Failed   []string `json:"failed"`
+	Skipped  []string `json:"skipped"` // No longer processing, or written by another writer meanwhile
+}
+
+// Reaper scans model.ProcessingKey for jobs past the deadline
+type Reaper struct {
+	client  *redis.Client
+	store   *model.Store
+	config  Config
+	enqueue Enqueue
+}
+
+// New creates a reaper that re-enqueues stuck jobs with enqueue
+func New(client *redis.Client, config Config, enqueue Enqueue) *Reaper {
+	return &Reaper{client: client, store: model.NewStore(client, config.JobTTL).WithActor("reaper"), config: config, enqueue: enqueue}
+}
+
+// Run scans every Interval until ctx is done. Each scan is passed to report
+// (nil: ignored) with its error.
+func (r *Reaper) Run(ctx context.Context, report func(Result, error)) {
+	periodic.RunDelayed(ctx, r.config.Interval, r.Scan, report)
+}
+
+// Scan handles the jobs that entered "processing" before the deadline.
+// Several API replicas may scan concurrently: a job is handled by the replica
+// that removes it from model.ProcessingKey.
+func (r *Reaper) Scan(ctx context.Context) (Result, error) {
+	var result Result
+	cutoff := time.Now().Add(-r.config.Deadline).Unix()
+	stuck, err := r.client.ZRangeByScoreWithScores(ctx, model.ProcessingKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff, 10),
+	}).Result()
+	if err != nil {
+		return result, err
+	}
+	for _, z := range stuck {
+		jobID, _ := z.Member.(string)
+		claimed, err := r.client.ZRem(ctx, model.ProcessingKey, jobID).Result()
+		if err != nil {
+			return result, err
+		}
+		if claimed == 0 {
+			continue // Finished meanwhile or handled by another replica
+		}
+		action, err := r.reap(ctx, jobID)
+		if err != nil {
+			// Put the job back to retry on the next scan
+			r.client.ZAdd(ctx, model.ProcessingKey, &redis.Z{Score: z.Score, Member: jobID})
+			return result, fmt.Errorf("failed to reap job %s: %w", jobID, err)
+		}
+		switch action {
+		case "requeued":
+			result.Requeued = append(result.Requeued, jobID)
+		case "failed":
+			result.Failed = append(result.Failed, jobID)
+		default:
+			result.Skipped = append(result.Skipped, jobID)
+		}
+	}
+	return result, nil
+}
+
+func (r *Reaper) reap(ctx context.Context, jobID string) (string, error) {
+	state, err := r.store.Load(ctx, jobID)
+	if err == model.ErrNotFound || (err == nil && state.Status != model.StatusProcessing) {
+		return "skipped", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	job, err := LoadMessage(ctx, r.client, jobID)
+	if err == ErrNoMessage {
+		// Without its message the job cannot be re-enqueued: left alone it
+		// would stay "processing" forever
+		errMsg := fmt.Sprintf("Job did not finish within %s and cannot be retried: its message is no longer stored", r.config.Deadline)
+		return r.fail(ctx, state, errMsg, map[string]string{"reaped": "true"})
+	}
+	if err != nil {
+		return "", err
+	}
+	attempt := max(job.Attempt, 1)
+
+	if attempt >= r.config.MaxAttempts {
+		errMsg := fmt.Sprintf("Job did not finish within %s after %d attempt(s): the worker stopped responding", r.config.Deadline, attempt)
+		return r.fail(ctx, state, errMsg, map[string]string{"reaped": "true", "attempt": strconv.Itoa(attempt)})
+	}
+
+	// The status is set before sending, so a worker picking the job up at once
+	// is not overwritten
+	job.Attempt = attempt + 1
+	if err := SaveMessage(ctx, r.client, job, r.config.JobTTL); err != nil {
+		return "", err
+	}
+	if err := r.store.CompareAndSetStatus(ctx, jobID, state.Version, model.StatusQueued, ""); err == model.ErrConflict {
+		return "skipped", nil
+	} else if err != nil {
+		return "", err
+	}
+	if err := r.enqueue(ctx, job); err != nil {
+		r.store.SetStatus(ctx, jobID, model.StatusProcessing, "") // Scan restores the original start time
+		return "", err
+	}
+	return "requeued", nil
+}
+
+// fail marks the job failed with errMsg. The worker may finish the job at the
+// same time: the status is only changed if nobody wrote it since it was read.
+func (r *Reaper) fail(ctx context.Context, state *model.Result, errMsg string, details map[string]string) (string, error) {
+	if err := r.store.CompareAndSetStatus(ctx, state.JobID, state.Version, model.StatusFailed, errMsg); err == model.ErrConflict {
+		return "skipped", nil
+	} else if err != nil {
+		return "", err
+	}
+	return "failed", r.store.SaveDetails(ctx, state.JobID, details)
+}
@@ -0,0 +1,111 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// stuckJob sets the job "processing" since an hour ago, with its message if
+// attempt is positive
+func stuckJob(t *testing.T, client *redis.Client, store *model.Store, jobID string, attempt int) {
+	t.Helper()
+	ctx := context.Background()
+	if err := store.SetStatus(ctx, jobID, model.StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	client.ZAdd(ctx, model.ProcessingKey, &redis.Z{Score: float64(time.Now().Add(-time.Hour).Unix()), Member: jobID})
+	if attempt > 0 {
+		if err := SaveMessage(ctx, client, messaging.JobMessage{JobID: jobID, Attempt: attempt}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := model.NewStore(client, time.Hour)
+
+	var enqueued []messaging.JobMessage
+	config := Config{Deadline: 30 * time.Minute, MaxAttempts: 3, Interval: time.Minute, JobTTL: time.Hour}
+	r := New(client, config, func(_ context.Context, job messaging.JobMessage) error {
+		enqueued = append(enqueued, job)
+		return nil
+	})
+
+	stuckJob(t, client, store, "retry", 1)
+	stuckJob(t, client, store, "exhausted", 3)
+	stuckJob(t, client, store, "no-message", 0)
+	stuckJob(t, client, store, "finished", 1)
+	store.SetStatus(ctx, "finished", model.StatusCompleted, "pdfs/finished.pdf")
+	client.ZAdd(ctx, model.ProcessingKey, &redis.Z{Score: float64(time.Now().Add(-time.Hour).Unix()), Member: "finished"})
+	if err := store.SetStatus(ctx, "running", model.StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := r.Scan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(result.Failed) // Scanned by start time, which may differ by a second
+	if strings.Join(result.Requeued, ",") != "retry" || strings.Join(result.Failed, ",") != "exhausted,no-message" || strings.Join(result.Skipped, ",") != "finished" {
+		t.Fatalf("Scan = %+v", result)
+	}
+	if len(enqueued) != 1 || enqueued[0].JobID != "retry" || enqueued[0].Attempt != 2 {
+		t.Errorf("enqueued %+v, want retry at attempt 2", enqueued)
+	}
+	if job, err := LoadMessage(ctx, client, "retry"); err != nil || job.Attempt != 2 {
+		t.Errorf("stored message of retry: %+v, %v", job, err)
+	}
+
+	for jobID, want := range map[string]string{"retry": model.StatusQueued, "exhausted": model.StatusFailed, "no-message": model.StatusFailed, "finished": model.StatusCompleted, "running": model.StatusProcessing} {
+		state, err := store.Load(ctx, jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Status != want {
+			t.Errorf("status of %s = %s, want %s", jobID, state.Status, want)
+		}
+		if want == model.StatusFailed && (state.Details["reaped"] != "true" || state.Error == "") {
+			t.Errorf("failed job %s: details %v, error %q", jobID, state.Details, state.Error)
+		}
+	}
+	if stuck, _ := client.ZRange(ctx, model.ProcessingKey, 0, -1).Result(); strings.Join(stuck, ",") != "running" {
+		t.Errorf("processing jobs after scan: %v, want only running", stuck)
+	}
+}
+
+func TestScanEnqueueError(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := model.NewStore(client, time.Hour)
+	r := New(client, DefaultConfig(), func(context.Context, messaging.JobMessage) error {
+		return errors.New("broker down")
+	})
+
+	stuckJob(t, client, store, "job1", 1)
+	if _, err := r.Scan(ctx); err == nil {
+		t.Fatal("Scan succeeded with the broker down")
+	}
+	// The job is put back to be retried by the next scan
+	if state, _ := store.Load(ctx, "job1"); state == nil || state.Status != model.StatusProcessing {
+		t.Errorf("status after failed enqueue: %+v", state)
+	}
+	if score, err := client.ZScore(ctx, model.ProcessingKey, "job1").Result(); err != nil || score > float64(time.Now().Add(-30*time.Minute).Unix()) {
+		t.Errorf("job not back in processing with its start time: %v, %v", score, err)
+	}
+}
@@ -0,0 +1,246 @@
+// Package speech synthesizes the translated text of a job into an MP3 file,
+// for users who listen to documents rather than read them
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// Synthesizer converts text to speech
+type Synthesizer interface {
+	// Name identifies the synthesizer in logs and job details
+	Name() string
+	// Check reports whether the synthesizer can be used (tools installed, key set)
+	Check() error
+	// Synthesize writes the MP3 audio of text, spoken in lang (ISO 639-1), to w
+	Synthesize(ctx context.Context, w io.Writer, text, lang string) error
+}
+
+// Engines selected by TTS_ENGINE
+const (
+	EngineESpeak = "espeak" // espeak-ng, encoded to MP3 by ffmpeg (default)
+	EngineGoogle = "google" // Google Cloud Text-to-Speech
+)
+
+// FromEnv builds the synthesizer selected by the environment:
+//
+//	TTS_ENGINE    espeak (default) or google
+//	TTS_API_KEY   API key of Google Cloud Text-to-Speech
+//	TTS_ENDPOINT  base URL of the Google API, default https://texttospeech.googleapis.com
+//	TTS_VOICE     voice name (espeak-ng voice or Google voice), default: the voice of the language
+func FromEnv() (Synthesizer, error) {
+	voice := os.Getenv("TTS_VOICE")
+	switch engine := strings.ToLower(strings.TrimSpace(os.Getenv("TTS_ENGINE"))); engine {
+	case "", EngineESpeak:
+		return ESpeak{Voice: voice}, nil
+	case EngineGoogle:
+		apiKey := os.Getenv("TTS_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("TTS_API_KEY is required for the google text-to-speech engine")
+		}
+		return NewGoogle(os.Getenv("TTS_ENDPOINT"), apiKey, voice), nil
+	default:
+		return nil, fmt.Errorf("unknown text-to-speech engine %q (want espeak or google)", engine)
+	}
+}
+
+// ESpeak speaks with espeak-ng, offline, and encodes the WAV output to MP3
+// with ffmpeg. The voice is robotic but every language of the OCR is covered.
+type ESpeak struct {
+	Voice string // espeak-ng voice, empty uses the language
+}
+
+func (ESpeak) Name() string { return EngineESpeak }
+
+func (ESpeak) Check() error {
+	for _, tool := range []string{"espeak-ng", "ffmpeg"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("%s executable not found in PATH: %w", tool, err)
+		}
+	}
+	return nil
+}
+
+// espeakVoices are the espeak-ng voices of languages whose code is not the
+// voice name
+var espeakVoices = map[string]string{
+	"zh": "cmn",
+	"no": "nb",
+}
+
+func (e ESpeak) Synthesize(ctx context.Context, w io.Writer, text, lang string) error {
+	voice := e.Voice
+	if voice == "" {
+		voice = lang
+		if v, ok := espeakVoices[lang]; ok {
+			voice = v
+		}
+	}
+	// espeak-ng --stdout | ffmpeg: the WAV is never written to disk
+	speak := exec.CommandContext(ctx, "espeak-ng", "-v", voice, "--stdin", "--stdout")
+	speak.Stdin = strings.NewReader(text)
+	var speakErr, encodeErr strings.Builder
+	speak.Stderr = &speakErr
+	wav, err := speak.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	encode := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-f", "wav", "-i", "pipe:0", "-codec:a", "libmp3lame", "-q:a", "5", "-f", "mp3", "pipe:1")
+	encode.Stdin = wav
+	encode.Stdout = w
+	encode.Stderr = &encodeErr
+	if err := speak.Start(); err != nil {
+		return fmt.Errorf("failed to start espeak-ng: %w", err)
+	}
+	if err := encode.Start(); err != nil {
+		speak.Process.Kill()
+		speak.Wait()
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	encodeWait := encode.Wait()
+	speakWait := speak.Wait()
+	usage.TrackProcess(ctx, speak.ProcessState)
+	usage.TrackProcess(ctx, encode.ProcessState)
+	if speakWait != nil {
+		return fmt.Errorf("espeak-ng failed: %v: %s", speakWait, strings.TrimSpace(speakErr.String()))
+	}
+	if encodeWait != nil {
+		return fmt.Errorf("ffmpeg failed: %v: %s", encodeWait, strings.TrimSpace(encodeErr.String()))
+	}
+	return nil
+}
+
+// maxGoogleInput is the longest text, in bytes, of one Google request
+const maxGoogleInput = 4800
+
+// Google calls the Google Cloud Text-to-Speech REST API (text:synthesize).
+// Long texts are sent in chunks of whole sentences; the MP3 of the chunks
+// are concatenated, which players handle as one stream.
+type Google struct {
+	Endpoint string
+	APIKey   string
+	Voice    string // Voice name, e.g. "vi-VN-Wavenet-A", empty lets Google pick by language
+	client   *http.Client
+}
+
+// NewGoogle creates a synthesizer for the API at endpoint (empty: Google's)
+func NewGoogle(endpoint, apiKey, voice string) *Google {
+	if endpoint == "" {
+		endpoint = "https://texttospeech.googleapis.com"
+	}
+	return &Google{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		APIKey:   apiKey,
+		Voice:    voice,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (*Google) Name() string { return EngineGoogle }
+
+func (g *Google) Check() error {
+	if g.APIKey == "" {
+		return fmt.Errorf("google text-to-speech requires an API key")
+	}
+	return nil
+}
+
+func (g *Google) Synthesize(ctx context.Context, w io.Writer, text, lang string) error {
+	for _, chunk := range splitText(text, maxGoogleInput) {
+		audio, err := g.synthesize(ctx, chunk, lang)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(audio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Google) synthesize(ctx context.Context, text, lang string) ([]byte, error) {
+	voice := map[string]string{"languageCode": lang}
+	if g.Voice != "" {
+		voice["name"] = g.Voice
+	}
+	body, err := json.Marshal(map[string]any{
+		"input":       map[string]string{"text": text},
+		"voice":       voice,
+		"audioConfig": map[string]string{"audioEncoding": "MP3"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.Endpoint+"/v1/text:synthesize?key="+g.APIKey, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("text-to-speech request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		AudioContent string `json:"audioContent"`
+		Error        *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid text-to-speech response (status %d)", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message := ""
+		if result.Error != nil {
+			message = result.Error.Message
+		}
+		return nil, fmt.Errorf("text-to-speech returned status %d: %s", resp.StatusCode, message)
+	}
+	return base64.StdEncoding.DecodeString(result.AudioContent)
+}
+
+// splitText cuts text into chunks of at most limit bytes, at a paragraph,
+// sentence or word boundary when there is one
+func splitText(text string, limit int) []string {
+	var chunks []string
+	text = strings.TrimSpace(text)
+	for len(text) > limit {
+		cut := -1
+		for _, sep := range []string{"\n", ". ", " "} {
+			if i := strings.LastIndex(text[:limit], sep); i > 0 {
+				cut = i + len(sep)
+				break
+			}
+		}
+		if cut < 0 {
+			// No boundary: cut at the last full rune
+			cut = limit
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		if chunk := strings.TrimSpace(text[:cut]); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
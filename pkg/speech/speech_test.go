@@ -0,0 +1,28 @@
+package speech
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short", " Xin chào. ", 20, []string{"Xin chào."}},
+		{"paragraphs first", "One two.\nThree four five.", 20, []string{"One two.", "Three four five."}},
+		{"sentences", "One two. Three four. Five", 12, []string{"One two.", "Three four.", "Five"}},
+		{"words", "alpha beta gamma", 11, []string{"alpha beta", "gamma"}},
+		{"no boundary keeps runes whole", "ááááá", 5, []string{"áá", "áá", "á"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitText(tt.text, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
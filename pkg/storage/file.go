@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStorage stores objects as files below a root directory
+type FileStorage struct {
+	root string
+}
+
+// NewFileStorage creates a FileStorage rooted at dir
+func NewFileStorage(dir string) *FileStorage {
+	return &FileStorage{root: dir}
+}
+
+// Name implements Storage
+func (s *FileStorage) Name() string { return "file" }
+
+// Path returns the file path of key, rejecting keys that escape the root.
+// Keys are relative to the root; ".." segments are allowed as long as the
+// cleaned path stays below it ("a/../b" is "b", "report..v2.pdf" is a name).
+func (s *FileStorage) Path(key string) (string, error) {
+	path := filepath.Join(s.root, key)
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return path, nil
+}
+
+// Create implements Storage. Data is written to a temporary file in the
+// same directory and renamed into place on Close, so readers never see a
+// partial object.
+func (s *FileStorage) Create(ctx context.Context, key string) (Writer, error) {
+	path, err := s.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &fileWriter{File: tmp, path: path}, nil
+}
+
+type fileWriter struct {
+	*os.File
+	path string
+}
+
+func (w *fileWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	return os.Rename(w.File.Name(), w.path)
+}
+
+func (w *fileWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.File.Name())
+}
+
+// Open implements Storage
+func (s *FileStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete implements Storage
+func (s *FileStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
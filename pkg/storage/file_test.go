@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoragePath(t *testing.T) {
+	root := t.TempDir()
+	s := NewFileStorage(root)
+	tests := []struct {
+		key  string
+		want string // "" when the key is rejected
+	}{
+		{"pdfs/job.pdf", "pdfs/job.pdf"},
+		{"pdfs/report..v2.pdf", "pdfs/report..v2.pdf"},
+		{"pdfs/..hidden", "pdfs/..hidden"},
+		{"pdfs/../uploads/a.png", "uploads/a.png"},
+		{"/pdfs/job.pdf", "pdfs/job.pdf"},
+		{"", ""},
+		{".", ""},
+		{"pdfs/..", ""},
+		{"..", ""},
+		{"../outside", ""},
+		{"pdfs/../../outside", ""},
+		{"../" + filepath.Base(root) + "x/file", ""},
+	}
+	for _, tt := range tests {
+		got, err := s.Path(tt.key)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Path(%q) = %q, want an error", tt.key, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Path(%q): %v", tt.key, err)
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("Path(%q) = %q, want %q", tt.key, got, want)
+		}
+	}
+}
+
+func TestFileStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStorage(t.TempDir())
+
+	w, err := s.Create(ctx, "pdfs/job.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "%PDF-1.4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(ctx, "pdfs/job.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("object visible before Close: err = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Open(ctx, "pdfs/job.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "%PDF-1.4" {
+		t.Fatalf("Open = %q, %v", data, err)
+	}
+
+	if err := s.Delete(ctx, "pdfs/job.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "pdfs/job.pdf"); err != nil {
+		t.Fatalf("deleting a missing object: %v", err)
+	}
+	if _, err := s.Open(ctx, "pdfs/job.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open after Delete: err = %v", err)
+	}
+
+	w, err = s.Create(ctx, "pdfs/aborted.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "partial")
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(ctx, "pdfs/aborted.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("aborted object is visible: err = %v", err)
+	}
+}
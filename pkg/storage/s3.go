@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/awssig"
+)
+
+// S3Config configures an S3 (or S3-compatible, e.g. MinIO) bucket
+type S3Config struct {
+	Bucket    string
+	Region    string // Default "us-east-1"
+	Endpoint  string // Default "https://s3.<region>.amazonaws.com"; objects use path-style URLs
+	AccessKey string
+	SecretKey string
+	// SessionToken accompanies temporary credentials (Lambda, ECS task roles)
+	SessionToken string
+}
+
+// S3Storage stores objects in an S3 bucket using AWS Signature Version 4
+type S3Storage struct {
+	config S3Config
+	signer awssig.Signer
+	client *http.Client
+}
+
+// NewS3Storage creates an S3Storage
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 storage requires a bucket")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3 storage requires an access key and a secret key")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	if _, err := url.ParseRequestURI(config.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", config.Endpoint, err)
+	}
+	signer := awssig.Signer{
+		AccessKey:    config.AccessKey,
+		SecretKey:    config.SecretKey,
+		SessionToken: config.SessionToken,
+		Region:       config.Region,
+		Service:      "s3",
+	}
+	return &S3Storage{config: config, signer: signer, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+}
+
+// Name implements Storage
+func (s *S3Storage) Name() string { return "s3" }
+
+// s3PartSize is the size of the parts of a multipart upload. S3 requires at
+// least 5 MiB for every part but the last.
+const s3PartSize = 8 << 20
+
+// Create implements Storage. The content is sent in parts of s3PartSize as
+// it is written (multipart upload), so at most one part is held in memory.
+// Objects smaller than a part are uploaded with a single PUT on Close.
+func (s *S3Storage) Create(ctx context.Context, key string) (Writer, error) {
+	return &s3Writer{ctx: ctx, storage: s, key: key}, nil
+}
+
+type s3Writer struct {
+	ctx      context.Context
+	storage  *S3Storage
+	key      string
+	buf      bytes.Buffer // Content of the next part
+	uploadID string       // Multipart upload, "" until the first part is sent
+	parts    []s3Part
+	err      error // First failure, the upload is aborted
+}
+
+// s3Part is an uploaded part, as listed in CompleteMultipartUpload
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), s3PartSize-w.buf.Len())
+		w.buf.Write(p[:n])
+		p, written = p[n:], written+n
+		if w.buf.Len() == s3PartSize {
+			if err := w.uploadPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *s3Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.uploadID == "" {
+		body := w.buf.Bytes()
+		req, err := w.storage.newRequest(w.ctx, "PUT", w.key, nil, bytes.NewReader(body), awssig.PayloadHash(body))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = int64(len(body))
+		resp, err := w.storage.do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if w.buf.Len() > 0 {
+		if err := w.uploadPart(); err != nil {
+			return err
+		}
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return w.fail(err)
+	}
+	req, err := w.storage.newRequest(w.ctx, "POST", w.key, url.Values{"uploadId": {w.uploadID}}, bytes.NewReader(body), awssig.PayloadHash(body))
+	if err != nil {
+		return w.fail(err)
+	}
+	req.ContentLength = int64(len(body))
+	resp, err := w.storage.do(req)
+	if err != nil {
+		return w.fail(err)
+	}
+	defer resp.Body.Close()
+	// S3 answers 200 before combining the parts and reports a failure in the body
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return w.fail(fmt.Errorf("invalid S3 CompleteMultipartUpload response: %w", err))
+	}
+	if result.XMLName.Local == "Error" {
+		return w.fail(fmt.Errorf("S3 CompleteMultipartUpload failed: %s: %s", result.Code, result.Message))
+	}
+	w.uploadID = ""
+	return nil
+}
+
+// Abort discards the buffered content and aborts the multipart upload, so
+// that S3 does not keep (and bill) the parts already sent
+func (w *s3Writer) Abort() error {
+	w.buf.Reset()
+	if w.uploadID == "" {
+		return nil
+	}
+	uploadID := w.uploadID
+	w.uploadID = ""
+	// Also when the job was cancelled: the parts would stay in the bucket
+	req, err := w.storage.newRequest(context.WithoutCancel(w.ctx), "DELETE", w.key, url.Values{"uploadId": {uploadID}}, nil, awssig.PayloadHash(nil))
+	if err != nil {
+		return err
+	}
+	resp, err := w.storage.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// uploadPart sends the buffered content as the next part, starting the
+// multipart upload with the first one
+func (w *s3Writer) uploadPart() error {
+	if w.uploadID == "" {
+		req, err := w.storage.newRequest(w.ctx, "POST", w.key, url.Values{"uploads": {""}}, nil, awssig.PayloadHash(nil))
+		if err != nil {
+			return w.fail(err)
+		}
+		resp, err := w.storage.do(req)
+		if err != nil {
+			return w.fail(err)
+		}
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil || result.UploadID == "" {
+			return w.fail(fmt.Errorf("invalid S3 CreateMultipartUpload response: %v", err))
+		}
+		w.uploadID = result.UploadID
+	}
+
+	body := w.buf.Bytes()
+	number := len(w.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {w.uploadID}}
+	req, err := w.storage.newRequest(w.ctx, "PUT", w.key, query, bytes.NewReader(body), awssig.PayloadHash(body))
+	if err != nil {
+		return w.fail(err)
+	}
+	req.ContentLength = int64(len(body))
+	resp, err := w.storage.do(req)
+	if err != nil {
+		return w.fail(err)
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, s3Part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	w.buf.Reset()
+	return nil
+}
+
+// fail records err, after which the writer only returns it, and aborts the
+// upload
+func (w *s3Writer) fail(err error) error {
+	w.err = err
+	w.Abort()
+	return err
+}
+
+// Open implements Storage
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, "GET", key, nil, nil, awssig.PayloadHash(nil))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete implements Storage
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, "DELETE", key, nil, nil, awssig.PayloadHash(nil))
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PresignGet implements Presigner
+func (s *S3Storage) PresignGet(key string, expires time.Duration) (string, error) {
+	u, err := url.Parse(s.objectURL(key))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.config.AccessKey+"/"+s.signer.Scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if s.config.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		u.EscapedPath(),
+		awssig.CanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		awssig.UnsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signer.Signature(now, canonicalRequest))
+	u.RawQuery = awssig.CanonicalQuery(query)
+	return u.String(), nil
+}
+
+func (s *S3Storage) objectURL(key string) string {
+	segments := strings.Split(strings.TrimLeft(key, "/"), "/")
+	for i, seg := range segments {
+		segments[i] = awssig.Escape(seg)
+	}
+	return s.config.Endpoint + "/" + awssig.Escape(s.config.Bucket) + "/" + strings.Join(segments, "/")
+}
+
+// newRequest creates a request on the object key with the query (nil for
+// none), signed with SigV4 header authentication
+func (s *S3Storage) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader, payloadHash string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = awssig.CanonicalQuery(query)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	s.signer.Sign(req, payloadHash, time.Now())
+	return req, nil
+}
+
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s request failed: %w", req.Method, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s returned %s: %s", req.Method, resp.Status, string(msg))
+	}
+	return resp, nil
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/awssig"
+)
+
+// fakeS3 keeps objects and multipart uploads in memory. Requests with a
+// partNumber in failParts, or completions when failComplete is set, fail.
+type fakeS3 struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	uploads      map[string][][]byte // Parts by upload ID
+	requests     []string            // Method and query of each request
+	failParts    map[string]bool
+	failComplete bool
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Storage) {
+	f := &fakeS3{objects: map[string][]byte{}, uploads: map[string][][]byte{}, failParts: map[string]bool{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	s, err := NewS3Storage(S3Config{Bucket: "bucket", Endpoint: server.URL, AccessKey: "AK", SecretKey: "SK"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, s
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") ||
+		r.Header.Get("X-Amz-Content-Sha256") != awssig.PayloadHash(body) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.URL.RawQuery))
+	parts, uploading := f.uploads[uploadID]
+	switch {
+	case r.Method == "POST" && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = nil
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, id)
+	case uploadID != "" && !uploading:
+		http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+	case r.Method == "PUT" && uploadID != "":
+		if f.failParts[query.Get("partNumber")] {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		f.uploads[uploadID] = append(parts, body)
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%s"`, query.Get("partNumber")))
+	case r.Method == "POST" && uploadID != "":
+		if f.failComplete {
+			// S3 reports some failures of the completion in a 200 response
+			fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>We encountered an internal error.</Message></Error>")
+			return
+		}
+		var complete struct {
+			Parts []s3Part `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil || len(complete.Parts) != len(parts) {
+			http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, i+1) {
+				http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+				return
+			}
+		}
+		f.objects[key] = bytes.Join(parts, nil)
+		delete(f.uploads, uploadID)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult><Key>"+key+"</Key></CompleteMultipartUploadResult>")
+	case r.Method == "DELETE" && uploadID != "":
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT":
+		f.objects[key] = body
+	case r.Method == "GET":
+		if object, ok := f.objects[key]; ok {
+			w.Write(object)
+		} else {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+		}
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// writeChunks writes content in chunks of an odd size, not aligned with the
+// parts
+func writeChunks(w io.Writer, content []byte) error {
+	for len(content) > 0 {
+		n := min(len(content), 1<<20+7)
+		if _, err := w.Write(content[:n]); err != nil {
+			return err
+		}
+		content = content[n:]
+	}
+	return nil
+}
+
+func TestS3StorageUpload(t *testing.T) {
+	ctx := context.Background()
+	content := make([]byte, 2*s3PartSize+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	tests := []struct {
+		name         string
+		size         int
+		wantRequests []string
+	}{
+		{"small object", 100, []string{"PUT"}},
+		{"empty object", 0, []string{"PUT"}},
+		{"exactly one part", s3PartSize, []string{"POST uploads=", "PUT partNumber=1&uploadId=upload-1", "POST uploadId=upload-1"}},
+		{"several parts", len(content), []string{"POST uploads=", "PUT partNumber=1&uploadId=upload-1",
+			"PUT partNumber=2&uploadId=upload-1", "PUT partNumber=3&uploadId=upload-1", "POST uploadId=upload-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, s := newFakeS3(t)
+			w, err := s.Create(ctx, "pdfs/job.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeChunks(w, content[:tt.size]); err != nil {
+				t.Fatal(err)
+			}
+			if buffered := w.(*s3Writer).buf.Cap(); buffered > 2*s3PartSize {
+				t.Errorf("%d bytes buffered", buffered)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(f.requests, ", ") != strings.Join(tt.wantRequests, ", ") {
+				t.Errorf("requests = %q, want %q", f.requests, tt.wantRequests)
+			}
+			r, err := s.Open(ctx, "pdfs/job.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if got, _ := io.ReadAll(r); !bytes.Equal(got, content[:tt.size]) {
+				t.Errorf("stored %d bytes, want %d", len(got), tt.size)
+			}
+		})
+	}
+}
+
+func TestS3StorageUploadFailure(t *testing.T) {
+	ctx := context.Background()
+	content := make([]byte, 2*s3PartSize+100)
+
+	// A failed part aborts the upload, and the writer keeps the error
+	f, s := newFakeS3(t)
+	f.failParts["2"] = true
+	w, _ := s.Create(ctx, "pdfs/job.pdf")
+	if err := writeChunks(w, content); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("Write = %v, want the part error", err)
+	}
+	if _, err := w.Write([]byte("more")); err == nil {
+		t.Error("Write after a failed part succeeded")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close after a failed part succeeded")
+	}
+	if len(f.uploads) != 0 || len(f.objects) != 0 {
+		t.Errorf("%d uploads and %d objects left", len(f.uploads), len(f.objects))
+	}
+
+	// A failure reported in the body of the completion
+	f, s = newFakeS3(t)
+	f.failComplete = true
+	w, _ = s.Create(ctx, "pdfs/job.pdf")
+	writeChunks(w, content)
+	if err := w.Close(); err == nil || !strings.Contains(err.Error(), "InternalError") {
+		t.Errorf("Close = %v, want the completion error", err)
+	}
+	if len(f.uploads) != 0 || len(f.objects) != 0 {
+		t.Errorf("%d uploads and %d objects left", len(f.uploads), len(f.objects))
+	}
+
+	// Abort, also after the job was cancelled
+	f, s = newFakeS3(t)
+	cancelled, cancel := context.WithCancel(ctx)
+	w, _ = s.Create(cancelled, "pdfs/job.pdf")
+	writeChunks(w, content[:s3PartSize+1])
+	cancel()
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Abort(); err != nil {
+		t.Errorf("second Abort = %v", err)
+	}
+	if len(f.uploads) != 0 || len(f.objects) != 0 {
+		t.Errorf("%d uploads and %d objects left after Abort", len(f.uploads), len(f.objects))
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNotFound is returned by Open when the object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Storage stores artifacts (PDFs, uploads) by key, e.g. "pdfs/<jobID>.pdf"
+type Storage interface {
+	// Name identifies the backend in logs
+	Name() string
+	// Create returns a writer for key. The object becomes visible when the
+	// writer is closed; Abort discards it.
+	Create(ctx context.Context, key string) (Writer, error)
+	// Open returns the object content, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Writer is an object being written
+type Writer interface {
+	io.WriteCloser
+	// Abort discards everything written so far
+	Abort() error
+}
+
+// Presigner is implemented by backends that can hand out temporary direct
+// download URLs, so large files do not have to be proxied by the API
+type Presigner interface {
+	PresignGet(key string, expires time.Duration) (string, error)
+}
+
+// Backend names accepted by FromEnv
+const (
+	BackendFile = "file"
+	BackendS3   = "s3"
+)
+
+// FromEnv creates the backend selected by STORAGE_BACKEND: "file" (default,
+// rooted at fileRoot) or "s3" (configured by S3_BUCKET, S3_REGION,
+// S3_ENDPOINT, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN;
+// the region falls back to AWS_REGION, which Lambda sets)
+func FromEnv(fileRoot string) (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case BackendFile, "":
+		return NewFileStorage(fileRoot), nil
+	case BackendS3:
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		return NewS3Storage(S3Config{
+			Bucket:       os.Getenv("S3_BUCKET"),
+			Region:       region,
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected file or s3)", backend)
+	}
+}
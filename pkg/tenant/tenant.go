@@ -0,0 +1,286 @@
+// Package tenant scopes the API to tenants identified by their API keys. The
+// tenant is part of the job ID (see model.TenantJobID), so Redis keys, cache
+// keys and storage paths derived from the job ID are scoped with it; this
+// package holds the tenant registry, the daily job quotas and the per-tenant
+// job index.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/delivery"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// Tenant is a customer of the API
+type Tenant struct {
+	ID      string   `json:"id"`
+	APIKeys []string `json:"api_keys"`
+	// DailyJobs is the number of jobs the tenant may submit per UTC day,
+	// 0 for no limit
+	DailyJobs int `json:"daily_jobs,omitempty"`
+	// DailyChars is the number of characters the tenant's jobs may send to
+	// the translation provider per UTC day, 0 for no limit. A job is refused
+	// once the budget is used up; the job running over it is not cut.
+	DailyChars int64 `json:"daily_chars,omitempty"`
+	// Admin gives the API keys of the tenant access to the system-wide
+	// endpoints (statistics, workers), which show the jobs and errors of
+	// every tenant
+	Admin bool `json:"admin,omitempty"`
+	// Retention overrides the default retention of the tenant's finished
+	// jobs (RETENTION_*), per field: {"completed": "720h", "artifacts": "168h"}
+	Retention *model.Retention `json:"retention,omitempty"`
+	// Delivery names the Google Drive and Dropbox folders the tenant
+	// authorized; a job lists the names in its deliver option to get its
+	// PDF uploaded there
+	Delivery map[string]*delivery.Target `json:"delivery,omitempty"`
+}
+
+// Default is the tenant of every request when no registry is configured:
+// no API key, no quota, plain job IDs
+var Default = &Tenant{}
+
+// ErrQuotaExceeded is returned by Reserve when the daily quota is used up
+var ErrQuotaExceeded = errors.New("daily job quota exceeded")
+
+// IDs are used in job IDs, Redis keys and storage paths
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Registry maps API keys to tenants
+type Registry struct {
+	byKey map[string]*Tenant
+	byID  map[string]*Tenant
+}
+
+// Load reads a registry from a JSON file {"tenants": [...]}. References of
+// the form "${VAR}" are replaced with the environment variable VAR so the API
+// keys do not have to be stored in the file; an unset variable is an error.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = config.ExpandEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("tenant file %s: %w", path, err)
+	}
+	var file struct {
+		Tenants []*Tenant `json:"tenants"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid tenant file %s: %w", path, err)
+	}
+	r := &Registry{byKey: map[string]*Tenant{}, byID: map[string]*Tenant{}}
+	for _, t := range file.Tenants {
+		if !idPattern.MatchString(t.ID) {
+			return nil, fmt.Errorf("invalid tenant id %q: lowercase letters, digits, '-' and '_', up to 32 characters", t.ID)
+		}
+		if r.byID[t.ID] != nil {
+			return nil, fmt.Errorf("duplicate tenant id %q", t.ID)
+		}
+		r.byID[t.ID] = t
+		if t.DailyJobs < 0 {
+			return nil, fmt.Errorf("tenant %s: daily_jobs must not be negative", t.ID)
+		}
+		for name, target := range t.Delivery {
+			if target == nil {
+				return nil, fmt.Errorf("tenant %s: delivery target %q is empty", t.ID, name)
+			}
+			if err := target.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant %s: delivery target %q: %w", t.ID, name, err)
+			}
+		}
+		if len(t.APIKeys) == 0 {
+			return nil, fmt.Errorf("tenant %s has no api_keys", t.ID)
+		}
+		for _, key := range t.APIKeys {
+			if key == "" {
+				return nil, fmt.Errorf("tenant %s has an empty API key", t.ID)
+			}
+			if other, ok := r.byKey[key]; ok {
+				return nil, fmt.Errorf("API key of tenant %s is also used by tenant %s", t.ID, other.ID)
+			}
+			r.byKey[key] = t
+		}
+	}
+	return r, nil
+}
+
+// FromEnv loads the registry of TENANTS_FILE. Without TENANTS_FILE it returns
+// nil: every request belongs to Default.
+func FromEnv() (*Registry, error) {
+	path := os.Getenv("TENANTS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// Authenticate returns the tenant owning apiKey
+func (r *Registry) Authenticate(apiKey string) (*Tenant, bool) {
+	t, ok := r.byKey[apiKey]
+	return t, ok
+}
+
+// Tenant returns the tenant with the ID
+func (r *Registry) Tenant(id string) (*Tenant, bool) {
+	t, ok := r.byID[id]
+	return t, ok
+}
+
+// Tenants returns every tenant of the registry, sorted by ID
+func (r *Registry) Tenants() []*Tenant {
+	list := make([]*Tenant, 0, len(r.byID))
+	for _, t := range r.byID {
+		list = append(list, t)
+	}
+	slices.SortFunc(list, func(a, b *Tenant) int { return strings.Compare(a.ID, b.ID) })
+	return list
+}
+
+// QuotaKey counts the jobs submitted by the tenant on day (UTC)
+func QuotaKey(tenantID string, day time.Time) string {
+	return "tenant:" + tenantID + ":jobs:" + day.UTC().Format("2006-01-02")
+}
+
+// IndexKey is a sorted set of job ID -> unix time the job was submitted, for
+// listing the jobs of a tenant. The default tenant uses "tenant::jobs".
+func IndexKey(tenantID string) string { return "tenant:" + tenantID + ":jobs" }
+
+// RefKey is a sorted set of job ID -> unix time the job was submitted, for
+// finding the jobs of the tenant by a reference of the submitter: kind is
+// "external_id" (the ID in the records of the caller), "filename" (the name
+// of the uploaded file) or "label" (a "key=value" label of the job).
+func RefKey(tenantID, kind, value string) string {
+	return "tenant:" + tenantID + ":" + kind + ":" + value
+}
+
+// Ref is a reference of jobs (see RefKey)
+type Ref struct {
+	Kind  string
+	Value string
+}
+
+// GlossaryKey is the hash of the terms of a glossary of the tenant. The
+// default tenant keeps the unscoped "glossary:<name>".
+func GlossaryKey(tenantID, name string) string {
+	if tenantID == "" {
+		return "glossary:" + name
+	}
+	return "tenant:" + tenantID + ":glossary:" + name
+}
+
+// GlossaryIndexKey is the set of the glossary names of the tenant
+func GlossaryIndexKey(tenantID string) string {
+	if tenantID == "" {
+		return "glossaries"
+	}
+	return "tenant:" + tenantID + ":glossaries"
+}
+
+// Reserve counts a job against the daily quota of t, or returns
+// ErrQuotaExceeded (the job is not counted)
+func Reserve(ctx context.Context, client *redis.Client, t *Tenant) error {
+	if t.DailyJobs == 0 {
+		return nil
+	}
+	key := QuotaKey(t.ID, time.Now())
+	pipe := client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 48*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if incr.Val() > int64(t.DailyJobs) {
+		client.Decr(ctx, key)
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Usage returns the jobs submitted today by the tenant
+func Usage(ctx context.Context, client *redis.Client, tenantID string) (int, error) {
+	n, err := client.Get(ctx, QuotaKey(tenantID, time.Now())).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// Track adds a job to the index of its tenant. Jobs older than ttl (expired
+// in Redis) are dropped from the index.
+func Track(ctx context.Context, client *redis.Client, tenantID, jobID string, ttl time.Duration) error {
+	return track(ctx, client, IndexKey(tenantID), jobID, ttl)
+}
+
+// TrackRef adds a job to the index of a reference (see RefKey)
+func TrackRef(ctx context.Context, client *redis.Client, tenantID, kind, value, jobID string, ttl time.Duration) error {
+	return track(ctx, client, RefKey(tenantID, kind, value), jobID, ttl)
+}
+
+func track(ctx context.Context, client *redis.Client, key, jobID string, ttl time.Duration) error {
+	now := time.Now()
+	pipe := client.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.Unix()), Member: jobID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.Add(-ttl).Unix(), 10))
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Untrack removes a deleted job from the index of its tenant
+func Untrack(ctx context.Context, client *redis.Client, tenantID, jobID string) error {
+	return client.ZRem(ctx, IndexKey(tenantID), jobID).Err()
+}
+
+// Jobs returns the job IDs of the tenant, newest first, and the total number
+// of jobs in the index
+func Jobs(ctx context.Context, client *redis.Client, tenantID string, offset, limit int) ([]string, int64, error) {
+	return page(ctx, client, IndexKey(tenantID), offset, limit)
+}
+
+// RefJobs returns the job IDs of the tenant submitted with every reference
+// of refs, newest first, and their total number
+func RefJobs(ctx context.Context, client *redis.Client, tenantID string, refs []Ref, offset, limit int) ([]string, int64, error) {
+	keys := make([]string, len(refs))
+	for i, ref := range refs {
+		keys[i] = RefKey(tenantID, ref.Kind, ref.Value)
+	}
+	if len(keys) == 1 {
+		return page(ctx, client, keys[0], offset, limit)
+	}
+	// Intersection in a transaction: the temporary key is never seen by
+	// another request
+	tmp := "tenant:" + tenantID + ":refs:query"
+	pipe := client.TxPipeline()
+	pipe.ZInterStore(ctx, tmp, &redis.ZStore{Keys: keys, Aggregate: "MAX"})
+	ids := pipe.ZRevRange(ctx, tmp, int64(offset), int64(offset+limit-1))
+	total := pipe.ZCard(ctx, tmp)
+	pipe.Del(ctx, tmp)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+	return ids.Val(), total.Val(), nil
+}
+
+func page(ctx context.Context, client *redis.Client, key string, offset, limit int) ([]string, int64, error) {
+	pipe := client.Pipeline()
+	ids := pipe.ZRevRange(ctx, key, int64(offset), int64(offset+limit-1))
+	total := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+	return ids.Val(), total.Val(), nil
+}
@@ -0,0 +1,293 @@
+package testutil
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DocumentOptions controls how a synthetic document image is rendered.
+// Zero values select the defaults noted on each field.
+type DocumentOptions struct {
+	Text       string  // Text to render; paragraphs are separated by blank lines
+	DPI        int     // Resolution, default 150
+	FontSizePt float64 // Glyph height in points, default 12
+	Bold       bool    // Thicken strokes by one pixel
+	WidthIn    float64 // Page width in inches, default 8.27 (A4); height fits the text
+	MarginIn   float64 // Page margin in inches, default 0.5
+	Noise      float64 // Share of pixels flipped to random gray levels (0..1)
+	Rotation   float64 // Rotation in degrees, counter-clockwise
+	Contrast   float64 // Ink darkness (0..1), default 1 (black on white)
+	Font       string  // FontMono (default), FontItalic or FontWide
+	Seed       int64   // Seed for the noise, the same seed gives the same image
+}
+
+// Variants of the built-in bitmap font accepted in DocumentOptions.Font
+const (
+	FontMono   = "mono"   // Upright 5x7 glyphs
+	FontItalic = "italic" // Glyphs slanted to the right
+	FontWide   = "wide"   // Glyphs twice as wide
+)
+
+func (o DocumentOptions) withDefaults() DocumentOptions {
+	if o.DPI <= 0 {
+		o.DPI = 150
+	}
+	if o.FontSizePt <= 0 {
+		o.FontSizePt = 12
+	}
+	if o.WidthIn <= 0 {
+		o.WidthIn = 8.27
+	}
+	if o.MarginIn <= 0 {
+		o.MarginIn = 0.5
+	}
+	if o.Contrast <= 0 || o.Contrast > 1 {
+		o.Contrast = 1
+	}
+	if o.Font == "" {
+		o.Font = FontMono
+	}
+	return o
+}
+
+// pageLayout is the size of the glyphs and the page of a document
+type pageLayout struct {
+	dotW, dotH int // Pixel size of one font dot so that a glyph is FontSizePt tall
+	slant      int // Horizontal shift in pixels of the top row of italic glyphs
+	charW      int
+	lineH      int
+	margin     int
+	width      int
+	lines      []string
+}
+
+func layoutDocument(opts DocumentOptions) (pageLayout, error) {
+	var l pageLayout
+	l.dotH = int(math.Round(opts.FontSizePt / 72 * float64(opts.DPI) / glyphHeight))
+	if l.dotH < 1 {
+		l.dotH = 1
+	}
+	l.dotW = l.dotH
+	switch opts.Font {
+	case FontMono:
+	case FontItalic:
+		l.slant = (glyphHeight - 1) * l.dotH / 2
+	case FontWide:
+		l.dotW = 2 * l.dotH
+	default:
+		return l, fmt.Errorf("unknown font %q (expected mono, italic or wide)", opts.Font)
+	}
+	l.charW = (glyphWidth + 1) * l.dotW // Rows of neighbouring italic glyphs shift alike and never overlap
+	l.lineH = (glyphHeight + 3) * l.dotH
+	l.margin = int(opts.MarginIn * float64(opts.DPI))
+	l.width = int(opts.WidthIn * float64(opts.DPI))
+	cols := (l.width - 2*l.margin - l.slant) / l.charW
+	if cols < 1 {
+		return l, fmt.Errorf("page width %.2fin is too narrow for %.1fpt text at %d DPI", opts.WidthIn, opts.FontSizePt, opts.DPI)
+	}
+	l.lines = wrapText(opts.Text, cols)
+	return l, nil
+}
+
+// RenderDocument renders the text as a grayscale document image
+func RenderDocument(opts DocumentOptions) (*image.Gray, error) {
+	opts = opts.withDefaults()
+	l, err := layoutDocument(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	height := 2*l.margin + len(l.lines)*l.lineH
+	img := image.NewGray(image.Rect(0, 0, l.width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	ink := uint8(255 * (1 - opts.Contrast))
+	for row, line := range l.lines {
+		y := l.margin + row*l.lineH
+		for col, r := range line {
+			drawGlyph(img, glyph(r), l.margin+col*l.charW, y, l, ink, opts.Bold)
+		}
+	}
+
+	if opts.Rotation != 0 {
+		img = rotate(img, opts.Rotation)
+	}
+	if opts.Noise > 0 {
+		addNoise(img, opts.Noise, opts.Seed)
+	}
+	return img, nil
+}
+
+// WriteDocument renders the document and saves it as a PNG file
+func WriteDocument(path string, opts DocumentOptions) error {
+	img, err := RenderDocument(opts)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// GroundTruth returns the text as it appears in the rendered image: one line
+// per rendered line, characters missing from the font replaced by '?'. OCR
+// output of the image is compared against it.
+func GroundTruth(opts DocumentOptions) (string, error) {
+	l, err := layoutDocument(opts.withDefaults())
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, len(l.lines))
+	for i, line := range l.lines {
+		lines[i] = strings.Map(func(r rune) rune {
+			if _, ok := glyphs[r]; !ok {
+				return '?'
+			}
+			return r
+		}, line)
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// WriteSample writes the document as <name>.png in dir and its ground truth
+// as <name>.gt.txt (the naming of Tesseract training data), and returns both
+// paths
+func WriteSample(dir, name string, opts DocumentOptions) (imagePath, textPath string, err error) {
+	truth, err := GroundTruth(opts)
+	if err != nil {
+		return "", "", err
+	}
+	imagePath = filepath.Join(dir, name+".png")
+	textPath = filepath.Join(dir, name+".gt.txt")
+	if err := WriteDocument(imagePath, opts); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(textPath, []byte(truth), 0644); err != nil {
+		return "", "", err
+	}
+	return imagePath, textPath, nil
+}
+
+// wrapText splits text into lines of at most cols characters, breaking at
+// spaces. Blank lines between paragraphs are kept.
+func wrapText(text string, cols int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := ""
+		for _, word := range words {
+			for len(word) > cols {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, word[:cols])
+				word = word[cols:]
+			}
+			switch {
+			case line == "":
+				line = word
+			case len(line)+1+len(word) <= cols:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func drawGlyph(img *image.Gray, g [glyphHeight]string, x, y int, l pageLayout, ink uint8, bold bool) {
+	for gy, row := range g {
+		// Italic: rows are shifted right, the more the higher they are
+		shift := 0
+		if l.slant > 0 {
+			shift = l.slant * (glyphHeight - 1 - gy) / (glyphHeight - 1)
+		}
+		for gx, dot := range row {
+			if dot != '#' {
+				continue
+			}
+			w := l.dotW
+			if bold {
+				w++
+			}
+			for dy := 0; dy < l.dotH; dy++ {
+				for dx := 0; dx < w; dx++ {
+					img.SetGray(x+shift+gx*l.dotW+dx, y+gy*l.dotH+dy, color.Gray{Y: ink})
+				}
+			}
+		}
+	}
+}
+
+// rotate returns the image rotated by degrees around its center, expanded
+// to fit and filled with white. Pixels are sampled bilinearly.
+func rotate(src *image.Gray, degrees float64) *image.Gray {
+	rad := degrees * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	sw, sh := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+	dw := int(math.Ceil(math.Abs(sw*cos) + math.Abs(sh*sin)))
+	dh := int(math.Ceil(math.Abs(sw*sin) + math.Abs(sh*cos)))
+
+	dst := image.NewGray(image.Rect(0, 0, dw, dh))
+	scx, scy := sw/2, sh/2
+	dcx, dcy := float64(dw)/2, float64(dh)/2
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Inverse mapping: find the source point of each destination pixel
+			fx, fy := float64(x)-dcx, float64(y)-dcy
+			sx := fx*cos - fy*sin + scx
+			sy := fx*sin + fy*cos + scy
+			dst.Pix[y*dst.Stride+x] = bilinear(src, sx, sy)
+		}
+	}
+	return dst
+}
+
+func bilinear(img *image.Gray, x, y float64) uint8 {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	at := func(px, py int) float64 {
+		if !(image.Point{px, py}.In(img.Bounds())) {
+			return 255
+		}
+		return float64(img.Pix[py*img.Stride+px])
+	}
+	top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+	bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+	return uint8(math.Round(top*(1-fy) + bottom*fy))
+}
+
+// addNoise sets a share of the pixels to random gray levels (salt and pepper)
+func addNoise(img *image.Gray, amount float64, seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	for i := range img.Pix {
+		if rng.Float64() < amount {
+			img.Pix[i] = uint8(rng.Intn(256))
+		}
+	}
+}
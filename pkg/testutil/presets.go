@@ -0,0 +1,76 @@
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// SampleText is an English paragraph with digits and punctuation, used when
+// a generated document does not need specific content
+const SampleText = `Invoice 2024-0117 was issued on March 5 to Northwind Traders.
+The total amount due is 1,250.00 USD, payable within 30 days.
+
+Please contact support@example.com for questions about this document.`
+
+// words is the vocabulary of Paragraphs: common words of business documents
+var words = strings.Fields(`account address amount annual balance bank board budget
+	building business change client committee company contract cost customer date
+	delivery department document employee equipment estimate final general group
+	invoice item letter manager market meeting member month number office order
+	payment period plan price product project quarter receipt record report
+	request review sales schedule service shipment staff statement supplier
+	system tax team total transfer update value week year approved received
+	signed pending issued current previous monthly attached required new`)
+
+// Paragraphs generates count paragraphs of English-like text with numbers and
+// punctuation, separated by blank lines. The same seed gives the same text,
+// so documents of any length can be rendered with known content.
+func Paragraphs(count int, seed int64) string {
+	rng := rand.New(rand.NewSource(seed))
+	paragraphs := make([]string, count)
+	for p := range paragraphs {
+		sentences := make([]string, 2+rng.Intn(3))
+		for s := range sentences {
+			n := 6 + rng.Intn(9)
+			sentence := make([]string, n)
+			for w := range sentence {
+				switch {
+				case rng.Intn(10) == 0:
+					sentence[w] = strconv.Itoa(1 + rng.Intn(9999))
+				default:
+					sentence[w] = words[rng.Intn(len(words))]
+				}
+				if w < n-1 && rng.Intn(12) == 0 {
+					sentence[w] += ","
+				}
+			}
+			sentence[0] = strings.ToUpper(sentence[0][:1]) + sentence[0][1:]
+			sentences[s] = strings.Join(sentence, " ") + "."
+		}
+		paragraphs[p] = strings.Join(sentences, " ")
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// Difficulty levels accepted by Difficulty
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+// Difficulty returns options for a named difficulty level. The result can
+// be adjusted further before rendering (for example to set Text).
+func Difficulty(level string) (DocumentOptions, error) {
+	switch level {
+	case DifficultyEasy:
+		return DocumentOptions{Text: SampleText, DPI: 300}, nil
+	case DifficultyMedium:
+		return DocumentOptions{Text: SampleText, DPI: 200, Noise: 0.02, Rotation: 1.5}, nil
+	case DifficultyHard:
+		return DocumentOptions{Text: SampleText, DPI: 100, FontSizePt: 10, Noise: 0.08, Rotation: 4, Contrast: 0.6}, nil
+	}
+	return DocumentOptions{}, fmt.Errorf("unknown difficulty %q (expected easy, medium or hard)", level)
+}
@@ -0,0 +1,354 @@
+package textclean
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dictionary is a word list loaded from a Hunspell dictionary (.aff and .dic
+// files). The supported subset covers spellchecking, not morphology: SET
+// (UTF-8 or ISO8859-1), FLAG (default, long, num, UTF-8), TRY, REP, PFX and
+// SFX with cross products. Compounding and other options are ignored.
+type Dictionary struct {
+	words map[string]struct{}
+	try   []rune      // Characters tried when generating suggestions (TRY)
+	rep   [][2]string // Common misspellings, from -> to (REP)
+}
+
+type affixRule struct {
+	strip, add string
+	condition  []charClass // Matched at the end of the word (suffix) or its start (prefix)
+}
+
+type affix struct {
+	prefix bool
+	cross  bool // Combines with affixes of the other kind
+	rules  []affixRule
+}
+
+// charClass is a character of an affix condition: ".", "x", "[abc]" or "[^abc]"
+type charClass struct {
+	any    bool
+	negate bool
+	chars  string
+}
+
+func (c charClass) match(r rune) bool {
+	if c.any {
+		return true
+	}
+	return strings.ContainsRune(c.chars, r) != c.negate
+}
+
+// LoadHunspell loads the dictionary of the files base.aff and base.dic, e.g.
+// "/usr/share/hunspell/en_US"
+func LoadHunspell(base string) (*Dictionary, error) {
+	d := &Dictionary{words: map[string]struct{}{}}
+	affixes, flagMode, decode, err := d.loadAff(base + ".aff")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(base + ".dic")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := decode(scanner.Text())
+		if first {
+			first = false // Number of words
+			continue
+		}
+		// word/FLAGS, optionally followed by morphological fields
+		entry, _, _ := strings.Cut(strings.TrimSpace(line), "\t")
+		entry, _, _ = strings.Cut(entry, " ")
+		word, flags := entry, ""
+		if i := strings.LastIndex(entry, "/"); i > 0 && entry[i-1] != '\\' {
+			word, flags = entry[:i], entry[i+1:]
+		}
+		word = strings.ReplaceAll(word, `\/`, "/")
+		if word == "" {
+			continue
+		}
+		d.expand(word, parseFlags(flags, flagMode), affixes)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s.dic: %w", base, err)
+	}
+	if len(d.try) == 0 {
+		d.try = []rune("esianrtolcdugmphbyfvkwzxjq")
+	}
+	return d, nil
+}
+
+func (d *Dictionary) loadAff(path string) (map[string]*affix, string, func(string) string, error) {
+	affixes := map[string]*affix{}
+	flagMode := ""
+	decode := func(s string) string { return s }
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(decode(scanner.Text()))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "SET":
+			if len(fields) > 1 {
+				switch strings.ToUpper(fields[1]) {
+				case "UTF-8":
+				case "ISO8859-1":
+					decode = latin1
+				default:
+					return nil, "", nil, fmt.Errorf("%s: unsupported encoding %s (want UTF-8 or ISO8859-1)", path, fields[1])
+				}
+			}
+		case "FLAG":
+			if len(fields) > 1 {
+				flagMode = fields[1]
+			}
+		case "TRY":
+			if len(fields) > 1 {
+				d.try = []rune(fields[1])
+			}
+		case "REP":
+			if len(fields) == 3 {
+				d.rep = append(d.rep, [2]string{strings.ReplaceAll(fields[1], "_", " "), strings.ReplaceAll(fields[2], "_", " ")})
+			}
+		case "PFX", "SFX":
+			if len(fields) < 4 {
+				continue
+			}
+			a, ok := affixes[fields[1]]
+			if !ok {
+				// Header: PFX flag cross_product count
+				affixes[fields[1]] = &affix{prefix: fields[0] == "PFX", cross: fields[2] == "Y"}
+				continue
+			}
+			// Rule: PFX flag stripping affix[/flags] [condition]
+			rule := affixRule{}
+			if fields[2] != "0" {
+				rule.strip = fields[2]
+			}
+			rule.add, _, _ = strings.Cut(fields[3], "/")
+			if rule.add == "0" {
+				rule.add = ""
+			}
+			if len(fields) > 4 && fields[4] != "." {
+				rule.condition = parseCondition(fields[4])
+			}
+			a.rules = append(a.rules, rule)
+		}
+	}
+	return affixes, flagMode, decode, scanner.Err()
+}
+
+func latin1(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+func parseCondition(s string) []charClass {
+	var classes []charClass
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '.':
+			classes = append(classes, charClass{any: true})
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			class := charClass{chars: string(runes[i+1 : end])}
+			if strings.HasPrefix(class.chars, "^") {
+				class.negate, class.chars = true, class.chars[1:]
+			}
+			classes = append(classes, class)
+			i = end
+		default:
+			classes = append(classes, charClass{chars: string(runes[i])})
+		}
+	}
+	return classes
+}
+
+func parseFlags(flags, mode string) []string {
+	if flags == "" {
+		return nil
+	}
+	var out []string
+	switch mode {
+	case "long":
+		for i := 0; i+1 < len(flags); i += 2 {
+			out = append(out, flags[i:i+2])
+		}
+	case "num":
+		for _, f := range strings.Split(flags, ",") {
+			if _, err := strconv.Atoi(f); err == nil {
+				out = append(out, f)
+			}
+		}
+	default: // One character per flag
+		for _, r := range flags {
+			out = append(out, string(r))
+		}
+	}
+	return out
+}
+
+// expand adds the word and its forms with the affixes of its flags
+func (d *Dictionary) expand(word string, flags []string, affixes map[string]*affix) {
+	d.words[word] = struct{}{}
+	var prefixes, suffixes []*affix
+	for _, flag := range flags {
+		a, ok := affixes[flag]
+		if !ok {
+			continue
+		}
+		if a.prefix {
+			prefixes = append(prefixes, a)
+		} else {
+			suffixes = append(suffixes, a)
+		}
+	}
+	for _, s := range suffixes {
+		for _, rule := range s.rules {
+			form, ok := applySuffix(word, rule)
+			if !ok {
+				continue
+			}
+			d.words[form] = struct{}{}
+			if !s.cross {
+				continue
+			}
+			for _, p := range prefixes {
+				if !p.cross {
+					continue
+				}
+				for _, prule := range p.rules {
+					if both, ok := applyPrefix(form, prule); ok {
+						d.words[both] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	for _, p := range prefixes {
+		for _, rule := range p.rules {
+			if form, ok := applyPrefix(word, rule); ok {
+				d.words[form] = struct{}{}
+			}
+		}
+	}
+}
+
+func applySuffix(word string, rule affixRule) (string, bool) {
+	runes := []rune(word)
+	if len(rule.condition) > len(runes) || !strings.HasSuffix(word, rule.strip) {
+		return "", false
+	}
+	tail := runes[len(runes)-len(rule.condition):]
+	for i, class := range rule.condition {
+		if !class.match(tail[i]) {
+			return "", false
+		}
+	}
+	return strings.TrimSuffix(word, rule.strip) + rule.add, true
+}
+
+func applyPrefix(word string, rule affixRule) (string, bool) {
+	runes := []rune(word)
+	if len(rule.condition) > len(runes) || !strings.HasPrefix(word, rule.strip) {
+		return "", false
+	}
+	for i, class := range rule.condition {
+		if !class.match(runes[i]) {
+			return "", false
+		}
+	}
+	return rule.add + strings.TrimPrefix(word, rule.strip), true
+}
+
+// Knows reports whether the word is correct: listed, or listed in lowercase
+// when it is capitalized or in uppercase
+func (d *Dictionary) Knows(word string) bool {
+	if _, ok := d.words[word]; ok {
+		return true
+	}
+	lower := strings.ToLower(word)
+	if _, ok := d.words[lower]; ok {
+		return true
+	}
+	_, ok := d.words[capitalize(lower)]
+	return ok && word == strings.ToUpper(word)
+}
+
+// Suggest returns the known words one edit (deletion, transposition,
+// substitution or insertion of a TRY character) or one REP replacement away
+// from the word, REP suggestions first
+func (d *Dictionary) Suggest(word string) (rep, edits []string) {
+	lower := strings.ToLower(word)
+	seen := map[string]bool{lower: true}
+	add := func(list *[]string, candidate string) {
+		if !seen[candidate] && d.Knows(candidate) {
+			*list = append(*list, candidate)
+		}
+		seen[candidate] = true
+	}
+	for _, r := range d.rep {
+		for i := strings.Index(lower, r[0]); i >= 0; {
+			add(&rep, lower[:i]+r[1]+lower[i+len(r[0]):])
+			next := strings.Index(lower[i+1:], r[0])
+			if next < 0 {
+				break
+			}
+			i += 1 + next
+		}
+	}
+	runes := []rune(lower)
+	for i := range runes {
+		add(&edits, string(runes[:i])+string(runes[i+1:]))
+		if i+1 < len(runes) {
+			swapped := append([]rune(nil), runes...)
+			swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+			add(&edits, string(swapped))
+		}
+		for _, t := range d.try {
+			if t != runes[i] {
+				add(&edits, string(runes[:i])+string(t)+string(runes[i+1:]))
+			}
+		}
+	}
+	for i := 0; i <= len(runes); i++ {
+		for _, t := range d.try {
+			add(&edits, string(runes[:i])+string(t)+string(runes[i:]))
+		}
+	}
+	return rep, edits
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return strings.ToUpper(string(r)) + s[size:]
+}
@@ -0,0 +1,73 @@
+package textclean
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadHunspell(t *testing.T) {
+	known := []string{"walk", "walks", "walked", "lock", "locks", "locked", "unlock", "unlocks",
+		"city", "cities", "phones", "bake", "Walks", "UNLOCK"}
+	unknown := []string{
+		"unlocked", // D is not a cross product
+		"unwalk",   // walk has no U
+		"citys",    // [^y] condition
+		"baked",    // [^e] condition
+	}
+	// The same dictionary with the flags of every FLAG mode
+	for _, base := range []string{"flag_default", "flag_long", "flag_num", "flag_utf8"} {
+		t.Run(base, func(t *testing.T) {
+			dict, err := LoadHunspell("testdata/" + base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, word := range known {
+				if !dict.Knows(word) {
+					t.Errorf("%q unknown", word)
+				}
+			}
+			for _, word := range unknown {
+				if dict.Knows(word) {
+					t.Errorf("%q known", word)
+				}
+			}
+		})
+	}
+}
+
+func TestSpellchecker(t *testing.T) {
+	dict, err := LoadHunspell("testdata/flag_default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		text          string
+		minConfidence float64
+		want          string
+		confidence    float64 // Of the change, 0: none
+	}{
+		{"REP", "my fone", 0, "my phone", 1},
+		{"transposition", "Lcok it", 0, "Lock it", 1},
+		{"two suggestions", "walkz", 0.5, "walk", 0.5}, // walk and walks
+		{"below the threshold", "walkz", 0.6, "walkz", 0},
+		{"acronym", "WALKZ", 0, "WALKZ", 0},
+		{"too short", "lok", 0, "lok", 0},
+		{"no suggestion", "qqqqq", 0, "qqqqq", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Spellchecker{Dictionaries: map[string]*Dictionary{"en": dict}, MinConfidence: tt.minConfidence}
+			got, changes := s.ProcessDocument([]string{tt.text}, "en")
+			if !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			switch {
+			case tt.confidence == 0 && len(changes) != 0:
+				t.Errorf("changes = %+v, want none", changes)
+			case tt.confidence != 0 && (len(changes) != 1 || changes[0].Confidence != tt.confidence):
+				t.Errorf("changes = %+v, want one with confidence %v", changes, tt.confidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package textclean
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Spellchecker replaces the misspelled words of the OCR output with the
+// suggestion of the dictionary of the text's language. A word is replaced
+// only when the suggestion is confident enough: 1 for the only suggestion,
+// 1/n when n suggestions are equally close (REP suggestions, listed by the
+// dictionary as common misspellings, are preferred to edits). Numbers,
+// acronyms in uppercase and words shorter than MinLength are kept.
+type Spellchecker struct {
+	Dictionaries  map[string]*Dictionary // By ISO 639-1 language, "en" is used for unknown languages
+	MinConfidence float64                // Default 0.5
+	MinLength     int                    // Default 4 letters
+}
+
+func (*Spellchecker) Name() string { return "spellcheck" }
+
+// Process corrects English text; the worker uses ProcessDocument with the
+// detected language
+func (s *Spellchecker) Process(pages []string) []string {
+	out, _ := s.ProcessDocument(pages, "")
+	return out
+}
+
+func (s *Spellchecker) ProcessDocument(pages []string, lang string) ([]string, []Change) {
+	if lang == "" {
+		lang = "en"
+	}
+	out := append([]string(nil), pages...)
+	dict := s.Dictionaries[lang]
+	if dict == nil {
+		return out, nil
+	}
+	minConfidence, minLength := s.MinConfidence, s.MinLength
+	if minConfidence == 0 {
+		minConfidence = 0.5
+	}
+	if minLength == 0 {
+		minLength = 4
+	}
+	var changes []Change
+	for p, page := range pages {
+		runes := []rune(page)
+		var b strings.Builder
+		last := 0
+		for start := 0; start < len(runes); {
+			if !isWordRune(runes[start]) {
+				start++
+				continue
+			}
+			end := start
+			for end < len(runes) && (isWordRune(runes[end]) || isApostrophe(runes, end)) {
+				end++
+			}
+			word := string(runes[start:end])
+			if fix, confidence, ok := s.correct(dict, word, minLength); ok && confidence >= minConfidence {
+				b.WriteString(string(runes[last:start]))
+				b.WriteString(fix)
+				last = end
+				changes = append(changes, Change{Step: "spellcheck", Page: p, Before: word, After: fix, Confidence: confidence})
+			}
+			start = end
+		}
+		if last > 0 {
+			b.WriteString(string(runes[last:]))
+			out[p] = b.String()
+		}
+	}
+	return out, changes
+}
+
+// An apostrophe inside a word ("don't", "l'homme")
+func isApostrophe(runes []rune, i int) bool {
+	return (runes[i] == '\'' || runes[i] == '’') && i+1 < len(runes) && unicode.IsLetter(runes[i+1])
+}
+
+// correct returns the suggestion for a misspelled word and its confidence
+func (s *Spellchecker) correct(dict *Dictionary, word string, minLength int) (string, float64, bool) {
+	letters, upper := 0, 0
+	for _, r := range word {
+		switch {
+		case unicode.IsDigit(r):
+			return "", 0, false
+		case unicode.IsUpper(r):
+			upper++
+			letters++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+	if letters < minLength || upper == letters || dict.Knows(word) {
+		return "", 0, false
+	}
+	rep, edits := dict.Suggest(word)
+	candidates := rep
+	if len(candidates) == 0 {
+		candidates = edits
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	fix := candidates[0]
+	if unicode.IsUpper([]rune(word)[0]) {
+		fix = capitalize(fix)
+	}
+	return fix, 1 / float64(len(candidates)), true
+}
+
+// SpellcheckerFromEnv reads OCR_SPELLCHECK_DICTIONARIES, the comma separated
+// Hunspell dictionaries by language (paths without the .aff/.dic extension),
+// e.g. "en=/usr/share/hunspell/en_US,fr=/usr/share/hunspell/fr_FR", and
+// OCR_SPELLCHECK_MIN_CONFIDENCE (0-1, default 0.5)
+func SpellcheckerFromEnv() (*Spellchecker, error) {
+	dictionaries, err := DictionariesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	s := &Spellchecker{Dictionaries: dictionaries}
+	if len(s.Dictionaries) == 0 {
+		return nil, fmt.Errorf("the spellcheck step needs OCR_SPELLCHECK_DICTIONARIES")
+	}
+	if raw := os.Getenv("OCR_SPELLCHECK_MIN_CONFIDENCE"); raw != "" {
+		confidence, err := strconv.ParseFloat(raw, 64)
+		if err != nil || confidence <= 0 || confidence > 1 {
+			return nil, fmt.Errorf("OCR_SPELLCHECK_MIN_CONFIDENCE must be between 0 and 1, got %q", raw)
+		}
+		s.MinConfidence = confidence
+	}
+	return s, nil
+}
+
+// DictionariesFromEnv loads the Hunspell dictionaries of
+// OCR_SPELLCHECK_DICTIONARIES by language
+func DictionariesFromEnv() (map[string]*Dictionary, error) {
+	dictionaries := map[string]*Dictionary{}
+	for _, entry := range strings.Split(os.Getenv("OCR_SPELLCHECK_DICTIONARIES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		lang, base, ok := strings.Cut(entry, "=")
+		if !ok || lang == "" || base == "" {
+			return nil, fmt.Errorf("OCR_SPELLCHECK_DICTIONARIES: want lang=path, got %q", entry)
+		}
+		dict, err := LoadHunspell(base)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the %s dictionary: %w", lang, err)
+		}
+		dictionaries[strings.ToLower(lang)] = dict
+	}
+	return dictionaries, nil
+}
@@ -0,0 +1,224 @@
+package textclean
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// A word split by a hyphen at the end of a line, continued in lowercase on the
+// next line. Hyphenated compounds continued in uppercase ("Jean-\nPaul") and
+// dashes after a space are kept.
+var hyphenBreak = regexp.MustCompile(`(\p{L}+)-[ \t]*\r?\n[ \t]*(\p{Ll}\p{L}*)`)
+
+// Dehyphenate joins the words hyphenated across line breaks. Without a
+// dictionary it cannot tell "transla-\ntion" from "well-\nknown" and joins
+// both; Dehyphenator keeps the hyphen of compounds.
+func Dehyphenate(page string) string {
+	return dehyphenate(page, nil)
+}
+
+// Dehyphenator joins the words hyphenated across line breaks like Dehyphenate,
+// but keeps the hyphen when the joined word is not in the dictionary of the
+// text's language: "transla-\ntion" becomes "translation" and "well-\nknown"
+// becomes "well-known". Languages without a dictionary are joined.
+type Dehyphenator struct {
+	Dictionaries map[string]*Dictionary // By ISO 639-1 language, "en" is used for unknown languages
+}
+
+func (*Dehyphenator) Name() string { return "dehyphenate" }
+
+// Process dehyphenates English text; the worker uses ProcessDocument with
+// the detected language
+func (d *Dehyphenator) Process(pages []string) []string {
+	out, _ := d.ProcessDocument(pages, "")
+	return out
+}
+
+func (d *Dehyphenator) ProcessDocument(pages []string, lang string) ([]string, []Change) {
+	if lang == "" {
+		lang = "en"
+	}
+	dict := d.Dictionaries[lang]
+	out := make([]string, len(pages))
+	for i, page := range pages {
+		out[i] = dehyphenate(page, dict)
+	}
+	return out, nil
+}
+
+func dehyphenate(page string, dict *Dictionary) string {
+	return hyphenBreak.ReplaceAllStringFunc(page, func(match string) string {
+		parts := hyphenBreak.FindStringSubmatch(match)
+		joined := parts[1] + parts[2]
+		if dict == nil || dict.Knows(joined) {
+			return joined
+		}
+		return parts[1] + "-" + parts[2]
+	})
+}
+
+var (
+	blankRun     = regexp.MustCompile(`[ \t\f\v\x{00A0}]+`)
+	paragraphGap = regexp.MustCompile(`\n{3,}`)
+)
+
+// CollapseWhitespace replaces runs of spaces and tabs with a single space,
+// trims the lines and keeps at most one empty line between paragraphs
+func CollapseWhitespace(page string) string {
+	lines := strings.Split(strings.ReplaceAll(page, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(blankRun.ReplaceAllString(line, " "))
+	}
+	return strings.TrimSpace(paragraphGap.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// Characters OCR engines confuse: the digits 0 and 1 and the letters O, o,
+// l and I
+func confusable(r rune) bool {
+	return strings.ContainsRune("01OolI", r)
+}
+
+// FixConfusions fixes the digit/letter confusions inside words and numbers:
+// in a word whose other characters are letters, 0 becomes O (o in lowercase
+// words) and 1 becomes l (I in uppercase words); in a number whose other
+// characters are digits, O and o become 0 and l and I become 1 between its
+// first and last digit ("2O23"), so that units and words run into a number
+// ("5l", "10l") are kept. Tokens mixing letters and digits ("A4", "B2B") are
+// left unchanged.
+func FixConfusions(page string) string {
+	runes := []rune(page)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		fixToken(runes[start:end])
+		start = end
+	}
+	return string(runes)
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func fixToken(token []rune) {
+	letters, digits, upper := 0, 0, 0
+	for _, r := range token {
+		switch {
+		case confusable(r):
+		case unicode.IsDigit(r):
+			digits++
+		default:
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	switch {
+	case digits > 0 && letters == 0:
+		first, last := -1, -1
+		for i, r := range token {
+			if unicode.IsDigit(r) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		for i := first + 1; i < last; i++ {
+			switch token[i] {
+			case 'O', 'o':
+				token[i] = '0'
+			case 'l', 'I':
+				token[i] = '1'
+			}
+		}
+	case letters > 0 && digits == 0:
+		upperWord := upper == letters
+		for i, r := range token {
+			switch {
+			case r == '0' && upperWord:
+				token[i] = 'O'
+			case r == '0':
+				token[i] = 'o'
+			case r == '1' && upperWord:
+				token[i] = 'I'
+			case r == '1':
+				token[i] = 'l'
+			}
+		}
+	}
+}
+
+// HeaderFooter removes the running headers and footers: the first and last
+// lines repeated on most pages of the document, ignoring their numbers (page
+// numbers, dates), e.g. "ACME Corp - Annual report" or "Page 3 of 12".
+// Documents of fewer than MinPages pages are not changed.
+type HeaderFooter struct {
+	MinPages int     // Default 3
+	Share    float64 // Share of the pages with the line, default 0.6
+}
+
+func (HeaderFooter) Name() string { return "headers" }
+
+func (h HeaderFooter) Process(pages []string) []string {
+	minPages, share := h.MinPages, h.Share
+	if minPages == 0 {
+		minPages = 3
+	}
+	if share == 0 {
+		share = 0.6
+	}
+	out := append([]string(nil), pages...)
+	if len(pages) < minPages {
+		return out
+	}
+	lines := make([][]string, len(pages))
+	for i, page := range pages {
+		lines[i] = strings.Split(page, "\n")
+	}
+	for _, fromEnd := range []bool{false, true} {
+		counts := map[string]int{}
+		for _, pageLines := range lines {
+			if i := edgeLine(pageLines, fromEnd); i >= 0 {
+				counts[lineShape(pageLines[i])]++
+			}
+		}
+		for p, pageLines := range lines {
+			i := edgeLine(pageLines, fromEnd)
+			if i >= 0 && float64(counts[lineShape(pageLines[i])]) >= share*float64(len(pages)) {
+				lines[p] = append(pageLines[:i:i], pageLines[i+1:]...)
+			}
+		}
+	}
+	for i, pageLines := range lines {
+		out[i] = strings.Join(pageLines, "\n")
+	}
+	return out
+}
+
+// edgeLine returns the index of the first (or last) non-empty line, -1 if none
+func edgeLine(lines []string, fromEnd bool) int {
+	for n := range lines {
+		i := n
+		if fromEnd {
+			i = len(lines) - 1 - n
+		}
+		if strings.TrimSpace(lines[i]) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+var digitRun = regexp.MustCompile(`\d+`)
+
+// lineShape is the line without its numbers and case and with single spaces
+func lineShape(line string) string {
+	return strings.ToLower(strings.Join(strings.Fields(digitRun.ReplaceAllString(line, "#")), " "))
+}
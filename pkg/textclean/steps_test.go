@@ -0,0 +1,72 @@
+package textclean
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDehyphenate(t *testing.T) {
+	dict, err := LoadHunspell("testdata/flag_default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		text     string
+		want     string // Without a dictionary
+		wantDict string // With the dictionary
+	}{
+		{"known word", "it un-\nlocks", "it unlocks", "it unlocks"},
+		{"compound", "a lock-\nsmith", "a locksmith", "a lock-smith"},
+		{"spaces and CRLF", "walk- \r\n  ed", "walked", "walked"},
+		{"capitalized continuation", "Jean-\nPaul", "Jean-\nPaul", "Jean-\nPaul"},
+		{"dash after a space", "walk -\nfast", "walk -\nfast", "walk -\nfast"},
+		{"hyphen inside a line", "well-known", "well-known", "well-known"},
+		{"several breaks", "un-\nlock and lock-\nsmith", "unlock and locksmith", "unlock and lock-smith"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Dehyphenate(tt.text); got != tt.want {
+				t.Errorf("Dehyphenate = %q, want %q", got, tt.want)
+			}
+			d := &Dehyphenator{Dictionaries: map[string]*Dictionary{"en": dict}}
+			got, changes := d.ProcessDocument([]string{tt.text}, "en")
+			if !reflect.DeepEqual(got, []string{tt.wantDict}) || changes != nil {
+				t.Errorf("Dehyphenator = %q, %v; want %q", got, changes, tt.wantDict)
+			}
+			// Languages without a dictionary are joined like Dehyphenate
+			if got, _ := d.ProcessDocument([]string{tt.text}, "fr"); got[0] != tt.want {
+				t.Errorf("Dehyphenator (fr) = %q, want %q", got[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestFixConfusions(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Words
+		{"0ffice", "office"},
+		{"HELL0 W0RLD", "HELLO WORLD"},
+		{"he1p", "help"},
+		{"1NVOICE", "INVOICE"},
+		// Numbers: letters only between the digits
+		{"2O23", "2023"},
+		{"1OO5", "1005"},
+		{"3l4", "314"},
+		{"5l", "5l"},
+		{"10l of water", "10l of water"},
+		{"l5", "l5"},
+		// Mixed tokens and tokens without any other character
+		{"A4 B2B", "A4 B2B"},
+		{"lo 0l", "lo 0l"},
+		{"Total: 2O23-1O-O5", "Total: 2023-1O-O5"}, // 1O and O5 have no digit after or before the letter
+	}
+	for _, tt := range tests {
+		if got := FixConfusions(tt.text); got != tt.want {
+			t.Errorf("FixConfusions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
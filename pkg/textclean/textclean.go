@@ -0,0 +1,167 @@
+// Package textclean normalizes OCR output before translation with a chain of
+// TextProcessor plugins: dehyphenation across line breaks, whitespace
+// collapsing, digit/letter confusion fixes, removal of running headers and
+// footers and spellchecking with Hunspell dictionaries. Processors work on all
+// the pages of a document, so that steps such as header detection can compare
+// pages.
+package textclean
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TextProcessor is a cleanup step. Process returns the cleaned pages and must
+// not modify its argument.
+type TextProcessor interface {
+	Name() string
+	Process(pages []string) []string
+}
+
+// Pipeline runs processors in order
+type Pipeline []TextProcessor
+
+// Process runs every step on the pages
+func (p Pipeline) Process(pages []string) []string {
+	for _, step := range p {
+		pages = step.Process(pages)
+	}
+	return pages
+}
+
+// Change is a correction reported by a processor
+type Change struct {
+	Step       string  `json:"step"`
+	Page       int     `json:"page"` // 0-based
+	Before     string  `json:"before"`
+	After      string  `json:"after"`
+	Confidence float64 `json:"confidence"`
+}
+
+// DocumentProcessor is a processor that depends on the language of the text
+// and reports its corrections, such as Spellchecker
+type DocumentProcessor interface {
+	TextProcessor
+	ProcessDocument(pages []string, lang string) ([]string, []Change)
+}
+
+// ProcessDocument runs every step on the pages of a text in the language lang
+// (ISO 639-1, empty for English) and returns the corrections reported by the
+// document processors
+func (p Pipeline) ProcessDocument(pages []string, lang string) ([]string, []Change) {
+	var changes []Change
+	for _, step := range p {
+		if doc, ok := step.(DocumentProcessor); ok {
+			var stepChanges []Change
+			pages, stepChanges = doc.ProcessDocument(pages, lang)
+			changes = append(changes, stepChanges...)
+		} else {
+			pages = step.Process(pages)
+		}
+	}
+	return pages, changes
+}
+
+// Names returns the names of the steps, in order
+func (p Pipeline) Names() []string {
+	names := make([]string, len(p))
+	for i, step := range p {
+		names[i] = step.Name()
+	}
+	return names
+}
+
+// PageFunc is a processor applying a function to each page
+type PageFunc struct {
+	StepName string
+	Fn       func(page string) string
+}
+
+func (f PageFunc) Name() string { return f.StepName }
+
+func (f PageFunc) Process(pages []string) []string {
+	out := make([]string, len(pages))
+	for i, page := range pages {
+		out[i] = f.Fn(page)
+	}
+	return out
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]TextProcessor{
+		"dehyphenate": &Dehyphenator{},
+		"whitespace":  PageFunc{"whitespace", CollapseWhitespace},
+		"confusions":  PageFunc{"confusions", FixConfusions},
+		"headers":     HeaderFooter{},
+	}
+)
+
+// Register makes a processor available to New and PipelineFromEnv under its
+// name, replacing a built-in processor of the same name
+func Register(p TextProcessor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[p.Name()] = p
+}
+
+// New returns the pipeline of the registered processors with these names
+func New(names ...string) (Pipeline, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var p Pipeline
+	for _, name := range names {
+		step, ok := registry[name]
+		if !ok {
+			known := make([]string, 0, len(registry))
+			for name := range registry {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown text cleanup step %q (want %s)", name, strings.Join(known, ", "))
+		}
+		p = append(p, step)
+	}
+	return p, nil
+}
+
+// PipelineFromEnv reads OCR_CLEANUP, the comma separated steps run after OCR,
+// e.g. "headers,dehyphenate,confusions,whitespace,spellcheck". Empty disables
+// cleanup. Unless a spellcheck processor was registered, the spellcheck step
+// loads the dictionaries of SpellcheckerFromEnv; the built-in dehyphenate step
+// uses the same dictionaries when OCR_SPELLCHECK_DICTIONARIES is set.
+func PipelineFromEnv() (Pipeline, error) {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("OCR_CLEANUP"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	registryMu.RLock()
+	_, registered := registry["spellcheck"]
+	dehyphenator, builtin := registry["dehyphenate"].(*Dehyphenator)
+	registryMu.RUnlock()
+	var dictionaries map[string]*Dictionary
+	if !registered && slices.Contains(names, "spellcheck") {
+		s, err := SpellcheckerFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		Register(s)
+		dictionaries = s.Dictionaries
+	}
+	if builtin && dehyphenator.Dictionaries == nil && slices.Contains(names, "dehyphenate") && os.Getenv("OCR_SPELLCHECK_DICTIONARIES") != "" {
+		if dictionaries == nil {
+			var err error
+			if dictionaries, err = DictionariesFromEnv(); err != nil {
+				return nil, err
+			}
+		}
+		Register(&Dehyphenator{Dictionaries: dictionaries})
+	}
+	return New(names...)
+}
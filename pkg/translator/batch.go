@@ -0,0 +1,293 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// BatchProvider is implemented by providers translating several texts in one
+// request, which cuts the per-request overhead and the rate limit pressure of
+// documents made of many pages, regions or table cells
+type BatchProvider interface {
+	Provider
+	// TranslateBatch returns the translations of texts, in the same order
+	TranslateBatch(texts []string, sourceLang, targetLang string) ([]string, error)
+}
+
+// Limits of one batch request
+const (
+	MaxBatchSegments = 50
+	MaxBatchChars    = 20000
+)
+
+// Usage is what a translation cost, for accounting
+type Usage struct {
+	Provider  string         // Provider that translated most segments, "" if nothing was sent
+	Providers map[string]int // Segments translated by each provider (a Chain falls back on poor translations)
+	Chars     int            // Characters sent to the providers, 0 when shared with a concurrent call
+}
+
+// add accumulates the usage of another part of the text
+func (u *Usage) add(other Usage) {
+	u.Chars += other.Chars
+	for name, n := range other.Providers {
+		if u.Providers == nil {
+			u.Providers = map[string]int{}
+		}
+		u.Providers[name] += n
+		if u.Provider == "" || u.Providers[name] > u.Providers[u.Provider] {
+			u.Provider = name
+		}
+	}
+}
+
+// Options of TranslateBatchUsage
+type Options struct {
+	Glossary Glossary // Terms forced in the translation
+	Markup   bool     // Keep the line breaks, list markers and headings of OCR text
+	// Detect identifies the language of a paragraph ("" when unsure). When
+	// set, every paragraph is translated from its own language and the ones
+	// already in the target language are kept; paragraphs are separated by a
+	// blank line.
+	Detect func(text string) (lang string, confidence float64)
+	// Parallel above 1 translates the paragraphs of the segments
+	// concurrently, at most Parallel requests at a time, instead of batching
+	// them
+	Parallel int
+	// Cache keeps the translation of each paragraph with Parallel, nil: none
+	Cache ParagraphCache
+}
+
+// TranslateBatch translates segments (pages, layout regions, table cells) from
+// sourceLang ("" for English) to targetLang, forcing the glossary terms like
+// TranslateWithGlossary. Providers implementing BatchProvider receive several
+// segments per request, the others one request per segment. Blank segments
+// are returned as they are. The result has the order of segments.
+func TranslateBatch(segments []string, sourceLang, targetLang string, glossary Glossary) ([]string, error) {
+	translated, _, err := TranslateBatchUsage(segments, sourceLang, targetLang, Options{Glossary: glossary})
+	return translated, err
+}
+
+// TranslateBatchUsage is TranslateBatch with options, also returning the
+// provider used and the characters sent to it
+func TranslateBatchUsage(segments []string, sourceLang, targetLang string, opts Options) ([]string, Usage, error) {
+	if opts.Detect != nil {
+		return translateByLanguage(segments, sourceLang, targetLang, opts)
+	}
+	return translateSource(segments, sourceLang, targetLang, opts)
+}
+
+// translateSegments translates every segment from sourceLang
+func translateSegments(segments []string, sourceLang, targetLang string, opts Options) ([]string, Usage, error) {
+	if sourceLang == "" {
+		sourceLang = SourceLanguage
+	}
+	translated := make([]string, len(segments))
+	copy(translated, segments)
+	if strings.EqualFold(sourceLang, targetLang) {
+		fmt.Printf("Text is already in %s, skipping translation\n", targetLang)
+		return translated, Usage{}, nil
+	}
+
+	var (
+		indexes      []int
+		texts        []string
+		replacements = make([][]string, len(segments))
+		required     = make([]int, len(segments)) // Glossary placeholders, before the markup ones
+	)
+	for i, segment := range segments {
+		if strings.TrimSpace(segment) == "" {
+			continue
+		}
+		text := segment
+		if len(opts.Glossary) > 0 {
+			text, replacements[i] = opts.Glossary.protect(segment)
+			required[i] = len(replacements[i])
+		}
+		if opts.Markup {
+			text, replacements[i] = protectMarkup(text, replacements[i])
+		}
+		indexes = append(indexes, i)
+		texts = append(texts, text)
+	}
+	if len(texts) == 0 {
+		return translated, Usage{}, nil
+	}
+
+	p := CurrentProvider()
+	// Concurrent identical batches (same document in several jobs) share one translation
+	key := flightKey(append([]string{"batch", p.Name(), sourceLang, targetLang}, texts...)...)
+	value, shared, err := inflight.Do(key, func() (any, error) {
+		return translateBatchWith(p, texts, sourceLang, targetLang)
+	})
+	if err != nil {
+		if _, ok := p.(Chain); ok {
+			return nil, Usage{}, err // Chain logs each provider itself
+		}
+		fmt.Printf("%s translation failed: %v\n", p.Name(), err)
+		return nil, Usage{}, fmt.Errorf("Translation failed")
+	}
+	result, ok := value.(batchResult)
+	if !ok || len(result.texts) != len(texts) {
+		return nil, Usage{}, fmt.Errorf("unexpected batch translation result %T", value)
+	}
+	usage := result.usage()
+	if shared {
+		fmt.Printf("Translation shared with a concurrent identical request\n")
+		usage.Chars = 0
+	} else {
+		for _, text := range texts {
+			usage.Chars += utf8.RuneCountInString(text)
+		}
+	}
+	for k, i := range indexes {
+		translated[i] = result.texts[k]
+		if len(replacements[i]) > 0 {
+			if translated[i], err = restore(result.texts[k], replacements[i], required[i]); err != nil {
+				return nil, Usage{}, err
+			}
+		}
+		if opts.Markup {
+			translated[i] = tidyMarkup(translated[i])
+		}
+	}
+	return translated, usage, nil
+}
+
+// batchResult is the translation of a batch, shared by concurrent identical
+// batches
+type batchResult struct {
+	texts     []string
+	providers []string // Provider that translated each text
+	retried   int      // Characters sent again to a fallback provider
+}
+
+// usage counts the texts of each provider; Chars only has the retries
+func (r batchResult) usage() Usage {
+	u := Usage{Providers: map[string]int{}, Chars: r.retried}
+	for _, name := range r.providers {
+		u.Providers[name]++
+		if u.Provider == "" || u.Providers[name] > u.Providers[u.Provider] {
+			u.Provider = name
+		}
+	}
+	return u
+}
+
+// translateBatchWith translates texts with p, in batches when p supports them
+func translateBatchWith(p Provider, texts []string, sourceLang, targetLang string) (batchResult, error) {
+	if c, ok := p.(Chain); ok {
+		return c.translateBatch(texts, sourceLang, targetLang)
+	}
+	results, err := translateBatchOnce(p, texts, sourceLang, targetLang)
+	if err != nil {
+		return batchResult{}, err
+	}
+	providers := make([]string, len(texts))
+	for i := range providers {
+		providers[i] = p.Name()
+	}
+	return batchResult{texts: results, providers: providers}, nil
+}
+
+// translateBatchOnce translates texts with p, which is not a Chain
+func translateBatchOnce(p Provider, texts []string, sourceLang, targetLang string) ([]string, error) {
+	bp, ok := p.(BatchProvider)
+	if !ok {
+		results := make([]string, len(texts))
+		for i, text := range texts {
+			var err error
+			if results[i], err = p.Translate(text, sourceLang, targetLang); err != nil {
+				return nil, err
+			}
+		}
+		fmt.Printf("Translated %d segment(s) in %d request(s) using %s\n", len(texts), len(texts), p.Name())
+		return results, nil
+	}
+
+	results := make([]string, 0, len(texts))
+	batches := splitBatches(texts)
+	for _, batch := range batches {
+		translated, err := bp.TranslateBatch(batch, sourceLang, targetLang)
+		if err != nil {
+			return nil, err
+		}
+		if len(translated) != len(batch) {
+			return nil, fmt.Errorf("%s returned %d translations for %d texts", p.Name(), len(translated), len(batch))
+		}
+		results = append(results, translated...)
+	}
+	fmt.Printf("Translated %d segment(s) in %d request(s) using %s\n", len(texts), len(batches), p.Name())
+	return results, nil
+}
+
+// splitBatches groups consecutive texts within MaxBatchSegments and
+// MaxBatchChars; a text longer than MaxBatchChars is sent alone
+func splitBatches(texts []string) [][]string {
+	var batches [][]string
+	start, chars := 0, 0
+	for i, text := range texts {
+		if i > start && (i-start == MaxBatchSegments || chars+len(text) > MaxBatchChars) {
+			batches = append(batches, texts[start:i])
+			start, chars = i, 0
+		}
+		chars += len(text)
+	}
+	return append(batches, texts[start:])
+}
+
+// TranslateBatch implements BatchProvider: each provider is tried in order
+// with the whole list, and the texts it translated poorly are retried with
+// the next providers
+func (c Chain) TranslateBatch(texts []string, sourceLang, targetLang string) ([]string, error) {
+	result, err := c.translateBatch(texts, sourceLang, targetLang)
+	return result.texts, err
+}
+
+func (c Chain) translateBatch(texts []string, sourceLang, targetLang string) (batchResult, error) {
+	var errs []string
+	for i, p := range c {
+		result, err := translateBatchWith(p, texts, sourceLang, targetLang)
+		if err != nil {
+			fmt.Printf("%s translation failed: %v. Trying alternative services...\n", p.Name(), err)
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+		if rest := c[i+1:]; len(rest) > 0 {
+			rest.retryPoor(texts, &result, sourceLang, targetLang)
+		}
+		return result, nil
+	}
+	return batchResult{}, fmt.Errorf("translation failed (%s)", strings.Join(errs, "; "))
+}
+
+// retryPoor translates again with c the texts whose translation in result
+// looks poor (see poorTranslation), and keeps the new translations that
+// look right. A failure of c keeps result as it is.
+func (c Chain) retryPoor(texts []string, result *batchResult, sourceLang, targetLang string) {
+	var poor []int
+	var retry []string
+	for i, text := range texts {
+		if reason := poorTranslation(text, result.texts[i]); reason != "" {
+			fmt.Printf("%s translation of segment %d looks poor (%s), retrying with %s\n", result.providers[i], i, reason, c.Name())
+			poor = append(poor, i)
+			retry = append(retry, text)
+		}
+	}
+	if len(poor) == 0 {
+		return
+	}
+	better, err := c.translateBatch(retry, sourceLang, targetLang)
+	if err != nil {
+		fmt.Printf("Retry of %d poor segment(s) failed, keeping them: %v\n", len(poor), err)
+		return
+	}
+	for k, i := range poor {
+		result.retried += utf8.RuneCountInString(retry[k])
+		if poorTranslation(retry[k], better.texts[k]) == "" {
+			result.texts[i], result.providers[i] = better.texts[k], better.providers[k]
+		}
+	}
+	result.retried += better.retried
+}
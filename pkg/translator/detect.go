@@ -0,0 +1,65 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// paragraphSeparator separates the paragraphs routed by language
+const paragraphSeparator = "\n\n"
+
+// paragraphRef locates a paragraph: segment index, paragraph index
+type paragraphRef struct{ segment, paragraph int }
+
+// translateByLanguage splits the segments into paragraphs, identifies the
+// language of each one with opts.Detect and translates them grouped by
+// language, so pages mixing languages are translated from the right source
+// and paragraphs already in targetLang are passed through unchanged.
+// Paragraphs too short to identify keep sourceLang.
+func translateByLanguage(segments []string, sourceLang, targetLang string, opts Options) ([]string, Usage, error) {
+	if sourceLang == "" {
+		sourceLang = SourceLanguage
+	}
+	paragraphs := make([][]string, len(segments))
+	groups := map[string][]paragraphRef{}
+	var langs []string // In order of appearance
+	for i, segment := range segments {
+		paragraphs[i] = strings.Split(segment, paragraphSeparator)
+		for j, paragraph := range paragraphs[i] {
+			lang, _ := opts.Detect(paragraph)
+			if lang == "" {
+				lang = sourceLang
+			}
+			if _, ok := groups[lang]; !ok {
+				langs = append(langs, lang)
+			}
+			groups[lang] = append(groups[lang], paragraphRef{i, j})
+		}
+	}
+	if len(langs) > 1 {
+		fmt.Printf("Text mixes %d languages (%s), translating each paragraph from its own\n", len(langs), strings.Join(langs, ", "))
+	}
+
+	var usage Usage
+	for _, lang := range langs {
+		refs := groups[lang]
+		texts := make([]string, len(refs))
+		for k, ref := range refs {
+			texts[k] = paragraphs[ref.segment][ref.paragraph]
+		}
+		translated, u, err := translateSource(texts, lang, targetLang, opts)
+		if err != nil {
+			return nil, Usage{}, err
+		}
+		usage.add(u)
+		for k, ref := range refs {
+			paragraphs[ref.segment][ref.paragraph] = translated[k]
+		}
+	}
+
+	translated := make([]string, len(segments))
+	for i := range paragraphs {
+		translated[i] = strings.Join(paragraphs[i], paragraphSeparator)
+	}
+	return translated, usage, nil
+}
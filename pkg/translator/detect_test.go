@@ -0,0 +1,65 @@
+package translator
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sourceProvider tags each translation with the source language it was
+// requested from
+type sourceProvider struct {
+	mu      sync.Mutex
+	sources []string
+}
+
+func (*sourceProvider) Name() string { return "source" }
+
+func (p *sourceProvider) Translate(text, sourceLang, _ string) (string, error) {
+	p.mu.Lock()
+	p.sources = append(p.sources, sourceLang)
+	p.mu.Unlock()
+	return "[" + sourceLang + "] " + text, nil
+}
+
+// detectPrefix identifies the paragraphs starting with a language code
+// ("fr Bonjour"), the others are too short to identify
+func detectPrefix(text string) (string, float64) {
+	if lang, _, ok := strings.Cut(text, " "); ok && len(lang) == 2 {
+		return lang, 0.9
+	}
+	return "", 0
+}
+
+func TestTranslateByLanguage(t *testing.T) {
+	p := &sourceProvider{}
+	useProvider(t, p)
+	segments := []string{
+		"fr Bonjour\n\nen Hello\n\nvi Xin chào",
+		"de Guten Tag\n\nfr Merci",
+		"Total",
+	}
+	got, _, err := translateByLanguage(segments, "en", "vi", Options{Detect: detectPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"[fr] fr Bonjour\n\n[en] en Hello\n\nvi Xin chào", // Already in the target language
+		"[de] de Guten Tag\n\n[fr] fr Merci",
+		"[en] Total", // Too short: the language of the document
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("translated =\n%q\nwant\n%q", got, want)
+	}
+	// One group per language, in order of appearance
+	if want := []string{"fr", "fr", "en", "en", "de"}; !reflect.DeepEqual(p.sources, want) {
+		t.Errorf("sources = %v, want %v", p.sources, want)
+	}
+
+	// Without a source language, undetected paragraphs use SourceLanguage
+	p.sources = nil
+	if got, _, err := translateByLanguage([]string{"Total"}, "", "vi", Options{Detect: detectPrefix}); err != nil || got[0] != "["+SourceLanguage+"] Total" {
+		t.Errorf("translated = %q, %v", got, err)
+	}
+}
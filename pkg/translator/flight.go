@@ -0,0 +1,22 @@
+package translator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/internal/flight"
+)
+
+// inflight groups the translations running in this process: concurrent
+// calls with the same key share one provider call
+var inflight flight.Group
+
+// flightKey hashes the parameters so long texts do not stay in the map
+func flightKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
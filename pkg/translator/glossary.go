@@ -0,0 +1,173 @@
+package translator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Glossary maps source terms to the exact text they must appear as in the
+// translation (product names, legal terms, acronyms). An empty target keeps
+// the source term untranslated, spelled as in the glossary.
+type Glossary map[string]string
+
+// placeholderPattern matches the placeholders inserted by protect. Translation
+// engines sometimes add spaces inside them, so the pattern tolerates that.
+var placeholderPattern = regexp.MustCompile(`\[\s*#\s*(\d+)\s*#\s*\]`)
+
+// Merge returns a glossary with the terms of g overridden by other
+func (g Glossary) Merge(other Glossary) Glossary {
+	merged := make(Glossary, len(g)+len(other))
+	for k, v := range g {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// protect replaces every glossary term in text (case insensitive, longest
+// term first) with a numbered placeholder. It returns the protected text and
+// the replacement for each placeholder.
+//
+// A term only matches as a whole word: the characters around it must not be
+// letters, digits or underscores. Unlike \b, this also holds for terms that
+// start or end with punctuation, such as "C++", ".NET" and "R&D".
+func (g Glossary) protect(text string) (string, []string) {
+	terms := g.sortedTerms()
+	if len(terms) == 0 {
+		return text, nil
+	}
+
+	var out strings.Builder
+	var replacements []string
+	prev := rune(-1) // Rune before i, -1 at the start of the text
+	for i := 0; i < len(text); {
+		if term, n := matchTerm(text[i:], prev, terms); n > 0 {
+			target := g[term]
+			if target == "" {
+				target = term
+			}
+			replacements = append(replacements, target)
+			fmt.Fprintf(&out, "[#%d#]", len(replacements)-1)
+			prev, _ = utf8.DecodeLastRuneInString(text[:i+n])
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		out.WriteString(text[i : i+size])
+		prev = r
+		i += size
+	}
+	return out.String(), replacements
+}
+
+// sortedTerms returns the non-blank terms, longest (in runes) first, then
+// in lexical order, so overlapping terms resolve the same way on every run
+func (g Glossary) sortedTerms() []string {
+	terms := make([]string, 0, len(g))
+	for term := range g {
+		if strings.TrimSpace(term) != "" {
+			terms = append(terms, term)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		ni, nj := utf8.RuneCountInString(terms[i]), utf8.RuneCountInString(terms[j])
+		if ni != nj {
+			return ni > nj
+		}
+		return terms[i] < terms[j]
+	})
+	return terms
+}
+
+// matchTerm returns the term matching at the start of s and the number of
+// bytes it covers, or 0 if none does. prev is the rune before s. Among terms
+// of the same length that differ only in case, the one spelled exactly as in
+// the text wins.
+func matchTerm(s string, prev rune, terms []string) (string, int) {
+	match, matchLen, matchRunes := "", 0, 0
+	for _, term := range terms {
+		runes := utf8.RuneCountInString(term)
+		if match != "" && runes < matchRunes {
+			break
+		}
+		n := prefixRunes(s, runes)
+		if n < 0 || !strings.EqualFold(s[:n], term) {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(s[n:]); isWordRune(prev) || isWordRune(next) {
+			continue
+		}
+		if match == "" {
+			match, matchLen, matchRunes = term, n, runes
+		}
+		if s[:n] == term {
+			return term, n
+		}
+	}
+	return match, matchLen
+}
+
+// prefixRunes returns the byte length of the first count runes of s, or -1
+// if s is shorter
+func prefixRunes(s string, count int) int {
+	n := 0
+	for ; count > 0; count-- {
+		if n >= len(s) {
+			return -1
+		}
+		_, size := utf8.DecodeRuneInString(s[n:])
+		n += size
+	}
+	return n
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// restore replaces the placeholders in translated text with the glossary
+// targets. It fails if the translation dropped one of the first required
+// placeholders, since the term would then be silently missing from the
+// output; the others (markup) only carry structure.
+func restore(translated string, replacements []string, required int) (string, error) {
+	seen := make([]bool, len(replacements))
+	restored := placeholderPattern.ReplaceAllStringFunc(translated, func(match string) string {
+		idx, err := strconv.Atoi(placeholderPattern.FindStringSubmatch(match)[1])
+		if err != nil || idx >= len(replacements) {
+			return match
+		}
+		seen[idx] = true
+		return replacements[idx]
+	})
+	for i, ok := range seen[:required] {
+		if !ok {
+			return "", fmt.Errorf("translation lost glossary term %q", replacements[i])
+		}
+	}
+	return restored, nil
+}
+
+// TranslateWithGlossary translates text from sourceLang ("" for English) to
+// targetLang, forcing the glossary terms: they are replaced by placeholders
+// before translation and by their required targets afterwards
+func TranslateWithGlossary(text, sourceLang, targetLang string, glossary Glossary) (string, error) {
+	if len(glossary) == 0 {
+		return TranslateFrom(text, sourceLang, targetLang)
+	}
+	protected, replacements := glossary.protect(text)
+	translated, err := TranslateFrom(protected, sourceLang, targetLang)
+	if err != nil {
+		return "", err
+	}
+	if len(replacements) == 0 {
+		return translated, nil
+	}
+	return restore(translated, replacements, len(replacements))
+}
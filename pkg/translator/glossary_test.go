@@ -0,0 +1,110 @@
+package translator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlossaryProtect(t *testing.T) {
+	tests := []struct {
+		name         string
+		glossary     Glossary
+		text         string
+		want         string
+		replacements []string
+	}{
+		{
+			name:         "whole words only",
+			glossary:     Glossary{"API": ""},
+			text:         "The API and APIs, rapid",
+			want:         "The [#0#] and APIs, rapid",
+			replacements: []string{"API"},
+		},
+		{
+			name:         "case insensitive, target spelling",
+			glossary:     Glossary{"kubernetes": "Kubernetes"},
+			text:         "KUBERNETES runs kubernetes",
+			want:         "[#0#] runs [#1#]",
+			replacements: []string{"Kubernetes", "Kubernetes"},
+		},
+		{
+			name:         "punctuation edges",
+			glossary:     Glossary{"C++": "", ".NET": "", "R&D": "Nghiên cứu"},
+			text:         "C++ and .NET teams (R&D).",
+			want:         "[#0#] and [#1#] teams ([#2#]).",
+			replacements: []string{"C++", ".NET", "Nghiên cứu"},
+		},
+		{
+			name:         "punctuation term inside a word",
+			glossary:     Glossary{"C++": "", ".NET": ""},
+			text:         "ObjC++ and ASP.NET, C++x",
+			want:         "ObjC++ and ASP.NET, C++x",
+			replacements: nil,
+		},
+		{
+			name:         "longest term first",
+			glossary:     Glossary{"New York": "Niu Oóc", "New": "Mới"},
+			text:         "New York is new",
+			want:         "[#0#] is [#1#]",
+			replacements: []string{"Niu Oóc", "Mới"},
+		},
+		{
+			name:         "exact case wins over other spellings",
+			glossary:     Glossary{"US": "Hoa Kỳ", "us": ""},
+			text:         "Call us in the US",
+			want:         "Call [#0#] in the [#1#]",
+			replacements: []string{"us", "Hoa Kỳ"},
+		},
+		{
+			name:         "unicode word boundaries",
+			glossary:     Glossary{"Hà Nội": "Hanoi"},
+			text:         "Hà Nội, Hà Nộiđ",
+			want:         "[#0#], Hà Nộiđ",
+			replacements: []string{"Hanoi"},
+		},
+		{
+			name:         "blank terms ignored",
+			glossary:     Glossary{" ": "x"},
+			text:         "a b",
+			want:         "a b",
+			replacements: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, replacements := tt.glossary.protect(tt.text)
+			if got != tt.want || !reflect.DeepEqual(replacements, tt.replacements) {
+				t.Errorf("protect(%q) = %q, %q; want %q, %q", tt.text, got, replacements, tt.want, tt.replacements)
+			}
+		})
+	}
+}
+
+func TestGlossaryProtectDeterministic(t *testing.T) {
+	glossary := Glossary{"Go": "Go", "GO": "GO!", "go": "đi", "gO": "?"}
+	want, wantReplacements := glossary.protect("Go, GO, go, Go")
+	for i := 0; i < 50; i++ {
+		got, replacements := glossary.protect("Go, GO, go, Go")
+		if got != want || !reflect.DeepEqual(replacements, wantReplacements) {
+			t.Fatalf("run %d: %q %q, first run %q %q", i, got, replacements, want, wantReplacements)
+		}
+	}
+	if !reflect.DeepEqual(wantReplacements, []string{"Go", "GO!", "đi", "Go"}) {
+		t.Fatalf("replacements = %q", wantReplacements)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	got, err := restore("[ # 0 # ] chạy trên [#1#]", []string{"Kubernetes", "Linux"}, 2)
+	if err != nil || got != "Kubernetes chạy trên Linux" {
+		t.Fatalf("restore = %q, %v", got, err)
+	}
+	if _, err := restore("chạy trên [#1#]", []string{"Kubernetes", "Linux"}, 2); err == nil {
+		t.Fatal("restore accepted a translation that lost a term")
+	}
+	// Only the required placeholders (glossary terms) must survive, not markup
+	got, err = restore("[#0#] chạy trên Linux", []string{"Kubernetes", "<b>"}, 1)
+	if err != nil || got != "Kubernetes chạy trên Linux" {
+		t.Fatalf("restore without markup = %q, %v", got, err)
+	}
+}
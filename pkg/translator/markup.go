@@ -0,0 +1,124 @@
+package translator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Blocks of the structure kept by the markup mode (Options.Markup)
+const (
+	blockParagraph = iota
+	blockHeading
+	blockItem
+)
+
+// block is one line of the lightweight markup: a paragraph (its wrapped OCR
+// lines joined), a heading or a list item
+type block struct {
+	kind   int
+	marker string // blockItem: list marker as written ("•", "-", "1.", "a)")
+	text   string
+	gap    bool // Blank line before the block
+}
+
+// listMarkerPattern matches a list item: bullet, number or letter marker
+// followed by the item text. Capital letters are markers only with a
+// parenthesis ("A)", "(B)"): "A. Smith said" starts with an initial.
+var listMarkerPattern = regexp.MustCompile(`^([•·▪◦‣●○■□►➢–*-]|\(?[0-9]{1,3}[.)]|\(?[a-z][.)]|\(?[A-Z]\))\s+(\S.*)$`)
+
+// Longest line taken for a heading
+const (
+	maxHeadingRunes = 60
+	maxHeadingWords = 8
+)
+
+// parseBlocks infers the structure of OCR text: list items, headings (short
+// lines standing alone or in capitals) and paragraphs whose line breaks only
+// come from the width of the page
+func parseBlocks(text string) []block {
+	lines := strings.Split(text, "\n")
+	var blocks []block
+	gap, open := false, false // open: the last block continues on the next line
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			gap, open = len(blocks) > 0, false
+			continue
+		}
+		if m := listMarkerPattern.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, block{kind: blockItem, marker: m[1], text: m[2], gap: gap})
+			gap, open = false, true
+			continue
+		}
+		if open {
+			blocks[len(blocks)-1].text += " " + line
+			continue
+		}
+		kind := blockParagraph
+		if isHeading(line, nextLine(lines, i)) {
+			kind = blockHeading
+		}
+		blocks = append(blocks, block{kind: kind, text: line, gap: gap})
+		gap, open = false, kind == blockParagraph
+	}
+	return blocks
+}
+
+// nextLine returns the line after lines[i], trimmed ("" at the end)
+func nextLine(lines []string, i int) string {
+	if i+1 < len(lines) {
+		return strings.TrimSpace(lines[i+1])
+	}
+	return ""
+}
+
+// isHeading tells whether line, the first line of a block, is a heading: a
+// short line without final punctuation that is alone, written in capitals or
+// introduces a list
+func isHeading(line, next string) bool {
+	if len([]rune(line)) > maxHeadingRunes || len(strings.Fields(line)) > maxHeadingWords {
+		return false
+	}
+	if strings.IndexFunc(line, unicode.IsLetter) < 0 || strings.ContainsAny(line[len(line)-1:], ".,;!?") {
+		return false
+	}
+	return next == "" || strings.ToUpper(line) == line || listMarkerPattern.MatchString(next)
+}
+
+// protectMarkup replaces the structure of text with placeholders numbered
+// after replacements: the line breaks between blocks and the list markers.
+// The wrapped lines of a paragraph are joined so the provider translates
+// whole sentences.
+func protectMarkup(text string, replacements []string) (string, []string) {
+	var b strings.Builder
+	placeholder := func(value string) {
+		replacements = append(replacements, value)
+		fmt.Fprintf(&b, "[#%d#] ", len(replacements)-1)
+	}
+	for i, blk := range parseBlocks(text) {
+		if i > 0 {
+			b.WriteString(" ")
+			if blk.gap {
+				placeholder("\n\n")
+			} else {
+				placeholder("\n")
+			}
+		}
+		if blk.kind == blockItem {
+			placeholder(blk.marker)
+		}
+		b.WriteString(blk.text)
+	}
+	return b.String(), replacements
+}
+
+// tidyMarkup removes the spaces left around the restored line breaks
+func tidyMarkup(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,121 @@
+package translator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []block
+	}{
+		{
+			name: "wrapped paragraph",
+			text: "The invoice is due\nwithin thirty days\nof delivery.",
+			want: []block{{kind: blockParagraph, text: "The invoice is due within thirty days of delivery."}},
+		},
+		{
+			name: "heading and paragraphs",
+			text: "Payment terms\n\nThe invoice is due.\n\n  Late fees apply.  ",
+			want: []block{
+				{kind: blockHeading, text: "Payment terms"},
+				{kind: blockParagraph, text: "The invoice is due.", gap: true},
+				{kind: blockParagraph, text: "Late fees apply.", gap: true},
+			},
+		},
+		{
+			name: "heading in capitals before its paragraph",
+			text: "PAYMENT TERMS\nThe invoice is due\nwithin thirty days.",
+			want: []block{
+				{kind: blockHeading, text: "PAYMENT TERMS"},
+				{kind: blockParagraph, text: "The invoice is due within thirty days."},
+			},
+		},
+		{
+			name: "list with wrapped items",
+			text: "Required documents\n• Passport\n• Proof of address,\nless than three months old\n2. Photo\n(b) Form\nC) Fee\n- Receipt",
+			want: []block{
+				{kind: blockHeading, text: "Required documents"},
+				{kind: blockItem, marker: "•", text: "Passport"},
+				{kind: blockItem, marker: "•", text: "Proof of address, less than three months old"},
+				{kind: blockItem, marker: "2.", text: "Photo"},
+				{kind: blockItem, marker: "(b)", text: "Form"},
+				{kind: blockItem, marker: "C)", text: "Fee"},
+				{kind: blockItem, marker: "-", text: "Receipt"},
+			},
+		},
+		{
+			name: "initial is not a list marker",
+			text: "A. Smith said the invoice\nwas paid.",
+			want: []block{{kind: blockParagraph, text: "A. Smith said the invoice was paid."}},
+		},
+		{
+			name: "markers without text",
+			text: "1.\n-",
+			want: []block{{kind: blockParagraph, text: "1. -"}},
+		},
+		{
+			name: "leading blank lines",
+			text: "\n\nHello there.",
+			want: []block{{kind: blockParagraph, text: "Hello there."}},
+		},
+		{name: "empty", text: "\n \n", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBlocks(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBlocks =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsHeading(t *testing.T) {
+	tests := []struct {
+		line, next string
+		want       bool
+	}{
+		{"Payment terms", "", true},
+		{"PAYMENT TERMS", "The invoice is due", true},
+		{"Required documents", "• Passport", true},
+		{"Required documents", "(a) Passport", true},
+		{"Payment terms", "The invoice is due", false}, // Start of a paragraph
+		{"Payment terms:", "", true},
+		{"The invoice is due.", "", false},
+		{"Is it due?", "", false},
+		{"2024", "", false}, // No letter
+		{"One two three four five six seven eight nine", "", false},
+		{"Một hai ba bốn năm sáu bảy tám chín mười mười một mười hai", "", false},
+		{"Điều khoản thanh toán", "", true},
+	}
+	for _, tt := range tests {
+		if got := isHeading(tt.line, tt.next); got != tt.want {
+			t.Errorf("isHeading(%q, %q) = %v, want %v", tt.line, tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestProtectMarkup(t *testing.T) {
+	text := "Required documents\n• Passport\n• Proof of address,\nless than three months old\n\nThe office is\nclosed on Sundays."
+	protected, replacements := protectMarkup(text, []string{"Kubernetes"})
+	want := "Required documents [#1#] [#2#] Passport [#3#] [#4#] Proof of address, less than three months old [#5#] The office is closed on Sundays."
+	if protected != want {
+		t.Errorf("protectMarkup =\n%q\nwant\n%q", protected, want)
+	}
+	if wantReplacements := []string{"Kubernetes", "\n", "•", "\n", "•", "\n\n"}; !reflect.DeepEqual(replacements, wantReplacements) {
+		t.Errorf("replacements = %q, want %q", replacements, wantReplacements)
+	}
+
+	// Restored after a translation that keeps the placeholders (the markup
+	// ones are not required)
+	translated := "Giấy tờ cần thiết [#1#] [#2#] Hộ chiếu [#3#] [#4#] Giấy xác nhận địa chỉ, dưới ba tháng [#5#] Văn phòng đóng cửa vào Chủ nhật."
+	restored, err := restore(translated, replacements, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tidyMarkup(restored), "Giấy tờ cần thiết\n• Hộ chiếu\n• Giấy xác nhận địa chỉ, dưới ba tháng\n\nVăn phòng đóng cửa vào Chủ nhật."; got != want {
+		t.Errorf("restored =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package translator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LibreTranslateProvider calls a LibreTranslate compatible HTTP service
+// (POST /translate), the usual way to serve Argos Translate / OPUS-MT models
+// on premises
+type LibreTranslateProvider struct {
+	URL    string
+	APIKey string
+	client *http.Client
+}
+
+// NewLibreTranslateProvider creates a provider for the service at baseURL
+func NewLibreTranslateProvider(baseURL, apiKey string) *LibreTranslateProvider {
+	return &LibreTranslateProvider{
+		URL:    strings.TrimRight(baseURL, "/"),
+		APIKey: apiKey,
+		// Local models are slower than Google on long texts
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (p *LibreTranslateProvider) Name() string { return "libretranslate" }
+
+func (p *LibreTranslateProvider) Translate(text, sourceLang, targetLang string) (string, error) {
+	var translated string
+	if err := p.post(text, sourceLang, targetLang, &translated); err != nil {
+		return "", err
+	}
+	if translated == "" && strings.TrimSpace(text) != "" {
+		return "", fmt.Errorf("LibreTranslate returned an empty translation")
+	}
+	return translated, nil
+}
+
+// TranslateBatch implements BatchProvider: LibreTranslate accepts a list of
+// texts in q and answers with the list of translations
+func (p *LibreTranslateProvider) TranslateBatch(texts []string, sourceLang, targetLang string) ([]string, error) {
+	var translated []string
+	if err := p.post(texts, sourceLang, targetLang, &translated); err != nil {
+		return nil, err
+	}
+	return translated, nil
+}
+
+// post sends q (a text or a list of texts) to /translate and decodes
+// translatedText into translated
+func (p *LibreTranslateProvider) post(q any, sourceLang, targetLang string, translated any) error {
+	body, err := json.Marshal(map[string]any{
+		"q":       q,
+		"source":  sourceLang,
+		"target":  targetLang,
+		"format":  "text",
+		"api_key": p.APIKey,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("LibreTranslate request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		TranslatedText json.RawMessage `json:"translatedText"`
+		Error          string          `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("invalid LibreTranslate response (status %d)", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("LibreTranslate returned status %d: %s", resp.StatusCode, result.Error)
+	}
+	if err := json.Unmarshal(result.TranslatedText, translated); err != nil {
+		return fmt.Errorf("invalid LibreTranslate response: %v", err)
+	}
+	return nil
+}
+
+// maxPhraseWords is the longest dictionary entry, in words, that is matched
+const maxPhraseWords = 6
+
+// Dictionary translates word by word (longest phrase first) from an embedded
+// dictionary. The quality is far below a translation model, but it needs no
+// network at all and keeps air-gapped deployments producing usable output.
+//
+// The dictionary file maps target languages to entries:
+//
+//	{"vi": {"invoice": "hóa đơn", "total amount": "tổng số tiền"}}
+//
+// Words without an entry are kept as they are.
+type Dictionary struct {
+	entries map[string]map[string]string // target language -> lowercase source phrase -> translation
+}
+
+// wordPattern splits text into words (letters, digits, apostrophes) and the
+// text between them
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}']+`)
+
+// LoadDictionary reads a dictionary JSON file
+func LoadDictionary(path string) (*Dictionary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid dictionary %s: %w", path, err)
+	}
+	return NewDictionary(raw), nil
+}
+
+// NewDictionary creates a dictionary from target language -> source -> translation
+func NewDictionary(entries map[string]map[string]string) *Dictionary {
+	d := &Dictionary{entries: make(map[string]map[string]string, len(entries))}
+	for lang, terms := range entries {
+		normalized := make(map[string]string, len(terms))
+		for source, target := range terms {
+			key := strings.Join(strings.Fields(strings.ToLower(source)), " ")
+			if key != "" {
+				normalized[key] = target
+			}
+		}
+		d.entries[strings.ToLower(lang)] = normalized
+	}
+	return d
+}
+
+func (d *Dictionary) Name() string { return "dictionary" }
+
+func (d *Dictionary) Translate(text, sourceLang, targetLang string) (string, error) {
+	terms, ok := d.entries[strings.ToLower(targetLang)]
+	if !ok {
+		return "", fmt.Errorf("dictionary has no entries for language %q", targetLang)
+	}
+
+	words := wordPattern.FindAllStringIndex(text, -1)
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(words); {
+		// Longest phrase starting at word i, only across plain spaces
+		matched, translation := 0, ""
+		phrase := ""
+		for n := 1; n <= maxPhraseWords && i+n <= len(words); n++ {
+			if n > 1 {
+				gap := text[words[i+n-2][1]:words[i+n-1][0]]
+				if strings.TrimSpace(gap) != "" {
+					break
+				}
+				phrase += " "
+			}
+			phrase += strings.ToLower(text[words[i+n-1][0]:words[i+n-1][1]])
+			if t, ok := terms[phrase]; ok {
+				matched, translation = n, t
+			}
+		}
+
+		start := words[i][0]
+		b.WriteString(text[last:start])
+		if matched == 0 {
+			end := words[i][1]
+			b.WriteString(text[start:end])
+			last = end
+			i++
+			continue
+		}
+		end := words[i+matched-1][1]
+		b.WriteString(matchCase(text[start:end], translation))
+		last = end
+		i += matched
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// matchCase capitalizes translation when the source starts with a capital
+// letter, so sentence starts stay capitalized
+func matchCase(source, translation string) string {
+	first, _ := utf8.DecodeRuneInString(source)
+	if !unicode.IsUpper(first) || translation == "" {
+		return translation
+	}
+	r, size := utf8.DecodeRuneInString(translation)
+	return string(unicode.ToUpper(r)) + translation[size:]
+}
@@ -0,0 +1,249 @@
+package translator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// libreRequest is the body of a LibreTranslate /translate request
+type libreRequest struct {
+	Q      any    `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	APIKey string `json:"api_key"`
+}
+
+// fakeLibreTranslate answers /translate with the dictionary translation of
+// each text, or with status and body when status is set
+type fakeLibreTranslate struct {
+	mu       sync.Mutex
+	requests []libreRequest
+	status   int
+	body     string
+}
+
+func newFakeLibreTranslate(t *testing.T, dict *Dictionary) (*fakeLibreTranslate, *LibreTranslateProvider) {
+	f := &fakeLibreTranslate{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/translate" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+			return
+		}
+		var req libreRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		status, body := f.status, f.body
+		f.mu.Unlock()
+		if status != 0 {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+			return
+		}
+		var translated any
+		switch q := req.Q.(type) {
+		case string:
+			translated, _ = dict.Translate(q, req.Source, req.Target)
+		case []any:
+			texts := make([]string, len(q))
+			for i, text := range q {
+				texts[i], _ = dict.Translate(text.(string), req.Source, req.Target)
+			}
+			translated = texts
+		}
+		json.NewEncoder(w).Encode(map[string]any{"translatedText": translated})
+	}))
+	t.Cleanup(server.Close)
+	return f, NewLibreTranslateProvider(server.URL+"/", "key")
+}
+
+var testDictionary = NewDictionary(map[string]map[string]string{
+	"VI": {"invoice": "hóa đơn", "Total Amount": "tổng số tiền", "total": "tổng", "paid": "đã thanh toán", "the": ""},
+})
+
+func TestLibreTranslateProvider(t *testing.T) {
+	f, p := newFakeLibreTranslate(t, testDictionary)
+	got, err := p.Translate("Total amount paid", "en", "vi")
+	if err != nil || got != "Tổng số tiền đã thanh toán" {
+		t.Fatalf("Translate = %q, %v", got, err)
+	}
+	if req := f.requests[0]; req.Source != "en" || req.Target != "vi" || req.Format != "text" || req.APIKey != "key" {
+		t.Errorf("request = %+v", req)
+	}
+
+	batch, err := p.TranslateBatch([]string{"invoice", "total"}, "en", "vi")
+	if err != nil || !reflect.DeepEqual(batch, []string{"hóa đơn", "tổng"}) {
+		t.Fatalf("TranslateBatch = %q, %v", batch, err)
+	}
+	if q, ok := f.requests[1].Q.([]any); !ok || len(q) != 2 {
+		t.Errorf("batch q = %v, want the list of texts", f.requests[1].Q)
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"error status", http.StatusBadRequest, `{"error":"vi is not supported"}`, "LibreTranslate returned status 400: vi is not supported"},
+		{"not JSON", http.StatusBadGateway, "<html>Bad Gateway</html>", "invalid LibreTranslate response (status 502)"},
+		{"wrong type", http.StatusOK, `{"translatedText":42}`, "invalid LibreTranslate response"},
+		{"empty translation", http.StatusOK, `{"translatedText":""}`, "empty translation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.mu.Lock()
+			f.status, f.body = tt.status, tt.body
+			f.mu.Unlock()
+			if _, err := p.Translate("invoice", "en", "vi"); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Translate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A batch answered with fewer translations than texts
+	f.status, f.body = http.StatusOK, `{"translatedText":["hóa đơn"]}`
+	if _, err := translateBatchOnce(p, []string{"invoice", "total"}, "en", "vi"); err == nil || !strings.Contains(err.Error(), "returned 1 translations for 2 texts") {
+		t.Errorf("translateBatchOnce = %v", err)
+	}
+
+	unreachable := NewLibreTranslateProvider("http://127.0.0.1:1", "")
+	if _, err := unreachable.Translate("invoice", "en", "vi"); err == nil || !strings.Contains(err.Error(), "LibreTranslate request failed") {
+		t.Errorf("Translate without a server = %v", err)
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"total amount", "tổng số tiền"},  // Longest phrase first
+		{"Total  Amount", "Tổng số tiền"}, // Spaces between the words of a phrase, capital kept
+		{"total, amount", "tổng, amount"}, // Punctuation breaks a phrase
+		{"INVOICE paid.", "Hóa đơn đã thanh toán."},
+		{"the invoice", " hóa đơn"}, // Empty translations remove the word
+		{"invoice #42 (unpaid)", "hóa đơn #42 (unpaid)"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got, err := testDictionary.Translate(tt.text, "en", "vi"); err != nil || got != tt.want {
+			t.Errorf("Translate(%q) = %q, %v; want %q", tt.text, got, err, tt.want)
+		}
+	}
+	if _, err := testDictionary.Translate("invoice", "en", "fr"); err == nil || !strings.Contains(err.Error(), `no entries for language "fr"`) {
+		t.Errorf("Translate to a missing language = %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dict.json")
+	os.WriteFile(path, []byte(`{"vi": {"invoice": "hóa đơn"}}`), 0o644)
+	if d, err := LoadDictionary(path); err != nil {
+		t.Fatal(err)
+	} else if got, _ := d.Translate("invoice", "en", "vi"); got != "hóa đơn" {
+		t.Errorf("loaded dictionary translates to %q", got)
+	}
+	os.WriteFile(path, []byte(`{"vi": ["invoice"]}`), 0o644)
+	if _, err := LoadDictionary(path); err == nil || !strings.Contains(err.Error(), "invalid dictionary") {
+		t.Errorf("LoadDictionary of invalid JSON = %v", err)
+	}
+}
+
+// stubProvider returns the same translation for every text, or err
+type stubProvider struct {
+	name, translation string
+	err               error
+}
+
+func (p stubProvider) Name() string { return p.name }
+
+func (p stubProvider) Translate(string, string, string) (string, error) {
+	return p.translation, p.err
+}
+
+// echoProvider returns the texts untranslated
+type echoProvider struct{}
+
+func (echoProvider) Name() string { return "echo" }
+
+func (echoProvider) Translate(text, _, _ string) (string, error) { return text, nil }
+
+func TestChain(t *testing.T) {
+	_, libre := newFakeLibreTranslate(t, testDictionary)
+	down := stubProvider{name: "google", err: errors.New("connection refused")}
+	text := "the invoice total amount paid the invoice"
+
+	// The next provider is used when one fails
+	got, err := Chain{down, libre}.Translate(text, "en", "vi")
+	if err != nil || got != " hóa đơn tổng số tiền đã thanh toán  hóa đơn" {
+		t.Errorf("Translate = %q, %v", got, err)
+	}
+	// A poor translation is retried, and kept when the retry is not better
+	empty := stubProvider{name: "google", translation: ""}
+	if got, err := (Chain{empty, libre}).Translate(text, "en", "vi"); err != nil || !strings.Contains(got, "hóa đơn") {
+		t.Errorf("Translate after an empty translation = %q, %v", got, err)
+	}
+	if got, err := (Chain{echoProvider{}, stubProvider{name: "other", err: errors.New("down")}}).Translate(text, "en", "vi"); err != nil || got != text {
+		t.Errorf("Translate with a failed retry = %q, %v; want the first translation", got, err)
+	}
+	if _, err := (Chain{down, stubProvider{name: "dictionary", err: errors.New("no entries")}}).Translate(text, "en", "vi"); err == nil ||
+		err.Error() != "translation failed (google: connection refused; dictionary: no entries)" {
+		t.Errorf("Translate with every provider down = %v", err)
+	}
+
+	// Batches: only the poor translations go to the next provider
+	texts := []string{"the invoice total amount was paid", "Nguyen Van An"}
+	result, err := Chain{echoProvider{}, libre}.translateBatch(texts, "en", "vi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.texts, []string{" hóa đơn tổng số tiền was đã thanh toán", "Nguyen Van An"}) ||
+		!reflect.DeepEqual(result.providers, []string{"libretranslate", "echo"}) {
+		t.Errorf("batch = %q by %v", result.texts, result.providers)
+	}
+	if u := result.usage(); u.Chars != len([]rune(texts[0])) || u.Providers["libretranslate"] != 1 {
+		t.Errorf("usage = %+v, want the retried characters", u)
+	}
+}
+
+func TestProviderFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	dictPath := filepath.Join(dir, "dict.json")
+	os.WriteFile(dictPath, []byte(`{"vi": {"invoice": "hóa đơn"}}`), 0o644)
+	tests := []struct {
+		translator, url, dictionary string
+		want                        string // Name of the provider
+		wantErr                     string
+	}{
+		{"", "", "", "google", ""},
+		{"google, LibreTranslate ,dictionary", "http://lt:5000", dictPath, "google,libretranslate,dictionary", ""},
+		{"argos", "http://lt:5000", "", "libretranslate", ""},
+		{"libretranslate", "", "", "", "TRANSLATOR_URL is required"},
+		{"dictionary", "", "", "", "TRANSLATOR_DICTIONARY is required"},
+		{"dictionary", "", filepath.Join(dir, "missing.json"), "", "missing.json"},
+		{"deepl", "", "", "", `unknown translator "deepl"`},
+	}
+	for _, tt := range tests {
+		t.Setenv("TRANSLATOR", tt.translator)
+		t.Setenv("TRANSLATOR_URL", tt.url)
+		t.Setenv("TRANSLATOR_DICTIONARY", tt.dictionary)
+		p, err := ProviderFromEnv()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("TRANSLATOR=%q: %v, want %q", tt.translator, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || p.Name() != tt.want {
+			t.Errorf("TRANSLATOR=%q: %v, %v; want %s", tt.translator, p, err, tt.want)
+		}
+	}
+}
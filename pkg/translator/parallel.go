@@ -0,0 +1,118 @@
+package translator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ParagraphCache keeps translated paragraphs between documents. Errors are
+// the implementation's business: a failed Get is a miss.
+type ParagraphCache interface {
+	Get(key string) (string, bool)
+	Set(key, value string)
+}
+
+// translateSource translates segments all written in sourceLang, in
+// parallel paragraphs when opts.Parallel is above 1
+func translateSource(segments []string, sourceLang, targetLang string, opts Options) ([]string, Usage, error) {
+	if opts.Parallel > 1 {
+		return translateParallel(segments, sourceLang, targetLang, opts)
+	}
+	return translateSegments(segments, sourceLang, targetLang, opts)
+}
+
+// translateParallel splits the segments into paragraphs, takes the cached
+// ones from opts.Cache and translates the others concurrently, at most
+// opts.Parallel at a time, then reassembles the segments in order. The first
+// error stops the paragraphs not started yet.
+func translateParallel(segments []string, sourceLang, targetLang string, opts Options) ([]string, Usage, error) {
+	if sourceLang == "" {
+		sourceLang = SourceLanguage
+	}
+	paragraphs := make([][]string, len(segments))
+	var pending []paragraphRef
+	cached := 0
+	for i, segment := range segments {
+		paragraphs[i] = strings.Split(segment, paragraphSeparator)
+		for j, paragraph := range paragraphs[i] {
+			if strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+			if opts.Cache != nil {
+				if text, ok := opts.Cache.Get(paragraphKey(paragraph, sourceLang, targetLang, opts)); ok {
+					paragraphs[i][j] = text
+					cached++
+					continue
+				}
+			}
+			pending = append(pending, paragraphRef{i, j})
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		usage    Usage
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	refs := make(chan paragraphRef)
+	for w := 0; w < min(opts.Parallel, len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ref := range refs {
+				source := paragraphs[ref.segment][ref.paragraph]
+				translated, u, err := translateSegments([]string{source}, sourceLang, targetLang, opts)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					paragraphs[ref.segment][ref.paragraph] = translated[0]
+					usage.add(u)
+				}
+				mu.Unlock()
+				if err == nil && opts.Cache != nil {
+					opts.Cache.Set(paragraphKey(source, sourceLang, targetLang, opts), translated[0])
+				}
+			}
+		}()
+	}
+	for _, ref := range pending {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		refs <- ref
+	}
+	close(refs)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, Usage{}, firstErr
+	}
+	fmt.Printf("Translated %d paragraph(s) with up to %d parallel request(s), %d from cache\n", len(pending), opts.Parallel, cached)
+
+	translated := make([]string, len(segments))
+	for i := range paragraphs {
+		translated[i] = strings.Join(paragraphs[i], paragraphSeparator)
+	}
+	return translated, usage, nil
+}
+
+// paragraphKey is the cache key of the translation of paragraph: everything
+// changing the output (provider, languages, glossary, markup) is part of it
+func paragraphKey(paragraph, sourceLang, targetLang string, opts Options) string {
+	parts := []string{CurrentProvider().Name(), sourceLang, targetLang, fmt.Sprint(opts.Markup)}
+	terms := make([]string, 0, len(opts.Glossary))
+	for term, target := range opts.Glossary {
+		terms = append(terms, term+"\x00"+target)
+	}
+	sort.Strings(terms)
+	parts = append(append(parts, terms...), "", paragraph)
+	return "translation:" + flightKey(parts...)
+}
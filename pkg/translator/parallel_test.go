@@ -0,0 +1,92 @@
+package translator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// upperProvider "translates" to upper case, later paragraphs faster so the
+// translations finish out of order
+type upperProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (*upperProvider) Name() string { return "upper" }
+
+func (p *upperProvider) Translate(text, _, _ string) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	if strings.Contains(text, "fail") {
+		return "", errors.New("provider unavailable")
+	}
+	time.Sleep(time.Duration(10-min(len(text), 10)) * time.Millisecond)
+	return strings.ToUpper(text), nil
+}
+
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+func (c *mapCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	text, ok := c.entries[key]
+	return text, ok
+}
+
+func (c *mapCache) Set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+}
+
+func useProvider(t *testing.T, p Provider) {
+	t.Helper()
+	previous := CurrentProvider()
+	SetProvider(p)
+	t.Cleanup(func() { SetProvider(previous) })
+}
+
+func TestTranslateParallel(t *testing.T) {
+	p := &upperProvider{}
+	useProvider(t, p)
+	cache := &mapCache{entries: map[string]string{}}
+	opts := Options{Parallel: 3, Cache: cache}
+	segments := []string{"a\n\nbb\n\nccc", "", "dddd\n\n \n\neeeee", "ffffff"}
+	want := []string{"A\n\nBB\n\nCCC", "", "DDDD\n\n \n\nEEEEE", "FFFFFF"}
+
+	got, _, err := translateParallel(segments, "en", "vi", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("translated = %q, want %q", got, want)
+	}
+	if p.calls != 6 || len(cache.entries) != 6 {
+		t.Fatalf("%d provider calls and %d cache entries, want one per paragraph", p.calls, len(cache.entries))
+	}
+
+	// Every paragraph in the cache: no request
+	got, _, err = translateParallel(segments, "en", "vi", opts)
+	if err != nil || !reflect.DeepEqual(got, want) || p.calls != 6 {
+		t.Fatalf("from cache: %q, %v after %d calls", got, err, p.calls)
+	}
+
+	// A failed paragraph fails the whole translation and is not cached
+	got, _, err = translateParallel([]string{"a\n\nfail here", "gg"}, "en", "vi", opts)
+	if err == nil || got != nil {
+		t.Fatalf("failed paragraph: %q, %v", got, err)
+	}
+	for _, text := range cache.entries {
+		if strings.Contains(text, "FAIL") {
+			t.Errorf("failed paragraph cached: %q", text)
+		}
+	}
+}
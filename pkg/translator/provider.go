@@ -0,0 +1,124 @@
+package translator
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SourceLanguage is the language of the OCR text
+const SourceLanguage = "en"
+
+// Provider is a translation backend
+type Provider interface {
+	// Name identifies the provider in logs
+	Name() string
+	// Translate translates text from sourceLang to targetLang (ISO 639-1 codes)
+	Translate(text, sourceLang, targetLang string) (string, error)
+}
+
+// GoogleProvider uses the unofficial Google Translate API. It needs internet
+// access.
+type GoogleProvider struct{}
+
+func (GoogleProvider) Name() string { return "google" }
+
+func (GoogleProvider) Translate(text, sourceLang, targetLang string) (string, error) {
+	return googleTranslate(text, sourceLang, targetLang)
+}
+
+// Chain tries each provider in order and returns the first successful
+// translation, e.g. Google first and an offline provider when it is
+// unreachable. A translation that looks poor (empty, length far from the
+// source, mostly untranslated) is retried with the next providers.
+type Chain []Provider
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, p := range c {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c Chain) Translate(text, sourceLang, targetLang string) (string, error) {
+	var errs []string
+	for i, p := range c {
+		translated, err := p.Translate(text, sourceLang, targetLang)
+		if err == nil {
+			// A translation that looks poor is retried with the next providers
+			if reason := poorTranslation(text, translated); reason != "" && i+1 < len(c) {
+				fmt.Printf("%s translation looks poor (%s), retrying with %s\n", p.Name(), reason, c[i+1:].Name())
+				if better, err := c[i+1:].Translate(text, sourceLang, targetLang); err == nil && poorTranslation(text, better) == "" {
+					return better, nil
+				}
+			}
+			fmt.Printf("Translation successful using %s\n", p.Name())
+			return translated, nil
+		}
+		fmt.Printf("%s translation failed: %v. Trying alternative services...\n", p.Name(), err)
+		errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+	}
+	return "", fmt.Errorf("translation failed (%s)", strings.Join(errs, "; "))
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   Provider = GoogleProvider{}
+)
+
+// SetProvider changes the provider used by Translate, TranslateTo and
+// TranslateWithGlossary
+func SetProvider(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+// CurrentProvider returns the provider in use
+func CurrentProvider() Provider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider
+}
+
+// ProviderFromEnv builds the provider selected by the environment:
+//
+//	TRANSLATOR             comma-separated providers tried in order:
+//	                       google (default), libretranslate, dictionary
+//	TRANSLATOR_URL         base URL of the LibreTranslate / Argos Translate service
+//	TRANSLATOR_API_KEY     API key of the LibreTranslate service, if required
+//	TRANSLATOR_DICTIONARY  path of the dictionary JSON file
+func ProviderFromEnv() (Provider, error) {
+	names := os.Getenv("TRANSLATOR")
+	if names == "" {
+		names = "google"
+	}
+	var chain Chain
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "google":
+			chain = append(chain, GoogleProvider{})
+		case "libretranslate", "argos":
+			url := os.Getenv("TRANSLATOR_URL")
+			if url == "" {
+				return nil, fmt.Errorf("TRANSLATOR_URL is required for the %s translator", name)
+			}
+			chain = append(chain, NewLibreTranslateProvider(url, os.Getenv("TRANSLATOR_API_KEY")))
+		case "dictionary":
+			path := os.Getenv("TRANSLATOR_DICTIONARY")
+			if path == "" {
+				return nil, fmt.Errorf("TRANSLATOR_DICTIONARY is required for the dictionary translator")
+			}
+			dict, err := LoadDictionary(path)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, dict)
+		default:
+			return nil, fmt.Errorf("unknown translator %q (want google, libretranslate or dictionary)", name)
+		}
+	}
+	return chain, nil
+}
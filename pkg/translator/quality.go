@@ -0,0 +1,67 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Thresholds of poorTranslation
+const (
+	minLengthRunes      = 40 // Shorter texts are not judged on their length
+	minLengthRatio      = 0.25
+	maxLengthRatio      = 4.0
+	minJudgedWords      = 4 // Words needed to judge the untranslated share
+	maxUntranslatedRate = 0.6
+)
+
+// poorTranslation tells why translated does not look like a translation of
+// source, or returns "": empty output, a length far from the source, or
+// most of the source words left as they were. None of the providers reports
+// a confidence, so only the texts are compared.
+func poorTranslation(source, translated string) string {
+	if strings.TrimSpace(translated) == "" {
+		if strings.TrimSpace(source) != "" {
+			return "empty translation"
+		}
+		return ""
+	}
+	if runes := utf8.RuneCountInString(source); runes >= minLengthRunes {
+		ratio := float64(utf8.RuneCountInString(translated)) / float64(runes)
+		if ratio < minLengthRatio || ratio > maxLengthRatio {
+			return fmt.Sprintf("length ratio %.2f", ratio)
+		}
+	}
+	words := plainWords(source)
+	if len(words) < minJudgedWords {
+		return ""
+	}
+	kept := map[string]bool{}
+	for _, word := range plainWords(strings.ToLower(translated)) {
+		kept[word] = true
+	}
+	untranslated := 0
+	for _, word := range words {
+		if kept[word] {
+			untranslated++
+		}
+	}
+	if rate := float64(untranslated) / float64(len(words)); rate > maxUntranslatedRate {
+		return fmt.Sprintf("%.0f%% of the words untranslated", rate*100)
+	}
+	return ""
+}
+
+// plainWords returns the lowercase words of at least 4 letters. Numbers,
+// codes, short words and capitalized names stay the same in any translation.
+func plainWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		first, _ := utf8.DecodeRuneInString(word)
+		if utf8.RuneCountInString(word) >= 4 && unicode.IsLower(first) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
@@ -0,0 +1,56 @@
+package translator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPoorTranslation(t *testing.T) {
+	long := "The invoice must be paid within thirty days of delivery."
+	tests := []struct {
+		name, source, translated string
+		want                     string // Prefix of the reason, "" for a good translation
+	}{
+		{"good", long, "Hóa đơn phải được thanh toán trong vòng ba mươi ngày kể từ khi giao hàng.", ""},
+		{"empty", long, "", "empty translation"},
+		{"blank", long, " \n\t", "empty translation"},
+		{"empty source", " ", "", ""},
+		{"too short", long, "Hóa đơn.", "length ratio 0.14"},
+		{"too long", long, strings.Repeat("Hóa đơn phải được thanh toán. ", 10), "length ratio 5.36"},
+		// Short sources are not judged on their length
+		{"short source", "Total", "Tổng cộng số tiền phải trả", ""},
+		{"untranslated", long, "The invoice must be paid within thirty ngày of delivery.", "86% of the words untranslated"},
+		{"partly untranslated", long, "Hóa đơn must be paid trong vòng thirty ngày kể từ delivery.", ""},
+		// Names, numbers and short words stay the same in any translation
+		{"names and numbers", "Contact Nguyen Van An at 0912 345 678 about INV-2024", "Liên hệ Nguyen Van An qua số 0912 345 678 về INV-2024", ""},
+		{"too few words", "Invoice paid", "Invoice paid", ""},
+		{"case of the translation", "please check the invoice total", "Please Check The Invoice Total", "100% of the words untranslated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := poorTranslation(tt.source, tt.translated)
+			if tt.want == "" && got != "" || !strings.HasPrefix(got, tt.want) {
+				t.Errorf("poorTranslation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlainWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The invoice is due", []string{"invoice"}},
+		{"Contact Nguyen at INV-2024, code ab12cd", []string{"code"}},
+		{"thanh toán hóa đơn", []string{"thanh", "toán"}},
+		{"well-known e-mail", []string{"well", "known", "mail"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := plainWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("plainWords(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrBudgetExhausted is returned when the daily character budget of a
+// provider is used up and does not reset within the wait allowed to a call
+var ErrBudgetExhausted = errors.New("translation budget exhausted")
+
+// Limiter paces the outbound calls to translation providers
+type Limiter interface {
+	// Wait blocks until a request of chars characters may be sent to
+	// provider, or returns ErrBudgetExhausted
+	Wait(provider string, chars int) error
+}
+
+// RedisLimiter is a token bucket of requests per minute and a daily
+// character counter per provider, kept in Redis so the budget is shared by
+// every worker. Calls over the budget wait instead of being sent, so the
+// unofficial Google endpoint does not block the IP.
+type RedisLimiter struct {
+	client            *redis.Client
+	RequestsPerMinute int           // 0: no request limit
+	CharsPerDay       int           // UTC day, 0: no character budget
+	MaxWait           time.Duration // Longest wait for the budget of one call
+}
+
+// NewRedisLimiter creates a RedisLimiter allowing up to 1 minute of waiting
+func NewRedisLimiter(client *redis.Client, requestsPerMinute, charsPerDay int) *RedisLimiter {
+	return &RedisLimiter{
+		client:            client,
+		RequestsPerMinute: requestsPerMinute,
+		CharsPerDay:       charsPerDay,
+		MaxWait:           time.Minute,
+	}
+}
+
+// LimiterFromEnv builds the limiter configured by the environment, or nil
+// when no limit is set:
+//
+//	TRANSLATOR_RATE_LIMIT   requests per minute to each provider
+//	TRANSLATOR_DAILY_CHARS  characters per UTC day sent to each provider
+//	TRANSLATOR_MAX_WAIT     longest wait for the budget of one call (default 1m)
+func LimiterFromEnv(client *redis.Client) (*RedisLimiter, error) {
+	var limits [2]int
+	for i, name := range []string{"TRANSLATOR_RATE_LIMIT", "TRANSLATOR_DAILY_CHARS"} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s %q", name, v)
+			}
+			limits[i] = n
+		}
+	}
+	if limits[0] == 0 && limits[1] == 0 {
+		return nil, nil
+	}
+	l := NewRedisLimiter(client, limits[0], limits[1])
+	if v := os.Getenv("TRANSLATOR_MAX_WAIT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid TRANSLATOR_MAX_WAIT %q", v)
+		}
+		l.MaxWait = d
+	}
+	return l, nil
+}
+
+// reserveScript takes a token from the bucket KEYS[1] and counts ARGV[3]
+// characters in KEYS[2], at the time ARGV[4] (unix milliseconds of the Redis
+// clock, which also picks the day of KEYS[2]). It returns 0 when the request
+// may be sent, the milliseconds until a token is available, or -1 when the
+// daily budget is used up. Nothing is taken unless both limits allow the
+// request.
+var reserveScript = redis.NewScript(`
+local rpm = tonumber(ARGV[1])
+local daily = tonumber(ARGV[2])
+local chars = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+if daily > 0 and tonumber(redis.call('GET', KEYS[2]) or '0') + chars > daily then
+	return -1
+end
+if rpm > 0 then
+	local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+	local tokens = tonumber(bucket[1]) or rpm
+	local ts = tonumber(bucket[2]) or now
+	tokens = math.min(rpm, tokens + math.max(0, now - ts) * rpm / 60000)
+	if tokens < 1 then
+		return math.ceil((1 - tokens) * 60000 / rpm)
+	end
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens - 1), 'ts', now)
+	redis.call('PEXPIRE', KEYS[1], 120000)
+end
+if daily > 0 then
+	redis.call('INCRBY', KEYS[2], chars)
+	redis.call('EXPIRE', KEYS[2], 172800)
+end
+return 0
+`)
+
+// BucketKey is the token bucket of the requests to provider
+func BucketKey(provider string) string { return "translator:" + provider + ":bucket" }
+
+// CharsKey counts the characters sent to provider on day (UTC)
+func CharsKey(provider string, day time.Time) string {
+	return "translator:" + provider + ":chars:" + day.UTC().Format("2006-01-02")
+}
+
+// Wait implements Limiter. The time of the token bucket and the day of the
+// character budget come from the Redis clock, so workers with skewed clocks
+// share one budget around UTC midnight. When Redis is unreachable the
+// request is sent: the limiter must not stop translations on its own.
+func (l *RedisLimiter) Wait(provider string, chars int) error {
+	if l.CharsPerDay > 0 && chars > l.CharsPerDay {
+		return fmt.Errorf("%w: %d characters exceed the daily budget of %s", ErrBudgetExhausted, chars, provider)
+	}
+	ctx := context.Background()
+	deadline := time.Now().Add(l.MaxWait)
+	for {
+		var wait int64
+		now, err := l.client.Time(ctx).Result()
+		if err == nil {
+			wait, err = reserveScript.Run(ctx, l.client, []string{BucketKey(provider), CharsKey(provider, now)},
+				l.RequestsPerMinute, l.CharsPerDay, chars, now.UnixMilli()).Int64()
+		}
+		if err != nil {
+			log.Printf("Translation rate limiter unavailable: %v. Proceeding.", err)
+			return nil
+		}
+		if wait == 0 {
+			return nil
+		}
+		delay := time.Duration(wait) * time.Millisecond
+		if wait < 0 {
+			// Budget of the next UTC day
+			delay = now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			if wait < 0 {
+				return fmt.Errorf("%w: %d characters per day to %s", ErrBudgetExhausted, l.CharsPerDay, provider)
+			}
+			return fmt.Errorf("%s rate limit of %d requests per minute: no slot within %v", provider, l.RequestsPerMinute, l.MaxWait)
+		}
+		log.Printf("%s rate limit reached, waiting %v", provider, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+}
+
+// Limit returns p with every outbound call paced by l. Providers of a Chain
+// are limited one by one, so a provider out of budget falls back to the next
+// one; the dictionary makes no outbound call and is not limited.
+func Limit(p Provider, l Limiter) Provider {
+	switch p := p.(type) {
+	case Chain:
+		limited := make(Chain, len(p))
+		for i, provider := range p {
+			limited[i] = Limit(provider, l)
+		}
+		return limited
+	case *Dictionary:
+		return p
+	case BatchProvider:
+		return limitedBatchProvider{limitedProvider{p, l}, p}
+	}
+	return limitedProvider{p, l}
+}
+
+type limitedProvider struct {
+	Provider
+	limiter Limiter
+}
+
+func (p limitedProvider) Translate(text, sourceLang, targetLang string) (string, error) {
+	if err := p.limiter.Wait(p.Name(), utf8.RuneCountInString(text)); err != nil {
+		return "", err
+	}
+	return p.Provider.Translate(text, sourceLang, targetLang)
+}
+
+type limitedBatchProvider struct {
+	limitedProvider
+	batch BatchProvider
+}
+
+func (p limitedBatchProvider) TranslateBatch(texts []string, sourceLang, targetLang string) ([]string, error) {
+	chars := 0
+	for _, text := range texts {
+		chars += utf8.RuneCountInString(text)
+	}
+	if err := p.limiter.Wait(p.Name(), chars); err != nil {
+		return nil, err
+	}
+	return p.batch.TranslateBatch(texts, sourceLang, targetLang)
+}
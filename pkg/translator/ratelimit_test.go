@@ -0,0 +1,77 @@
+package translator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestLimiter(t *testing.T, requestsPerMinute, charsPerDay int) (*RedisLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	l := NewRedisLimiter(client, requestsPerMinute, charsPerDay)
+	l.MaxWait = 0 // Report instead of waiting
+	return l, mr
+}
+
+func TestRedisLimiterDayRollover(t *testing.T) {
+	l, mr := newTestLimiter(t, 0, 10)
+	// The Redis clock picks the day, whatever the clock of the worker
+	beforeMidnight := time.Date(2031, 3, 9, 23, 59, 59, 0, time.UTC)
+	mr.SetTime(beforeMidnight)
+
+	if err := l.Wait("google", 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Wait("google", 6); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("over the budget: err = %v, want ErrBudgetExhausted", err)
+	}
+	if err := l.Wait("libretranslate", 6); err != nil {
+		t.Fatalf("budget of another provider: %v", err)
+	}
+
+	mr.SetTime(beforeMidnight.Add(2 * time.Second))
+	if err := l.Wait("google", 6); err != nil {
+		t.Fatalf("after midnight: %v", err)
+	}
+	for day, want := range map[time.Time]string{beforeMidnight: "6", beforeMidnight.Add(2 * time.Second): "6"} {
+		if got, _ := mr.Get(CharsKey("google", day)); got != want {
+			t.Errorf("%s = %q, want %q", CharsKey("google", day), got, want)
+		}
+	}
+
+	if err := l.Wait("google", 11); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("request larger than the budget: err = %v", err)
+	}
+}
+
+func TestRedisLimiterRequestsPerMinute(t *testing.T) {
+	l, mr := newTestLimiter(t, 2, 0)
+	start := time.Date(2031, 3, 9, 12, 0, 0, 0, time.UTC)
+	mr.SetTime(start)
+	for i := 0; i < 2; i++ {
+		if err := l.Wait("google", 100); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if err := l.Wait("google", 100); err == nil || errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("third request: err = %v, want a rate limit error", err)
+	}
+	mr.SetTime(start.Add(30 * time.Second)) // One token refilled
+	if err := l.Wait("google", 100); err != nil {
+		t.Fatalf("after 30s: %v", err)
+	}
+}
+
+func TestRedisLimiterUnavailable(t *testing.T) {
+	l, mr := newTestLimiter(t, 1, 10)
+	mr.Close()
+	if err := l.Wait("google", 5); err != nil {
+		t.Fatalf("Redis down: err = %v, want the request sent", err)
+	}
+}
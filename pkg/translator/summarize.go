@@ -0,0 +1,228 @@
+package translator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultSummarySentences is the length of a summary, in sentences, when
+// SUMMARIZER_SENTENCES is not set
+const DefaultSummarySentences = 3
+
+// Summarizer produces a short summary of a document, used to triage large
+// batches without reading every translation
+type Summarizer interface {
+	// Name identifies the summarizer in logs and job details
+	Name() string
+	// Summarize summarizes text, written in lang (ISO 639-1), in the same language
+	Summarize(text, lang string) (string, error)
+}
+
+// ExtractiveSummarizer keeps the sentences of the text whose words are the
+// most frequent in the whole text, in their original order. It runs locally
+// without any model, so the summary is only as good as the sentence split.
+type ExtractiveSummarizer struct {
+	Sentences int // Sentences kept, 0 uses DefaultSummarySentences
+}
+
+func (ExtractiveSummarizer) Name() string { return "extractive" }
+
+// sentencePattern matches a sentence: text up to a terminal punctuation
+// (Latin, CJK, Arabic, Devanagari) or a blank line
+var sentencePattern = regexp.MustCompile(`(?s)[^.!?。！？؟।\n]+(?:[.!?。！？؟।]+|\n\s*\n|$)`)
+
+func (s ExtractiveSummarizer) Summarize(text, _ string) (string, error) {
+	limit := s.Sentences
+	if limit <= 0 {
+		limit = DefaultSummarySentences
+	}
+	var sentences []string
+	for _, match := range sentencePattern.FindAllString(text, -1) {
+		if sentence := strings.Join(strings.Fields(match), " "); len(summaryWords(sentence)) > 0 {
+			sentences = append(sentences, sentence)
+		}
+	}
+	if len(sentences) <= limit {
+		return strings.Join(sentences, " "), nil
+	}
+	freq := map[string]int{}
+	for _, word := range summaryWords(text) {
+		freq[word]++
+	}
+	scores := make([]float64, len(sentences))
+	for i, sentence := range sentences {
+		words := summaryWords(sentence)
+		for _, word := range words {
+			scores[i] += float64(freq[word])
+		}
+		scores[i] /= float64(len(words)) // Long sentences are not favored
+	}
+	order := make([]int, len(sentences))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	kept := order[:limit]
+	sort.Ints(kept)
+	summary := make([]string, len(kept))
+	for i, index := range kept {
+		summary[i] = sentences[index]
+	}
+	return strings.Join(summary, " "), nil
+}
+
+// summaryWords returns the lowercase words of text. Words of one or two
+// letters (articles, particles) carry no topic and are left out.
+func summaryWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if utf8.RuneCountInString(word) > 2 {
+			words = append(words, strings.ToLower(word))
+		}
+	}
+	return words
+}
+
+// OpenAISummarizer asks a chat model behind an OpenAI compatible endpoint
+// (POST /chat/completions): OpenAI itself, or a local server such as
+// Ollama, vLLM or llama.cpp
+type OpenAISummarizer struct {
+	URL       string // Base URL, e.g. https://api.openai.com/v1
+	APIKey    string
+	Model     string
+	Sentences int // Sentences asked for, 0 uses DefaultSummarySentences
+	client    *http.Client
+}
+
+// NewOpenAISummarizer creates a summarizer for the endpoint at baseURL
+func NewOpenAISummarizer(baseURL, apiKey, model string, sentences int) *OpenAISummarizer {
+	return &OpenAISummarizer{
+		URL:       strings.TrimRight(baseURL, "/"),
+		APIKey:    apiKey,
+		Model:     model,
+		Sentences: sentences,
+		// Local models can take long on a whole document
+		client: &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+func (s *OpenAISummarizer) Name() string { return "openai" }
+
+// maxSummaryInput bounds the text sent to the model (in runes), to stay in
+// the context window of small local models
+const maxSummaryInput = 24000
+
+func (s *OpenAISummarizer) Summarize(text, lang string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return "", nil
+	}
+	if runes := []rune(text); len(runes) > maxSummaryInput {
+		text = string(runes[:maxSummaryInput])
+	}
+	sentences := s.Sentences
+	if sentences <= 0 {
+		sentences = DefaultSummarySentences
+	}
+	body, err := json.Marshal(map[string]any{
+		"model": s.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": fmt.Sprintf("Summarize the document given by the user in at most %d sentences. "+
+				"Write the summary in the language with ISO 639-1 code %q. Answer with the summary only.", sentences, lang)},
+			{"role": "user", "content": text},
+		},
+		"temperature": 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("summarization request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid summarization response (status %d)", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message := ""
+		if result.Error != nil {
+			message = result.Error.Message
+		}
+		return "", fmt.Errorf("summarization endpoint returned status %d: %s", resp.StatusCode, message)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("summarization endpoint returned no choices")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+// SummarizerFromEnv builds the summarizer selected by the environment:
+//
+//	SUMMARIZER            extractive (default, local) or openai
+//	SUMMARIZER_URL        base URL of the OpenAI compatible endpoint
+//	SUMMARIZER_API_KEY    API key of the endpoint, if required
+//	SUMMARIZER_MODEL      model name, default gpt-4o-mini
+//	SUMMARIZER_SENTENCES  summary length in sentences, default 3
+func SummarizerFromEnv() (Summarizer, error) {
+	sentences := DefaultSummarySentences
+	if v := os.Getenv("SUMMARIZER_SENTENCES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("SUMMARIZER_SENTENCES must be at least 1, got %q", v)
+		}
+		sentences = n
+	}
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("SUMMARIZER"))); name {
+	case "", "extractive":
+		return ExtractiveSummarizer{Sentences: sentences}, nil
+	case "openai":
+		url := os.Getenv("SUMMARIZER_URL")
+		if url == "" {
+			return nil, fmt.Errorf("SUMMARIZER_URL is required for the openai summarizer")
+		}
+		model := os.Getenv("SUMMARIZER_MODEL")
+		if model == "" {
+			model = "gpt-4o-mini"
+		}
+		return NewOpenAISummarizer(url, os.Getenv("SUMMARIZER_API_KEY"), model, sentences), nil
+	default:
+		return nil, fmt.Errorf("unknown summarizer %q (want extractive or openai)", name)
+	}
+}
@@ -0,0 +1,49 @@
+package translator
+
+import "testing"
+
+func TestExtractiveSummarizer(t *testing.T) {
+	text := "The invoice lists the shipping costs. Weather was nice.\n\n" +
+		"Shipping costs of the invoice are due in May! Call us. The invoice total includes shipping."
+	tests := []struct {
+		name      string
+		sentences int
+		text      string
+		want      string
+	}{
+		{
+			name:      "most frequent words, original order",
+			sentences: 2,
+			text:      text,
+			want:      "The invoice lists the shipping costs. The invoice total includes shipping.",
+		},
+		{
+			name:      "short text kept whole",
+			sentences: 3,
+			text:      "First line.\nSecond   line",
+			want:      "First line. Second line",
+		},
+		{
+			name:      "CJK punctuation",
+			sentences: 1,
+			text:      "发票金额。发票日期。天气",
+			want:      "发票金额。",
+		},
+		{
+			name: "no words",
+			text: "12. 34 !",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractiveSummarizer{Sentences: tt.sentences}.Summarize(tt.text, "en")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Summarize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,26 +7,69 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
+// DefaultTargetLanguage is the language Translate translates to
+const DefaultTargetLanguage = "vi"
+
 // Translate text from English to Vietnamese
 func Translate(text string) (string, error) {
-	// First try Google Translate (unofficial API)
-	translatedText, err := googleTranslate(text)
-	if err == nil {
-		fmt.Println("Translation successful using Google Translate")
-		return translatedText, nil
+	return TranslateTo(text, DefaultTargetLanguage)
+}
+
+// TranslateTo translates English text to the target language (ISO 639-1 code)
+// with the current provider (see SetProvider)
+func TranslateTo(text, targetLang string) (string, error) {
+	return TranslateFrom(text, SourceLanguage, targetLang)
+}
+
+// TranslateFrom translates text from sourceLang to targetLang. Text already
+// in the target language is returned unchanged.
+func TranslateFrom(text, sourceLang, targetLang string) (string, error) {
+	if sourceLang == "" {
+		sourceLang = SourceLanguage
 	}
-	
-	fmt.Printf("Google Translate failed: %v. Trying alternative services...\n", err)
+	if strings.EqualFold(sourceLang, targetLang) {
+		fmt.Printf("Text is already in %s, skipping translation\n", targetLang)
+		return text, nil
+	}
+	p := CurrentProvider()
+	// Concurrent identical translations (same text, languages and provider)
+	// wait for the first one instead of calling the provider again
+	value, shared, err := inflight.Do(flightKey(p.Name(), sourceLang, targetLang, text), func() (any, error) {
+		return translateWith(p, text, sourceLang, targetLang)
+	})
+	if err != nil {
+		return "", err
+	}
+	translatedText, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected translation result %T", value)
+	}
+	if shared {
+		fmt.Printf("Translation shared with a concurrent identical request\n")
+	}
+	return translatedText, nil
+}
 
-	// If Google Translate fails, return error
-	return "", fmt.Errorf("Translation failed")
+func translateWith(p Provider, text, sourceLang, targetLang string) (string, error) {
+	if _, ok := p.(Chain); ok {
+		// Chain logs each provider itself
+		return p.Translate(text, sourceLang, targetLang)
+	}
+	translatedText, err := p.Translate(text, sourceLang, targetLang)
+	if err != nil {
+		fmt.Printf("%s translation failed: %v\n", p.Name(), err)
+		return "", fmt.Errorf("Translation failed")
+	}
+	fmt.Printf("Translation successful using %s\n", p.Name())
+	return translatedText, nil
 }
 
 // googleTranslate uses the unofficial Google Translate API
-func googleTranslate(text string) (string, error) {
+func googleTranslate(text, sourceLang, targetLang string) (string, error) {
 	// Google Translate URL
 	baseURL := "https://translate.googleapis.com/translate_a/single"
 	
@@ -38,8 +81,8 @@ func googleTranslate(text string) (string, error) {
 	// Build query parameters
 	params := url.Values{}
 	params.Add("client", "gtx")
-	params.Add("sl", "en")     // Source language
-	params.Add("tl", "vi")     // Target language
+	params.Add("sl", sourceLang) // Source language
+	params.Add("tl", targetLang) // Target language
 	params.Add("dt", "t")      // Return translated text
 	params.Add("q", text)      // Text to translate
 	
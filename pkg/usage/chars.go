@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// CharsRetention is how long the daily character counters are kept
+const CharsRetention = 90 * 24 * time.Hour
+
+// Characters is the translation cost of one job
+type Characters struct {
+	OCR        int64  // Characters of the source text (OCR, PDF text layer or client text)
+	Translated int64  // Characters sent to the translation provider
+	Provider   string // Provider that translated the text, "" if nothing was sent
+}
+
+// DailyCharacters is the translation cost of a tenant on one UTC day
+type DailyCharacters struct {
+	Date            string           `json:"date"`
+	Jobs            int64            `json:"jobs"`
+	OCRChars        int64            `json:"ocr_chars"`
+	TranslatedChars int64            `json:"translated_chars"`
+	Providers       map[string]int64 `json:"providers"` // Translated characters by provider
+}
+
+// CharsKey is a hash of the character counters of the tenant on day (UTC):
+// "jobs", "ocr_chars", "translated_chars" and "provider:<name>". The default
+// tenant uses "stats:usage:chars::<day>".
+func CharsKey(tenantID string, day time.Time) string {
+	return "stats:usage:chars:" + tenantID + ":" + day.UTC().Format("2006-01-02")
+}
+
+// RecordCharacters adds the characters of a job to the counters of its tenant
+func RecordCharacters(ctx context.Context, client *redis.Client, tenantID string, chars Characters) error {
+	key := CharsKey(tenantID, time.Now())
+	pipe := client.TxPipeline()
+	pipe.HIncrBy(ctx, key, "jobs", 1)
+	pipe.HIncrBy(ctx, key, "ocr_chars", chars.OCR)
+	pipe.HIncrBy(ctx, key, "translated_chars", chars.Translated)
+	if chars.Provider != "" {
+		pipe.HIncrBy(ctx, key, "provider:"+chars.Provider, chars.Translated)
+	}
+	pipe.Expire(ctx, key, CharsRetention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LoadCharacters reads the counters of the tenant for the last days UTC days,
+// newest first. Days without jobs are included with zero counters.
+func LoadCharacters(ctx context.Context, client *redis.Client, tenantID string, days int) ([]DailyCharacters, error) {
+	now := time.Now()
+	pipe := client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, days)
+	for i := range cmds {
+		cmds[i] = pipe.HGetAll(ctx, CharsKey(tenantID, now.AddDate(0, 0, -i)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	result := make([]DailyCharacters, days)
+	for i, cmd := range cmds {
+		day := DailyCharacters{Date: now.AddDate(0, 0, -i).UTC().Format("2006-01-02"), Providers: map[string]int64{}}
+		for field, raw := range cmd.Val() {
+			value, _ := strconv.ParseInt(raw, 10, 64)
+			switch field {
+			case "jobs":
+				day.Jobs = value
+			case "ocr_chars":
+				day.OCRChars = value
+			case "translated_chars":
+				day.TranslatedChars = value
+			default:
+				if name, ok := strings.CutPrefix(field, "provider:"); ok {
+					day.Providers[name] = value
+				}
+			}
+		}
+		result[i] = day
+	}
+	return result, nil
+}
+
+// Sum adds up the counters of days, for example the days of LoadCharacters
+// or the same days of several tenants. Date is left empty.
+func Sum(days []DailyCharacters) DailyCharacters {
+	total := DailyCharacters{Providers: map[string]int64{}}
+	for _, day := range days {
+		total.Jobs += day.Jobs
+		total.OCRChars += day.OCRChars
+		total.TranslatedChars += day.TranslatedChars
+		for name, chars := range day.Providers {
+			total.Providers[name] += chars
+		}
+	}
+	return total
+}
@@ -0,0 +1,57 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestCharacters(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	for _, chars := range []Characters{
+		{OCR: 100, Translated: 100, Provider: "google"},
+		{OCR: 50, Translated: 40, Provider: "libretranslate"},
+		{OCR: 30}, // Translation from the cache: nothing sent
+	} {
+		if err := RecordCharacters(ctx, client, "acme", chars); err != nil {
+			t.Fatal(err)
+		}
+	}
+	RecordCharacters(ctx, client, "globex", Characters{OCR: 7, Translated: 7, Provider: "google"})
+	yesterday := time.Now().AddDate(0, 0, -1)
+	client.HSet(ctx, CharsKey("acme", yesterday), "jobs", 1, "ocr_chars", 10, "translated_chars", 10, "provider:google", 10)
+
+	if ttl := mr.TTL(CharsKey("acme", time.Now())); ttl != CharsRetention {
+		t.Errorf("TTL of the counters = %v, want %v", ttl, CharsRetention)
+	}
+	if got := CharsKey("", time.Date(2024, 6, 1, 23, 0, 0, 0, time.FixedZone("ICT", 7*3600))); got != "stats:usage:chars::2024-06-01" {
+		t.Errorf("CharsKey of the default tenant = %q", got)
+	}
+
+	daily, err := LoadCharacters(ctx, client, "acme", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 3 || daily[0].Date != time.Now().UTC().Format("2006-01-02") || daily[1].Date != yesterday.UTC().Format("2006-01-02") {
+		t.Fatalf("LoadCharacters = %+v, want 3 days newest first", daily)
+	}
+	today := daily[0]
+	if today.Jobs != 3 || today.OCRChars != 180 || today.TranslatedChars != 140 || today.Providers["google"] != 100 || today.Providers["libretranslate"] != 40 {
+		t.Errorf("today = %+v", today)
+	}
+	if daily[2].Jobs != 0 || daily[2].Providers == nil {
+		t.Errorf("day without jobs = %+v, want zero counters", daily[2])
+	}
+
+	total := Sum(daily)
+	if total.Date != "" || total.Jobs != 4 || total.OCRChars != 190 || total.TranslatedChars != 150 || total.Providers["google"] != 110 {
+		t.Errorf("Sum = %+v", total)
+	}
+}
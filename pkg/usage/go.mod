@@ -0,0 +1,10 @@
+module github.com/mxngoc2104/KTPM-CS2/pkg/usage
+
+go 1.24.2
+
+require (
+	github.com/alicebob/miniredis/v2 v2.35.0
+	github.com/go-redis/redis/v8 v8.11.5
+)
+
+require github.com/yuin/gopher-lua v1.1.1 // indirect
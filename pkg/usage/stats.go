@@ -0,0 +1,157 @@
+package usage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys of the aggregated usage
+const (
+	StatsKey  = "stats:usage"         // Hash "<stage>:<counter>" -> value
+	TopCPUKey = "stats:usage:top_cpu" // Sorted set job ID -> total CPU ms
+	TopRSSKey = "stats:usage:top_rss" // Sorted set job ID -> largest child peak RSS KB
+)
+
+// TopJobs is how many of the most expensive jobs are kept per ranking
+const TopJobs = 20
+
+// Summed counters of a stage in StatsKey
+var sumCounters = []string{"wall_ms", "cpu_ms", "child_cpu_ms", "bytes_read", "bytes_written"}
+
+// Keeps the larger of the stored value and ARGV[2] in hash field ARGV[1]
+var hsetMaxScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local value = tonumber(ARGV[2])
+if value > current then
+	redis.call('HSET', KEYS[1], ARGV[1], value)
+end
+return 0`)
+
+// StageStats is the aggregated usage of a stage over all measured jobs
+type StageStats struct {
+	Jobs              int64   `json:"jobs"`
+	WallMS            int64   `json:"wall_ms"`
+	CPUMS             int64   `json:"cpu_ms"`
+	ChildCPUMS        int64   `json:"child_cpu_ms"`
+	BytesRead         int64   `json:"bytes_read"`
+	BytesWritten      int64   `json:"bytes_written"`
+	AvgWallMS         float64 `json:"avg_wall_ms"`
+	AvgCPUMS          float64 `json:"avg_cpu_ms"` // Worker + child CPU per job
+	MaxWallMS         int64   `json:"max_wall_ms"`
+	MaxChildPeakRSSKB int64   `json:"max_child_peak_rss_kb"`
+}
+
+// JobUsage is one entry of a most-expensive-jobs ranking
+type JobUsage struct {
+	JobID string `json:"job_id"`
+	Value int64  `json:"value"`
+}
+
+// Stats is the usage aggregated over all jobs, with the jobs that used the
+// most resources (candidates for pathological inputs)
+type Stats struct {
+	Jobs   int64                 `json:"jobs"`
+	Stages map[string]StageStats `json:"stages"`
+	TopCPU []JobUsage            `json:"top_cpu_ms"`
+	TopRSS []JobUsage            `json:"top_child_peak_rss_kb"`
+}
+
+// Record adds the report of a job to the aggregated stats
+func Record(ctx context.Context, client *redis.Client, jobID string, report Report) error {
+	if len(report) == 0 {
+		return nil
+	}
+	var totalCPU, peakRSS int64
+	pipe := client.Pipeline()
+	pipe.HIncrBy(ctx, StatsKey, "jobs", 1)
+	for name, stage := range report {
+		values := []int64{stage.WallMS, stage.CPUMS, stage.ChildCPUMS, stage.BytesRead, stage.BytesWritten}
+		pipe.HIncrBy(ctx, StatsKey, name+":jobs", 1)
+		for i, counter := range sumCounters {
+			pipe.HIncrBy(ctx, StatsKey, name+":"+counter, values[i])
+		}
+		hsetMaxScript.Run(ctx, pipe, []string{StatsKey}, name+":max_wall_ms", stage.WallMS)
+		hsetMaxScript.Run(ctx, pipe, []string{StatsKey}, name+":max_child_peak_rss_kb", stage.ChildPeakRSSKB)
+		totalCPU += stage.CPUMS + stage.ChildCPUMS
+		if stage.ChildPeakRSSKB > peakRSS {
+			peakRSS = stage.ChildPeakRSSKB
+		}
+	}
+	pipe.ZAdd(ctx, TopCPUKey, &redis.Z{Score: float64(totalCPU), Member: jobID})
+	pipe.ZRemRangeByRank(ctx, TopCPUKey, 0, -TopJobs-1)
+	pipe.ZAdd(ctx, TopRSSKey, &redis.Z{Score: float64(peakRSS), Member: jobID})
+	pipe.ZRemRangeByRank(ctx, TopRSSKey, 0, -TopJobs-1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Load reads the aggregated stats
+func Load(ctx context.Context, client *redis.Client) (*Stats, error) {
+	fields, err := client.HGetAll(ctx, StatsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{Stages: map[string]StageStats{}}
+	for field, raw := range fields {
+		value, _ := strconv.ParseInt(raw, 10, 64)
+		if field == "jobs" {
+			stats.Jobs = value
+			continue
+		}
+		name, counter, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		stage := stats.Stages[name]
+		switch counter {
+		case "jobs":
+			stage.Jobs = value
+		case "wall_ms":
+			stage.WallMS = value
+		case "cpu_ms":
+			stage.CPUMS = value
+		case "child_cpu_ms":
+			stage.ChildCPUMS = value
+		case "bytes_read":
+			stage.BytesRead = value
+		case "bytes_written":
+			stage.BytesWritten = value
+		case "max_wall_ms":
+			stage.MaxWallMS = value
+		case "max_child_peak_rss_kb":
+			stage.MaxChildPeakRSSKB = value
+		}
+		stats.Stages[name] = stage
+	}
+	for name, stage := range stats.Stages {
+		if stage.Jobs > 0 {
+			stage.AvgWallMS = float64(stage.WallMS) / float64(stage.Jobs)
+			stage.AvgCPUMS = float64(stage.CPUMS+stage.ChildCPUMS) / float64(stage.Jobs)
+		}
+		stats.Stages[name] = stage
+	}
+
+	if stats.TopCPU, err = loadTop(ctx, client, TopCPUKey); err != nil {
+		return nil, err
+	}
+	if stats.TopRSS, err = loadTop(ctx, client, TopRSSKey); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func loadTop(ctx context.Context, client *redis.Client, key string) ([]JobUsage, error) {
+	entries, err := client.ZRevRangeWithScores(ctx, key, 0, TopJobs-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	top := make([]JobUsage, 0, len(entries))
+	for _, entry := range entries {
+		jobID, _ := entry.Member.(string)
+		top = append(top, JobUsage{JobID: jobID, Value: int64(entry.Score)})
+	}
+	return top, nil
+}
@@ -0,0 +1,59 @@
+package usage
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func takeSnapshot() snapshot {
+	s := snapshot{at: time.Now()}
+	var self syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &self) == nil {
+		s.cpu = rusageCPU(&self)
+	}
+	s.bytesRead, s.bytesWritten = procIO()
+	return s
+}
+
+func rusageCPU(ru *syscall.Rusage) time.Duration {
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// procIO reads the rchar/wchar counters of /proc/self/io: bytes passed to
+// read and write calls (files, pipes and sockets), including the I/O of
+// children once they are reaped
+func procIO() (read, written int64) {
+	f, err := os.Open("/proc/self/io")
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		switch key {
+		case "rchar":
+			read = n
+		case "wchar":
+			written = n
+		}
+	}
+	return read, written
+}
+
+// processUsage returns the CPU time and peak RSS of a finished process
+// (ru_maxrss is in KB on Linux)
+func processUsage(state *os.ProcessState) (time.Duration, int64) {
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return rusageCPU(ru), ru.Maxrss
+	}
+	return 0, 0
+}
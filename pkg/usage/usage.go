@@ -0,0 +1,139 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stage is the resources used by one processing stage of a job
+type Stage struct {
+	WallMS         int64 `json:"wall_ms"`
+	CPUMS          int64 `json:"cpu_ms"`            // User + system CPU of the worker process
+	ChildCPUMS     int64 `json:"child_cpu_ms"`      // User + system CPU of the processes spawned by the stage (e.g. tesseract)
+	ChildPeakRSSKB int64 `json:"child_peak_rss_kb"` // Largest peak RSS of a spawned process
+	BytesRead      int64 `json:"bytes_read"`        // Bytes read by the worker and its reaped children
+	BytesWritten   int64 `json:"bytes_written"`
+	// Approximate is set when other stages ran in the same process at the
+	// same time: CPUMS and the byte counts then include their usage
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// Add accumulates other into s (sums, and the maximum of the peaks)
+func (s *Stage) Add(other Stage) {
+	s.WallMS += other.WallMS
+	s.CPUMS += other.CPUMS
+	s.ChildCPUMS += other.ChildCPUMS
+	s.BytesRead += other.BytesRead
+	s.BytesWritten += other.BytesWritten
+	if other.ChildPeakRSSKB > s.ChildPeakRSSKB {
+		s.ChildPeakRSSKB = other.ChildPeakRSSKB
+	}
+	s.Approximate = s.Approximate || other.Approximate
+}
+
+// Report is the usage of every stage of a job, by stage name
+type Report map[string]Stage
+
+// Add accumulates a stage measurement (stages may run once per page)
+func (r Report) Add(name string, stage Stage) {
+	total := r[name]
+	total.Add(stage)
+	r[name] = total
+}
+
+// JSON encodes the report for the job details
+func (r Report) JSON() string {
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+// snapshot is the process-wide counters at one instant
+type snapshot struct {
+	at           time.Time
+	cpu          time.Duration
+	bytesRead    int64
+	bytesWritten int64
+}
+
+// Meter measures one stage of one job.
+//
+// Spawned processes are attributed exactly: TrackProcess adds the CPU time
+// and peak RSS of each process to the Meter of its context. The CPU and I/O
+// of the worker process itself can only be read process-wide, so they are
+// the change of the process counters over the stage; when other stages run
+// at the same time (several jobs in one process), the stage is marked
+// Approximate because it includes their usage.
+type Meter struct {
+	start       snapshot
+	mu          sync.Mutex
+	childCPU    time.Duration
+	peakRSS     int64
+	overlapping bool // Another Meter ran during the stage
+}
+
+type meterKey struct{}
+
+var (
+	runningMu sync.Mutex
+	running   = map[*Meter]bool{}
+)
+
+// Start begins measuring a stage. Pass the returned context to the code that
+// spawns processes so TrackProcess attributes them to this stage.
+func Start(ctx context.Context) (context.Context, *Meter) {
+	m := &Meter{start: takeSnapshot()}
+	runningMu.Lock()
+	for other := range running {
+		other.markOverlapping()
+		m.overlapping = true
+	}
+	running[m] = true
+	runningMu.Unlock()
+	return context.WithValue(ctx, meterKey{}, m), m
+}
+
+func (m *Meter) markOverlapping() {
+	m.mu.Lock()
+	m.overlapping = true
+	m.mu.Unlock()
+}
+
+// Stop ends the measurement
+func (m *Meter) Stop() Stage {
+	end := takeSnapshot()
+	runningMu.Lock()
+	delete(running, m)
+	runningMu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Stage{
+		WallMS:         end.at.Sub(m.start.at).Milliseconds(),
+		CPUMS:          (end.cpu - m.start.cpu).Milliseconds(),
+		ChildCPUMS:     m.childCPU.Milliseconds(),
+		ChildPeakRSSKB: m.peakRSS,
+		BytesRead:      end.bytesRead - m.start.bytesRead,
+		BytesWritten:   end.bytesWritten - m.start.bytesWritten,
+		Approximate:    m.overlapping,
+	}
+}
+
+// TrackProcess adds the CPU time and peak RSS of a finished child process to
+// the Meter of ctx, if any. Call it after cmd.Run / cmd.Wait with
+// cmd.ProcessState.
+func TrackProcess(ctx context.Context, state *os.ProcessState) {
+	m, _ := ctx.Value(meterKey{}).(*Meter)
+	if m == nil || state == nil {
+		return
+	}
+	cpu, rss := processUsage(state)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.childCPU += cpu
+	if rss > m.peakRSS {
+		m.peakRSS = rss
+	}
+}
@@ -0,0 +1,91 @@
+package usage
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary doubles as the child process measured by TrackProcess
+func TestMain(m *testing.M) {
+	if os.Getenv("USAGE_TEST_CHILD") == "1" {
+		burnCPU(100 * time.Millisecond)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func burnCPU(d time.Duration) {
+	buf := make([]byte, 32<<20)
+	for start := time.Now(); time.Since(start) < d; {
+		for i := range buf {
+			buf[i]++
+		}
+	}
+}
+
+func runChild(t *testing.T, ctx context.Context) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "USAGE_TEST_CHILD=1")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	TrackProcess(ctx, cmd.ProcessState)
+}
+
+func TestTrackProcess(t *testing.T) {
+	ocrCtx, ocrMeter := Start(context.Background())
+	_, translateMeter := Start(context.Background()) // Another job's stage running at the same time
+	runChild(t, ocrCtx)
+	runChild(t, context.Background()) // Not measured by any stage
+	ocr, translate := ocrMeter.Stop(), translateMeter.Stop()
+
+	if ocr.ChildCPUMS < 50 {
+		t.Errorf("ocr child CPU = %d ms, want the CPU of the child (~100 ms)", ocr.ChildCPUMS)
+	}
+	if runtime.GOOS == "linux" && ocr.ChildPeakRSSKB < 32<<10 {
+		t.Errorf("ocr child peak RSS = %d KB, want at least the 32 MB buffer", ocr.ChildPeakRSSKB)
+	}
+	if translate.ChildCPUMS != 0 || translate.ChildPeakRSSKB != 0 {
+		t.Errorf("translate got the child of another stage: %+v", translate)
+	}
+	if !ocr.Approximate || !translate.Approximate {
+		t.Errorf("overlapping stages not marked approximate: %+v, %+v", ocr, translate)
+	}
+
+	// Alone again: exact
+	_, m := Start(context.Background())
+	if stage := m.Stop(); stage.Approximate {
+		t.Errorf("stage marked approximate without overlap: %+v", stage)
+	}
+}
+
+func TestTrackProcessWithoutMeter(t *testing.T) {
+	TrackProcess(context.Background(), nil)
+	ctx, m := Start(context.Background())
+	TrackProcess(ctx, nil)
+	if stage := m.Stop(); stage.ChildCPUMS != 0 {
+		t.Fatalf("stage = %+v", stage)
+	}
+}
+
+func TestReportAdd(t *testing.T) {
+	report := Report{}
+	report.Add("ocr", Stage{WallMS: 10, CPUMS: 2, ChildCPUMS: 8, ChildPeakRSSKB: 300, BytesRead: 100})
+	report.Add("ocr", Stage{WallMS: 5, CPUMS: 1, ChildCPUMS: 4, ChildPeakRSSKB: 200, BytesWritten: 50, Approximate: true})
+	report.Add("pdf", Stage{WallMS: 3})
+
+	want := Stage{WallMS: 15, CPUMS: 3, ChildCPUMS: 12, ChildPeakRSSKB: 300, BytesRead: 100, BytesWritten: 50, Approximate: true}
+	if report["ocr"] != want {
+		t.Fatalf("ocr = %+v, want %+v", report["ocr"], want)
+	}
+	json := report.JSON()
+	if !strings.Contains(json, `"approximate":true`) || strings.Count(json, "approximate") != 1 {
+		t.Fatalf("JSON = %s, want approximate only on ocr", json)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
+)
+
+const (
+	maxHTTPBody      = 10 << 20 // Giới hạn message của Pub/Sub
+	storageEventType = "google.cloud.storage.object.v1.finalized"
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+	codeEventFailed = "EVENT_FAILED" // Xử lý sự kiện lỗi, Pub/Sub/Eventarc sẽ gửi lại
+)
+
+// --- Cloud Functions gen2 / Cloud Run: HTTP server nhận sự kiện qua Eventarc hoặc Pub/Sub push ---
+// Dịch vụ cần yêu cầu xác thực (IAM): bất kỳ ai gọi được endpoint đều tạo được Job
+// Timeout/TLS/CORS đọc từ biến môi trường như API (HTTP_*, TLS_*, CORS_ALLOWED_ORIGINS);
+// STAGE=all chạy cả pipeline trong một request nên timeout ghi mặc định dài hơn (Cloud Run tối đa 60 phút)
+func runHTTP(addr string) {
+	serverDefaults := httpserver.DefaultConfig()
+	serverDefaults.WriteTimeout = time.Hour
+	serverConfig, err := httpserver.ConfigFromEnv(serverDefaults)
+	if err != nil {
+		log.Fatalf("SERVERLESS: Invalid HTTP server configuration: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleHTTP)
+	fmt.Printf("SERVERLESS: Listening for events on %s (TLS: %t)\n", addr, serverConfig.TLS())
+	log.Fatal(httpserver.ListenAndServe(addr, mux, serverConfig))
+}
+
+// Trả lỗi 5xx để Pub/Sub/Eventarc gửi lại message (retry, dead-letter topic)
+func handleHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpserver.WriteError(w, r, http.StatusMethodNotAllowed, httpserver.CodeMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHTTPBody))
+	if err != nil {
+		httpserver.WriteError(w, r, http.StatusBadRequest, httpserver.CodeInvalidRequest, err.Error(), nil)
+		return
+	}
+	if err := handleHTTPEvent(r.Context(), r.Header, body); err != nil {
+		log.Printf("SERVERLESS: Event failed (request %s): %v", httpserver.RequestID(r), err)
+		httpserver.WriteError(w, r, http.StatusInternalServerError, codeEventFailed, err.Error(), nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleHTTPEvent nhận CloudEvent của Cloud Storage (binary mode, loại trong
+// header Ce-Type), message Pub/Sub push ({"message": {"data": base64}}, cả khi
+// qua Eventarc) hoặc JSON của message gửi trực tiếp
+func handleHTTPEvent(ctx context.Context, header http.Header, body []byte) error {
+	if eventType := header.Get("Ce-Type"); strings.HasPrefix(eventType, "google.cloud.storage.object.") {
+		if eventType != storageEventType {
+			return nil // Xóa, lưu trữ hoặc đổi metadata của object
+		}
+		var object struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(body, &object); err != nil {
+			return fmt.Errorf("invalid storage event: %w", err)
+		}
+		return handleUpload(ctx, object.Name)
+	}
+
+	var push struct {
+		Message *struct {
+			Data []byte `json:"data"` // Base64 trong JSON
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &push); err == nil && push.Message != nil {
+		return handleMessage(ctx, push.Message.Data)
+	}
+	return handleMessage(ctx, body)
+}
+
+// --- Gửi message sang Pub/Sub (REST API, token của service account từ metadata server) ---
+type pubsubPublisher struct {
+	topic  string // projects/{project}/topics/{topic}
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newPubSubPublisher(topic string) (*pubsubPublisher, error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "topics" || parts[1] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("NEXT_TOPIC must be projects/{project}/topics/{topic}, got %q", topic)
+	}
+	return &pubsubPublisher{topic: topic, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// Publish implements publisher
+func (p *pubsubPublisher) Publish(ctx context.Context, body []byte) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]any{"messages": []map[string][]byte{{"data": body}}})
+	if err != nil {
+		return err
+	}
+	endpoint := "https://pubsub.googleapis.com/v1/" + (&url.URL{Path: p.topic}).EscapedPath() + ":publish"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Pub/Sub publish failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Pub/Sub publish returned %s: %s", resp.Status, string(msg))
+	}
+	return nil
+}
+
+// accessToken trả về token còn hạn, lấy token mới trước khi hết hạn 1 phút
+func (p *pubsubPublisher) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Before(p.expires) {
+		return p.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("metadata server unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned %s", resp.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid metadata token response: %w", err)
+	}
+	p.token = token.AccessToken
+	p.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleHTTP(t *testing.T) {
+	queue := useTranslateStage(t, map[string]string{"job1": "total"})
+	push := func(data string) string {
+		return `{"message":{"data":"` + base64.StdEncoding.EncodeToString([]byte(data)) + `"},"subscription":"projects/p/subscriptions/s"}`
+	}
+	tests := []struct {
+		name       string
+		method     string
+		eventType  string // Header Ce-Type
+		body       string
+		wantStatus int
+	}{
+		{"pub/sub push", http.MethodPost, "", push(ocrDone("job1")), http.StatusNoContent},
+		{"direct message", http.MethodPost, "", ocrDone("job1"), http.StatusNoContent},
+		{"object deleted", http.MethodPost, "google.cloud.storage.object.v1.deleted", `{"name":"uploads/a.png"}`, http.StatusNoContent},
+		{"object outside the uploads", http.MethodPost, storageEventType, `{"name":"pdfs/a.pdf"}`, http.StatusNoContent},
+		{"upload in the translate stage", http.MethodPost, storageEventType, `{"name":"uploads/a.png"}`, http.StatusInternalServerError},
+		{"invalid storage event", http.MethodPost, storageEventType, `[]`, http.StatusInternalServerError},
+		{"failed message", http.MethodPost, "", push(ocrDone("job2")), http.StatusInternalServerError},
+		{"not a message", http.MethodPost, "", "hello", http.StatusInternalServerError},
+		{"GET", http.MethodGet, "", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.eventType != "" {
+				r.Header.Set("Ce-Type", tt.eventType)
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code == http.StatusInternalServerError {
+				// Pub/Sub và Eventarc gửi lại message khi nhận lỗi 5xx
+				var body struct {
+					Error struct{ Code string } `json:"error"`
+				}
+				if json.Unmarshal(w.Body.Bytes(), &body); body.Error.Code != codeEventFailed {
+					t.Errorf("error = %s", w.Body)
+				}
+			}
+		})
+	}
+	if len(queue.messages) != 2 {
+		t.Errorf("%d messages published, want 2", len(queue.messages))
+	}
+}
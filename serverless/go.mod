@@ -0,0 +1,5 @@
+module github.com/mxngoc2104/KTPM-CS2/serverless
+
+go 1.24.2
+
+require github.com/google/uuid v1.6.0
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/broker"
+)
+
+// --- AWS Lambda: vòng lặp Runtime API (custom runtime provided.al2023 / container image) ---
+// Không cần aws-lambda-go: runtime chỉ là ba endpoint HTTP next/response/error
+func runLambda(api string) {
+	base := "http://" + api + "/2018-06-01/runtime/invocation/"
+	client := &http.Client{} // Không timeout: "next" chờ tới khi có lần gọi mới
+	for {
+		resp, err := client.Get(base + "next")
+		if err != nil {
+			log.Fatalf("SERVERLESS: Lambda runtime API unavailable: %v", err)
+		}
+		payload, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			log.Fatalf("SERVERLESS: Failed to read Lambda invocation: %v", err)
+		}
+		requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+		deadline := time.Now().Add(15 * time.Minute) // Thời gian chạy tối đa của Lambda
+		if ms, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+			deadline = time.UnixMilli(ms)
+		}
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		result, err := handleLambdaEvent(ctx, payload)
+		cancel()
+
+		if err != nil {
+			log.Printf("SERVERLESS: Invocation %s failed: %v", requestID, err)
+			result, _ = json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "StageError"})
+			postRuntime(client, base+requestID+"/error", result, "StageError")
+			continue
+		}
+		postRuntime(client, base+requestID+"/response", result, "")
+	}
+}
+
+func postRuntime(client *http.Client, endpoint string, body []byte, errorType string) {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("SERVERLESS: %v", err)
+		return
+	}
+	if errorType != "" {
+		req.Header.Set("Lambda-Runtime-Function-Error-Type", errorType)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("SERVERLESS: Failed to report Lambda result: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// --- Sự kiện Lambda: S3 notification, SQS batch hoặc gọi trực tiếp với JSON của message ---
+type lambdaEvent struct {
+	Records []lambdaRecord `json:"Records"`
+}
+
+type lambdaRecord struct {
+	EventSource string `json:"eventSource"` // "aws:s3" hoặc "aws:sqs"
+	MessageID   string `json:"messageId"`
+	Body        string `json:"body"`
+	S3          struct {
+		Object struct {
+			Key string `json:"key"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+type batchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// handleLambdaEvent trả về response của lần gọi. Với SQS, message lỗi được
+// trả trong batchItemFailures (event source mapping cần bật ReportBatchItemFailures)
+// để chỉ các message đó được gửi lại: lỗi (kể cả panic) của một message không
+// làm hỏng cả batch. Sự kiện S3 gọi trực tiếp không có batch: lần gọi lỗi để
+// Lambda gửi lại sự kiện.
+func handleLambdaEvent(ctx context.Context, payload []byte) ([]byte, error) {
+	var event lambdaEvent
+	if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) == 0 {
+		if err := handleMessage(ctx, payload); err != nil {
+			return nil, err
+		}
+		return []byte(`{"status":"ok"}`), nil
+	}
+
+	failures := []batchItemFailure{}
+	var errs []error
+	for _, record := range event.Records {
+		switch record.EventSource {
+		case "aws:s3":
+			if err := handleRecord(ctx, record); err != nil {
+				errs = append(errs, err)
+			}
+		case "aws:sqs":
+			if err := handleRecord(ctx, record); err != nil {
+				log.Printf("SERVERLESS: SQS message %s failed: %v", record.MessageID, err)
+				failures = append(failures, batchItemFailure{ItemIdentifier: record.MessageID})
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unsupported event source %q", record.EventSource))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return json.Marshal(map[string]any{"batchItemFailures": failures})
+}
+
+// handleRecord xử lý một record, panic được trả về như lỗi của record đó.
+// Message SQS chưa bắt đầu khi lần gọi sắp hết giờ được trả lỗi để gửi lại.
+func handleRecord(ctx context.Context, record lambdaRecord) (err error) {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("not started: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("SERVERLESS: PANIC while handling %s record: %v\n%s", record.EventSource, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if record.EventSource == "aws:s3" {
+		return handleS3Key(ctx, record.S3.Object.Key)
+	}
+	// Thông báo S3 gửi qua hàng đợi SQS (bucket -> SQS -> Lambda): body là sự kiện S3
+	var event lambdaEvent
+	if json.Unmarshal([]byte(record.Body), &event) == nil && len(event.Records) > 0 && event.Records[0].EventSource == "aws:s3" {
+		for _, s3Record := range event.Records {
+			if err := handleS3Key(ctx, s3Record.S3.Object.Key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return handleMessage(ctx, []byte(record.Body))
+}
+
+func handleS3Key(ctx context.Context, rawKey string) error {
+	// Key trong S3 event được URL-encode (dấu cách thành '+')
+	key, err := url.QueryUnescape(rawKey)
+	if err != nil {
+		return fmt.Errorf("invalid S3 object key %q: %w", rawKey, err)
+	}
+	return handleUpload(ctx, key)
+}
+
+// --- Gửi message sang SQS qua publisher của pkg/broker (ký SigV4 bằng credentials của Lambda) ---
+type sqsPublisher struct{ *broker.SQSPublisher }
+
+func newSQSPublisher(queueURL string) (sqsPublisher, error) {
+	config, err := broker.SQSConfigFromEnv()
+	if err != nil {
+		return sqsPublisher{}, err
+	}
+	config.QueueURL, config.TopicARN = queueURL, ""
+	p, err := broker.NewSQSPublisher(config)
+	return sqsPublisher{p}, err
+}
+
+// Publish implements publisher
+func (p sqsPublisher) Publish(ctx context.Context, body []byte) error {
+	return p.PublishBody(ctx, body, "")
+}
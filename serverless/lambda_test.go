@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+)
+
+// upperProvider dịch sang chữ hoa
+type upperProvider struct{}
+
+func (upperProvider) Name() string { return "upper" }
+
+func (upperProvider) Translate(text, _, _ string) (string, error) { return strings.ToUpper(text), nil }
+
+// fakePublisher ghi lại message gửi sang bước tiếp theo, panic với Job "panic"
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []stageMessage
+}
+
+func (p *fakePublisher) Publish(_ context.Context, body []byte) error {
+	var msg stageMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return err
+	}
+	if msg.Job.JobID == "panic" {
+		panic("publisher bug")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+// useTranslateStage chạy function ở bước translate với storage trong thư mục
+// tạm, văn bản OCR của các Job trong texts và hàng đợi giả
+func useTranslateStage(t *testing.T, texts map[string]string) *fakePublisher {
+	t.Helper()
+	previousStage, previousArtifacts, previousNext, previousProvider := stage, artifacts, next, translator.CurrentProvider()
+	t.Cleanup(func() {
+		stage, artifacts, next = previousStage, previousArtifacts, previousNext
+		translator.SetProvider(previousProvider)
+	})
+	queue := &fakePublisher{}
+	stage, artifacts, next = stageTranslate, storage.NewFileStorage(t.TempDir()), queue
+	translator.SetProvider(upperProvider{})
+	for jobID, text := range texts {
+		if err := writeObject(context.Background(), textKey(jobID, stageOCR), []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return queue
+}
+
+// ocrDone là message của bước ocr cho Job
+func ocrDone(jobID string) string {
+	body, _ := json.Marshal(stageMessage{Job: messaging.JobMessage{JobID: jobID, TargetLang: "vi"}, TextKey: textKey(jobID, stageOCR)})
+	return string(body)
+}
+
+// s3Event là thông báo S3 của các object
+func s3Event(keys ...string) string {
+	records := make([]map[string]any, len(keys))
+	for i, key := range keys {
+		records[i] = map[string]any{"eventSource": "aws:s3", "s3": map[string]any{"object": map[string]string{"key": key}}}
+	}
+	body, _ := json.Marshal(map[string]any{"Records": records})
+	return string(body)
+}
+
+// sqsEvent là batch SQS với các body, messageId m1, m2...
+func sqsEvent(bodies ...string) []byte {
+	records := make([]map[string]string, len(bodies))
+	for i, body := range bodies {
+		records[i] = map[string]string{"eventSource": "aws:sqs", "messageId": "m" + string(rune('1'+i)), "body": body}
+	}
+	payload, _ := json.Marshal(map[string]any{"Records": records})
+	return payload
+}
+
+func failedItems(t *testing.T, response []byte) []string {
+	t.Helper()
+	var result struct {
+		BatchItemFailures []batchItemFailure `json:"batchItemFailures"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil || result.BatchItemFailures == nil {
+		t.Fatalf("response %s: %v", response, err)
+	}
+	ids := []string{}
+	for _, f := range result.BatchItemFailures {
+		ids = append(ids, f.ItemIdentifier)
+	}
+	return ids
+}
+
+func TestLambdaSQSBatch(t *testing.T) {
+	ctx := context.Background()
+	queue := useTranslateStage(t, map[string]string{"job1": "total", "panic": "paid"})
+
+	response, err := handleLambdaEvent(ctx, sqsEvent(
+		ocrDone("job1"),
+		"{",
+		ocrDone("job2"), // Không có văn bản OCR
+		ocrDone("panic"),
+		s3Event("uploads/scan.png"), // Ảnh upload chỉ được bước ocr xử lý
+		s3Event("outputs/job1.pdf", "uploads/invoice.PDF"),
+	))
+	if err != nil {
+		t.Fatalf("one failed message failed the batch: %v", err)
+	}
+	// Chỉ các message lỗi được gửi lại
+	if got, want := failedItems(t, response), []string{"m2", "m3", "m4", "m5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batchItemFailures = %v, want %v", got, want)
+	}
+	if len(queue.messages) != 1 || queue.messages[0].Job.JobID != "job1" || queue.messages[0].TextKey != textKey("job1", stageTranslate) {
+		t.Fatalf("published %+v", queue.messages)
+	}
+	if text, err := readObject(ctx, textKey("job1", stageTranslate)); err != nil || string(text) != "TOTAL" {
+		t.Errorf("translated text = %q, %v", text, err)
+	}
+	var status jobStatus
+	data, _ := readObject(ctx, "status/job2.json")
+	if json.Unmarshal(data, &status); status.Status != "failed" || status.Stage != stageTranslate {
+		t.Errorf("status of job2 = %+v", status)
+	}
+
+	// Lần gọi sắp hết giờ: message chưa bắt đầu được gửi lại
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	response, err = handleLambdaEvent(cancelled, sqsEvent(ocrDone("job1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := failedItems(t, response); !reflect.DeepEqual(got, []string{"m1"}) || len(queue.messages) != 1 {
+		t.Errorf("batchItemFailures = %v after the deadline, %d messages published", got, len(queue.messages))
+	}
+}
+
+func TestLambdaEvents(t *testing.T) {
+	ctx := context.Background()
+	queue := useTranslateStage(t, map[string]string{"job1": "total"})
+
+	// Gọi trực tiếp với JSON của message
+	if response, err := handleLambdaEvent(ctx, []byte(ocrDone("job1"))); err != nil || string(response) != `{"status":"ok"}` {
+		t.Errorf("direct invocation = %s, %v", response, err)
+	}
+	if _, err := handleLambdaEvent(ctx, []byte(`{"job":{}}`)); err == nil {
+		t.Error("invalid direct invocation succeeded")
+	}
+	if len(queue.messages) != 1 {
+		t.Errorf("%d messages published, want 1", len(queue.messages))
+	}
+
+	// Sự kiện S3 gọi trực tiếp: lỗi làm lần gọi lỗi để Lambda gửi lại
+	tests := []struct {
+		name    string
+		payload string
+		wantErr string
+	}{
+		{"object outside the uploads", s3Event("outputs/a+b.pdf"), ""},
+		{"upload in the translate stage", s3Event("uploads/scan+1.png"), "handled by the ocr stage"},
+		{"invalid key", s3Event("uploads/%zz.png"), "invalid S3 object key"},
+		{"unsupported source", `{"Records":[{"eventSource":"aws:sns"}]}`, `unsupported event source "aws:sns"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := handleLambdaEvent(ctx, []byte(tt.payload))
+			if tt.wantErr == "" {
+				if err != nil || len(failedItems(t, response)) != 0 {
+					t.Errorf("handleLambdaEvent = %s, %v", response, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("handleLambdaEvent = %s, %v; want %q", response, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+)
+
+// --- Chạy pipeline dưới dạng serverless function (AWS Lambda, Cloud Functions/Cloud Run) ---
+// Mỗi function chạy một bước (STAGE): ocr -> translate -> pdf, nối với nhau qua
+// SQS (NEXT_QUEUE_URL) hoặc Pub/Sub (NEXT_TOPIC). Không cấu hình hàng đợi thì
+// function chạy tiếp các bước sau ngay trong cùng lần gọi (STAGE=all).
+// Không cần Kafka, Redis hay worker chạy thường trực: trạng thái Job nằm trong storage.
+
+const (
+	fileRoot     = "/tmp/output" // Gốc của storage dạng file (chỉ dùng khi chạy thử)
+	capsCacheDir = "/tmp/cache"  // Cache thông tin engine OCR, giữ lại giữa các lần gọi của cùng instance
+	capsCacheTTL = time.Hour * 24
+)
+
+var (
+	artifacts   storage.Storage // Ảnh upload, văn bản trung gian, PDF và trạng thái Job (STORAGE_BACKEND)
+	pdfTemplate *pdf.Template
+	pdfFonts               = pdf.DefaultFontRegistry()
+	ocrEngine   ocr.Engine = &ocr.TesseractEngine{}
+	next        publisher  // Hàng đợi của bước tiếp theo (nil: chạy tiếp trong cùng lần gọi)
+	stage       = os.Getenv("STAGE")
+	// Tiền tố của ảnh upload; sự kiện của object khác (PDF, văn bản trung gian) bị bỏ qua
+	uploadPrefix = envOr("UPLOAD_PREFIX", "uploads/")
+	// Ngôn ngữ đích của Job tạo từ sự kiện upload (Job gửi qua hàng đợi tự mang TargetLang)
+	defaultTargetLang = envOr("TARGET_LANG", translator.DefaultTargetLanguage)
+	detectLanguage, _ = strconv.ParseBool(os.Getenv("OCR_LANGUAGE_DETECTION"))
+	dpiConfig         = imagefilter.DefaultDPIConfig()
+)
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	if stage == "" {
+		stage = stageAll
+	}
+	if !validStage(stage) {
+		log.Fatalf("SERVERLESS: Unknown STAGE %q (expected ocr, translate, pdf or all)", stage)
+	}
+
+	var err error
+	artifacts, err = storage.FromEnv(fileRoot)
+	if err != nil {
+		log.Fatalf("SERVERLESS: %v", err)
+	}
+	fmt.Printf("SERVERLESS: Stage '%s' using '%s' storage\n", stage, artifacts.Name())
+
+	// --- Hàng đợi của bước tiếp theo ---
+	switch {
+	case stage == stageAll || stage == stagePDF:
+	case os.Getenv("NEXT_QUEUE_URL") != "":
+		next, err = newSQSPublisher(os.Getenv("NEXT_QUEUE_URL"))
+	case os.Getenv("NEXT_TOPIC") != "":
+		next, err = newPubSubPublisher(os.Getenv("NEXT_TOPIC"))
+	}
+	if err != nil {
+		log.Fatalf("SERVERLESS: %v", err)
+	}
+
+	if stage == stageAll || stage == stageOCR {
+		initOCR()
+	}
+	if stage != stageOCR || next == nil {
+		initTranslator()
+	}
+	if stage == stageAll || stage == stagePDF || next == nil {
+		initPDF()
+	}
+
+	// --- Chọn nền tảng: Lambda Runtime API hoặc HTTP (Cloud Functions gen2/Cloud Run) ---
+	if api := os.Getenv("AWS_LAMBDA_RUNTIME_API"); api != "" {
+		runLambda(api)
+		return
+	}
+	runHTTP(":" + envOr("PORT", "8080"))
+}
+
+// --- Engine OCR: pre-warm lúc cold start để lỗi cấu hình lộ ra trước Job đầu tiên ---
+func initOCR() {
+	var err error
+	if os.Getenv("OCR_ENGINE") == "remote" {
+		ocrEngine, err = ocr.NewRemoteEngine(ocr.RemoteConfig{
+			URL:    os.Getenv("OCR_REMOTE_URL"),
+			APIKey: os.Getenv("OCR_REMOTE_API_KEY"),
+			Cache:  ocr.CapabilityCache{Dir: capsCacheDir, TTL: capsCacheTTL},
+		})
+		if err != nil {
+			log.Fatalf("SERVERLESS: %v", err)
+		}
+	}
+	ctxPrewarm, cancelPrewarm := context.WithTimeout(context.Background(), 30*time.Second)
+	caps, err := ocrEngine.Prewarm(ctxPrewarm)
+	cancelPrewarm()
+	if err != nil {
+		log.Fatalf("SERVERLESS: OCR engine '%s' is not ready: %v", ocrEngine.Name(), err)
+	}
+	fmt.Printf("SERVERLESS: OCR engine '%s' ready (%s), languages: %v\n", caps.Engine, caps.Version, caps.Languages)
+
+	dpiConfig, err = imagefilter.DPIConfigFromEnv()
+	if err != nil {
+		log.Fatalf("SERVERLESS: Invalid DPI configuration: %v", err)
+	}
+}
+
+func initTranslator() {
+	provider, err := translator.ProviderFromEnv()
+	if err != nil {
+		log.Fatalf("SERVERLESS: %v", err)
+	}
+	translator.SetProvider(provider)
+}
+
+// --- Template và font PDF (cùng biến môi trường với worker) ---
+func initPDF() {
+	var err error
+	if tmplPath := os.Getenv("PDF_TEMPLATE"); tmplPath != "" {
+		tmpl := pdf.DefaultTemplate()
+		if tmplPath != "default" {
+			tmpl, err = pdf.LoadTemplate(tmplPath)
+			if err != nil {
+				log.Fatalf("SERVERLESS: %v", err)
+			}
+		}
+		pdfTemplate = &tmpl
+	}
+	if fontsPath := os.Getenv("PDF_FONTS"); fontsPath != "" {
+		fonts, err := pdf.LoadFontRegistry(fontsPath)
+		if fonts == nil {
+			log.Fatalf("SERVERLESS: %v", err)
+		}
+		pdfFonts = fonts
+	} else if fontDir := os.Getenv("PDF_FONT_DIR"); fontDir != "" {
+		pdfFonts.Dir = fontDir
+	}
+	// Thiếu font: dùng font dựng sẵn trong binary, chỉ cho văn bản chữ Latin
+	if err := pdfFonts.Validate(); err != nil {
+		log.Printf("SERVERLESS: Warning: %v; using the built-in font (Latin text only)", err)
+		pdfFonts = pdf.BuiltinFontRegistry()
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+)
+
+// Các bước của pipeline (STAGE)
+const (
+	stageOCR       = "ocr"       // Sự kiện upload / JobMessage -> văn bản OCR
+	stageTranslate = "translate" // Văn bản OCR -> văn bản đã dịch
+	stagePDF       = "pdf"       // Văn bản đã dịch -> PDF
+	stageAll       = "all"       // Cả ba bước trong một lần gọi
+)
+
+func validStage(s string) bool {
+	switch s {
+	case stageOCR, stageTranslate, stagePDF, stageAll:
+		return true
+	}
+	return false
+}
+
+// --- Message giữa các bước (SQS/Pub/Sub) ---
+// Văn bản nằm trong storage thay vì trong message: SQS giới hạn 256 KB, Pub/Sub 10 MB
+type stageMessage struct {
+	Job        messaging.JobMessage `json:"job"`
+	SourceLang string               `json:"source_lang,omitempty"` // Ngôn ngữ nguồn phát hiện được, rỗng: tiếng Anh
+	TextKey    string               `json:"text_key"`              // Văn bản của bước trước, các trang cách nhau bởi pdf.PageBreak
+}
+
+// --- Trạng thái Job, lưu trong storage tại status/{jobID}.json ---
+type jobStatus struct {
+	JobID     string    `json:"job_id"`
+	Status    string    `json:"status"` // processing, completed, failed
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error,omitempty"`
+	PDFKey    string    `json:"pdf_key,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// --- Xử lý message từ hàng đợi hoặc lần gọi trực tiếp ---
+// Bước ocr nhận JobMessage (ImagePath là key trong storage), các bước sau nhận stageMessage
+func handleMessage(ctx context.Context, body []byte) error {
+	if stage == stageOCR || stage == stageAll {
+		var job messaging.JobMessage
+		if err := json.Unmarshal(body, &job); err != nil {
+			return fmt.Errorf("invalid job message: %w", err)
+		}
+		if job.JobID == "" || job.ImagePath == "" {
+			return fmt.Errorf("job message requires job_id and image_path")
+		}
+		return runOCR(ctx, job)
+	}
+	var msg stageMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return fmt.Errorf("invalid stage message: %w", err)
+	}
+	if msg.Job.JobID == "" || msg.TextKey == "" {
+		return fmt.Errorf("stage message requires job.job_id and text_key")
+	}
+	if stage == stageTranslate {
+		return runTranslate(ctx, msg)
+	}
+	return runPDF(ctx, msg)
+}
+
+// --- Xử lý sự kiện object mới trong bucket (S3, GCS) ---
+func handleUpload(ctx context.Context, key string) error {
+	if !strings.HasPrefix(key, uploadPrefix) || strings.HasSuffix(key, "/") {
+		log.Printf("SERVERLESS: Ignoring object %s outside of %s", key, uploadPrefix)
+		return nil
+	}
+	if strings.EqualFold(path.Ext(key), ".pdf") {
+		log.Printf("SERVERLESS: Ignoring PDF upload %s (pdf_text jobs need the worker)", key)
+		return nil
+	}
+	if stage != stageOCR && stage != stageAll {
+		return fmt.Errorf("storage events are handled by the ocr stage, this function runs stage %s", stage)
+	}
+	return runOCR(ctx, jobFromKey(key))
+}
+
+// --- Tạo Job từ key của ảnh upload ---
+// Key dạng "uploads/{jobID}-{tên file}" (như API) giữ jobID, key khác nhận jobID mới
+func jobFromKey(key string) messaging.JobMessage {
+	name := path.Base(key)
+	jobID := ""
+	if len(name) > 36 && name[36] == '-' {
+		if _, err := uuid.Parse(name[:36]); err == nil {
+			jobID = name[:36]
+		}
+	}
+	if jobID == "" {
+		jobID = uuid.NewString()
+	}
+	return messaging.JobMessage{JobID: jobID, ImagePath: key, TargetLang: defaultTargetLang}
+}
+
+// --- Bước 1: OCR ---
+func runOCR(ctx context.Context, job messaging.JobMessage) error {
+	if job.JobType == messaging.JobTypePDFText {
+		return failJob(ctx, job.JobID, stageOCR, fmt.Errorf("pdf_text jobs are not supported by the serverless pipeline"))
+	}
+	setJobStatus(ctx, jobStatus{JobID: job.JobID, Status: "processing", Stage: stageOCR})
+	start := time.Now()
+	text, sourceLang, err := recognize(ctx, job)
+	if err != nil {
+		return failJob(ctx, job.JobID, stageOCR, err)
+	}
+	log.Printf("SERVERLESS: OCR completed for job %s (request %s, %v). Text length: %d", job.JobID, job.RequestID, time.Since(start), len(text))
+
+	msg := stageMessage{Job: job, SourceLang: sourceLang, TextKey: textKey(job.JobID, stageOCR)}
+	if err := writeObject(ctx, msg.TextKey, []byte(text)); err != nil {
+		return failJob(ctx, job.JobID, stageOCR, err)
+	}
+	if next != nil {
+		return forward(ctx, stageOCR, msg)
+	}
+	return runTranslate(ctx, msg)
+}
+
+// --- OCR ảnh upload: tải về /tmp, chọn frame, lọc ảnh, OCR từng frame ---
+func recognize(ctx context.Context, job messaging.JobMessage) (string, string, error) {
+	dir, err := os.MkdirTemp("", "job-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(dir)
+	imagePath := filepath.Join(dir, path.Base(job.ImagePath))
+	if err := downloadObject(ctx, job.ImagePath, imagePath); err != nil {
+		return "", "", err
+	}
+
+	converter, err := imagefilter.ConverterFromEnv()
+	if err != nil {
+		return "", "", err
+	}
+	// HEIC/WebP -> PNG (heif-convert, dwebp)
+	if imagePath, _, err = converter.ToPNG(ctx, imagePath); err != nil {
+		return "", "", err
+	}
+	frames, err := imagefilter.ExtractFrames(imagePath, job.FramePolicy)
+	if err != nil {
+		return "", "", fmt.Errorf("frame extraction failed: %w", err)
+	}
+	pages := make([]string, 0, len(frames.Paths))
+	sourceLang := ""
+	for _, framePath := range frames.Paths {
+		dpi, err := dpiConfig.Resolve(framePath, job.DPI)
+		if err != nil {
+			return "", "", err
+		}
+		filtered, _, err := imagefilter.ApplyFiltersWithOptions(framePath, imagefilter.Options{DPI: dpi.Value})
+		if err != nil {
+			return "", "", fmt.Errorf("image filtering failed: %w", err)
+		}
+		var text string
+		if detectLanguage {
+			var detection *ocr.Detection
+			text, detection, err = ocr.DetectAndRecognize(ctx, ocrEngine, filtered, nil)
+			if detection != nil && sourceLang == "" {
+				sourceLang = detection.Language
+			}
+		} else {
+			text, err = ocrEngine.ImageToText(ctx, filtered)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("OCR failed: %w", err)
+		}
+		pages = append(pages, text)
+	}
+	return strings.Join(pages, pdf.PageBreak), sourceLang, nil
+}
+
+// --- Bước 2: dịch từng trang ---
+func runTranslate(ctx context.Context, msg stageMessage) error {
+	job := msg.Job
+	setJobStatus(ctx, jobStatus{JobID: job.JobID, Status: "processing", Stage: stageTranslate})
+	data, err := readObject(ctx, msg.TextKey)
+	if err != nil {
+		return failJob(ctx, job.JobID, stageTranslate, err)
+	}
+	targetLang := job.TargetLang
+	if targetLang == "" {
+		targetLang = translator.DefaultTargetLanguage
+	}
+	start := time.Now()
+	// Các trang được gửi theo lô nếu provider hỗ trợ (LibreTranslate)
+	pages, err := translator.TranslateBatch(strings.Split(string(data), pdf.PageBreak), msg.SourceLang, targetLang, translator.Glossary(job.GlossaryTerms))
+	if err != nil {
+		return failJob(ctx, job.JobID, stageTranslate, err)
+	}
+	translated := strings.Join(pages, pdf.PageBreak)
+	log.Printf("SERVERLESS: Translation completed for job %s (%v). Translated length: %d", job.JobID, time.Since(start), len(translated))
+
+	msg.TextKey = textKey(job.JobID, stageTranslate)
+	if err := writeObject(ctx, msg.TextKey, []byte(translated)); err != nil {
+		return failJob(ctx, job.JobID, stageTranslate, err)
+	}
+	if next != nil {
+		return forward(ctx, stageTranslate, msg)
+	}
+	return runPDF(ctx, msg)
+}
+
+// --- Bước 3: tạo PDF vào storage (pdfs/{jobID}.pdf như worker) ---
+func runPDF(ctx context.Context, msg stageMessage) error {
+	job := msg.Job
+	setJobStatus(ctx, jobStatus{JobID: job.JobID, Status: "processing", Stage: stagePDF})
+	data, err := readObject(ctx, msg.TextKey)
+	if err != nil {
+		return failJob(ctx, job.JobID, stagePDF, err)
+	}
+	targetLang := job.TargetLang
+	if targetLang == "" {
+		targetLang = translator.DefaultTargetLanguage
+	}
+	pdfKey := fmt.Sprintf("pdfs/%s.pdf", job.JobID)
+	w, err := artifacts.Create(ctx, pdfKey)
+	if err != nil {
+		return failJob(ctx, job.JobID, stagePDF, err)
+	}
+	err = pdf.CreatePDFTo(w, string(data), pdf.Config{
+		Template: pdfTemplate,
+		JobID:    job.JobID,
+		Fonts:    pdfFonts,
+		Language: targetLang,
+	})
+	if err != nil {
+		w.Abort()
+		return failJob(ctx, job.JobID, stagePDF, err)
+	}
+	if err := w.Close(); err != nil {
+		return failJob(ctx, job.JobID, stagePDF, err)
+	}
+	log.Printf("SERVERLESS: PDF generation completed for job %s. Output: %s", job.JobID, pdfKey)
+	setJobStatus(ctx, jobStatus{JobID: job.JobID, Status: "completed", Stage: stagePDF, PDFKey: pdfKey})
+	return nil
+}
+
+// --- Hàng đợi của bước tiếp theo (SQS, Pub/Sub) ---
+type publisher interface {
+	Publish(ctx context.Context, body []byte) error
+}
+
+// --- Gửi message sang bước tiếp theo ---
+func forward(ctx context.Context, from string, msg stageMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return failJob(ctx, msg.Job.JobID, from, err)
+	}
+	if err := next.Publish(ctx, body); err != nil {
+		return failJob(ctx, msg.Job.JobID, from, fmt.Errorf("failed to publish to the next stage: %w", err))
+	}
+	return nil
+}
+
+// --- Ghi trạng thái thất bại và trả lỗi để nền tảng gửi lại (retry, dead-letter queue) ---
+func failJob(ctx context.Context, jobID, failedStage string, err error) error {
+	setJobStatus(ctx, jobStatus{JobID: jobID, Status: "failed", Stage: failedStage, Error: err.Error()})
+	return fmt.Errorf("%s stage failed for job %s: %w", failedStage, jobID, err)
+}
+
+// --- Lỗi ghi trạng thái chỉ được log, không làm hỏng Job ---
+func setJobStatus(ctx context.Context, status jobStatus) {
+	status.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(status)
+	if err == nil {
+		err = writeObject(ctx, fmt.Sprintf("status/%s.json", status.JobID), data)
+	}
+	if err != nil {
+		log.Printf("SERVERLESS: Failed to write status of job %s: %v", status.JobID, err)
+	}
+}
+
+func textKey(jobID, fromStage string) string {
+	return fmt.Sprintf("texts/%s/%s.txt", jobID, fromStage)
+}
+
+func writeObject(ctx context.Context, key string, data []byte) error {
+	w, err := artifacts.Create(ctx, key)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+func readObject(ctx context.Context, key string) ([]byte, error) {
+	r, err := artifacts.Open(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func downloadObject(ctx context.Context, key, dst string) error {
+	r, err := artifacts.Open(ctx, key)
+	if err == storage.ErrNotFound {
+		return fmt.Errorf("uploaded image %s not found", key)
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
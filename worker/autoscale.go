@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/autoscale"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/broker"
+)
+
+// --- Tự điều chỉnh số job xử lý song song theo độ sâu hàng đợi (WORKER_MAX_CONCURRENCY) ---
+// Mỗi AUTOSCALE_INTERVAL đọc số job chờ/đang chạy từ broker (Kafka: lag của consumer group),
+// đặt số consumer trong [WORKER_MIN_CONCURRENCY, WORKER_MAX_CONCURRENCY] và ghi số replica
+// cần thiết (autoscale.HintKey) cho HPA/KEDA. Tăng ngay khi hàng đợi dài ra, giảm từng
+// consumer một mỗi lần đọc để không dao động theo các đợt job ngắn.
+func runAutoscaled(ctx context.Context, config autoscale.Config) {
+	publisher, err := broker.NewPublisher(ctx, cfg)
+	if err != nil {
+		log.Fatalf("WORKER: Failed to set up the message broker for autoscaling: %v", err)
+	}
+	defer publisher.Close()
+	inspector, ok := publisher.(broker.DepthInspector)
+	if !ok {
+		log.Fatalf("WORKER: Broker %s cannot report its queue depth, autoscaling is not supported", publisher.Name())
+	}
+
+	pool := &consumerPool{ctx: ctx}
+	if err := pool.resize(config.MinConcurrency); err != nil {
+		log.Fatalf("WORKER: Failed to set up the message broker: %v", err)
+	}
+	fmt.Printf("WORKER: Autoscaling %s consumers between %d and %d for topic '%s', group '%s' (target backlog %d per consumer)\n",
+		pool.name, config.MinConcurrency, config.MaxConcurrency, cfg.KafkaTopic, cfg.KafkaGroupID, config.TargetBacklog)
+
+	fmt.Println("WORKER: Starting message consumption loop...")
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			pool.wait()
+			return
+		case <-ticker.C:
+		}
+		depth, err := inspector.Depth(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("WORKER: Failed to read queue depth for autoscaling: %v", err)
+			}
+			continue
+		}
+		hint := config.Compute(depth.Pending + max(depth.InFlight, 0))
+		hint.WorkerID = fleetTracker.ID()
+		target := hint.Concurrency
+		if target < pool.size() {
+			target = pool.size() - 1
+		}
+		if target != pool.size() {
+			log.Printf("WORKER: Scaling consumers from %d to %d (backlog %d, desired replicas %d)", pool.size(), target, hint.Backlog, hint.DesiredReplicas)
+			if err := pool.resize(target); err != nil {
+				log.Printf("WORKER: Failed to add a consumer: %v", err)
+			}
+			fleetTracker.SetMaxConcurrency(pool.size())
+		}
+		if err := autoscale.Publish(ctx, redisClient, hint, config.Interval); err != nil && ctx.Err() == nil {
+			log.Printf("WORKER: Failed to publish autoscale hint: %v", err)
+		}
+	}
+}
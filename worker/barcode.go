@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+)
+
+// --- Tìm và giải mã barcode/QR code của ảnh (BARCODE_DETECTION hoặc barcodes=true của job) ---
+// Hóa đơn, nhãn vận chuyển thường có dữ liệu quan trọng chỉ nằm trong barcode. Tọa độ
+// tính theo pixel của ảnh đã xoay theo EXIF, như ảnh hiển thị cho người dùng.
+func barcodeStage(ctx context.Context, r *Job, _ map[string]string) error {
+	jobID := r.job.JobID
+	if loadStage(ctx, jobID, "barcodes", &r.barcodes, r.details) {
+		return nil
+	}
+	before := maps.Clone(r.details)
+	if err := ocr.CheckBarcodes(); err != nil {
+		errMsg := fmt.Sprintf("Barcode detection is not available on this worker: %v", err)
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+		return fmt.Errorf("barcode detection requested for job %s: %w", jobID, err)
+	}
+	barcodeStartTime := time.Now()
+	enterStage(ctx, jobID, "barcodes")
+	imagePath, orientation, err := imagefilter.AutoOrient(r.job.ImagePath)
+	if err != nil {
+		imagePath = r.job.ImagePath
+	} else if orientation != 1 {
+		defer os.Remove(imagePath)
+	}
+	r.barcodes, err = ocr.DetectBarcodes(ctx, imagePath)
+	if err != nil {
+		errMsg := fmt.Sprintf("Barcode detection error: %v", err)
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+		return permanent(errMsg, fmt.Errorf("barcode detection failed for job %s: %w", jobID, err))
+	}
+	if r.barcodes == nil {
+		r.barcodes = []ocr.Barcode{} // Bước đã chạy: lưu danh sách rỗng
+	}
+	r.details["barcodes"] = strconv.Itoa(len(r.barcodes))
+	r.details["barcodes_ms"] = strconv.FormatInt(time.Since(barcodeStartTime).Milliseconds(), 10)
+	saveStage(ctx, jobID, "barcodes", r.barcodes, r.details, before)
+	log.Printf("WORKER: Found %d barcode(s) in image of job %s", len(r.barcodes), jobID)
+	return nil
+}
+
+// --- Lưu barcode của job ({jobID}:barcodes, JSON) để API trả về trong status ---
+// Bước không chạy thì bỏ qua; không tìm thấy barcode nào vẫn lưu danh sách rỗng
+func saveJobBarcodes(ctx context.Context, jobID, cacheKey string, barcodes []ocr.Barcode) error {
+	if barcodes == nil {
+		return nil
+	}
+	data, err := json.Marshal(barcodes)
+	if err != nil {
+		return err
+	}
+	if err := redisClient.Set(ctx, fmt.Sprintf("%s:barcodes", jobID), data, jobTTL).Err(); err != nil {
+		return err
+	}
+	return resultCache.Set(ctx, fmt.Sprintf("%s:barcodes", cacheKey), string(data), cacheTTL)
+}
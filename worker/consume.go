@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/broker"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+)
+
+// Chờ giữa hai lần đọc message lỗi liên tiếp
+const (
+	receiveBackoff    = time.Second
+	receiveMaxBackoff = 30 * time.Second
+)
+
+// --- Chạy song song n consumer trong cùng group, mỗi consumer xử lý lần lượt ---
+// Với Kafka mỗi consumer là một reader riêng nên được chia partition: thứ tự
+// trong một partition (cùng key) được giữ và offset chỉ được commit sau khi job
+// của nó xử lý xong, không có offset nào bị commit vượt qua job chưa xong.
+// Số consumer vượt quá số partition của topic sẽ ngồi chờ.
+func runConsumers(ctx context.Context, n int) {
+	pool := &consumerPool{ctx: ctx}
+	if err := pool.resize(n); err != nil {
+		log.Fatalf("WORKER: Failed to set up the message broker: %v", err)
+	}
+	fmt.Printf("WORKER: %d %s consumer(s) configured for topic '%s', group '%s'\n", n, pool.name, cfg.KafkaTopic, cfg.KafkaGroupID)
+
+	fmt.Println("WORKER: Starting message consumption loop...")
+	pool.wait()
+}
+
+// --- Nhóm consumer có thể thêm/bớt khi đang chạy (tự điều chỉnh theo hàng đợi) ---
+// Consumer bị bớt dừng nhận message mới nhưng xử lý xong job đang chạy rồi mới đóng
+type consumerPool struct {
+	ctx  context.Context
+	name string // Tên broker, cho log
+	// Tạo consumer mới, nil: broker.NewConsumer (topic chính)
+	newConsumer func(ctx context.Context, cfg config.Config) (broker.Consumer, error)
+	wg          sync.WaitGroup
+	stops       []context.CancelFunc
+}
+
+// Số consumer đang chạy
+func (p *consumerPool) size() int { return len(p.stops) }
+
+// Thêm hoặc bớt consumer cho tới khi còn n consumer
+func (p *consumerPool) resize(n int) error {
+	newConsumer := p.newConsumer
+	if newConsumer == nil {
+		newConsumer = broker.NewConsumer
+	}
+	for len(p.stops) < n {
+		consumer, err := newConsumer(p.ctx, cfg)
+		if err != nil {
+			return err
+		}
+		p.name = consumer.Name()
+		ctxReceive, stop := context.WithCancel(p.ctx)
+		p.stops = append(p.stops, stop)
+		i := len(p.stops) - 1
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			consumeLoop(p.ctx, ctxReceive, consumer)
+			// Đóng sau vòng lặp để message đang xử lý vẫn được nack khi worker dừng
+			if err := consumer.Close(); err != nil {
+				log.Printf("WORKER: Failed to close broker consumer %d: %v", i, err)
+			}
+		}()
+	}
+	for len(p.stops) > n {
+		p.stops[len(p.stops)-1]()
+		p.stops = p.stops[:len(p.stops)-1]
+	}
+	return nil
+}
+
+// --- Làn ưu tiên (PRIORITY_TOPIC): job mode=sync có consumer riêng, không chờ sau hàng đợi ---
+// PRIORITY_CONCURRENCY (mặc định 1) consumer, thêm vào số job song song của worker;
+// trả về nil khi không có làn ưu tiên
+func startPriorityConsumers(ctx context.Context) (*consumerPool, error) {
+	if !broker.PriorityConfigured() {
+		return nil, nil
+	}
+	n := 1
+	if v := os.Getenv("PRIORITY_CONCURRENCY"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("PRIORITY_CONCURRENCY must be at least 1, got %q", v)
+		}
+	}
+	pool := &consumerPool{ctx: ctx, newConsumer: broker.NewPriorityConsumer}
+	if err := pool.resize(n); err != nil {
+		return nil, err
+	}
+	fmt.Printf("WORKER: %d %s consumer(s) configured for the priority lane\n", n, pool.name)
+	return pool, nil
+}
+
+// Chờ mọi consumer dừng (ctx của nhóm bị hủy)
+func (p *consumerPool) wait() { p.wg.Wait() }
+
+// --- Vòng lặp đọc message của một consumer cho tới khi ctx bị hủy ---
+// ctxReceive (con của ctx) bị hủy khi consumer bị bớt: chỉ dừng nhận message mới,
+// job đang chạy vẫn dùng ctx của worker
+// Lỗi đọc liên tiếp (broker mất kết nối) được thử lại sau receiveBackoff, gấp đôi
+// sau mỗi lần lỗi tới tối đa receiveMaxBackoff, thay vì gọi lại Receive ngay
+func consumeLoop(ctx, ctxReceive context.Context, consumer broker.Consumer) {
+	backoff := time.Duration(0)
+	for {
+		// Sử dụng context của worker để có thể dừng vòng lặp từ bên ngoài
+		m, err := consumer.Receive(ctxReceive)
+		if err != nil {
+			if ctxReceive.Err() != nil {
+				// Context bị hủy (worker đang dừng hoặc consumer bị bớt), thoát vòng lặp
+				return
+			}
+			backoff = min(max(2*backoff, receiveBackoff), receiveMaxBackoff)
+			log.Printf("WORKER: Error reading message: %v (retrying in %v)", err, backoff)
+			select {
+			case <-ctxReceive.Done():
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		fmt.Printf("WORKER: Received message at %s: %s\n", m.ID, string(m.Body))
+
+		var job messaging.JobMessage // Sử dụng struct từ package messaging
+		if err := json.Unmarshal(m.Body, &job); err != nil {
+			log.Printf("WORKER: Error unmarshaling message at %s: %v. Skipping.", m.ID, err)
+			// Ack message lỗi để không xử lý lại
+			if err := m.Ack(ctx); err != nil {
+				log.Printf("WORKER: failed to ack message at %s: %v", m.ID, err)
+			}
+			continue
+		}
+
+		if job.RequestID == "" {
+			// Message gửi bởi phiên bản API cũ hơn: request ID chỉ có trong header
+			job.RequestID = m.RequestID
+		}
+		fmt.Printf("WORKER: Processing job %s for image %s\n", jobLabel(job), job.ImagePath)
+
+		runJob(ctx, job)
+
+		// Worker dừng giữa chừng: trả message lại cho broker để gửi lại (các bước đã xong được bỏ qua)
+		if ctx.Err() != nil {
+			if err := m.Nack(context.Background()); err != nil {
+				log.Printf("WORKER: failed to nack message at %s: %v", m.ID, err)
+			}
+			return
+		}
+		// Ack message sau khi xử lý (job lỗi đã được đánh dấu failed, không xử lý lại)
+		if err := m.Ack(ctx); err != nil {
+			log.Printf("WORKER: failed to ack message at %s: %v", m.ID, err)
+		}
+		if ctxReceive.Err() != nil {
+			return // Consumer bị bớt trong lúc xử lý job
+		}
+	}
+}
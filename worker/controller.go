@@ -0,0 +1,459 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// ImageJob custom resource (deploy/kubernetes/imagejob-crd.yaml)
+const (
+	imageJobAPI          = "/apis/ktpm.io/v1alpha1"
+	imageJobStaleAfter   = time.Hour       // ImageJob Running lâu hơn được xử lý lại (worker bị dừng đột ngột)
+	imageJobWatchTimeout = 5 * time.Minute // Sau mỗi lần watch kết thúc, list lại toàn bộ (resync)
+	maxImageJobInput     = 50 << 20        // Kích thước tối đa của ảnh tải về
+)
+
+// Phase của ImageJob
+const (
+	imageJobPending   = "Pending"
+	imageJobRunning   = "Running"
+	imageJobSucceeded = "Succeeded"
+	imageJobFailed    = "Failed"
+)
+
+type imageJob struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+		Generation      int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec   imageJobSpec   `json:"spec"`
+	Status imageJobStatus `json:"status"`
+}
+
+// --- Spec của ImageJob, tương ứng các tham số upload của API ---
+// Giá trị hợp lệ được kiểm tra bởi schema của CRD
+type imageJobSpec struct {
+	Image         string                 `json:"image"` // URL http(s) hoặc key trong storage (STORAGE_BACKEND)
+	TargetLang    string                 `json:"targetLang,omitempty"`
+	EmbedImage    string                 `json:"embedImage,omitempty"`
+	FramePolicy   string                 `json:"framePolicy,omitempty"`
+	DPI           int                    `json:"dpi,omitempty"`
+	OCRMode       string                 `json:"ocrMode,omitempty"`
+	Glossary      string                 `json:"glossary,omitempty"`
+	GlossaryTerms map[string]string      `json:"glossaryTerms,omitempty"`
+	Regions       []messaging.CropRegion `json:"regions,omitempty"`
+}
+
+// --- Status của ImageJob ---
+// Không dùng omitempty: merge patch cần ghi đè (xóa) giá trị của lần chạy trước
+type imageJobStatus struct {
+	Phase              string              `json:"phase"`
+	JobID              string              `json:"jobID"` // Dùng với REST API: /api/status/{jobID}, /api/download/{jobID}
+	ObservedGeneration int64               `json:"observedGeneration"`
+	PDFKey             string              `json:"pdfKey"`
+	Cached             bool                `json:"cached"`
+	Message            string              `json:"message"`
+	StartedAt          *time.Time          `json:"startedAt"`
+	CompletedAt        *time.Time          `json:"completedAt"`
+	Conditions         []imageJobCondition `json:"conditions"`
+}
+
+type imageJobCondition struct {
+	Type               string    `json:"type"`   // Ready, Processing
+	Status             string    `json:"status"` // True, False
+	Reason             string    `json:"reason"`
+	Message            string    `json:"message"`
+	ObservedGeneration int64     `json:"observedGeneration"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// --- Controller: watch ImageJob và chạy pipeline cho từng resource ---
+// Mỗi lần một job như vòng lặp Kafka; nhiều replica dùng chung được nhờ
+// resourceVersion khi nhận job (replica nhận sau gặp conflict và bỏ qua)
+type controller struct {
+	kube      *kubeClient
+	namespace string
+	queue     chan string
+
+	mu     sync.Mutex
+	queued map[string]bool
+}
+
+func runController() {
+	kube, err := newKubeClient()
+	if err != nil {
+		log.Fatalf("WORKER: %v", err)
+	}
+	namespace := os.Getenv("CONTROLLER_NAMESPACE")
+	if namespace == "" {
+		namespace = podNamespace()
+	}
+	if namespace == "" {
+		log.Fatalf("WORKER: CONTROLLER_NAMESPACE is required outside of the cluster")
+	}
+	c := &controller{kube: kube, namespace: namespace, queue: make(chan string, 1024), queued: make(map[string]bool)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go c.watch(ctx)
+	fmt.Printf("WORKER: Controller watching ImageJobs in namespace '%s'\n", namespace)
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("WORKER: Shut down complete.")
+			return
+		case name := <-c.queue:
+			c.mu.Lock()
+			delete(c.queued, name)
+			c.mu.Unlock()
+			c.reconcile(ctx, name)
+		}
+	}
+}
+
+func (c *controller) path(name string) string {
+	p := imageJobAPI + "/namespaces/" + url.PathEscape(c.namespace) + "/imagejobs"
+	if name != "" {
+		p += "/" + url.PathEscape(name)
+	}
+	return p
+}
+
+func (c *controller) enqueue(job *imageJob) {
+	if !needsWork(job, time.Now()) {
+		return
+	}
+	c.mu.Lock()
+	if c.queued[job.Metadata.Name] {
+		c.mu.Unlock()
+		return
+	}
+	c.queued[job.Metadata.Name] = true
+	c.mu.Unlock()
+	c.queue <- job.Metadata.Name
+}
+
+// needsWork: spec chưa được xử lý, hoặc job Running quá lâu (worker xử lý đã dừng)
+func needsWork(job *imageJob, now time.Time) bool {
+	status := job.Status
+	if status.Phase == imageJobRunning {
+		return status.StartedAt == nil || now.Sub(*status.StartedAt) > imageJobStaleAfter
+	}
+	done := status.Phase == imageJobSucceeded || status.Phase == imageJobFailed
+	return !done || status.ObservedGeneration != job.Metadata.Generation
+}
+
+// --- List rồi watch từ resourceVersion của list; lỗi hoặc hết hạn thì list lại ---
+func (c *controller) watch(ctx context.Context) {
+	for ctx.Err() == nil {
+		resourceVersion, err := c.list(ctx)
+		if err == nil {
+			err = c.watchFrom(ctx, resourceVersion)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("WORKER: ImageJob watch failed, retrying: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+func (c *controller) list(ctx context.Context) (string, error) {
+	resp, err := c.kube.do(ctx, "GET", c.path(""), "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []imageJob `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", fmt.Errorf("invalid ImageJob list: %w", err)
+	}
+	for i := range list.Items {
+		c.enqueue(&list.Items[i])
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+func (c *controller) watchFrom(ctx context.Context, resourceVersion string) error {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("resourceVersion", resourceVersion)
+	query.Set("timeoutSeconds", fmt.Sprint(int(imageJobWatchTimeout.Seconds())))
+	resp, err := c.kube.do(ctx, "GET", c.path("")+"?"+query.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string          `json:"type"` // ADDED, MODIFIED, DELETED, BOOKMARK, ERROR
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var job imageJob
+			if err := json.Unmarshal(event.Object, &job); err != nil {
+				log.Printf("WORKER: Invalid ImageJob in watch event: %v", err)
+				continue
+			}
+			c.enqueue(&job)
+		case "ERROR":
+			// Thường là 410 Gone: resourceVersion đã quá cũ, cần list lại
+			return fmt.Errorf("watch error: %s", string(event.Object))
+		}
+	}
+}
+
+// --- Xử lý một ImageJob: nhận job, tải ảnh, chạy pipeline, ghi status ---
+func (c *controller) reconcile(ctx context.Context, name string) {
+	resp, err := c.kube.do(ctx, "GET", c.path(name), "", nil)
+	if err == errKubeNotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("WORKER: Failed to get ImageJob %s: %v", name, err)
+		return
+	}
+	var job imageJob
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err != nil {
+		log.Printf("WORKER: Invalid ImageJob %s: %v", name, err)
+		return
+	}
+	if !needsWork(&job, time.Now()) {
+		return
+	}
+
+	// Nhận job: resourceVersion trong patch bảo đảm chỉ một replica nhận được
+	jobID := uuid.New().String()
+	now := time.Now().UTC()
+	status := imageJobStatus{
+		Phase:              imageJobRunning,
+		JobID:              jobID,
+		ObservedGeneration: job.Metadata.Generation,
+		StartedAt:          &now,
+	}
+	status.Conditions = imageJobConditions(job.Status.Conditions, status, "Processing", "Pipeline is running")
+	if err := c.patchStatus(ctx, &job, status, true); err != nil {
+		if err != errKubeConflict {
+			log.Printf("WORKER: Failed to claim ImageJob %s: %v", name, err)
+		}
+		return
+	}
+	log.Printf("WORKER: Processing ImageJob %s as job %s", name, jobID)
+
+	msg, err := imageJobMessage(ctx, jobID, job.Spec)
+	var details map[string]string
+	reason := "InvalidInput"
+	if err == nil {
+		updateJobStatus(ctx, jobID, model.StatusQueued, "")
+		details, err = runJob(ctx, msg)
+		reason = "PipelineFailed"
+	}
+
+	// Worker đang dừng giữa chừng: trả ImageJob về Pending để replica khác xử lý
+	if ctx.Err() != nil {
+		status.Phase, status.Message, status.StartedAt = imageJobPending, "Interrupted by worker shutdown", nil
+		status.Conditions = imageJobConditions(status.Conditions, status, "Interrupted", status.Message)
+		ctxRelease, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := c.patchStatus(ctxRelease, &job, status, false); err != nil {
+			log.Printf("WORKER: Failed to release ImageJob %s: %v", name, err)
+		}
+		return
+	}
+
+	completed := time.Now().UTC()
+	status.CompletedAt = &completed
+	if err != nil {
+		status.Phase, status.Message = imageJobFailed, err.Error()
+		status.Conditions = imageJobConditions(status.Conditions, status, reason, status.Message)
+	} else {
+		status.Phase, status.Message = imageJobSucceeded, "PDF generated"
+		status.PDFKey, status.Cached = details["pdf_path"], details["cached"] == "true"
+		status.Conditions = imageJobConditions(status.Conditions, status, "Completed", status.Message)
+	}
+	if err := c.patchStatus(ctx, &job, status, false); err != nil {
+		log.Printf("WORKER: Failed to update status of ImageJob %s: %v", name, err)
+	}
+}
+
+// patchStatus ghi status qua subresource /status (JSON merge patch).
+// claim thêm resourceVersion đã đọc: API server trả 409 nếu resource đã thay đổi.
+func (c *controller) patchStatus(ctx context.Context, job *imageJob, status imageJobStatus, claim bool) error {
+	patch := map[string]any{"status": status}
+	if claim {
+		patch["metadata"] = map[string]string{"resourceVersion": job.Metadata.ResourceVersion}
+	}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	resp, err := c.kube.do(ctx, "PATCH", c.path(job.Metadata.Name)+"/status", "application/merge-patch+json", body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// imageJobConditions cập nhật condition Ready và Processing theo phase,
+// giữ lastTransitionTime khi giá trị không đổi
+func imageJobConditions(previous []imageJobCondition, status imageJobStatus, reason, message string) []imageJobCondition {
+	values := map[string]bool{
+		"Ready":      status.Phase == imageJobSucceeded,
+		"Processing": status.Phase == imageJobRunning,
+	}
+	now := time.Now().UTC()
+	conditions := make([]imageJobCondition, 0, len(values))
+	for _, kind := range []string{"Ready", "Processing"} {
+		value := "False"
+		if values[kind] {
+			value = "True"
+		}
+		cond := imageJobCondition{
+			Type: kind, Status: value, Reason: reason, Message: message,
+			ObservedGeneration: status.ObservedGeneration, LastTransitionTime: now,
+		}
+		for _, prev := range previous {
+			if prev.Type == kind && prev.Status == value {
+				cond.LastTransitionTime = prev.LastTransitionTime
+			}
+		}
+		conditions = append(conditions, cond)
+	}
+	return conditions
+}
+
+// --- Chuyển spec thành JobMessage, tải ảnh về thư mục upload như API ---
+func imageJobMessage(ctx context.Context, jobID string, spec imageJobSpec) (messaging.JobMessage, error) {
+	msg := messaging.JobMessage{
+		JobID:         jobID,
+		JobType:       messaging.JobTypeImage,
+		EmbedImage:    spec.EmbedImage,
+		TargetLang:    spec.TargetLang,
+		Glossary:      spec.Glossary,
+		GlossaryTerms: spec.GlossaryTerms,
+		FramePolicy:   spec.FramePolicy,
+		DPI:           spec.DPI,
+		Regions:       spec.Regions,
+		OCRMode:       spec.OCRMode,
+	}
+	if spec.OCRMode == "printed" {
+		msg.OCRMode = messaging.OCRModePrinted
+	}
+	if spec.Image == "" {
+		return msg, fmt.Errorf("spec.image is required")
+	}
+	var err error
+	msg.ImagePath, err = fetchImageJobInput(ctx, jobID, spec.Image)
+	if err != nil {
+		return msg, err
+	}
+
+	// PDF có sẵn lớp văn bản -> dịch trực tiếp, không OCR (cùng giới hạn như API)
+	header := make([]byte, 5)
+	if f, err := os.Open(msg.ImagePath); err == nil {
+		io.ReadFull(f, header)
+		f.Close()
+	}
+	if string(header) == "%PDF-" {
+		msg.JobType = messaging.JobTypePDFText
+		if msg.EmbedImage != "" || len(msg.Regions) > 0 || msg.OCRMode != messaging.OCRModePrinted {
+			os.Remove(msg.ImagePath)
+			return msg, fmt.Errorf("embedImage, regions and ocrMode are not supported for PDF input")
+		}
+	}
+	return msg, nil
+}
+
+// fetchImageJobInput tải ảnh từ URL http(s) hoặc từ storage vào thư mục upload
+func fetchImageJobInput(ctx context.Context, jobID, image string) (string, error) {
+	var src io.ReadCloser
+	name := path.Base(image)
+	if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		u, err := url.Parse(image)
+		if err != nil {
+			return "", fmt.Errorf("invalid image URL: %w", err)
+		}
+		name = path.Base(u.Path)
+		req, err := http.NewRequestWithContext(ctx, "GET", image, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := (&http.Client{Timeout: 2 * time.Minute}).Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to download image: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("failed to download image: %s", resp.Status)
+		}
+		src = resp.Body
+	} else {
+		r, err := artifacts.Open(ctx, image)
+		if err != nil {
+			return "", fmt.Errorf("failed to open image %s from storage: %w", image, err)
+		}
+		src = r
+	}
+	defer src.Close()
+
+	if name == "" || name == "." || name == "/" {
+		name = "image"
+	}
+	if err := os.MkdirAll(cfg.UploadDir(), os.ModePerm); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(cfg.UploadDir(), fmt.Sprintf("%s-%s", jobID, filepath.Base(name)))
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, io.LimitReader(src, maxImageJobInput+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxImageJobInput {
+		err = fmt.Errorf("image is larger than %d bytes", maxImageJobInput)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// --- Lưu hOCR/ALTO của từng trang (ocr_formats), không có định dạng nào thì bỏ qua ---
+// Mỗi định dạng lưu trong Redis ({jobID}:ocr_hocr, {jobID}:ocr_alto) dưới dạng JSON
+// mảng tài liệu theo trang để API trả về từng trang
+func saveJobFormats(ctx context.Context, jobID, cacheKey string, formats map[string][]string) error {
+	for format, pages := range formats {
+		data, err := json.Marshal(pages)
+		if err != nil {
+			return err
+		}
+		if err := redisClient.Set(ctx, fmt.Sprintf("%s:ocr_%s", jobID, format), data, jobTTL).Err(); err != nil {
+			return err
+		}
+		if err := resultCache.Set(ctx, fmt.Sprintf("%s:ocr_%s", cacheKey, format), string(data), cacheTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
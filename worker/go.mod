@@ -2,11 +2,16 @@ module github.com/mxngoc2104/KTPM-CS2/worker
 
 go 1.24.2
 
-require github.com/segmentio/kafka-go v0.4.47
+require (
+	github.com/alicebob/miniredis/v2 v2.35.0
+	github.com/google/uuid v1.6.0
+	github.com/segmentio/kafka-go v0.4.47
+)
 
 require (
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/stretchr/testify v1.10.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/net v0.38.0 // indirect
 )
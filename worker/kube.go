@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Thư mục service account được Kubernetes mount vào pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	errKubeNotFound = errors.New("kubernetes resource not found")
+	errKubeConflict = errors.New("kubernetes resource was modified concurrently")
+)
+
+// --- Client REST tối giản cho Kubernetes API server (không cần client-go) ---
+// Trong cluster: dùng token và CA của service account. Ngoài cluster (phát triển):
+// KUBE_API_URL trỏ tới `kubectl proxy`, ví dụ http://127.0.0.1:8001
+type kubeClient struct {
+	baseURL   string
+	tokenFile string // Đọc lại ở mỗi request vì token được xoay vòng định kỳ
+	client    *http.Client
+}
+
+func newKubeClient() (*kubeClient, error) {
+	if url := os.Getenv("KUBE_API_URL"); url != "" {
+		return &kubeClient{baseURL: strings.TrimRight(url, "/"), client: &http.Client{}}, nil
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster (set KUBE_API_URL to use kubectl proxy)")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid service account CA certificate")
+	}
+	return &kubeClient{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountDir + "/token",
+		client:    &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}, nil
+}
+
+// podNamespace trả về namespace của pod đang chạy, rỗng nếu chạy ngoài cluster
+func podNamespace() string {
+	data, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// do gửi request tới API server. Request watch không có timeout phía client
+// (server đóng stream sau timeoutSeconds), các request khác tối đa 30 giây.
+func (k *kubeClient) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	if !strings.Contains(path, "watch=true") {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		resp, err := k.send(ctx, method, path, contentType, body)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		// Đọc hết body trước khi hủy context
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+	return k.send(ctx, method, path, contentType, body)
+}
+
+func (k *kubeClient) send(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if k.tokenFile != "" {
+		token, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes %s %s failed: %w", method, path, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errKubeNotFound
+	case resp.StatusCode == http.StatusConflict:
+		resp.Body.Close()
+		return nil, errKubeConflict
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("kubernetes %s %s returned %s: %s", method, path, resp.Status, string(msg))
+	}
+	return resp, nil
+}
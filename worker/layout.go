@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+)
+
+// --- OCR với phân tích bố cục (OCR_LAYOUT) ---
+// Engine đã được kiểm tra hỗ trợ LayoutEngine khi khởi động
+func recognizeLayout(ctx context.Context, engine ocr.Engine, imagePath string, osd *ocr.Detection) (*ocr.Layout, *ocr.Detection, error) {
+	layoutEngine := engine.(ocr.LayoutEngine)
+	if detectLanguage {
+		return ocr.DetectAndRecognizeLayout(ctx, layoutEngine, imagePath, osd)
+	}
+	layout, err := layoutEngine.ImageToLayout(ctx, imagePath, nil)
+	return layout, nil, err
+}
+
+// --- Thông tin bố cục trả về trong status ---
+func setLayoutDetails(details map[string]string, layouts []*ocr.Layout) {
+	regions, tables, columns := 0, 0, 0
+	for _, layout := range layouts {
+		regions += len(layout.Regions)
+		tables += layout.Tables()
+		columns = max(columns, layout.Columns)
+	}
+	details["layout_regions"] = strconv.Itoa(regions)
+	details["layout_tables"] = strconv.Itoa(tables)
+	details["layout_columns"] = strconv.Itoa(columns)
+}
+
+// --- Dịch từng vùng của các bố cục (mọi trang), bảng được dịch theo từng ô ---
+// Ô không có chữ (số, giá tiền) và vùng trống giữ nguyên. Các vùng và ô được gửi
+// theo lô (translator.TranslateBatch) thay vì mỗi ô một request.
+func translateLayouts(layouts []*ocr.Layout, sourceLang, targetLang string, opts translator.Options) ([]*ocr.Layout, translator.Usage, error) {
+	var segments []string
+	var targets []*string // Vị trí ghi bản dịch của từng đoạn
+	translated := make([]*ocr.Layout, len(layouts))
+	for p, layout := range layouts {
+		translated[p] = &ocr.Layout{Regions: make([]ocr.Region, len(layout.Regions)), Columns: layout.Columns}
+		for i, region := range layout.Regions {
+			out := &translated[p].Regions[i]
+			*out = region
+			if region.Kind == ocr.RegionTable {
+				out.Rows = make([][]string, len(region.Rows))
+				for r, row := range region.Rows {
+					out.Rows[r] = slices.Clone(row)
+					for c, cell := range row {
+						if strings.IndexFunc(cell, unicode.IsLetter) >= 0 {
+							segments, targets = append(segments, cell), append(targets, &out.Rows[r][c])
+						}
+					}
+				}
+			} else if strings.TrimSpace(region.Text) != "" {
+				segments, targets = append(segments, region.Text), append(targets, &out.Text)
+			}
+		}
+	}
+	texts, cost, err := translator.TranslateBatchUsage(segments, sourceLang, targetLang, opts)
+	if err != nil {
+		return nil, cost, err
+	}
+	for i, text := range texts {
+		*targets[i] = text
+	}
+	return translated, cost, nil
+}
+
+// --- Chuyển bố cục đã dịch thành trang PDF có cấu trúc ---
+func layoutPage(layout *ocr.Layout) pdf.Page {
+	page := pdf.Page{Regions: make([]pdf.Region, len(layout.Regions))}
+	for i, region := range layout.Regions {
+		kind := pdf.RegionText
+		if region.Kind == ocr.RegionTable {
+			kind = pdf.RegionTable
+		}
+		page.Regions[i] = pdf.Region{Kind: kind, Text: region.Text, Rows: region.Rows}
+	}
+	return page
+}
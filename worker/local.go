@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/fleet"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// LocalOptions là tùy chọn của job chạy bằng imgproc process (giống form upload)
+type LocalOptions struct {
+	TargetLang     string
+	FramePolicy    string
+	EmbedImage     string
+	DPI            int
+	DetectLanguage bool // OCR_LANGUAGE_DETECTION
+}
+
+// LocalResult là kết quả của job chạy bằng imgproc process
+type LocalResult struct {
+	Details        map[string]string // Thông tin chi tiết của job (các bước, thời gian, ngôn ngữ...)
+	TranslatedText string            // Các trang cách nhau bởi pdf.PageBreak
+}
+
+// --- imgproc process: chạy pipeline của worker cho một ảnh ngay trong tiến trình ---
+// Các bước giống hệt worker (PIPELINE_DEFINITION, OCR_CLEANUP, OCR_LAYOUT, BARCODE_DETECTION...),
+// trạng thái job, checkpoint và kết quả từng bước nằm trong Redis trong bộ nhớ nên không cần
+// Redis, Kafka hay API. PDF được ghi ra output, log khởi tạo ghi vào logOut.
+func ProcessLocal(c config.Config, input, output string, opts LocalOptions, logOut io.Writer) (*LocalResult, error) {
+	cfg = c
+	mr, err := miniredis.Run()
+	if err != nil {
+		return nil, err
+	}
+	defer mr.Close()
+	redisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+	jobStore = model.NewStore(redisClient, jobTTL)
+	resultCache = cache.NewRedisCache(redisClient, "")
+	fleetTracker = fleet.NewTracker("local", 1)
+
+	closeStages, err := setupPipeline(logOut)
+	defer closeStages()
+	if err != nil {
+		return nil, err
+	}
+	detectLanguage = opts.DetectLanguage
+	return processLocal(context.Background(), input, output, opts)
+}
+
+// Ảnh được chép vào thư mục tạm để frame, ảnh đã lọc và artifact không nằm cạnh input
+func processLocal(ctx context.Context, input, output string, opts LocalOptions) (*LocalResult, error) {
+	dir, err := os.MkdirTemp("", "imgproc-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	artifacts = storage.NewFileStorage(filepath.Join(dir, "output"))
+	imagePath := filepath.Join(dir, filepath.Base(input))
+	if err := copyFile(input, imagePath); err != nil {
+		return nil, err
+	}
+
+	job := messaging.JobMessage{
+		JobID:       uuid.New().String(),
+		ImagePath:   imagePath,
+		TargetLang:  opts.TargetLang,
+		FramePolicy: opts.FramePolicy,
+		EmbedImage:  opts.EmbedImage,
+		DPI:         opts.DPI,
+	}
+	details, err := processImage(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	result, err := jobStore.Load(ctx, job.JobID)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveLocalPDF(ctx, result.PDFPath, output); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	translated, err := redisClient.Get(ctx, job.JobID+":translated_text").Result()
+	if err != nil {
+		return nil, err
+	}
+	return &LocalResult{Details: details, TranslatedText: translated}, nil
+}
+
+// Chép PDF từ storage tạm ra file output
+func saveLocalPDF(ctx context.Context, key, output string) error {
+	r, err := artifacts.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+)
+
+// TestProcessLocal chạy imgproc process với engine OCR giả (OCR_ENGINE=remote) và
+// translator dictionary: làm sạch OCR_CLEANUP phải được áp dụng như trên worker
+func TestProcessLocal(t *testing.T) {
+	ocrServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/capabilities":
+			w.Write([]byte(`{"languages":["eng"]}`))
+		case "/ocr":
+			json.NewEncoder(w).Encode(map[string]string{"text": "total   invoice"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ocrServer.Close()
+
+	dir := t.TempDir()
+	dictionary := filepath.Join(dir, "dictionary.json")
+	if err := os.WriteFile(dictionary, []byte(`{"vi": {"invoice": "hóa đơn", "total": "tổng"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OCR_ENGINE", "remote")
+	t.Setenv("OCR_REMOTE_URL", ocrServer.URL)
+	t.Setenv("TRANSLATOR", "dictionary")
+	t.Setenv("TRANSLATOR_DICTIONARY", dictionary)
+	t.Setenv("OCR_CLEANUP", "whitespace")
+
+	img := image.NewGray(image.Rect(0, 0, 64, 32))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	img.Set(10, 10, color.Black)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "scan.png")
+	if err := os.WriteFile(input, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "scan.pdf")
+
+	result, err := ProcessLocal(config.Config{OutputDir: dir}, input, output, LocalOptions{TargetLang: "vi"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TranslatedText != "tổng hóa đơn" {
+		t.Errorf("translated text = %q, want the cleaned OCR text translated", result.TranslatedText)
+	}
+	if stages := result.Details["pipeline_stages"]; !strings.Contains(stages, "cleanup") || !strings.Contains(stages, "pdf") {
+		t.Errorf("pipeline stages = %q, want the stages of the worker", stages)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		t.Errorf("output is not a PDF: %q", data[:min(len(data), 16)])
+	}
+}
@@ -1,43 +1,62 @@
-package main
+// Package worker consumes jobs from Kafka or NATS JetStream (or ImageJob
+// resources in controller mode) and runs the OCR, translation and PDF pipeline. It is
+// started by `imgproc worker`.
+package worker
 
 import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/segmentio/kafka-go"
 
+	"github.com/mxngoc2104/KTPM-CS2/pkg/autoscale"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/broker"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/config"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/events"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/fleet"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/httpserver"
 	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/lineage"
 	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/notify"
 	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
 	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pipeline"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/speech"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/tenant"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/textclean"
 	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
 	// Thêm để xử lý đường dẫn file PDF
 )
 
-// TODO: Di chuyển cấu hình ra nơi khác
 const (
-	kafkaBroker  = "localhost:9092"
-	kafkaTopic   = "image_processing_jobs"
-	kafkaGroupID = "image-processor-group" // Consumer group ID
-	redisAddr    = "localhost:6379"
-	pdfDir       = "../output/pdfs"             // Thư mục lưu PDF (cần khớp với API)
-	fontPath     = "../font/Roboto-Regular.ttf" // Đường dẫn font (cần khớp với logic PDF)
 	jobTTL       = time.Hour * 24
 	cacheTTL     = time.Hour * 24 * 7 // Thời gian cache hash ảnh (7 ngày)
+	capsCacheTTL = time.Hour * 24     // Cache thông tin engine OCR (ngôn ngữ, giới hạn) trong cfg.CacheDir()
+	eventTimeout = 10 * time.Second   // Thời gian tối đa để gửi event tới các sink
 )
 
+// Số sửa đổi tối đa của bước làm sạch (sửa chính tả) lưu trong chi tiết job
+const maxReportedChanges = 100
+
 // TODO: Di chuyển struct này vào package chung pkg/messaging hoặc tương tự
 /*
 type JobMessage struct {
@@ -47,7 +66,54 @@ type JobMessage struct {
 */
 
 var (
+	cfg         config.Config // Redis, Kafka, thư mục output (dùng chung với API)
 	redisClient *redis.Client
+	jobStore    *model.Store     // Trạng thái và thông tin chi tiết của job (dùng chung với API)
+	resultCache cache.Cache      // Cache hash ảnh -> PDF và văn bản (CACHE_BACKEND: redis, memory, tiered, memcached, disk)
+	artifacts   storage.Storage  // Nơi lưu PDF kết quả (STORAGE_BACKEND: file, s3)
+	pdfTemplate *pdf.Template    // Template PDF của deployment (nil: không header/footer)
+	pdfFonts                     = pdf.DefaultFontRegistry()
+	ocrEngine   ocr.Engine       = &ocr.TesseractEngine{}
+	eventRouter *events.Router   = &events.Router{}   // Gửi event job hoàn tất/thất bại tới các sink (EVENT_SINKS)
+	notifier    *notify.Notifier = &notify.Notifier{} // Báo job thất bại lên Slack/Teams/webhook (NOTIFICATIONS)
+	// Gộp các lần OCR đồng thời của cùng một ảnh (cùng nội dung, cùng chế độ)
+	ocrFlight ocr.Flight
+	// Phát hiện ngôn ngữ/script trước khi OCR (OCR_LANGUAGE_DETECTION=true)
+	detectLanguage, _ = strconv.ParseBool(os.Getenv("OCR_LANGUAGE_DETECTION"))
+	// Xoay ảnh về đúng chiều và chỉnh nghiêng trước khi OCR (AUTO_ORIENT=true)
+	autoOrient, _ = strconv.ParseBool(os.Getenv("AUTO_ORIENT"))
+	// Phân tích bố cục (cột, bảng, thứ tự đọc) thay vì OCR cả trang thành một khối (OCR_LAYOUT=true)
+	layoutAnalysis, _ = strconv.ParseBool(os.Getenv("OCR_LAYOUT"))
+	// Giữ xuống dòng, gạch đầu dòng và tiêu đề của văn bản OCR qua bước dịch (TRANSLATE_MARKUP=true)
+	markupTranslation, _ = strconv.ParseBool(os.Getenv("TRANSLATE_MARKUP"))
+	// Nhận diện ngôn ngữ từng đoạn trước khi dịch (TRANSLATE_LANGUAGE_DETECTION=true): đoạn đã ở
+	// ngôn ngữ đích giữ nguyên, trang nhiều ngôn ngữ được dịch theo ngôn ngữ của từng đoạn
+	paragraphDetection, _ = strconv.ParseBool(os.Getenv("TRANSLATE_LANGUAGE_DETECTION"))
+	// Tìm và giải mã barcode/QR code của mọi ảnh bằng zbarimg (BARCODE_DETECTION=true),
+	// job cũng có thể yêu cầu riêng (barcodes=true khi upload)
+	barcodeDetection, _ = strconv.ParseBool(os.Getenv("BARCODE_DETECTION"))
+	// Tóm tắt bản dịch của mọi job (SUMMARIZATION=true), job cũng có thể yêu cầu riêng
+	// (summarize=true khi upload); SUMMARY_COVER=true in tóm tắt trên trang bìa của PDF
+	summarization, _ = strconv.ParseBool(os.Getenv("SUMMARIZATION"))
+	summaryCover, _  = strconv.ParseBool(os.Getenv("SUMMARY_COVER"))
+	// Backend tóm tắt (SUMMARIZER): extractive (cục bộ) hoặc openai (endpoint tương thích OpenAI)
+	summarizer translator.Summarizer
+	// Đọc bản dịch thành MP3 cho output audio (TTS_ENGINE); nil: không hỗ trợ trên worker này
+	speechSynthesizer speech.Synthesizer
+	// Số đoạn của một job được dịch song song (TRANSLATE_PARALLEL), 1: các trang gửi theo lô
+	translateParallel = 1
+	// Cách chọn DPI cho OCR (OCR_DPI, OCR_DPI_MIN, OCR_DPI_MAX)
+	dpiConfig = imagefilter.DefaultDPIConfig()
+	// Kích thước và chất lượng thumbnail của ảnh upload (THUMBNAIL_MAX_WIDTH, THUMBNAIL_MAX_HEIGHT, THUMBNAIL_QUALITY)
+	thumbnailConfig = imagefilter.DefaultThumbnailConfig()
+	// Chuyển ảnh HEIC/WebP sang PNG bằng heif-convert và dwebp (HEIF_CONVERT_PATH, DWEBP_PATH)
+	imageConverter imagefilter.Converter
+	// Các bước làm sạch văn bản OCR trước khi dịch (OCR_CLEANUP), rỗng: không làm sạch
+	textCleanup textclean.Pipeline
+	// Job đang xử lý và số job đã xong, gửi lên Redis làm heartbeat (GET /api/admin/workers)
+	fleetTracker *fleet.Tracker
+	// Engine cho chữ viết tay (HANDWRITING_ENGINE), dùng với job ocr_mode=handwriting; nil: không hỗ trợ
+	handwritingEngine ocr.Engine
 )
 
 // --- Hàm tính SHA256 hash của file ---
@@ -66,29 +132,133 @@ func calculateFileHash(filePath string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func main() {
-	// --- Khởi tạo Redis Client ---
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: redisAddr,
-		DB:   0,
-	})
-	ctxRedis, cancelRedis := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelRedis()
-	_, err := redisClient.Ping(ctxRedis).Result()
+// Run khởi tạo worker và xử lý job cho tới khi nhận SIGINT/SIGTERM
+func Run(c config.Config) {
+	cfg = c
+	// Profiler (pprof) của worker (ADMIN_ADDR)
+	httpserver.StartAdmin(cfg.AdminAddr)
+
+	// --- Khởi tạo Redis Client: retry/backoff, timeout và pool theo REDIS_* (pkg/cache) ---
+	redisConfig, err := cache.RedisConfigFromEnv(cfg.RedisAddr)
 	if err != nil {
+		log.Fatalf("WORKER: Invalid Redis configuration: %v", err)
+	}
+	if threshold, err := time.ParseDuration(os.Getenv("REDIS_SLOW_LOG")); err == nil {
+		redisConfig.Observer = cache.SlowCommandLogger("WORKER: ", threshold)
+	}
+	redisClient = cache.NewRedisClient(redisConfig)
+	ctxRedis, cancelRedis := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelRedis()
+	if err := cache.WaitForRedis(ctxRedis, redisClient); err != nil {
 		log.Fatalf("WORKER: Could not connect to Redis: %v", err)
 	}
+	// Log khi mất/có lại kết nối Redis giữa các job
+	cache.NewRedisHealth(redisClient).Start(context.Background(), 30*time.Second)
+	jobStore = model.NewStore(redisClient, jobTTL)
 	fmt.Println("WORKER: Connected to Redis")
 
-	// --- Khởi tạo Kafka Reader (Consumer) ---
-	kReader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  []string{kafkaBroker},
-		GroupID:  kafkaGroupID,
-		Topic:    kafkaTopic,
-		MinBytes: 10e3, // 10KB
-		MaxBytes: 10e6, // 10MB
+	resultCache, err = cache.New(os.Getenv("CACHE_BACKEND"), redisClient)
+	if err != nil {
+		log.Fatalf("WORKER: %v", err)
+	}
+	if v := os.Getenv("NEGATIVE_CACHE_TTL"); v != "" {
+		negativeCacheTTL, err = time.ParseDuration(v)
+		if err != nil || negativeCacheTTL < 0 {
+			log.Fatalf("WORKER: NEGATIVE_CACHE_TTL must be a duration such as 10m (0 disables it), got %q", v)
+		}
+	}
+	// Nén văn bản OCR/bản dịch lớn trước khi lưu cache (CACHE_COMPRESSION: gzip, zstd)
+	resultCache, err = cache.CompressionFromEnv(resultCache)
+	if err != nil {
+		log.Fatalf("WORKER: %v", err)
+	}
+	fmt.Printf("WORKER: Using '%s' result cache\n", resultCache.Name())
+
+	artifacts, err = storage.FromEnv(cfg.OutputDir)
+	if err != nil {
+		log.Fatalf("WORKER: %v", err)
+	}
+	fmt.Printf("WORKER: Using '%s' artifact storage\n", artifacts.Name())
+
+	closeStages, err := setupPipeline(os.Stdout)
+	defer closeStages()
+	if err != nil {
+		log.Fatalf("WORKER: %v", err)
+	}
+
+	// --- Khởi tạo event sink (Kafka, RabbitMQ, webhook, file log) ---
+	// EVENT_SINKS trỏ tới file JSON khai báo các sink và loại event gửi tới từng sink
+	if sinksPath := os.Getenv("EVENT_SINKS"); sinksPath != "" {
+		sinksConfig, err := events.LoadConfig(sinksPath)
+		if err != nil {
+			log.Fatalf("WORKER: %v", err)
+		}
+		eventRouter, err = events.NewRouter(sinksConfig)
+		if err != nil {
+			log.Fatalf("WORKER: %v", err)
+		}
+		fmt.Printf("WORKER: Publishing job events to %d sink(s)\n", eventRouter.Len())
+	}
+	defer eventRouter.Close()
+
+	// --- Thông báo job thất bại tới Slack, Teams, webhook ---
+	// NOTIFICATIONS trỏ tới file JSON khai báo các kênh, loại thông báo và mức độ tối thiểu của từng kênh
+	notifier, err = notify.FromEnv()
+	if err != nil {
+		log.Fatalf("WORKER: %v", err)
+	}
+	if notifier.Len() > 0 {
+		fmt.Printf("WORKER: Sending notifications to %d channel(s)\n", notifier.Len())
+	}
+
+	// --- Số job xử lý song song (WORKER_CONCURRENCY), mỗi job một consumer riêng ---
+	concurrency := 1
+	if v := os.Getenv("WORKER_CONCURRENCY"); v != "" {
+		concurrency, err = strconv.Atoi(v)
+		if err != nil || concurrency < 1 {
+			log.Fatalf("WORKER: WORKER_CONCURRENCY must be at least 1, got %q", v)
+		}
+	}
+	// WORKER_MAX_CONCURRENCY thay WORKER_CONCURRENCY: số job song song tự điều chỉnh theo hàng đợi
+	autoscaleConfig, autoscaleEnabled, err := autoscale.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("WORKER: %v", err)
+	}
+	if autoscaleEnabled {
+		concurrency = autoscaleConfig.MinConcurrency
+	}
+
+	// --- Heartbeat của worker (hostname, job đang xử lý theo bước, số job đã xong) ---
+	// Controller mode xử lý lần lượt từng job
+	mode := broker.BrokerKafka
+	if name := os.Getenv("BROKER"); name != "" {
+		mode = name
+	}
+	if os.Getenv("WORKER_MODE") == "controller" {
+		mode = "controller"
+		concurrency = 1
+	}
+	fleetTracker = fleet.NewTracker(mode, concurrency)
+	jobStore = jobStore.WithActor("worker:" + fleetTracker.ID()) // Worker ghi trong lịch sử của job
+	ctxFleet, cancelFleet := context.WithCancel(context.Background())
+	go fleetTracker.Run(ctxFleet, redisClient, func(err error) {
+		log.Printf("WORKER: Failed to publish heartbeat: %v", err)
 	})
-	fmt.Printf("WORKER: Kafka reader configured for topic '%s', group '%s'\n", kafkaTopic, kafkaGroupID)
+	defer func() {
+		cancelFleet()
+		ctxDeregister, cancelDeregister := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelDeregister()
+		if err := fleetTracker.Deregister(ctxDeregister, redisClient); err != nil {
+			log.Printf("WORKER: Failed to deregister worker %s: %v", fleetTracker.ID(), err)
+		}
+	}()
+	fmt.Printf("WORKER: Publishing heartbeats as worker '%s'\n", fleetTracker.ID())
+
+	// --- Controller mode: xử lý ImageJob custom resource của Kubernetes thay vì broker ---
+	if mode == "controller" {
+		runController()
+		return
+	}
 
 	// --- Xử lý tín hiệu OS để dừng worker một cách an toàn ---
 	signals := make(chan os.Signal, 1)
@@ -98,102 +268,888 @@ func main() {
 	go func() {
 		<-signals
 		fmt.Println("\nWORKER: Received termination signal, shutting down...")
-		cancelWorker() // Hủy context để dừng vòng lặp đọc Kafka
-		if err := kReader.Close(); err != nil {
-			log.Printf("WORKER: Failed to close Kafka reader: %v", err)
-		}
+		cancelWorker() // Hủy context để dừng các vòng lặp đọc message
 	}()
 
-	// --- Vòng lặp đọc message từ Kafka ---
-	fmt.Println("WORKER: Starting message consumption loop...")
-	for {
-		// Sử dụng context của worker để có thể dừng vòng lặp từ bên ngoài
-		m, err := kReader.ReadMessage(ctxWorker)
-		if err != nil {
-			if ctxWorker.Err() != nil {
-				// Context bị hủy (worker đang dừng), thoát vòng lặp
-				break
+	priority, err := startPriorityConsumers(ctxWorker)
+	if err != nil {
+		log.Fatalf("WORKER: Failed to set up the priority lane of the message broker: %v", err)
+	}
+
+	// --- Vòng lặp đọc message từ broker, một vòng lặp cho mỗi consumer ---
+	if autoscaleEnabled {
+		runAutoscaled(ctxWorker, autoscaleConfig)
+	} else {
+		runConsumers(ctxWorker, concurrency)
+	}
+	if priority != nil {
+		priority.wait()
+	}
+
+	fmt.Println("WORKER: Shut down complete.")
+}
+
+// --- Khởi tạo các bước của pipeline từ biến môi trường (template và font PDF, engine OCR,
+// làm sạch, dịch, tóm tắt...), dùng chung cho worker và imgproc process ---
+// Hàm trả về giải phóng tài nguyên (pool OCR), cả khi có lỗi; thông báo khởi tạo ghi vào out
+func setupPipeline(out io.Writer) (func(), error) {
+	var closers []func()
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+	var err error
+	// --- Tải template PDF (header/footer/logo/cover) ---
+	// PDF_TEMPLATE=default dùng template mặc định, hoặc đường dẫn tới file JSON
+	if tmplPath := os.Getenv("PDF_TEMPLATE"); tmplPath != "" {
+		tmpl := pdf.DefaultTemplate()
+		if tmplPath != "default" {
+			tmpl, err = pdf.LoadTemplate(tmplPath)
+			if err != nil {
+				return closeAll, err
 			}
-			// Lỗi khác khi đọc message
-			log.Printf("WORKER: Error reading message: %v", err)
-			continue // Bỏ qua message lỗi và thử đọc message tiếp theo
 		}
+		pdfTemplate = &tmpl
+		fmt.Fprintf(out, "WORKER: Using PDF template '%s'\n", tmplPath)
+	}
 
-		fmt.Printf("WORKER: Received message at offset %d: %s = %s\n", m.Offset, string(m.Key), string(m.Value))
+	// --- Tải font registry (font theo script: CJK, Arabic, Devanagari, ...) ---
+	// PDF_FONTS trỏ tới file JSON, PDF_FONT_DIR chỉ đổi thư mục font mặc định
+	if fontsPath := os.Getenv("PDF_FONTS"); fontsPath != "" {
+		fonts, err := pdf.LoadFontRegistry(fontsPath)
+		if fonts == nil {
+			return closeAll, err
+		}
+		pdfFonts = fonts
+		fmt.Fprintf(out, "WORKER: Using font registry '%s'\n", fontsPath)
+	} else if fontDir := os.Getenv("PDF_FONT_DIR"); fontDir != "" {
+		pdfFonts.Dir = fontDir
+	}
+	// Thiếu thư mục hoặc file font không chặn worker khởi động: dùng font dựng sẵn
+	// trong binary, chỉ văn bản chữ Latin (kể cả tiếng Việt) tạo được PDF
+	if err := pdfFonts.Validate(); err != nil {
+		fmt.Fprintf(out, "WORKER: Warning: %v; using the built-in font (Latin text only)\n", err)
+		pdfFonts = pdf.BuiltinFontRegistry()
+	}
 
-		var job messaging.JobMessage // Sử dụng struct từ package messaging
-		if err := json.Unmarshal(m.Value, &job); err != nil {
-			log.Printf("WORKER: Error unmarshaling message for key %s: %v. Skipping.", string(m.Key), err)
-			// Commit message lỗi để không xử lý lại
-			if err := kReader.CommitMessages(ctxWorker, m); err != nil {
-				log.Printf("WORKER: failed to commit message offset %d: %v", m.Offset, err)
+	// --- Khởi tạo và pre-warm engine OCR ---
+	// OCR_ENGINE=remote dùng dịch vụ OCR qua HTTP (OCR_REMOTE_URL, OCR_REMOTE_API_KEY)
+	// OCR_ENGINE=pool giữ sẵn OCR_POOL_SIZE tiến trình OCR server (OCR_POOL_COMMAND); chỉ nhanh
+	// hơn khi server giữ engine đã nạp traineddata (imgproc ocr-server thì không); OCR_POOL_TIMEOUT cho mỗi ảnh
+	switch os.Getenv("OCR_ENGINE") {
+	case "remote":
+		ocrEngine, err = ocr.NewRemoteEngine(ocr.RemoteConfig{
+			URL:    os.Getenv("OCR_REMOTE_URL"),
+			APIKey: os.Getenv("OCR_REMOTE_API_KEY"),
+			Cache:  ocr.CapabilityCache{Dir: cfg.CacheDir(), TTL: capsCacheTTL},
+		})
+		if err != nil {
+			return closeAll, err
+		}
+	case "pool":
+		poolConfig := ocr.PoolConfig{Command: strings.Fields(os.Getenv("OCR_POOL_COMMAND"))}
+		if v := os.Getenv("OCR_POOL_SIZE"); v != "" {
+			poolConfig.Size, err = strconv.Atoi(v)
+			if err != nil || poolConfig.Size < 1 {
+				return closeAll, fmt.Errorf("OCR_POOL_SIZE must be at least 1, got %q", v)
+			}
+		}
+		if v := os.Getenv("OCR_POOL_TIMEOUT"); v != "" {
+			poolConfig.Timeout, err = time.ParseDuration(v)
+			if err != nil || poolConfig.Timeout <= 0 {
+				return closeAll, fmt.Errorf("invalid OCR_POOL_TIMEOUT %q", v)
 			}
-			continue
 		}
+		pool, err := ocr.NewPoolEngine(poolConfig)
+		if err != nil {
+			return closeAll, err
+		}
+		closers = append(closers, func() { pool.Close() })
+		ocrEngine = pool
+	}
+	ctxPrewarm, cancelPrewarm := context.WithTimeout(context.Background(), 30*time.Second)
+	caps, err := ocrEngine.Prewarm(ctxPrewarm)
+	cancelPrewarm()
+	if err != nil {
+		return closeAll, fmt.Errorf("OCR engine '%s' is not ready: %w", ocrEngine.Name(), err)
+	}
+	fmt.Fprintf(out, "WORKER: OCR engine '%s' ready (%s), languages: %v\n", caps.Engine, caps.Version, caps.Languages)
+	if _, ok := ocrEngine.(ocr.LayoutEngine); layoutAnalysis && !ok {
+		return closeAll, fmt.Errorf("OCR_LAYOUT is not supported by OCR engine '%s'", ocrEngine.Name())
+	}
 
-		fmt.Printf("WORKER: Processing job %s for image %s\n", job.JobID, job.ImagePath)
+	if barcodeDetection {
+		if err := ocr.CheckBarcodes(); err != nil {
+			return closeAll, fmt.Errorf("BARCODE_DETECTION is set but %w", err)
+		}
+	}
 
-		// Xử lý job và lấy thông tin chi tiết
-		details, processErr := processImage(ctxWorker, job.ImagePath, job.JobID)
+	// --- Engine OCR chữ viết tay (Google Vision, Azure Read, TrOCR qua HTTP) ---
+	// HANDWRITING_ENGINE=google|azure|remote, HANDWRITING_ENDPOINT, HANDWRITING_API_KEY
+	handwritingConfig := ocr.HandwritingConfigFromEnv()
+	handwritingConfig.Cache = ocr.CapabilityCache{Dir: cfg.CacheDir(), TTL: capsCacheTTL}
+	handwritingEngine, err = ocr.NewHandwritingEngine(handwritingConfig)
+	if err != nil {
+		return closeAll, err
+	}
+	if handwritingEngine != nil {
+		ctxPrewarm, cancelPrewarm := context.WithTimeout(context.Background(), 30*time.Second)
+		_, err := handwritingEngine.Prewarm(ctxPrewarm)
+		cancelPrewarm()
+		if err != nil {
+			return closeAll, fmt.Errorf("handwriting OCR engine '%s' is not ready: %w", handwritingEngine.Name(), err)
+		}
+		fmt.Fprintf(out, "WORKER: Handwriting OCR engine '%s' ready\n", handwritingEngine.Name())
+	}
 
-		if processErr != nil {
-			// Lỗi đã được log và trạng thái đã được cập nhật thành 'failed' bên trong processImage
-			log.Printf("WORKER: Job %s failed to process.", job.JobID)
-		} else {
-			// Trạng thái đã được cập nhật thành 'completed' bên trong processImage
-			// Lưu thêm thông tin chi tiết vào Redis
-			if err := saveJobDetails(ctxWorker, job.JobID, details); err != nil {
-				log.Printf("WORKER: Failed to save details for completed job %s: %v", job.JobID, err)
-			}
-			log.Printf("WORKER: Job %s processed successfully. Cached: %t", job.JobID, details["cached"] == "true")
+	dpiConfig, err = imagefilter.DPIConfigFromEnv()
+	if err != nil {
+		return closeAll, fmt.Errorf("invalid DPI configuration: %w", err)
+	}
+	thumbnailConfig, err = imagefilter.ThumbnailConfigFromEnv()
+	if err != nil {
+		return closeAll, fmt.Errorf("invalid thumbnail configuration: %w", err)
+	}
+	imageConverter, err = imagefilter.ConverterFromEnv()
+	if err != nil {
+		return closeAll, fmt.Errorf("invalid image conversion configuration: %w", err)
+	}
+	// --- Pipeline của worker (PIPELINE_DEFINITION: file JSON), job có thể gửi kèm pipeline riêng ---
+	if path := os.Getenv("PIPELINE_DEFINITION"); path != "" {
+		if pipelineDefinition, err = pipeline.Load(path); err == nil {
+			err = stageRunner.Validate(pipelineDefinition)
+		}
+		if err != nil {
+			return closeAll, fmt.Errorf("invalid pipeline definition: %w", err)
+		}
+		fmt.Fprintf(out, "WORKER: Using pipeline '%s': %s\n", pipelineDefinition.Name, strings.Join(pipelineDefinition.Names(), " -> "))
+	}
+	if err := initRenderQueues(); err != nil {
+		return closeAll, err
+	}
+	textCleanup, err = textclean.PipelineFromEnv()
+	if err != nil {
+		return closeAll, fmt.Errorf("invalid OCR cleanup configuration: %w", err)
+	}
+	if len(textCleanup) > 0 {
+		fmt.Fprintf(out, "WORKER: OCR text cleanup steps: %s\n", strings.Join(textCleanup.Names(), ", "))
+	}
+
+	// --- Chọn backend dịch ---
+	// TRANSLATOR=google (mặc định), libretranslate (dịch vụ Argos/OPUS-MT cục bộ, TRANSLATOR_URL)
+	// hoặc dictionary (TRANSLATOR_DICTIONARY); nhiều giá trị cách nhau bởi dấu phẩy được thử lần lượt
+	translatorProvider, err := translator.ProviderFromEnv()
+	if err != nil {
+		return closeAll, err
+	}
+	// TRANSLATOR_RATE_LIMIT (request/phút) và TRANSLATOR_DAILY_CHARS (ký tự/ngày) là ngân sách
+	// chung của mọi worker (token bucket trong Redis); lời gọi vượt ngân sách phải chờ
+	translatorLimiter, err := translator.LimiterFromEnv(redisClient)
+	if err != nil {
+		return closeAll, fmt.Errorf("invalid translator rate limit: %w", err)
+	}
+	if translatorLimiter != nil {
+		translatorProvider = translator.Limit(translatorProvider, translatorLimiter)
+		fmt.Fprintf(out, "WORKER: Translator rate limit: %d request(s)/minute, %d character(s)/day (0: unlimited)\n", translatorLimiter.RequestsPerMinute, translatorLimiter.CharsPerDay)
+	}
+	translator.SetProvider(translatorProvider)
+	fmt.Fprintf(out, "WORKER: Using translator '%s'\n", translatorProvider.Name())
+
+	// --- Chọn backend tóm tắt ---
+	// SUMMARIZER=extractive (mặc định, không cần model) hoặc openai (SUMMARIZER_URL, SUMMARIZER_MODEL:
+	// OpenAI hoặc model cục bộ qua Ollama, vLLM, llama.cpp); SUMMARIZER_SENTENCES: độ dài tóm tắt
+	summarizer, err = translator.SummarizerFromEnv()
+	if err != nil {
+		return closeAll, err
+	}
+	if summarization {
+		fmt.Fprintf(out, "WORKER: Summarizing every job with '%s'\n", summarizer.Name())
+	}
+
+	// --- Text-to-speech cho output audio ---
+	// TTS_ENGINE=espeak (mặc định, espeak-ng + ffmpeg cục bộ) hoặc google (TTS_API_KEY)
+	synthesizer, err := speech.FromEnv()
+	if err != nil {
+		return closeAll, err
+	}
+	if err := synthesizer.Check(); err != nil {
+		// Job yêu cầu output audio sẽ thất bại với lỗi rõ ràng
+		fmt.Fprintf(out, "WORKER: Text-to-speech '%s' is not available, audio output disabled: %v\n", synthesizer.Name(), err)
+	} else {
+		speechSynthesizer = synthesizer
+		fmt.Fprintf(out, "WORKER: Using text-to-speech '%s' for audio output\n", synthesizer.Name())
+	}
+
+	if v := os.Getenv("TRANSLATE_PARALLEL"); v != "" {
+		translateParallel, err = strconv.Atoi(v)
+		if err != nil || translateParallel < 1 {
+			return closeAll, fmt.Errorf("TRANSLATE_PARALLEL must be at least 1, got %q", v)
+		}
+	}
+	return closeAll, nil
+}
+
+// --- Xử lý một job và lưu kết quả (dùng chung cho broker và controller mode) ---
+func runJob(ctx context.Context, job messaging.JobMessage) (map[string]string, error) {
+	// Xử lý job và lấy thông tin chi tiết (panic được recover, job bị cách ly)
+	fleetTracker.StartJob(job.JobID)
+	details, processErr := processImageSafe(ctx, job)
+	if processErr == errJobCompleted {
+		// Kết quả đã có sẵn như cache hit: trả về PDF của lần xử lý trước, không ghi đè details và không gửi lại event
+		fleetTracker.FinishJob(job.JobID, nil, true)
+		log.Printf("WORKER: Job %s was already completed by another delivery, skipping.", jobLabel(job))
+		if state, err := jobStore.Load(ctx, job.JobID); err == nil {
+			details = state.Details
+			details["pdf_path"] = state.PDFPath
 		}
+		return details, nil
+	}
+	fleetTracker.FinishJob(job.JobID, processErr, details["cached"] == "true")
+	if job.RequestID != "" && details != nil {
+		// Event của job mang request ID để đối chiếu với request upload
+		details["request_id"] = job.RequestID
+	}
 
-		// Commit message sau khi xử lý
-		if err := kReader.CommitMessages(ctxWorker, m); err != nil {
-			log.Printf("WORKER: failed to commit message offset %d: %v", m.Offset, err)
+	if processErr != nil {
+		// Lỗi đã được log và trạng thái đã được cập nhật thành 'failed' bên trong processImage
+		log.Printf("WORKER: Job %s failed to process: %v", jobLabel(job), processErr)
+	} else {
+		// Trạng thái đã được cập nhật thành 'completed' bên trong processImage
+		// Lưu thêm thông tin chi tiết vào Redis
+		if err := saveJobDetails(ctx, job.JobID, details); err != nil {
+			log.Printf("WORKER: Failed to save details for completed job %s: %v", job.JobID, err)
 		}
+		log.Printf("WORKER: Job %s processed successfully. Cached: %t", jobLabel(job), details["cached"] == "true")
+	}
+	publishJobEvent(job.JobID, details, processErr)
+	if processErr != nil {
+		notifyJobFailure(job, details, processErr)
 	}
+	return details, processErr
+}
 
-	fmt.Println("WORKER: Shut down complete.")
+// --- Thông báo job thất bại tới các kênh (NOTIFICATIONS) ---
+// Panic (job bị cách ly) là lỗi của worker nên có mức critical
+func notifyJobFailure(job messaging.JobMessage, details map[string]string, processErr error) {
+	if notifier.Len() == 0 {
+		return
+	}
+	severity := notify.SeverityWarning
+	if details["quarantined"] == "true" {
+		severity = notify.SeverityCritical
+	}
+	fields := map[string]string{"job_id": job.JobID, "worker": fleetTracker.ID()}
+	if job.RequestID != "" {
+		fields["request_id"] = job.RequestID
+	}
+	if stage := details["stage"]; stage != "" {
+		fields["stage"] = stage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	n := notify.New(notify.TypeJobFailed, severity, "Job failed", processErr.Error(), fields)
+	if err := notifier.Notify(ctx, n); err != nil {
+		log.Printf("WORKER: Failed to send failure notification for job %s: %v", job.JobID, err)
+	}
+}
+
+// --- Nhãn của job trong log, kèm request ID của API để đối chiếu log giữa các service ---
+func jobLabel(job messaging.JobMessage) string {
+	if job.RequestID == "" {
+		return job.JobID // Job không tạo từ API (controller, message cũ)
+	}
+	return job.JobID + " (request " + job.RequestID + ")"
+}
+
+// --- Gửi event trạng thái cuối của job tới các sink ---
+// Không dùng context của worker để event của job cuối cùng vẫn được gửi khi worker đang dừng
+func publishJobEvent(jobID string, details map[string]string, processErr error) {
+	if eventRouter.Len() == 0 {
+		return
+	}
+	event := events.JobCompleted(jobID, details)
+	if processErr != nil {
+		event = events.JobFailed(jobID, processErr, details)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	if err := eventRouter.Publish(ctx, event); err != nil {
+		log.Printf("WORKER: Failed to publish %s event for job %s: %v", event.Type, jobID, err)
+	}
+}
+
+// --- Phát hiện góc xoay của trang bằng OSD của engine OCR ---
+// Trả về nil nếu engine không hỗ trợ, Detection rỗng (góc 0) nếu không xác định
+// được (ảnh ít chữ). Kết quả được dùng lại khi OCR để không chạy OSD lần hai.
+func detectRotation(ctx context.Context, imagePath string) *ocr.Detection {
+	langEngine, ok := ocrEngine.(ocr.LanguageEngine)
+	if !ok {
+		return nil
+	}
+	det, err := langEngine.DetectLanguage(ctx, imagePath)
+	if err != nil {
+		log.Printf("WORKER: Orientation detection failed for %s: %v", imagePath, err)
+		return &ocr.Detection{}
+	}
+	return det
+}
+
+// --- Kết quả bước lấy văn bản (OCR hoặc đọc lớp văn bản của PDF) ---
+type recognition struct {
+	pages      []string            // Văn bản từng trang
+	formats    map[string][]string // hOCR/ALTO từng trang theo định dạng (ocr_formats)
+	layouts    []*ocr.Layout       // Bố cục từng trang (OCR_LAYOUT hoặc vùng crop), nil nếu không có
+	sourceLang string              // Ngôn ngữ nguồn phát hiện được, rỗng: tiếng Anh
+	regions    []regionResult      // Văn bản từng vùng crop của request
+}
+
+// --- Lọc ảnh và OCR từng frame của ảnh ---
+// Với vùng crop, chỉ OCR các vùng đó; mỗi vùng là một vùng văn bản của bố cục trang
+func recognizeImage(ctx context.Context, job messaging.JobMessage, details map[string]string, report usage.Report) (*recognition, error) {
+	// Ảnh chụp điện thoại lưu hướng xoay trong EXIF: xoay về đúng chiều trước mọi bước
+	// (vùng crop, phát hiện hướng văn bản và OCR đều làm trên ảnh như khi hiển thị)
+	imagePath, orientation, err := imagefilter.AutoOrient(job.ImagePath)
+	if err != nil {
+		log.Printf("WORKER: Cannot apply EXIF orientation for job %s, using the image as stored: %v", job.JobID, err)
+		imagePath = job.ImagePath
+	} else if orientation != 1 {
+		details["exif_orientation"] = strconv.Itoa(orientation)
+		defer os.Remove(imagePath)
+		log.Printf("WORKER: Applied EXIF orientation %d to image of job %s", orientation, job.JobID)
+	}
+
+	// Ảnh nhiều frame (GIF động): chọn frame theo policy, mỗi frame là một trang
+	frames, err := imagefilter.ExtractFrames(imagePath, job.FramePolicy)
+	if err != nil {
+		errMsg := fmt.Sprintf("Frame extraction error: %v", err)
+		updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg)
+		return nil, permanent(errMsg, fmt.Errorf("frame extraction failed for job %s: %w", job.JobID, err))
+	}
+	defer frames.Remove()
+	if frames.Total > 1 || job.FramePolicy != "" {
+		details["frame_policy"] = frames.Policy
+		details["frames"] = strconv.Itoa(frames.Total)
+		used := make([]string, len(frames.Used))
+		for i, idx := range frames.Used {
+			used[i] = strconv.Itoa(idx)
+		}
+		details["frames_used"] = strings.Join(used, ",")
+		log.Printf("WORKER: Job %s has %d frame(s), processing %v (policy '%s')", job.JobID, frames.Total, frames.Used, frames.Policy)
+	}
+
+	// Chữ viết tay: OCR bằng engine riêng (HANDWRITING_ENGINE) thay vì Tesseract
+	if job.OCRMode == messaging.OCRModeHandwriting {
+		if handwritingEngine == nil {
+			errMsg := "Handwriting OCR is not configured on this worker (HANDWRITING_ENGINE)"
+			updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg)
+			return nil, fmt.Errorf("handwriting OCR requested for job %s but no engine is configured", job.JobID)
+		}
+		details["ocr_mode"] = job.OCRMode
+		details["ocr_engine"] = handwritingEngine.Name()
+	}
+
+	// Cấu hình OCR của job (PSM, OEM, biến Tesseract): engine phải hỗ trợ
+	var ocrConfig ocr.Config
+	if job.OCRConfig != nil {
+		ocrConfig = ocr.Config(*job.OCRConfig)
+		if _, err := ocr.WithConfig(ocrEngine, ocrConfig); err != nil {
+			errMsg := fmt.Sprintf("OCR configuration error: %v", err)
+			updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg)
+			return nil, permanent(errMsg, fmt.Errorf("OCR configuration of job %s: %w", job.JobID, err))
+		}
+		details["ocr_config"] = ocrConfig.String()
+	}
+
+	// hOCR/ALTO của từng trang (ocr_formats): engine phải xuất được tọa độ từ
+	var exportEngine ocr.ExportEngine
+	if len(job.OCRFormats) > 0 {
+		if engine, err := ocr.WithConfig(ocrEngine, ocrConfig); err == nil && job.OCRMode == messaging.OCRModePrinted {
+			exportEngine, _ = engine.(ocr.ExportEngine)
+		}
+		if exportEngine == nil || len(job.Regions) > 0 {
+			errMsg := fmt.Sprintf("OCR formats %s are not supported by OCR engine '%s' with this job", strings.Join(job.OCRFormats, ","), ocrEngine.Name())
+			updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg)
+			return nil, permanent(errMsg, fmt.Errorf("OCR formats of job %s: %s", job.JobID, errMsg))
+		}
+		details["ocr_formats"] = strings.Join(job.OCRFormats, ",")
+	}
+
+	// Độ phân giải cho OCR: theo job, OCR_DPI hoặc suy ra từ metadata/kích thước ảnh gốc
+	// (frame tách từ ảnh động không còn metadata)
+	dpi, err := dpiConfig.Resolve(job.ImagePath, job.DPI)
+	if err != nil {
+		log.Printf("WORKER: Cannot resolve DPI for job %s, letting the OCR engine estimate it: %v", job.JobID, err)
+	} else {
+		details["ocr_dpi"] = strconv.Itoa(dpi.Value)
+		details["ocr_dpi_source"] = dpi.Source
+		if dpi.Clamped {
+			details["ocr_dpi_clamped"] = "true"
+		}
+		log.Printf("WORKER: Using %d DPI (%s) for job %s", dpi.Value, dpi.Source, job.JobID)
+	}
+
+	// Vùng crop của request (nil: cả ảnh)
+	crops := []*messaging.CropRegion{nil}
+	if len(job.Regions) > 0 {
+		crops = crops[:0]
+		for i := range job.Regions {
+			crops = append(crops, &job.Regions[i])
+		}
+		details["crop_regions"] = strconv.Itoa(len(job.Regions))
+	}
+
+	var filterDuration, ocrDuration time.Duration
+	var detection *ocr.Detection // Ngôn ngữ phát hiện ở frame (vùng) đầu tiên
+	rec := &recognition{pages: make([]string, 0, len(frames.Paths)), formats: map[string][]string{}}
+	for f, framePath := range frames.Paths {
+		var osd *ocr.Detection // OSD của frame (AUTO_ORIENT), dùng lại khi OCR
+		rotationKnown := !autoOrient
+		page := &ocr.Layout{Regions: []ocr.Region{}, Columns: 1}
+		texts := make([]string, 0, len(crops))
+		for c, crop := range crops {
+			// Mốc của frame/vùng này ở lần giao trước: dùng lại ảnh đã lọc, hoặc cả văn bản OCR
+			part := fmt.Sprintf("ocr:%d.%d", f, c)
+			var checkpoint ocrCheckpoint
+			if loadCheckpoint(ctx, job.JobID, part, &checkpoint) && checkpoint.Done {
+				log.Printf("WORKER: Job %s was redelivered, reusing the OCR text of frame %d region %d", job.JobID, f, c)
+			} else {
+				if checkpoint.FilteredPath != "" {
+					if _, err := os.Stat(checkpoint.FilteredPath); err != nil {
+						checkpoint.FilteredPath = "" // Ảnh đã lọc không còn: lọc lại
+					}
+				}
+				if checkpoint.FilteredPath == "" {
+					if !rotationKnown {
+						// Tesseract OSD được tính vào bước lọc
+						osdCtx, osdMeter := usage.Start(ctx)
+						osd, rotationKnown = detectRotation(osdCtx, framePath), true
+						report.Add("filter", osdMeter.Stop())
+					}
+					// 1. Image Filtering
+					filterStartTime := time.Now()
+					enterStage(ctx, job.JobID, "filter")
+					_, filterMeter := usage.Start(ctx)
+					rotation := 0
+					if osd != nil {
+						rotation = osd.Rotate
+					}
+					filterOpts := imagefilter.Options{Rotate: rotation, Deskew: autoOrient, DPI: dpi.Value, Crop: cropRect(crop)}
+					filteredImagePath, correction, err := imagefilter.ApplyFiltersWithOptions(framePath, filterOpts)
+					filterDuration += time.Since(filterStartTime)
+					report.Add("filter", filterMeter.Stop())
+					if err != nil {
+						errMsg := fmt.Sprintf("Image filtering error: %v", err)
+						updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg)
+						return nil, permanent(errMsg, fmt.Errorf("image filtering failed for job %s: %w", job.JobID, err))
+					}
+					checkpoint.FilteredPath, checkpoint.Correction = filteredImagePath, *correction
+					saveCheckpoint(ctx, job.JobID, part, checkpoint)
+					log.Printf("WORKER: Image filtering completed for job %s. Filtered path: %s", job.JobID, filteredImagePath)
+				} else {
+					log.Printf("WORKER: Job %s was redelivered, reusing filtered image %s", job.JobID, checkpoint.FilteredPath)
+				}
+				if f == 0 && c == 0 {
+					// Ảnh đã lọc của trang (vùng) đầu tiên
+					saveArtifact(ctx, job.JobID, model.ArtifactFiltered, details, func(w io.Writer) error {
+						filtered, err := os.Open(checkpoint.FilteredPath)
+						if err != nil {
+							return err
+						}
+						defer filtered.Close()
+						_, err = io.Copy(w, filtered)
+						return err
+					})
+				}
+
+				// 2. OCR
+				ocrStartTime := time.Now()
+				enterStage(ctx, job.JobID, "ocr")
+				ocrCtx, ocrMeter := usage.Start(ctx)
+				text, layout, det, err := ocrImage(ocrCtx, checkpoint.FilteredPath, job.OCRMode, ocrConfig, osd)
+				ocrDuration += time.Since(ocrStartTime)
+				report.Add("ocr", ocrMeter.Stop())
+				if err != nil {
+					ocrErrMsg := fmt.Sprintf("OCR error: %v", err)
+					log.Printf("WORKER: Job %s failed at OCR step. Error: %s", job.JobID, ocrErrMsg)
+					updateJobStatus(ctx, job.JobID, model.StatusFailed, ocrErrMsg)
+					err = fmt.Errorf("OCR failed for job %s: %w", job.JobID, err)
+					if _, local := ocrEngine.(*ocr.TesseractEngine); local && job.OCRMode != messaging.OCRModeHandwriting {
+						// Tesseract cục bộ lỗi trên cùng ảnh là lỗi của ảnh (engine từ xa có thể lỗi tạm thời)
+						err = permanent(ocrErrMsg, err)
+					}
+					return nil, err
+				}
+				checkpoint.Text, checkpoint.Layout, checkpoint.Detection = text, layout, det
+
+				if exportEngine != nil {
+					// Cùng ảnh đã lọc và traineddata với văn bản: tọa độ theo ảnh đã lọc
+					var langs []string
+					if det != nil {
+						langs = det.Traineddata
+					}
+					exportStartTime := time.Now()
+					exportCtx, exportMeter := usage.Start(ctx)
+					documents, err := exportEngine.ImageToFormats(exportCtx, checkpoint.FilteredPath, langs, job.OCRFormats)
+					ocrDuration += time.Since(exportStartTime)
+					report.Add("ocr", exportMeter.Stop())
+					if err != nil {
+						errMsg := fmt.Sprintf("OCR export error: %v", err)
+						updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg)
+						return nil, fmt.Errorf("OCR export failed for job %s: %w", job.JobID, err)
+					}
+					checkpoint.Documents = documents
+				}
+				checkpoint.Done = true
+				saveCheckpoint(ctx, job.JobID, part, checkpoint)
+			}
+
+			if autoOrient && details["rotation"] == "" {
+				// Góc xoay của frame đầu tiên
+				details["rotation"] = strconv.Itoa(checkpoint.Correction.Rotation)
+				details["skew_deg"] = strconv.FormatFloat(checkpoint.Correction.Skew, 'f', 1, 64)
+			}
+			text, layout := checkpoint.Text, checkpoint.Layout
+			if detection == nil {
+				detection = checkpoint.Detection
+			}
+			texts = append(texts, text)
+			for format, document := range checkpoint.Documents {
+				rec.formats[format] = append(rec.formats[format], document)
+			}
+
+			switch {
+			case crop != nil:
+				if layout == nil {
+					layout = &ocr.Layout{Regions: []ocr.Region{{Kind: ocr.RegionText, Text: text}}}
+				}
+				first := len(page.Regions)
+				page.Regions = append(page.Regions, layout.Regions...)
+				rec.regions = append(rec.regions, regionResult{
+					CropRegion: *crop, Frame: frames.Used[f], Text: text,
+					page: f, first: first, last: len(page.Regions),
+				})
+			case layout != nil:
+				page = layout
+			}
+		}
+		rec.pages = append(rec.pages, strings.Join(texts, "\n\n"))
+		if layoutAnalysis || len(job.Regions) > 0 {
+			rec.layouts = append(rec.layouts, page)
+		}
+	}
+	details["filter_ms"] = strconv.FormatInt(filterDuration.Milliseconds(), 10)
+	details["ocr_ms"] = strconv.FormatInt(ocrDuration.Milliseconds(), 10)
+	if layoutAnalysis {
+		setLayoutDetails(details, rec.layouts)
+	}
+	log.Printf("WORKER: OCR completed for job %s (%v). Text length: %d", job.JobID, ocrDuration, len(strings.Join(rec.pages, "")))
+	if detection != nil {
+		rec.sourceLang = detection.Language
+		if detection.Language != "" {
+			details["source_lang"] = detection.Language
+		}
+		if detection.Script != "" {
+			details["detected_script"] = detection.Script
+		}
+		if len(detection.Traineddata) > 0 {
+			details["ocr_languages"] = strings.Join(detection.Traineddata, "+")
+		}
+		log.Printf("WORKER: Detected script '%s', language '%s' for job %s", detection.Script, detection.Language, job.JobID)
+	}
+	return rec, nil
+}
+
+// --- OCR một ảnh đã lọc theo chế độ của worker và của job ---
+// Trả về văn bản, bố cục (chỉ với OCR_LAYOUT) và ngôn ngữ phát hiện được (nếu bật)
+// Nhiều job đồng thời chứa cùng một ảnh (và cùng cấu hình OCR) chỉ chạy OCR một lần,
+// các job còn lại chờ và dùng chung kết quả (bố cục dùng chung chỉ được đọc)
+func ocrImage(ctx context.Context, imagePath, mode string, config ocr.Config, osd *ocr.Detection) (string, *ocr.Layout, *ocr.Detection, error) {
+	key, err := ocr.ImageKey(imagePath, mode, config.String())
+	if err != nil {
+		return "", nil, nil, err
+	}
+	type ocrResult struct {
+		text   string
+		layout *ocr.Layout
+		det    *ocr.Detection
+	}
+	value, shared, err := ocrFlight.Do(key, func() (any, error) {
+		text, layout, det, err := runOCR(ctx, imagePath, mode, config, osd)
+		return ocrResult{text, layout, det}, err
+	})
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if shared {
+		log.Printf("WORKER: OCR of %s shared with a concurrent job on the same image", imagePath)
+	}
+	r, ok := value.(ocrResult)
+	if !ok {
+		return "", nil, nil, fmt.Errorf("unexpected OCR result %T", value)
+	}
+	return r.text, r.layout, r.det, nil
+}
+
+// --- Chạy engine OCR phù hợp với chế độ, với cấu hình OCR của job ---
+func runOCR(ctx context.Context, imagePath, mode string, config ocr.Config, osd *ocr.Detection) (string, *ocr.Layout, *ocr.Detection, error) {
+	engine := ocrEngine
+	if mode != messaging.OCRModeHandwriting {
+		var err error
+		if engine, err = ocr.WithConfig(ocrEngine, config); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	switch {
+	case mode == messaging.OCRModeHandwriting:
+		// Engine chữ viết tay không trả về tọa độ từ: cả ảnh là một vùng văn bản,
+		// ngôn ngữ được nhận diện từ văn bản
+		text, err := handwritingEngine.ImageToText(ctx, imagePath)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		var det *ocr.Detection
+		if detectLanguage {
+			if lang, _ := ocr.DetectTextLanguage(text); lang != "" {
+				det = &ocr.Detection{Language: lang}
+			}
+		}
+		var layout *ocr.Layout
+		if layoutAnalysis {
+			layout = &ocr.Layout{Regions: []ocr.Region{{Kind: ocr.RegionText, Text: text}}, Columns: 1}
+		}
+		return text, layout, det, nil
+	case layoutAnalysis:
+		// Vùng văn bản và bảng theo thứ tự đọc
+		layout, det, err := recognizeLayout(ctx, engine, imagePath, osd)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return layout.Text(), layout, det, nil
+	case detectLanguage:
+		// Phát hiện script/ngôn ngữ trước, OCR bằng traineddata tương ứng
+		text, det, err := ocr.DetectAndRecognize(ctx, engine, imagePath, osd)
+		return text, nil, det, err
+	default:
+		text, err := engine.ImageToText(ctx, imagePath)
+		return text, nil, nil, err
+	}
 }
 
 // --- Hàm xử lý chính cho một job ---
 // Trả về map chứa thông tin chi tiết và lỗi nếu có
-func processImage(ctx context.Context, imagePath string, jobID string) (map[string]string, error) {
+func processImage(ctx context.Context, job messaging.JobMessage) (map[string]string, error) {
+	jobID, imagePath := job.JobID, job.ImagePath
 	details := make(map[string]string)
 	var err error
-
-	// Đảm bảo thư mục output/pdfs tồn tại
-	if err = os.MkdirAll(pdfDir, os.ModePerm); err != nil {
-		errMsg := fmt.Sprintf("Cannot create PDF output directory %s: %v", pdfDir, err)
-		updateJobStatus(ctx, jobID, "failed", errMsg) // Cập nhật lỗi
-		return nil, fmt.Errorf(errMsg)
+	if job.Attempt > 1 {
+		// Job được gửi lại sau khi bị treo ở lần xử lý trước
+		details["attempt"] = strconv.Itoa(job.Attempt)
 	}
 
+	// Tài nguyên dùng ở từng bước (CPU, RSS của tesseract, I/O) -> details + /api/stats
+	// Ghi cả job lỗi để tìm ra input bất thường (tốn CPU/bộ nhớ)
+	report := usage.Report{}
+	defer func() {
+		if err := usage.Record(ctx, redisClient, jobID, report); err != nil {
+			log.Printf("WORKER: Failed to record resource usage for job %s: %v", jobID, err)
+		}
+		// Ký tự OCR và ký tự đã dịch theo tenant và ngày (job cache hit không tốn ký tự dịch)
+		if err := usage.RecordCharacters(ctx, redisClient, model.TenantOf(jobID), jobCharacters(details)); err != nil {
+			log.Printf("WORKER: Failed to record character usage for job %s: %v", jobID, err)
+		}
+	}()
+
 	// --- Cache Check ---
 	imageHash, err := calculateFileHash(imagePath)
 	if err != nil {
 		errMsg := fmt.Sprintf("Failed to calculate image hash: %v", err)
-		updateJobStatus(ctx, jobID, "failed", errMsg)
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
 		return nil, fmt.Errorf("failed to calculate hash for job %s: %w", jobID, err)
 	}
+	if job.JobType == messaging.JobTypeImage {
+		// HEIC (iPhone) và WebP: chuyển sang PNG trước khi xử lý, hash (cache) vẫn tính trên file gốc
+		converted, format, err := imageConverter.ToPNG(ctx, imagePath)
+		if err != nil {
+			errMsg := fmt.Sprintf("Image conversion error: %v", err)
+			updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+			return nil, fmt.Errorf("image conversion failed for job %s: %w", jobID, err)
+		}
+		if format != "" {
+			details["input_format"] = format
+			job.ImagePath = converted
+			defer os.Remove(converted)
+			log.Printf("WORKER: Converted %s image of job %s to PNG", format, jobID)
+		}
+		// Thumbnail cho UI, tạo cả khi kết quả lấy từ cache
+		createThumbnail(ctx, job, details)
+	}
+
 	cacheKey := fmt.Sprintf("imagehash:%s", imageHash)
+	switch job.JobType {
+	case messaging.JobTypePDFText:
+		cacheKey = fmt.Sprintf("pdfhash:%s", imageHash)
+	case messaging.JobTypeText:
+		cacheKey = fmt.Sprintf("texthash:%s", imageHash)
+	}
+	if tenantID := model.TenantOf(jobID); tenantID != "" {
+		// Cache riêng của từng tenant: không trả kết quả của tenant khác
+		cacheKey = fmt.Sprintf("tenant:%s:%s", tenantID, cacheKey)
+	}
+	if job.EmbedImage != "" {
+		// PDF có nhúng ảnh gốc khác với PDF thường -> dùng cache key riêng
+		cacheKey = fmt.Sprintf("%s:embed_%s", cacheKey, job.EmbedImage)
+	}
+	targetLang := job.TargetLang
+	if targetLang == "" {
+		targetLang = translator.DefaultTargetLanguage
+	}
+	if targetLang != translator.DefaultTargetLanguage {
+		// Bản dịch sang ngôn ngữ khác -> cache key riêng
+		cacheKey = fmt.Sprintf("%s:lang_%s", cacheKey, targetLang)
+	}
+	def, err := jobPipeline(job)
+	if err != nil {
+		errMsg := fmt.Sprintf("Invalid pipeline: %v", err)
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+		return nil, fmt.Errorf("invalid pipeline for job %s: %w", jobID, err)
+	}
+	if def.Hash() != defaultPipeline.Hash() {
+		// Pipeline khác (bước, thứ tự, option) cho kết quả khác -> cache key theo định nghĩa
+		cacheKey = fmt.Sprintf("%s:pipeline_%s", cacheKey, def.Hash())
+	}
+	glossary, err := loadGlossary(ctx, job)
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to load glossary: %v", err)
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+		return nil, fmt.Errorf("failed to load glossary for job %s: %w", jobID, err)
+	}
+	if len(glossary) > 0 {
+		// Bản dịch phụ thuộc vào thuật ngữ -> cache key theo nội dung glossary
+		cacheKey = fmt.Sprintf("%s:glossary_%s", cacheKey, glossaryHash(glossary))
+	}
+	if job.FramePolicy != "" && job.FramePolicy != imagefilter.FramesFirst {
+		// Frame khác của ảnh động cho kết quả khác -> cache key riêng
+		cacheKey = fmt.Sprintf("%s:frames_%s", cacheKey, job.FramePolicy)
+	}
+	if detectLanguage {
+		// OCR bằng traineddata của script phát hiện được cho văn bản khác -> cache key riêng
+		cacheKey = fmt.Sprintf("%s:langdetect", cacheKey)
+	}
+	if autoOrient {
+		// Ảnh đã xoay/chỉnh nghiêng cho văn bản OCR khác -> cache key riêng
+		cacheKey = fmt.Sprintf("%s:orient", cacheKey)
+	}
+	if len(job.Regions) > 0 {
+		// Chỉ OCR các vùng crop -> cache key theo danh sách vùng
+		cacheKey = fmt.Sprintf("%s:regions_%s", cacheKey, regionsHash(job.Regions))
+	}
+	if job.OCRConfig != nil && job.JobType == messaging.JobTypeImage {
+		// PSM, whitelist... thay đổi kết quả OCR -> cache key theo cấu hình
+		sum := sha256.Sum256([]byte(ocr.Config(*job.OCRConfig).String()))
+		cacheKey = fmt.Sprintf("%s:ocrconfig_%s", cacheKey, hex.EncodeToString(sum[:8]))
+	}
+	if len(job.OCRFormats) > 0 && job.JobType == messaging.JobTypeImage {
+		// Kết quả cache phải có hOCR/ALTO -> cache key theo định dạng
+		cacheKey = fmt.Sprintf("%s:formats_%s", cacheKey, strings.Join(job.OCRFormats, "+"))
+	}
+	if (barcodeDetection || job.Barcodes) && job.JobType == messaging.JobTypeImage {
+		// Kết quả cache phải có barcode -> cache key riêng
+		cacheKey += ":barcodes"
+	}
+	if summarization || job.Summarize {
+		// Kết quả cache phải có tóm tắt (và PDF có trang bìa tóm tắt) -> cache key riêng
+		cacheKey = fmt.Sprintf("%s:summary_%s", cacheKey, summarizer.Name())
+		if summaryCover {
+			cacheKey += "_cover"
+		}
+	}
+	if job.DPI != 0 {
+		// DPI chỉ định theo job thay đổi kết quả OCR -> cache key riêng
+		cacheKey = fmt.Sprintf("%s:dpi_%d", cacheKey, job.DPI)
+	}
+	if layoutAnalysis && job.JobType == messaging.JobTypeImage {
+		// PDF giữ cấu trúc bảng/cột -> cache key riêng
+		cacheKey += ":layout"
+	}
+	if paragraphDetection {
+		// Đoạn đã ở ngôn ngữ đích không được dịch -> cache key riêng
+		cacheKey += ":detect"
+	}
+	if markupTranslation {
+		// Bản dịch giữ cấu trúc (đoạn, danh sách, tiêu đề) khác bản dịch thường -> cache key riêng
+		cacheKey += ":markup"
+	}
+	if len(textCleanup) > 0 && job.JobType == messaging.JobTypeImage {
+		// Văn bản OCR đã làm sạch khác văn bản thô -> cache key theo các bước
+		cacheKey = fmt.Sprintf("%s:cleanup_%s", cacheKey, strings.Join(textCleanup.Names(), "+"))
+	}
+	if job.OCRMode != messaging.OCRModePrinted {
+		// Engine chữ viết tay cho văn bản khác -> cache key riêng
+		cacheKey = fmt.Sprintf("%s:ocr_%s", cacheKey, job.OCRMode)
+	}
+	// Header/footer của template PDF ({date}) nằm trong PDF đã cache -> cache key theo
+	// template và ngày hiển thị; PDF của job được render với đúng ngày này
+	renderedAt := time.Now()
+	sharePDF := true
+	if pdfTemplate != nil {
+		cacheKey = fmt.Sprintf("%s:template_%s", cacheKey, pdfTemplate.CacheKey(renderedAt))
+		// Template có {jobID}: PDF chỉ thuộc về job tạo ra nó, không dùng chung
+		sharePDF = !pdfTemplate.PerJob()
+	}
 	log.Printf("WORKER: Calculated image hash for job %s: %s", jobID, imageHash)
+	// Hash để quản trị viên xóa kết quả đã cache của input (DELETE /api/admin/cache/entry)
+	details["image_hash"] = imageHash
 
-	cachedPdfPath, err := redisClient.Get(ctx, cacheKey).Result()
+	if job.SkipCache {
+		// Xử lý lại theo yêu cầu (POST /api/jobs/:job_id/reprocess): bỏ qua cache, kết quả mới ghi đè
+		details["cache_skipped"] = "true"
+	} else if err := checkKnownFailure(ctx, jobID, cacheKey, details); err != nil {
+		// Input đã lỗi cố định gần đây với cùng tùy chọn -> thất bại ngay
+		return details, err
+	}
+
+	cachedPdfPath, err := "", cache.ErrMiss
+	if len(job.Outputs) == 0 && !job.SkipCache && sharePDF {
+		// Cache chỉ giữ PDF bản dịch: job có output thêm luôn được xử lý
+		cachedPdfPath, err = resultCache.Get(ctx, cacheKey)
+	}
+	if err == nil && cachedPdfPath != "" {
+		// PDF đã cache có thể đã bị janitor xóa khi hết RETENTION_ARTIFACTS: xử lý lại như cache miss
+		if r, openErr := artifacts.Open(ctx, cachedPdfPath); openErr == storage.ErrNotFound {
+			log.Printf("WORKER: Cached PDF %s for job %s no longer exists, processing again", cachedPdfPath, jobID)
+			err = cache.ErrMiss
+		} else if openErr == nil {
+			r.Close()
+		}
+	}
 	if err == nil && cachedPdfPath != "" { // Cache hit!
 		log.Printf("WORKER: Cache hit for job %s (image hash: %s). Using cached PDF: %s", jobID, imageHash, cachedPdfPath)
 		details["pdf_path"] = cachedPdfPath
 		details["cached"] = "true"
+		if job.EmbedImage != "" {
+			// PDF đã cache có cùng cách nhúng ảnh gốc (embed_image nằm trong cache key)
+			details["embed_image"] = job.EmbedImage
+		}
+		// Ghi nhận job đã tạo PDF gốc làm cha trong lineage
+		if source := sourceJobID(cachedPdfPath); source != "" {
+			if err := lineage.Record(ctx, redisClient, source, jobID, lineage.RelationCache, jobTTL); err != nil {
+				log.Printf("WORKER: Failed to record cache lineage for job %s: %v", jobID, err)
+			}
+		}
+		// Sao chép văn bản đã cache (nếu có) sang job hiện tại
+		if err := copyCachedTexts(ctx, cacheKey, jobID); err != nil {
+			log.Printf("WORKER: Failed to copy cached texts for job %s: %v", jobID, err)
+		}
 		// Cập nhật trạng thái thành công và lưu đường dẫn PDF từ cache
-		if err := updateJobStatus(ctx, jobID, "completed", cachedPdfPath); err != nil {
+		if err := updateJobStatus(ctx, jobID, model.StatusCompleted, cachedPdfPath); err != nil {
 			log.Printf("WORKER: Failed to update Redis status for cached job %s: %v", jobID, err)
 			// Vẫn trả về thành công vì đã có PDF
 		}
 		return details, nil // Trả về thành công từ cache
 	}
-	if err != redis.Nil {
-		// Lỗi khi truy cập Redis (không phải cache miss), log nhưng vẫn tiếp tục xử lý
+	if err != cache.ErrMiss {
+		// Lỗi khi truy cập cache (không phải cache miss), log nhưng vẫn tiếp tục xử lý
 		log.Printf("WORKER: Error checking image cache for job %s: %v. Proceeding without cache.", jobID, err)
 	}
 	// Cache miss hoặc lỗi Redis -> tiếp tục xử lý
@@ -202,108 +1158,125 @@ func processImage(ctx context.Context, imagePath string, jobID string) (map[stri
 	// --- End Cache Check ---
 
 	// Cập nhật trạng thái: processing
-	if err = updateJobStatus(ctx, jobID, "processing", ""); err != nil {
+	if err = updateJobStatus(ctx, jobID, model.StatusProcessing, ""); errors.Is(err, model.ErrConflict) {
+		// Message giao lại của job mà một worker khác đã xử lý xong: không xử lý lại
+		return details, errJobCompleted
+	} else if err != nil {
 		log.Printf("WORKER: Failed to set processing status for job %s: %v", jobID, err)
 		// Tiếp tục xử lý nếu có thể
 	}
 	log.Printf("WORKER: Starting image processing for job %s", jobID)
 
-	// 1. Image Filtering
-	filterStartTime := time.Now()
-	filteredImagePath, err := imagefilter.ApplyFilters(imagePath)
-	filterDuration := time.Since(filterStartTime)
+	// 1-4. Các bước của pipeline (mặc định: lấy văn bản, làm sạch, dịch, tạo PDF)
+	run := &Job{job: job, details: details, report: report, targetLang: targetLang, glossary: glossary, renderedAt: renderedAt}
+	ran, err := stageRunner.Run(ctx, def, run)
 	if err != nil {
-		errMsg := fmt.Sprintf("Image filtering error: %v", err)
-		updateJobStatus(ctx, jobID, "failed", errMsg)
-		return nil, fmt.Errorf("image filtering failed for job %s: %w", jobID, err)
+		rememberFailure(ctx, jobID, cacheKey, err)
+		return nil, err // Job đã được đánh dấu failed bởi bước lỗi
 	}
-	details["filter_ms"] = strconv.FormatInt(filterDuration.Milliseconds(), 10)
-	log.Printf("WORKER: Image filtering completed for job %s (%v). Filtered path: %s", jobID, filterDuration, filteredImagePath)
-
-	// 2. OCR
-	ocrStartTime := time.Now()
-	ocrResult, err := ocr.ImageToText(filteredImagePath)
-	ocrDuration := time.Since(ocrStartTime)
-	if err != nil {
-		ocrErrMsg := fmt.Sprintf("OCR error: %v", err)
-		log.Printf("WORKER: Job %s failed at OCR step. Error: %s", jobID, ocrErrMsg)
-		updateJobStatus(ctx, jobID, "failed", ocrErrMsg)
-		return nil, fmt.Errorf("OCR failed for job %s: %w", jobID, err)
+	if run.pdfKey == "" {
+		return nil, pipelineError(ctx, jobID, fmt.Errorf("pipeline %q has no pdf stage", def.Name))
 	}
-	details["ocr_ms"] = strconv.FormatInt(ocrDuration.Milliseconds(), 10)
-	log.Printf("WORKER: OCR completed for job %s (%v). Text length: %d", jobID, ocrDuration, len(ocrResult))
-
-	// 3. Translation
-	transStartTime := time.Now()
-	translatedText, err := translator.Translate(ocrResult)
-	transDuration := time.Since(transStartTime)
-	if err != nil {
-		errMsg := fmt.Sprintf("Translation error: %v", err)
-		updateJobStatus(ctx, jobID, "failed", errMsg)
-		return nil, fmt.Errorf("translation failed for job %s: %w", jobID, err)
+	if def.Name != defaultPipeline.Name {
+		details["pipeline"] = def.Name
 	}
-	details["translate_ms"] = strconv.FormatInt(transDuration.Milliseconds(), 10)
-	log.Printf("WORKER: Translation completed for job %s (%v). Translated length: %d", jobID, transDuration, len(translatedText))
+	details["pipeline_stages"] = strings.Join(ran, ",")
+	rec, pdfKey := run.rec, run.pdfKey
+	ocrResult, translatedText := run.ocrText(), run.translatedText()
 
-	// 4. PDF Generation
-	pdfStartTime := time.Now()
-	pdfOutputPath := filepath.Join(pdfDir, fmt.Sprintf("%s.pdf", jobID))
-	tempPdfPath, err := pdf.CreatePDF(translatedText)
-	if err != nil {
-		errMsg := fmt.Sprintf("PDF generation error: %v", err)
-		updateJobStatus(ctx, jobID, "failed", errMsg)
-		return nil, fmt.Errorf("PDF generation failed for job %s: %w", jobID, err)
-	}
-	if tempPdfPath != pdfOutputPath {
-		if err := os.Rename(tempPdfPath, pdfOutputPath); err != nil {
-			errMsg := fmt.Sprintf("Failed to rename/move PDF: %v", err)
-			updateJobStatus(ctx, jobID, "failed", errMsg)
-			os.Remove(tempPdfPath)
-			return nil, fmt.Errorf("failed to rename/move PDF for job %s: %w", jobID, err)
-		}
-	}
-	pdfDuration := time.Since(pdfStartTime)
-	details["pdf_ms"] = strconv.FormatInt(pdfDuration.Milliseconds(), 10)
-	details["pdf_path"] = pdfOutputPath // Lưu đường dẫn cuối cùng
-	log.Printf("WORKER: PDF generation completed for job %s (%v). Output: %s", jobID, pdfDuration, pdfOutputPath)
+	details["resource_usage"] = report.JSON()
 
 	// 5. Update Redis on Success
-	if err = updateJobStatus(ctx, jobID, "completed", pdfOutputPath); err != nil {
+	if err = updateJobStatus(ctx, jobID, model.StatusCompleted, pdfKey); err != nil {
 		log.Printf("WORKER: Failed to update final status in Redis for job %s after success: %v", jobID, err)
 		// Vẫn trả về thành công vì đã có PDF
 	}
 
-	// Lưu cache hash ảnh -> pdfPath
-	if err := redisClient.Set(ctx, cacheKey, pdfOutputPath, cacheTTL).Err(); err != nil {
-		log.Printf("WORKER: Failed to save image hash cache for job %s (hash: %s): %v", jobID, imageHash, err)
+	// Lưu văn bản OCR và bản dịch để API có thể trả về (preview + phân trang)
+	if err := saveJobTexts(ctx, jobID, cacheKey, ocrResult, translatedText); err != nil {
+		log.Printf("WORKER: Failed to save texts for job %s: %v", jobID, err)
+	}
+	if err := saveJobRegions(ctx, jobID, cacheKey, rec.regions); err != nil {
+		log.Printf("WORKER: Failed to save region texts for job %s: %v", jobID, err)
+	}
+	if err := saveJobFormats(ctx, jobID, cacheKey, rec.formats); err != nil {
+		log.Printf("WORKER: Failed to save hOCR/ALTO of job %s: %v", jobID, err)
+	}
+	if err := saveJobBarcodes(ctx, jobID, cacheKey, run.barcodes); err != nil {
+		log.Printf("WORKER: Failed to save barcodes of job %s: %v", jobID, err)
+	}
+	if err := saveJobSummary(ctx, jobID, cacheKey, run.summary); err != nil {
+		log.Printf("WORKER: Failed to save summary of job %s: %v", jobID, err)
+	}
+
+	// Lưu cache hash ảnh -> key PDF (trừ PDF mang job ID của job này)
+	if sharePDF {
+		if err := resultCache.Set(ctx, cacheKey, pdfKey, cacheTTL); err != nil {
+			log.Printf("WORKER: Failed to save image hash cache for job %s (hash: %s): %v", jobID, imageHash, err)
+		}
 	}
 
 	log.Printf("WORKER: Finished processing job %s successfully.", jobID)
 	return details, nil
 }
 
+// --- Chi phí dịch của job, đọc từ details của các bước ---
+func jobCharacters(details map[string]string) usage.Characters {
+	ocrChars, _ := strconv.ParseInt(details["ocr_chars"], 10, 64)
+	translatedChars, _ := strconv.ParseInt(details["translated_chars"], 10, 64)
+	return usage.Characters{OCR: ocrChars, Translated: translatedChars, Provider: details["translation_provider"]}
+}
+
+// --- Tải glossary của job: glossary đã lưu trong Redis + thuật ngữ riêng của request ---
+// Glossary đã lưu thuộc tenant của job
+func loadGlossary(ctx context.Context, job messaging.JobMessage) (translator.Glossary, error) {
+	glossary := translator.Glossary{}
+	if job.Glossary != "" {
+		terms, err := redisClient.HGetAll(ctx, tenant.GlossaryKey(model.TenantOf(job.JobID), job.Glossary)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("glossary %s not found", job.Glossary)
+		}
+		glossary = translator.Glossary(terms)
+	}
+	return glossary.Merge(job.GlossaryTerms), nil
+}
+
+// --- Hash nội dung glossary (thứ tự thuật ngữ không ảnh hưởng) ---
+func glossaryHash(glossary translator.Glossary) string {
+	terms := make([]string, 0, len(glossary))
+	for source, target := range glossary {
+		terms = append(terms, source+"\x00"+target)
+	}
+	sort.Strings(terms)
+	h := sha256.Sum256([]byte(strings.Join(terms, "\x01")))
+	return hex.EncodeToString(h[:8])
+}
+
+// --- Lấy jobID đã tạo PDF từ key trong storage ("pdfs/{jobID}.pdf") ---
+func sourceJobID(pdfKey string) string {
+	name := filepath.Base(pdfKey)
+	if filepath.Ext(name) != ".pdf" {
+		return ""
+	}
+	return strings.TrimSuffix(name, ".pdf")
+}
+
+// errJobCompleted: job đã hoàn tất ở một lần giao message khác
+var errJobCompleted = errors.New("job already completed")
+
 // --- Hàm cập nhật trạng thái Job cơ bản vào Redis ---
-// Chỉ cập nhật status, pdfpath, error
+// Chỉ cập nhật status, pdfpath, error (job processing được reaper theo dõi).
+// Job đã completed không bị ghi đè (model.ErrConflict): worker chậm hơn của
+// cùng job không xóa được kết quả.
 func updateJobStatus(ctx context.Context, jobID, status, result string) error {
-	pipe := redisClient.Pipeline()
-	statusKey := fmt.Sprintf("%s:status", jobID)
-	pdfPathKey := fmt.Sprintf("%s:pdfpath", jobID)
-	errorKey := fmt.Sprintf("%s:error", jobID)
-
-	pipe.Set(ctx, statusKey, status, jobTTL)
-
-	if status == "completed" {
-		pipe.Set(ctx, pdfPathKey, result, jobTTL)
-		pipe.Del(ctx, errorKey)
-	} else if status == "failed" {
-		pipe.Set(ctx, errorKey, result, jobTTL)
-		pipe.Del(ctx, pdfPathKey)
-	} else {
-		// Xóa các kết quả cũ nếu trạng thái là processing/queued
-		pipe.Del(ctx, pdfPathKey, errorKey)
+	err := jobStore.SetStatus(ctx, jobID, status, result)
+	if errors.Is(err, model.ErrConflict) {
+		log.Printf("WORKER: Job %s is already completed, status '%s' not written", jobID, status)
+		return err
 	}
-
-	_, err := pipe.Exec(ctx)
 	if err != nil {
 		log.Printf("WORKER: Error executing Redis status pipeline for job %s: %v", jobID, err)
 	}
@@ -311,24 +1284,105 @@ func updateJobStatus(ctx context.Context, jobID, status, result string) error {
 	return err
 }
 
+// --- Bước thumbnail: JPEG nhỏ của ảnh upload trong storage (GET /api/jobs/:job_id/preview) ---
+// Lỗi chỉ được log: job vẫn được xử lý, chỉ không có preview
+func createThumbnail(ctx context.Context, job messaging.JobMessage, details map[string]string) {
+	start := time.Now()
+	enterStage(ctx, job.JobID, "thumbnail")
+	key := model.ThumbnailKey(job.JobID)
+	writer, err := artifacts.Create(ctx, key)
+	if err != nil {
+		log.Printf("WORKER: Warning: Cannot create thumbnail of job %s in storage: %v", job.JobID, err)
+		return
+	}
+	if err := thumbnailConfig.WriteThumbnail(writer, job.ImagePath); err != nil {
+		writer.Abort()
+		log.Printf("WORKER: Warning: Thumbnail generation failed for job %s: %v", job.JobID, err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("WORKER: Warning: Failed to save thumbnail of job %s: %v", job.JobID, err)
+		return
+	}
+	details["thumbnail_path"] = key
+	details["thumbnail_ms"] = strconv.FormatInt(time.Since(start).Milliseconds(), 10)
+	// Lưu ngay để preview có trước khi job kết thúc
+	if err := saveJobDetails(ctx, job.JobID, map[string]string{"thumbnail_path": key}); err != nil {
+		log.Printf("WORKER: Warning: Failed to save thumbnail path of job %s: %v", job.JobID, err)
+	}
+}
+
+// --- Lưu file trung gian của job vào storage (GET /api/jobs/:job_id/artifacts/:name) ---
+// Văn bản OCR thô, ảnh đã lọc, văn bản đã làm sạch: để gỡ lỗi bản dịch sai. Lỗi chỉ được log
+func saveArtifact(ctx context.Context, jobID, name string, details map[string]string, write func(io.Writer) error) {
+	key := model.ArtifactKey(jobID, model.ArtifactFiles[name])
+	writer, err := artifacts.Create(ctx, key)
+	if err != nil {
+		log.Printf("WORKER: Warning: Cannot create artifact %s of job %s in storage: %v", name, jobID, err)
+		return
+	}
+	if err := write(writer); err != nil {
+		writer.Abort()
+		log.Printf("WORKER: Warning: Failed to write artifact %s of job %s: %v", name, jobID, err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("WORKER: Warning: Failed to save artifact %s of job %s: %v", name, jobID, err)
+		return
+	}
+	var names []string
+	if details["artifacts"] != "" {
+		names = strings.Split(details["artifacts"], ",")
+	}
+	if !slices.Contains(names, name) {
+		details["artifacts"] = strings.Join(append(names, name), ",")
+	}
+}
+
+// --- Ghi bước job đang chạy: heartbeat của worker, details (status, /ws) và lịch sử của job ---
+func enterStage(ctx context.Context, jobID, stage string) {
+	fleetTracker.SetStage(jobID, stage)
+	if err := saveJobDetails(ctx, jobID, map[string]string{"stage": stage}); err != nil {
+		log.Printf("WORKER: Warning: Failed to save stage %s of job %s: %v", stage, jobID, err)
+	}
+	if err := jobStore.RecordHistory(ctx, jobID, model.HistoryEvent{Type: model.HistoryStage, Stage: stage}); err != nil {
+		log.Printf("WORKER: Warning: Failed to record stage %s in history of job %s: %v", stage, jobID, err)
+	}
+}
+
 // --- Hàm lưu thông tin chi tiết của Job vào Redis ---
 func saveJobDetails(ctx context.Context, jobID string, details map[string]string) error {
-	if details == nil {
-		return nil // Không có gì để lưu
-	}
-	pipe := redisClient.Pipeline()
-	// Sử dụng HMSet để lưu map vào một hash key duy nhất cho gọn
-	detailsKey := fmt.Sprintf("%s:details", jobID)
-	pipe.HMSet(ctx, detailsKey, details)
-	pipe.Expire(ctx, detailsKey, jobTTL) // Đặt TTL cho hash key
+	return jobStore.SaveDetails(ctx, jobID, details)
+}
 
-	/* // Cách cũ: Lưu từng key riêng lẻ
-	for key, value := range details {
-		redisKey := fmt.Sprintf("%s:%s", jobID, key) // Ví dụ: jobID:ocr_ms
-		pipe.Set(ctx, redisKey, value, jobTTL)
+// --- Hàm lưu văn bản OCR và bản dịch của Job vào Redis ---
+// Văn bản được lưu theo job (jobTTL) và theo hash ảnh (cacheTTL) để dùng lại khi cache hit
+func saveJobTexts(ctx context.Context, jobID, cacheKey, ocrText, translatedText string) error {
+	pipe := redisClient.Pipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s:ocr_text", jobID), ocrText, jobTTL)
+	pipe.Set(ctx, fmt.Sprintf("%s:translated_text", jobID), translatedText, jobTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if err := resultCache.Set(ctx, fmt.Sprintf("%s:ocr_text", cacheKey), ocrText, cacheTTL); err != nil {
+		return err
 	}
-	*/
+	return resultCache.Set(ctx, fmt.Sprintf("%s:translated_text", cacheKey), translatedText, cacheTTL)
+}
 
-	_, err := pipe.Exec(ctx)
-	return err
+// --- Hàm sao chép văn bản đã cache theo hash ảnh sang Job mới ---
+func copyCachedTexts(ctx context.Context, cacheKey, jobID string) error {
+	for _, field := range []string{"ocr_text", "translated_text", "regions", "ocr_" + messaging.OCRFormatHOCR, "ocr_" + messaging.OCRFormatALTO, "barcodes", "summary"} {
+		text, err := resultCache.Get(ctx, fmt.Sprintf("%s:%s", cacheKey, field))
+		if err == cache.ErrMiss {
+			continue // Cache cũ chưa có văn bản
+		}
+		if err != nil {
+			return err
+		}
+		if err := redisClient.Set(ctx, fmt.Sprintf("%s:%s", jobID, field), text, jobTTL).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
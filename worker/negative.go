@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// Thời gian nhớ lỗi cố định (NEGATIVE_CACHE_TTL, 0: tắt): ngắn để sau khi sửa
+// preprocessing (hoặc cài thêm traineddata) file được xử lý lại sớm
+var negativeCacheTTL = 10 * time.Minute
+
+// --- Lỗi cố định của input (file hỏng, nội dung không đọc được) ---
+// Gửi lại cùng file với cùng tùy chọn sẽ lỗi y hệt: lỗi được nhớ trong cache với
+// thời hạn ngắn để job sau thất bại ngay, không lọc ảnh và OCR lại
+type permanentError struct {
+	status string // Thông báo lỗi của job, trả lại cho các job sau
+	err    error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// --- Đánh dấu lỗi là cố định, status là thông báo đã ghi vào trạng thái job ---
+func permanent(status string, err error) error {
+	return &permanentError{status: status, err: err}
+}
+
+// --- Key của lỗi đã nhớ: cùng các tùy chọn với key của kết quả ---
+func failureKey(cacheKey string) string {
+	return cacheKey + ":failed"
+}
+
+// --- Job thất bại ngay nếu cùng input đã lỗi cố định gần đây ---
+// Trả về nil nếu không có lỗi đã nhớ (hoặc negative cache bị tắt)
+func checkKnownFailure(ctx context.Context, jobID, cacheKey string, details map[string]string) error {
+	if negativeCacheTTL <= 0 {
+		return nil
+	}
+	status, err := resultCache.Get(ctx, failureKey(cacheKey))
+	if err != nil {
+		if err != cache.ErrMiss {
+			log.Printf("WORKER: Error checking failure cache for job %s: %v. Proceeding.", jobID, err)
+		}
+		return nil
+	}
+	details["negative_cached"] = "true"
+	log.Printf("WORKER: Input of job %s failed recently with the same options, failing fast: %s", jobID, status)
+	updateJobStatus(ctx, jobID, model.StatusFailed, status)
+	return fmt.Errorf("input of job %s is known to fail: %s", jobID, status)
+}
+
+// --- Nhớ lỗi cố định của input (lỗi tạm thời như Redis, timeout không được nhớ) ---
+func rememberFailure(ctx context.Context, jobID, cacheKey string, err error) {
+	var perm *permanentError
+	if negativeCacheTTL <= 0 || !errors.As(err, &perm) || ctx.Err() != nil {
+		return
+	}
+	if err := resultCache.Set(ctx, failureKey(cacheKey), perm.status, negativeCacheTTL); err != nil {
+		log.Printf("WORKER: Failed to remember permanent failure of job %s: %v", jobID, err)
+	}
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// useTestRedis trỏ Redis, trạng thái job và cache kết quả của worker vào Redis trong bộ nhớ
+func useTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	jobStore = model.NewStore(redisClient, time.Hour)
+	resultCache = cache.NewRedisCache(redisClient, "")
+	return mr
+}
+
+func TestNegativeCache(t *testing.T) {
+	ctx := context.Background()
+	mr := useTestRedis(t)
+	const cacheKey = "imagehash:abc:lang_vi"
+
+	details := map[string]string{}
+	if err := checkKnownFailure(ctx, "job1", cacheKey, details); err != nil {
+		t.Fatalf("no failure remembered: %v", err)
+	}
+
+	// Lỗi tạm thời không được nhớ
+	rememberFailure(ctx, "job1", cacheKey, errors.New("redis timeout"))
+	if mr.Exists(failureKey(cacheKey)) {
+		t.Fatal("transient error remembered")
+	}
+
+	rememberFailure(ctx, "job1", cacheKey, fmt.Errorf("job job1: %w", permanent("Cannot decode image", errors.New("invalid JPEG"))))
+	if ttl := mr.TTL(failureKey(cacheKey)); ttl != negativeCacheTTL {
+		t.Fatalf("failure TTL = %v, want %v", ttl, negativeCacheTTL)
+	}
+	if err := checkKnownFailure(ctx, "job2", cacheKey, details); err == nil {
+		t.Fatal("known failure not reported")
+	}
+	job, err := jobStore.Load(ctx, "job2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != model.StatusFailed || job.Error != "Cannot decode image" || details["negative_cached"] != "true" {
+		t.Fatalf("job = %+v, details %v; want failed with the remembered error", job, details)
+	}
+
+	// Các tùy chọn khác (key khác) không bị ảnh hưởng
+	if err := checkKnownFailure(ctx, "job3", cacheKey+":dpi_300", map[string]string{}); err != nil {
+		t.Fatalf("other options: %v", err)
+	}
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	ctx := context.Background()
+	mr := useTestRedis(t)
+	defer func(ttl time.Duration) { negativeCacheTTL = ttl }(negativeCacheTTL)
+	negativeCacheTTL = 0
+
+	rememberFailure(ctx, "job1", "key", permanent("Cannot decode image", errors.New("invalid JPEG")))
+	if mr.Exists(failureKey("key")) {
+		t.Fatal("failure remembered with NEGATIVE_CACHE_TTL=0")
+	}
+	mr.Set(failureKey("key"), "Cannot decode image")
+	if err := checkKnownFailure(ctx, "job2", "key", map[string]string{}); err != nil {
+		t.Fatalf("failure checked with NEGATIVE_CACHE_TTL=0: %v", err)
+	}
+
+	// Job bị hủy (worker dừng) không được nhớ là lỗi cố định
+	negativeCacheTTL = time.Minute
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	rememberFailure(canceled, "job3", "other", permanent("Cannot decode image", context.Canceled))
+	if mr.Exists(failureKey("other")) {
+		t.Fatal("failure of a canceled job remembered")
+	}
+}
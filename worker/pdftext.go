@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// --- Đọc lớp văn bản của PDF (job pdf_text, không cần OCR) ---
+// Ngôn ngữ nguồn được nhận diện từ văn bản (rỗng: tiếng Anh)
+func extractPDFPages(ctx context.Context, job messaging.JobMessage, details map[string]string, report usage.Report) (*recognition, error) {
+	jobID := job.JobID
+	extractStartTime := time.Now()
+	enterStage(ctx, job.JobID, "extract")
+	_, extractMeter := usage.Start(ctx)
+	pages, err := pdf.ExtractTextFile(job.ImagePath)
+	extractDuration := time.Since(extractStartTime)
+	report.Add("extract", extractMeter.Stop())
+	if err != nil {
+		errMsg := fmt.Sprintf("PDF text extraction error: %v", err)
+		if errors.Is(err, pdf.ErrEncrypted) {
+			errMsg = "PDF is encrypted, its text cannot be read"
+		}
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+		return nil, permanent(errMsg, fmt.Errorf("PDF text extraction failed for job %s: %w", jobID, err))
+	}
+	if strings.TrimSpace(strings.Join(pages, "")) == "" {
+		// PDF scan: không có lớp văn bản -> phải gửi dưới dạng ảnh để OCR
+		errMsg := "PDF has no text layer (scanned document?); upload it as an image for OCR"
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+		return nil, permanent(errMsg, fmt.Errorf("PDF for job %s has no text layer", jobID))
+	}
+	details["extract_ms"] = strconv.FormatInt(extractDuration.Milliseconds(), 10)
+	details["pages"] = strconv.Itoa(len(pages))
+	log.Printf("WORKER: Extracted text layer of %d page(s) for job %s (%v)", len(pages), jobID, extractDuration)
+
+	// Ngôn ngữ nguồn: PDF của job trước thường đã là bản dịch (không phải tiếng Anh)
+	sourceLang, _ := ocr.DetectTextLanguage(strings.Join(pages, "\n"))
+	if sourceLang != "" {
+		details["source_lang"] = sourceLang
+	}
+	return &recognition{pages: pages, sourceLang: sourceLang}, nil
+}
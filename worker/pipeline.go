@@ -0,0 +1,420 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/cache"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pipeline"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/textclean"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// Pipeline mặc định: lấy văn bản theo loại job, làm sạch văn bản OCR, dịch, tóm tắt, tạo PDF
+var defaultPipeline = pipeline.Definition{
+	Name: "default",
+	Stages: []pipeline.Stage{
+		{Name: "ocr", When: map[string][]string{"job_type": {"image"}}},
+		{Name: "barcodes", When: map[string][]string{"job_type": {"image"}, "barcodes": {"true"}}},
+		{Name: "extract", When: map[string][]string{"job_type": {messaging.JobTypePDFText}}},
+		{Name: "text", When: map[string][]string{"job_type": {messaging.JobTypeText}}},
+		{Name: "cleanup", When: map[string][]string{"job_type": {"image"}, "layout": {"false"}}},
+		{Name: "translate"},
+		{Name: "summarize", When: map[string][]string{"summarize": {"true"}}},
+		{Name: "pdf"},
+	},
+}
+
+var (
+	pipelineDefinition = defaultPipeline // PIPELINE_DEFINITION hoặc defaultPipeline
+	stageRunner        = newStageRunner()
+)
+
+// --- Các bước worker cung cấp cho pipeline (tên dùng trong định nghĩa pipeline) ---
+func newStageRunner() *pipeline.Runner[*Job] {
+	runner := pipeline.NewRunner[*Job]()
+	runner.Register("ocr", recognitionStage("ocr"))
+	runner.Register("extract", recognitionStage("extract"))
+	runner.Register("text", recognitionStage("text"))
+	runner.Register("barcodes", barcodeStage)
+	runner.Register("cleanup", cleanupStage)
+	runner.Register("translate", translateStage)
+	runner.Register("summarize", summarizeStage)
+	runner.Register("pdf", pdfStage)
+	return runner
+}
+
+// --- Pipeline của job: định nghĩa gửi kèm job, nếu không thì pipeline của worker ---
+func jobPipeline(job messaging.JobMessage) (pipeline.Definition, error) {
+	if len(job.Pipeline) == 0 {
+		return pipelineDefinition, nil
+	}
+	def, err := pipeline.Parse(job.Pipeline)
+	if err != nil {
+		return def, err
+	}
+	return def, stageRunner.Validate(def)
+}
+
+// Job là trạng thái của một job trong pipeline, dùng chung giữa các bước (xem RegisterStage)
+type Job struct {
+	job        messaging.JobMessage
+	details    map[string]string
+	report     usage.Report
+	targetLang string
+	glossary   translator.Glossary
+	rec        *recognition       // Văn bản từng trang (bước ocr, extract hoặc text)
+	trans      *translationMarker // Bản dịch (bước translate), nil: PDF chứa văn bản gốc
+	barcodes   []ocr.Barcode      // Barcode/QR code của ảnh (bước barcodes)
+	summary    *string            // Tóm tắt bản dịch (bước summarize)
+	pdfKey     string             // PDF kết quả (bước pdf)
+	renderedAt time.Time          // {date} của template PDF, cùng giá trị với cache key
+}
+
+// Var trả về giá trị của biến dùng trong điều kiện when/unless của các bước
+func (r *Job) Var(name string) string {
+	switch name {
+	case "job_type":
+		if r.job.JobType == messaging.JobTypeImage {
+			return "image"
+		}
+		return r.job.JobType
+	case "ocr_mode":
+		if r.job.OCRMode == messaging.OCRModePrinted {
+			return "printed"
+		}
+		return r.job.OCRMode
+	case "target_lang":
+		return r.targetLang
+	case "source_lang": // Rỗng trước bước lấy văn bản
+		if r.rec == nil {
+			return ""
+		}
+		if r.rec.sourceLang == "" {
+			return "en"
+		}
+		return r.rec.sourceLang
+	case "layout":
+		return strconv.FormatBool(r.rec != nil && r.rec.layouts != nil)
+	case "regions":
+		return strconv.FormatBool(len(r.job.Regions) > 0)
+	case "outputs":
+		return strconv.FormatBool(len(r.job.Outputs) > 0)
+	case "barcodes":
+		return strconv.FormatBool(barcodeDetection || r.job.Barcodes)
+	case "summarize":
+		return strconv.FormatBool(summarization || r.job.Summarize)
+	}
+	return ""
+}
+
+// --- Văn bản OCR và bản dịch (các trang cách nhau bởi pdf.PageBreak) ---
+func (r *Job) ocrText() string { return strings.Join(r.rec.pages, pdf.PageBreak) }
+
+func (r *Job) translatedText() string {
+	if r.trans == nil {
+		return r.ocrText()
+	}
+	return strings.Join(r.trans.Pages, pdf.PageBreak)
+}
+
+// --- 1-2. Lấy văn bản từng trang: lọc ảnh + OCR, đọc lớp văn bản của PDF hoặc văn bản của client ---
+// Bước đã hoàn thành ở lần giao trước (có mốc trong Redis) được bỏ qua
+func recognitionStage(stage string) pipeline.StageFunc[*Job] {
+	return func(ctx context.Context, r *Job, _ map[string]string) error {
+		var marker recognitionMarker
+		if loadStage(ctx, r.job.JobID, stage, &marker, r.details) {
+			r.rec = marker.recognition()
+			return nil
+		}
+		before := maps.Clone(r.details)
+		var err error
+		switch stage {
+		case "extract":
+			r.rec, err = extractPDFPages(ctx, r.job, r.details, r.report)
+		case "text":
+			r.rec, err = readTextPages(ctx, r.job, r.details)
+		default:
+			r.rec, err = recognizeImage(ctx, r.job, r.details, r.report)
+		}
+		if err != nil {
+			return err
+		}
+		r.details["ocr_chars"] = strconv.Itoa(utf8.RuneCountInString(r.ocrText()))
+		saveTextArtifact(ctx, r, model.ArtifactOCR)
+		saveStage(ctx, r.job.JobID, stage, newRecognitionMarker(r.rec), r.details, before)
+		return nil
+	}
+}
+
+// --- Lưu văn bản hiện tại của job (các trang cách nhau bởi pdf.PageBreak) làm file trung gian ---
+func saveTextArtifact(ctx context.Context, r *Job, name string) {
+	saveArtifact(ctx, r.job.JobID, name, r.details, func(w io.Writer) error {
+		_, err := io.WriteString(w, r.ocrText())
+		return err
+	})
+}
+
+// --- Đánh dấu job thất bại do định nghĩa pipeline (bước thiếu văn bản, option sai) ---
+func pipelineError(ctx context.Context, jobID string, err error) error {
+	updateJobStatus(ctx, jobID, model.StatusFailed, fmt.Sprintf("Pipeline error: %v", err))
+	return fmt.Errorf("pipeline failed for job %s: %w", jobID, err)
+}
+
+// errNoText: pipeline không có bước lấy văn bản trước bước cần văn bản
+func errNoText(ctx context.Context, jobID, stage string) error {
+	return pipelineError(ctx, jobID, fmt.Errorf("stage %s needs the text of an ocr, extract or text stage", stage))
+}
+
+// --- Làm sạch văn bản OCR trước khi dịch (OCR_CLEANUP, hoặc option steps của bước) ---
+// Nối từ bị ngắt dòng, khoảng trắng, nhầm lẫn 0/O và 1/l, header/footer lặp lại, sửa chính tả
+// theo từ điển của ngôn ngữ nguồn. Bố cục và vùng crop được giữ nguyên.
+func cleanupStage(ctx context.Context, r *Job, options map[string]string) error {
+	if r.rec == nil {
+		return errNoText(ctx, r.job.JobID, "cleanup")
+	}
+	steps := textCleanup
+	if names := options["steps"]; names != "" {
+		var err error
+		if steps, err = textclean.New(strings.Split(names, ",")...); err != nil {
+			return pipelineError(ctx, r.job.JobID, err)
+		}
+	}
+	if len(steps) == 0 || r.rec.layouts != nil {
+		return nil
+	}
+	cleanupStartTime := time.Now()
+	enterStage(ctx, r.job.JobID, "cleanup")
+	var changes []textclean.Change
+	r.rec.pages, changes = steps.ProcessDocument(r.rec.pages, r.rec.sourceLang)
+	r.details["cleanup"] = strings.Join(steps.Names(), ",")
+	if len(changes) > 0 {
+		// Báo cáo các từ đã sửa chính tả (tối đa maxReportedChanges từ)
+		r.details["cleanup_changes"] = strconv.Itoa(len(changes))
+		report, _ := json.Marshal(changes[:min(len(changes), maxReportedChanges)])
+		r.details["cleanup_report"] = string(report)
+	}
+	r.details["cleanup_ms"] = strconv.FormatInt(time.Since(cleanupStartTime).Milliseconds(), 10)
+	saveTextArtifact(ctx, r, model.ArtifactCleaned)
+	return nil
+}
+
+// --- 3. Translation (từng trang, để giữ ranh giới trang; với bố cục: từng vùng/ô của bảng) ---
+// Bản dịch của lần giao trước được dùng lại để không tốn thêm quota dịch
+func translateStage(ctx context.Context, r *Job, _ map[string]string) error {
+	if r.rec == nil {
+		return errNoText(ctx, r.job.JobID, "translate")
+	}
+	jobID, rec := r.job.JobID, r.rec
+	trans := translationMarker{Pages: make([]string, len(rec.pages)), Layouts: make([]*ocr.Layout, len(rec.layouts))}
+	if !loadStage(ctx, jobID, "translate", &trans, r.details) {
+		before := maps.Clone(r.details)
+		transStartTime := time.Now()
+		enterStage(ctx, jobID, "translate")
+		_, transMeter := usage.Start(ctx)
+		// Các trang (hoặc vùng, ô) được gửi theo lô nếu provider hỗ trợ
+		// TRANSLATE_MARKUP: cấu trúc của văn bản được thay bằng placeholder khi dịch rồi khôi phục
+		opts := translator.Options{Glossary: r.glossary, Markup: markupTranslation}
+		if paragraphDetection {
+			opts.Detect = ocr.DetectTextLanguage
+		}
+		if translateParallel > 1 {
+			// Từng đoạn được dịch song song, bản dịch của đoạn được cache để dùng lại giữa các tài liệu
+			// của tenant; xử lý lại (SkipCache) dịch lại mọi đoạn
+			opts.Parallel = translateParallel
+			if !r.job.SkipCache {
+				opts.Cache = paragraphCache{ctx, jobID}
+			}
+		}
+		var cost translator.Usage
+		var err error
+		if rec.layouts != nil {
+			if trans.Layouts, cost, err = translateLayouts(rec.layouts, rec.sourceLang, r.targetLang, opts); err == nil {
+				for i, layout := range trans.Layouts {
+					trans.Pages[i] = layout.Text()
+				}
+			}
+		} else {
+			trans.Pages, cost, err = translator.TranslateBatchUsage(rec.pages, rec.sourceLang, r.targetLang, opts)
+		}
+		r.report.Add("translate", transMeter.Stop())
+		if err != nil {
+			errMsg := fmt.Sprintf("Translation error: %v", err)
+			updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+			return fmt.Errorf("translation failed for job %s: %w", jobID, err)
+		}
+		transDuration := time.Since(transStartTime)
+		r.details["translate_ms"] = strconv.FormatInt(transDuration.Milliseconds(), 10)
+		r.details["target_lang"] = r.targetLang
+		// Ký tự đã gửi tới provider dịch -> chi phí theo tenant (GET /api/admin/usage)
+		r.details["translated_chars"] = strconv.Itoa(cost.Chars)
+		if cost.Provider != "" {
+			r.details["translation_provider"] = cost.Provider
+		}
+		if len(cost.Providers) > 1 {
+			// Chain dịch lại bằng provider sau các đoạn có bản dịch kém: số đoạn theo provider
+			r.details["translation_providers"] = formatCounts(cost.Providers)
+		}
+		if markupTranslation {
+			r.details["markup"] = "true"
+		}
+		if len(r.glossary) > 0 {
+			r.details["glossary_terms"] = strconv.Itoa(len(r.glossary))
+		}
+		saveStage(ctx, jobID, "translate", trans, r.details, before)
+		log.Printf("WORKER: Translation completed for job %s (%v)", jobID, transDuration)
+	}
+	r.trans = &trans
+	setRegionTranslations(rec.regions, trans.Layouts)
+	log.Printf("WORKER: Translated length for job %s: %d", jobID, len(r.translatedText()))
+	return nil
+}
+
+// --- "google:10,libretranslate:2", sắp xếp theo tên ---
+func formatCounts(counts map[string]int) string {
+	parts := make([]string, 0, len(counts))
+	for _, name := range slices.Sorted(maps.Keys(counts)) {
+		parts = append(parts, fmt.Sprintf("%s:%d", name, counts[name]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// --- Cache bản dịch từng đoạn (TRANSLATE_PARALLEL) trong cache kết quả ---
+// Key theo tenant như cache kết quả; key đã dùng được ghi vào model.TranslationCacheKey
+// của job để API xóa bản dịch khi erase job
+type paragraphCache struct {
+	ctx   context.Context
+	jobID string
+}
+
+func (c paragraphCache) key(key string) string {
+	if tenantID := model.TenantOf(c.jobID); tenantID != "" {
+		return fmt.Sprintf("tenant:%s:%s", tenantID, key)
+	}
+	return key
+}
+
+func (c paragraphCache) Get(key string) (string, bool) {
+	key = c.key(key)
+	text, err := resultCache.Get(c.ctx, key)
+	if err != nil && err != cache.ErrMiss {
+		log.Printf("WORKER: Error reading translation cache: %v", err)
+	}
+	if err == nil {
+		c.track(key)
+	}
+	return text, err == nil
+}
+
+func (c paragraphCache) Set(key, text string) {
+	key = c.key(key)
+	if err := resultCache.Set(c.ctx, key, text, cacheTTL); err != nil {
+		log.Printf("WORKER: Failed to cache translation: %v", err)
+		return
+	}
+	c.track(key)
+}
+
+func (c paragraphCache) track(key string) {
+	pipe := redisClient.TxPipeline()
+	pipe.SAdd(c.ctx, model.TranslationCacheKey(c.jobID), key)
+	pipe.Expire(c.ctx, model.TranslationCacheKey(c.jobID), jobTTL)
+	if _, err := pipe.Exec(c.ctx); err != nil {
+		log.Printf("WORKER: Failed to record translation cache key of job %s: %v", c.jobID, err)
+	}
+}
+
+// --- 4. PDF Generation ---
+// Các output thêm (PDF văn bản gốc, file văn bản) được render song song với PDF bản dịch,
+// mỗi loại trong hàng đợi riêng; job chỉ hoàn tất khi mọi output đã có trong result store
+func pdfStage(ctx context.Context, r *Job, _ map[string]string) error {
+	if r.rec == nil {
+		return errNoText(ctx, r.job.JobID, "pdf")
+	}
+	jobID, job, details := r.job.JobID, r.job, r.details
+	translatedText := r.translatedText()
+	var pdfPages []pdf.Page // Nội dung có cấu trúc của PDF (nil: văn bản thường)
+	language := r.targetLang
+	if r.trans != nil {
+		for _, layout := range r.trans.Layouts {
+			pdfPages = append(pdfPages, layoutPage(layout))
+		}
+	} else {
+		// Không có bước translate: PDF chứa văn bản gốc
+		language = r.rec.sourceLang
+	}
+	renderCtx, cancelRenders := context.WithCancel(ctx)
+	defer cancelRenders() // PDF lỗi: dừng các output thêm đang render
+	renders := startRenders(renderCtx, job, r.rec, r.ocrText(), translatedText, language)
+	summary := ""
+	if summaryCover && r.summary != nil {
+		summary = *r.summary // In tóm tắt trên trang bìa (SUMMARY_COVER)
+	}
+	// PDF đã ghi vào storage ở lần giao trước không được tạo lại
+	pdfKey := model.PDFKey(jobID)
+	if !loadStage(ctx, jobID, "pdf", &pdfKey, details) {
+		before := maps.Clone(details)
+		pdfStartTime := time.Now()
+		enterStage(ctx, jobID, "pdf")
+		_, pdfMeter := usage.Start(ctx)
+		pdfWriter, err := artifacts.Create(ctx, pdfKey)
+		if err != nil {
+			r.report.Add("pdf", pdfMeter.Stop())
+			errMsg := fmt.Sprintf("Cannot create PDF in storage: %v", err)
+			updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+			return fmt.Errorf("failed to create PDF %s for job %s: %w", pdfKey, jobID, err)
+		}
+		// Ghi PDF trực tiếp vào storage (không qua file tạm + os.Rename)
+		err = pdf.CreatePDFTo(pdfWriter, translatedText, pdf.Config{
+			SourceImagePath: job.ImagePath, // Nhúng ảnh gốc (không phải ảnh xám) nếu được yêu cầu
+			ImagePlacement:  job.EmbedImage,
+			Template:        pdfTemplate,
+			JobID:           jobID,
+			Date:            r.renderedAt,
+			Fonts:           pdfFonts,
+			Language:        language, // Chọn font, hướng chữ (RTL) và cách ngắt dòng (CJK)
+			Pages:           pdfPages, // Bảng được vẽ thành bảng
+			Summary:         summary,
+		})
+		if err == nil {
+			err = pdfWriter.Close()
+		} else {
+			pdfWriter.Abort()
+		}
+		r.report.Add("pdf", pdfMeter.Stop())
+		if err != nil {
+			errMsg := fmt.Sprintf("PDF generation error: %v", err)
+			updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+			return fmt.Errorf("PDF generation failed for job %s: %w", jobID, err)
+		}
+		pdfDuration := time.Since(pdfStartTime)
+		details["pdf_ms"] = strconv.FormatInt(pdfDuration.Milliseconds(), 10)
+		details["pdf_path"] = pdfKey // Key của PDF trong storage
+		if job.EmbedImage != "" {
+			details["embed_image"] = job.EmbedImage
+		}
+		saveStage(ctx, jobID, "pdf", pdfKey, details, before)
+		log.Printf("WORKER: PDF generation completed for job %s (%v). Output: %s", jobID, pdfDuration, pdfKey)
+	}
+	if err := renders.wait(ctx, details); err != nil {
+		errMsg := fmt.Sprintf("Output rendering error: %v", err)
+		updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+		return fmt.Errorf("output rendering failed for job %s: %w", jobID, err)
+	}
+	r.pdfKey = pdfKey
+	return nil
+}
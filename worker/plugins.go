@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+// StageFunc là một bước của pipeline: đọc và sửa văn bản, bản dịch hoặc file của job.
+// options là options của bước trong định nghĩa pipeline. Lỗi trả về làm job thất bại.
+type StageFunc func(ctx context.Context, job *Job, options map[string]string) error
+
+// Tên các bước có sẵn của worker, không thể thay bằng RegisterStage
+var builtinStages = map[string]bool{"ocr": true, "extract": true, "text": true, "cleanup": true, "translate": true, "pdf": true}
+
+// RegisterStage thêm một bước tùy chỉnh (che thông tin cá nhân, watermark, chuyển định
+// dạng...) dùng được trong PIPELINE_DEFINITION và pipeline gửi kèm job. Gọi trước Run,
+// thường trong init() của binary riêng của deployment:
+//
+//	func main() {
+//		worker.RegisterStage("redact", redactEmails)
+//		worker.Run(config.FromEnv())
+//	}
+//
+// Bước tùy chỉnh chạy lại khi job được giao lại, nên phải idempotent.
+func RegisterStage(name string, fn StageFunc) error {
+	if name == "" || fn == nil {
+		return fmt.Errorf("stage name and function are required")
+	}
+	if builtinStages[name] {
+		return fmt.Errorf("stage %q is a built-in stage", name)
+	}
+	stageRunner.Register(name, func(ctx context.Context, job *Job, options map[string]string) error {
+		enterStage(ctx, job.job.JobID, name)
+		if err := fn(ctx, job, options); err != nil {
+			return pipelineError(ctx, job.job.JobID, fmt.Errorf("stage %s: %w", name, err))
+		}
+		return nil
+	})
+	return nil
+}
+
+// Message trả về message của job (tùy chọn của request)
+func (r *Job) Message() messaging.JobMessage { return r.job }
+
+// Pages trả về văn bản từng trang (sau bước ocr, extract hoặc text), nil nếu chưa có
+func (r *Job) Pages() []string {
+	if r.rec == nil {
+		return nil
+	}
+	return r.rec.pages
+}
+
+// SetPages thay văn bản từng trang, dùng bởi các bước sau (dịch, PDF)
+func (r *Job) SetPages(pages []string) error {
+	if r.rec == nil {
+		return fmt.Errorf("the job has no text yet: run the stage after ocr, extract or text")
+	}
+	r.rec.pages = pages
+	return nil
+}
+
+// Translation trả về bản dịch từng trang (sau bước translate), nil nếu chưa dịch
+func (r *Job) Translation() []string {
+	if r.trans == nil {
+		return nil
+	}
+	return r.trans.Pages
+}
+
+// SetTranslation thay bản dịch từng trang trước bước pdf. Với job có bố cục (OCR_LAYOUT),
+// PDF được vẽ từ bố cục đã dịch nên chỉ văn bản lưu trong job thay đổi.
+func (r *Job) SetTranslation(pages []string) error {
+	if r.trans == nil {
+		return fmt.Errorf("the job has no translation yet: run the stage after translate")
+	}
+	r.trans.Pages = pages
+	return nil
+}
+
+// SourceLang trả về ngôn ngữ nguồn phát hiện được (ISO 639-1), "en" nếu không phát hiện
+func (r *Job) SourceLang() string { return r.Var("source_lang") }
+
+// TargetLang trả về ngôn ngữ đích của bản dịch
+func (r *Job) TargetLang() string { return r.targetLang }
+
+// PDFKey trả về key của PDF kết quả trong Storage (sau bước pdf), rỗng nếu chưa có.
+// Bước watermark ghi đè file tại key này.
+func (r *Job) PDFKey() string { return r.pdfKey }
+
+// Storage trả về nơi lưu PDF và các output của job (STORAGE_BACKEND)
+func (r *Job) Storage() storage.Storage { return artifacts }
+
+// SetDetail ghi một thông tin của bước vào details của job, trả về trong trường custom
+// của status (vd. số thông tin cá nhân đã che, key của file đã chuyển định dạng)
+func (r *Job) SetDetail(key, value string) {
+	r.details["custom."+key] = value
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/fleet"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pipeline"
+)
+
+func TestRegisterStage(t *testing.T) {
+	ctx := context.Background()
+	useTestRedis(t)
+	fleetTracker = fleet.NewTracker("test", 1)
+
+	noop := func(context.Context, *Job, map[string]string) error { return nil }
+	for name, fn := range map[string]StageFunc{"": noop, "nil_function": nil, "ocr": noop, "pdf": noop} {
+		if err := RegisterStage(name, fn); err == nil {
+			t.Errorf("RegisterStage(%q) accepted", name)
+		}
+	}
+
+	// Bước tùy chỉnh đọc và thay văn bản của job, option từ định nghĩa pipeline
+	if err := RegisterStage("test_redact", func(_ context.Context, job *Job, options map[string]string) error {
+		pages := job.Pages()
+		for i := range pages {
+			pages[i] = strings.ReplaceAll(pages[i], options["word"], "***")
+		}
+		job.SetDetail("redacted", "true")
+		return job.SetPages(pages)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	errRedact := errors.New("no dictionary")
+	if err := RegisterStage("test_fail", func(context.Context, *Job, map[string]string) error { return errRedact }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := jobStore.SetStatus(ctx, "job1", model.StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	run := &Job{job: messaging.JobMessage{JobID: "job1"}, details: map[string]string{}, rec: &recognition{pages: []string{"call alice", "alice"}}}
+	def := pipeline.Definition{Stages: []pipeline.Stage{{Name: "test_redact", Options: map[string]string{"word": "alice"}}}}
+	ran, err := stageRunner.Run(ctx, def, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ran, []string{"test_redact"}) || !reflect.DeepEqual(run.Pages(), []string{"call ***", "***"}) {
+		t.Errorf("ran %v, pages %q", ran, run.Pages())
+	}
+	if run.details["custom.redacted"] != "true" {
+		t.Errorf("details = %v, want the custom detail", run.details)
+	}
+	job, err := jobStore.Load(ctx, "job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Details["stage"] != "test_redact" {
+		t.Errorf("stage = %q, want the custom stage recorded", job.Details["stage"])
+	}
+
+	// Lỗi của bước làm job thất bại
+	def = pipeline.Definition{Stages: []pipeline.Stage{{Name: "test_fail"}}}
+	if _, err := stageRunner.Run(ctx, def, run); !errors.Is(err, errRedact) {
+		t.Fatalf("Run = %v, want the stage error", err)
+	}
+	job, err = jobStore.Load(ctx, "job1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != model.StatusFailed || !strings.Contains(job.Error, "stage test_fail: no dictionary") {
+		t.Errorf("job = %s %q, want failed with the stage error", job.Status, job.Error)
+	}
+
+	// SetPages trước khi có văn bản
+	if err := (&Job{}).SetPages([]string{"x"}); err == nil {
+		t.Error("SetPages without text accepted")
+	}
+}
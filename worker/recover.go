@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+)
+
+// --- Chạy processImage với recover() để một job lỗi không làm dừng worker ---
+// Khi panic: đánh dấu job failed, lưu stack trace và cách ly ảnh đầu vào
+func processImageSafe(ctx context.Context, job messaging.JobMessage) (details map[string]string, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		stack := debug.Stack()
+		log.Printf("WORKER: PANIC while processing job %s: %v\n%s", job.JobID, r, stack)
+
+		details = quarantineJob(job, r, stack)
+		errMsg := fmt.Sprintf("Internal error while processing job (panic: %v)", r)
+		if err := updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg); err != nil {
+			log.Printf("WORKER: Failed to mark panicked job %s as failed: %v", job.JobID, err)
+		}
+		if err := saveJobDetails(ctx, job.JobID, details); err != nil {
+			log.Printf("WORKER: Failed to save quarantine details for job %s: %v", job.JobID, err)
+		}
+		err = fmt.Errorf("panic while processing job %s: %v", job.JobID, r)
+	}()
+
+	return processImage(ctx, job)
+}
+
+// --- Cách ly ảnh đầu vào và ghi stack trace vào thư mục quarantine ---
+// Trả về details chứa đường dẫn các file đã lưu (bỏ qua các file không lưu được)
+func quarantineJob(job messaging.JobMessage, panicValue interface{}, stack []byte) map[string]string {
+	details := map[string]string{"quarantined": "true"}
+
+	jobDir := filepath.Join(cfg.QuarantineDir(), job.JobID) // Ảnh gây panic và stack trace
+	if err := os.MkdirAll(jobDir, os.ModePerm); err != nil {
+		log.Printf("WORKER: Cannot create quarantine directory %s: %v", jobDir, err)
+		return details
+	}
+
+	stackPath := filepath.Join(jobDir, "stack.txt")
+	report := fmt.Sprintf("job_id: %s\nimage_path: %s\ntime: %s\npanic: %v\n\n%s",
+		job.JobID, job.ImagePath, time.Now().Format(time.RFC3339), panicValue, stack)
+	if err := os.WriteFile(stackPath, []byte(report), 0644); err != nil {
+		log.Printf("WORKER: Failed to write stack trace for job %s: %v", job.JobID, err)
+	} else {
+		details["stack_trace_path"] = stackPath
+	}
+
+	if job.ImagePath != "" {
+		imageCopy := filepath.Join(jobDir, filepath.Base(job.ImagePath))
+		if err := copyFile(job.ImagePath, imageCopy); err != nil {
+			log.Printf("WORKER: Failed to quarantine input image for job %s: %v", job.JobID, err)
+		} else {
+			details["quarantine_path"] = imageCopy
+		}
+	}
+
+	log.Printf("WORKER: Job %s quarantined in %s", job.JobID, jobDir)
+	return details
+}
+
+// --- Sao chép file (giữ nguyên file gốc) ---
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
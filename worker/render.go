@@ -0,0 +1,170 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+)
+
+// Hàng đợi render riêng cho từng loại output: tối đa renderConcurrency output
+// cùng loại được render cùng lúc trên worker, output loại khác không phải chờ
+var renderQueues = map[string]chan struct{}{}
+
+// --- Tạo hàng đợi render theo RENDER_CONCURRENCY (mặc định 2 output mỗi loại) ---
+func initRenderQueues() error {
+	n := 2
+	if v := os.Getenv("RENDER_CONCURRENCY"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("RENDER_CONCURRENCY must be at least 1, got %q", v)
+		}
+	}
+	for output := range messaging.OutputFiles {
+		renderQueues[output] = make(chan struct{}, n)
+	}
+	return nil
+}
+
+// Kết quả render một output thêm
+type renderResult struct {
+	key      string // Key của file trong storage
+	duration time.Duration
+	err      error
+}
+
+// renderSet: các output thêm của một job, render song song với PDF bản dịch
+type renderSet struct {
+	jobID   string
+	outputs []string
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	results map[string]renderResult
+}
+
+// --- Bắt đầu render các output thêm của job (job.Outputs) trong goroutine riêng ---
+// Output đã có trong hash model.OutputsKey (render ở lần giao trước) được bỏ qua.
+// language là ngôn ngữ của translatedText (đọc bằng giọng của ngôn ngữ này).
+func startRenders(ctx context.Context, job messaging.JobMessage, rec *recognition, ocrText, translatedText, language string) *renderSet {
+	set := &renderSet{jobID: job.JobID, outputs: job.Outputs, results: map[string]renderResult{}}
+	done, err := redisClient.HGetAll(ctx, model.OutputsKey(job.JobID)).Result()
+	if err != nil {
+		log.Printf("WORKER: Failed to read rendered outputs of job %s: %v. Rendering all outputs.", job.JobID, err)
+	}
+	for _, output := range job.Outputs {
+		if key, ok := done[output]; ok {
+			set.results[output] = renderResult{key: key}
+			continue
+		}
+		set.wg.Add(1)
+		go func() {
+			defer set.wg.Done()
+			result := renderOutput(ctx, job, output, rec, ocrText, translatedText, language)
+			set.mu.Lock()
+			set.results[output] = result
+			set.mu.Unlock()
+		}()
+	}
+	return set
+}
+
+// --- Render một output vào storage (chờ chỗ trống trong hàng đợi của loại output) ---
+func renderOutput(ctx context.Context, job messaging.JobMessage, output string, rec *recognition, ocrText, translatedText, language string) renderResult {
+	queue := renderQueues[output]
+	select {
+	case queue <- struct{}{}:
+		defer func() { <-queue }()
+	case <-ctx.Done():
+		return renderResult{err: ctx.Err()}
+	}
+	if output == messaging.OutputAudio && speechSynthesizer == nil {
+		return renderResult{err: fmt.Errorf("text-to-speech is not available on this worker")}
+	}
+	startTime := time.Now()
+	key := model.OutputKey(job.JobID, messaging.OutputFiles[output])
+	w, err := artifacts.Create(ctx, key)
+	if err != nil {
+		return renderResult{err: err}
+	}
+	switch output {
+	case messaging.OutputOriginalPDF:
+		var pages []pdf.Page // Bố cục gốc (bảng, cột) nếu có
+		for _, layout := range rec.layouts {
+			pages = append(pages, layoutPage(layout))
+		}
+		err = pdf.CreatePDFTo(w, ocrText, pdf.Config{
+			Template: pdfTemplate,
+			JobID:    job.JobID,
+			Fonts:    pdfFonts,
+			Language: rec.sourceLang,
+			Pages:    pages,
+		})
+	case messaging.OutputText:
+		_, err = w.Write([]byte(translatedText))
+	case messaging.OutputAudio:
+		// Các trang được đọc liên tiếp như các đoạn văn
+		if language == "" {
+			language = translator.SourceLanguage
+		}
+		err = speechSynthesizer.Synthesize(ctx, w, strings.ReplaceAll(translatedText, pdf.PageBreak, "\n\n"), language)
+	default:
+		err = fmt.Errorf("unknown output %q", output)
+	}
+	if err == nil {
+		err = w.Close()
+	} else {
+		w.Abort()
+	}
+	if err != nil {
+		return renderResult{err: err}
+	}
+	// Ghi nhận output vào result store (barrier hoàn tất job)
+	pipe := redisClient.Pipeline()
+	pipe.HSet(ctx, model.OutputsKey(job.JobID), output, key)
+	pipe.Expire(ctx, model.OutputsKey(job.JobID), jobTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return renderResult{err: fmt.Errorf("failed to record output: %w", err)}
+	}
+	return renderResult{key: key, duration: time.Since(startTime)}
+}
+
+// --- Barrier: chờ các output thêm và kiểm tra trong result store rằng tất cả đã có ---
+// Thời gian render và key của từng output được ghi vào details
+func (s *renderSet) wait(ctx context.Context, details map[string]string) error {
+	s.wg.Wait()
+	if len(s.outputs) == 0 {
+		return nil
+	}
+	var failed []string
+	for _, output := range s.outputs {
+		if result := s.results[output]; result.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", output, result.err))
+		} else if result.duration > 0 {
+			details[output+"_ms"] = strconv.FormatInt(result.duration.Milliseconds(), 10)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to render %s", strings.Join(failed, "; "))
+	}
+	done, err := redisClient.HGetAll(ctx, model.OutputsKey(s.jobID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read rendered outputs: %w", err)
+	}
+	for _, output := range s.outputs {
+		if _, ok := done[output]; !ok {
+			return fmt.Errorf("output %s is missing from the result store", output)
+		}
+	}
+	details["outputs"] = strings.Join(s.outputs, ",")
+	return nil
+}
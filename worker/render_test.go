@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/storage"
+)
+
+func TestRenderBarrier(t *testing.T) {
+	ctx := context.Background()
+	mr := useTestRedis(t)
+	dir := t.TempDir()
+	artifacts = storage.NewFileStorage(dir)
+	if err := initRenderQueues(); err != nil {
+		t.Fatal(err)
+	}
+	speechSynthesizer = nil
+
+	// Output thêm render xong: có trong result store và trong details
+	job := messaging.JobMessage{JobID: "job1", Outputs: []string{messaging.OutputText}}
+	details := map[string]string{}
+	if err := startRenders(ctx, job, &recognition{}, "ocr", "bản dịch", "vi").wait(ctx, details); err != nil {
+		t.Fatal(err)
+	}
+	if details["outputs"] != messaging.OutputText {
+		t.Errorf("details = %v, want the outputs listed", details)
+	}
+	key := model.OutputKey("job1", messaging.OutputFiles[messaging.OutputText])
+	if data, err := os.ReadFile(filepath.Join(dir, key)); err != nil || string(data) != "bản dịch" {
+		t.Errorf("rendered text = %q, %v", data, err)
+	}
+	if got := mr.HGet(model.OutputsKey("job1"), messaging.OutputText); got != key {
+		t.Errorf("result store = %q, want %q", got, key)
+	}
+
+	// Lần giao lại: output đã render được bỏ qua, không ghi lại file
+	os.Remove(filepath.Join(dir, key))
+	details = map[string]string{}
+	if err := startRenders(ctx, job, &recognition{}, "ocr", "bản dịch khác", "vi").wait(ctx, details); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, key)); !os.IsNotExist(err) {
+		t.Errorf("output rendered again: %v", err)
+	}
+	if _, ok := details[messaging.OutputText+"_ms"]; ok || details["outputs"] != messaging.OutputText {
+		t.Errorf("details of the redelivery = %v", details)
+	}
+
+	// Lỗi render của một output làm hỏng job
+	job = messaging.JobMessage{JobID: "job2", Outputs: []string{messaging.OutputText, messaging.OutputAudio}}
+	err := startRenders(ctx, job, &recognition{}, "ocr", "bản dịch", "vi").wait(ctx, map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "failed to render audio: text-to-speech is not available") {
+		t.Errorf("wait = %v, want the audio error", err)
+	}
+
+	// Output báo thành công nhưng không có trong result store (hash hết hạn)
+	set := &renderSet{jobID: "job3", outputs: []string{messaging.OutputText}, results: map[string]renderResult{
+		messaging.OutputText: {key: "outputs/job3/translated.txt"},
+	}}
+	if err := set.wait(ctx, map[string]string{}); err == nil || err.Error() != "output txt is missing from the result store" {
+		t.Errorf("wait = %v, want the missing output", err)
+	}
+
+	// Không có output thêm
+	if err := (&renderSet{jobID: "job4"}).wait(ctx, map[string]string{}); err != nil {
+		t.Errorf("wait without outputs = %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+)
+
+// --- Văn bản của một vùng crop (OCR theo vùng) ---
+// Lưu trong Redis ({jobID}:regions) dưới dạng JSON để API trả về
+type regionResult struct {
+	messaging.CropRegion
+	Frame          int    `json:"frame"` // Frame của ảnh (GIF động), 0 với ảnh thường
+	Text           string `json:"text"`
+	TranslatedText string `json:"translated_text"`
+
+	page, first, last int // Trang và các vùng [first, last) của bố cục trang
+}
+
+// --- Chuyển vùng crop của request sang imagefilter (nil: cả ảnh) ---
+func cropRect(crop *messaging.CropRegion) *imagefilter.Rect {
+	if crop == nil {
+		return nil
+	}
+	return &imagefilter.Rect{X: crop.X, Y: crop.Y, Width: crop.Width, Height: crop.Height}
+}
+
+// --- Điền bản dịch của từng vùng crop từ bố cục đã dịch ---
+func setRegionTranslations(regions []regionResult, translated []*ocr.Layout) {
+	for i, r := range regions {
+		if r.page < len(translated) && translated[r.page] != nil {
+			part := &ocr.Layout{Regions: translated[r.page].Regions[r.first:r.last]}
+			regions[i].TranslatedText = part.Text()
+		}
+	}
+}
+
+// --- Lưu văn bản từng vùng crop (không có vùng thì bỏ qua) ---
+func saveJobRegions(ctx context.Context, jobID, cacheKey string, regions []regionResult) error {
+	if len(regions) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(regions)
+	if err != nil {
+		return err
+	}
+	if err := redisClient.Set(ctx, fmt.Sprintf("%s:regions", jobID), data, jobTTL).Err(); err != nil {
+		return err
+	}
+	return resultCache.Set(ctx, fmt.Sprintf("%s:regions", cacheKey), string(data), cacheTTL)
+}
+
+// --- Hash danh sách vùng crop (thứ tự vùng ảnh hưởng đến kết quả) ---
+func regionsHash(regions []messaging.CropRegion) string {
+	data, _ := json.Marshal(regions)
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:8])
+}
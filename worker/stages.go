@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/imagefilter"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+)
+
+// --- Mốc hoàn thành của từng bước ({jobID}:stage:{stage}) ---
+// Broker giao message ít nhất một lần: khi job được giao lại (worker chết trước
+// khi commit, reaper gửi lại), các bước đã xong được bỏ qua và kết quả của
+// chúng được lấy từ mốc. Tránh tạo PDF trùng và dịch lại (tốn quota dịch).
+type stageMarker struct {
+	Details map[string]string `json:"details"` // Thông tin chi tiết do bước ghi vào details
+	Output  json.RawMessage   `json:"output"`  // Kết quả của bước
+}
+
+func stageKey(jobID, stage string) string {
+	return fmt.Sprintf("%s:stage:%s", jobID, stage)
+}
+
+// loadStage trả về true nếu bước đã hoàn thành ở lần giao trước;
+// kết quả được đọc vào output và details của bước được khôi phục
+func loadStage(ctx context.Context, jobID, stage string, output any, details map[string]string) bool {
+	data, err := redisClient.Get(ctx, stageKey(jobID, stage)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("WORKER: Failed to read %s stage marker of job %s: %v. Running the stage.", stage, jobID, err)
+		}
+		return false
+	}
+	var marker stageMarker
+	if err = json.Unmarshal(data, &marker); err == nil {
+		err = json.Unmarshal(marker.Output, output)
+	}
+	if err != nil {
+		log.Printf("WORKER: Invalid %s stage marker of job %s: %v. Running the stage.", stage, jobID, err)
+		return false
+	}
+	maps.Copy(details, marker.Details)
+	if resumed := details["resumed_stages"]; resumed != "" {
+		details["resumed_stages"] = resumed + "," + stage
+	} else {
+		details["resumed_stages"] = stage
+	}
+	log.Printf("WORKER: Job %s was redelivered, skipping completed stage %s", jobID, stage)
+	return true
+}
+
+// saveStage ghi mốc sau khi bước hoàn thành. before là details trước khi
+// chạy bước: chỉ các giá trị bước thêm vào được lưu trong mốc.
+func saveStage(ctx context.Context, jobID, stage string, output any, details, before map[string]string) {
+	marker := stageMarker{Details: make(map[string]string)}
+	for k, v := range details {
+		if old, ok := before[k]; !ok || old != v {
+			marker.Details[k] = v
+		}
+	}
+	var err error
+	if marker.Output, err = json.Marshal(output); err == nil {
+		var data []byte
+		if data, err = json.Marshal(marker); err == nil {
+			err = redisClient.Set(ctx, stageKey(jobID, stage), data, jobTTL).Err()
+		}
+	}
+	if err != nil {
+		// Chỉ mất khả năng bỏ qua bước khi job được giao lại
+		log.Printf("WORKER: Failed to save %s stage marker of job %s: %v", stage, jobID, err)
+	}
+}
+
+// --- Mốc từng phần của một bước đang chạy ({jobID}:stage:{part}) ---
+// Khác mốc của bước: không khôi phục details, chỉ để bước tiếp tục từ phần đã xong
+func loadCheckpoint(ctx context.Context, jobID, part string, output any) bool {
+	data, err := redisClient.Get(ctx, stageKey(jobID, part)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("WORKER: Failed to read %s checkpoint of job %s: %v", part, jobID, err)
+		}
+		return false
+	}
+	if err := json.Unmarshal(data, output); err != nil {
+		log.Printf("WORKER: Invalid %s checkpoint of job %s: %v", part, jobID, err)
+		return false
+	}
+	return true
+}
+
+func saveCheckpoint(ctx context.Context, jobID, part string, output any) {
+	data, err := json.Marshal(output)
+	if err == nil {
+		err = redisClient.Set(ctx, stageKey(jobID, part), data, jobTTL).Err()
+	}
+	if err != nil {
+		log.Printf("WORKER: Failed to save %s checkpoint of job %s: %v", part, jobID, err)
+	}
+}
+
+// --- Mốc của một frame/vùng crop trong bước OCR ---
+// Ảnh nhiều frame hoặc nhiều vùng: job giao lại sau khi worker chết dùng lại ảnh
+// đã lọc (nếu file còn) và văn bản của các phần đã OCR xong
+type ocrCheckpoint struct {
+	FilteredPath string                 `json:"filtered_path"`
+	Correction   imagefilter.Correction `json:"correction"`
+	Done         bool                   `json:"done"` // Đã OCR (và xuất hOCR/ALTO nếu có)
+	Text         string                 `json:"text,omitempty"`
+	Layout       *ocr.Layout            `json:"layout,omitempty"`
+	Detection    *ocr.Detection         `json:"detection,omitempty"`
+	Documents    map[string]string      `json:"documents,omitempty"` // Định dạng -> tài liệu (ocr_formats)
+}
+
+// --- Kết quả bước OCR/đọc PDF lưu trong mốc ---
+type recognitionMarker struct {
+	Pages      []string            `json:"pages"`
+	Layouts    []*ocr.Layout       `json:"layouts,omitempty"`
+	SourceLang string              `json:"source_lang,omitempty"`
+	Regions    []storedRegion      `json:"regions,omitempty"`
+	Formats    map[string][]string `json:"formats,omitempty"`
+}
+
+// Vùng crop kèm vị trí trong bố cục trang (không có trong JSON trả về cho API)
+type storedRegion struct {
+	regionResult
+	Page  int `json:"page"`
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+func newRecognitionMarker(rec *recognition) recognitionMarker {
+	marker := recognitionMarker{Pages: rec.pages, Layouts: rec.layouts, SourceLang: rec.sourceLang, Formats: rec.formats}
+	for _, r := range rec.regions {
+		marker.Regions = append(marker.Regions, storedRegion{regionResult: r, Page: r.page, First: r.first, Last: r.last})
+	}
+	return marker
+}
+
+func (m recognitionMarker) recognition() *recognition {
+	rec := &recognition{pages: m.Pages, layouts: m.Layouts, sourceLang: m.SourceLang, formats: m.Formats}
+	for _, r := range m.Regions {
+		region := r.regionResult
+		region.page, region.first, region.last = r.Page, r.First, r.Last
+		rec.regions = append(rec.regions, region)
+	}
+	return rec
+}
+
+// --- Kết quả bước dịch lưu trong mốc ---
+type translationMarker struct {
+	Pages   []string      `json:"pages"`
+	Layouts []*ocr.Layout `json:"layouts,omitempty"`
+}
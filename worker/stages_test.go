@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/fleet"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/translator"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// countingProvider dịch sang chữ hoa và đếm số lần được gọi
+type countingProvider struct{ calls int }
+
+func (*countingProvider) Name() string { return "counting" }
+
+func (p *countingProvider) Translate(text, _, _ string) (string, error) {
+	p.calls++
+	return strings.ToUpper(text), nil
+}
+
+func TestStageRedelivery(t *testing.T) {
+	ctx := context.Background()
+	mr := useTestRedis(t)
+	fleetTracker = fleet.NewTracker("test", 1)
+	provider := &countingProvider{}
+	previous := translator.CurrentProvider()
+	translator.SetProvider(provider)
+	t.Cleanup(func() { translator.SetProvider(previous) })
+	if err := jobStore.SetStatus(ctx, "job1", model.StatusProcessing, ""); err != nil {
+		t.Fatal(err)
+	}
+	newRun := func(details map[string]string) *Job {
+		return &Job{job: messaging.JobMessage{JobID: "job1"}, details: details, report: usage.Report{}, targetLang: "vi",
+			rec: &recognition{pages: []string{"total invoice", "paid"}}}
+	}
+
+	// Lần giao đầu: bước dịch chạy và ghi mốc
+	first := newRun(map[string]string{"ocr_ms": "120"})
+	if err := translateStage(ctx, first, nil); err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != 2 || first.details["translation_provider"] != "counting" {
+		t.Fatalf("%d provider calls, details %v", provider.calls, first.details)
+	}
+	if ttl := mr.TTL(stageKey("job1", "translate")); ttl != jobTTL {
+		t.Errorf("marker TTL = %v, want %v", ttl, jobTTL)
+	}
+
+	// Lần giao lại (worker khác, details rỗng): bản dịch và details của bước được khôi phục
+	second := newRun(map[string]string{})
+	if err := translateStage(ctx, second, nil); err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("%d provider calls, want the translation reused", provider.calls)
+	}
+	if want := []string{"TOTAL INVOICE", "PAID"}; !reflect.DeepEqual(second.trans.Pages, want) {
+		t.Errorf("pages = %q, want %q", second.trans.Pages, want)
+	}
+	for _, key := range []string{"translation_provider", "translate_ms", "target_lang", "translated_chars"} {
+		if second.details[key] != first.details[key] {
+			t.Errorf("details[%s] = %q, want %q", key, second.details[key], first.details[key])
+		}
+	}
+	if _, ok := second.details["ocr_ms"]; ok {
+		t.Error("details set before the stage were saved in its marker")
+	}
+	if second.details["resumed_stages"] != "translate" {
+		t.Errorf("resumed_stages = %q", second.details["resumed_stages"])
+	}
+
+	// Các bước bỏ qua được nối vào resumed_stages
+	saveStage(ctx, "job1", "pdf", "outputs/job1/result.pdf", map[string]string{"pdf_ms": "30"}, nil)
+	var pdfKey string
+	if !loadStage(ctx, "job1", "pdf", &pdfKey, second.details) || pdfKey != "outputs/job1/result.pdf" {
+		t.Fatalf("pdf marker = %q", pdfKey)
+	}
+	if second.details["resumed_stages"] != "translate,pdf" || second.details["pdf_ms"] != "30" {
+		t.Errorf("details = %v", second.details)
+	}
+
+	// Mốc hỏng hoặc không có: bước chạy lại
+	mr.Set(stageKey("job1", "pdf"), "{")
+	if loadStage(ctx, "job1", "pdf", &pdfKey, map[string]string{}) {
+		t.Error("invalid marker loaded")
+	}
+	if loadStage(ctx, "job2", "translate", &pdfKey, map[string]string{}) {
+		t.Error("missing marker loaded")
+	}
+
+	// Mốc từng phần của bước
+	saveCheckpoint(ctx, "job1", "ocr_page_1", []string{"page 1"})
+	var pages []string
+	if !loadCheckpoint(ctx, "job1", "ocr_page_1", &pages) || !reflect.DeepEqual(pages, []string{"page 1"}) {
+		t.Errorf("checkpoint = %q", pages)
+	}
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/usage"
+)
+
+// --- Tóm tắt bản dịch (SUMMARIZATION hoặc summarize=true của job) ---
+// Vài câu để phân loại nhanh một lô tài liệu lớn mà không phải đọc từng bản dịch.
+// Tóm tắt bằng ngôn ngữ của bản dịch (văn bản gốc nếu pipeline không có bước translate).
+func summarizeStage(ctx context.Context, r *Job, _ map[string]string) error {
+	if r.rec == nil {
+		return errNoText(ctx, r.job.JobID, "summarize")
+	}
+	jobID := r.job.JobID
+	var summary string
+	if !loadStage(ctx, jobID, "summarize", &summary, r.details) {
+		before := maps.Clone(r.details)
+		summaryStartTime := time.Now()
+		enterStage(ctx, jobID, "summarize")
+		_, summaryMeter := usage.Start(ctx)
+		lang := r.targetLang
+		if r.trans == nil {
+			lang = r.Var("source_lang")
+		}
+		var err error
+		summary, err = summarizer.Summarize(r.translatedText(), lang)
+		r.report.Add("summarize", summaryMeter.Stop())
+		if err != nil {
+			errMsg := fmt.Sprintf("Summarization error: %v", err)
+			updateJobStatus(ctx, jobID, model.StatusFailed, errMsg)
+			return fmt.Errorf("summarization failed for job %s: %w", jobID, err)
+		}
+		r.details["summarizer"] = summarizer.Name()
+		r.details["summary_ms"] = strconv.FormatInt(time.Since(summaryStartTime).Milliseconds(), 10)
+		saveStage(ctx, jobID, "summarize", summary, r.details, before)
+		log.Printf("WORKER: Summarized job %s with %s (%d characters)", jobID, summarizer.Name(), len(summary))
+	}
+	r.summary = &summary
+	return nil
+}
+
+// --- Lưu tóm tắt của job ({jobID}:summary) để API trả về trong status ---
+// Bước không chạy thì bỏ qua
+func saveJobSummary(ctx context.Context, jobID, cacheKey string, summary *string) error {
+	if summary == nil {
+		return nil
+	}
+	if err := redisClient.Set(ctx, fmt.Sprintf("%s:summary", jobID), *summary, jobTTL).Err(); err != nil {
+		return err
+	}
+	return resultCache.Set(ctx, fmt.Sprintf("%s:summary", cacheKey), *summary, cacheTTL)
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mxngoc2104/KTPM-CS2/pkg/messaging"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/model"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/ocr"
+	"github.com/mxngoc2104/KTPM-CS2/pkg/pdf"
+)
+
+// --- Đọc văn bản do client gửi (job text: văn bản OCR đã sửa, không cần OCR) ---
+// Các trang cách nhau bởi pdf.PageBreak như văn bản OCR của job gốc
+func readTextPages(ctx context.Context, job messaging.JobMessage, details map[string]string) (*recognition, error) {
+	enterStage(ctx, job.JobID, "text")
+	data, err := os.ReadFile(job.ImagePath)
+	if err != nil {
+		errMsg := fmt.Sprintf("Cannot read text: %v", err)
+		updateJobStatus(ctx, job.JobID, model.StatusFailed, errMsg)
+		return nil, fmt.Errorf("failed to read text for job %s: %w", job.JobID, err)
+	}
+	pages := strings.Split(string(data), pdf.PageBreak)
+	details["pages"] = strconv.Itoa(len(pages))
+	log.Printf("WORKER: Read %d page(s) of text for job %s", len(pages), job.JobID)
+
+	sourceLang, _ := ocr.DetectTextLanguage(string(data))
+	if sourceLang != "" {
+		details["source_lang"] = sourceLang
+	}
+	return &recognition{pages: pages, sourceLang: sourceLang}, nil
+}